@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/daohu527/vlink/pkg/controlcenter"
+	"github.com/daohu527/vlink/pkg/logging"
 	"github.com/daohu527/vlink/pkg/protocol"
 )
 
@@ -31,14 +32,44 @@ func main() {
 	certFile := flag.String("cert", "", "path to TLS certificate")
 	keyFile := flag.String("key", "", "path to TLS private key")
 	caFile := flag.String("ca", "", "path to CA certificate")
+	crlFile := flag.String("crl", "", "path to a certificate revocation list checked against the broker's certificate (disabled when empty)")
+	username := flag.String("username", "", "MQTT username (password is read from VLINK_MQTT_PASSWORD)")
+	httpAddr := flag.String("http", "", "address to serve /vehicles, /events and /debug/vlink on (disabled when empty)")
+	grpcAddr := flag.String("grpc", "", "address to serve the gRPC ControlCenter API on (disabled when empty)")
+	proximity := flag.Float64("proximity", 0, "warn when two vehicles come within this many metres (disabled when 0)")
+	dryRun := flag.Bool("dry-run", false, "log everything instead of publishing it, commands included (operator training)")
+	snapshot := flag.String("snapshot", "", "file to persist the vehicle shadow in across restarts (disabled when empty)")
+	codecName := flag.String("codec", "json", "wire codec: json, protobuf or compat (writes json, reads both)")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
+	connectTimeout := flag.Duration("connect-timeout", 0, "give up if the broker is not reached within this long (0 retries until interrupted)")
 	flag.Parse()
 
+	codec, err := protocol.CodecByName(*codecName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger, err := logging.ByName(*logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	cfg := controlcenter.Config{
 		BrokerURL: *broker,
 		ClientID:  *clientID,
 		CertFile:  *certFile,
 		KeyFile:   *keyFile,
 		CAFile:    *caFile,
+		CRLFile:   *crlFile,
+		Username:  *username,
+		Password:  os.Getenv("VLINK_MQTT_PASSWORD"),
+
+		ProximityThreshold: *proximity,
+		DryRun:             *dryRun,
+		Codec:              codec,
+		HTTPAddr:           *httpAddr,
+		GRPCAddr:           *grpcAddr,
+		SnapshotPath:       *snapshot,
+		Logger:             logger,
 	}
 
 	srv := controlcenter.New(cfg)
@@ -50,16 +81,62 @@ func main() {
 		// In production: trigger video stream, notify operator dashboard, etc.
 	})
 
-	if err := srv.Connect(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	connectCtx, cancel := ctx, context.CancelFunc(func() {})
+	if *connectTimeout > 0 {
+		connectCtx, cancel = context.WithTimeout(ctx, *connectTimeout)
+	}
+	err = srv.ConnectContext(connectCtx)
+	cancel()
+	if err != nil {
 		log.Fatalf("connect: %v", err)
 	}
 	defer srv.Disconnect()
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
-
 	log.Printf("control-center %s started", *clientID)
 
+	// SIGHUP re-reads the TLS certificate, key and CA after a rotation.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := srv.ReloadTLS(); err != nil {
+				log.Printf("reload tls: %v", err)
+			}
+		}
+	}()
+
+	if *proximity > 0 {
+		go func() {
+			t := time.NewTicker(time.Second)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					srv.CheckProximity()
+				}
+			}
+		}()
+	}
+
+	// Regrade shadow liveness (online/degraded/stale/offline) every second.
+	go func() {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				srv.Shadows().CheckLiveness()
+			}
+		}
+	}()
+
 	// Periodically print a summary of known vehicles.
 	go func() {
 		t := time.NewTicker(10 * time.Second)
@@ -0,0 +1,52 @@
+// Command shadow-diff compares the shadows of two control centers, e.g. an
+// active and a standby one, through their HTTP query APIs and reports where
+// they disagree. It exits with status 1 when they diverge.
+//
+// Usage:
+//
+//	shadow-diff -a http://cc-active:8080 -b http://cc-standby:8080 -tolerance 2s
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/controlcenter"
+)
+
+func main() {
+	a := flag.String("a", "", "base URL of the first control center's HTTP API")
+	b := flag.String("b", "", "base URL of the second control center's HTTP API")
+	tolerance := flag.Duration("tolerance", time.Second, "allowed difference between latest state timestamps")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout for fetching both snapshots")
+	flag.Parse()
+
+	if *a == "" || *b == "" {
+		log.Fatal("both -a and -b are required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	r, err := controlcenter.DiffCenters(ctx, *a, *b, *tolerance)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, id := range r.OnlyInA {
+		fmt.Printf("only in a: %s\n", id)
+	}
+	for _, id := range r.OnlyInB {
+		fmt.Printf("only in b: %s\n", id)
+	}
+	for _, d := range r.Diverged {
+		fmt.Printf("diverged:  %s (a %d, b %d, skew %v)\n", d.VehicleID, d.TimestampA, d.TimestampB, d.Skew())
+	}
+	if !r.Consistent() {
+		os.Exit(1)
+	}
+	fmt.Println("consistent")
+}
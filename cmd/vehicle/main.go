@@ -22,6 +22,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/daohu527/vlink/pkg/logging"
 	"github.com/daohu527/vlink/pkg/protocol"
 	"github.com/daohu527/vlink/pkg/vehicle"
 )
@@ -33,19 +34,36 @@ func main() {
 	keyFile := flag.String("key", "", "path to vehicle TLS private key")
 	caFile := flag.String("ca", "", "path to CA certificate")
 	hz := flag.Float64("hz", 10, "state publish frequency (10-50 Hz)")
+	username := flag.String("username", "", "MQTT username (password is read from VLINK_MQTT_PASSWORD)")
+	codecName := flag.String("codec", "json", "wire codec: json, protobuf or compat (writes json, reads both)")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
+	connectTimeout := flag.Duration("connect-timeout", 0, "give up if the broker is not reached within this long (0 retries until interrupted)")
 	flag.Parse()
 
 	if *id == "" {
 		log.Fatal("vehicle id must not be empty")
 	}
+	codec, err := protocol.CodecByName(*codecName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger, err := logging.ByName(*logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	cfg := vehicle.Config{
-		VehicleID: *id,
-		BrokerURL: *broker,
-		CertFile:  *certFile,
-		KeyFile:   *keyFile,
-		CAFile:    *caFile,
-		PublishHz: *hz,
+		VehicleID:   *id,
+		BrokerURL:   *broker,
+		CertFile:    *certFile,
+		KeyFile:     *keyFile,
+		CAFile:      *caFile,
+		Username:    *username,
+		Password:    os.Getenv("VLINK_MQTT_PASSWORD"),
+		PublishHz:   *hz,
+		Codec:       codec,
+		AlertPolicy: vehicle.DefaultAlertPolicy,
+		Logger:      logger,
 	}
 
 	agent := vehicle.New(cfg, func() *protocol.VehicleState {
@@ -62,13 +80,30 @@ func main() {
 		}
 	})
 
-	if err := agent.Connect(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	connectCtx, cancel := ctx, context.CancelFunc(func() {})
+	if *connectTimeout > 0 {
+		connectCtx, cancel = context.WithTimeout(ctx, *connectTimeout)
+	}
+	err = agent.ConnectContext(connectCtx)
+	cancel()
+	if err != nil {
 		log.Fatalf("connect: %v", err)
 	}
 	defer agent.Disconnect()
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+	// SIGHUP re-reads the TLS certificate, key and CA after a rotation.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := agent.ReloadTLS(); err != nil {
+				log.Printf("reload tls: %v", err)
+			}
+		}
+	}()
 
 	log.Printf("vehicle agent %s started at %.0f Hz", *id, *hz)
 	if err := agent.Run(ctx); err != nil && err != context.Canceled {
@@ -0,0 +1,9 @@
+// Package api is the gRPC interface of the control center, defined by the
+// ControlCenter service in proto/api.proto. It holds the request and
+// response messages, the client, and the server registration, all
+// generated by protoc-gen-go and protoc-gen-go-grpc; the control center
+// implements the server (see controlcenter.Config.GRPCAddr). Vehicle
+// messages come from package vlinkpb and shadow entries from fleetpb.
+package api
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/daohu527/vlink --go-grpc_out=../.. --go-grpc_opt=module=github.com/daohu527/vlink api.proto
@@ -0,0 +1,297 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v5.29.3
+// source: api.proto
+
+package api
+
+import (
+	fleetpb "github.com/daohu527/vlink/pkg/fleetpb"
+	vlinkpb "github.com/daohu527/vlink/pkg/vlinkpb"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetVehicleRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VehicleId     string                 `protobuf:"bytes,1,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetVehicleRequest) Reset() {
+	*x = GetVehicleRequest{}
+	mi := &file_api_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetVehicleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetVehicleRequest) ProtoMessage() {}
+
+func (x *GetVehicleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetVehicleRequest.ProtoReflect.Descriptor instead.
+func (*GetVehicleRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetVehicleRequest) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+type ListActiveRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MaxAgeMs      int64                  `protobuf:"varint,1,opt,name=max_age_ms,json=maxAgeMs,proto3" json:"max_age_ms,omitempty"` // 0 means 60 s
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListActiveRequest) Reset() {
+	*x = ListActiveRequest{}
+	mi := &file_api_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListActiveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListActiveRequest) ProtoMessage() {}
+
+func (x *ListActiveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListActiveRequest.ProtoReflect.Descriptor instead.
+func (*ListActiveRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListActiveRequest) GetMaxAgeMs() int64 {
+	if x != nil {
+		return x.MaxAgeMs
+	}
+	return 0
+}
+
+type ListActiveResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VehicleIds    []string               `protobuf:"bytes,1,rep,name=vehicle_ids,json=vehicleIds,proto3" json:"vehicle_ids,omitempty"` // sorted
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListActiveResponse) Reset() {
+	*x = ListActiveResponse{}
+	mi := &file_api_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListActiveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListActiveResponse) ProtoMessage() {}
+
+func (x *ListActiveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListActiveResponse.ProtoReflect.Descriptor instead.
+func (*ListActiveResponse) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListActiveResponse) GetVehicleIds() []string {
+	if x != nil {
+		return x.VehicleIds
+	}
+	return nil
+}
+
+type SubscribeAlertsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VehicleIds    []string               `protobuf:"bytes,1,rep,name=vehicle_ids,json=vehicleIds,proto3" json:"vehicle_ids,omitempty"` // empty means every vehicle
+	MinSeverity   int32                  `protobuf:"varint,2,opt,name=min_severity,json=minSeverity,proto3" json:"min_severity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeAlertsRequest) Reset() {
+	*x = SubscribeAlertsRequest{}
+	mi := &file_api_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeAlertsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeAlertsRequest) ProtoMessage() {}
+
+func (x *SubscribeAlertsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeAlertsRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeAlertsRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SubscribeAlertsRequest) GetVehicleIds() []string {
+	if x != nil {
+		return x.VehicleIds
+	}
+	return nil
+}
+
+func (x *SubscribeAlertsRequest) GetMinSeverity() int32 {
+	if x != nil {
+		return x.MinSeverity
+	}
+	return 0
+}
+
+var File_api_proto protoreflect.FileDescriptor
+
+const file_api_proto_rawDesc = "" +
+	"\n" +
+	"\tapi.proto\x12\x05vlink\x1a\vvlink.proto\x1a\vfleet.proto\"2\n" +
+	"\x11GetVehicleRequest\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x01 \x01(\tR\tvehicleId\"1\n" +
+	"\x11ListActiveRequest\x12\x1c\n" +
+	"\n" +
+	"max_age_ms\x18\x01 \x01(\x03R\bmaxAgeMs\"5\n" +
+	"\x12ListActiveResponse\x12\x1f\n" +
+	"\vvehicle_ids\x18\x01 \x03(\tR\n" +
+	"vehicleIds\"\\\n" +
+	"\x16SubscribeAlertsRequest\x12\x1f\n" +
+	"\vvehicle_ids\x18\x01 \x03(\tR\n" +
+	"vehicleIds\x12!\n" +
+	"\fmin_severity\x18\x02 \x01(\x05R\vminSeverity2\x96\x02\n" +
+	"\rControlCenter\x12:\n" +
+	"\n" +
+	"GetVehicle\x12\x18.vlink.GetVehicleRequest\x1a\x12.vlink.ShadowEntry\x12A\n" +
+	"\n" +
+	"ListActive\x12\x18.vlink.ListActiveRequest\x1a\x19.vlink.ListActiveResponse\x127\n" +
+	"\vSendControl\x12\x15.vlink.ControlCommand\x1a\x11.vlink.CommandAck\x12M\n" +
+	"\x0fSubscribeAlerts\x12\x1d.vlink.SubscribeAlertsRequest\x1a\x19.vlink.TeleoperationAlert0\x01B#Z!github.com/daohu527/vlink/pkg/apib\x06proto3"
+
+var (
+	file_api_proto_rawDescOnce sync.Once
+	file_api_proto_rawDescData []byte
+)
+
+func file_api_proto_rawDescGZIP() []byte {
+	file_api_proto_rawDescOnce.Do(func() {
+		file_api_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_proto_rawDesc), len(file_api_proto_rawDesc)))
+	})
+	return file_api_proto_rawDescData
+}
+
+var file_api_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_api_proto_goTypes = []any{
+	(*GetVehicleRequest)(nil),          // 0: vlink.GetVehicleRequest
+	(*ListActiveRequest)(nil),          // 1: vlink.ListActiveRequest
+	(*ListActiveResponse)(nil),         // 2: vlink.ListActiveResponse
+	(*SubscribeAlertsRequest)(nil),     // 3: vlink.SubscribeAlertsRequest
+	(*vlinkpb.ControlCommand)(nil),     // 4: vlink.ControlCommand
+	(*fleetpb.ShadowEntry)(nil),        // 5: vlink.ShadowEntry
+	(*vlinkpb.CommandAck)(nil),         // 6: vlink.CommandAck
+	(*vlinkpb.TeleoperationAlert)(nil), // 7: vlink.TeleoperationAlert
+}
+var file_api_proto_depIdxs = []int32{
+	0, // 0: vlink.ControlCenter.GetVehicle:input_type -> vlink.GetVehicleRequest
+	1, // 1: vlink.ControlCenter.ListActive:input_type -> vlink.ListActiveRequest
+	4, // 2: vlink.ControlCenter.SendControl:input_type -> vlink.ControlCommand
+	3, // 3: vlink.ControlCenter.SubscribeAlerts:input_type -> vlink.SubscribeAlertsRequest
+	5, // 4: vlink.ControlCenter.GetVehicle:output_type -> vlink.ShadowEntry
+	2, // 5: vlink.ControlCenter.ListActive:output_type -> vlink.ListActiveResponse
+	6, // 6: vlink.ControlCenter.SendControl:output_type -> vlink.CommandAck
+	7, // 7: vlink.ControlCenter.SubscribeAlerts:output_type -> vlink.TeleoperationAlert
+	4, // [4:8] is the sub-list for method output_type
+	0, // [0:4] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_api_proto_init() }
+func file_api_proto_init() {
+	if File_api_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_proto_rawDesc), len(file_api_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_proto_goTypes,
+		DependencyIndexes: file_api_proto_depIdxs,
+		MessageInfos:      file_api_proto_msgTypes,
+	}.Build()
+	File_api_proto = out.File
+	file_api_proto_goTypes = nil
+	file_api_proto_depIdxs = nil
+}
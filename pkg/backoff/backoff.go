@@ -0,0 +1,170 @@
+// Package backoff spaces out reconnect attempts to the MQTT broker. Delays
+// grow exponentially and are jittered so that a fleet losing its broker at
+// the same moment does not reconnect in lockstep once it is back.
+package backoff
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInitial is the delay before the second attempt.
+	DefaultInitial = time.Second
+	// DefaultMax caps the delay between attempts.
+	DefaultMax = 2 * time.Minute
+	// DefaultJitterFraction is the share of each delay that is randomised.
+	DefaultJitterFraction = 0.5
+)
+
+// ErrStopped is returned by Retry when it is stopped before connecting.
+var ErrStopped = errors.New("backoff: stopped")
+
+// permanentError marks an error that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err, e.g. a broker rejecting the client's credentials, so
+// that Retry returns it at once instead of trying again. It returns nil if
+// err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// State describes the progress of a Backoff, e.g. for logging.
+type State struct {
+	// Attempt is the number of the next attempt, counting from 1 since the
+	// last Reset.
+	Attempt int
+	// Delay is the wait before that attempt.
+	Delay time.Duration
+}
+
+// Backoff computes the delays between connection attempts. The first attempt
+// after a Reset is not delayed. The second waits Initial, and each later one
+// twice as long as the one before, up to Max. JitterFraction of every delay
+// is random: with 0.5, a 4s delay becomes anything between 2s and 4s. A
+// Backoff is safe for concurrent use.
+type Backoff struct {
+	initial time.Duration
+	max     time.Duration
+	jitter  float64
+	rand    func() float64 // in [0, 1)
+
+	mu    sync.Mutex
+	state State
+}
+
+// New returns a Backoff. Zero arguments select DefaultInitial, DefaultMax
+// and DefaultJitterFraction; a negative jitterFraction disables jitter, and
+// one above 1 is treated as 1. max is raised to initial if it is lower.
+func New(initial, max time.Duration, jitterFraction float64) *Backoff {
+	if initial <= 0 {
+		initial = DefaultInitial
+	}
+	if max <= 0 {
+		max = DefaultMax
+	}
+	if max < initial {
+		max = initial
+	}
+	switch {
+	case jitterFraction == 0:
+		jitterFraction = DefaultJitterFraction
+	case jitterFraction < 0:
+		jitterFraction = 0
+	case jitterFraction > 1:
+		jitterFraction = 1
+	}
+	return &Backoff{initial: initial, max: max, jitter: jitterFraction, rand: rand.Float64}
+}
+
+// Next returns the delay before the next attempt and advances the Backoff.
+func (b *Backoff) Next() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state.Attempt++
+	b.state.Delay = b.delay(b.state.Attempt)
+	return b.state.Delay
+}
+
+// delay returns the jittered delay before attempt n.
+func (b *Backoff) delay(n int) time.Duration {
+	if n <= 1 {
+		return 0
+	}
+	d := b.initial
+	for i := 2; i < n && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	return d - time.Duration(float64(d)*b.jitter*b.rand())
+}
+
+// Reset starts over, e.g. once a connection has been established, so the
+// next attempt is immediate again.
+func (b *Backoff) Reset() {
+	b.mu.Lock()
+	b.state = State{}
+	b.mu.Unlock()
+}
+
+// State returns the attempt most recently scheduled by Next and its delay.
+func (b *Backoff) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Retry calls connect until it succeeds, waiting b.Next() before each
+// attempt, and then resets b. onFailure, if not nil, is called after every
+// failed attempt with the error and the state of the next one. Retry gives up
+// with ErrStopped once stop is closed, or as soon as connect returns an
+// error wrapping ErrStopped, e.g. after abandoning an attempt in flight. An
+// error made with Permanent also ends the retries, and Retry returns the
+// error it wraps.
+func Retry(stop <-chan struct{}, b *Backoff, connect func() error, onFailure func(error, State)) error {
+	d := b.Next()
+	for {
+		if d > 0 {
+			timer := time.NewTimer(d)
+			select {
+			case <-stop:
+				timer.Stop()
+				return ErrStopped
+			case <-timer.C:
+			}
+		} else {
+			select {
+			case <-stop:
+				return ErrStopped
+			default:
+			}
+		}
+		err := connect()
+		if err == nil {
+			b.Reset()
+			return nil
+		}
+		if errors.Is(err, ErrStopped) {
+			return err
+		}
+		var p *permanentError
+		if errors.As(err, &p) {
+			return p.err
+		}
+		d = b.Next()
+		if onFailure != nil {
+			onFailure(err, b.State())
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package backoff
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// intervals returns the first n delays of b.
+func intervals(b *Backoff, n int) []time.Duration {
+	var got []time.Duration
+	for range n {
+		got = append(got, b.Next())
+	}
+	return got
+}
+
+func TestBackoffSequence(t *testing.T) {
+	b := New(time.Second, 10*time.Second, -1)
+	want := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	if got := intervals(b, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("intervals = %v, want %v", got, want)
+	}
+	if s := b.State(); s.Attempt != len(want) || s.Delay != 10*time.Second {
+		t.Errorf("State = %+v", s)
+	}
+
+	b.Reset()
+	if d := b.Next(); d != 0 {
+		t.Errorf("first delay after Reset = %v, want 0", d)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := New(time.Second, 10*time.Second, 0.5)
+	draws := []float64{0.9, 0, 0.5, 0.75}
+	b.rand = func() float64 {
+		r := draws[0]
+		draws = draws[1:]
+		return r
+	}
+	// The first attempt takes no draw; the others lose up to half.
+	want := []time.Duration{0, 550 * time.Millisecond, 2 * time.Second, 3 * time.Second, 5 * time.Second}
+	if got := intervals(b, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("intervals = %v, want %v", got, want)
+	}
+}
+
+func TestBackoffJitterStaysInBounds(t *testing.T) {
+	b := New(100*time.Millisecond, time.Second, 0.3)
+	b.Next()
+	base := 100 * time.Millisecond
+	for i := 0; i < 50; i++ {
+		d := b.Next()
+		if lo := base - base*3/10; d < lo || d > base {
+			t.Fatalf("delay %d = %v, want within [%v, %v]", i, d, lo, base)
+		}
+		if base < time.Second {
+			base *= 2
+			if base > time.Second {
+				base = time.Second
+			}
+		}
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	b := New(0, 0, 0)
+	if b.initial != DefaultInitial || b.max != DefaultMax || b.jitter != DefaultJitterFraction {
+		t.Errorf("defaults = %v/%v/%v", b.initial, b.max, b.jitter)
+	}
+	b = New(time.Minute, time.Second, 2)
+	if b.max != time.Minute || b.jitter != 1 {
+		t.Errorf("clamped = %v/%v, want 1m/1", b.max, b.jitter)
+	}
+}
+
+func TestRetryBacksOffUntilConnected(t *testing.T) {
+	b := New(time.Millisecond, 4*time.Millisecond, -1)
+	fail := errors.New("broker down")
+	calls := 0
+	var states []State
+	err := Retry(make(chan struct{}), b, func() error {
+		calls++
+		if calls < 4 {
+			return fail
+		}
+		return nil
+	}, func(err error, s State) {
+		if !errors.Is(err, fail) {
+			t.Errorf("onFailure error = %v", err)
+		}
+		states = append(states, s)
+	})
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	want := []State{{2, time.Millisecond}, {3, 2 * time.Millisecond}, {4, 4 * time.Millisecond}}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("states = %v, want %v", states, want)
+	}
+	if s := b.State(); s != (State{}) {
+		t.Errorf("State after connecting = %+v, want reset", s)
+	}
+}
+
+func TestRetryStops(t *testing.T) {
+	b := New(time.Hour, time.Hour, -1)
+	stop := make(chan struct{})
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- Retry(stop, b, func() error {
+			calls++
+			return errors.New("broker down")
+		}, nil)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrStopped) {
+			t.Errorf("Retry = %v, want ErrStopped", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Retry did not stop")
+	}
+	if calls != 1 {
+		t.Errorf("connect called %d times, want 1", calls)
+	}
+
+	// An attempt abandoned with ErrStopped is not retried or reported.
+	b = New(0, 0, 0)
+	err := Retry(make(chan struct{}), b, func() error { return ErrStopped }, func(error, State) { t.Error("onFailure called") })
+	if !errors.Is(err, ErrStopped) {
+		t.Errorf("Retry = %v, want ErrStopped", err)
+	}
+
+	// A closed stop prevents even the immediate first attempt.
+	if err := Retry(stop, New(0, 0, 0), func() error { t.Error("connected after stop"); return nil }, nil); !errors.Is(err, ErrStopped) {
+		t.Errorf("Retry = %v, want ErrStopped", err)
+	}
+}
+
+func TestRetryGivesUpOnPermanentErrors(t *testing.T) {
+	b := New(time.Millisecond, time.Millisecond, -1)
+	refused := errors.New("not authorized")
+	calls, failures := 0, 0
+	err := Retry(make(chan struct{}), b, func() error {
+		calls++
+		return fmt.Errorf("connect: %w", Permanent(refused))
+	}, func(error, State) { failures++ })
+	if err != refused {
+		t.Errorf("Retry = %v, want the permanent error unwrapped", err)
+	}
+	if calls != 1 || failures != 0 {
+		t.Errorf("connect called %d times, onFailure %d; want a single attempt", calls, failures)
+	}
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) != nil")
+	}
+}
@@ -0,0 +1,250 @@
+package controlcenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// pendingAckTTL bounds how long an unacknowledged command is remembered,
+// unless its action's ack timeout is longer or zero.
+const pendingAckTTL = time.Minute
+
+// defaultAckTimeout applies to actions without an entry in
+// DefaultAckTimeouts or Config.AckTimeouts when Config.DefaultAckTimeout is
+// zero.
+const defaultAckTimeout = 30 * time.Second
+
+// defaultAckTimeouts backs DefaultAckTimeouts. Safety actions are expected
+// to be answered almost at once; following a trajectory takes as long as
+// the path and falls back to Config.DefaultAckTimeout.
+var defaultAckTimeouts = map[string]time.Duration{
+	protocol.ActionStop:               2 * time.Second,
+	protocol.ActionCancel:             2 * time.Second,
+	protocol.ActionResume:             5 * time.Second,
+	protocol.ActionSetSpeed:           5 * time.Second,
+	protocol.ActionRequestState:       5 * time.Second,
+	protocol.ActionSetPublishHz:       5 * time.Second,
+	protocol.ActionResetPublishHz:     5 * time.Second,
+	protocol.ActionTeleoperationStart: 10 * time.Second,
+}
+
+// DefaultAckTimeouts returns the per-action ack timeouts SendControlAndWait
+// applies unless Config.AckTimeouts overrides them. The map is a copy the
+// caller may modify, e.g. as the base of Config.AckTimeouts.
+func DefaultAckTimeouts() map[string]time.Duration {
+	return maps.Clone(defaultAckTimeouts)
+}
+
+// ErrCommandTimeout is returned by SendControlAndWait when the vehicle does
+// not answer within the command's ack timeout (see Config.AckTimeouts).
+var ErrCommandTimeout = errors.New("control-center: command ack timed out")
+
+// AckListener is called for every acknowledgement that matches a command sent
+// by this server. latency is measured on the control-center clock from
+// publish to receipt; the vehicle-reported ack timestamp is never used for it,
+// so a vehicle with a skewed clock cannot distort the figure.
+type AckListener func(ack *protocol.CommandAck, latency time.Duration)
+
+// commandTracker correlates acknowledgements with sent commands strictly by
+// CommandID. All times it stores come from the control-center clock.
+type commandTracker struct {
+	mu      sync.Mutex
+	pending map[string]pendingCommand
+}
+
+// progressBuffer is the capacity of a SendControlWithProgress channel.
+const progressBuffer = 16
+
+// pendingCommand is a sent command awaiting its final acknowledgement.
+type pendingCommand struct {
+	sentAt   time.Time
+	armedAt  time.Time                 // sentAt, or the receipt of the latest in_progress ack
+	ttl      time.Duration             // zero never expires
+	span     trace.Span                // nil for an untracked command
+	progress chan *protocol.CommandAck // nil unless progress was requested
+}
+
+func newCommandTracker() *commandTracker {
+	return &commandTracker{pending: make(map[string]pendingCommand)}
+}
+
+// track records that commandID was sent at sentAt and forgets commands that
+// have waited longer than their ttl, at least pendingAckTTL, since they were
+// sent or last reported progress (see resolve). A zero ttl is never
+// forgotten this way: the command stays pending until its final ack, or
+// until forget, e.g. when its waiter gives up. span, if
+// non-nil, is ended once the command is resolved, forgotten or expired;
+// progress, if non-nil, receives every matching ack and is closed at the
+// same point.
+func (t *commandTracker) track(commandID string, sentAt time.Time, ttl time.Duration, span trace.Span, progress chan *protocol.CommandAck) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, p := range t.pending {
+		if p.ttl > 0 && sentAt.Sub(p.armedAt) > p.ttl {
+			p.end("vlink.ack.status", "expired")
+			delete(t.pending, id)
+		}
+	}
+	if ttl > 0 {
+		ttl = max(ttl, pendingAckTTL)
+	}
+	t.pending[commandID] = pendingCommand{sentAt: sentAt, armedAt: sentAt, ttl: ttl, span: span, progress: progress}
+}
+
+// forget drops commandID, e.g. after its publish failed or its waiter gave
+// up; reason is recorded on the command's span. Acks arriving afterwards are
+// unmatched and dropped.
+func (t *commandTracker) forget(commandID, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.pending[commandID]; ok {
+		if p.span != nil {
+			p.span.SetStatus(codes.Error, reason)
+		}
+		p.end("error", reason)
+		delete(t.pending, commandID)
+	}
+}
+
+// resolve matches an ack received at receivedAt and returns the latency since
+// the command was sent. Terminal statuses release the command; "accepted"
+// and "in_progress" acks keep it pending so later acks can still match, and
+// re-arm its ttl, so a long-running task reporting progress never expires
+// before its final ack.
+func (t *commandTracker) resolve(ack *protocol.CommandAck, receivedAt time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.pending[ack.CommandID]
+	if !ok {
+		return 0, false
+	}
+	p.deliver(ack)
+	if ack.Final() {
+		p.end("vlink.ack.status", ack.Status)
+		delete(t.pending, ack.CommandID)
+	} else {
+		p.armedAt = receivedAt
+		t.pending[ack.CommandID] = p
+	}
+	return receivedAt.Sub(p.sentAt), true
+}
+
+// deliver hands ack to the command's progress channel without blocking the
+// MQTT callback. A full channel drops the oldest update to make room, so the
+// final ack is never lost behind unread progress.
+func (p pendingCommand) deliver(ack *protocol.CommandAck) {
+	if p.progress == nil {
+		return
+	}
+	select {
+	case p.progress <- ack:
+		return
+	default:
+	}
+	select {
+	case <-p.progress:
+	default:
+	}
+	select {
+	case p.progress <- ack:
+	default:
+	}
+}
+
+// end records a final attribute on the command's span and ends it, and
+// closes the progress channel.
+func (p pendingCommand) end(key, value string) {
+	if p.progress != nil {
+		close(p.progress)
+	}
+	if p.span == nil {
+		return
+	}
+	p.span.SetAttributes(attribute.String(key, value))
+	p.span.End()
+}
+
+// Len returns the number of commands awaiting acknowledgement.
+func (t *commandTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// SendControlAndWait publishes cmd and blocks until the vehicle answers it
+// with a final ack, completed, rejected or superseded, which it returns.
+// accepted and in_progress updates are skipped, so a long-running task is
+// waited on to completion; use SendControlWithProgress to observe them. A
+// CommandID is assigned if cmd has none. The wait is bounded by ctx and by
+// the action's ack timeout (see Config.AckTimeouts), after which
+// ErrCommandTimeout is returned. When either ends the wait the command is
+// forgotten, so a late ack is dropped rather than delivered to a reader that
+// is no longer there. Under Config.DryRun the command is logged and an error
+// wrapping ErrDryRun is returned, since no ack can come.
+func (s *Server) SendControlAndWait(ctx context.Context, cmd *protocol.ControlCommand) (*protocol.CommandAck, error) {
+	if cmd.CommandID == "" {
+		cmd.CommandID = newCommandID()
+	}
+	timeout := s.ackTimeout(cmd.Action)
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	progress, err := s.SendControlWithProgress(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.DryRun {
+		return nil, fmt.Errorf("%w: command %s to %s", ErrDryRun, cmd.CommandID, cmd.VehicleID)
+	}
+	for {
+		select {
+		case ack, ok := <-progress:
+			if !ok {
+				return nil, fmt.Errorf("control-center: command %s to %s: %w", cmd.CommandID, cmd.VehicleID, errNoAck)
+			}
+			if ack.Final() {
+				return ack, nil
+			}
+		case <-expired:
+			s.acks.forget(cmd.CommandID, "ack timeout")
+			return nil, fmt.Errorf("control-center: command %s to %s: %w after %v (%s)", cmd.CommandID, cmd.VehicleID, ErrCommandTimeout, timeout, cmd.Action)
+		case <-ctx.Done():
+			s.acks.forget(cmd.CommandID, "wait cancelled")
+			return nil, fmt.Errorf("control-center: command %s to %s: %w", cmd.CommandID, cmd.VehicleID, ctx.Err())
+		}
+	}
+}
+
+// ackTimeout returns how long SendControlAndWait waits for an answer to
+// action: its Config.AckTimeouts entry, else its DefaultAckTimeouts entry,
+// else Config.DefaultAckTimeout. Zero means no limit besides the caller's
+// context, and the command is then tracked until answered.
+func (s *Server) ackTimeout(action string) time.Duration {
+	if d, ok := s.cfg.AckTimeouts[action]; ok {
+		return d
+	}
+	if d, ok := defaultAckTimeouts[action]; ok {
+		return d
+	}
+	if s.cfg.DefaultAckTimeout > 0 {
+		return s.cfg.DefaultAckTimeout
+	}
+	return defaultAckTimeout
+}
+
+// errNoAck reports a command released without an answer, e.g. because it
+// expired or was never published in dry-run mode.
+var errNoAck = errors.New("control-center: command released without an ack")
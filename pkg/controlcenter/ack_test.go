@@ -0,0 +1,301 @@
+package controlcenter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestFutureDatedAckUsesCenterClock(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	now := time.UnixMilli(1_700_000_000_000)
+	srv.now = func() time.Time { return now }
+
+	type result struct {
+		ack     *protocol.CommandAck
+		latency time.Duration
+	}
+	var got []result
+	srv.OnAck(func(ack *protocol.CommandAck, latency time.Duration) {
+		got = append(got, result{ack, latency})
+	})
+
+	cmd := &protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "stop"}
+	if err := srv.SendControl(cmd); err != nil {
+		t.Fatalf("SendControl: %v", err)
+	}
+
+	// The vehicle clock is an hour ahead; the ack arrives 40ms later by ours.
+	now = now.Add(40 * time.Millisecond)
+	ack := &protocol.CommandAck{
+		CommandID: "cmd-1",
+		VehicleID: "car-001",
+		Status:    protocol.AckCompleted,
+		Timestamp: now.Add(time.Hour).UnixMilli(),
+	}
+	data, _ := protocol.Marshal(ack)
+	handler := mc.handlers[protocol.WildcardAckTopic()]
+	if handler == nil {
+		t.Fatal("no handler for wildcard ack topic")
+	}
+	handler(mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: data})
+
+	if len(got) != 1 {
+		t.Fatalf("ack listener called %d times, want 1", len(got))
+	}
+	if got[0].ack.CommandID != "cmd-1" {
+		t.Errorf("CommandID = %q, want cmd-1", got[0].ack.CommandID)
+	}
+	if got[0].latency != 40*time.Millisecond {
+		t.Errorf("latency = %v, want 40ms", got[0].latency)
+	}
+	if n := srv.acks.Len(); n != 0 {
+		t.Errorf("pending commands = %d, want 0 after completion", n)
+	}
+
+	// A redelivered or unknown ack is dropped.
+	handler(mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: data})
+	if len(got) != 1 {
+		t.Errorf("unmatched ack reached listeners")
+	}
+}
+
+func TestCommandTrackerPrunesExpired(t *testing.T) {
+	tr := newCommandTracker()
+	t0 := time.Now()
+	tr.track("old", t0, time.Second, nil, nil)
+	tr.track("long", t0, 5*time.Minute, nil, nil)
+	tr.track("unbounded", t0, 0, nil, nil)
+	tr.track("new", t0.Add(pendingAckTTL+time.Second), time.Second, nil, nil)
+
+	if n := tr.Len(); n != 3 {
+		t.Fatalf("Len = %d, want 3", n)
+	}
+	if _, ok := tr.resolve(&protocol.CommandAck{CommandID: "old"}, t0); ok {
+		t.Error("expired command should not correlate")
+	}
+	if _, ok := tr.resolve(&protocol.CommandAck{CommandID: "long"}, t0); !ok {
+		t.Error("command with a long ack timeout expired after pendingAckTTL")
+	}
+	if _, ok := tr.resolve(&protocol.CommandAck{CommandID: "unbounded"}, t0); !ok {
+		t.Error("command with a zero ack timeout expired")
+	}
+}
+
+func TestInProgressAckRearmsCommand(t *testing.T) {
+	tr := newCommandTracker()
+	t0 := time.Now()
+	tr.track("task", t0, time.Second, nil, nil)
+
+	// Progress keeps arriving within the ttl, for longer than the ttl.
+	at := t0
+	for i := 0; i < 3; i++ {
+		at = at.Add(pendingAckTTL - time.Second)
+		if _, ok := tr.resolve(&protocol.CommandAck{CommandID: "task", Status: protocol.AckInProgress}, at); !ok {
+			t.Fatalf("progress %d after %v unmatched", i, at.Sub(t0))
+		}
+		tr.track("other", at, time.Second, nil, nil) // sweeps expired commands
+	}
+	latency, ok := tr.resolve(&protocol.CommandAck{CommandID: "task", Status: protocol.AckCompleted}, at)
+	if !ok {
+		t.Fatal("final ack of a task reporting progress was unmatched")
+	}
+	if latency != at.Sub(t0) {
+		t.Errorf("latency = %v, want %v since the command was sent", latency, at.Sub(t0))
+	}
+}
+
+func TestSendControlWithProgressSurfacesEveryAck(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	progress, err := srv.SendControlWithProgress(&protocol.ControlCommand{
+		CommandID: "cmd-1", VehicleID: "car-001", Action: "drive_to_depot",
+	})
+	if err != nil {
+		t.Fatalf("SendControlWithProgress: %v", err)
+	}
+
+	handler := mc.handlers[protocol.WildcardAckTopic()]
+	for _, ack := range []*protocol.CommandAck{
+		{CommandID: "cmd-1", VehicleID: "car-001", Status: protocol.AckInProgress, Progress: 50, ETA: 60_000},
+		{CommandID: "cmd-1", VehicleID: "car-001", Status: protocol.AckCompleted},
+	} {
+		data, _ := protocol.Marshal(ack)
+		handler(mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: data})
+	}
+
+	var got []*protocol.CommandAck
+	for ack := range progress {
+		got = append(got, ack)
+	}
+	if len(got) != 2 {
+		t.Fatalf("received %d acks, want 2", len(got))
+	}
+	if got[0].Status != protocol.AckInProgress || got[0].Progress != 50 || got[0].ETA != 60_000 {
+		t.Errorf("first ack = %+v, want in_progress 50%% eta 60s", got[0])
+	}
+	if got[1].Status != protocol.AckCompleted {
+		t.Errorf("second ack status = %q, want completed", got[1].Status)
+	}
+	if n := srv.acks.Len(); n != 0 {
+		t.Errorf("pending commands = %d, want 0 after completion", n)
+	}
+}
+
+func TestSendControlWithProgressRequiresCommandID(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	srv.ConnectWithClient(newMockClient())
+	if _, err := srv.SendControlWithProgress(&protocol.ControlCommand{VehicleID: "car-001"}); err == nil {
+		t.Error("expected an error without a command ID")
+	}
+}
+
+func TestSendControlAndWaitReturnsFinalAck(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	cmd := &protocol.ControlCommand{VehicleID: "car-001", Action: "stop"}
+	done := make(chan struct{})
+	var (
+		ack *protocol.CommandAck
+		err error
+	)
+	go func() {
+		defer close(done)
+		ack, err = srv.SendControlAndWait(context.Background(), cmd)
+	}()
+
+	// Wait for the command to be tracked before answering it.
+	deadline := time.Now().Add(time.Second)
+	for srv.acks.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("command was never tracked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	handler := mc.handlers[protocol.WildcardAckTopic()]
+	for _, a := range []*protocol.CommandAck{
+		{CommandID: "other", VehicleID: "car-001", Status: protocol.AckRejected},
+		{CommandID: cmd.CommandID, VehicleID: "car-001", Status: protocol.AckAccepted},
+		{CommandID: cmd.CommandID, VehicleID: "car-001", Status: protocol.AckInProgress, Progress: 10},
+		{CommandID: cmd.CommandID, VehicleID: "car-001", Status: protocol.AckCompleted},
+	} {
+		data, _ := protocol.Marshal(a)
+		handler(mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: data})
+	}
+	<-done
+
+	if err != nil {
+		t.Fatalf("SendControlAndWait: %v", err)
+	}
+	if cmd.CommandID == "" {
+		t.Error("command ID was not assigned")
+	}
+	if ack == nil || ack.CommandID != cmd.CommandID || ack.Status != protocol.AckCompleted {
+		t.Errorf("ack = %+v, want completed for %s", ack, cmd.CommandID)
+	}
+}
+
+func TestSendControlAndWaitTimesOut(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	cmd := &protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "stop"}
+	ack, err := srv.SendControlAndWait(ctx, cmd)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if ack != nil {
+		t.Errorf("ack = %+v, want nil", ack)
+	}
+	if n := srv.acks.Len(); n != 0 {
+		t.Errorf("pending commands = %d, want 0 after timeout", n)
+	}
+
+	// A late ack is unmatched and must not reach OnAck listeners.
+	srv.OnAck(func(*protocol.CommandAck, time.Duration) {
+		t.Error("late ack was delivered")
+	})
+	data, _ := protocol.Marshal(&protocol.CommandAck{CommandID: "cmd-1", VehicleID: "car-001", Status: protocol.AckAccepted})
+	mc.handlers[protocol.WildcardAckTopic()](mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: data})
+}
+
+func TestAckTimeoutPerAction(t *testing.T) {
+	srv := New(Config{
+		ClientID:          "cc",
+		AckTimeouts:       map[string]time.Duration{protocol.ActionResume: time.Second, "drive_to_depot": 10 * time.Minute},
+		DefaultAckTimeout: 45 * time.Second,
+	})
+	for action, want := range map[string]time.Duration{
+		protocol.ActionStop:   DefaultAckTimeouts()[protocol.ActionStop],
+		protocol.ActionResume: time.Second,
+		"drive_to_depot":      10 * time.Minute,
+		"unlisted":            45 * time.Second,
+	} {
+		if got := srv.ackTimeout(action); got != want {
+			t.Errorf("ackTimeout(%q) = %v, want %v", action, got, want)
+		}
+	}
+	if got := New(Config{}).ackTimeout("unlisted"); got != defaultAckTimeout {
+		t.Errorf("fallback = %v, want %v", got, defaultAckTimeout)
+	}
+}
+
+func TestSendControlAndWaitAppliesActionTimeout(t *testing.T) {
+	srv := New(Config{ClientID: "cc", AckTimeouts: map[string]time.Duration{
+		protocol.ActionStop: 20 * time.Millisecond,
+		"drive_to_depot":    time.Second,
+	}})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	// Answer every command after 60ms: too slow for stop, in time for
+	// drive_to_depot.
+	mc.publishErr = func(_ string, payload []byte) error {
+		var cmd protocol.ControlCommand
+		if err := protocol.Unmarshal(payload, &cmd); err != nil {
+			return err
+		}
+		time.AfterFunc(60*time.Millisecond, func() {
+			data, _ := protocol.Marshal(&protocol.CommandAck{CommandID: cmd.CommandID, VehicleID: cmd.VehicleID, Status: protocol.AckCompleted})
+			mc.handlers[protocol.WildcardAckTopic()](mc, &mockMessage{topic: protocol.AckTopic(cmd.VehicleID), payload: data})
+		})
+		return nil
+	}
+
+	start := time.Now()
+	ack, err := srv.SendControlAndWait(context.Background(), &protocol.ControlCommand{VehicleID: "car-001", Action: protocol.ActionStop})
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Fatalf("stop: err = %v, want ErrCommandTimeout", err)
+	}
+	if ack != nil {
+		t.Errorf("stop: ack = %+v, want nil", ack)
+	}
+	if elapsed := time.Since(start); elapsed >= 60*time.Millisecond {
+		t.Errorf("stop timed out after %v, want its 20ms timeout", elapsed)
+	}
+
+	ack, err = srv.SendControlAndWait(context.Background(), &protocol.ControlCommand{VehicleID: "car-001", Action: "drive_to_depot"})
+	if err != nil {
+		t.Fatalf("drive_to_depot: %v", err)
+	}
+	if ack.Status != protocol.AckCompleted {
+		t.Errorf("drive_to_depot: ack = %+v", ack)
+	}
+	time.Sleep(80 * time.Millisecond) // let the late stop ack arrive and be dropped
+	if n := srv.acks.Len(); n != 0 {
+		t.Errorf("pending commands = %d, want 0", n)
+	}
+}
@@ -0,0 +1,149 @@
+package controlcenter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestAuditLogRecordsSentCommands(t *testing.T) {
+	var buf bytes.Buffer
+	srv := New(Config{ClientID: "cc", AuditLog: &buf})
+	srv.ConnectWithClient(newMockClient())
+
+	for _, action := range []string{protocol.ActionStop, protocol.ActionResume} {
+		if err := srv.SendControl(&protocol.ControlCommand{CommandID: newCommandID(), VehicleID: "car-001", Action: action}); err != nil {
+			t.Fatalf("SendControl: %v", err)
+		}
+	}
+
+	entries, err := ReadAudit(&buf)
+	if err != nil {
+		t.Fatalf("ReadAudit: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(entries))
+	}
+	if a := entries[0].Command.Action; a != protocol.ActionStop {
+		t.Errorf("first action = %q, want stop", a)
+	}
+	if entries[1].Time.Before(entries[0].Time) || entries[1].DryRun {
+		t.Errorf("second entry = %+v", entries[1])
+	}
+}
+
+func TestAuditLogKeepsPayloadsSealed(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	var buf bytes.Buffer
+	srv := New(Config{ClientID: "cc", AuditLog: &buf, PayloadKey: key})
+	srv.ConnectWithClient(newMockClient())
+	secret := `{"pin":"1234"}`
+	if err := srv.SendControl(&protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "unlock", Payload: secret}); err != nil {
+		t.Fatalf("SendControl: %v", err)
+	}
+	if strings.Contains(buf.String(), "1234") {
+		t.Fatalf("audit log holds the plaintext payload: %s", buf.String())
+	}
+	entries, err := ReadAudit(&buf)
+	if err != nil || len(entries) != 1 || !protocol.IsSealedPayload(entries[0].Command.Payload) {
+		t.Fatalf("entries = %+v, %v; want one with a sealed payload", entries, err)
+	}
+
+	// Replay opens the payload and seals it again for the fresh command ID.
+	replay := New(Config{ClientID: "cc", PayloadKey: key})
+	mc := newMockClient()
+	replay.ConnectWithClient(mc)
+	if err := replay.Replay(context.Background(), entries); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	var cmd protocol.ControlCommand
+	if err := json.Unmarshal(mc.published[0].payload, &cmd); err != nil {
+		t.Fatal(err)
+	}
+	cipher, _ := protocol.NewPayloadCipher(key)
+	if plain, err := cipher.Open(&cmd); err != nil || plain != secret {
+		t.Errorf("replayed payload opens to %q, %v; want %q", plain, err, secret)
+	}
+
+	if err := New(Config{ClientID: "cc"}).Replay(context.Background(), entries); err == nil {
+		t.Error("Replay of a sealed payload succeeded without the key")
+	}
+}
+
+func TestReadAuditRejectsEntryWithoutCommand(t *testing.T) {
+	if _, err := ReadAudit(strings.NewReader(`{"time":"2024-01-01T00:00:00Z"}`)); err == nil {
+		t.Error("ReadAudit accepted an entry without a command")
+	}
+}
+
+func TestReplayReissuesSessionInOrder(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	session := []AuditEntry{
+		{Time: t0, Command: &protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: protocol.ActionStop}},
+		{Time: t0.Add(30 * time.Millisecond), Command: &protocol.ControlCommand{VehicleID: "car-002", Action: protocol.ActionStop}},
+		{Time: t0.Add(60 * time.Millisecond), Command: &protocol.ControlCommand{CommandID: "cmd-3", VehicleID: "car-001", Action: protocol.ActionResume}},
+	}
+	var recording bytes.Buffer
+	for _, e := range session {
+		if err := json.NewEncoder(&recording).Encode(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := ReadAudit(&recording)
+	if err != nil {
+		t.Fatalf("ReadAudit: %v", err)
+	}
+
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	start := time.Now()
+	if err := srv.Replay(context.Background(), entries); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("replay took %v, want the recorded 60ms spacing kept", elapsed)
+	}
+
+	if len(mc.published) != len(session) {
+		t.Fatalf("published %d commands, want %d", len(mc.published), len(session))
+	}
+	for i, p := range mc.published {
+		var cmd protocol.ControlCommand
+		if err := json.Unmarshal(p.payload, &cmd); err != nil {
+			t.Fatal(err)
+		}
+		want := session[i].Command
+		if cmd.VehicleID != want.VehicleID || cmd.Action != want.Action {
+			t.Errorf("command %d = %s to %s, want %s to %s", i, cmd.Action, cmd.VehicleID, want.Action, want.VehicleID)
+		}
+		if want.CommandID != "" && (cmd.CommandID == "" || cmd.CommandID == want.CommandID) {
+			t.Errorf("command %d ID = %q, want a fresh ID", i, cmd.CommandID)
+		}
+	}
+}
+
+func TestReplayStopsWhenContextDone(t *testing.T) {
+	t0 := time.Now()
+	entries := []AuditEntry{
+		{Time: t0, Command: &protocol.ControlCommand{VehicleID: "car-001", Action: protocol.ActionStop}},
+		{Time: t0.Add(time.Hour), Command: &protocol.ControlCommand{VehicleID: "car-001", Action: protocol.ActionResume}},
+	}
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := srv.Replay(ctx, entries); err == nil {
+		t.Fatal("Replay returned nil after the context expired")
+	}
+	if len(mc.published) != 1 {
+		t.Errorf("published %d commands, want only the first", len(mc.published))
+	}
+}
@@ -0,0 +1,111 @@
+package controlcenter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// backfillTick is the interval at which the backfill queue releases a batch
+// of Config.BackfillRate/10 states.
+const backfillTick = 100 * time.Millisecond
+
+// backfillQueueSize bounds the backfill queue. Every agent reconnecting
+// after a broker outage replays up to its OfflineBufferSize states at once,
+// so the burst grows with the fleet.
+const backfillQueueSize = 16384
+
+// backfillQueue holds replayed states delivered in a reconnect burst and
+// releases them to the shadow at a bounded rate, so a reconnect does not
+// stall the updater behind thousands of replayed states. Once size states
+// are pending the oldest is discarded, as it would only be backfilled into
+// the history behind the vehicle's newer states.
+type backfillQueue struct {
+	mu      sync.Mutex
+	pending []*protocol.VehicleState
+	size    int
+	applied uint64
+	dropped uint64
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newBackfillQueue(size int) *backfillQueue {
+	return &backfillQueue{size: size, done: make(chan struct{})}
+}
+
+// push enqueues state, evicting the oldest pending state if the queue is
+// full.
+func (b *backfillQueue) push(state *protocol.VehicleState) {
+	b.mu.Lock()
+	if len(b.pending) == b.size {
+		b.pending[0] = nil
+		b.pending = b.pending[1:]
+		b.dropped++
+	}
+	b.pending = append(b.pending, state)
+	b.mu.Unlock()
+}
+
+// drain applies up to max pending states in arrival order and returns how
+// many it applied.
+func (b *backfillQueue) drain(apply func(*protocol.VehicleState), max int) int {
+	b.mu.Lock()
+	n := min(max, len(b.pending))
+	batch := make([]*protocol.VehicleState, n)
+	copy(batch, b.pending)
+	b.pending = append(b.pending[:0], b.pending[n:]...)
+	b.applied += uint64(n)
+	b.mu.Unlock()
+
+	for _, state := range batch {
+		apply(state)
+	}
+	return n
+}
+
+// Len returns the number of states waiting to be applied.
+func (b *backfillQueue) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// Applied returns how many backfilled states have been released.
+func (b *backfillQueue) Applied() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.applied
+}
+
+// Dropped returns how many states were evicted from the full queue.
+func (b *backfillQueue) Dropped() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// run drains perTick states every tick until stop is called.
+func (b *backfillQueue) run(apply func(*protocol.VehicleState), perTick int, tick time.Duration) {
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-t.C:
+			b.drain(apply, perTick)
+		}
+	}
+}
+
+func (b *backfillQueue) stop() {
+	b.stopOnce.Do(func() { close(b.done) })
+}
+
+// backfillPerTick converts Config.BackfillRate into a batch size per tick.
+func backfillPerTick(rate int, tick time.Duration) int {
+	return max(1, int(int64(rate)*int64(tick)/int64(time.Second)))
+}
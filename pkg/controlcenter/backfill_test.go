@@ -0,0 +1,131 @@
+package controlcenter
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestBackfillDrainIsBoundedPerTick(t *testing.T) {
+	b := newBackfillQueue(backfillQueueSize)
+	for i := 0; i < 25; i++ {
+		b.push(&protocol.VehicleState{VehicleID: "car-001", Timestamp: int64(i)})
+	}
+	var applied []int64
+	apply := func(s *protocol.VehicleState) { applied = append(applied, s.Timestamp) }
+	for i, want := range []int{10, 10, 5, 0} {
+		if n := b.drain(apply, 10); n != want {
+			t.Errorf("tick %d applied %d, want %d", i, n, want)
+		}
+	}
+	for i, ts := range applied {
+		if ts != int64(i) {
+			t.Fatalf("applied out of order: %v", applied)
+		}
+	}
+	if b.Applied() != 25 || b.Len() != 0 {
+		t.Errorf("applied %d, pending %d", b.Applied(), b.Len())
+	}
+}
+
+func TestBackfillQueueIsBounded(t *testing.T) {
+	b := newBackfillQueue(3)
+	for i := 0; i < 5; i++ {
+		b.push(&protocol.VehicleState{VehicleID: "car-001", Timestamp: int64(i)})
+	}
+	if b.Len() != 3 || b.Dropped() != 2 {
+		t.Fatalf("pending %d, dropped %d; want 3 and 2", b.Len(), b.Dropped())
+	}
+	var applied []int64
+	b.drain(func(s *protocol.VehicleState) { applied = append(applied, s.Timestamp) }, 10)
+	if !slices.Equal(applied, []int64{2, 3, 4}) {
+		t.Errorf("applied %v, want the newest three", applied)
+	}
+}
+
+func TestBackfillPerTick(t *testing.T) {
+	if n := backfillPerTick(500, 100*time.Millisecond); n != 50 {
+		t.Errorf("backfillPerTick(500) = %d, want 50", n)
+	}
+	if n := backfillPerTick(1, 100*time.Millisecond); n != 1 {
+		t.Errorf("backfillPerTick(1) = %d, want at least 1", n)
+	}
+}
+
+func TestReconnectBurstIsRateLimited(t *testing.T) {
+	const burst = 200
+	srv := New(Config{ClientID: "cc", BackfillRate: 1000}) // 100 per tick
+	defer srv.Disconnect()
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	// Count applied states per tick boundary via the shadow listener.
+	updates := make(chan time.Time, burst)
+	srv.Shadows().OnUpdate(func(_, _ *protocol.VehicleState) { updates <- time.Now() })
+
+	handler := mc.handlers[protocol.WildcardStateTopic()]
+	for i := 0; i < burst; i++ {
+		id := fmt.Sprintf("car-%03d", i)
+		data, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: id, Timestamp: 1, Replayed: true})
+		handler(mc, &mockMessage{topic: protocol.StateTopic(id), payload: data})
+	}
+	if n := len(srv.Shadows().All()); n != 0 {
+		t.Fatalf("%d replayed states applied inline, want all deferred", n)
+	}
+	if m := srv.Metrics(); m.BackfillPending != burst {
+		t.Errorf("BackfillPending = %d, want %d", m.BackfillPending, burst)
+	}
+
+	// A live state is applied immediately despite the pending burst.
+	live, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "car-live", Timestamp: 1})
+	handler(mc, &mockMessage{topic: protocol.StateTopic("car-live"), payload: live})
+	if e, ok := srv.Shadows().Get("car-live"); !ok || e.Backfill {
+		t.Fatalf("live state: entry %+v, ok %v", e, ok)
+	}
+	<-updates
+
+	var times []time.Time
+	deadline := time.After(5 * time.Second)
+	for len(times) < burst {
+		select {
+		case at := <-updates:
+			times = append(times, at)
+		case <-deadline:
+			t.Fatalf("only %d of %d backfilled states applied", len(times), burst)
+		}
+	}
+	// Two batches of 100, one tick apart.
+	if gap := times[100].Sub(times[99]); gap < backfillTick/2 {
+		t.Errorf("second batch followed the first after %v, want about %v", gap, backfillTick)
+	}
+	if e, _ := srv.Shadows().Get("car-000"); !e.Backfill {
+		t.Error("backfilled entry not marked")
+	}
+	if m := srv.Metrics(); m.BackfillPending != 0 || m.BackfillApplied != burst {
+		t.Errorf("metrics = %+v, want all %d applied", m, burst)
+	}
+}
+
+func TestReplayedStateIsBackfill(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	handler := mc.handlers[protocol.WildcardStateTopic()]
+
+	deliver := func(s *protocol.VehicleState) {
+		data, _ := protocol.Marshal(s)
+		handler(mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: data})
+	}
+	deliver(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 100, Seq: 1, Replayed: true})
+	if e, _ := srv.Shadows().Get("car-001"); e == nil || !e.Backfill {
+		t.Fatalf("replayed state entry = %+v, want Backfill", e)
+	}
+	deliver(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 300, Seq: 3})
+	deliver(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 200, Seq: 2, Replayed: true})
+	if e, _ := srv.Shadows().Get("car-001"); e.Backfill || e.State.Timestamp != 300 {
+		t.Errorf("entry = %+v, want the live state kept", e)
+	}
+}
@@ -0,0 +1,85 @@
+package controlcenter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// BroadcastError reports the vehicles a Broadcast failed to reach. The
+// command was still sent to every other target.
+type BroadcastError struct {
+	Action string
+	// Failed maps each vehicle ID that was not reached to its send error.
+	Failed map[string]error
+}
+
+// FailedIDs returns the IDs of the vehicles that were not reached, sorted.
+func (e *BroadcastError) FailedIDs() []string {
+	ids := make([]string, 0, len(e.Failed))
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (e *BroadcastError) Error() string {
+	ids := e.FailedIDs()
+	return fmt.Sprintf("control-center: broadcast %s failed for %d vehicle(s): %s", e.Action, len(ids), strings.Join(ids, ", "))
+}
+
+// Unwrap returns the individual send errors, ordered by vehicle ID.
+func (e *BroadcastError) Unwrap() []error {
+	ids := e.FailedIDs()
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		errs[i] = e.Failed[id]
+	}
+	return errs
+}
+
+// Broadcast sends a command with action to each of vehicleIDs, e.g. to stop
+// every vehicle in an area at once. Each vehicle gets its own command with a
+// fresh CommandID and timestamp, sent like SendControl (so DryRun and ack
+// tracking apply). A failure for one vehicle does not stop the others; the
+// failures are returned together as a *BroadcastError.
+func (s *Server) Broadcast(action string, vehicleIDs []string) error {
+	var failed map[string]error
+	for _, id := range vehicleIDs {
+		cmd := &protocol.ControlCommand{CommandID: newCommandID(), VehicleID: id, Action: action}
+		if err := s.SendControl(cmd); err != nil {
+			if failed == nil {
+				failed = make(map[string]error)
+			}
+			failed[id] = err
+		}
+	}
+	if failed != nil {
+		return &BroadcastError{Action: action, Failed: failed}
+	}
+	return nil
+}
+
+// BroadcastNear broadcasts action to every vehicle whose last known position
+// is within radiusMeters of (lat, lon) (see shadow.Manager.Near) and returns
+// the IDs it targeted.
+func (s *Server) BroadcastNear(action string, lat, lon, radiusMeters float64) ([]string, error) {
+	ids := s.shadows.Near(lat, lon, radiusMeters)
+	return ids, s.Broadcast(action, ids)
+}
+
+// BroadcastActive broadcasts action to every vehicle that reported within
+// Config.ActiveWindow and is online and not stale, and returns the IDs it
+// targeted, sorted.
+func (s *Server) BroadcastActive(action string) ([]string, error) {
+	window := s.cfg.ActiveWindow
+	if window <= 0 {
+		window = defaultActiveWindow
+	}
+	ids := s.shadows.ActiveVehicles(window)
+	sort.Strings(ids)
+	return ids, s.Broadcast(action, ids)
+}
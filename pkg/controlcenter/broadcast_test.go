@@ -0,0 +1,142 @@
+package controlcenter
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestBroadcastPublishesOneCommandPerTarget(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	targets := []string{"car-001", "car-002", "car-003"}
+	if err := srv.Broadcast(protocol.ActionStop, targets); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	if len(mc.published) != len(targets) {
+		t.Fatalf("published %d commands, want %d", len(mc.published), len(targets))
+	}
+	ids := make(map[string]bool)
+	for i, p := range mc.published {
+		var cmd protocol.ControlCommand
+		if err := protocol.Unmarshal(p.payload, &cmd); err != nil {
+			t.Fatal(err)
+		}
+		if p.topic != protocol.ControlTopic(targets[i]) || cmd.VehicleID != targets[i] || cmd.Action != protocol.ActionStop {
+			t.Errorf("publish %d = %s to %s on %s", i, cmd.Action, cmd.VehicleID, p.topic)
+		}
+		if cmd.CommandID == "" || ids[cmd.CommandID] {
+			t.Errorf("publish %d has command ID %q, want a unique one", i, cmd.CommandID)
+		}
+		ids[cmd.CommandID] = true
+		if cmd.Timestamp == 0 {
+			t.Errorf("publish %d has no timestamp", i)
+		}
+	}
+	if n := srv.acks.Len(); n != len(targets) {
+		t.Errorf("pending commands = %d, want every broadcast command tracked", n)
+	}
+}
+
+func TestBroadcastActiveAddressesMixedCaseVehicles(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	data, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "Car-007", Timestamp: time.Now().UnixMilli()})
+	mc.handlers[protocol.WildcardStateTopic()](mc, &mockMessage{topic: protocol.StateTopic("Car-007"), payload: data})
+
+	ids, err := srv.BroadcastActive(protocol.ActionStop)
+	if err != nil {
+		t.Fatalf("BroadcastActive: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"Car-007"}) {
+		t.Errorf("targets = %q, want the ID the vehicle sent", ids)
+	}
+	if len(mc.published) != 1 || mc.published[0].topic != protocol.ControlTopic("Car-007") {
+		t.Errorf("published %+v, want one command on the vehicle's own control topic", mc.published)
+	}
+}
+
+func TestBroadcastAggregatesFailures(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	refused := errors.New("broker refused")
+	mc.publishErr = func(topic string, _ []byte) error {
+		if strings.Contains(topic, "car-002") || strings.Contains(topic, "car-004") {
+			return refused
+		}
+		return nil
+	}
+
+	err := srv.Broadcast(protocol.ActionStop, []string{"car-004", "car-001", "car-002", "car-003"})
+	var berr *BroadcastError
+	if !errors.As(err, &berr) {
+		t.Fatalf("err = %v, want a *BroadcastError", err)
+	}
+	if got, want := berr.FailedIDs(), []string{"car-002", "car-004"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FailedIDs = %v, want %v", got, want)
+	}
+	if !errors.Is(err, refused) {
+		t.Error("BroadcastError does not wrap the send errors")
+	}
+	if !strings.Contains(err.Error(), "car-002, car-004") {
+		t.Errorf("error %q does not list the failed vehicles", err)
+	}
+	if len(mc.published) != 2 {
+		t.Errorf("published %d commands, want the 2 that succeeded", len(mc.published))
+	}
+}
+
+func TestBroadcastDryRun(t *testing.T) {
+	srv := New(Config{ClientID: "cc", DryRun: true})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	if err := srv.Broadcast(protocol.ActionStop, []string{"car-001", "car-002"}); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	if len(mc.published) != 0 {
+		t.Errorf("published %d commands in dry-run mode, want 0", len(mc.published))
+	}
+}
+
+func TestBroadcastNearAndActive(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	now := time.Now().UnixMilli()
+	for id, p := range map[string][2]float64{
+		"car-001": {39.9000, 116.4000},
+		"car-002": {39.9020, 116.4000}, // ~220 m away
+		"car-003": {39.9500, 116.4000}, // ~5.5 km away
+	} {
+		srv.Shadows().Update(&protocol.VehicleState{VehicleID: id, Timestamp: now, Latitude: p[0], Longitude: p[1]})
+	}
+	srv.Shadows().SetOnline("car-003", false)
+
+	ids, err := srv.BroadcastNear(protocol.ActionStop, 39.9, 116.4, 500)
+	if err != nil {
+		t.Fatalf("BroadcastNear: %v", err)
+	}
+	if want := []string{"car-001", "car-002"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("BroadcastNear targets = %v, want %v", ids, want)
+	}
+
+	ids, err = srv.BroadcastActive(protocol.ActionResume)
+	if err != nil {
+		t.Fatalf("BroadcastActive: %v", err)
+	}
+	if want := []string{"car-001", "car-002"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("BroadcastActive targets = %v, want the online vehicles %v", ids, want)
+	}
+	if len(mc.published) != 4 {
+		t.Errorf("published %d commands, want 4", len(mc.published))
+	}
+}
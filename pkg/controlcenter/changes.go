@@ -0,0 +1,132 @@
+package controlcenter
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// changeBuffer is the capacity of each SubscribeChanges channel.
+const changeBuffer = 256
+
+// ChangeKind classifies a ShadowChange.
+type ChangeKind string
+
+// Shadow change kinds.
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeUpdated ChangeKind = "updated"
+	ChangeRemoved ChangeKind = "removed"
+)
+
+// ShadowChange is a minimal description of one shadow write. Fields holds
+// the state fields that differ from the previous state, keyed by their JSON
+// names; an added vehicle reports every field and a removed one none.
+type ShadowChange struct {
+	Kind      ChangeKind
+	VehicleID string
+	Timestamp int64 // state timestamp, Unix milliseconds; zero on removal
+	Fields    map[string]any
+}
+
+// changeFeed fans shadow changes out to SubscribeChanges subscribers.
+// Because a diff stream is only meaningful without gaps, a subscriber that
+// falls a full buffer behind is dropped and its channel closed; it should
+// resynchronise from Shadows().All() and subscribe again.
+type changeFeed struct {
+	mu   sync.Mutex
+	subs map[<-chan ShadowChange]chan ShadowChange
+	log  logging.Logger
+}
+
+func newChangeFeed(log logging.Logger) *changeFeed {
+	return &changeFeed{subs: make(map[<-chan ShadowChange]chan ShadowChange), log: log}
+}
+
+// SubscribeChanges returns a channel receiving every subsequent shadow
+// change. The channel is closed by UnsubscribeChanges, or when the
+// subscriber falls too far behind to keep up; a closed channel means later
+// changes were missed.
+func (s *Server) SubscribeChanges() <-chan ShadowChange {
+	f := s.changes
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan ShadowChange, changeBuffer)
+	f.subs[ch] = ch
+	return ch
+}
+
+// UnsubscribeChanges stops and closes a channel returned by
+// SubscribeChanges.
+func (s *Server) UnsubscribeChanges(ch <-chan ShadowChange) {
+	f := s.changes
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.subs[ch]; ok {
+		close(c)
+		delete(f.subs, ch)
+	}
+}
+
+func (f *changeFeed) update(prev, next *protocol.VehicleState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.subs) == 0 {
+		return
+	}
+	c := ShadowChange{Kind: ChangeUpdated, VehicleID: next.VehicleID, Timestamp: next.Timestamp}
+	if prev == nil {
+		c.Kind = ChangeAdded
+	}
+	c.Fields = stateDelta(prev, next)
+	if c.Kind == ChangeUpdated && len(c.Fields) == 0 {
+		return // a redelivery; nothing changed
+	}
+	f.send(c)
+}
+
+func (f *changeFeed) remove(_ string, last *protocol.VehicleState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.send(ShadowChange{Kind: ChangeRemoved, VehicleID: last.VehicleID})
+}
+
+// send delivers c to every subscriber. The caller must hold f.mu.
+func (f *changeFeed) send(c ShadowChange) {
+	for key, ch := range f.subs {
+		select {
+		case ch <- c:
+		default:
+			f.log.Warn("change subscriber fell behind, closing its stream")
+			close(ch)
+			delete(f.subs, key)
+		}
+	}
+}
+
+// stateDelta returns the fields of next that differ from prev, keyed by JSON
+// name. With a nil prev every field is returned.
+func stateDelta(prev, next *protocol.VehicleState) map[string]any {
+	nv := reflect.ValueOf(next).Elem()
+	var pv reflect.Value
+	if prev != nil {
+		pv = reflect.ValueOf(prev).Elem()
+	}
+	t := nv.Type()
+	delta := make(map[string]any)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		v := nv.Field(i).Interface()
+		if pv.IsValid() && pv.Field(i).Interface() == v {
+			continue
+		}
+		delta[name] = v
+	}
+	return delta
+}
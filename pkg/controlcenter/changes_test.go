@@ -0,0 +1,85 @@
+package controlcenter
+
+import (
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func nextChange(t *testing.T, ch <-chan ShadowChange) ShadowChange {
+	t.Helper()
+	select {
+	case c, ok := <-ch:
+		if !ok {
+			t.Fatal("change stream closed")
+		}
+		return c
+	default:
+		t.Fatal("no change delivered")
+		return ShadowChange{}
+	}
+}
+
+func TestSubscribeChangesReportsDeltas(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	ch := srv.SubscribeChanges()
+	defer srv.UnsubscribeChanges(ch)
+
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000, Speed: 5, Mode: "autonomous"})
+	if c := nextChange(t, ch); c.Kind != ChangeAdded || c.Fields["mode"] != "autonomous" {
+		t.Errorf("first change = %+v, want added with every field", c)
+	}
+
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1100, Speed: 7, Mode: "autonomous"})
+	c := nextChange(t, ch)
+	if c.Kind != ChangeUpdated || c.VehicleID != "car-001" || c.Timestamp != 1100 {
+		t.Fatalf("change = %+v, want updated car-001 at 1100", c)
+	}
+	if len(c.Fields) != 2 || c.Fields["speed"] != float32(7) || c.Fields["timestamp"] != int64(1100) {
+		t.Errorf("fields = %v, want only speed and timestamp", c.Fields)
+	}
+
+	srv.Shadows().Remove("car-001")
+	if c := nextChange(t, ch); c.Kind != ChangeRemoved || c.VehicleID != "car-001" || len(c.Fields) != 0 {
+		t.Errorf("change = %+v, want removed car-001", c)
+	}
+}
+
+func TestSubscribeChangesMultipleSubscribers(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	a, b := srv.SubscribeChanges(), srv.SubscribeChanges()
+
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000})
+	for _, ch := range []<-chan ShadowChange{a, b} {
+		if c := nextChange(t, ch); c.Kind != ChangeAdded {
+			t.Errorf("change = %+v, want added", c)
+		}
+	}
+
+	srv.UnsubscribeChanges(a)
+	if _, ok := <-a; ok {
+		t.Error("unsubscribed channel still open")
+	}
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1100})
+	if c := nextChange(t, b); c.Kind != ChangeUpdated {
+		t.Errorf("change = %+v, want updated", c)
+	}
+}
+
+func TestSubscribeChangesClosesLaggingSubscriber(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	slow := srv.SubscribeChanges()
+
+	for i := 0; i <= changeBuffer; i++ {
+		srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: int64(1000 + i)})
+	}
+
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != changeBuffer {
+		t.Errorf("lagging subscriber received %d changes before close, want %d", n, changeBuffer)
+	}
+	srv.UnsubscribeChanges(slow) // already dropped; must not panic
+}
@@ -0,0 +1,415 @@
+package controlcenter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/backoff"
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// defaultCommandDeadline applies when CommandQueueConfig.Deadline is zero.
+const defaultCommandDeadline = time.Minute
+
+// ErrCommandUndelivered is passed to CommandQueueConfig.OnFailure for a
+// command the vehicle did not acknowledge before its deadline.
+var ErrCommandUndelivered = errors.New("control-center: command undelivered")
+
+// errAckWait fails a queue attempt whose publish went through but whose ack
+// did not arrive in time.
+var errAckWait = errors.New("no ack in time")
+
+// CommandFailureFunc is called for a queued command that was given up on.
+type CommandFailureFunc func(cmd *protocol.ControlCommand, err error)
+
+// CommandQueueConfig configures a CommandQueue.
+type CommandQueueConfig struct {
+	// Deadline is how long a command is retried before it fails (default
+	// 1m).
+	Deadline time.Duration
+	// AckWait is how long an attempt whose publish succeeded waits for the
+	// vehicle's ack before the command is published again. Zero uses the
+	// action's ack timeout (see Config.AckTimeouts), or the deadline if
+	// that is zero too.
+	AckWait time.Duration
+	// InitialBackoff, MaxBackoff and JitterFraction space out the attempts
+	// as they do reconnects (see backoff.Backoff); the first attempt is
+	// immediate.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	JitterFraction float64
+	// OnFailure, when set, is called with an error wrapping
+	// ErrCommandUndelivered for every command not acknowledged before its
+	// deadline, including ones restored from the WAL that expired while the
+	// control center was down.
+	OnFailure CommandFailureFunc
+	// WALPath, when set, records queued commands in this file so that the
+	// ones still unacknowledged are resumed by the next queue opened on it,
+	// e.g. after a restart. Commands are recorded unencrypted.
+	WALPath string
+}
+
+// CommandQueue delivers commands reliably where SendControl makes a single
+// attempt: it publishes each command until the vehicle acknowledges it or
+// its deadline passes, backing off between attempts, so commands survive a
+// short broker outage. Commands are held in memory and, with
+// CommandQueueConfig.WALPath, on disk.
+//
+// A command is identified by its CommandID: enqueuing one whose ID is still
+// queued does nothing, and vehicles ignore the repeated deliveries of a
+// retried command, so a stop is never executed twice.
+type CommandQueue struct {
+	srv *Server
+	cfg CommandQueueConfig
+	wal *commandWAL // nil without WALPath
+
+	mu      sync.Mutex
+	pending map[string]*queuedCommand
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// queuedCommand is a command being retried by a CommandQueue.
+type queuedCommand struct {
+	cmd      *protocol.ControlCommand
+	deadline time.Time
+	timer    *time.Timer // fires at deadline
+	lastErr  error       // guarded by CommandQueue.mu
+
+	stop     chan struct{} // closed once the command is settled or the queue closed
+	stopOnce sync.Once
+}
+
+func (c *queuedCommand) halt() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// NewCommandQueue returns a CommandQueue sending through s. With
+// cfg.WALPath it resumes the commands left unacknowledged in the WAL.
+func (s *Server) NewCommandQueue(cfg CommandQueueConfig) (*CommandQueue, error) {
+	if cfg.Deadline <= 0 {
+		cfg.Deadline = defaultCommandDeadline
+	}
+	q := &CommandQueue{srv: s, cfg: cfg, pending: make(map[string]*queuedCommand)}
+	var restored []walRecord
+	if cfg.WALPath != "" {
+		var err error
+		if q.wal, restored, err = openCommandWAL(cfg.WALPath, s.log); err != nil {
+			return nil, err
+		}
+	}
+	s.OnAck(q.handleAck)
+
+	now := s.now()
+	for _, r := range restored {
+		if !now.Before(r.Deadline) {
+			q.fail(r.Command, fmt.Errorf("%w: command %s to %s expired while queued on disk", ErrCommandUndelivered, r.Command.CommandID, r.Command.VehicleID))
+			if err := q.wal.done(r.Command.CommandID); err != nil {
+				s.log.Error("command queue WAL", "err", err)
+			}
+			continue
+		}
+		q.mu.Lock()
+		q.start(r.Command, r.Deadline)
+		q.mu.Unlock()
+	}
+	return q, nil
+}
+
+// Enqueue queues cmd for delivery, assigning a CommandID if it has none.
+// It returns once cmd is queued, and in the WAL if one is configured;
+// delivery failures are reported to CommandQueueConfig.OnFailure. A
+// command whose ID is already queued is ignored.
+func (q *CommandQueue) Enqueue(cmd *protocol.ControlCommand) error {
+	if cmd.VehicleID == "" {
+		return errors.New("control-center: queued command requires a vehicle ID")
+	}
+	if cmd.CommandID == "" {
+		cmd.CommandID = newCommandID()
+	}
+	c := *cmd
+	deadline := q.srv.now().Add(q.cfg.Deadline)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("control-center: command queue closed")
+	}
+	if _, ok := q.pending[c.CommandID]; ok {
+		return nil
+	}
+	if q.wal != nil {
+		if err := q.wal.add(walRecord{Command: &c, Deadline: deadline}); err != nil {
+			return fmt.Errorf("control-center: queue command %s: %w", c.CommandID, err)
+		}
+	}
+	q.start(&c, deadline)
+	return nil
+}
+
+// Pending returns the number of commands awaiting acknowledgement.
+func (q *CommandQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Close stops retrying and waits for attempts in flight. Commands still
+// queued stay in the WAL, if any, for the next queue to resume; without one
+// they are dropped. OnFailure is not called for them.
+func (q *CommandQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	for _, c := range q.pending {
+		c.timer.Stop()
+		c.halt()
+	}
+	q.pending = nil
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	if q.wal != nil {
+		return q.wal.close()
+	}
+	return nil
+}
+
+// start tracks cmd and begins its attempts. q.mu must be held.
+func (q *CommandQueue) start(cmd *protocol.ControlCommand, deadline time.Time) {
+	c := &queuedCommand{cmd: cmd, deadline: deadline, stop: make(chan struct{})}
+	q.pending[cmd.CommandID] = c
+	c.timer = time.AfterFunc(deadline.Sub(q.srv.now()), func() { q.expire(c) })
+	q.wg.Add(1)
+	go q.run(c)
+}
+
+// run publishes c until it is settled.
+func (q *CommandQueue) run(c *queuedCommand) {
+	defer q.wg.Done()
+	b := backoff.New(q.cfg.InitialBackoff, q.cfg.MaxBackoff, q.cfg.JitterFraction)
+	// Retry ends with ErrStopped, or nil when an ack ends an attempt; the
+	// command has been settled either way.
+	_ = backoff.Retry(c.stop, b, func() error { return q.attempt(c) }, func(err error, next backoff.State) {
+		q.mu.Lock()
+		c.lastErr = err
+		q.mu.Unlock()
+		q.srv.log.Warn("command attempt failed", "command_id", c.cmd.CommandID, "vehicle_id", c.cmd.VehicleID,
+			"attempt", next.Attempt-1, "err", err, "retry_in", next.Delay)
+	})
+}
+
+// attempt publishes c once and waits for its ack. It returns nil once c is
+// settled.
+func (q *CommandQueue) attempt(c *queuedCommand) error {
+	wire := *c.cmd
+	if err := q.srv.SendControl(&wire); err != nil {
+		return err
+	}
+	if q.srv.cfg.DryRun {
+		// No ack will come for a command that was never published.
+		q.settle(c.cmd.CommandID)
+		return nil
+	}
+	wait := q.cfg.AckWait
+	if wait <= 0 {
+		wait = q.srv.ackTimeout(c.cmd.Action)
+	}
+	if wait <= 0 {
+		wait = time.Until(c.deadline)
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-c.stop:
+		return nil
+	case <-t.C:
+		return errAckWait
+	}
+}
+
+// handleAck settles the queued command an ack answers. Any ack, even a
+// rejection, shows the command was delivered.
+func (q *CommandQueue) handleAck(ack *protocol.CommandAck, _ time.Duration) {
+	q.settle(ack.CommandID)
+}
+
+// settle ends the attempts of a delivered command.
+func (q *CommandQueue) settle(commandID string) {
+	if c := q.remove(commandID); c != nil {
+		c.halt()
+	}
+}
+
+// expire gives up on c at its deadline.
+func (q *CommandQueue) expire(c *queuedCommand) {
+	q.mu.Lock()
+	lastErr := c.lastErr
+	q.mu.Unlock()
+	if q.remove(c.cmd.CommandID) != c {
+		return
+	}
+	c.halt()
+	err := fmt.Errorf("%w: command %s to %s not acknowledged within %v", ErrCommandUndelivered, c.cmd.CommandID, c.cmd.VehicleID, q.cfg.Deadline)
+	if lastErr != nil {
+		err = fmt.Errorf("%w (last attempt: %v)", err, lastErr)
+	}
+	q.fail(c.cmd, err)
+}
+
+// remove drops commandID from the queue and the WAL, returning it, or nil
+// if it was not queued.
+func (q *CommandQueue) remove(commandID string) *queuedCommand {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	c, ok := q.pending[commandID]
+	if !ok {
+		return nil
+	}
+	delete(q.pending, commandID)
+	c.timer.Stop()
+	if q.wal != nil {
+		if err := q.wal.done(commandID); err != nil {
+			q.srv.log.Error("command queue WAL", "err", err)
+		}
+	}
+	return c
+}
+
+// fail logs a command given up on and reports it to OnFailure.
+func (q *CommandQueue) fail(cmd *protocol.ControlCommand, err error) {
+	q.srv.log.Error("command undelivered", "command_id", cmd.CommandID, "vehicle_id", cmd.VehicleID, "err", err)
+	if q.cfg.OnFailure != nil {
+		q.cfg.OnFailure(cmd, err)
+	}
+}
+
+// walRecord is one line of the command WAL: a queued command with its
+// deadline, or the ID of a command that left the queue.
+type walRecord struct {
+	Command  *protocol.ControlCommand `json:"command,omitempty"`
+	Deadline time.Time                `json:"deadline,omitzero"`
+	Done     string                   `json:"done,omitempty"`
+}
+
+// commandWAL appends walRecords to a file, one JSON object per line.
+type commandWAL struct {
+	path string
+	f    *os.File
+	enc  *json.Encoder
+}
+
+// openCommandWAL reads the WAL at path and returns the commands it still
+// holds, in the order they were queued. The file is then compacted to just
+// those commands, so it does not grow across restarts. A missing file is
+// an empty WAL; a line that cannot be decoded, e.g. one torn by a crash, is
+// skipped.
+func openCommandWAL(path string, log logging.Logger) (*commandWAL, []walRecord, error) {
+	var queued []walRecord
+	if f, err := os.Open(path); err == nil {
+		queued, err = readCommandWAL(f, log)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("control-center: read command WAL %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("control-center: open command WAL: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, nil, fmt.Errorf("control-center: compact command WAL: %w", err)
+	}
+	w := &commandWAL{path: path, f: tmp, enc: json.NewEncoder(tmp)}
+	for _, r := range queued {
+		if err := w.enc.Encode(r); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return nil, nil, fmt.Errorf("control-center: compact command WAL: %w", err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, nil, fmt.Errorf("control-center: compact command WAL: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, nil, fmt.Errorf("control-center: compact command WAL: %w", err)
+	}
+	return w, queued, nil
+}
+
+func readCommandWAL(f *os.File, log logging.Logger) ([]walRecord, error) {
+	var order []string
+	queued := make(map[string]walRecord)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 4<<20)
+	for line := 1; sc.Scan(); line++ {
+		var r walRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			log.Warn("skipping bad command WAL line", "path", f.Name(), "line", line, "err", err)
+			continue
+		}
+		switch {
+		case r.Done != "":
+			delete(queued, r.Done)
+		case r.Command != nil && r.Command.CommandID != "":
+			if _, ok := queued[r.Command.CommandID]; !ok {
+				order = append(order, r.Command.CommandID)
+			}
+			queued[r.Command.CommandID] = r
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	var records []walRecord
+	for _, id := range order {
+		if r, ok := queued[id]; ok {
+			records = append(records, r)
+			delete(queued, id)
+		}
+	}
+	return records, nil
+}
+
+// add records a queued command.
+func (w *commandWAL) add(r walRecord) error {
+	return w.append(r)
+}
+
+// done records that commandID left the queue.
+func (w *commandWAL) done(commandID string) error {
+	return w.append(walRecord{Done: commandID})
+}
+
+// append writes r and syncs it to disk, so a queued command survives a
+// crash as soon as Enqueue returns.
+func (w *commandWAL) append(r walRecord) error {
+	if err := w.enc.Encode(r); err != nil {
+		return fmt.Errorf("command WAL %s: %w", w.path, err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("command WAL %s: %w", w.path, err)
+	}
+	return nil
+}
+
+func (w *commandWAL) close() error {
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("control-center: command WAL %s: %w", w.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package controlcenter
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// fastRetry retries queued commands every few milliseconds.
+var fastRetry = CommandQueueConfig{InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, JitterFraction: -1}
+
+// countingPublishes makes mc fail the first failures control publishes and
+// counts every attempt in n. Successful publishes are signalled on the
+// returned channel.
+func countingPublishes(mc *mockClient, failures int32, n *atomic.Int32) <-chan string {
+	ok := make(chan string, 64)
+	mc.publishErr = func(topic string, payload []byte) error {
+		if topic != protocol.ControlTopic("car-001") {
+			return nil
+		}
+		if n.Add(1) <= failures {
+			return errors.New("broker unavailable")
+		}
+		var cmd protocol.ControlCommand
+		_ = protocol.Unmarshal(payload, &cmd)
+		ok <- cmd.CommandID
+		return nil
+	}
+	return ok
+}
+
+func deliverAck(t *testing.T, mc *mockClient, commandID string) {
+	t.Helper()
+	data, _ := protocol.Marshal(&protocol.CommandAck{CommandID: commandID, VehicleID: "car-001", Status: protocol.AckCompleted})
+	mc.handlers[protocol.WildcardAckTopic()](mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: data})
+}
+
+func waitDrained(t *testing.T, q *CommandQueue) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for q.Pending() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d commands still pending", q.Pending())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCommandQueueRetriesFailedPublishes(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	var attempts atomic.Int32
+	published := countingPublishes(mc, 3, &attempts)
+
+	cfg := fastRetry
+	cfg.OnFailure = func(cmd *protocol.ControlCommand, err error) { t.Errorf("OnFailure(%s, %v)", cmd.CommandID, err) }
+	q, err := srv.NewCommandQueue(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	cmd := &protocol.ControlCommand{VehicleID: "car-001", Action: protocol.ActionStop}
+	if err := q.Enqueue(cmd); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if cmd.CommandID == "" {
+		t.Fatal("Enqueue did not assign a command ID")
+	}
+	select {
+	case id := <-published:
+		if id != cmd.CommandID {
+			t.Fatalf("published %s, want %s", id, cmd.CommandID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("command never published")
+	}
+	if n := attempts.Load(); n != 4 {
+		t.Errorf("published on attempt %d, want 4 after 3 failures", n)
+	}
+	deliverAck(t, mc, cmd.CommandID)
+	waitDrained(t, q)
+}
+
+func TestCommandQueueRepublishesUntilAcked(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	var attempts atomic.Int32
+	published := countingPublishes(mc, 0, &attempts)
+
+	cfg := fastRetry
+	cfg.AckWait = 5 * time.Millisecond
+	q, _ := srv.NewCommandQueue(cfg)
+	defer q.Close()
+
+	cmd := &protocol.ControlCommand{CommandID: "stop-1", VehicleID: "car-001", Action: protocol.ActionStop}
+	if err := q.Enqueue(cmd); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if id := <-published; id != "stop-1" {
+			t.Fatalf("republished as %s, want the same command ID", id)
+		}
+	}
+	deliverAck(t, mc, "stop-1")
+	waitDrained(t, q)
+}
+
+func TestCommandQueueReportsDeadline(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	var attempts atomic.Int32
+	countingPublishes(mc, 1<<30, &attempts)
+
+	failed := make(chan error, 1)
+	cfg := fastRetry
+	cfg.Deadline = 30 * time.Millisecond
+	cfg.OnFailure = func(cmd *protocol.ControlCommand, err error) { failed <- err }
+	q, _ := srv.NewCommandQueue(cfg)
+	defer q.Close()
+
+	if err := q.Enqueue(&protocol.ControlCommand{CommandID: "stop-1", VehicleID: "car-001", Action: protocol.ActionStop}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-failed:
+		if !errors.Is(err, ErrCommandUndelivered) {
+			t.Errorf("err = %v, want ErrCommandUndelivered", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnFailure not called at the deadline")
+	}
+	if q.Pending() != 0 {
+		t.Errorf("Pending = %d after the deadline", q.Pending())
+	}
+	if attempts.Load() < 2 {
+		t.Errorf("%d attempts before the deadline, want retries", attempts.Load())
+	}
+}
+
+func TestCommandQueueDeduplicatesByCommandID(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	var attempts atomic.Int32
+	countingPublishes(mc, 1<<30, &attempts)
+
+	q, _ := srv.NewCommandQueue(CommandQueueConfig{InitialBackoff: time.Hour})
+	defer q.Close()
+	for range 2 {
+		if err := q.Enqueue(&protocol.ControlCommand{CommandID: "stop-1", VehicleID: "car-001", Action: protocol.ActionStop}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := q.Pending(); n != 1 {
+		t.Errorf("Pending = %d, want the duplicate ignored", n)
+	}
+}
+
+func TestCommandQueueResumesFromWAL(t *testing.T) {
+	wal := filepath.Join(t.TempDir(), "commands.wal")
+
+	// The broker is down: the command stays queued until shutdown.
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	var attempts atomic.Int32
+	countingPublishes(mc, 1<<30, &attempts)
+	cfg := fastRetry
+	cfg.WALPath = wal
+	q, err := srv.NewCommandQueue(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(&protocol.ControlCommand{CommandID: "stop-1", VehicleID: "car-001", Action: protocol.ActionStop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart the command is delivered and acknowledged.
+	srv = New(Config{ClientID: "cc"})
+	mc = newMockClient()
+	srv.ConnectWithClient(mc)
+	published := countingPublishes(mc, 0, &attempts)
+	if q, err = srv.NewCommandQueue(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if id := <-published; id != "stop-1" {
+		t.Fatalf("resumed %s, want stop-1", id)
+	}
+	deliverAck(t, mc, "stop-1")
+	waitDrained(t, q)
+	q.Close()
+
+	if q, err = srv.NewCommandQueue(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if n := q.Pending(); n != 0 {
+		t.Errorf("Pending = %d after the acked command was reopened", n)
+	}
+}
+
+func TestCommandQueueFailsExpiredWALEntries(t *testing.T) {
+	wal := filepath.Join(t.TempDir(), "commands.wal")
+	srv := New(Config{ClientID: "cc"})
+	q, err := srv.NewCommandQueue(CommandQueueConfig{WALPath: wal, Deadline: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(&protocol.ControlCommand{CommandID: "stop-1", VehicleID: "car-001", Action: protocol.ActionStop}); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	srv = New(Config{ClientID: "cc"})
+	srv.now = func() time.Time { return time.Now().Add(time.Hour) }
+	var failed []string
+	q, err = srv.NewCommandQueue(CommandQueueConfig{
+		WALPath:   wal,
+		OnFailure: func(cmd *protocol.ControlCommand, err error) { failed = append(failed, cmd.CommandID) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if len(failed) != 1 || failed[0] != "stop-1" || q.Pending() != 0 {
+		t.Errorf("failed = %v, pending = %d; want stop-1 failed on restore", failed, q.Pending())
+	}
+}
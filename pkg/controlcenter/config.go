@@ -0,0 +1,104 @@
+package controlcenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// configQueries routes config reports to the QueryConfig call awaiting them.
+type configQueries struct {
+	mu      sync.Mutex
+	waiters map[string]chan *protocol.ConfigReport
+}
+
+func newConfigQueries() *configQueries {
+	return &configQueries{waiters: make(map[string]chan *protocol.ConfigReport)}
+}
+
+func (r *configQueries) add(queryID string) chan *protocol.ConfigReport {
+	ch := make(chan *protocol.ConfigReport, 1)
+	r.mu.Lock()
+	r.waiters[queryID] = ch
+	r.mu.Unlock()
+	return ch
+}
+
+func (r *configQueries) remove(queryID string) {
+	r.mu.Lock()
+	delete(r.waiters, queryID)
+	r.mu.Unlock()
+}
+
+// resolve delivers report to its waiter and reports whether one was waiting.
+func (r *configQueries) resolve(report *protocol.ConfigReport) bool {
+	r.mu.Lock()
+	ch, ok := r.waiters[report.QueryID]
+	delete(r.waiters, report.QueryID)
+	r.mu.Unlock()
+	if ok {
+		ch <- report
+	}
+	return ok
+}
+
+// QueryConfig asks vehicleID for the settings it is currently running with
+// and waits up to timeout for its report.
+func (s *Server) QueryConfig(vehicleID string, timeout time.Duration) (*protocol.ConfigReport, error) {
+	q := &protocol.ConfigQuery{
+		QueryID:   newCommandID(),
+		VehicleID: vehicleID,
+		Timestamp: s.now().UnixMilli(),
+	}
+	data, err := s.codec().Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.DryRun {
+		s.log.Info("dry run, not publishing config query", "vehicle_id", vehicleID, "payload", string(data))
+		return nil, fmt.Errorf("%w: config query to %s", ErrDryRun, vehicleID)
+	}
+
+	ch := s.configs.add(q.QueryID)
+	defer s.configs.remove(q.QueryID)
+
+	var errs []error
+	for _, t := range s.vehicleTopics(vehicleID) {
+		token := s.client.Publish(t.ConfigQuery(vehicleID), 1, false, data)
+		token.Wait()
+		if err := token.Error(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("control-center: query config of %s: %w", vehicleID, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	select {
+	case report := <-ch:
+		return report, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("control-center: query config of %s: %w", vehicleID, ctx.Err())
+	}
+}
+
+func (s *Server) handleConfig(_ mqtt.Client, msg mqtt.Message) {
+	defer s.recoverHandler("config", msg.Topic())
+	report := &protocol.ConfigReport{}
+	if err := s.decode(msg.Payload(), report); err != nil {
+		s.log.Error("bad config report", "topic", msg.Topic(), "err", err)
+		return
+	}
+	if !s.configs.resolve(report) {
+		s.log.Debug("dropping unmatched config report", "query_id", report.QueryID, "vehicle_id", report.VehicleID)
+	}
+}
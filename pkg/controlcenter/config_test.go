@@ -0,0 +1,37 @@
+package controlcenter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestQueryConfigTimesOut(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	_, err := srv.QueryConfig("car-001", 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+	if len(mc.published) != 1 || mc.published[0].topic != protocol.ConfigQueryTopic("car-001") {
+		t.Errorf("published = %+v, want one query on the config_query topic", mc.published)
+	}
+}
+
+func TestUnmatchedConfigReportIgnored(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	handler := mc.handlers[protocol.WildcardConfigTopic()]
+	if handler == nil {
+		t.Fatal("no handler for wildcard config topic")
+	}
+	data, _ := protocol.Marshal(&protocol.ConfigReport{QueryID: "unknown", VehicleID: "car-001"})
+	handler(mc, &mockMessage{topic: protocol.ConfigTopic("car-001"), payload: data})
+}
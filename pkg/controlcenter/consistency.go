@@ -0,0 +1,71 @@
+package controlcenter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// FetchShadows downloads the shadow of the control center whose HTTPServer
+// is at baseURL (e.g. "http://cc-standby:8080") from its /snapshot export.
+func FetchShadows(ctx context.Context, baseURL string) (map[string]*shadow.Entry, error) {
+	url := strings.TrimSuffix(baseURL, "/") + "/snapshot"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("control-center: fetch %s: %w", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("control-center: fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("control-center: fetch %s: %s", url, resp.Status)
+	}
+
+	entries := make(map[string]*shadow.Entry)
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var v VehicleResponse
+		if err := json.Unmarshal(sc.Bytes(), &v); err != nil {
+			return nil, fmt.Errorf("control-center: fetch %s: %w", url, err)
+		}
+		if v.State == nil {
+			continue
+		}
+		entries[v.State.VehicleID] = &shadow.Entry{
+			State:     v.State,
+			UpdatedAt: v.UpdatedAt,
+			Version:   v.Version,
+			Stale:     v.Stale,
+			Online:    v.Online,
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("control-center: fetch %s: %w", url, err)
+	}
+	return entries, nil
+}
+
+// DiffCenters fetches the shadows of two control centers, typically an
+// active and a standby one, and reports where they disagree (see
+// shadow.Diff). tolerance absorbs the states in flight between the two
+// fetches.
+func DiffCenters(ctx context.Context, baseURLA, baseURLB string, tolerance time.Duration) (shadow.DiffReport, error) {
+	a, err := FetchShadows(ctx, baseURLA)
+	if err != nil {
+		return shadow.DiffReport{}, err
+	}
+	b, err := FetchShadows(ctx, baseURLB)
+	if err != nil {
+		return shadow.DiffReport{}, err
+	}
+	return shadow.Diff(a, b, tolerance), nil
+}
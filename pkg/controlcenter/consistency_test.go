@@ -0,0 +1,54 @@
+package controlcenter
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+func TestDiffCentersOverHTTP(t *testing.T) {
+	active, standby := shadow.NewManager(), shadow.NewManager()
+	active.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 20_000, Speed: 4})
+	active.Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: 20_000})
+	standby.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 12_000})
+	standby.Update(&protocol.VehicleState{VehicleID: "car-003", Timestamp: 20_000})
+
+	a := httptest.NewServer(NewHTTPServer(active))
+	defer a.Close()
+	b := httptest.NewServer(NewHTTPServer(standby))
+	defer b.Close()
+
+	got, err := FetchShadows(context.Background(), a.URL+"/")
+	if err != nil {
+		t.Fatalf("FetchShadows: %v", err)
+	}
+	if e := got["car-001"]; len(got) != 2 || e == nil || e.State.Speed != 4 || e.Version != 1 || !e.Online {
+		t.Errorf("FetchShadows = %+v", got)
+	}
+
+	r, err := DiffCenters(context.Background(), a.URL, b.URL, time.Second)
+	if err != nil {
+		t.Fatalf("DiffCenters: %v", err)
+	}
+	want := shadow.DiffReport{
+		OnlyInA:  []string{"car-002"},
+		OnlyInB:  []string{"car-003"},
+		Diverged: []shadow.Divergence{{VehicleID: "car-001", TimestampA: 20_000, TimestampB: 12_000}},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("DiffCenters = %+v, want %+v", r, want)
+	}
+}
+
+func TestFetchShadowsReportsHTTPErrors(t *testing.T) {
+	srv := httptest.NewServer(NewHTTPServer(shadow.NewManager()))
+	defer srv.Close()
+	if _, err := FetchShadows(context.Background(), srv.URL+"/nope"); err == nil {
+		t.Error("expected an error for a 404")
+	}
+}
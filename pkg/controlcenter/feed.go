@@ -0,0 +1,52 @@
+package controlcenter
+
+import (
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// OperatorAssigner picks the operator responsible for an alert. It returns
+// "" when no operator is assigned.
+type OperatorAssigner func(alert *protocol.TeleoperationAlert) string
+
+// SetOperatorAssigner installs fn to fill FeedAlert.AssignedOperator on
+// alerts republished to the feed topic (see Config.AlertFeed).
+func (s *Server) SetOperatorAssigner(fn OperatorAssigner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.assignOperator = fn
+}
+
+// republishAlert publishes alert, enriched with control-center metadata, to
+// protocol.AlertFeedTopic. It is registered as an alerter listener, so only
+// alerts that pass deduplication and rate limiting reach the feed. It does
+// not wait for the publish to complete.
+func (s *Server) republishAlert(alert *protocol.TeleoperationAlert) {
+	if s.client == nil || s.cfg.DryRun {
+		return
+	}
+	s.mu.RLock()
+	assign := s.assignOperator
+	s.mu.RUnlock()
+
+	feed := &protocol.FeedAlert{
+		TeleoperationAlert: *alert,
+		ReceivedAt:         s.now().UnixMilli(),
+	}
+	if assign != nil {
+		feed.AssignedOperator = assign(alert)
+	}
+	data, err := s.codec().Marshal(feed)
+	if err != nil {
+		s.log.Error("encode feed alert", "err", err)
+		return
+	}
+	token := s.client.Publish(protocol.AlertFeedTopic, 1, false, data)
+	// This runs in the MQTT callback that delivered the alert, which must
+	// not wait for the broker; the outcome is logged when it arrives.
+	go func() {
+		<-token.Done()
+		if err := token.Error(); err != nil {
+			s.log.Error("publish alert feed", "topic", protocol.AlertFeedTopic, "err", err)
+		}
+	}()
+}
@@ -0,0 +1,117 @@
+package controlcenter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestAlertFeedRepublishesEnrichedAlert(t *testing.T) {
+	srv := New(Config{ClientID: "cc", AlertFeed: true})
+	receivedAt := time.UnixMilli(1_700_000_000_000)
+	srv.now = func() time.Time { return receivedAt }
+	srv.SetOperatorAssigner(func(a *protocol.TeleoperationAlert) string { return "op-" + a.VehicleID })
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	alert := &protocol.TeleoperationAlert{AlertID: "a-1", VehicleID: "car-001", Reason: "extreme_weather", Severity: 3, Timestamp: 42}
+	data, _ := protocol.Marshal(alert)
+	mc.handlers[protocol.WildcardAlertTopic()](mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: data})
+
+	if len(mc.published) != 1 || mc.published[0].topic != protocol.AlertFeedTopic {
+		t.Fatalf("published = %v, want one message on %s", mc.published, protocol.AlertFeedTopic)
+	}
+	var got protocol.FeedAlert
+	if err := protocol.Unmarshal(mc.published[0].payload, &got); err != nil {
+		t.Fatalf("decode feed alert: %v", err)
+	}
+	if got.AlertID != "a-1" || got.VehicleID != "car-001" || got.Reason != "extreme_weather" || got.Timestamp != 42 {
+		t.Errorf("feed alert = %+v, want original alert fields", got.TeleoperationAlert)
+	}
+	if got.ReceivedAt != receivedAt.UnixMilli() {
+		t.Errorf("ReceivedAt = %d, want %d", got.ReceivedAt, receivedAt.UnixMilli())
+	}
+	if got.AssignedOperator != "op-car-001" {
+		t.Errorf("AssignedOperator = %q, want op-car-001", got.AssignedOperator)
+	}
+}
+
+func TestAlertFeedIsOptIn(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	data, _ := protocol.Marshal(&protocol.TeleoperationAlert{VehicleID: "car-001", Severity: 1})
+	mc.handlers[protocol.WildcardAlertTopic()](mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: data})
+
+	if len(mc.published) != 0 {
+		t.Errorf("published = %v, want nothing without AlertFeed", mc.published)
+	}
+}
+
+// pendingToken is a publish token that completes, with err, once done is
+// closed.
+type pendingToken struct {
+	done chan struct{}
+	err  error
+}
+
+func (t *pendingToken) Wait() bool { <-t.done; return true }
+func (t *pendingToken) WaitTimeout(d time.Duration) bool {
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+func (t *pendingToken) Done() <-chan struct{} { return t.done }
+func (t *pendingToken) Error() error          { return t.err }
+
+// pendingClient is a mockClient whose publishes stay pending on token.
+type pendingClient struct {
+	*mockClient
+	token *pendingToken
+}
+
+func (c *pendingClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mockClient.Publish(topic, qos, retained, payload)
+	return c.token
+}
+
+func TestAlertFeedDoesNotBlockTheCallback(t *testing.T) {
+	var rec logging.Recorder
+	srv := New(Config{ClientID: "cc", AlertFeed: true, Logger: &rec})
+	token := &pendingToken{done: make(chan struct{}), err: errors.New("broker gone")}
+	mc := &pendingClient{mockClient: newMockClient(), token: token}
+	srv.ConnectWithClient(mc)
+
+	data, _ := protocol.Marshal(&protocol.TeleoperationAlert{AlertID: "a-1", VehicleID: "car-001", Reason: "extreme_weather", Timestamp: 42})
+	returned := make(chan struct{})
+	go func() {
+		mc.handlers[protocol.WildcardAlertTopic()](mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: data})
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("alert callback waited for the feed publish")
+	}
+
+	close(token.done)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := rec.Find(logging.LevelError, "publish alert feed"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("logged %+v, want the failed feed publish", rec.Entries())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
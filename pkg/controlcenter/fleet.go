@@ -0,0 +1,20 @@
+package controlcenter
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/daohu527/vlink/pkg/fleetpb"
+)
+
+// FleetSnapshot serializes the shadow of every tracked vehicle as a protobuf
+// FleetSnapshot message (proto/fleet.proto), e.g. for a gRPC analytics
+// service. Decode it with proto.Unmarshal into a fleetpb.FleetSnapshot.
+func (s *Server) FleetSnapshot() ([]byte, error) {
+	data, err := proto.Marshal(fleetpb.FromEntries(s.shadows.All(), s.now()))
+	if err != nil {
+		return nil, fmt.Errorf("control-center: fleet snapshot: %w", err)
+	}
+	return data, nil
+}
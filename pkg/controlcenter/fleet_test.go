@@ -0,0 +1,58 @@
+package controlcenter
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/daohu527/vlink/pkg/fleetpb"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestFleetSnapshotRoundTrip(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	now := time.Now().UnixMilli()
+	states := []*protocol.VehicleState{
+		{VehicleID: "car-002", Timestamp: now, Latitude: 39.9042, Longitude: 116.4074, Speed: 8.5,
+			Heading: 270, Gear: protocol.GearDrive, BatteryPct: 64, Mode: "autonomous", Seq: 41},
+		{VehicleID: "car-001", Timestamp: now, Latitude: -33.8688, Longitude: 151.2093, Altitude: 12,
+			Gear: protocol.GearPark, BatteryPct: 99.5, Mode: "manual", Emergency: true},
+	}
+	for _, s := range states {
+		srv.Shadows().Update(s)
+	}
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: now + 100, Speed: 9, Mode: "teleoperation"})
+	srv.Shadows().MarkStale("car-001")
+
+	data, err := srv.FleetSnapshot()
+	if err != nil {
+		t.Fatalf("FleetSnapshot: %v", err)
+	}
+	var snap fleetpb.FleetSnapshot
+	if err := proto.Unmarshal(data, &snap); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if snap.Timestamp == 0 {
+		t.Error("snapshot timestamp not set")
+	}
+	if len(snap.Vehicles) != 2 || snap.Vehicles[0].State.VehicleId != "car-001" {
+		t.Fatalf("vehicles = %+v, want car-001 then car-002", snap.Vehicles)
+	}
+
+	got := snap.Entries()
+	for id, want := range srv.Shadows().All() {
+		e, ok := got[id]
+		if !ok {
+			t.Errorf("%s missing from snapshot", id)
+			continue
+		}
+		if *e.State != *want.State {
+			t.Errorf("%s state = %+v, want %+v", id, *e.State, *want.State)
+		}
+		if e.Version != want.Version || e.Stale != want.Stale || e.Online != want.Online || e.UpdatedAt.UnixMilli() != want.UpdatedAt.UnixMilli() {
+			t.Errorf("%s entry = {v%d stale=%v %v}, want {v%d stale=%v %v}",
+				id, e.Version, e.Stale, e.UpdatedAt, want.Version, want.Stale, want.UpdatedAt)
+		}
+	}
+}
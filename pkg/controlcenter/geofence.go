@@ -0,0 +1,123 @@
+package controlcenter
+
+import (
+	"sync"
+
+	"github.com/daohu527/vlink/pkg/geofence"
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// ReasonGeofenceExit is the Reason of alerts raised when a vehicle leaves
+// its geofence. Agents with their own Config.Geofence raise the same reason.
+const ReasonGeofenceExit = "geofence_exit"
+
+// geofenceSeverity is the severity of geofence alerts.
+const geofenceSeverity = 3
+
+// GeofenceFunc is called when a vehicle leaves its geofence, with the first
+// state received from outside it.
+type GeofenceFunc func(vehicleID string, state *protocol.VehicleState)
+
+// geofences holds the fences set with SetGeofence and which vehicles are
+// currently outside theirs.
+type geofences struct {
+	mu        sync.Mutex
+	fleet     *geofence.Fence            // nil when unset
+	vehicles  map[string]*geofence.Fence // canonical ID -> fence
+	outside   map[string]bool
+	listeners []GeofenceFunc
+}
+
+func newGeofences() *geofences {
+	return &geofences{vehicles: make(map[string]*geofence.Fence), outside: make(map[string]bool)}
+}
+
+// SetGeofence restricts vehicleID to fence, or every vehicle without a fence
+// of its own when vehicleID is empty. An empty fence removes it. When a
+// vehicle's state first places it outside its fence, the OnGeofenceExit
+// listeners are called and a ReasonGeofenceExit alert is raised through the
+// Alerter; it is raised again only after the vehicle has come back inside.
+// Replacing a fence re-arms the check. States without a position fix are
+// not checked. SetGeofence returns an error, and changes nothing, if fence
+// fails geofence.Polygon.Validate.
+func (s *Server) SetGeofence(vehicleID string, polygon geofence.Polygon) error {
+	var fence *geofence.Fence
+	if len(polygon) > 0 {
+		var err error
+		if fence, err = polygon.Compile(); err != nil {
+			return err
+		}
+	}
+	g := s.fences
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case vehicleID == "":
+		g.fleet = fence
+		clear(g.outside)
+		return nil
+	case fence == nil:
+		delete(g.vehicles, shadow.CanonicalID(vehicleID))
+	default:
+		g.vehicles[shadow.CanonicalID(vehicleID)] = fence
+	}
+	delete(g.outside, shadow.CanonicalID(vehicleID))
+	return nil
+}
+
+// OnGeofenceExit registers fn to be called whenever a vehicle leaves its
+// geofence (see SetGeofence).
+func (s *Server) OnGeofenceExit(fn GeofenceFunc) {
+	g := s.fences
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// Copy on write: checkGeofence iterates the old slice without the lock.
+	ls := make([]GeofenceFunc, len(g.listeners), len(g.listeners)+1)
+	copy(ls, g.listeners)
+	g.listeners = append(ls, fn)
+}
+
+// checkGeofence is a shadow update listener that detects a vehicle leaving
+// its fence.
+func (s *Server) checkGeofence(_, next *protocol.VehicleState) {
+	if !next.HasPosition() {
+		return
+	}
+	id := shadow.CanonicalID(next.VehicleID)
+	g := s.fences
+	g.mu.Lock()
+	fence, ok := g.vehicles[id]
+	if !ok {
+		fence = g.fleet
+	}
+	if fence == nil {
+		g.mu.Unlock()
+		return
+	}
+	out := !fence.Contains(next.Latitude, next.Longitude)
+	exited := out && !g.outside[id]
+	if out {
+		g.outside[id] = true
+	} else {
+		delete(g.outside, id)
+	}
+	ls := g.listeners
+	g.mu.Unlock()
+	if !exited {
+		return
+	}
+
+	for _, fn := range ls {
+		fn(next.VehicleID, next)
+	}
+	s.alerter.Handle(&protocol.TeleoperationAlert{
+		AlertID:   protocol.NewID(),
+		VehicleID: next.VehicleID,
+		Timestamp: s.now().UnixMilli(),
+		Reason:    ReasonGeofenceExit,
+		Latitude:  next.Latitude,
+		Longitude: next.Longitude,
+		Severity:  geofenceSeverity,
+	})
+}
@@ -0,0 +1,116 @@
+package controlcenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/geofence"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// square returns the fence with the given corners.
+func square(minLat, minLon, maxLat, maxLon float64) geofence.Polygon {
+	return geofence.Polygon{
+		{Lat: minLat, Lon: minLon}, {Lat: minLat, Lon: maxLon},
+		{Lat: maxLat, Lon: maxLon}, {Lat: maxLat, Lon: minLon},
+	}
+}
+
+var depot = square(39.89, 116.39, 39.91, 116.41)
+
+func TestGeofenceExitAlertsOncePerExit(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	if err := srv.SetGeofence("", depot); err != nil {
+		t.Fatalf("SetGeofence: %v", err)
+	}
+	var exits []string
+	srv.OnGeofenceExit(func(id string, s *protocol.VehicleState) {
+		exits = append(exits, id)
+	})
+	var alerts []*protocol.TeleoperationAlert
+	srv.Alerter().Register(func(a *protocol.TeleoperationAlert) {
+		if a.Reason == ReasonGeofenceExit {
+			alerts = append(alerts, a)
+		}
+	})
+
+	now := time.Now().UnixMilli()
+	move := func(lat, lon float64) {
+		now++
+		srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now, Latitude: lat, Longitude: lon})
+	}
+	move(39.90, 116.40) // inside
+	move(39.91, 116.40) // on the boundary counts as inside
+	move(39.95, 116.40) // out
+	move(39.96, 116.40) // still out
+	if len(exits) != 1 || len(alerts) != 1 {
+		t.Fatalf("exits = %v, alerts = %d; want one of each", exits, len(alerts))
+	}
+	if a := alerts[0]; a.VehicleID != "car-001" || a.Latitude != 39.95 || a.Severity != geofenceSeverity {
+		t.Errorf("alert = %+v", a)
+	}
+
+	move(39.90, 116.40) // back in
+	move(39.80, 116.40) // and out again
+	if len(exits) != 2 || len(alerts) != 2 {
+		t.Errorf("exits = %v, alerts = %d; want a second exit after re-entering", exits, len(alerts))
+	}
+}
+
+func TestPerVehicleGeofenceOverridesFleet(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	wide := square(39, 116, 41, 117)
+	if err := srv.SetGeofence("", wide); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.SetGeofence("Car-001", depot); err != nil {
+		t.Fatal(err)
+	}
+	var exits []string
+	srv.OnGeofenceExit(func(id string, _ *protocol.VehicleState) { exits = append(exits, id) })
+
+	now := time.Now().UnixMilli()
+	for _, id := range []string{"car-001", "car-002"} {
+		srv.Shadows().Update(&protocol.VehicleState{VehicleID: id, Timestamp: now, Latitude: 40.5, Longitude: 116.5})
+	}
+	if len(exits) != 1 || exits[0] != "car-001" {
+		t.Fatalf("exits = %v, want car-001 only (outside its depot, inside the fleet fence)", exits)
+	}
+
+	// Without its own fence the vehicle falls back to the fleet's.
+	if err := srv.SetGeofence("car-001", nil); err != nil {
+		t.Fatal(err)
+	}
+	now++
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now, Latitude: 42, Longitude: 116.5})
+	if len(exits) != 2 {
+		t.Errorf("exits = %v, want car-001 to leave the fleet fence", exits)
+	}
+}
+
+func TestSetGeofenceRejectsDegeneratePolygon(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	if err := srv.SetGeofence("car-001", geofence.Polygon{{Lat: 0, Lon: 0}, {Lat: 1, Lon: 1}}); err == nil {
+		t.Error("SetGeofence accepted a two-vertex fence")
+	}
+}
+
+func TestGeofenceIgnoresStatesWithoutFix(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	if err := srv.SetGeofence("", depot); err != nil {
+		t.Fatal(err)
+	}
+	var exits []string
+	srv.OnGeofenceExit(func(id string, _ *protocol.VehicleState) { exits = append(exits, id) })
+
+	now := time.Now().UnixMilli()
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "Car-001", Timestamp: now, Latitude: 39.90, Longitude: 116.40})
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "Car-001", Timestamp: now + 1}) // GPS dropout
+	if len(exits) != 0 {
+		t.Fatalf("exits = %v, want none for a state without a fix", exits)
+	}
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "Car-001", Timestamp: now + 2, Latitude: 39.95, Longitude: 116.40})
+	if len(exits) != 1 || exits[0] != "Car-001" {
+		t.Errorf("exits = %v, want Car-001 as it reports itself", exits)
+	}
+}
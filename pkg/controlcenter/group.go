@@ -0,0 +1,131 @@
+package controlcenter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// defaultActiveWindow is used when Config.ActiveWindow is zero.
+const defaultActiveWindow = 5 * time.Second
+
+// ErrNoActiveMember is returned by DispatchToGroup when no member of the
+// group has reported recently.
+var ErrNoActiveMember = errors.New("control-center: no active vehicle in group")
+
+// GroupMember is a vehicle in a dispatch group. Weight sets its share of
+// dispatched commands relative to the other members; values below 1 count
+// as 1.
+type GroupMember struct {
+	VehicleID string
+	Weight    int
+}
+
+// vehicleGroups holds dispatch groups and their smooth weighted round-robin
+// state.
+type vehicleGroups struct {
+	mu     sync.Mutex
+	groups map[string][]*groupSlot
+}
+
+type groupSlot struct {
+	GroupMember
+	current int
+}
+
+func newVehicleGroups() *vehicleGroups {
+	return &vehicleGroups{groups: make(map[string][]*groupSlot)}
+}
+
+// SetGroup defines group as vehicleIDs, each with weight 1, replacing any
+// earlier definition.
+func (s *Server) SetGroup(group string, vehicleIDs ...string) {
+	members := make([]GroupMember, len(vehicleIDs))
+	for i, id := range vehicleIDs {
+		members[i] = GroupMember{VehicleID: id, Weight: 1}
+	}
+	s.SetWeightedGroup(group, members)
+}
+
+// SetWeightedGroup defines group as members, replacing any earlier
+// definition. An empty members list deletes the group.
+func (s *Server) SetWeightedGroup(group string, members []GroupMember) {
+	g := s.groups
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(members) == 0 {
+		delete(g.groups, group)
+		return
+	}
+	slots := make([]*groupSlot, len(members))
+	for i, m := range members {
+		if m.Weight < 1 {
+			m.Weight = 1
+		}
+		slots[i] = &groupSlot{GroupMember: m}
+	}
+	g.groups[group] = slots
+}
+
+// DispatchToGroup sends cmd to one active member of group, chosen by
+// weighted round-robin, and returns that member's vehicle ID. A member is
+// active if its shadow was updated within Config.ActiveWindow, by the
+// server's clock, and it is neither stale nor offline, whether by its last
+// will or by liveness; inactive members are skipped without losing their
+// turn order. cmd.VehicleID is overwritten with the chosen vehicle.
+func (s *Server) DispatchToGroup(group string, cmd *protocol.ControlCommand) (string, error) {
+	id, err := s.groups.pick(group, s.isActive)
+	if err != nil {
+		return "", err
+	}
+	cmd.VehicleID = id
+	if err := s.SendControl(cmd); err != nil {
+		return "", fmt.Errorf("control-center: dispatch to group %s: %w", group, err)
+	}
+	return id, nil
+}
+
+// pick chooses the next active member of group using smooth weighted
+// round-robin: every active member gains its weight, the one with the most
+// accumulated credit is chosen and pays back the total.
+func (g *vehicleGroups) pick(group string, active func(string) bool) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	slots, ok := g.groups[group]
+	if !ok {
+		return "", fmt.Errorf("control-center: unknown group %q", group)
+	}
+	var best *groupSlot
+	total := 0
+	for _, sl := range slots {
+		if !active(sl.VehicleID) {
+			continue
+		}
+		sl.current += sl.Weight
+		total += sl.Weight
+		if best == nil || sl.current > best.current {
+			best = sl
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("%w %q", ErrNoActiveMember, group)
+	}
+	best.current -= total
+	return best.VehicleID, nil
+}
+
+func (s *Server) isActive(vehicleID string) bool {
+	e, ok := s.shadows.Get(vehicleID)
+	if !ok || e.Stale || !e.Online || e.Liveness == shadow.LivenessOffline {
+		return false
+	}
+	window := s.cfg.ActiveWindow
+	if window <= 0 {
+		window = defaultActiveWindow
+	}
+	return s.now().Sub(e.UpdatedAt) <= window
+}
@@ -0,0 +1,114 @@
+package controlcenter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func reportStates(srv *Server, ids ...string) {
+	for _, id := range ids {
+		srv.Shadows().Update(&protocol.VehicleState{VehicleID: id, Timestamp: time.Now().UnixMilli()})
+	}
+}
+
+func TestDispatchToGroupCyclesActiveMembers(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	reportStates(srv, "car-001", "car-002", "car-003")
+	srv.SetGroup("pool", "car-001", "car-002", "car-003")
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		id, err := srv.DispatchToGroup("pool", &protocol.ControlCommand{Action: protocol.ActionResume})
+		if err != nil {
+			t.Fatalf("DispatchToGroup: %v", err)
+		}
+		got = append(got, id)
+	}
+	want := []string{"car-001", "car-002", "car-003", "car-001", "car-002", "car-003"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("dispatch order = %v, want %v", got, want)
+		}
+	}
+	if last := mc.published[len(mc.published)-1].topic; last != protocol.ControlTopic("car-003") {
+		t.Errorf("last command published to %q", last)
+	}
+
+	// An inactive member is skipped.
+	srv.Shadows().MarkStale("car-002")
+	got = got[:0]
+	for i := 0; i < 4; i++ {
+		id, _ := srv.DispatchToGroup("pool", &protocol.ControlCommand{Action: protocol.ActionResume})
+		got = append(got, id)
+	}
+	for _, id := range got {
+		if id == "car-002" {
+			t.Fatalf("dispatched to stale vehicle: %v", got)
+		}
+	}
+}
+
+func TestDispatchToGroupHonoursWeights(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	srv.ConnectWithClient(newMockClient())
+	reportStates(srv, "car-001", "car-002")
+	srv.SetWeightedGroup("pool", []GroupMember{{VehicleID: "car-001", Weight: 2}, {VehicleID: "car-002", Weight: 1}})
+
+	counts := make(map[string]int)
+	for i := 0; i < 9; i++ {
+		id, err := srv.DispatchToGroup("pool", &protocol.ControlCommand{Action: protocol.ActionResume})
+		if err != nil {
+			t.Fatalf("DispatchToGroup: %v", err)
+		}
+		counts[id]++
+	}
+	if counts["car-001"] != 6 || counts["car-002"] != 3 {
+		t.Errorf("counts = %v, want 6:3", counts)
+	}
+}
+
+func TestDispatchToGroupWithoutActiveMembers(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	srv.SetGroup("pool", "car-001")
+
+	if _, err := srv.DispatchToGroup("pool", &protocol.ControlCommand{Action: protocol.ActionResume}); !errors.Is(err, ErrNoActiveMember) {
+		t.Errorf("err = %v, want ErrNoActiveMember", err)
+	}
+	if _, err := srv.DispatchToGroup("missing", &protocol.ControlCommand{}); err == nil {
+		t.Error("expected an error for an unknown group")
+	}
+	if len(mc.published) != 0 {
+		t.Errorf("published %d commands, want 0", len(mc.published))
+	}
+}
+
+func TestDispatchToGroupSkipsOfflineAndQuietMembers(t *testing.T) {
+	srv := New(Config{ClientID: "cc", ActiveWindow: 10 * time.Second})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+	srv.now = clock
+	srv.Shadows().SetClock(clock)
+	reportStates(srv, "car-001", "car-002", "car-003")
+	srv.SetGroup("pool", "car-001", "car-002", "car-003")
+
+	srv.Shadows().SetOnline("car-001", false)
+	now = now.Add(5 * time.Second)
+	reportStates(srv, "car-003")
+	now = now.Add(7 * time.Second) // car-002 last reported 12s ago
+
+	for i := 0; i < 3; i++ {
+		id, err := srv.DispatchToGroup("pool", &protocol.ControlCommand{Action: protocol.ActionResume})
+		if err != nil || id != "car-003" {
+			t.Fatalf("dispatched to %q (%v), want only car-003", id, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package controlcenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/daohu527/vlink/pkg/api"
+	"github.com/daohu527/vlink/pkg/fleetpb"
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+	"github.com/daohu527/vlink/pkg/vlinkpb"
+)
+
+// alertStreamBuffer is the number of alerts buffered per SubscribeAlerts
+// stream.
+const alertStreamBuffer = 64
+
+// grpcService implements the ControlCenter gRPC service over a Server.
+type grpcService struct {
+	api.UnimplementedControlCenterServer
+	s *Server
+}
+
+// GRPCService returns the server's implementation of the ControlCenter gRPC
+// service (see package api), for mounting on a grpc.Server of the caller's
+// own, e.g. one with TLS credentials. Config.GRPCAddr serves it without
+// further setup.
+func (s *Server) GRPCService() api.ControlCenterServer {
+	return grpcService{s: s}
+}
+
+// GRPCAddr returns the address the gRPC API is listening on, or nil when
+// Config.GRPCAddr is empty or Connect has not been called.
+func (s *Server) GRPCAddr() net.Addr {
+	if s.rpcLn == nil {
+		return nil
+	}
+	return s.rpcLn.Addr()
+}
+
+// serveGRPC listens on addr and serves the gRPC API in the background
+// until stopGRPC.
+func (s *Server) serveGRPC(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("control-center: grpc listen on %s: %w", addr, err)
+	}
+	rpc := grpc.NewServer()
+	api.RegisterControlCenterServer(rpc, s.GRPCService())
+	s.rpc, s.rpcLn = rpc, ln
+	go func() {
+		if err := rpc.Serve(ln); err != nil {
+			s.log.Error("grpc server", "err", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) stopGRPC() {
+	if s.rpc != nil {
+		s.rpc.Stop()
+		s.rpc, s.rpcLn = nil, nil
+	}
+}
+
+func (g grpcService) GetVehicle(_ context.Context, req *api.GetVehicleRequest) (*fleetpb.ShadowEntry, error) {
+	e, ok := g.s.shadows.Get(req.GetVehicleId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "vehicle %q not found", req.GetVehicleId())
+	}
+	return fleetpb.FromEntry(e), nil
+}
+
+func (g grpcService) ListActive(_ context.Context, req *api.ListActiveRequest) (*api.ListActiveResponse, error) {
+	maxAge := defaultActiveMaxAge
+	switch ms := req.GetMaxAgeMs(); {
+	case ms < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "negative max_age_ms %d", ms)
+	case ms > 0:
+		maxAge = time.Duration(ms) * time.Millisecond
+	}
+	ids := g.s.shadows.ActiveVehicles(maxAge)
+	sort.Strings(ids)
+	return &api.ListActiveResponse{VehicleIds: ids}, nil
+}
+
+// SendControl sends cmd with SendControlAndWait, bounded by the call's
+// deadline as well as the action's ack timeout.
+func (g grpcService) SendControl(ctx context.Context, req *vlinkpb.ControlCommand) (*vlinkpb.CommandAck, error) {
+	cmd := protocol.CommandFromProto(req)
+	if cmd.VehicleID == "" || cmd.Action == "" {
+		return nil, status.Error(codes.InvalidArgument, "vehicle_id and action are required")
+	}
+	ack, err := g.s.SendControlAndWait(ctx, cmd)
+	switch {
+	case err == nil:
+		return protocol.AckToProto(ack), nil
+	case errors.Is(err, ErrCommandTimeout):
+		return nil, status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, ErrDryRun):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case ctx.Err() != nil:
+		return nil, status.FromContextError(ctx.Err()).Err()
+	default:
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+}
+
+// SubscribeAlerts streams accepted alerts until the client goes away. A
+// client too slow to keep up misses alerts rather than stalling delivery to
+// other listeners.
+func (g grpcService) SubscribeAlerts(req *api.SubscribeAlertsRequest, stream grpc.ServerStreamingServer[vlinkpb.TeleoperationAlert]) error {
+	var ids map[string]bool // nil matches every vehicle
+	for _, id := range req.GetVehicleIds() {
+		if ids == nil {
+			ids = make(map[string]bool)
+		}
+		ids[shadow.CanonicalID(id)] = true
+	}
+	alerts := make(chan *protocol.TeleoperationAlert, alertStreamBuffer)
+	sub := g.s.alerter.RegisterFiltered(func(a *protocol.TeleoperationAlert) bool {
+		return a.Severity >= req.GetMinSeverity() && (ids == nil || ids[shadow.CanonicalID(a.VehicleID)])
+	}, func(a *protocol.TeleoperationAlert) {
+		select {
+		case alerts <- a:
+		default:
+		}
+	})
+	defer sub.Remove()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case a := <-alerts:
+			if err := stream.Send(protocol.AlertToProto(a)); err != nil {
+				return err
+			}
+		}
+	}
+}
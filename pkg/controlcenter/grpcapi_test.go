@@ -0,0 +1,166 @@
+package controlcenter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/daohu527/vlink/pkg/api"
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/vlinkpb"
+)
+
+// dialGRPC serves srv's gRPC API on a loopback port and returns a client
+// for it.
+func dialGRPC(t *testing.T, srv *Server) api.ControlCenterClient {
+	t.Helper()
+	if err := srv.serveGRPC("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.stopGRPC)
+	conn, err := grpc.NewClient(srv.GRPCAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return api.NewControlCenterClient(conn)
+}
+
+func TestGRPCGetVehicle(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli(), Speed: 7})
+	client := dialGRPC(t, srv)
+	ctx := context.Background()
+
+	e, err := client.GetVehicle(ctx, &api.GetVehicleRequest{VehicleId: "car-001"})
+	if err != nil {
+		t.Fatalf("GetVehicle: %v", err)
+	}
+	if e.State == nil || e.State.VehicleId != "car-001" || e.State.Speed != 7 || e.Version != 1 {
+		t.Errorf("entry = %+v, want car-001 at version 1", e)
+	}
+
+	_, err = client.GetVehicle(ctx, &api.GetVehicleRequest{VehicleId: "car-404"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetVehicle(car-404) error = %v, want NotFound", err)
+	}
+}
+
+func TestGRPCListActive(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	now := time.Now().UnixMilli()
+	for _, id := range []string{"car-002", "car-001", "car-003"} {
+		srv.Shadows().Update(&protocol.VehicleState{VehicleID: id, Timestamp: now})
+	}
+	srv.Shadows().MarkStale("car-003")
+	client := dialGRPC(t, srv)
+
+	resp, err := client.ListActive(context.Background(), &api.ListActiveRequest{})
+	if err != nil {
+		t.Fatalf("ListActive: %v", err)
+	}
+	if len(resp.VehicleIds) != 2 || resp.VehicleIds[0] != "car-001" || resp.VehicleIds[1] != "car-002" {
+		t.Errorf("active = %v, want [car-001 car-002]", resp.VehicleIds)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	resp, err = client.ListActive(context.Background(), &api.ListActiveRequest{MaxAgeMs: 10})
+	if err != nil {
+		t.Fatalf("ListActive: %v", err)
+	}
+	if len(resp.VehicleIds) != 0 {
+		t.Errorf("active within 10ms = %v, want none", resp.VehicleIds)
+	}
+
+	_, err = client.ListActive(context.Background(), &api.ListActiveRequest{MaxAgeMs: -1})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListActive(-1) error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestGRPCSendControlReturnsAck(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	client := dialGRPC(t, srv)
+
+	// Answer the command once the server tracks it.
+	go func() {
+		for srv.acks.Len() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		for _, st := range []string{protocol.AckAccepted, protocol.AckCompleted} {
+			data, _ := protocol.Marshal(&protocol.CommandAck{CommandID: "cmd-1", VehicleID: "car-001", Status: st})
+			mc.handlers[protocol.WildcardAckTopic()](mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: data})
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ack, err := client.SendControl(ctx, &vlinkpb.ControlCommand{CommandId: "cmd-1", VehicleId: "car-001", Action: "stop"})
+	if err != nil {
+		t.Fatalf("SendControl: %v", err)
+	}
+	if ack.CommandId != "cmd-1" || ack.VehicleId != "car-001" || ack.Status != protocol.AckCompleted {
+		t.Errorf("ack = %+v, want completed for cmd-1", ack)
+	}
+
+	_, err = client.SendControl(ctx, &vlinkpb.ControlCommand{Action: "stop"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SendControl without vehicle error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestGRPCSendControlDeadline(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	srv.ConnectWithClient(newMockClient())
+	client := dialGRPC(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.SendControl(ctx, &vlinkpb.ControlCommand{VehicleId: "car-001", Action: "stop"})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("SendControl error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestGRPCSubscribeAlerts(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	client := dialGRPC(t, srv)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SubscribeAlerts(ctx, &api.SubscribeAlertsRequest{VehicleIds: []string{"car-001"}, MinSeverity: 2})
+	if err != nil {
+		t.Fatalf("SubscribeAlerts: %v", err)
+	}
+
+	// The subscription is registered asynchronously, so keep raising the
+	// matching alert until one arrives; the others must never get through.
+	got := make(chan *vlinkpb.TeleoperationAlert, 1)
+	go func() {
+		a, err := stream.Recv()
+		if err != nil {
+			t.Errorf("Recv: %v", err)
+		}
+		got <- a
+	}()
+	for {
+		srv.Alerter().Handle(&protocol.TeleoperationAlert{AlertID: "low", VehicleID: "car-001", Severity: 1})
+		srv.Alerter().Handle(&protocol.TeleoperationAlert{AlertID: "other", VehicleID: "car-002", Severity: 3})
+		srv.Alerter().Handle(&protocol.TeleoperationAlert{AlertID: "match", VehicleID: "car-001", Severity: 3, Reason: "obstacle"})
+		select {
+		case a := <-got:
+			if a == nil || a.AlertId != "match" || a.Reason != "obstacle" {
+				t.Errorf("alert = %+v, want match", a)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
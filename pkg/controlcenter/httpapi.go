@@ -0,0 +1,194 @@
+package controlcenter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// defaultActiveMaxAge is the max_age of GET /vehicles/active when the query
+// parameter is absent.
+const defaultActiveMaxAge = 60 * time.Second
+
+// HTTPServer serves a read-only JSON query API over a shadow.Manager:
+//
+//	GET /vehicles                     sorted vehicle IDs
+//	GET /vehicles/active?max_age=60s  IDs of vehicles active within max_age
+//	GET /vehicles/{id}                the vehicle's state and shadow metadata
+//	GET /snapshot                     every vehicle as NDJSON, one
+//	                                  VehicleResponse per line, sorted by ID
+//
+// Hierarchical IDs are given unescaped ("/vehicles/region-a/car-001"), so a
+// vehicle named "active" cannot be queried by ID. Requests only take the
+// shadow's read lock briefly and encode immutable entries outside it, so they
+// never hold up the MQTT handlers writing to the shadow.
+type HTTPServer struct {
+	shadows *shadow.Manager
+	mux     *http.ServeMux
+	srv     *http.Server
+	ln      net.Listener
+	log     logging.Logger
+}
+
+// VehicleResponse is the body of GET /vehicles/{id}.
+type VehicleResponse struct {
+	State     *protocol.VehicleState `json:"state"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	Version   uint64                 `json:"version"`
+	Stale     bool                   `json:"stale"`
+	Online    bool                   `json:"online"`
+	Paused    bool                   `json:"paused,omitempty"`
+	Liveness  string                 `json:"liveness"`
+	// DistanceTraveled is the vehicle's odometer in metres (see
+	// shadow.Entry.DistanceTraveled); zero without Config.HistorySize.
+	DistanceTraveled float64 `json:"distance_traveled"`
+	// ReceivedAt, SkewMillis and ClockSkewed report the vehicle's clock
+	// skew (see shadow.Entry.Skew); SkewMillis is negative when the
+	// vehicle's clock runs ahead.
+	ReceivedAt  time.Time `json:"received_at"`
+	SkewMillis  int64     `json:"skew_ms"`
+	ClockSkewed bool      `json:"clock_skewed"`
+}
+
+// NewHTTPServer returns an HTTPServer reading from shadows. It is an
+// http.Handler in its own right; Start additionally listens on an address.
+func NewHTTPServer(shadows *shadow.Manager) *HTTPServer {
+	h := &HTTPServer{shadows: shadows, mux: http.NewServeMux(), log: logging.Default()}
+	h.mux.HandleFunc("GET /vehicles", h.listVehicles)
+	h.mux.HandleFunc("GET /vehicles/active", h.activeVehicles)
+	h.mux.HandleFunc("GET /vehicles/{id...}", h.getVehicle)
+	h.mux.HandleFunc("GET /snapshot", h.snapshot)
+	return h
+}
+
+// Handle mounts an additional handler, e.g. Server.EventsHandler, next to
+// the query API.
+func (h *HTTPServer) Handle(pattern string, handler http.Handler) {
+	h.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP implements http.Handler.
+func (h *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// SetLogger replaces the logger serving errors are reported to
+// (logging.Default unless set). Call it before Start.
+func (h *HTTPServer) SetLogger(l logging.Logger) {
+	h.log = logging.OrDefault(l)
+}
+
+// Start listens on addr and serves in the background until Close.
+func (h *HTTPServer) Start(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("control-center: http listen on %s: %w", addr, err)
+	}
+	h.ln = ln
+	h.srv = &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := h.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			h.log.Error("http server", "err", err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address Start is listening on, or nil before Start.
+func (h *HTTPServer) Addr() net.Addr {
+	if h.ln == nil {
+		return nil
+	}
+	return h.ln.Addr()
+}
+
+// Close stops a started server, closing its listener and connections.
+func (h *HTTPServer) Close() error {
+	if h.srv == nil {
+		return nil
+	}
+	return h.srv.Close()
+}
+
+func (h *HTTPServer) listVehicles(w http.ResponseWriter, _ *http.Request) {
+	all := h.shadows.All()
+	ids := make([]string, 0, len(all))
+	for _, e := range all {
+		ids = append(ids, e.State.VehicleID)
+	}
+	sort.Strings(ids)
+	writeJSON(w, ids)
+}
+
+func (h *HTTPServer) activeVehicles(w http.ResponseWriter, r *http.Request) {
+	maxAge := defaultActiveMaxAge
+	if v := r.URL.Query().Get("max_age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("bad max_age %q", v), http.StatusBadRequest)
+			return
+		}
+		maxAge = d
+	}
+	ids := h.shadows.ActiveVehicles(maxAge)
+	sort.Strings(ids)
+	writeJSON(w, ids)
+}
+
+func (h *HTTPServer) getVehicle(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	e, ok := h.shadows.Get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("vehicle %q not found", id), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, responseOf(e))
+}
+
+// snapshot streams the whole shadow as NDJSON, e.g. for DiffCenters.
+func (h *HTTPServer) snapshot(w http.ResponseWriter, _ *http.Request) {
+	all := h.shadows.All()
+	ids := make([]string, 0, len(all))
+	for id := range all {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, id := range ids {
+		if err := enc.Encode(responseOf(all[id])); err != nil {
+			return
+		}
+	}
+}
+
+func responseOf(e *shadow.Entry) VehicleResponse {
+	return VehicleResponse{
+		State:     e.State,
+		UpdatedAt: e.UpdatedAt,
+		Version:   e.Version,
+		Stale:     e.Stale,
+		Online:    e.Online,
+		Paused:    e.Paused,
+		Liveness:  e.Liveness.String(),
+
+		DistanceTraveled: e.DistanceTraveled(),
+		ReceivedAt:       e.ReceivedAt,
+		SkewMillis:       e.Skew.Milliseconds(),
+		ClockSkewed:      e.ClockSkewed,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,128 @@
+package controlcenter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+func newTestHTTPServer(t *testing.T) (*HTTPServer, *shadow.Manager) {
+	t.Helper()
+	m := shadow.NewManager()
+	m.Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: 1, Latitude: 40, Longitude: 116, Speed: 3})
+	m.Update(&protocol.VehicleState{VehicleID: "region-a/car-001", Timestamp: 1, Latitude: 41})
+	m.Update(&protocol.VehicleState{VehicleID: "car-003", Timestamp: 1})
+	m.SetOnline("car-003", false)
+	return NewHTTPServer(m), m
+}
+
+func get(t *testing.T, h http.Handler, target string, v any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	if rec.Code == http.StatusOK && v != nil {
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s: %v", target, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestHTTPListVehicles(t *testing.T) {
+	h, _ := newTestHTTPServer(t)
+	var ids []string
+	if code := get(t, h, "/vehicles", &ids); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	want := []string{"car-002", "car-003", "region-a/car-001"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %q, want %q", ids, want)
+	}
+}
+
+func TestHTTPGetVehicle(t *testing.T) {
+	h, m := newTestHTTPServer(t)
+	var resp VehicleResponse
+	if code := get(t, h, "/vehicles/car-002", &resp); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	e, _ := m.Get("car-002")
+	if resp.State == nil || resp.State.VehicleID != "car-002" || resp.State.Speed != 3 || resp.State.Latitude != 40 {
+		t.Errorf("state = %+v", resp.State)
+	}
+	if !resp.UpdatedAt.Equal(e.UpdatedAt) || resp.Version != 1 || !resp.Online || resp.Liveness != "online" {
+		t.Errorf("metadata = %+v, want updated_at %v version 1 online", resp, e.UpdatedAt)
+	}
+
+	if code := get(t, h, "/vehicles/region-a/car-001", &resp); code != http.StatusOK || resp.State.Latitude != 41 {
+		t.Errorf("hierarchical ID: status %d, state %+v", code, resp.State)
+	}
+}
+
+func TestHTTPReportsClockSkew(t *testing.T) {
+	m := shadow.NewManager()
+	now := time.Unix(1_700_000_000, 0)
+	m.SetClock(func() time.Time { return now })
+	m.SetMaxClockSkew(5 * time.Second)
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now.Add(10 * time.Second).UnixMilli()})
+
+	var resp VehicleResponse
+	if code := get(t, NewHTTPServer(m), "/vehicles/car-001", &resp); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if !resp.ReceivedAt.Equal(now) || resp.SkewMillis != -10000 || !resp.ClockSkewed {
+		t.Errorf("received_at %v, skew_ms %d, clock_skewed %v; want %v, -10000, true", resp.ReceivedAt, resp.SkewMillis, resp.ClockSkewed, now)
+	}
+}
+
+func TestHTTPGetUnknownVehicle(t *testing.T) {
+	h, _ := newTestHTTPServer(t)
+	if code := get(t, h, "/vehicles/car-999", nil); code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", code)
+	}
+}
+
+func TestHTTPActiveVehicles(t *testing.T) {
+	h, _ := newTestHTTPServer(t)
+	var ids []string
+	if code := get(t, h, "/vehicles/active?max_age=60s", &ids); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	// car-003 is offline.
+	if want := []string{"car-002", "region-a/car-001"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("active = %q, want %q", ids, want)
+	}
+	if code := get(t, h, "/vehicles/active?max_age=soon", nil); code != http.StatusBadRequest {
+		t.Errorf("bad max_age status = %d, want 400", code)
+	}
+	if code := get(t, h, "/vehicles/active", &ids); code != http.StatusOK || len(ids) != 2 {
+		t.Errorf("default max_age: status %d, ids %q", code, ids)
+	}
+}
+
+func TestHTTPServerStartAndClose(t *testing.T) {
+	h, _ := newTestHTTPServer(t)
+	if err := h.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	resp, err := http.Get("http://" + h.Addr().String() + "/vehicles")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := http.Get("http://" + h.Addr().String() + "/vehicles"); err == nil {
+		t.Error("server still answering after Close")
+	}
+}
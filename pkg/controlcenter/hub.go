@@ -0,0 +1,46 @@
+package controlcenter
+
+import (
+	"sync"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// updateHub fans shadow updates out to streaming subscribers. Delivery never
+// blocks the shadow writer: a subscriber whose buffer is full misses updates.
+type updateHub struct {
+	mu     sync.Mutex
+	nextID int
+	subs   map[int]chan *protocol.VehicleState
+}
+
+func newUpdateHub() *updateHub {
+	return &updateHub{subs: make(map[int]chan *protocol.VehicleState)}
+}
+
+// subscribe returns a subscription ID and a channel buffering up to buf updates.
+func (h *updateHub) subscribe(buf int) (int, <-chan *protocol.VehicleState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	ch := make(chan *protocol.VehicleState, buf)
+	h.subs[h.nextID] = ch
+	return h.nextID, ch
+}
+
+func (h *updateHub) unsubscribe(id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, id)
+}
+
+func (h *updateHub) publish(_, next *protocol.VehicleState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range h.subs {
+		select {
+		case ch <- next:
+		default:
+		}
+	}
+}
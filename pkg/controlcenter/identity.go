@@ -0,0 +1,95 @@
+package controlcenter
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// ErrIdentityMismatch is returned, wrapped, by MatchIdentity for a message
+// whose vehicle ID is not its publisher's.
+var ErrIdentityMismatch = errors.New("control-center: vehicle identity mismatch")
+
+// Peer is what the control center knows about who published a message.
+//
+// The control center is itself an MQTT client, so it never sees a vehicle's
+// TLS handshake: the broker does. Binding vehicle IDs to certificates is
+// therefore primarily the broker's job, through ACLs that let a client
+// publish only under its own vehicle ID (e.g. Mosquitto's
+// use_identity_as_username with a "pattern write v1/vehicle/%u/#" ACL).
+// With such ACLs in place the topic's vehicle ID is authenticated, and the
+// control center's part is to check that the payload claims the same ID.
+// Where the publisher's certificate does reach the control center, e.g.
+// through a bridge or an in-process broker whose messages implement
+// PeerCertificateMessage, it is checked directly as well.
+type Peer struct {
+	// TopicVehicleID is the vehicle ID in the topic the message arrived on.
+	TopicVehicleID string
+	// Certificate is the publisher's client certificate, or nil when the
+	// message does not carry it.
+	Certificate *x509.Certificate
+}
+
+// PeerCertificateMessage is implemented by messages that carry their
+// publisher's TLS client certificate. Messages from paho do not.
+type PeerCertificateMessage interface {
+	PeerCertificate() *x509.Certificate
+}
+
+// IdentityPolicy decides whether a state or alert claiming vehicleID may
+// come from peer; an error rejects it. See Config.IdentityPolicy.
+type IdentityPolicy func(peer Peer, vehicleID string) error
+
+// MatchIdentity is the default IdentityPolicy. vehicleID must match the
+// topic's vehicle ID and, when the certificate is known, its common name or
+// one of its DNS names. IDs are compared after shadow.CanonicalID, as the
+// shadow keys them.
+func MatchIdentity(peer Peer, vehicleID string) error {
+	id := shadow.CanonicalID(vehicleID)
+	if peer.TopicVehicleID != "" && shadow.CanonicalID(peer.TopicVehicleID) != id {
+		return fmt.Errorf("%w: %q published on the topic of %q", ErrIdentityMismatch, vehicleID, peer.TopicVehicleID)
+	}
+	cert := peer.Certificate
+	if cert == nil {
+		return nil
+	}
+	if shadow.CanonicalID(cert.Subject.CommonName) == id {
+		return nil
+	}
+	for _, name := range cert.DNSNames {
+		if shadow.CanonicalID(name) == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q published with the certificate of %q", ErrIdentityMismatch, vehicleID, cert.Subject.CommonName)
+}
+
+// AllowAnyIdentity is an IdentityPolicy that accepts every message, for
+// deployments whose vehicles share a certificate and whose topics do not
+// carry the vehicle ID the payload does.
+func AllowAnyIdentity(Peer, string) error { return nil }
+
+// verifyIdentity applies Config.IdentityPolicy to a decoded state or alert
+// claiming vehicleID, logging and counting a rejection.
+func (s *Server) verifyIdentity(msg mqtt.Message, vehicleID string) bool {
+	policy := s.cfg.IdentityPolicy
+	if policy == nil {
+		policy = MatchIdentity
+	}
+	_, topicID, _, _ := protocol.ParseTopic(msg.Topic())
+	peer := Peer{TopicVehicleID: topicID}
+	if pm, ok := msg.(PeerCertificateMessage); ok {
+		peer.Certificate = pm.PeerCertificate()
+	}
+	if err := policy(peer, vehicleID); err != nil {
+		s.identityRejected.Add(1)
+		s.log.Warn("rejecting message", "topic", msg.Topic(), "err", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package controlcenter
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/membroker"
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/security/ca"
+)
+
+func TestMatchIdentity(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "car-001"},
+		DNSNames: []string{"car-001-alias"},
+	}
+	for _, tc := range []struct {
+		name      string
+		peer      Peer
+		vehicleID string
+		ok        bool
+	}{
+		{"topic matches", Peer{TopicVehicleID: "car-001"}, "car-001", true},
+		{"topic matches canonically", Peer{TopicVehicleID: "Car-001"}, "car-001 ", true},
+		{"topic mismatch", Peer{TopicVehicleID: "car-001"}, "car-002", false},
+		{"common name matches", Peer{TopicVehicleID: "car-001", Certificate: cert}, "car-001", true},
+		{"DNS name matches", Peer{TopicVehicleID: "car-001-alias", Certificate: cert}, "car-001-alias", true},
+		{"certificate mismatch", Peer{TopicVehicleID: "car-002", Certificate: cert}, "car-002", false},
+		{"certificate without topic", Peer{Certificate: cert}, "car-002", false},
+	} {
+		err := MatchIdentity(tc.peer, tc.vehicleID)
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrIdentityMismatch) {
+			t.Errorf("%s: err = %v, want ErrIdentityMismatch", tc.name, err)
+		}
+	}
+}
+
+func TestSpoofedVehicleIDRejected(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	srv := New(Config{ClientID: "cc"})
+	srv.now = func() time.Time { return now }
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	var alerts int
+	srv.Alerter().Register(func(*protocol.TeleoperationAlert) { alerts++ })
+
+	// car-001 publishes on its own topics but claims to be car-002.
+	state, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "car-002", Timestamp: now.UnixMilli()})
+	mc.handlers[protocol.WildcardStateTopic()](mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: state})
+	alert, _ := protocol.Marshal(&protocol.TeleoperationAlert{VehicleID: "car-002", Reason: "sensor_fault", Severity: 2, Timestamp: now.UnixMilli()})
+	mc.handlers[protocol.WildcardAlertTopic()](mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: alert})
+
+	if _, ok := srv.Shadows().Get("car-002"); ok {
+		t.Error("spoofed state reached the shadow")
+	}
+	if alerts != 0 {
+		t.Errorf("spoofed alert delivered %d times", alerts)
+	}
+	if n := srv.Metrics().IdentityRejected; n != 2 {
+		t.Errorf("IdentityRejected = %d, want 2", n)
+	}
+}
+
+func TestAllowAnyIdentityOptsOut(t *testing.T) {
+	srv := New(Config{ClientID: "cc", IdentityPolicy: AllowAnyIdentity})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	state, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "car-002", Timestamp: time.Now().UnixMilli()})
+	mc.handlers[protocol.WildcardStateTopic()](mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: state})
+	if _, ok := srv.Shadows().Get("car-002"); !ok {
+		t.Error("state dropped although identity checks are off")
+	}
+	if n := srv.Metrics().IdentityRejected; n != 0 {
+		t.Errorf("IdentityRejected = %d, want 0", n)
+	}
+}
+
+func TestIdentityCheckedAgainstPeerCertificate(t *testing.T) {
+	caCert, caKey, err := ca.GenerateCA("fleet-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(id string) *x509.Certificate {
+		cert, _, err := ca.SignLeaf(caCert, caKey, id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	b := membroker.New()
+	srv := New(Config{ClientID: "cc"})
+	srv.ConnectWithClient(b.Client("cc"))
+
+	publish := func(c *membroker.Client, id string) {
+		t.Helper()
+		state, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: id, Timestamp: time.Now().UnixMilli()})
+		if tok := c.Publish(protocol.StateTopic(id), 0, false, state); tok.Error() != nil {
+			t.Fatal(tok.Error())
+		}
+	}
+
+	honest := b.Client("car-001")
+	honest.SetPeerCertificate(issue("car-001"))
+	publish(honest, "car-001")
+	if _, ok := srv.Shadows().Get("car-001"); !ok {
+		t.Error("state matching its certificate was rejected")
+	}
+
+	// Without broker ACLs a vehicle can publish on another's topic; its
+	// certificate still gives it away.
+	spoofer := b.Client("car-003")
+	spoofer.SetPeerCertificate(issue("car-003"))
+	publish(spoofer, "car-002")
+	if _, ok := srv.Shadows().Get("car-002"); ok {
+		t.Error("state from another vehicle's certificate reached the shadow")
+	}
+	if n := srv.Metrics().IdentityRejected; n != 1 {
+		t.Errorf("IdentityRejected = %d, want 1", n)
+	}
+}
@@ -0,0 +1,64 @@
+package controlcenter
+
+import "sync"
+
+// defaultLossWindow is the number of sequence numbers evaluated per loss
+// calculation when Config.LinkLossWindow is unset.
+const defaultLossWindow = 100
+
+// DegradedLinkFunc is called when a vehicle's observed state loss rate over a
+// window exceeds Config.LinkLossThreshold. lossRate is in [0, 1].
+type DegradedLinkFunc func(vehicleID string, lossRate float64)
+
+// linkMonitor detects gaps in per-vehicle state sequence numbers.
+type linkMonitor struct {
+	mu        sync.Mutex
+	window    uint64
+	threshold float64
+	links     map[string]*linkStats
+}
+
+type linkStats struct {
+	lastSeq  uint64
+	expected uint64
+	received uint64
+}
+
+func newLinkMonitor(window int, threshold float64) *linkMonitor {
+	if window <= 0 {
+		window = defaultLossWindow
+	}
+	return &linkMonitor{
+		window:    uint64(window),
+		threshold: threshold,
+		links:     make(map[string]*linkStats),
+	}
+}
+
+// observe records seq for vehicleID. When a full window has been observed it
+// returns the loss rate and whether it exceeds the threshold. A sequence
+// number that does not advance (duplicate or sender restart) resets the
+// baseline without counting as loss.
+func (m *linkMonitor) observe(vehicleID string, seq uint64) (float64, bool) {
+	if seq == 0 {
+		return 0, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.links[vehicleID]
+	if !ok || seq <= st.lastSeq {
+		m.links[vehicleID] = &linkStats{lastSeq: seq}
+		return 0, false
+	}
+	st.expected += seq - st.lastSeq
+	st.received++
+	st.lastSeq = seq
+	if st.expected < m.window {
+		return 0, false
+	}
+
+	rate := float64(st.expected-st.received) / float64(st.expected)
+	st.expected, st.received = 0, 0
+	return rate, rate > m.threshold
+}
@@ -0,0 +1,60 @@
+package controlcenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestDegradedLinkReportsLoss(t *testing.T) {
+	srv := New(Config{ClientID: "cc", LinkLossWindow: 10})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	var rates []float64
+	srv.OnDegradedLink(func(vehicleID string, lossRate float64) {
+		if vehicleID != "car-001" {
+			t.Errorf("vehicleID = %q, want car-001", vehicleID)
+		}
+		rates = append(rates, lossRate)
+	})
+
+	handler := mc.handlers[protocol.WildcardStateTopic()]
+	now := time.Now().UnixMilli()
+	// Every other sequence number is lost in transit.
+	for seq := uint64(1); seq <= 11; seq += 2 {
+		state := &protocol.VehicleState{VehicleID: "car-001", Timestamp: now + int64(seq), Seq: seq}
+		data, _ := protocol.Marshal(state)
+		handler(mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: data})
+	}
+
+	if len(rates) != 1 {
+		t.Fatalf("OnDegradedLink called %d times, want 1", len(rates))
+	}
+	if rates[0] != 0.5 {
+		t.Errorf("lossRate = %v, want 0.5", rates[0])
+	}
+}
+
+func TestLinkMonitorNoLoss(t *testing.T) {
+	m := newLinkMonitor(5, 0)
+	for seq := uint64(1); seq <= 20; seq++ {
+		if rate, degraded := m.observe("car-001", seq); degraded {
+			t.Fatalf("seq %d reported degraded link with rate %v", seq, rate)
+		}
+	}
+}
+
+func TestLinkMonitorResetsOnRestart(t *testing.T) {
+	m := newLinkMonitor(5, 0)
+	for seq := uint64(1); seq <= 3; seq++ {
+		m.observe("car-001", seq)
+	}
+	// The vehicle restarted and numbering begins again.
+	for seq := uint64(1); seq <= 10; seq++ {
+		if _, degraded := m.observe("car-001", seq); degraded {
+			t.Fatalf("restart at seq %d reported as loss", seq)
+		}
+	}
+}
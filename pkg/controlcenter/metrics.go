@@ -0,0 +1,104 @@
+package controlcenter
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Metrics is a point-in-time view of the server's internal buffers.
+type Metrics struct {
+	// StateQueueDepth is the number of states enqueued but not yet applied
+	// to the shadow.
+	StateQueueDepth int `json:"state_queue_depth"`
+	// StateQueueDropped counts states evicted from the full state queue.
+	StateQueueDropped uint64 `json:"state_queue_dropped"`
+	// StateQueueShed counts states shed for exceeding Config.ShedLag.
+	StateQueueShed uint64 `json:"state_queue_shed"`
+	// BackfillPending is the number of replayed states awaiting
+	// rate-limited application (see Config.BackfillRate), BackfillApplied
+	// the number released so far and BackfillDropped the number evicted
+	// from the full queue.
+	BackfillPending int    `json:"backfill_pending"`
+	BackfillApplied uint64 `json:"backfill_applied"`
+	BackfillDropped uint64 `json:"backfill_dropped"`
+	// PendingAcks is the number of sent commands awaiting acknowledgement.
+	PendingAcks int `json:"pending_acks"`
+	// Vehicles is the number of shadow entries, and ClockSkewed the number
+	// of them flagged for clock skew (see Config.MaxClockSkew).
+	Vehicles    int `json:"vehicles"`
+	ClockSkewed int `json:"clock_skewed"`
+	// ShadowDropped counts states the shadow did not apply because they
+	// were stale, invalid or implausible; see ShadowDrops for a per-vehicle
+	// breakdown.
+	ShadowDropped uint64 `json:"shadow_dropped"`
+	// QuarantineDropped counts states and alerts suppressed because their
+	// vehicle was quarantined (see Server.Quarantine).
+	QuarantineDropped uint64 `json:"quarantine_dropped"`
+	// IdentityRejected counts states and alerts rejected by
+	// Config.IdentityPolicy.
+	IdentityRejected uint64 `json:"identity_rejected"`
+	// CertValiditySeconds is how long the TLS certificate remains valid,
+	// negative once it has expired; see Config.CertExpiryWarning. It is
+	// zero without TLS.
+	CertValiditySeconds float64 `json:"cert_validity_seconds,omitempty"`
+}
+
+// Metrics returns the current buffer gauges and counters.
+func (s *Server) Metrics() Metrics {
+	entries := s.shadows.All()
+	m := Metrics{
+		PendingAcks:       s.acks.Len(),
+		Vehicles:          len(entries),
+		QuarantineDropped: s.muted.Dropped(),
+		IdentityRejected:  s.identityRejected.Load(),
+	}
+	for _, e := range entries {
+		if e.ClockSkewed {
+			m.ClockSkewed++
+		}
+	}
+	if expiry := s.certExpiry.Load(); expiry != 0 {
+		m.CertValiditySeconds = time.Unix(0, expiry).Sub(s.now()).Seconds()
+	}
+	s.mu.RLock()
+	m.ShadowDropped = s.otherDrops
+	for _, n := range s.shadowDrops {
+		m.ShadowDropped += n
+	}
+	s.mu.RUnlock()
+	if s.queue != nil {
+		m.StateQueueDepth = s.queue.Len()
+		m.StateQueueDropped = s.queue.Dropped()
+		m.StateQueueShed = s.queue.Shed()
+	}
+	if s.backfill != nil {
+		m.BackfillPending = s.backfill.Len()
+		m.BackfillApplied = s.backfill.Applied()
+		m.BackfillDropped = s.backfill.Dropped()
+	}
+	return m
+}
+
+// ShadowDrops returns, per canonical vehicle ID, how many of its states the
+// shadow dropped as stale, invalid or implausible. Vehicles are forgotten
+// when removed from the shadow, and only the first 4096 to have states
+// dropped are broken down; Metrics.ShadowDropped counts them all.
+func (s *Server) ShadowDrops() map[string]uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	drops := make(map[string]uint64, len(s.shadowDrops))
+	for id, n := range s.shadowDrops {
+		drops[id] = n
+	}
+	return drops
+}
+
+// DebugHandler returns an http.Handler that serves Metrics as JSON, suitable
+// for mounting at /debug/vlink.
+func (s *Server) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.Metrics())
+	})
+}
@@ -0,0 +1,152 @@
+package controlcenter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/security"
+)
+
+func TestMetricsReflectUndrainedItems(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	// Attach a queue without a consumer so pushes stay enqueued.
+	srv.queue = newStateQueue(2, 0)
+	for i := 0; i < 3; i++ {
+		srv.queue.push(&protocol.VehicleState{VehicleID: "car-001", Timestamp: int64(i)})
+	}
+	if err := srv.SendControl(&protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "stop"}); err != nil {
+		t.Fatalf("SendControl: %v", err)
+	}
+
+	m := srv.Metrics()
+	want := Metrics{StateQueueDepth: 2, StateQueueDropped: 1, PendingAcks: 1}
+	if m != want {
+		t.Errorf("Metrics = %+v, want %+v", m, want)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vlink", nil))
+	var got Metrics
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode debug response: %v", err)
+	}
+	if got != want {
+		t.Errorf("debug handler = %+v, want %+v", got, want)
+	}
+}
+
+func TestShadowDropsCountedPerVehicle(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	handler := mc.handlers[protocol.WildcardStateTopic()]
+	for _, s := range []*protocol.VehicleState{
+		{VehicleID: "car-001", Timestamp: 2000},
+		{VehicleID: "car-001", Timestamp: 1000},                // stale
+		{VehicleID: "car-002", Timestamp: 1000, Latitude: 120}, // invalid
+	} {
+		data, _ := protocol.Marshal(s)
+		handler(mc, &mockMessage{topic: protocol.StateTopic(s.VehicleID), payload: data})
+	}
+
+	drops := srv.ShadowDrops()
+	if drops["car-001"] != 1 || drops["car-002"] != 1 {
+		t.Errorf("ShadowDrops = %v, want one per vehicle", drops)
+	}
+	if m := srv.Metrics(); m.ShadowDropped != 2 {
+		t.Errorf("Metrics.ShadowDropped = %d, want 2", m.ShadowDropped)
+	}
+}
+
+func TestShadowDropsAreBoundedAndPruned(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "Car-001", Timestamp: 2000})
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000})
+	for i := range maxDropVehicles + 10 {
+		srv.countDrop(fmt.Sprintf("bogus-%d", i))
+	}
+	if n := len(srv.ShadowDrops()); n != maxDropVehicles {
+		t.Errorf("ShadowDrops tracks %d vehicles, want %d", n, maxDropVehicles)
+	}
+	if got := srv.ShadowDrops()["car-001"]; got != 1 {
+		t.Errorf("car-001 drops = %d, want 1", got)
+	}
+
+	srv.Shadows().Remove("car-001")
+	if _, ok := srv.ShadowDrops()["car-001"]; ok {
+		t.Error("drops of a removed vehicle are still tracked")
+	}
+	if m := srv.Metrics(); m.ShadowDropped != maxDropVehicles+11 {
+		t.Errorf("Metrics.ShadowDropped = %d, want every drop counted", m.ShadowDropped)
+	}
+}
+
+func TestMetricsCountClockSkewedVehicles(t *testing.T) {
+	srv := New(Config{ClientID: "cc", StateQueueSize: 8, MaxClockSkew: time.Second})
+	defer srv.Disconnect()
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	handler := mc.handlers[protocol.WildcardStateTopic()]
+	now := time.Now()
+	for _, s := range []*protocol.VehicleState{
+		{VehicleID: "car-001", Timestamp: now.Add(time.Minute).UnixMilli()},
+		{VehicleID: "car-002", Timestamp: now.UnixMilli()},
+	} {
+		data, _ := protocol.Marshal(s)
+		handler(mc, &mockMessage{topic: protocol.StateTopic(s.VehicleID), payload: data})
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for srv.Metrics().Vehicles < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("queued states never reached the shadow")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if m := srv.Metrics(); m.ClockSkewed != 1 {
+		t.Errorf("Metrics.ClockSkewed = %d, want 1", m.ClockSkewed)
+	}
+	if e, _ := srv.Shadows().Get("car-001"); e.Skew >= 0 || !e.ClockSkewed {
+		t.Errorf("car-001 skew = %v, flagged %v; want negative, flagged", e.Skew, e.ClockSkewed)
+	}
+}
+
+func TestMetricsReportCertValidity(t *testing.T) {
+	if got := New(Config{ClientID: "cc"}).Metrics().CertValiditySeconds; got != 0 {
+		t.Errorf("CertValiditySeconds without TLS = %v, want 0", got)
+	}
+
+	certFile, keyFile, caFile := writeTestCerts(t)
+	expiry, err := security.CertExpiry(certFile)
+	if err != nil {
+		t.Fatalf("CertExpiry: %v", err)
+	}
+	srv := New(Config{
+		BrokerURL: "tls://broker:8883",
+		ClientID:  "cc",
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		CAFile:    caFile,
+	})
+	now := expiry.Add(-10 * time.Minute)
+	srv.now = func() time.Time { return now }
+	if _, err := srv.clientOptions(); err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	if got := srv.Metrics().CertValiditySeconds; got != 600 {
+		t.Errorf("CertValiditySeconds = %v, want 600", got)
+	}
+	now = expiry.Add(time.Minute)
+	if got := srv.Metrics().CertValiditySeconds; got != -60 {
+		t.Errorf("CertValiditySeconds after expiry = %v, want -60", got)
+	}
+}
@@ -0,0 +1,86 @@
+package controlcenter
+
+import (
+	"hash/fnv"
+	"slices"
+	"sync"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// recentPerVehicle bounds how many messages of each kind the server
+// remembers per vehicle to recognise one dual-published under another
+// prefix.
+const recentPerVehicle = 16
+
+// migration tracks vehicles across the topic prefixes of
+// Config.TopicPrefixes, so that an agent dual-publishing during a
+// migration is handled once and sent each command once.
+type migration struct {
+	mu     sync.Mutex
+	recent map[string][]sighting // by kind and canonical vehicle ID
+	homes  map[string]string     // canonical vehicle ID -> prefix
+}
+
+// sighting is a message received under prefix, identified by its payload.
+type sighting struct {
+	sum    uint64
+	prefix string
+}
+
+func newMigration() *migration {
+	return &migration{recent: make(map[string][]sighting), homes: make(map[string]string)}
+}
+
+// duplicate reports whether payload, received under prefix, is a copy of a
+// message of the same kind from the same vehicle received under another
+// prefix, recording it otherwise. Each copy matches its original once, so
+// a vehicle repeating itself later, e.g. going online again, is not
+// mistaken for a duplicate.
+func (m *migration) duplicate(prefix, vehicleID, kind string, payload []byte) bool {
+	h := fnv.New64a()
+	h.Write(payload)
+	sum := h.Sum64()
+	key := kind + "/" + shadow.CanonicalID(vehicleID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := m.recent[key]
+	for i, s := range seen {
+		if s.sum == sum && s.prefix != prefix {
+			m.recent[key] = slices.Delete(seen, i, i+1)
+			return true
+		}
+	}
+	if len(seen) == recentPerVehicle {
+		seen = slices.Delete(seen, 0, 1)
+	}
+	m.recent[key] = append(seen, sighting{sum, prefix})
+	return false
+}
+
+// setHome records prefix as the one vehicleID's agent subscribes under. An
+// agent publishes its status under its first prefix only, which is also
+// where it takes commands.
+func (m *migration) setHome(vehicleID, prefix string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.homes[shadow.CanonicalID(vehicleID)] = prefix
+}
+
+// vehicleTopics returns the topics to publish to vehicleID under: those of
+// the prefix its agent subscribes under once its status has been seen,
+// every configured prefix until then.
+func (s *Server) vehicleTopics(vehicleID string) []protocol.Topics {
+	if len(s.topics) == 1 {
+		return s.topics
+	}
+	s.migrate.mu.Lock()
+	home, ok := s.migrate.homes[shadow.CanonicalID(vehicleID)]
+	s.migrate.mu.Unlock()
+	if !ok {
+		return s.topics
+	}
+	return []protocol.Topics{{Prefix: home}}
+}
@@ -0,0 +1,98 @@
+package controlcenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/membroker"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestStatesOnBothPrefixesShareOneShadow(t *testing.T) {
+	b := membroker.New()
+	srv := New(Config{ClientID: "cc", TopicPrefixes: []string{"v1/vehicle", "v2/vehicle"}})
+	srv.ConnectWithClient(b.Client("cc"))
+
+	v1 := protocol.Topics{Prefix: "v1/vehicle"}
+	v2 := protocol.Topics{Prefix: "v2/vehicle"}
+	car := b.Client("car-001")
+	now := time.Now().UnixMilli()
+
+	publish := func(topic string, ts int64) {
+		data, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "car-001", Timestamp: ts})
+		car.Publish(topic, 0, false, data)
+	}
+	publish(v1.State("car-001"), now)
+	publish(v2.State("car-001"), now+100)
+
+	all := srv.Shadows().All()
+	if len(all) != 1 {
+		t.Fatalf("len(All) = %d, want 1", len(all))
+	}
+	entry := all["car-001"]
+	if entry == nil || entry.State.Timestamp != now+100 {
+		t.Fatalf("shadow = %+v, want the v2 state at %d", entry, now+100)
+	}
+	if entry.Version != 2 {
+		t.Errorf("Version = %d, want 2 (one update per prefix)", entry.Version)
+	}
+
+	if err := srv.SendControl(&protocol.ControlCommand{VehicleID: "car-001", Action: protocol.ActionStop}); err != nil {
+		t.Fatalf("SendControl: %v", err)
+	}
+	var controls []string
+	for _, m := range b.Messages() {
+		if _, _, kind, _ := protocol.ParseTopic(m.Topic); kind == protocol.KindControl {
+			controls = append(controls, m.Topic)
+		}
+	}
+	if len(controls) != 2 || controls[0] != v1.Control("car-001") || controls[1] != v2.Control("car-001") {
+		t.Errorf("control published to %v, want both prefixes", controls)
+	}
+}
+
+func TestDualPublishedMessagesHandledOnce(t *testing.T) {
+	b := membroker.New()
+	srv := New(Config{ClientID: "cc", TopicPrefixes: []string{"v1/vehicle", "v2/vehicle"}})
+	srv.ConnectWithClient(b.Client("cc"))
+	var acks int
+	srv.OnAck(func(*protocol.CommandAck, time.Duration) { acks++ })
+
+	v1 := protocol.Topics{Prefix: "v1/vehicle"}
+	v2 := protocol.Topics{Prefix: "v2/vehicle"}
+	car := b.Client("car-001")
+	// The agent lists v2 first: it reports its status and takes commands
+	// there, and dual-publishes everything else.
+	car.Publish(v2.Status("car-001"), 1, true, []byte(protocol.StatusOnline))
+	state, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli()})
+	for _, topics := range []protocol.Topics{v2, v1} {
+		car.Publish(topics.State("car-001"), 0, false, state)
+	}
+	if e, _ := srv.Shadows().Get("car-001"); e == nil || e.Version != 1 {
+		t.Fatalf("shadow = %+v, want one update", e)
+	}
+
+	cmd := &protocol.ControlCommand{VehicleID: "car-001", CommandID: "cmd-1", Action: protocol.ActionStop}
+	if err := srv.SendControl(cmd); err != nil {
+		t.Fatal(err)
+	}
+	var controls []string
+	for _, m := range b.Messages() {
+		if _, _, kind, _ := protocol.ParseTopic(m.Topic); kind == protocol.KindControl {
+			controls = append(controls, m.Topic)
+		}
+	}
+	if len(controls) != 1 || controls[0] != v2.Control("car-001") {
+		t.Errorf("control published to %v, want %s only", controls, v2.Control("car-001"))
+	}
+
+	for _, status := range []string{protocol.AckAccepted, protocol.AckCompleted} {
+		ack, _ := protocol.Marshal(&protocol.CommandAck{VehicleID: "car-001", CommandID: "cmd-1", Status: status})
+		for _, topics := range []protocol.Topics{v2, v1} {
+			car.Publish(topics.Ack("car-001"), 1, false, ack)
+		}
+	}
+	if acks != 2 {
+		t.Errorf("OnAck fired %d times, want once per status", acks)
+	}
+}
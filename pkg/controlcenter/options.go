@@ -0,0 +1,71 @@
+package controlcenter
+
+import "go.opentelemetry.io/otel/trace"
+
+// Option configures a Server built with NewWithOptions.
+type Option func(*Config)
+
+// NewWithOptions creates a Server from functional options. It is equivalent
+// to calling New with a Config populated by opts.
+func NewWithOptions(opts ...Option) *Server {
+	var cfg Config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return New(cfg)
+}
+
+// WithBroker sets the MQTT broker URL.
+func WithBroker(url string) Option {
+	return func(c *Config) { c.BrokerURL = url }
+}
+
+// WithClientID sets the MQTT client ID.
+func WithClientID(id string) Option {
+	return func(c *Config) { c.ClientID = id }
+}
+
+// WithTLS enables mutual TLS using the given certificate, key and CA files.
+func WithTLS(certFile, keyFile, caFile string) Option {
+	return func(c *Config) {
+		c.CertFile = certFile
+		c.KeyFile = keyFile
+		c.CAFile = caFile
+	}
+}
+
+// WithTLSPEM enables mutual TLS using in-memory PEM instead of files (see
+// Config.CertPEM).
+func WithTLSPEM(certPEM, keyPEM, caPEM []byte) Option {
+	return func(c *Config) {
+		c.CertPEM = certPEM
+		c.KeyPEM = keyPEM
+		c.CAPEM = caPEM
+	}
+}
+
+// WithStateQueueSize bounds the inbound state queue (see Config.StateQueueSize).
+func WithStateQueueSize(n int) Option {
+	return func(c *Config) { c.StateQueueSize = n }
+}
+
+// WithLinkLoss configures state loss detection (see Config.LinkLossWindow and
+// Config.LinkLossThreshold).
+func WithLinkLoss(window int, threshold float64) Option {
+	return func(c *Config) {
+		c.LinkLossWindow = window
+		c.LinkLossThreshold = threshold
+	}
+}
+
+// WithTopicPrefixes sets the topic namespaces to serve (see
+// Config.TopicPrefixes).
+func WithTopicPrefixes(prefixes ...string) Option {
+	return func(c *Config) { c.TopicPrefixes = prefixes }
+}
+
+// WithTracerProvider traces every command sent with a CommandID on a tracer
+// from tp (see Config.TracerProvider).
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Config) { c.TracerProvider = tp }
+}
@@ -0,0 +1,45 @@
+package controlcenter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewWithOptionsBuildsConfig(t *testing.T) {
+	srv := NewWithOptions(
+		WithBroker("tls://broker:8883"),
+		WithClientID("cc-01"),
+		WithTLS("cert.pem", "key.pem", "ca.pem"),
+		WithTLSPEM([]byte("cert"), []byte("key"), []byte("ca")),
+		WithLinkLoss(50, 0.1),
+	)
+	defer srv.Disconnect()
+
+	want := Config{
+		BrokerURL:         "tls://broker:8883",
+		ClientID:          "cc-01",
+		CertFile:          "cert.pem",
+		KeyFile:           "key.pem",
+		CAFile:            "ca.pem",
+		CertPEM:           []byte("cert"),
+		KeyPEM:            []byte("key"),
+		CAPEM:             []byte("ca"),
+		LinkLossWindow:    50,
+		LinkLossThreshold: 0.1,
+	}
+	if !reflect.DeepEqual(srv.cfg, want) {
+		t.Errorf("cfg = %+v, want %+v", srv.cfg, want)
+	}
+}
+
+func TestWithStateQueueSizeStartsQueue(t *testing.T) {
+	srv := NewWithOptions(WithStateQueueSize(16))
+	defer srv.Disconnect()
+
+	if srv.cfg.StateQueueSize != 16 {
+		t.Errorf("StateQueueSize = %d, want 16", srv.cfg.StateQueueSize)
+	}
+	if srv.queue == nil {
+		t.Error("state queue not created")
+	}
+}
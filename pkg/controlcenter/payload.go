@@ -0,0 +1,75 @@
+package controlcenter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// defaultMaxPayloadSize bounds decompressed payloads when
+// Config.MaxPayloadSize is not set.
+const defaultMaxPayloadSize = 1 << 20 // 1 MiB
+
+// decodePayload transparently decompresses gzip payloads (magic 0x1f 0x8b)
+// and, when allowZlib is set, ones with a zlib deflate header; anything
+// else is returned unchanged. Decompression stops with an error once more
+// than limit bytes are produced, so a small compressed message cannot
+// exhaust memory.
+func decodePayload(data []byte, limit int, allowZlib bool) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case allowZlib && isZlib(data):
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, fmt.Errorf("decompressed payload exceeds %d bytes", limit)
+	}
+	return out, nil
+}
+
+// isZlib reports whether data starts with a valid zlib header (RFC 1950):
+// deflate compression method and a header checksum divisible by 31. One
+// payload in 31 whose first byte has the deflate nibble passes by chance,
+// which is why the check is opt-in.
+func isZlib(data []byte) bool {
+	return len(data) >= 2 && data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0
+}
+
+// decode decompresses a payload if needed and unmarshals it into v.
+func (s *Server) decode(payload []byte, v any) error {
+	limit := s.cfg.MaxPayloadSize
+	if limit <= 0 {
+		limit = defaultMaxPayloadSize
+	}
+	data, err := decodePayload(payload, limit, s.cfg.ZlibPayloads)
+	if err != nil {
+		return err
+	}
+	return s.codec().Unmarshal(data, v)
+}
+
+// codec returns the configured wire codec.
+func (s *Server) codec() protocol.Codec {
+	if s.cfg.Codec == nil {
+		return protocol.JSONCodec{}
+	}
+	return s.cfg.Codec
+}
@@ -0,0 +1,108 @@
+package controlcenter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestServerDecodesGzippedState(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	state := protocol.NewVehicleState("car-001")
+	state.Speed = 12.5
+	data, _ := protocol.Marshal(state)
+
+	handler := mc.handlers[protocol.WildcardStateTopic()]
+	handler(mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: gzipBytes(t, data)})
+
+	entry, ok := srv.Shadows().Get("car-001")
+	if !ok {
+		t.Fatal("shadow not updated from gzipped payload")
+	}
+	if entry.State.Speed != 12.5 {
+		t.Errorf("speed = %v, want 12.5", entry.State.Speed)
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	plain := []byte(`{"vehicle_id":"car-001"}`)
+
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write(plain)
+	zw.Close()
+
+	for name, in := range map[string][]byte{
+		"plain": plain,
+		"gzip":  gzipBytes(t, plain),
+		"zlib":  zbuf.Bytes(),
+	} {
+		got, err := decodePayload(in, 1024, true)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%s: decoded %q, want %q", name, got, plain)
+		}
+	}
+	if got, _ := decodePayload(zbuf.Bytes(), 1024, false); !bytes.Equal(got, zbuf.Bytes()) {
+		t.Error("zlib payload expanded without allowZlib")
+	}
+}
+
+func TestServerLeavesZlibLikeProtobufState(t *testing.T) {
+	srv := New(Config{ClientID: "cc", Codec: protocol.ProtobufCodec{}})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	state := protocol.NewVehicleState("car-001")
+	state.Speed = 12.5
+	data, err := protocol.ProtobufCodec{}.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Field 11 (emergency) as varint 9 encodes to 0x58 0x09, a valid zlib
+	// header; protobuf accepts fields in any order.
+	data = append([]byte{0x58, 0x09}, data...)
+	if !isZlib(data) {
+		t.Fatal("test payload does not start with a zlib header")
+	}
+
+	handler := mc.handlers[protocol.WildcardStateTopic()]
+	handler(mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: data})
+
+	entry, ok := srv.Shadows().Get("car-001")
+	if !ok {
+		t.Fatal("protobuf state starting with a zlib header was not applied")
+	}
+	if entry.State.Speed != 12.5 || !entry.State.Emergency {
+		t.Errorf("state = %+v, want speed 12.5 and emergency", entry.State)
+	}
+}
+
+func TestDecodePayloadRejectsBomb(t *testing.T) {
+	bomb := gzipBytes(t, bytes.Repeat([]byte{' '}, 1<<16))
+	if _, err := decodePayload(bomb, 1024, false); err == nil {
+		t.Error("expected error for payload exceeding the decompressed size limit")
+	}
+}
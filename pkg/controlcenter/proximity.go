@@ -0,0 +1,61 @@
+package controlcenter
+
+import (
+	"fmt"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// ReasonProximity is the Reason of alerts raised by CheckProximity.
+const ReasonProximity = "proximity_warning"
+
+// proximitySeverity is the severity of proximity alerts.
+const proximitySeverity = 2
+
+// CheckProximity finds vehicles within Config.ProximityThreshold metres of
+// each other and returns the close pairs. When a pair first comes close, a
+// ReasonProximity alert is raised through the Alerter for each of its two
+// vehicles; the pair is alerted again only after it has separated. It
+// returns nil when ProximityThreshold is not set. Call it periodically, e.g.
+// once a second.
+func (s *Server) CheckProximity() [][2]string {
+	if s.cfg.ProximityThreshold <= 0 {
+		return nil
+	}
+	pairs := s.shadows.ProximityPairs(s.cfg.ProximityThreshold)
+
+	s.mu.Lock()
+	current := make(map[[2]string]bool, len(pairs))
+	var fresh [][2]string
+	for _, p := range pairs {
+		current[p] = true
+		if !s.nearPairs[p] {
+			fresh = append(fresh, p)
+		}
+	}
+	s.nearPairs = current
+	s.mu.Unlock()
+
+	for _, p := range fresh {
+		s.raiseProximity(p[0], p[1])
+		s.raiseProximity(p[1], p[0])
+	}
+	return pairs
+}
+
+// raiseProximity alerts operators that vehicleID is close to other.
+func (s *Server) raiseProximity(vehicleID, other string) {
+	e, ok := s.shadows.Get(vehicleID)
+	if !ok {
+		return
+	}
+	s.alerter.Handle(&protocol.TeleoperationAlert{
+		AlertID:   protocol.NewID(),
+		VehicleID: vehicleID,
+		Timestamp: s.now().UnixMilli(),
+		Reason:    fmt.Sprintf("%s: within %.0f m of %s", ReasonProximity, s.cfg.ProximityThreshold, other),
+		Latitude:  e.State.Latitude,
+		Longitude: e.State.Longitude,
+		Severity:  proximitySeverity,
+	})
+}
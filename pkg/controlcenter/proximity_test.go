@@ -0,0 +1,50 @@
+package controlcenter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestCheckProximityAlertsClosePairsOnce(t *testing.T) {
+	srv := New(Config{ClientID: "cc", ProximityThreshold: 30})
+	now := time.Now().UnixMilli()
+	place := func(id string, lat, lon float64) {
+		srv.Shadows().Update(&protocol.VehicleState{VehicleID: id, Timestamp: now, Latitude: lat, Longitude: lon})
+		now++
+	}
+	place("car-001", 39.90000, 116.40000)
+	place("car-002", 39.90010, 116.40010) // ~14 m: close pair
+	place("car-003", 39.95000, 116.40000)
+	place("car-004", 39.96000, 116.40000) // ~1.1 km from car-003: distant pair
+
+	var alerted []string
+	srv.Alerter().Register(func(a *protocol.TeleoperationAlert) {
+		if strings.HasPrefix(a.Reason, ReasonProximity) {
+			alerted = append(alerted, a.VehicleID)
+		}
+	})
+
+	pairs := srv.CheckProximity()
+	if len(pairs) != 1 || pairs[0] != [2]string{"car-001", "car-002"} {
+		t.Fatalf("pairs = %v, want [[car-001 car-002]]", pairs)
+	}
+	if len(alerted) != 2 || alerted[0] != "car-001" || alerted[1] != "car-002" {
+		t.Errorf("alerted = %v, want both vehicles of the close pair", alerted)
+	}
+
+	srv.CheckProximity()
+	if len(alerted) != 2 {
+		t.Errorf("alerted again for a pair that stayed close: %v", alerted)
+	}
+
+	place("car-002", 39.91000, 116.40000) // separate
+	srv.CheckProximity()
+	place("car-002", 39.90010, 116.40010) // and close in again
+	srv.CheckProximity()
+	if len(alerted) != 4 {
+		t.Errorf("alerted = %v, want a new alert after the pair re-approached", alerted)
+	}
+}
@@ -0,0 +1,95 @@
+package controlcenter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// quarantines holds the vehicles muted by Quarantine and their deadlines.
+type quarantines struct {
+	mu      sync.Mutex
+	until   map[string]time.Time // canonical ID -> deadline
+	dropped uint64
+	log     logging.Logger
+}
+
+func newQuarantines(log logging.Logger) *quarantines {
+	return &quarantines{until: make(map[string]time.Time), log: log}
+}
+
+// suppress reports whether a message from vehicleID should be dropped
+// because the vehicle is quarantined at now, counting it if so. An expired
+// quarantine is lifted.
+func (q *quarantines) suppress(vehicleID string, now time.Time) bool {
+	id := shadow.CanonicalID(vehicleID)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	until, ok := q.until[id]
+	if !ok {
+		return false
+	}
+	if !now.Before(until) {
+		delete(q.until, id)
+		q.log.Info("quarantine expired", "vehicle_id", vehicleID)
+		return false
+	}
+	q.dropped++
+	return true
+}
+
+// Dropped returns how many messages quarantines have suppressed.
+func (q *quarantines) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Quarantine mutes vehicleID until the given time without disconnecting it,
+// e.g. while it floods bad data or alerts: its states are dropped before
+// they reach the shadow, so no shadow listener or subscriber sees them, and
+// its alerts are suppressed. Acks and status messages still flow, so
+// commands sent to the vehicle meanwhile are tracked as usual. The
+// quarantine lifts by itself at the deadline, or earlier through
+// Unquarantine; quarantining an already muted vehicle moves its deadline.
+// IDs are matched after shadow.CanonicalID, like shadow lookups.
+func (s *Server) Quarantine(vehicleID string, until time.Time) {
+	q := s.muted
+	q.mu.Lock()
+	q.until[shadow.CanonicalID(vehicleID)] = until
+	q.mu.Unlock()
+	s.log.Warn("vehicle quarantined", "vehicle_id", vehicleID, "until", until.Format(time.RFC3339))
+}
+
+// Unquarantine lifts a quarantine early. It reports whether vehicleID was
+// quarantined.
+func (s *Server) Unquarantine(vehicleID string) bool {
+	q := s.muted
+	id := shadow.CanonicalID(vehicleID)
+	q.mu.Lock()
+	_, ok := q.until[id]
+	delete(q.until, id)
+	q.mu.Unlock()
+	if ok {
+		s.log.Info("quarantine lifted", "vehicle_id", vehicleID)
+	}
+	return ok
+}
+
+// Quarantined returns the deadline of every active quarantine keyed by
+// canonical vehicle ID.
+func (s *Server) Quarantined() map[string]time.Time {
+	q := s.muted
+	now := s.now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	active := make(map[string]time.Time, len(q.until))
+	for id, until := range q.until {
+		if now.Before(until) {
+			active[id] = until
+		}
+	}
+	return active
+}
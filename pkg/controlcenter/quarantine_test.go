@@ -0,0 +1,121 @@
+package controlcenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestQuarantineMutesStatesAndAlertsUntilDeadline(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	srv := New(Config{ClientID: "cc"})
+	srv.now = func() time.Time { return now }
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	var updates, alerts int
+	srv.Shadows().OnUpdate(func(_, next *protocol.VehicleState) {
+		if next.VehicleID == "car-001" {
+			updates++
+		}
+	})
+	srv.Alerter().Register(func(*protocol.TeleoperationAlert) { alerts++ })
+
+	ts := now.UnixMilli()
+	send := func() {
+		ts++
+		state, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "car-001", Timestamp: ts})
+		mc.handlers[protocol.WildcardStateTopic()](mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: state})
+		alert, _ := protocol.Marshal(&protocol.TeleoperationAlert{VehicleID: "car-001", Reason: "sensor_fault", Severity: 2, Timestamp: ts})
+		mc.handlers[protocol.WildcardAlertTopic()](mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: alert})
+	}
+
+	srv.Quarantine("car-001", now.Add(time.Minute))
+	send()
+	send()
+	if updates != 0 || alerts != 0 {
+		t.Fatalf("quarantined vehicle reached listeners: %d updates, %d alerts", updates, alerts)
+	}
+	if _, ok := srv.Shadows().Get("car-001"); ok {
+		t.Error("quarantined state reached the shadow")
+	}
+	if n := srv.Metrics().QuarantineDropped; n != 4 {
+		t.Errorf("QuarantineDropped = %d, want 4", n)
+	}
+	if q := srv.Quarantined(); !q["car-001"].Equal(now.Add(time.Minute)) {
+		t.Errorf("Quarantined = %v", q)
+	}
+
+	now = now.Add(time.Minute)
+	send()
+	if updates != 1 || alerts != 1 {
+		t.Errorf("after the deadline: %d updates, %d alerts, want 1 each", updates, alerts)
+	}
+	if q := srv.Quarantined(); len(q) != 0 {
+		t.Errorf("Quarantined after expiry = %v, want none", q)
+	}
+}
+
+func TestUnquarantineLiftsEarly(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	srv.Quarantine("car-001", time.Now().Add(time.Hour))
+	if !srv.Unquarantine("car-001") {
+		t.Fatal("Unquarantine reported no quarantine")
+	}
+	if srv.Unquarantine("car-001") {
+		t.Error("second Unquarantine reported a quarantine")
+	}
+
+	state, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli()})
+	mc.handlers[protocol.WildcardStateTopic()](mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: state})
+	if _, ok := srv.Shadows().Get("car-001"); !ok {
+		t.Error("state dropped after Unquarantine")
+	}
+}
+
+func TestQuarantineLeavesOtherVehiclesAndAcks(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	srv.Quarantine("car-001", time.Now().Add(time.Hour))
+
+	state, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "car-002", Timestamp: time.Now().UnixMilli()})
+	mc.handlers[protocol.WildcardStateTopic()](mc, &mockMessage{topic: protocol.StateTopic("car-002"), payload: state})
+	if _, ok := srv.Shadows().Get("car-002"); !ok {
+		t.Error("another vehicle's state was dropped")
+	}
+
+	acks := make(chan *protocol.CommandAck, 1)
+	srv.OnAck(func(ack *protocol.CommandAck, _ time.Duration) { acks <- ack })
+	if err := srv.SendControl(&protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: protocol.ActionStop}); err != nil {
+		t.Fatal(err)
+	}
+	ack, _ := protocol.Marshal(&protocol.CommandAck{CommandID: "cmd-1", VehicleID: "car-001", Status: protocol.AckAccepted})
+	mc.handlers[protocol.WildcardAckTopic()](mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: ack})
+	select {
+	case <-acks:
+	default:
+		t.Error("ack from a quarantined vehicle was dropped")
+	}
+}
+
+func TestQuarantineMatchesCanonicalID(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	// Quarantine by the key the shadow lists the vehicle under.
+	srv.Quarantine("car-007", time.Now().Add(time.Minute))
+	state, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "Car-007", Timestamp: time.Now().UnixMilli()})
+	mc.handlers[protocol.WildcardStateTopic()](mc, &mockMessage{topic: protocol.StateTopic("Car-007"), payload: state})
+	if _, ok := srv.Shadows().Get("Car-007"); ok {
+		t.Error("state from a quarantined mixed-case vehicle reached the shadow")
+	}
+	if !srv.Unquarantine("CAR-007") {
+		t.Error("Unquarantine did not match the quarantine")
+	}
+}
@@ -0,0 +1,170 @@
+package controlcenter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// defaultShedQueueSize is the state queue size used when Config.ShedLag is
+// set without a StateQueueSize.
+const defaultShedQueueSize = 1024
+
+// stateQueue is a bounded FIFO that decouples the MQTT callback goroutine
+// from the shadow updater. When the queue is full a pending state is
+// discarded so that push never blocks. With a maxLag, states that waited
+// longer than it are shed unapplied, letting a lagging updater catch up.
+// Load is shed per vehicle: a state is discarded in favour of a newer one
+// of the same vehicle still queued, so every vehicle keeps its latest
+// state. Only a queue full of distinct vehicles evicts one outright.
+type stateQueue struct {
+	mu      sync.Mutex
+	buf     []queuedState
+	head    int
+	n       int
+	pending map[string]int // canonical vehicle ID -> states queued
+	dropped uint64
+	shed    uint64
+	maxLag  time.Duration
+
+	notify   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// queuedState is a state with the time it was enqueued, which is also when
+// the server received it.
+type queuedState struct {
+	state *protocol.VehicleState
+	key   string // canonical vehicle ID
+	at    time.Time
+}
+
+func newStateQueue(size int, maxLag time.Duration) *stateQueue {
+	return &stateQueue{
+		maxLag:  maxLag,
+		buf:     make([]queuedState, size),
+		pending: make(map[string]int),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// push enqueues state. If the queue is full it evicts the oldest state
+// superseded by a newer one of the same vehicle, or else the oldest state.
+func (q *stateQueue) push(state *protocol.VehicleState) {
+	q.mu.Lock()
+	if q.n == len(q.buf) {
+		q.evict()
+		q.dropped++
+	}
+	key := shadow.CanonicalID(state.VehicleID)
+	q.buf[(q.head+q.n)%len(q.buf)] = queuedState{state: state, key: key, at: time.Now()}
+	q.n++
+	q.pending[key]++
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// evict removes one state from the full queue: the oldest one superseded
+// by a newer state of the same vehicle, or the oldest if every vehicle has
+// a single state queued. The caller must hold q.mu.
+func (q *stateQueue) evict() {
+	at := 0
+	if q.n > len(q.pending) { // some vehicle has more than one state queued
+		for i := 0; i < q.n; i++ {
+			if q.pending[q.buf[(q.head+i)%len(q.buf)].key] > 1 {
+				at = i
+				break
+			}
+		}
+	}
+	// Close the gap by moving the states ahead of it up one slot.
+	victim := q.buf[(q.head+at)%len(q.buf)]
+	for i := at; i > 0; i-- {
+		q.buf[(q.head+i)%len(q.buf)] = q.buf[(q.head+i-1)%len(q.buf)]
+	}
+	q.removeHead(victim.key)
+}
+
+// removeHead clears the oldest slot, which held a state of vehicle key, and
+// advances past it. The caller must hold q.mu.
+func (q *stateQueue) removeHead(key string) {
+	q.buf[q.head] = queuedState{}
+	q.head = (q.head + 1) % len(q.buf)
+	q.n--
+	if q.pending[key]--; q.pending[key] == 0 {
+		delete(q.pending, key)
+	}
+}
+
+// pop removes and returns the oldest queued state with the time it was
+// enqueued. A state that waited longer than maxLag is shed if a newer state
+// of its vehicle is queued behind it; a vehicle's latest state is always
+// applied.
+func (q *stateQueue) pop() (*protocol.VehicleState, time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.n > 0 {
+		e := q.buf[q.head]
+		superseded := q.pending[e.key] > 1
+		q.removeHead(e.key)
+		if q.maxLag > 0 && superseded && time.Since(e.at) > q.maxLag {
+			q.shed++
+			continue
+		}
+		return e.state, e.at, true
+	}
+	return nil, time.Time{}, false
+}
+
+// Len returns the number of states waiting to be applied.
+func (q *stateQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+// Dropped returns how many states were evicted because the queue was full.
+func (q *stateQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Shed returns how many superseded states were discarded for exceeding
+// maxLag.
+func (q *stateQueue) Shed() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.shed
+}
+
+// run drains the queue into apply, with the time each state was enqueued,
+// until stop is called.
+func (q *stateQueue) run(apply func(*protocol.VehicleState, time.Time)) {
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.notify:
+			for {
+				s, at, ok := q.pop()
+				if !ok {
+					break
+				}
+				apply(s, at)
+			}
+		}
+	}
+}
+
+func (q *stateQueue) stop() {
+	q.stopOnce.Do(func() { close(q.done) })
+}
@@ -0,0 +1,150 @@
+package controlcenter
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestStateQueueDropsOldestWithoutBlocking(t *testing.T) {
+	q := newStateQueue(4, 0)
+
+	done := make(chan struct{})
+	go func() {
+		// No consumer is running, so every push beyond capacity must evict.
+		for i := 0; i < 10; i++ {
+			q.push(&protocol.VehicleState{VehicleID: "car-001", Timestamp: int64(i)})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("push blocked on a full queue")
+	}
+
+	if got := q.Dropped(); got != 6 {
+		t.Errorf("Dropped = %d, want 6", got)
+	}
+	if got := q.Len(); got != 4 {
+		t.Fatalf("Len = %d, want 4", got)
+	}
+	for want := int64(6); want < 10; want++ {
+		s, _, ok := q.pop()
+		if !ok {
+			t.Fatalf("pop returned empty queue, want timestamp %d", want)
+		}
+		if s.Timestamp != want {
+			t.Errorf("Timestamp = %d, want %d", s.Timestamp, want)
+		}
+	}
+}
+
+func TestServerStateQueueAppliesUpdates(t *testing.T) {
+	srv := New(Config{ClientID: "cc", StateQueueSize: 8})
+	defer srv.Disconnect()
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	state := &protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli()}
+	data, _ := protocol.Marshal(state)
+	mc.handlers[protocol.WildcardStateTopic()](mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: data})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := srv.Shadows().Get("car-001"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("queued state never reached the shadow")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := srv.DroppedStates(); got != 0 {
+		t.Errorf("DroppedStates = %d, want 0", got)
+	}
+}
+
+func TestShedLagDropsStatesButKeepsAlerts(t *testing.T) {
+	srv := New(Config{ClientID: "cc", ShedLag: 20 * time.Millisecond})
+	defer srv.Disconnect()
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	// A slow shadow consumer: every applied state takes 10ms.
+	var applied atomic.Int32
+	srv.Shadows().OnUpdate(func(_, _ *protocol.VehicleState) {
+		applied.Add(1)
+		time.Sleep(10 * time.Millisecond)
+	})
+	var alerts atomic.Int32
+	srv.Alerter().Register(func(*protocol.TeleoperationAlert) { alerts.Add(1) })
+
+	route := mc.handlers[protocol.WildcardStateTopic()]
+	const vehicles, rounds = 4, 10
+	now := time.Now().UnixMilli()
+	for r := 0; r < rounds; r++ {
+		for v := 0; v < vehicles; v++ {
+			id := fmt.Sprintf("car-%03d", v)
+			data, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: id, Timestamp: now + int64(r)})
+			route(mc, &mockMessage{topic: protocol.StateTopic(id), payload: data})
+		}
+		if r%3 == 0 {
+			id := fmt.Sprintf("alert-%d", r)
+			alert, _ := protocol.Marshal(&protocol.TeleoperationAlert{AlertID: id, VehicleID: "car-000", Severity: 2})
+			route(mc, &mockMessage{topic: protocol.AlertTopic("car-000"), payload: alert})
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.queue.Len() > 0 || int(applied.Load())+int(srv.ShedStates()) < vehicles*rounds {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue not drained: applied %d, shed %d", applied.Load(), srv.ShedStates())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if srv.ShedStates() == 0 {
+		t.Error("no states shed despite the consumer lagging")
+	}
+	for v := 0; v < vehicles; v++ {
+		id := fmt.Sprintf("car-%03d", v)
+		if e, ok := srv.Shadows().Get(id); !ok || e.State.Timestamp != now+rounds-1 {
+			t.Errorf("%s shadow = %+v, want its latest state applied", id, e)
+		}
+	}
+	if n := alerts.Load(); n != 4 {
+		t.Errorf("alerts delivered = %d, want all 4", n)
+	}
+	if m := srv.Metrics(); m.StateQueueShed != srv.ShedStates() {
+		t.Errorf("Metrics.StateQueueShed = %d, want %d", m.StateQueueShed, srv.ShedStates())
+	}
+}
+
+func TestStateQueueKeepsEachVehiclesLatest(t *testing.T) {
+	q := newStateQueue(3, 0)
+	q.push(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1})
+	q.push(&protocol.VehicleState{VehicleID: "car-002", Timestamp: 1})
+	q.push(&protocol.VehicleState{VehicleID: "CAR-002", Timestamp: 2})
+	// Full: car-002's superseded state makes room, not car-001's only one.
+	q.push(&protocol.VehicleState{VehicleID: "car-003", Timestamp: 1})
+
+	var got []string
+	for {
+		s, _, ok := q.pop()
+		if !ok {
+			break
+		}
+		got = append(got, fmt.Sprintf("%s@%d", s.VehicleID, s.Timestamp))
+	}
+	if want := "[car-001@1 CAR-002@2 car-003@1]"; fmt.Sprint(got) != want {
+		t.Errorf("queue held %v, want %s", got, want)
+	}
+	if q.Dropped() != 1 || len(q.pending) != 0 {
+		t.Errorf("Dropped = %d, pending = %v; want 1 and none", q.Dropped(), q.pending)
+	}
+}
@@ -0,0 +1,145 @@
+package controlcenter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// stateRequests routes state responses to the RequestState call awaiting them.
+type stateRequests struct {
+	mu      sync.Mutex
+	waiters map[string]chan *protocol.VehicleState
+}
+
+func newStateRequests() *stateRequests {
+	return &stateRequests{waiters: make(map[string]chan *protocol.VehicleState)}
+}
+
+func (r *stateRequests) add(requestID string) chan *protocol.VehicleState {
+	ch := make(chan *protocol.VehicleState, 1)
+	r.mu.Lock()
+	r.waiters[requestID] = ch
+	r.mu.Unlock()
+	return ch
+}
+
+func (r *stateRequests) remove(requestID string) {
+	r.mu.Lock()
+	delete(r.waiters, requestID)
+	r.mu.Unlock()
+}
+
+// resolve delivers state to its waiter, if one is still registered.
+func (r *stateRequests) resolve(state *protocol.VehicleState) {
+	r.mu.Lock()
+	ch, ok := r.waiters[state.RequestID]
+	delete(r.waiters, state.RequestID)
+	r.mu.Unlock()
+	if ok {
+		ch <- state
+	}
+}
+
+// RequestState asks vehicleID to publish a fresh state and waits for it
+// until ctx is done. The response also updates the shadow as usual.
+func (s *Server) RequestState(ctx context.Context, vehicleID string) (*protocol.VehicleState, error) {
+	id := newCommandID()
+	ch := s.requests.add(id)
+	defer s.requests.remove(id)
+
+	cmd := &protocol.ControlCommand{
+		CommandID: id,
+		VehicleID: vehicleID,
+		Action:    protocol.ActionRequestState,
+	}
+	if err := s.SendControl(cmd); err != nil {
+		return nil, fmt.Errorf("control-center: request state from %s: %w", vehicleID, err)
+	}
+
+	select {
+	case state := <-ch:
+		return state, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("control-center: request state from %s: %w", vehicleID, ctx.Err())
+	}
+}
+
+// RequestAllStates requests a fresh state from every active vehicle in the
+// shadow, i.e. one online, not stale and heard from within the offline
+// threshold of Config.Liveness, and collects the responses keyed by vehicle
+// ID. Vehicles already presumed gone are skipped rather than waited on and
+// reported missing, so the shadow's history of departed vehicles does not
+// fill the error. Active vehicles that do not answer within timeout (or
+// before ctx is done) are missing from the map, and the returned error names
+// them; the partial map is returned either way.
+func (s *Server) RequestAllStates(ctx context.Context, timeout time.Duration) (map[string]*protocol.VehicleState, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		states  = make(map[string]*protocol.VehicleState)
+		missing []string
+	)
+	for _, id := range s.shadows.ActiveVehicles(s.livenessWindow()) {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			state, err := s.RequestState(ctx, id)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				missing = append(missing, id)
+				return
+			}
+			states[id] = state
+		}(id)
+	}
+	wg.Wait()
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return states, fmt.Errorf("control-center: no state from %d vehicle(s): %s", len(missing), strings.Join(missing, ", "))
+	}
+	return states, nil
+}
+
+// RefreshVehicle forces a refresh of vehicleID's shadow, e.g. when an
+// operator knows the displayed position is wrong. The entry is marked stale,
+// a fresh state is requested, and the entry updated from the response is
+// returned. If the vehicle does not answer before ctx is done the entry stays
+// stale and an error is returned.
+func (s *Server) RefreshVehicle(ctx context.Context, vehicleID string) (*shadow.Entry, error) {
+	s.shadows.MarkStale(vehicleID)
+	if _, err := s.RequestState(ctx, vehicleID); err != nil {
+		return nil, err
+	}
+	entry, ok := s.shadows.Get(vehicleID)
+	if !ok || entry.Stale {
+		// The response was dropped, e.g. as older than the stored state.
+		return nil, fmt.Errorf("control-center: refresh %s: shadow not updated", vehicleID)
+	}
+	return entry, nil
+}
+
+// livenessWindow is how long a vehicle may stay silent before its shadow
+// goes offline under Config.Liveness, unbounded when that grade is disabled.
+func (s *Server) livenessWindow() time.Duration {
+	t := s.cfg.Liveness
+	if t == (shadow.LivenessThresholds{}) {
+		t = shadow.DefaultLivenessThresholds
+	}
+	if t.Offline <= 0 {
+		return math.MaxInt64
+	}
+	return t.Offline
+}
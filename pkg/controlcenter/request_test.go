@@ -0,0 +1,149 @@
+package controlcenter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/membroker"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// fakeVehicle answers request_state commands on the in-memory broker.
+func fakeVehicle(b *membroker.Broker, id string, lat float64) {
+	c := b.Client(id)
+	c.Subscribe(protocol.ControlTopic(id), 1, func(_ mqtt.Client, m mqtt.Message) {
+		var cmd protocol.ControlCommand
+		if err := protocol.Unmarshal(m.Payload(), &cmd); err != nil || cmd.Action != protocol.ActionRequestState {
+			return
+		}
+		data, _ := protocol.Marshal(&protocol.VehicleState{
+			VehicleID: id,
+			Timestamp: time.Now().UnixMilli(),
+			Latitude:  lat,
+			RequestID: cmd.CommandID,
+		})
+		c.Publish(protocol.StateTopic(id), 0, false, data)
+	})
+}
+
+func TestRequestAllStatesReturnsPartialResults(t *testing.T) {
+	b := membroker.New()
+	srv := New(Config{ClientID: "cc"})
+	srv.ConnectWithClient(b.Client("cc"))
+
+	old := time.Now().Add(-time.Minute).UnixMilli()
+	for _, id := range []string{"car-001", "car-002", "car-003"} {
+		srv.Shadows().Update(&protocol.VehicleState{VehicleID: id, Timestamp: old})
+	}
+	fakeVehicle(b, "car-001", 39.9)
+	fakeVehicle(b, "car-002", 40.1)
+	// car-003 is offline and never answers.
+
+	states, err := srv.RequestAllStates(context.Background(), 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "car-003") {
+		t.Errorf("error = %v, want one naming car-003", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("len(states) = %d, want 2", len(states))
+	}
+	if states["car-001"].Latitude != 39.9 || states["car-002"].Latitude != 40.1 {
+		t.Errorf("states = %+v", states)
+	}
+
+	entry, _ := srv.Shadows().Get("car-001")
+	if entry.State.Timestamp == old {
+		t.Error("response did not refresh the shadow")
+	}
+	if n := len(srv.requests.waiters); n != 0 {
+		t.Errorf("%d request waiters leaked", n)
+	}
+}
+
+func TestRequestAllStatesSkipsOfflineVehicles(t *testing.T) {
+	b := membroker.New()
+	srv := New(Config{ClientID: "cc"})
+	srv.ConnectWithClient(b.Client("cc"))
+
+	now := time.Now()
+	srv.Shadows().SetClock(func() time.Time { return now.Add(-2 * time.Minute) })
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-gone", Timestamp: now.Add(-2 * time.Minute).UnixMilli()})
+	srv.Shadows().SetClock(nil)
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now.UnixMilli()})
+	fakeVehicle(b, "car-001", 39.9)
+
+	states, err := srv.RequestAllStates(context.Background(), 50*time.Millisecond)
+	if err != nil {
+		t.Errorf("error = %v, want the offline vehicle skipped", err)
+	}
+	if len(states) != 1 || states["car-001"] == nil {
+		t.Errorf("states = %+v, want car-001 only", states)
+	}
+}
+
+func TestRefreshVehicleMarksStaleThenUpdates(t *testing.T) {
+	for _, cfg := range []Config{
+		{ClientID: "cc"},
+		{ClientID: "cc", StateQueueSize: 8},
+		{ClientID: "cc", ShedLag: time.Second},
+	} {
+		testRefreshVehicle(t, cfg)
+	}
+}
+
+func testRefreshVehicle(t *testing.T, cfg Config) {
+	t.Helper()
+	b := membroker.New()
+	srv := New(cfg)
+	srv.ConnectWithClient(b.Client("cc"))
+
+	old := time.Now().Add(-time.Minute).UnixMilli()
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: old, Latitude: 1})
+
+	var staleWhileRequested bool
+	c := b.Client("car-001")
+	c.Subscribe(protocol.ControlTopic("car-001"), 1, func(_ mqtt.Client, m mqtt.Message) {
+		var cmd protocol.ControlCommand
+		protocol.Unmarshal(m.Payload(), &cmd)
+		if e, ok := srv.Shadows().Get("car-001"); ok {
+			staleWhileRequested = e.Stale
+		}
+		data, _ := protocol.Marshal(&protocol.VehicleState{
+			VehicleID: "car-001",
+			Timestamp: time.Now().UnixMilli(),
+			Latitude:  39.9,
+			RequestID: cmd.CommandID,
+		})
+		c.Publish(protocol.StateTopic("car-001"), 0, false, data)
+	})
+
+	entry, err := srv.RefreshVehicle(context.Background(), "car-001")
+	if err != nil {
+		t.Fatalf("RefreshVehicle: %v", err)
+	}
+	if !staleWhileRequested {
+		t.Error("entry was not marked stale while the refresh was pending")
+	}
+	if entry.Stale || entry.State.Latitude != 39.9 {
+		t.Errorf("entry = %+v, want fresh state at 39.9", entry)
+	}
+}
+
+func TestRefreshVehicleLeavesEntryStaleOnTimeout(t *testing.T) {
+	b := membroker.New()
+	srv := New(Config{ClientID: "cc"})
+	srv.ConnectWithClient(b.Client("cc"))
+	srv.Shadows().Update(protocol.NewVehicleState("car-001"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := srv.RefreshVehicle(ctx, "car-001"); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if e, _ := srv.Shadows().Get("car-001"); !e.Stale {
+		t.Error("entry should stay stale when the vehicle does not answer")
+	}
+}
@@ -5,16 +5,31 @@
 package controlcenter
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 
+	"github.com/daohu527/vlink/pkg/backoff"
+	"github.com/daohu527/vlink/pkg/logging"
 	"github.com/daohu527/vlink/pkg/protocol"
 	"github.com/daohu527/vlink/pkg/security"
 	"github.com/daohu527/vlink/pkg/shadow"
 	"github.com/daohu527/vlink/pkg/teleoperation"
+	"github.com/daohu527/vlink/pkg/tracing"
 )
 
 // Config holds the control-center configuration.
@@ -27,23 +42,364 @@ type Config struct {
 	CertFile string
 	KeyFile  string
 	CAFile   string
+	// CertPEM, KeyPEM and CAPEM hold the same mTLS material in memory, e.g.
+	// from a mounted secret, as an alternative to the files. When all three
+	// are set they take precedence over CertFile, KeyFile and CAFile.
+	CertPEM []byte
+	KeyPEM  []byte
+	CAPEM   []byte
+	// ControlQoS is the MQTT QoS level commands are published at, and
+	// StateQoS and AlertQoS the levels the server subscribes to states and
+	// alerts with; the broker delivers each message at the lower of the
+	// publisher's and the subscriber's level. Nil keeps the default, QoS 1;
+	// set them with protocol.QoS. Connect rejects levels above 2.
+	ControlQoS *byte
+	StateQoS   *byte
+	AlertQoS   *byte
+	// CertExpiryWarning is how close to its expiry the certificate in
+	// CertFile may be before Connect and ReloadTLS log a warning. Zero means
+	// security.DefaultExpiryWarning (30 days). Metrics reports the remaining
+	// validity either way.
+	CertExpiryWarning time.Duration
+	// CRLFile, when set with TLS, is a certificate revocation list signed
+	// by a CA in CAFile (or CAPEM): a broker whose certificate it lists is
+	// refused with security.ErrRevoked. It is re-read whenever the file
+	// changes, and checked against CAFile again on ReloadTLS. The control
+	// center is a client of the broker, so the list cannot refuse revoked
+	// vehicles; give it to the broker for that.
+	CRLFile string
+	// Username and Password authenticate with brokers that require them,
+	// alone or in addition to mTLS. The password is only sent when Username
+	// is set.
+	Username string
+	Password string
+	// InitialBackoff, MaxBackoff and JitterFraction space out attempts to
+	// reach the broker, both in Connect and after a lost connection (see
+	// backoff.Backoff). The first attempt is immediate, the second waits
+	// InitialBackoff (default 1s), and each later one twice as long, up to
+	// MaxBackoff (default 2m). JitterFraction of every wait is random
+	// (default 0.5; negative disables it).
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	JitterFraction float64
+	// StateQueueSize bounds the number of inbound state messages buffered
+	// between the MQTT callback and the shadow updater. When the queue is
+	// full a pending state is dropped so the MQTT client never blocks: the
+	// oldest one with a newer state of the same vehicle queued, so that
+	// each vehicle keeps its latest, or else the oldest. Zero applies
+	// updates inline on the callback goroutine.
+	// Responses to RequestState and RefreshVehicle are always applied
+	// inline.
+	StateQueueSize int
+	// ShedLag protects the server from a slow consumer: states that waited in
+	// the state queue longer than this are dropped unapplied (see ShedStates),
+	// so a lagging shadow updater catches up instead of buffering without
+	// bound. Shedding is per vehicle: a vehicle's latest queued state is
+	// applied however long it waited. Alerts and acks are never queued and so
+	// never shed. Setting it enables the state queue with a default size of
+	// 1024 if StateQueueSize is zero.
+	ShedLag time.Duration
+	// LinkLossWindow is the number of state sequence numbers over which the
+	// per-vehicle loss rate is computed (default 100).
+	LinkLossWindow int
+	// LinkLossThreshold is the loss rate above which OnDegradedLink
+	// listeners are notified. Zero reports any loss.
+	LinkLossThreshold float64
+	// HistorySize, when positive, makes the shadow retain that many recent
+	// states per vehicle (see shadow.Manager.History).
+	HistorySize int
+	// HistoryMinDistance and HistoryMinInterval thin the history of
+	// stationary vehicles: a state is recorded only if it moved more than
+	// HistoryMinDistance metres or HistoryMinInterval passed since the last
+	// recorded one (see shadow.Manager.SetHistoryFilter). Zero records
+	// every state.
+	HistoryMinDistance float64
+	HistoryMinInterval time.Duration
+	// TopicPrefixes lists the vehicle topic namespaces the server serves,
+	// e.g. ["v1/vehicle", "v2/vehicle"] while migrating protocol versions.
+	// States from every prefix feed the same shadow, and a message an agent
+	// dual-publishes under several prefixes is handled once. Commands go to
+	// the prefix a vehicle's status arrives under, which is where its agent
+	// subscribes, or under each prefix until its status is seen. Defaults
+	// to protocol.DefaultTopicPrefix.
+	// Prefixes must not overlap one another (see protocol.ValidatePrefixes);
+	// Connect rejects ones that do. Inbound messages are routed by their
+	// parsed topic, so unrelated topics under the same namespace are ignored.
+	TopicPrefixes []string
+	// Alerts configures deduplication and ordering of inbound alerts.
+	Alerts teleoperation.Config
+	// MaxPayloadSize limits the decompressed size of compressed payloads,
+	// which are detected and expanded transparently (default 1 MiB).
+	MaxPayloadSize int
+	// ZlibPayloads also expands payloads starting with a zlib header. Only
+	// gzip is detected by default: the two-byte zlib header is too weak a
+	// marker to tell compressed data from, e.g., a protobuf state.
+	ZlibPayloads bool
+	// AlertFeed republishes every accepted alert, enriched with receipt time
+	// and assigned operator, to protocol.AlertFeedTopic.
+	AlertFeed bool
+	// TracerProvider supplies the OpenTelemetry tracer that starts a span
+	// for every command sent with a CommandID and propagates its context in
+	// ControlCommand.TraceParent. The span ends when the vehicle's final
+	// acknowledgement arrives. Defaults to the global provider, a no-op
+	// until the application installs one.
+	TracerProvider trace.TracerProvider
+	// Logger receives the control center's log entries, and those of its
+	// shadow and, unless Alerts.Logger is set, its alert handler. Defaults
+	// to logging.Default.
+	Logger logging.Logger
+	// ProximityThreshold is the distance in metres below which
+	// CheckProximity reports two vehicles as dangerously close. Zero
+	// disables proximity checks.
+	ProximityThreshold float64
+	// AckTimeouts bounds how long SendControlAndWait waits for each action
+	// to be answered, overriding DefaultAckTimeouts; e.g. a long-running
+	// "drive_to_depot" can be given minutes. A zero entry waits for the
+	// caller's context alone. DefaultAckTimeout applies to actions listed in
+	// neither (default 30s).
+	AckTimeouts       map[string]time.Duration
+	DefaultAckTimeout time.Duration
+	// DryRun keeps the server from publishing anything, e.g. for operator
+	// training; it still subscribes and keeps the shadow. Command sends log
+	// the intended publish and report success, but are not tracked, so no
+	// acks arrive for them. SendControlAndWait, QueryConfig and
+	// OfferStream, which need an answer, log their request and fail with
+	// ErrDryRun. Alerts are not republished to protocol.AlertFeedTopic.
+	DryRun bool
+	// AuditLog, when set, receives an AuditEntry as a line of JSON for
+	// every command sent, dry-run ones included, so an operator session can
+	// later be read back with ReadAudit and reproduced with Replay. Payloads
+	// are recorded as published: sealed when PayloadKey is set.
+	AuditLog io.Writer
+	// ActiveWindow is how recently a vehicle must have reported to receive
+	// commands from DispatchToGroup (default 5s).
+	ActiveWindow time.Duration
+	// MaxPlausibleSpeed drops states implying the vehicle moved faster than
+	// this many metres per second since its last state (see
+	// shadow.Manager.SetMaxPlausibleSpeed). Zero disables the check.
+	MaxPlausibleSpeed float64
+	// MaxTurnRate logs a heading anomaly, typically a faulty heading sensor,
+	// for states whose heading changed faster than this many degrees per
+	// second since the vehicle's last state (see
+	// shadow.Manager.SetMaxTurnRate). Zero disables the check.
+	MaxTurnRate float64
+	// MaxClockSkew flags vehicles whose clock is off by more than this, as
+	// measured from when their states arrive (see shadow.Entry.Skew); the
+	// flag is logged and reported by the HTTP API and Metrics. Zero, the
+	// default, disables the flag. Skew is only measured: states are still
+	// ordered by the vehicle's timestamps.
+	MaxClockSkew time.Duration
+	// Liveness sets the thresholds at which shadow entries become degraded,
+	// stale and offline (default shadow.DefaultLivenessThresholds).
+	// Transitions are logged; call Shadows().CheckLiveness periodically to
+	// evaluate them.
+	Liveness shadow.LivenessThresholds
+	// Codec encodes everything the server publishes and decodes what it
+	// receives over MQTT. Defaults to protocol.JSONCodec; see
+	// protocol.CompatCodec for moving a fleet to protocol.ProtobufCodec.
+	Codec protocol.Codec
+	// TopicFilter, when set, authorizes every inbound message by topic
+	// before it is handled; messages on topics it rejects are dropped, e.g.
+	// another tenant's vehicles matched by a broad wildcard on a shared
+	// broker.
+	TopicFilter func(topic string) bool
+	// WatchOnly replaces the wildcard state and alert subscriptions with
+	// subscriptions to the vehicles passed to WatchVehicle, for tools that
+	// follow a few vehicles rather than the fleet. Acks, streams, config
+	// reports and status messages are still received from every vehicle.
+	WatchOnly bool
+	// BackfillRate, when positive, limits how many replayed (see
+	// protocol.VehicleState.Replayed) states are applied to the shadow per
+	// second. Agents replay their offline buffers at once when the broker
+	// comes back; rather than stalling the shadow updater behind that burst,
+	// such states are queued and applied gradually, while live states keep
+	// flowing. Backfilled entries are marked shadow.Entry.Backfill until the
+	// vehicle's next live state. Zero applies replayed states on arrival.
+	BackfillRate int
+	// PayloadKey, when set, encrypts every non-empty ControlCommand.Payload
+	// with AES-GCM under this 16-, 24- or 32-byte key before it is
+	// published (see protocol.PayloadCipher). Vehicles need the same key;
+	// give it to them first, with vehicle.Config.AllowPlaintextPayloads
+	// during the transition.
+	PayloadKey []byte
+	// SnapshotPath, when set, persists the shadow across restarts: New
+	// restores it from this file, if present, and the server checkpoints it
+	// there every SnapshotInterval (default 30s) and on Disconnect. Restored
+	// entries keep the time their vehicle last reported, so ActiveVehicles
+	// does not count them until the vehicle reports again.
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+	// IdentityPolicy checks every inbound state and alert against its
+	// publisher before it is applied; a rejected message is dropped, logged
+	// and counted in Metrics.IdentityRejected. Nil uses MatchIdentity, which
+	// requires the payload's vehicle ID to match its topic and, where the
+	// message carries it, the publisher's certificate. Deployments without
+	// per-vehicle identities can opt out with AllowAnyIdentity.
+	IdentityPolicy IdentityPolicy
+	// HTTPAddr, when set, makes Connect serve the shadow query API (see
+	// HTTPServer) on this address, together with EventsHandler at /events,
+	// WebSocketHandler at /stream and DebugHandler at /debug/vlink.
+	// Disconnect stops it.
+	HTTPAddr string
+	// GRPCAddr, when set, makes Connect serve the ControlCenter gRPC API
+	// (see package api and GRPCService) on this address. Like the HTTP API
+	// it is served without TLS, so bind it to a trusted network or mount
+	// GRPCService on a server with credentials instead. Disconnect stops
+	// it.
+	GRPCAddr string
+}
+
+// tlsFromPEM reports whether TLS uses the in-memory PEM fields.
+func (c Config) tlsFromPEM() bool {
+	return len(c.CertPEM) > 0 && len(c.KeyPEM) > 0 && len(c.CAPEM) > 0
 }
 
 // Server is the control-center MQTT server.
 type Server struct {
-	cfg     Config
-	client  mqtt.Client
-	shadows *shadow.Manager
-	alerter *teleoperation.Handler
+	cfg      Config
+	log      logging.Logger
+	tracer   trace.Tracer
+	client   mqtt.Client
+	shadows  *shadow.Manager
+	alerter  *teleoperation.Handler
+	queue    *stateQueue
+	backfill *backfillQueue
+	acks     *commandTracker
+	requests *stateRequests
+	streams  *streamSessions
+	configs  *configQueries
+	links    *linkMonitor
+	topics   []protocol.Topics
+	migrate  *migration
+	hub      *updateHub
+	changes  *changeFeed
+	groups   *vehicleGroups
+	muted    *quarantines
+	fences   *geofences
+	watches  *watches
+	sockets  *webSockets
+	http     *HTTPServer
+	rpc      *grpc.Server // nil without Config.GRPCAddr
+	rpcLn    net.Listener
+	audit    *auditLog               // nil without Config.AuditLog
+	snapshot *checkpointer           // nil without Config.SnapshotPath
+	payloads *protocol.PayloadCipher // nil without Config.PayloadKey
+	keyErr   error                   // from an invalid Config.PayloadKey
+	now      func() time.Time
+
+	sseHeartbeat time.Duration
+	tlsReload    atomic.Pointer[func() error] // set by Connect when TLS is configured
+	certExpiry   atomic.Int64                 // Unix nanoseconds; zero without TLS
+
+	identityRejected atomic.Uint64
+
+	backoff      *backoff.Backoff
+	newClient    func(*mqtt.ClientOptions) mqtt.Client // mqtt.NewClient; replaced in tests
+	stopMu       sync.Mutex
+	stop         chan struct{} // closed by Disconnect; nil before Connect
+	reconnecting atomic.Bool
+
+	mu                sync.RWMutex
+	ackListeners      []AckListener
+	degradedListeners []DegradedLinkFunc
+	assignOperator    OperatorAssigner
+	nearPairs         map[[2]string]bool // pairs already alerted by CheckProximity
+	shadowDrops       map[string]uint64  // canonical vehicle ID -> states the shadow dropped
+	otherDrops        uint64             // drops of vehicles beyond maxDropVehicles
 }
 
 // New creates a Server with a fresh shadow manager and teleoperation handler.
 func New(cfg Config) *Server {
-	return &Server{
-		cfg:     cfg,
-		shadows: shadow.NewManager(),
-		alerter: teleoperation.NewHandler(),
+	logger := logging.OrDefault(cfg.Logger)
+	alerts := cfg.Alerts
+	if alerts.Logger == nil {
+		alerts.Logger = logger
+	}
+	s := &Server{
+		cfg:      cfg,
+		log:      logger,
+		tracer:   tracing.Tracer(cfg.TracerProvider, "github.com/daohu527/vlink/pkg/controlcenter"),
+		shadows:  shadow.NewManagerWithHistory(cfg.HistorySize),
+		alerter:  teleoperation.NewHandlerWithConfig(alerts),
+		acks:     newCommandTracker(),
+		requests: newStateRequests(),
+		streams:  newStreamSessions(),
+		configs:  newConfigQueries(),
+		links:    newLinkMonitor(cfg.LinkLossWindow, cfg.LinkLossThreshold),
+		topics:   protocol.TopicsFor(cfg.TopicPrefixes),
+		migrate:  newMigration(),
+		hub:      newUpdateHub(),
+		changes:  newChangeFeed(logger),
+		groups:   newVehicleGroups(),
+		muted:    newQuarantines(logger),
+		fences:   newGeofences(),
+		watches:  newWatches(),
+		sockets:  newWebSockets(),
+		now:      time.Now,
+		backoff:  backoff.New(cfg.InitialBackoff, cfg.MaxBackoff, cfg.JitterFraction),
+
+		newClient: mqtt.NewClient,
+
+		sseHeartbeat: sseHeartbeat,
+	}
+	s.shadows.SetLogger(logger)
+	s.shadows.OnUpdate(s.hub.publish)
+	s.shadows.OnUpdate(s.changes.update)
+	s.shadows.OnUpdate(s.checkGeofence)
+	s.shadows.OnRemove(s.changes.remove)
+	s.shadows.OnRemove(s.forgetDrops)
+	s.shadows.SetMaxPlausibleSpeed(cfg.MaxPlausibleSpeed)
+	s.shadows.SetMaxTurnRate(cfg.MaxTurnRate)
+	s.shadows.OnHeadingAnomaly(s.logHeadingAnomaly)
+	s.shadows.SetMaxClockSkew(cfg.MaxClockSkew)
+	if cfg.Liveness != (shadow.LivenessThresholds{}) {
+		s.shadows.SetLivenessThresholds(cfg.Liveness)
+	}
+	s.shadows.OnLiveness(s.logLiveness)
+	s.shadows.SetHistoryFilter(cfg.HistoryMinDistance, cfg.HistoryMinInterval)
+	s.shadows.OnDrop(s.recordDrop)
+	s.alerter.SetLocator(s.locate)
+	if cfg.AlertFeed {
+		s.alerter.Register(s.republishAlert)
+	}
+	if size := cfg.StateQueueSize; size > 0 || cfg.ShedLag > 0 {
+		if size <= 0 {
+			size = defaultShedQueueSize
+		}
+		s.queue = newStateQueue(size, cfg.ShedLag)
+		go s.queue.run(s.applyQueued)
 	}
+	if cfg.AuditLog != nil {
+		s.audit = newAuditLog(cfg.AuditLog, logger)
+	}
+	if len(cfg.PayloadKey) > 0 {
+		s.payloads, s.keyErr = protocol.NewPayloadCipher(cfg.PayloadKey)
+	}
+	if cfg.BackfillRate > 0 {
+		s.backfill = newBackfillQueue(backfillQueueSize)
+		go s.backfill.run(s.applyBackfill, backfillPerTick(cfg.BackfillRate, backfillTick), backfillTick)
+	}
+	if cfg.SnapshotPath != "" {
+		s.snapshot = newCheckpointer(cfg.SnapshotPath, s.shadows, logger)
+		if err := s.snapshot.restore(); err != nil {
+			s.log.Error("restore shadow snapshot", "err", err)
+		}
+		interval := cfg.SnapshotInterval
+		if interval <= 0 {
+			interval = defaultSnapshotInterval
+		}
+		go s.snapshot.run(interval)
+	}
+	return s
+}
+
+// locate reports a vehicle's position from its shadow.
+func (s *Server) locate(vehicleID string) (float64, float64, bool) {
+	e, ok := s.shadows.Get(vehicleID)
+	if !ok {
+		return 0, 0, false
+	}
+	return e.State.Latitude, e.State.Longitude, true
 }
 
 // Shadows returns the digital-twin manager (read-only access for callers).
@@ -52,36 +408,305 @@ func (s *Server) Shadows() *shadow.Manager { return s.shadows }
 // Alerter returns the teleoperation handler so callers can register listeners.
 func (s *Server) Alerter() *teleoperation.Handler { return s.alerter }
 
-// Connect establishes the MQTT connection. When CertFile, KeyFile and CAFile
-// are set in Config, mutual TLS 1.3 authentication is used.
+// DroppedStates returns how many inbound state messages were discarded
+// because the state queue was full. It is always zero when StateQueueSize
+// is not set.
+func (s *Server) DroppedStates() uint64 {
+	if s.queue == nil {
+		return 0
+	}
+	return s.queue.Dropped()
+}
+
+// ShedStates returns how many inbound states were dropped because they
+// waited longer than Config.ShedLag to be applied.
+func (s *Server) ShedStates() uint64 {
+	if s.queue == nil {
+		return 0
+	}
+	return s.queue.Shed()
+}
+
+// OnAck registers a listener invoked for every command acknowledgement that
+// correlates with a command sent through SendControl.
+func (s *Server) OnAck(l AckListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ackListeners = append(s.ackListeners, l)
+}
+
+// OnDegradedLink registers a listener notified when gaps in a vehicle's state
+// sequence numbers indicate message loss above Config.LinkLossThreshold.
+func (s *Server) OnDegradedLink(fn DegradedLinkFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.degradedListeners = append(s.degradedListeners, fn)
+}
+
+// Connect is ConnectContext without a deadline: it retries until the broker
+// accepts the connection, refuses the client's credentials or certificates,
+// or Disconnect is called.
 func (s *Server) Connect() error {
+	return s.ConnectContext(context.Background())
+}
+
+// ConnectContext establishes the MQTT connection. When CertFile, KeyFile and
+// CAFile, or CertPEM, KeyPEM and CAPEM, are set in Config, mutual TLS 1.3
+// authentication is used. Username and Password, if set, are sent as well,
+// over TLS when it is configured.
+//
+// Failed attempts are retried with backoff until one succeeds, Disconnect is
+// called, or ctx is done. The broker refusing the credentials or the client
+// certificate, or the server certificate failing verification, is not
+// retried: ConnectContext returns that error at once. When ctx is done
+// first, the attempt in flight is abandoned, the client and the HTTP and
+// gRPC listeners are shut down, and the returned error wraps ctx.Err(). Once
+// connected, ctx no longer matters.
+func (s *Server) ConnectContext(ctx context.Context) error {
+	opts, err := s.clientOptions()
+	if err != nil {
+		return err
+	}
+	if s.cfg.HTTPAddr != "" {
+		h := NewHTTPServer(s.shadows)
+		h.SetLogger(s.log)
+		h.Handle("GET /events", s.EventsHandler())
+		h.Handle("GET /stream", s.WebSocketHandler())
+		h.Handle("GET /debug/vlink", s.DebugHandler())
+		if err := h.Start(s.cfg.HTTPAddr); err != nil {
+			return err
+		}
+		s.http = h
+	}
+	if s.cfg.GRPCAddr != "" {
+		if err := s.serveGRPC(s.cfg.GRPCAddr); err != nil {
+			s.stopHTTP()
+			return err
+		}
+	}
+	s.client = s.newClient(opts)
+	stop := make(chan struct{})
+	s.stopMu.Lock()
+	s.stop = stop
+	s.stopMu.Unlock()
+
+	// abort ends the retries, and the attempt in flight, when ctx is done
+	// or Disconnect closes stop.
+	abort := make(chan struct{})
+	connected := make(chan struct{})
+	defer close(connected)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		case <-connected:
+			return
+		}
+		close(abort)
+	}()
+
+	s.backoff.Reset()
+	err = backoff.Retry(abort, s.backoff, func() error { return s.connectOnce(abort) }, s.retryFailed)
+	if err == nil {
+		return nil
+	}
+	s.stopHTTP()
+	s.stopGRPC()
+	if ctx.Err() != nil {
+		s.abandon(stop)
+		return fmt.Errorf("control-center connect: %w", ctx.Err())
+	}
+	return fmt.Errorf("control-center connect: %w", err)
+}
+
+// connectOnce makes a single attempt to reach the broker, giving up with
+// backoff.ErrStopped when abort is closed first. A refusal of the client's
+// credentials or certificates is permanent: retrying cannot fix it.
+func (s *Server) connectOnce(abort <-chan struct{}) error {
+	token := s.client.Connect()
+	select {
+	case <-token.Done():
+		err := token.Error()
+		if security.IsAuthError(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	case <-abort:
+		return backoff.ErrStopped
+	}
+}
+
+// abandon tears down the client of a ConnectContext whose context expired,
+// unless Disconnect already has.
+func (s *Server) abandon(stop chan struct{}) {
+	s.stopMu.Lock()
+	if s.stop != stop {
+		s.stopMu.Unlock()
+		return
+	}
+	close(stop)
+	s.stop = nil
+	s.stopMu.Unlock()
+	s.client.Disconnect(0)
+}
+
+// retryFailed logs a failed attempt to reach the broker.
+func (s *Server) retryFailed(err error, next backoff.State) {
+	s.log.Warn("connect failed", "err", err, "attempt", next.Attempt, "retry_in", next.Delay)
+}
+
+// reconnect retries the connection in the background after it was lost,
+// unless a retry is already running or the client was not created by
+// Connect.
+func (s *Server) reconnect() {
+	s.stopMu.Lock()
+	stop := s.stop
+	s.stopMu.Unlock()
+	if stop == nil || !s.reconnecting.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer s.reconnecting.Store(false)
+		if err := backoff.Retry(stop, s.backoff, func() error { return s.connectOnce(stop) }, s.retryFailed); err != nil {
+			s.log.Error("reconnect", "err", err)
+		}
+	}()
+}
+
+// ReconnectState reports the progress of the current attempt to reach the
+// broker, e.g. for logging; it is the zero State while connected.
+func (s *Server) ReconnectState() backoff.State {
+	return s.backoff.State()
+}
+
+// HTTPServer returns the query API server started by Connect, or nil when
+// Config.HTTPAddr is empty.
+func (s *Server) HTTPServer() *HTTPServer { return s.http }
+
+func (s *Server) stopHTTP() {
+	if s.http != nil {
+		_ = s.http.Close()
+		s.http = nil
+	}
+	s.sockets.closeAll()
+}
+
+// clientOptions builds the MQTT client options from Config.
+func (s *Server) clientOptions() (*mqtt.ClientOptions, error) {
+	if err := protocol.ValidatePrefixes(s.cfg.TopicPrefixes); err != nil {
+		return nil, fmt.Errorf("control-center: %w", err)
+	}
+	if s.keyErr != nil {
+		return nil, fmt.Errorf("control-center: %w", s.keyErr)
+	}
+	if err := errors.Join(
+		protocol.ValidateQoS("ControlQoS", s.cfg.ControlQoS),
+		protocol.ValidateQoS("StateQoS", s.cfg.StateQoS),
+		protocol.ValidateQoS("AlertQoS", s.cfg.AlertQoS),
+	); err != nil {
+		return nil, fmt.Errorf("control-center: %w", err)
+	}
 	opts := mqtt.NewClientOptions().
 		AddBroker(s.cfg.BrokerURL).
 		SetClientID(s.cfg.ClientID).
 		SetCleanSession(false).
-		SetAutoReconnect(true).
-		SetConnectRetry(true).
-		SetConnectRetryInterval(5 * time.Second).
+		// Connect and reconnect retry with jittered backoff themselves;
+		// paho's retries are neither configurable nor jittered.
+		SetAutoReconnect(false).
+		SetConnectRetry(false).
 		SetOnConnectHandler(s.onConnect).
 		SetConnectionLostHandler(s.onConnectionLost)
 
-	if s.cfg.CertFile != "" && s.cfg.KeyFile != "" && s.cfg.CAFile != "" {
-		tlsCfg, err := security.ServerTLSConfig(s.cfg.CertFile, s.cfg.KeyFile, s.cfg.CAFile)
+	switch {
+	case s.cfg.tlsFromPEM():
+		tlsCfg, err := security.TLSConfigFromPEM(s.cfg.CertPEM, s.cfg.KeyPEM, s.cfg.CAPEM, true)
 		if err != nil {
-			return fmt.Errorf("control-center tls config: %w", err)
+			return nil, fmt.Errorf("control-center tls config: %w", err)
+		}
+		if s.cfg.CRLFile != "" {
+			crl, err := security.LoadCRLFromPEM(s.cfg.CRLFile, s.cfg.CAPEM)
+			if err != nil {
+				return nil, fmt.Errorf("control-center tls config: %w", err)
+			}
+			crl.SetLogger(s.log)
+			security.ApplyCRL(tlsCfg, crl)
 		}
 		opts.SetTLSConfig(tlsCfg)
+		s.checkCertExpiry()
+	case s.cfg.CertFile != "" && s.cfg.KeyFile != "" && s.cfg.CAFile != "":
+		tlsCfg, reload := security.ReloadableTLSConfig(s.cfg.CertFile, s.cfg.KeyFile, s.cfg.CAFile)
+		if err := reload(); err != nil {
+			return nil, fmt.Errorf("control-center tls config: %w", err)
+		}
+		if u, err := url.Parse(s.cfg.BrokerURL); err == nil {
+			tlsCfg.ServerName = u.Hostname()
+		}
+		if s.cfg.CRLFile != "" {
+			crl, err := security.LoadCRL(s.cfg.CRLFile, s.cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("control-center tls config: %w", err)
+			}
+			crl.SetLogger(s.log)
+			security.ApplyCRL(tlsCfg, crl)
+			// The list must verify against the CA pool in use.
+			reloadTLS := reload
+			reload = func() error {
+				if err := reloadTLS(); err != nil {
+					return err
+				}
+				return crl.ReloadIssuers()
+			}
+		}
+		opts.SetTLSConfig(tlsCfg)
+		s.tlsReload.Store(&reload)
+		s.checkCertExpiry()
 	}
+	if s.cfg.Username != "" {
+		opts.SetUsername(s.cfg.Username)
+		opts.SetPassword(s.cfg.Password)
+	}
+	return opts, nil
+}
 
-	s.client = mqtt.NewClient(opts)
-
-	token := s.client.Connect()
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("control-center connect: %w", token.Error())
+// ReloadTLS re-reads CertFile, KeyFile and CAFile, e.g. after a certificate
+// rotation, checks the CRLFile list against the new CAFile, and uses them
+// for every later TLS handshake, including automatic
+// reconnects. The current connection keeps its certificates until it is
+// re-established. If any file fails to load, the previous certificates stay
+// in use and the error is returned. ReloadTLS fails unless Connect set up TLS
+// from files; in-memory PEM cannot be re-read.
+func (s *Server) ReloadTLS() error {
+	reload := s.tlsReload.Load()
+	if reload == nil {
+		return errors.New("control-center: TLS is not loaded from files")
+	}
+	if err := (*reload)(); err != nil {
+		return fmt.Errorf("control-center: %w", err)
 	}
+	s.checkCertExpiry()
+	s.log.Info("TLS certificates reloaded")
 	return nil
 }
 
+// checkCertExpiry records when the server's certificate expires, as
+// reported by Metrics, and logs a warning once that is within
+// Config.CertExpiryWarning. An unreadable expiry is logged and otherwise
+// ignored.
+func (s *Server) checkCertExpiry() {
+	var expiry time.Time
+	var err error
+	if s.cfg.tlsFromPEM() {
+		expiry, err = security.CheckExpiryPEM(s.cfg.CertPEM, s.cfg.CertExpiryWarning, s.now(), s.log)
+	} else {
+		expiry, err = security.CheckExpiry(s.cfg.CertFile, s.cfg.CertExpiryWarning, s.now(), s.log)
+	}
+	if err != nil {
+		s.log.Error("certificate expiry", "err", err)
+		return
+	}
+	s.certExpiry.Store(expiry.UnixNano())
+}
+
 // ConnectWithClient injects a pre-configured client (used in tests).
 func (s *Server) ConnectWithClient(c mqtt.Client) {
 	s.client = c
@@ -89,66 +714,444 @@ func (s *Server) ConnectWithClient(c mqtt.Client) {
 }
 
 // SendControl publishes a ControlCommand to the given vehicle.
+// Commands with a CommandID are tracked so that the vehicle's acknowledgement
+// can be correlated and reported to OnAck listeners.
 func (s *Server) SendControl(cmd *protocol.ControlCommand) error {
-	cmd.Timestamp = time.Now().UnixMilli()
+	return s.sendControl(cmd, nil)
+}
+
+// SendControlWithProgress publishes cmd like SendControl and returns a
+// channel receiving every acknowledgement for it, including the in_progress
+// updates of a long-running command. The channel is closed after the final
+// ack, or once the command is forgotten as expired: it has then gone longer
+// than its ack timeout (at least a minute) without an ack, each accepted or
+// in_progress ack restarting that period. Expired commands are swept when
+// the next command is sent. cmd.CommandID is required.
+func (s *Server) SendControlWithProgress(cmd *protocol.ControlCommand) (<-chan *protocol.CommandAck, error) {
+	if cmd.CommandID == "" {
+		return nil, errors.New("control-center: progress requires a command ID")
+	}
+	progress := make(chan *protocol.CommandAck, progressBuffer)
+	if err := s.sendControl(cmd, progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+func (s *Server) sendControl(cmd *protocol.ControlCommand, progress chan *protocol.CommandAck) error {
+	sentAt := s.now()
+	cmd.Timestamp = sentAt.UnixMilli()
 
-	data, err := protocol.Marshal(cmd)
+	var span trace.Span
+	if cmd.CommandID != "" {
+		var ctx context.Context
+		ctx, span = s.tracer.Start(tracing.ContextWithTraceParent(context.Background(), cmd.TraceParent),
+			"vlink.send_control",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("vlink.vehicle_id", cmd.VehicleID),
+				attribute.String("vlink.command_id", cmd.CommandID),
+				attribute.String("vlink.action", cmd.Action),
+			))
+		cmd.TraceParent = tracing.TraceParent(ctx)
+	}
+	fail := func(err error) error {
+		if span != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+		}
+		return err
+	}
+
+	wire, err := s.sealPayload(cmd)
+	if err != nil {
+		return fail(err)
+	}
+	data, err := s.codec().Marshal(wire)
 	if err != nil {
+		return fail(err)
+	}
+
+	if s.cfg.DryRun {
+		for _, t := range s.vehicleTopics(cmd.VehicleID) {
+			s.log.Info("dry run, not publishing command", "topic", t.Control(cmd.VehicleID), "payload", string(data))
+		}
+		if span != nil {
+			span.SetAttributes(attribute.Bool("vlink.dry_run", true))
+			span.End()
+		}
+		if progress != nil {
+			close(progress)
+		}
+		s.recordAudit(wire, sentAt)
+		return nil
+	}
+
+	if cmd.CommandID != "" {
+		s.acks.track(cmd.CommandID, sentAt, s.ackTimeout(cmd.Action), span, progress)
+	}
+	var errs []error
+	for _, t := range s.vehicleTopics(cmd.VehicleID) {
+		token := s.client.Publish(t.Control(cmd.VehicleID), protocol.QoSOr(s.cfg.ControlQoS, 1), false, data)
+		token.Wait()
+		if err := token.Error(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		s.acks.forget(cmd.CommandID, "publish failed")
 		return err
 	}
+	if cmd.CommandID != "" {
+		s.alerter.RecordCommand(cmd.VehicleID, cmd.CommandID, cmd.Action)
+	}
+	s.recordAudit(wire, sentAt)
+	return nil
+}
+
+// ErrDryRun is returned, wrapped, for a request that needs an answer from a
+// vehicle while Config.DryRun keeps the server from publishing it.
+var ErrDryRun = errors.New("control-center: dry run, not published")
 
-	topic := protocol.ControlTopic(cmd.VehicleID)
-	token := s.client.Publish(topic, 1, false, data)
-	token.Wait()
-	return token.Error()
+// recordAudit appends a sent command to Config.AuditLog, if set. cmd is the
+// command as published, so a payload sealed under Config.PayloadKey stays
+// sealed in the log.
+func (s *Server) recordAudit(cmd *protocol.ControlCommand, sentAt time.Time) {
+	if s.audit == nil {
+		return
+	}
+	s.audit.record(AuditEntry{Time: sentAt, Command: cmd, DryRun: s.cfg.DryRun})
 }
 
-// Disconnect gracefully closes the MQTT connection.
+// sealPayload returns cmd as it goes on the wire: with its payload encrypted
+// when Config.PayloadKey is set, leaving the caller's command untouched.
+func (s *Server) sealPayload(cmd *protocol.ControlCommand) (*protocol.ControlCommand, error) {
+	if s.keyErr != nil {
+		return nil, fmt.Errorf("control-center: %w", s.keyErr)
+	}
+	if s.payloads == nil || cmd.Payload == "" {
+		return cmd, nil
+	}
+	sealed, err := s.payloads.Seal(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("control-center: %w", err)
+	}
+	wire := *cmd
+	wire.Payload = sealed
+	return &wire, nil
+}
+
+// Disconnect gracefully closes the MQTT connection. It stops the alert
+// handler's workers (see teleoperation.Config.Workers) after they deliver the
+// alerts already queued, so a disconnected Server is not reconnected: alerts
+// it handles afterwards are dropped, logged and counted.
 func (s *Server) Disconnect() {
+	s.stopMu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.stopMu.Unlock()
 	if s.client != nil {
 		s.client.Disconnect(250)
 	}
+	if s.queue != nil {
+		s.queue.stop()
+	}
+	if s.backfill != nil {
+		s.backfill.stop()
+	}
+	if s.snapshot != nil {
+		s.snapshot.stop()
+	}
+	s.alerter.Close()
+	s.stopHTTP()
+	s.stopGRPC()
 }
 
 // --- private ---
 
 func (s *Server) onConnect(c mqtt.Client) {
-	log.Printf("control-center %s: connected to broker", s.cfg.ClientID)
+	s.log.Info("connected to broker")
 	s.subscribeTopics(c)
 }
 
 func (s *Server) onConnectionLost(_ mqtt.Client, err error) {
-	log.Printf("control-center %s: connection lost: %v", s.cfg.ClientID, err)
+	s.log.Warn("connection lost", "err", err)
+	s.reconnect()
 }
 
 func (s *Server) subscribeTopics(c mqtt.Client) {
-	topics := map[string]mqtt.MessageHandler{
-		protocol.WildcardStateTopic(): s.handleState,
-		protocol.WildcardAlertTopic(): s.handleAlert,
+	type subscription struct {
+		topic string
+		qos   byte
 	}
-	for topic, handler := range topics {
-		token := c.Subscribe(topic, 1, handler)
+	var subs []subscription
+	for _, t := range s.topics {
+		if !s.cfg.WatchOnly {
+			subs = append(subs,
+				subscription{t.WildcardState(), protocol.QoSOr(s.cfg.StateQoS, 1)},
+				subscription{t.WildcardAlert(), protocol.QoSOr(s.cfg.AlertQoS, 1)},
+			)
+		}
+		subs = append(subs,
+			subscription{t.WildcardAck(), 1},
+			subscription{t.WildcardStream(), 1},
+			subscription{t.WildcardConfig(), 1},
+			subscription{t.WildcardStatus(), 1},
+		)
+	}
+	for _, sub := range subs {
+		token := c.Subscribe(sub.topic, sub.qos, s.route)
 		token.Wait()
 		if err := token.Error(); err != nil {
-			log.Printf("control-center: subscribe %s error: %v", topic, err)
+			s.log.Error("subscribe", "topic", sub.topic, "err", err)
+		}
+	}
+	if s.cfg.WatchOnly {
+		s.subscribeWatched(c)
+	}
+}
+
+// route dispatches msg by its parsed topic rather than by the subscription
+// it arrived on, so that a broader subscription overlapping the vehicle
+// namespaces (e.g. "v1/#" on a shared client) cannot feed another message
+// kind to the wrong decoder. Topics outside the configured prefixes, or of
+// a kind the server does not consume, are ignored.
+func (s *Server) route(c mqtt.Client, msg mqtt.Message) {
+	prefix, vehicleID, kind, ok := protocol.ParseTopic(msg.Topic())
+	if !ok || !s.servesPrefix(prefix) || !s.authorized(msg.Topic()) {
+		return
+	}
+	if len(s.topics) > 1 {
+		if kind == protocol.KindStatus {
+			s.migrate.setHome(vehicleID, prefix)
+		}
+		if s.migrate.duplicate(prefix, vehicleID, kind, msg.Payload()) {
+			return
 		}
 	}
+	if (kind == protocol.KindState || kind == protocol.KindAlert) && s.muted.suppress(vehicleID, s.now()) {
+		return
+	}
+	switch kind {
+	case protocol.KindState:
+		s.handleState(c, msg)
+	case protocol.KindAlert:
+		s.handleAlert(c, msg)
+	case protocol.KindAck:
+		s.handleAck(c, msg)
+	case protocol.KindStream:
+		s.handleStream(c, msg)
+	case protocol.KindConfig:
+		s.handleConfig(c, msg)
+	case protocol.KindStatus:
+		s.handleStatus(c, msg)
+	}
+}
+
+// authorized applies Config.TopicFilter.
+func (s *Server) authorized(topic string) bool {
+	return s.cfg.TopicFilter == nil || s.cfg.TopicFilter(topic)
+}
+
+func (s *Server) servesPrefix(prefix string) bool {
+	for _, t := range s.topics {
+		if t.Prefix == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverHandler is deferred by every message handler. It logs a panic
+// raised while processing a message, including one from a registered
+// callback, so the message is dropped instead of crashing the MQTT callback
+// goroutine.
+func (s *Server) recoverHandler(kind, topic string) {
+	if r := recover(); r != nil {
+		s.log.Error("recovered panic handling message", "kind", kind, "topic", topic, "panic", r, "stack", string(debug.Stack()))
+	}
+}
+
+// recordDrop counts a state the shadow refused; the shadow logs it.
+func (s *Server) recordDrop(state *protocol.VehicleState, _ shadow.UpdateResult) {
+	id := ""
+	if state != nil {
+		id = state.VehicleID
+	}
+	s.countDrop(id)
+}
+
+// maxDropVehicles bounds how many vehicles ShadowDrops counts separately,
+// so that states under ever new, e.g. made-up, vehicle IDs cannot grow it
+// without limit.
+const maxDropVehicles = 4096
+
+// countDrop counts a state from vehicleID that never reached the shadow.
+func (s *Server) countDrop(vehicleID string) {
+	id := shadow.CanonicalID(vehicleID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shadowDrops == nil {
+		s.shadowDrops = make(map[string]uint64)
+	}
+	if _, ok := s.shadowDrops[id]; !ok && len(s.shadowDrops) >= maxDropVehicles {
+		s.otherDrops++
+		return
+	}
+	s.shadowDrops[id]++
+}
+
+// forgetDrops stops counting drops for a vehicle removed from the shadow.
+func (s *Server) forgetDrops(vehicleID string, _ *protocol.VehicleState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.otherDrops += s.shadowDrops[vehicleID]
+	delete(s.shadowDrops, vehicleID)
+}
+
+func (s *Server) logHeadingAnomaly(a shadow.HeadingAnomaly) {
+	s.log.Warn("heading anomaly", "vehicle_id", a.VehicleID, "turn_deg", a.Delta, "rate_deg_s", a.Rate)
+}
+
+func (s *Server) logLiveness(c shadow.LivenessChange) {
+	s.log.Info("vehicle liveness changed", "vehicle_id", c.VehicleID, "to", c.To, "from", c.From)
+}
+
+// applyQueued updates the shadow from the state queue worker, measuring the
+// vehicle's clock skew from when the state was enqueued rather than applied.
+func (s *Server) applyQueued(state *protocol.VehicleState, receivedAt time.Time) {
+	defer s.recoverHandler("queued state", state.VehicleID)
+	s.applyState(state, receivedAt)
+}
+
+// applyState writes state, received at receivedAt (zero meaning now), to the
+// shadow, as backfill if the vehicle replayed it from its offline buffer.
+func (s *Server) applyState(state *protocol.VehicleState, receivedAt time.Time) {
+	if state.Replayed {
+		s.shadows.UpdateBackfill(state)
+		return
+	}
+	s.shadows.UpdateReceived(state, receivedAt)
+}
+
+// applyBackfill updates the shadow from the backfill queue worker.
+func (s *Server) applyBackfill(state *protocol.VehicleState) {
+	defer s.recoverHandler("backfilled state", state.VehicleID)
+	s.shadows.UpdateBackfill(state)
 }
 
 func (s *Server) handleState(_ mqtt.Client, msg mqtt.Message) {
+	defer s.recoverHandler("state", msg.Topic())
 	state := &protocol.VehicleState{}
-	if err := protocol.Unmarshal(msg.Payload(), state); err != nil {
-		log.Printf("control-center: bad state message on %s: %v", msg.Topic(), err)
+	if err := s.decode(msg.Payload(), state); err != nil {
+		s.log.Error("bad state message", "topic", msg.Topic(), "err", err)
 		return
 	}
-	s.shadows.Update(state)
+	if !s.verifyIdentity(msg, state.VehicleID) {
+		return
+	}
+	if err := protocol.ValidateState(state); err != nil {
+		s.log.Warn("dropping invalid state", "topic", msg.Topic(), "err", err)
+		s.countDrop(state.VehicleID)
+		return
+	}
+	// Retained and replayed states say nothing about current link loss.
+	if !msg.Retained() && !state.Replayed {
+		s.observeLink(state)
+	}
+	switch {
+	case state.Replayed && s.backfill != nil:
+		s.backfill.push(state)
+	case s.queue != nil && state.RequestID == "":
+		s.queue.push(state)
+	default:
+		// A response to RequestState skips the state queue, so that its
+		// caller observes the refreshed shadow; older states still queued
+		// are then dropped as stale.
+		s.applyState(state, time.Time{})
+	}
+	// Resolve after the inline update so a RequestState caller observes the
+	// refreshed shadow.
+	if state.RequestID != "" {
+		s.requests.resolve(state)
+	}
+}
+
+func (s *Server) observeLink(state *protocol.VehicleState) {
+	rate, degraded := s.links.observe(state.VehicleID, state.Seq)
+	if !degraded {
+		return
+	}
+	s.log.Warn("degraded link", "vehicle_id", state.VehicleID, "loss_rate", rate)
+	s.mu.RLock()
+	ls := make([]DegradedLinkFunc, len(s.degradedListeners))
+	copy(ls, s.degradedListeners)
+	s.mu.RUnlock()
+	for _, l := range ls {
+		l(state.VehicleID, rate)
+	}
 }
 
 func (s *Server) handleAlert(_ mqtt.Client, msg mqtt.Message) {
+	defer s.recoverHandler("alert", msg.Topic())
 	alert := &protocol.TeleoperationAlert{}
-	if err := protocol.Unmarshal(msg.Payload(), alert); err != nil {
-		log.Printf("control-center: bad alert message on %s: %v", msg.Topic(), err)
+	if err := s.decode(msg.Payload(), alert); err != nil {
+		s.log.Error("bad alert message", "topic", msg.Topic(), "err", err)
+		return
+	}
+	if !s.verifyIdentity(msg, alert.VehicleID) {
 		return
 	}
 	s.alerter.Handle(alert)
 }
+
+// handleStatus marks a shadow online or offline from the vehicle's status
+// topic. The payload is plain text rather than an encoded message, since
+// the broker publishes the will verbatim.
+func (s *Server) handleStatus(_ mqtt.Client, msg mqtt.Message) {
+	defer s.recoverHandler("status", msg.Topic())
+	_, vehicleID, _, _ := protocol.ParseTopic(msg.Topic())
+	switch status := strings.TrimSpace(string(msg.Payload())); status {
+	case protocol.StatusOnline, protocol.StatusPaused:
+		paused := status == protocol.StatusPaused
+		s.shadows.SetOnline(vehicleID, true)
+		if e, ok := s.shadows.Get(vehicleID); ok && e.Paused != paused {
+			s.shadows.SetPaused(vehicleID, paused)
+			s.log.Info("vehicle state publishing changed", "vehicle_id", vehicleID, "paused", paused)
+		}
+	case protocol.StatusOffline:
+		if s.shadows.SetOnline(vehicleID, false) {
+			s.log.Info("vehicle went offline", "vehicle_id", vehicleID)
+		}
+	default:
+		s.log.Error("bad status message", "topic", msg.Topic(), "status", status)
+	}
+}
+
+func (s *Server) handleAck(_ mqtt.Client, msg mqtt.Message) {
+	defer s.recoverHandler("ack", msg.Topic())
+	receivedAt := s.now()
+	ack := &protocol.CommandAck{}
+	if err := s.decode(msg.Payload(), ack); err != nil {
+		s.log.Error("bad ack message", "topic", msg.Topic(), "err", err)
+		return
+	}
+	latency, ok := s.acks.resolve(ack, receivedAt)
+	if !ok {
+		s.log.Debug("dropping unmatched ack", "command_id", ack.CommandID, "vehicle_id", ack.VehicleID)
+		return
+	}
+	s.alerter.RecordAck(ack)
+
+	s.mu.RLock()
+	ls := make([]AckListener, len(s.ackListeners))
+	copy(ls, s.ackListeners)
+	s.mu.RUnlock()
+
+	for _, l := range ls {
+		l(ack, latency)
+	}
+}
@@ -1,52 +1,77 @@
 package controlcenter
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
 
+	"github.com/daohu527/vlink/pkg/backoff"
+	"github.com/daohu527/vlink/pkg/logging"
 	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/teleoperation"
 )
 
 // --- reuse the mockClient / mockMessage / mockToken from vehicle tests,
 // duplicated here to keep packages independent. ---
 
 type mockMessage struct {
-	topic   string
-	payload []byte
+	topic    string
+	payload  []byte
+	retained bool
 }
 
 func (m *mockMessage) Duplicate() bool   { return false }
 func (m *mockMessage) Qos() byte         { return 1 }
-func (m *mockMessage) Retained() bool    { return false }
+func (m *mockMessage) Retained() bool    { return m.retained }
 func (m *mockMessage) Topic() string     { return m.topic }
 func (m *mockMessage) MessageID() uint16 { return 0 }
 func (m *mockMessage) Payload() []byte   { return m.payload }
 func (m *mockMessage) Ack()              {}
 
-type mockToken struct{}
+type mockToken struct{ err error }
 
 func (t *mockToken) Wait() bool                     { return true }
 func (t *mockToken) WaitTimeout(time.Duration) bool { return true }
-func (t *mockToken) Done() <-chan struct{}           { ch := make(chan struct{}); close(ch); return ch }
-func (t *mockToken) Error() error                   { return nil }
+func (t *mockToken) Done() <-chan struct{}          { ch := make(chan struct{}); close(ch); return ch }
+func (t *mockToken) Error() error                   { return t.err }
+
+type mockPublish struct {
+	topic   string
+	payload []byte
+	qos     byte
+}
 
 type mockClient struct {
-	published []struct{ topic string; payload []byte }
+	published []mockPublish
 	handlers  map[string]mqtt.MessageHandler
+	subQoS    map[string]byte
+	// subscribed and unsubscribed record every Subscribe and Unsubscribe
+	// call by topic, in order.
+	subscribed   []string
+	unsubscribed []string
+	// publishErr, when set, is consulted before each publish; a non-nil
+	// result fails that publish and the message is not recorded.
+	publishErr func(topic string, payload []byte) error
 }
 
 func newMockClient() *mockClient {
-	return &mockClient{handlers: make(map[string]mqtt.MessageHandler)}
+	return &mockClient{handlers: make(map[string]mqtt.MessageHandler), subQoS: make(map[string]byte)}
 }
 
-func (c *mockClient) IsConnected() bool                                    { return true }
-func (c *mockClient) IsConnectionOpen() bool                               { return true }
-func (c *mockClient) Connect() mqtt.Token                                  { return &mockToken{} }
-func (c *mockClient) Disconnect(uint)                                      {}
-func (c *mockClient) Publish(topic string, _ byte, _ bool, payload interface{}) mqtt.Token {
+func (c *mockClient) IsConnected() bool      { return true }
+func (c *mockClient) IsConnectionOpen() bool { return true }
+func (c *mockClient) Connect() mqtt.Token    { return &mockToken{} }
+func (c *mockClient) Disconnect(uint)        {}
+func (c *mockClient) Publish(topic string, qos byte, _ bool, payload interface{}) mqtt.Token {
 	var p []byte
 	switch v := payload.(type) {
 	case []byte:
@@ -54,19 +79,33 @@ func (c *mockClient) Publish(topic string, _ byte, _ bool, payload interface{})
 	case string:
 		p = []byte(v)
 	}
-	c.published = append(c.published, struct{ topic string; payload []byte }{topic, p})
+	if c.publishErr != nil {
+		if err := c.publishErr(topic, p); err != nil {
+			return &mockToken{err: err}
+		}
+	}
+	c.published = append(c.published, mockPublish{topic, p, qos})
 	return &mockToken{}
 }
-func (c *mockClient) Subscribe(topic string, _ byte, h mqtt.MessageHandler) mqtt.Token {
+func (c *mockClient) Subscribe(topic string, qos byte, h mqtt.MessageHandler) mqtt.Token {
 	c.handlers[topic] = h
+	c.subQoS[topic] = qos
+	c.subscribed = append(c.subscribed, topic)
 	return &mockToken{}
 }
 func (c *mockClient) SubscribeMultiple(map[string]byte, mqtt.MessageHandler) mqtt.Token {
 	return &mockToken{}
 }
-func (c *mockClient) Unsubscribe(...string) mqtt.Token            { return &mockToken{} }
-func (c *mockClient) AddRoute(string, mqtt.MessageHandler)        {}
-func (c *mockClient) OptionsReader() mqtt.ClientOptionsReader     {
+func (c *mockClient) Unsubscribe(topics ...string) mqtt.Token {
+	for _, topic := range topics {
+		delete(c.handlers, topic)
+		delete(c.subQoS, topic)
+	}
+	c.unsubscribed = append(c.unsubscribed, topics...)
+	return &mockToken{}
+}
+func (c *mockClient) AddRoute(string, mqtt.MessageHandler) {}
+func (c *mockClient) OptionsReader() mqtt.ClientOptionsReader {
 	return mqtt.NewClient(mqtt.NewClientOptions()).OptionsReader()
 }
 
@@ -99,6 +138,26 @@ func TestServerUpdatesShadowOnStateMessage(t *testing.T) {
 	}
 }
 
+func TestServerLogsDecodeErrorAtErrorLevel(t *testing.T) {
+	var rec logging.Recorder
+	srv := New(Config{ClientID: "cc", Logger: &rec})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	mc.handlers[protocol.WildcardStateTopic()](mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: []byte("{not json")})
+
+	e, ok := rec.Find(logging.LevelError, "bad state message")
+	if !ok {
+		t.Fatalf("no error entry for the bad state message; logged %+v", rec.Entries())
+	}
+	if e.Fields["topic"] != protocol.StateTopic("car-001") || e.Fields["err"] == nil {
+		t.Errorf("fields = %v, want the topic and the decode error", e.Fields)
+	}
+	if _, ok := srv.Shadows().Get("car-001"); ok {
+		t.Error("undecodable state reached the shadow")
+	}
+}
+
 func TestServerForwardsAlerts(t *testing.T) {
 	srv := New(Config{ClientID: "cc"})
 	mc := newMockClient()
@@ -150,3 +209,568 @@ func TestServerSendControl(t *testing.T) {
 		t.Errorf("topic = %q, want %q", got, want)
 	}
 }
+
+func TestServerUsesConfiguredQoS(t *testing.T) {
+	for _, tc := range []struct {
+		name                         string
+		cfg                          Config
+		control, state, alert, other byte
+	}{
+		{"defaults", Config{}, 1, 1, 1, 1},
+		{"configured", Config{ControlQoS: protocol.QoS(2), StateQoS: protocol.QoS(2), AlertQoS: protocol.QoS(2)}, 2, 2, 2, 1},
+		{"at most once", Config{ControlQoS: protocol.QoS(0), StateQoS: protocol.QoS(0), AlertQoS: protocol.QoS(0)}, 0, 0, 0, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.ClientID = "cc"
+			srv := New(cfg)
+			mc := newMockClient()
+			srv.ConnectWithClient(mc)
+
+			cmd := &protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "stop"}
+			if err := srv.SendControl(cmd); err != nil {
+				t.Fatalf("SendControl: %v", err)
+			}
+			if len(mc.published) != 1 {
+				t.Fatalf("published %d messages, want 1", len(mc.published))
+			}
+			if got := mc.published[0].qos; got != tc.control {
+				t.Errorf("control QoS = %d, want %d", got, tc.control)
+			}
+			for topic, qos := range mc.subQoS {
+				want := tc.other
+				switch topic {
+				case protocol.WildcardStateTopic():
+					want = tc.state
+				case protocol.WildcardAlertTopic():
+					want = tc.alert
+				}
+				if qos != want {
+					t.Errorf("subscribe %s QoS = %d, want %d", topic, qos, want)
+				}
+			}
+		})
+	}
+}
+
+func TestClientOptionsRejectsInvalidQoS(t *testing.T) {
+	srv := New(Config{BrokerURL: "tcp://broker:1883", ClientID: "cc", StateQoS: protocol.QoS(3)})
+	if _, err := srv.clientOptions(); !errors.Is(err, protocol.ErrInvalidQoS) {
+		t.Errorf("clientOptions = %v, want ErrInvalidQoS", err)
+	}
+}
+
+func TestServerAppliesAlertConfig(t *testing.T) {
+	srv := New(Config{ClientID: "cc", Alerts: teleoperation.Config{DedupWindow: time.Minute}})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	var called int32
+	srv.Alerter().Register(func(*protocol.TeleoperationAlert) { atomic.AddInt32(&called, 1) })
+
+	data, _ := protocol.Marshal(&protocol.TeleoperationAlert{AlertID: "a-1", VehicleID: "car-001", Severity: 2})
+	handler := mc.handlers[protocol.WildcardAlertTopic()]
+	handler(mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: data})
+	handler(mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: data})
+
+	if n := atomic.LoadInt32(&called); n != 1 {
+		t.Errorf("listener called %d times, want 1 for a redelivered alert", n)
+	}
+}
+
+func TestServerRecoversFromCallbackPanics(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	var alerts int
+	srv.Alerter().Register(func(a *protocol.TeleoperationAlert) {
+		if a.Reason == "bad" {
+			var p *protocol.VehicleState
+			_ = p.Speed // nil dereference
+		}
+		alerts++
+	})
+	srv.Shadows().OnUpdate(func(_, next *protocol.VehicleState) {
+		if next.VehicleID == "car-bad" {
+			panic("sink failure")
+		}
+	})
+
+	alertHandler := mc.handlers[protocol.WildcardAlertTopic()]
+	for _, reason := range []string{"bad", "good"} {
+		data, _ := protocol.Marshal(&protocol.TeleoperationAlert{VehicleID: "car-001", Reason: reason})
+		alertHandler(mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: data})
+	}
+	if alerts != 1 {
+		t.Errorf("alerts processed after panic = %d, want 1", alerts)
+	}
+
+	stateHandler := mc.handlers[protocol.WildcardStateTopic()]
+	for _, id := range []string{"car-bad", "car-002"} {
+		data, _ := protocol.Marshal(protocol.NewVehicleState(id))
+		stateHandler(mc, &mockMessage{topic: protocol.StateTopic(id), payload: data})
+	}
+	if _, ok := srv.Shadows().Get("car-002"); !ok {
+		t.Error("state after a panicking callback was not processed")
+	}
+}
+
+func TestCredentialsReachClientOptions(t *testing.T) {
+	certFile, keyFile, caFile := writeTestCerts(t)
+	srv := New(Config{
+		BrokerURL: "tls://broker:8883",
+		ClientID:  "cc",
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		CAFile:    caFile,
+		Username:  "control-center",
+		Password:  "s3cret",
+	})
+
+	opts, err := srv.clientOptions()
+	if err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	r := mqtt.NewClient(opts).OptionsReader()
+	if r.Username() != "control-center" || r.Password() != "s3cret" {
+		t.Errorf("credentials = %q/%q, want control-center/s3cret", r.Username(), r.Password())
+	}
+	if tlsCfg := r.TLSConfig(); tlsCfg == nil || tlsCfg.GetClientCertificate == nil {
+		t.Error("TLS config lost when credentials are set")
+	}
+
+	// Without credentials nothing is sent.
+	opts, err = New(Config{BrokerURL: "tcp://broker:1883", ClientID: "cc"}).clientOptions()
+	if err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	if r := mqtt.NewClient(opts).OptionsReader(); r.Username() != "" || r.Password() != "" {
+		t.Errorf("unexpected credentials %q/%q", r.Username(), r.Password())
+	}
+}
+
+func TestReloadTLS(t *testing.T) {
+	if err := New(Config{ClientID: "cc"}).ReloadTLS(); err == nil {
+		t.Error("ReloadTLS succeeded without TLS configured")
+	}
+
+	certFile, keyFile, caFile := writeTestCerts(t)
+	srv := New(Config{
+		BrokerURL: "tls://broker:8883",
+		ClientID:  "cc",
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		CAFile:    caFile,
+	})
+	opts, err := srv.clientOptions()
+	if err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	if got := opts.TLSConfig.ServerName; got != "broker" {
+		t.Errorf("ServerName = %q, want broker", got)
+	}
+	if err := srv.ReloadTLS(); err != nil {
+		t.Fatalf("ReloadTLS: %v", err)
+	}
+	if err := os.WriteFile(certFile, []byte("rotating"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.ReloadTLS(); err == nil {
+		t.Error("ReloadTLS accepted a corrupt certificate")
+	}
+}
+
+func TestClientOptionsRejectsUnreadableCRL(t *testing.T) {
+	certFile, keyFile, caFile := writeTestCerts(t)
+	srv := New(Config{
+		BrokerURL: "tls://broker:8883",
+		ClientID:  "cc",
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		CAFile:    caFile,
+		CRLFile:   filepath.Join(t.TempDir(), "missing.crl"),
+	})
+	if _, err := srv.clientOptions(); err == nil {
+		t.Error("clientOptions succeeded with a missing CRL")
+	}
+}
+
+// flakyClient fails its first failures connection attempts.
+type flakyClient struct {
+	*mockClient
+	failures int
+	attempts atomic.Int32
+}
+
+func (c *flakyClient) Connect() mqtt.Token {
+	if int(c.attempts.Add(1)) <= c.failures {
+		return &mockToken{err: errors.New("connection refused")}
+	}
+	return &mockToken{}
+}
+
+func TestReconnectBacksOffAfterConnectionLost(t *testing.T) {
+	srv := New(Config{ClientID: "cc", InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond})
+	fc := &flakyClient{mockClient: newMockClient(), failures: 2}
+	srv.ConnectWithClient(fc)
+
+	// Clients injected with ConnectWithClient reconnect on their own.
+	srv.onConnectionLost(fc, errors.New("network unreachable"))
+	time.Sleep(10 * time.Millisecond)
+	if n := fc.attempts.Load(); n != 0 {
+		t.Fatalf("reconnected an injected client %d times", n)
+	}
+
+	srv.stop = make(chan struct{})
+	defer srv.Disconnect()
+	srv.onConnectionLost(fc, errors.New("network unreachable"))
+	deadline := time.Now().Add(time.Second)
+	for (fc.attempts.Load() < 3 || srv.reconnecting.Load()) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := fc.attempts.Load(); n != 3 {
+		t.Fatalf("connect attempts = %d, want 3", n)
+	}
+	if s := srv.ReconnectState(); s.Attempt != 0 {
+		t.Errorf("ReconnectState after reconnecting = %+v, want reset", s)
+	}
+}
+
+func TestConnectRetriesUntilDisconnected(t *testing.T) {
+	srv := New(Config{
+		ClientID:       "cc",
+		BrokerURL:      "tcp://127.0.0.1:1",
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	})
+	done := make(chan error, 1)
+	go func() { done <- srv.Connect() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.ReconnectState().Attempt < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s := srv.ReconnectState(); s.Attempt < 3 || s.Delay > 5*time.Millisecond {
+		t.Errorf("ReconnectState = %+v, want attempt 3 or later within MaxBackoff", s)
+	}
+	srv.Disconnect()
+	select {
+	case err := <-done:
+		if !errors.Is(err, backoff.ErrStopped) {
+			t.Errorf("Connect = %v, want ErrStopped", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connect did not return after Disconnect")
+	}
+}
+
+// hangingToken never completes, like a connect to a broker that accepts the
+// TCP connection but never answers.
+type hangingToken struct{ mockToken }
+
+func (t *hangingToken) Wait() bool            { select {} }
+func (t *hangingToken) Done() <-chan struct{} { return nil }
+
+// hangingClient's connection attempts never complete.
+type hangingClient struct {
+	*mockClient
+	attempts     atomic.Int32
+	disconnected atomic.Bool
+}
+
+func (c *hangingClient) Connect() mqtt.Token {
+	c.attempts.Add(1)
+	return &hangingToken{}
+}
+func (c *hangingClient) Disconnect(uint) { c.disconnected.Store(true) }
+
+func TestConnectContextHonorsDeadline(t *testing.T) {
+	srv := New(Config{ClientID: "cc", BrokerURL: "tcp://broker:1883", HTTPAddr: "127.0.0.1:0"})
+	hc := &hangingClient{mockClient: newMockClient()}
+	srv.newClient = func(*mqtt.ClientOptions) mqtt.Client { return hc }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := srv.ConnectContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ConnectContext = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ConnectContext returned after %v, want about 50ms", elapsed)
+	}
+	if hc.attempts.Load() != 1 || !hc.disconnected.Load() {
+		t.Errorf("attempts = %d, disconnected = %v; want the one hanging attempt torn down",
+			hc.attempts.Load(), hc.disconnected.Load())
+	}
+	if srv.stop != nil || srv.http != nil {
+		t.Error("abandoned connect left its stop channel or HTTP listener behind")
+	}
+	// A late connection-lost callback must not start reconnecting.
+	srv.onConnectionLost(hc, errors.New("network unreachable"))
+	if srv.reconnecting.Load() {
+		t.Error("reconnecting after an abandoned connect")
+	}
+}
+
+// refusingClient's broker refuses every connection attempt with err.
+type refusingClient struct {
+	*mockClient
+	err      error
+	attempts atomic.Int32
+}
+
+func (c *refusingClient) Connect() mqtt.Token {
+	c.attempts.Add(1)
+	return &mockToken{err: c.err}
+}
+
+func TestConnectGivesUpWhenNotAuthorised(t *testing.T) {
+	srv := New(Config{ClientID: "cc", BrokerURL: "tcp://broker:1883", InitialBackoff: time.Hour})
+	rc := &refusingClient{mockClient: newMockClient(), err: packets.ErrorRefusedNotAuthorised}
+	srv.newClient = func(*mqtt.ClientOptions) mqtt.Client { return rc }
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Connect() }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, packets.ErrorRefusedNotAuthorised) {
+			t.Errorf("Connect = %v, want the refusal", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connect kept retrying a refused connection")
+	}
+	if n := rc.attempts.Load(); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+}
+
+func TestClientOptionsPreferInMemoryPEM(t *testing.T) {
+	certFile, keyFile, caFile := writeTestCerts(t)
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(Config{
+		BrokerURL: "tls://broker:8883",
+		ClientID:  "cc",
+		CertFile:  "/no/such/cert.pem",
+		KeyFile:   "/no/such/key.pem",
+		CAFile:    "/no/such/ca.pem",
+		CertPEM:   certPEM,
+		KeyPEM:    keyPEM,
+		CAPEM:     caPEM,
+	})
+
+	opts, err := srv.clientOptions()
+	if err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	tlsCfg := opts.TLSConfig
+	if tlsCfg == nil || len(tlsCfg.Certificates) != 1 || tlsCfg.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("TLS config not built from PEM: %+v", tlsCfg)
+	}
+	if srv.Metrics().CertValiditySeconds <= 0 {
+		t.Error("certificate validity not reported for in-memory PEM")
+	}
+	if err := srv.ReloadTLS(); err == nil {
+		t.Error("ReloadTLS succeeded for in-memory PEM")
+	}
+}
+
+func TestServerIgnoresUnrelatedTopics(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	var alerts int32
+	srv.Alerter().Register(func(*protocol.TeleoperationAlert) { atomic.AddInt32(&alerts, 1) })
+
+	// As if delivered through an overly broad subscription such as "v1/#".
+	broad := mc.handlers[protocol.WildcardStateTopic()]
+	state, _ := protocol.Marshal(protocol.NewVehicleState("car-001"))
+	cmd, _ := protocol.Marshal(&protocol.ControlCommand{CommandID: "c-1", VehicleID: "car-001", Action: "stop"})
+	feed, _ := protocol.Marshal(&protocol.FeedAlert{TeleoperationAlert: protocol.TeleoperationAlert{VehicleID: "car-001", Severity: 3}})
+	for _, m := range []*mockMessage{
+		{topic: protocol.ControlTopic("car-001"), payload: cmd},
+		{topic: protocol.AlertFeedTopic, payload: feed},
+		{topic: "v2/vehicle/car-001/state", payload: state},
+		{topic: protocol.StateTopic("car-001") + "/raw", payload: state},
+		{topic: "v1/diagnostics", payload: []byte("not json")},
+	} {
+		broad(mc, m)
+	}
+
+	if n := len(srv.Shadows().All()); n != 0 {
+		t.Errorf("shadow has %d entries, want unrelated topics ignored", n)
+	}
+	if n := atomic.LoadInt32(&alerts); n != 0 {
+		t.Errorf("alert listener called %d times for unrelated topics", n)
+	}
+
+	// A matching topic is still routed by kind, whichever subscription it
+	// arrived on.
+	alert, _ := protocol.Marshal(&protocol.TeleoperationAlert{VehicleID: "car-001", Severity: 2})
+	broad(mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: alert})
+	if n := atomic.LoadInt32(&alerts); n != 1 {
+		t.Errorf("alert listener called %d times, want 1", n)
+	}
+}
+
+func TestTopicFilterDropsUnauthorizedTopics(t *testing.T) {
+	srv := New(Config{
+		ClientID:    "cc",
+		TopicFilter: func(topic string) bool { return !strings.Contains(topic, "/tenant-b-") },
+	})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	var alerts []string
+	srv.Alerter().Register(func(a *protocol.TeleoperationAlert) { alerts = append(alerts, a.VehicleID) })
+
+	route := mc.handlers[protocol.WildcardStateTopic()]
+	for _, id := range []string{"tenant-a-001", "tenant-b-001"} {
+		state, _ := protocol.Marshal(protocol.NewVehicleState(id))
+		route(mc, &mockMessage{topic: protocol.StateTopic(id), payload: state})
+		alert, _ := protocol.Marshal(&protocol.TeleoperationAlert{AlertID: "a-" + id, VehicleID: id, Severity: 2})
+		route(mc, &mockMessage{topic: protocol.AlertTopic(id), payload: alert})
+	}
+
+	if _, ok := srv.Shadows().Get("tenant-b-001"); ok {
+		t.Error("state on a filtered topic reached the shadow")
+	}
+	if _, ok := srv.Shadows().Get("tenant-a-001"); !ok {
+		t.Error("state on an authorized topic was dropped")
+	}
+	if len(alerts) != 1 || alerts[0] != "tenant-a-001" {
+		t.Errorf("alerts = %v, want only tenant-a-001", alerts)
+	}
+}
+
+func TestAlertResolutionLinksCommandsAndAcks(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	route := mc.handlers[protocol.WildcardAlertTopic()]
+
+	alert, _ := protocol.Marshal(&protocol.TeleoperationAlert{AlertID: "a-1", VehicleID: "car-001", Reason: "extreme_weather", Severity: 3})
+	route(mc, &mockMessage{topic: protocol.AlertTopic("car-001"), payload: alert})
+
+	for _, cmd := range []*protocol.ControlCommand{
+		{CommandID: "c-1", VehicleID: "car-001", Action: protocol.ActionTeleoperationStart},
+		{CommandID: "c-2", VehicleID: "car-001", Action: protocol.ActionResume},
+	} {
+		if err := srv.SendControl(cmd); err != nil {
+			t.Fatalf("SendControl: %v", err)
+		}
+		ack, _ := protocol.Marshal(&protocol.CommandAck{CommandID: cmd.CommandID, VehicleID: "car-001", Status: protocol.AckCompleted})
+		route(mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: ack})
+	}
+
+	refs := srv.Alerter().ResolutionOf("a-1")
+	if len(refs) != 2 || refs[0].Action != protocol.ActionTeleoperationStart || refs[1].Action != protocol.ActionResume {
+		t.Fatalf("ResolutionOf = %+v, want teleoperation_start then resume", refs)
+	}
+	for _, r := range refs {
+		if r.Status != protocol.AckCompleted {
+			t.Errorf("%s status = %q, want completed", r.CommandID, r.Status)
+		}
+	}
+}
+
+func TestStatusMessagesFlipOnline(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	route := mc.handlers[protocol.WildcardStatusTopic()]
+	if route == nil {
+		t.Fatal("no subscription for the status wildcard")
+	}
+
+	state, _ := protocol.Marshal(protocol.NewVehicleState("car-001"))
+	route(mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: state})
+	if e, _ := srv.Shadows().Get("car-001"); !e.Online {
+		t.Fatal("vehicle not online after its first state")
+	}
+
+	// The broker publishes the vehicle's last will.
+	route(mc, &mockMessage{topic: protocol.StatusTopic("car-001"), payload: []byte(protocol.StatusOffline)})
+	if e, _ := srv.Shadows().Get("car-001"); e.Online {
+		t.Error("offline status did not clear Online")
+	}
+	if ids := srv.Shadows().ActiveVehicles(time.Minute); len(ids) != 0 {
+		t.Errorf("ActiveVehicles = %v, want offline vehicle excluded", ids)
+	}
+
+	route(mc, &mockMessage{topic: protocol.StatusTopic("car-001"), payload: []byte(protocol.StatusOnline)})
+	if e, _ := srv.Shadows().Get("car-001"); !e.Online {
+		t.Error("online status did not set Online")
+	}
+}
+
+func TestConnectRejectsOverlappingPrefixes(t *testing.T) {
+	srv := New(Config{ClientID: "cc", TopicPrefixes: []string{"v1", "v1/vehicle"}})
+	if _, err := srv.clientOptions(); !errors.Is(err, protocol.ErrInvalidPrefix) {
+		t.Errorf("clientOptions = %v, want ErrInvalidPrefix", err)
+	}
+}
+
+func TestServerDryRunDoesNotPublish(t *testing.T) {
+	srv := New(Config{ClientID: "cc", DryRun: true})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	cmd := &protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: protocol.ActionStop}
+	if err := srv.SendControl(cmd); err != nil {
+		t.Fatalf("SendControl: %v", err)
+	}
+	progress, err := srv.SendControlWithProgress(&protocol.ControlCommand{CommandID: "cmd-2", VehicleID: "car-001", Action: "drive_to_depot"})
+	if err != nil {
+		t.Fatalf("SendControlWithProgress: %v", err)
+	}
+	if _, ok := <-progress; ok {
+		t.Error("dry-run progress channel delivered an ack")
+	}
+
+	if _, err := srv.SendControlAndWait(context.Background(), &protocol.ControlCommand{VehicleID: "car-001", Action: protocol.ActionStop}); !errors.Is(err, ErrDryRun) {
+		t.Errorf("SendControlAndWait = %v, want ErrDryRun", err)
+	}
+	if _, err := srv.QueryConfig("car-001", time.Second); !errors.Is(err, ErrDryRun) {
+		t.Errorf("QueryConfig = %v, want ErrDryRun", err)
+	}
+	if _, err := srv.OfferStream(context.Background(), &protocol.StreamSignal{VehicleID: "car-001"}); !errors.Is(err, ErrDryRun) {
+		t.Errorf("OfferStream = %v, want ErrDryRun", err)
+	}
+	srv.republishAlert(&protocol.TeleoperationAlert{VehicleID: "car-001", Reason: "obstacle", Severity: 3})
+
+	if len(mc.published) != 0 {
+		t.Errorf("published %d messages in dry-run mode, want 0", len(mc.published))
+	}
+	if n := srv.acks.Len(); n != 0 {
+		t.Errorf("pending commands = %d, want dry-run commands untracked", n)
+	}
+}
+
+func TestSendControlRejectsInvalidPayloadKey(t *testing.T) {
+	srv := New(Config{ClientID: "cc", PayloadKey: []byte("short")})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	if err := srv.SendControl(&protocol.ControlCommand{VehicleID: "car-001", Action: "stop"}); err == nil {
+		t.Error("expected an error for an invalid payload key")
+	}
+	if _, err := srv.clientOptions(); err == nil {
+		t.Error("clientOptions accepted an invalid payload key")
+	}
+	if n := len(mc.published); n != 0 {
+		t.Errorf("published %d messages, want none", n)
+	}
+}
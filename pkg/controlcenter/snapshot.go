@@ -0,0 +1,110 @@
+package controlcenter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// defaultSnapshotInterval applies when Config.SnapshotPath is set without a
+// SnapshotInterval.
+const defaultSnapshotInterval = 30 * time.Second
+
+// checkpointer persists the shadow to Config.SnapshotPath periodically and
+// once more when stopped.
+type checkpointer struct {
+	path    string
+	shadows *shadow.Manager
+	log     logging.Logger
+
+	done     chan struct{}
+	finished chan struct{}
+	stopOnce sync.Once
+}
+
+func newCheckpointer(path string, shadows *shadow.Manager, log logging.Logger) *checkpointer {
+	return &checkpointer{
+		path:     path,
+		shadows:  shadows,
+		log:      log,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+}
+
+// restore loads the snapshot at path into the shadow. A missing file is not
+// an error: it is the first start.
+func (c *checkpointer) restore() error {
+	f, err := os.Open(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("control-center: restore shadow: %w", err)
+	}
+	defer f.Close()
+	if err := c.shadows.LoadSnapshot(f); err != nil {
+		return fmt.Errorf("control-center: restore shadow from %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// save writes the snapshot to a temporary file beside path and renames it
+// into place, so a crash mid-write never leaves a truncated snapshot.
+func (c *checkpointer) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("control-center: checkpoint shadow: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if err := c.shadows.Snapshot(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("control-center: checkpoint shadow: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("control-center: checkpoint shadow: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("control-center: checkpoint shadow: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("control-center: checkpoint shadow: %w", err)
+	}
+	return nil
+}
+
+// run saves a checkpoint every interval until stop is called.
+func (c *checkpointer) run(interval time.Duration) {
+	defer close(c.finished)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			if err := c.save(); err != nil {
+				c.log.Error("checkpoint shadow", "err", err)
+			}
+		}
+	}
+}
+
+// stop ends run and writes a final checkpoint.
+func (c *checkpointer) stop() {
+	c.stopOnce.Do(func() {
+		close(c.done)
+		<-c.finished
+		if err := c.save(); err != nil {
+			c.log.Error("checkpoint shadow", "err", err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package controlcenter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestSnapshotRestoredAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shadow.json")
+
+	srv := New(Config{ClientID: "cc", SnapshotPath: path})
+	srv.ConnectWithClient(newMockClient())
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli(), BatteryPct: 64})
+	srv.Disconnect()
+
+	restarted := New(Config{ClientID: "cc", SnapshotPath: path})
+	defer restarted.Disconnect()
+	e, ok := restarted.Shadows().Get("car-001")
+	if !ok {
+		t.Fatal("car-001 not restored")
+	}
+	if e.State.BatteryPct != 64 {
+		t.Errorf("battery = %v, want 64", e.State.BatteryPct)
+	}
+	if ids := restarted.Shadows().ActiveVehicles(time.Minute); len(ids) != 1 {
+		t.Errorf("ActiveVehicles = %v, want the recent vehicle", ids)
+	}
+}
+
+func TestSnapshotCheckpointsPeriodically(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shadow.json")
+	srv := New(Config{ClientID: "cc", SnapshotPath: path, SnapshotInterval: 10 * time.Millisecond})
+	defer srv.Disconnect()
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli()})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no checkpoint written")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSnapshotStartsEmptyWithoutFile(t *testing.T) {
+	srv := New(Config{ClientID: "cc", SnapshotPath: filepath.Join(t.TempDir(), "missing.json")})
+	defer srv.Disconnect()
+	if n := len(srv.Shadows().All()); n != 0 {
+		t.Errorf("entries = %d, want 0", n)
+	}
+}
@@ -0,0 +1,72 @@
+package controlcenter
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+const (
+	// sseHeartbeat is the interval of keep-alive comments on idle streams.
+	sseHeartbeat = 15 * time.Second
+	// sseBuffer is the number of updates buffered per SSE client.
+	sseBuffer = 64
+)
+
+// EventsHandler returns an http.Handler that streams shadow updates as
+// Server-Sent Events, intended to be mounted at /events. Each update is sent
+// as a "state" event whose data is the VehicleState JSON. The optional
+// vehicle_id query parameter restricts the stream to one vehicle, whose ID
+// is matched after shadow.CanonicalID as in the shadow. Idle streams receive
+// a comment every 15 seconds to keep proxies from closing them; a client too
+// slow to keep up misses updates rather than stalling the shadow.
+func (s *Server) EventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		filter := shadow.CanonicalID(r.URL.Query().Get("vehicle_id"))
+
+		id, updates := s.hub.subscribe(sseBuffer)
+		defer s.hub.unsubscribe(id)
+
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(s.sseHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case state := <-updates:
+				if filter != "" && shadow.CanonicalID(state.VehicleID) != filter {
+					continue
+				}
+				data, err := protocol.Marshal(state)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: state\ndata: %s\n\n", data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
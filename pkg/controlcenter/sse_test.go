@@ -0,0 +1,134 @@
+package controlcenter
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// firstStateEvent opens url on the events handler of srv, applies states to
+// the shadow once subscribed, and returns the first "state" event.
+func firstStateEvent(t *testing.T, srv *Server, url string, states ...*protocol.VehicleState) protocol.VehicleState {
+	t.Helper()
+	ts := httptest.NewServer(srv.EventsHandler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + url)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+	}()
+	next := func() string {
+		select {
+		case l := <-lines:
+			return l
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for SSE data")
+			return ""
+		}
+	}
+
+	// Wait for the subscription to be established before updating.
+	if l := next(); l != ": connected" {
+		t.Fatalf("first line = %q, want connected comment", l)
+	}
+	for _, state := range states {
+		srv.Shadows().Update(state)
+	}
+
+	var event, data string
+	for data == "" {
+		l := next()
+		switch {
+		case strings.HasPrefix(l, "event: "):
+			event = strings.TrimPrefix(l, "event: ")
+		case strings.HasPrefix(l, "data: "):
+			data = strings.TrimPrefix(l, "data: ")
+		}
+	}
+	if event != "state" {
+		t.Errorf("event = %q, want state", event)
+	}
+	var s protocol.VehicleState
+	if err := protocol.Unmarshal([]byte(data), &s); err != nil {
+		t.Fatalf("decode event data: %v", err)
+	}
+	return s
+}
+
+func TestEventsStreamsShadowUpdates(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	now := time.Now().UnixMilli()
+	s := firstStateEvent(t, srv, "/events?vehicle_id=car-002",
+		&protocol.VehicleState{VehicleID: "car-001", Timestamp: now},
+		&protocol.VehicleState{VehicleID: "car-002", Timestamp: now, Speed: 7})
+	if s.VehicleID != "car-002" || s.Speed != 7 {
+		t.Errorf("event state = %+v, want filtered car-002 update", s)
+	}
+}
+
+func TestEventsFilterIgnoresCase(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	now := time.Now().UnixMilli()
+	s := firstStateEvent(t, srv, "/events?vehicle_id=CAR-002",
+		&protocol.VehicleState{VehicleID: "car-001", Timestamp: now},
+		&protocol.VehicleState{VehicleID: "Car-002", Timestamp: now, Speed: 7})
+	if s.VehicleID != "Car-002" || s.Speed != 7 {
+		t.Errorf("event state = %+v, want the Car-002 update", s)
+	}
+}
+
+func TestEventsHeartbeatAndDisconnect(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	srv.sseHeartbeat = 10 * time.Millisecond
+	ts := httptest.NewServer(srv.EventsHandler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	sc := bufio.NewScanner(resp.Body)
+	sawHeartbeat := false
+	for i := 0; i < 6 && sc.Scan(); i++ {
+		if sc.Text() == ": heartbeat" {
+			sawHeartbeat = true
+			break
+		}
+	}
+	if !sawHeartbeat {
+		t.Error("no heartbeat comment received")
+	}
+	resp.Body.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		srv.hub.mu.Lock()
+		n := len(srv.hub.subs)
+		srv.hub.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber not released after client disconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
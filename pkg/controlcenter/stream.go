@@ -0,0 +1,109 @@
+package controlcenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// streamSessions routes stream answers to the OfferStream call awaiting them.
+type streamSessions struct {
+	mu      sync.Mutex
+	waiters map[string]chan *protocol.StreamSignal
+}
+
+func newStreamSessions() *streamSessions {
+	return &streamSessions{waiters: make(map[string]chan *protocol.StreamSignal)}
+}
+
+func (r *streamSessions) add(sessionID string) chan *protocol.StreamSignal {
+	ch := make(chan *protocol.StreamSignal, 1)
+	r.mu.Lock()
+	r.waiters[sessionID] = ch
+	r.mu.Unlock()
+	return ch
+}
+
+func (r *streamSessions) remove(sessionID string) {
+	r.mu.Lock()
+	delete(r.waiters, sessionID)
+	r.mu.Unlock()
+}
+
+// resolve delivers answer to its waiter and reports whether one was waiting.
+func (r *streamSessions) resolve(answer *protocol.StreamSignal) bool {
+	r.mu.Lock()
+	ch, ok := r.waiters[answer.SessionID]
+	delete(r.waiters, answer.SessionID)
+	r.mu.Unlock()
+	if ok {
+		ch <- answer
+	}
+	return ok
+}
+
+// OfferStream sends a video stream offer to offer.VehicleID and waits until
+// ctx is done for the vehicle's answer. SessionID is generated when empty and
+// Type and Timestamp are filled in. An answer that rejects the offer is
+// returned together with an error.
+func (s *Server) OfferStream(ctx context.Context, offer *protocol.StreamSignal) (*protocol.StreamSignal, error) {
+	if offer.SessionID == "" {
+		offer.SessionID = newCommandID()
+	}
+	offer.Type = protocol.StreamOffer
+	offer.Timestamp = s.now().UnixMilli()
+	data, err := s.codec().Marshal(offer)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.DryRun {
+		s.log.Info("dry run, not publishing stream offer", "vehicle_id", offer.VehicleID, "payload", string(data))
+		return nil, fmt.Errorf("%w: stream offer to %s", ErrDryRun, offer.VehicleID)
+	}
+
+	ch := s.streams.add(offer.SessionID)
+	defer s.streams.remove(offer.SessionID)
+
+	var errs []error
+	for _, t := range s.vehicleTopics(offer.VehicleID) {
+		token := s.client.Publish(t.Stream(offer.VehicleID), 1, false, data)
+		token.Wait()
+		if err := token.Error(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("control-center: stream offer to %s: %w", offer.VehicleID, err)
+	}
+
+	select {
+	case answer := <-ch:
+		if answer.Error != "" {
+			return answer, fmt.Errorf("control-center: stream offer rejected by %s: %s", offer.VehicleID, answer.Error)
+		}
+		return answer, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("control-center: stream offer to %s: %w", offer.VehicleID, ctx.Err())
+	}
+}
+
+func (s *Server) handleStream(_ mqtt.Client, msg mqtt.Message) {
+	defer s.recoverHandler("stream", msg.Topic())
+	sig := &protocol.StreamSignal{}
+	if err := s.decode(msg.Payload(), sig); err != nil {
+		s.log.Error("bad stream message", "topic", msg.Topic(), "err", err)
+		return
+	}
+	if sig.Type != protocol.StreamAnswer {
+		return // our own offers echoed back by the broker
+	}
+	if !s.streams.resolve(sig) {
+		s.log.Debug("dropping unmatched stream answer", "session_id", sig.SessionID, "vehicle_id", sig.VehicleID)
+	}
+}
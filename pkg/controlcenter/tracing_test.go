@@ -0,0 +1,79 @@
+package controlcenter
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/tracing"
+)
+
+// spanAttr returns the value of attribute key on span, or "".
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSendControlCreatesSpanPerCommand(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	srv := NewWithOptions(WithClientID("cc"), WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))))
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	for _, id := range []string{"cmd-1", "cmd-2"} {
+		if err := srv.SendControl(&protocol.ControlCommand{CommandID: id, VehicleID: "car-001", Action: protocol.ActionStop}); err != nil {
+			t.Fatalf("SendControl: %v", err)
+		}
+	}
+	if n := len(rec.Started()); n != 2 {
+		t.Fatalf("started %d spans, want one per command", n)
+	}
+	if n := len(rec.Ended()); n != 0 {
+		t.Fatalf("%d spans ended before their acks", n)
+	}
+
+	var sent protocol.ControlCommand
+	protocol.Unmarshal(mc.published[0].payload, &sent)
+	first := rec.Started()[0]
+	if want := tracing.TraceParent(trace.ContextWithSpanContext(context.Background(), first.SpanContext())); sent.TraceParent != want {
+		t.Errorf("command TraceParent = %q, want span context %q", sent.TraceParent, want)
+	}
+
+	data, _ := protocol.Marshal(&protocol.CommandAck{CommandID: "cmd-1", VehicleID: "car-001", Status: protocol.AckCompleted})
+	mc.handlers[protocol.WildcardAckTopic()](mc, &mockMessage{topic: protocol.AckTopic("car-001"), payload: data})
+
+	ended := rec.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("ended %d spans, want the acked command's", len(ended))
+	}
+	if got := spanAttr(ended[0], "vlink.command_id"); got != "cmd-1" {
+		t.Errorf("ended span for command %q, want cmd-1", got)
+	}
+	if got := spanAttr(ended[0], "vlink.ack.status"); got != protocol.AckCompleted {
+		t.Errorf("vlink.ack.status = %q, want %q", got, protocol.AckCompleted)
+	}
+}
+
+func TestUntracedCommandsCarryNoTraceParent(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	if err := srv.SendControl(&protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: protocol.ActionStop}); err != nil {
+		t.Fatalf("SendControl: %v", err)
+	}
+	var sent protocol.ControlCommand
+	protocol.Unmarshal(mc.published[0].payload, &sent)
+	if sent.TraceParent != "" {
+		t.Errorf("TraceParent = %q with the no-op default tracer, want empty", sent.TraceParent)
+	}
+}
@@ -0,0 +1,59 @@
+package controlcenter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// SendTransaction publishes cmds in order, each at QoS 1. If a publish fails,
+// every command already sent is compensated with an ActionCancel command, in
+// reverse order, and the publish error is returned.
+//
+// This is best effort only: MQTT offers no atomic multi-message delivery, so
+// a vehicle may act on a command before its cancel arrives, only commands
+// running as vehicle tasks can be interrupted (others have their cancel
+// rejected), and a cancel can itself fail to publish (reported in the
+// returned error). Commands without a CommandID are assigned one so that
+// they can be cancelled.
+func (s *Server) SendTransaction(cmds []*protocol.ControlCommand) error {
+	for i, cmd := range cmds {
+		if cmd.CommandID == "" {
+			cmd.CommandID = newCommandID()
+		}
+		if err := s.SendControl(cmd); err != nil {
+			err = fmt.Errorf("control-center transaction: command %d (%s) to %s: %w", i, cmd.Action, cmd.VehicleID, err)
+			return errors.Join(err, s.compensate(cmds[:i]))
+		}
+	}
+	return nil
+}
+
+// compensate sends a cancel for each of sent, newest first.
+func (s *Server) compensate(sent []*protocol.ControlCommand) error {
+	var errs []error
+	for i := len(sent) - 1; i >= 0; i-- {
+		orig := sent[i]
+		payload, err := protocol.Marshal(protocol.CancelPayload{CommandID: orig.CommandID})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		cancel := &protocol.ControlCommand{
+			CommandID: newCommandID(),
+			VehicleID: orig.VehicleID,
+			Action:    protocol.ActionCancel,
+			Payload:   string(payload),
+		}
+		if err := s.SendControl(cancel); err != nil {
+			errs = append(errs, fmt.Errorf("control-center transaction: cancel %s: %w", orig.CommandID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newCommandID returns a fresh CommandID.
+func newCommandID() string {
+	return protocol.NewID()
+}
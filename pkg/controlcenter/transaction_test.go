@@ -0,0 +1,71 @@
+package controlcenter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestSendTransactionCompensatesOnFailure(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	errBroker := errors.New("broker unavailable")
+	attempts := 0
+	mc.publishErr = func(string, []byte) error {
+		attempts++
+		if attempts == 2 {
+			return errBroker
+		}
+		return nil
+	}
+
+	cmds := []*protocol.ControlCommand{
+		{CommandID: "cmd-stop", VehicleID: "car-001", Action: protocol.ActionStop},
+		{CommandID: "cmd-reroute", VehicleID: "car-001", Action: "reroute"},
+	}
+	err := srv.SendTransaction(cmds)
+	if !errors.Is(err, errBroker) {
+		t.Fatalf("SendTransaction error = %v, want %v", err, errBroker)
+	}
+
+	if len(mc.published) != 2 {
+		t.Fatalf("published %d messages, want stop + cancel", len(mc.published))
+	}
+	var cancel protocol.ControlCommand
+	if err := protocol.Unmarshal(mc.published[1].payload, &cancel); err != nil {
+		t.Fatalf("decode cancel: %v", err)
+	}
+	if cancel.Action != protocol.ActionCancel || cancel.VehicleID != "car-001" {
+		t.Errorf("compensation = %s to %s, want cancel to car-001", cancel.Action, cancel.VehicleID)
+	}
+	var p protocol.CancelPayload
+	if err := protocol.Unmarshal([]byte(cancel.Payload), &p); err != nil {
+		t.Fatalf("decode cancel payload: %v", err)
+	}
+	if p.CommandID != "cmd-stop" {
+		t.Errorf("cancelled command = %q, want cmd-stop", p.CommandID)
+	}
+}
+
+func TestSendTransactionAssignsCommandIDs(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+
+	cmds := []*protocol.ControlCommand{
+		{VehicleID: "car-001", Action: protocol.ActionStop},
+		{VehicleID: "car-001", Action: protocol.ActionResume},
+	}
+	if err := srv.SendTransaction(cmds); err != nil {
+		t.Fatalf("SendTransaction: %v", err)
+	}
+	if cmds[0].CommandID == "" || cmds[0].CommandID == cmds[1].CommandID {
+		t.Errorf("CommandIDs = %q, %q; want unique non-empty IDs", cmds[0].CommandID, cmds[1].CommandID)
+	}
+	if len(mc.published) != 2 {
+		t.Errorf("published %d messages, want 2", len(mc.published))
+	}
+}
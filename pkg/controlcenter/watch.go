@@ -0,0 +1,172 @@
+package controlcenter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// watches counts the WatchVehicle calls not yet matched by Unwatch, per
+// canonical vehicle ID.
+type watches struct {
+	mu    sync.Mutex
+	count map[string]*watch
+}
+
+// watch is one watched vehicle.
+type watch struct {
+	id string // as it appears in the vehicle's topics
+	n  int
+}
+
+func newWatches() *watches {
+	return &watches{count: make(map[string]*watch)}
+}
+
+// release ends one watch of the vehicle keyed key and returns its topic ID,
+// reporting whether it was watched and whether that was its last watch.
+func (w *watches) release(key string) (id string, watched, last bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wt, ok := w.count[key]
+	if !ok {
+		return "", false, false
+	}
+	wt.n--
+	if wt.n > 0 {
+		return wt.id, true, false
+	}
+	delete(w.count, key)
+	return wt.id, true, true
+}
+
+// WatchVehicle makes the server receive vehicleID's states and alerts. With
+// Config.WatchOnly the server subscribes to nothing but the watched
+// vehicles' state and alert topics, so a dashboard or debugging tool that
+// follows a few vehicles is not sent the whole fleet's traffic; otherwise
+// the wildcard subscriptions already cover every vehicle and WatchVehicle
+// only records the watch, so no message is handled twice.
+//
+// Watches are counted: each call must be matched by a call to Unwatch, and
+// the topics are unsubscribed only when the last watcher of a vehicle is
+// gone. Watches made before Connect, or while the connection is down, are
+// subscribed when it comes up. IDs are matched after shadow.CanonicalID;
+// the topics subscribed are those of the ID the vehicle is known by in the
+// shadow, or vehicleID as given for a vehicle not seen yet.
+func (s *Server) WatchVehicle(vehicleID string) error {
+	if vehicleID == "" {
+		return errors.New("control-center: watch requires a vehicle ID")
+	}
+	key := shadow.CanonicalID(vehicleID)
+	w := s.watches
+	w.mu.Lock()
+	wt, ok := w.count[key]
+	if !ok {
+		wt = &watch{id: s.topicID(vehicleID)}
+		w.count[key] = wt
+	}
+	wt.n++
+	first, id := wt.n == 1, wt.id
+	w.mu.Unlock()
+
+	// Subscribe without holding w.mu: waiting for the broker under it could
+	// deadlock against subscribeWatched on the connect callback.
+	if !first || !s.watchSubscriptions() {
+		return nil
+	}
+	if err := s.subscribeWatch(s.client, id); err != nil {
+		w.release(key)
+		s.unsubscribeWatch(id)
+		return fmt.Errorf("control-center: watch %s: %w", vehicleID, err)
+	}
+	return nil
+}
+
+// topicID returns the ID vehicleID's topics are built from: the one its
+// shadow state carries, if any, else vehicleID itself.
+func (s *Server) topicID(vehicleID string) string {
+	if e, ok := s.shadows.Get(vehicleID); ok {
+		return e.State.VehicleID
+	}
+	return vehicleID
+}
+
+// Unwatch ends one WatchVehicle call for vehicleID. When no watcher
+// remains, the server unsubscribes from the vehicle's topics in WatchOnly
+// mode. Unwatching a vehicle that is not watched does nothing.
+func (s *Server) Unwatch(vehicleID string) error {
+	id, watched, last := s.watches.release(shadow.CanonicalID(vehicleID))
+	if !watched || !last || !s.watchSubscriptions() {
+		return nil
+	}
+	if err := s.unsubscribeWatch(id); err != nil {
+		return fmt.Errorf("control-center: unwatch %s: %w", vehicleID, err)
+	}
+	return nil
+}
+
+// Watched returns the IDs of the vehicles currently watched, as their
+// topics spell them, sorted.
+func (s *Server) Watched() []string {
+	w := s.watches
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ids := make([]string, 0, len(w.count))
+	for _, wt := range w.count {
+		ids = append(ids, wt.id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// watchSubscriptions reports whether watches should be subscribed now: in
+// WatchOnly mode with an open connection. Otherwise subscribeTopics takes
+// care of them when the connection comes up.
+func (s *Server) watchSubscriptions() bool {
+	return s.cfg.WatchOnly && s.client != nil && s.client.IsConnectionOpen()
+}
+
+// subscribeWatched subscribes c to the topics of every watched vehicle. It
+// is called by subscribeTopics in WatchOnly mode.
+func (s *Server) subscribeWatched(c mqtt.Client) {
+	for _, id := range s.Watched() {
+		if err := s.subscribeWatch(c, id); err != nil {
+			s.log.Error("watch", "vehicle_id", id, "err", err)
+		}
+	}
+}
+
+// subscribeWatch subscribes c to vehicleID's state and alert topics under
+// every prefix.
+func (s *Server) subscribeWatch(c mqtt.Client, vehicleID string) error {
+	var errs []error
+	for _, t := range s.topics {
+		topics := []string{t.State(vehicleID), t.Alert(vehicleID)}
+		qos := []byte{protocol.QoSOr(s.cfg.StateQoS, 1), protocol.QoSOr(s.cfg.AlertQoS, 1)}
+		for i, topic := range topics {
+			token := c.Subscribe(topic, qos[i], s.route)
+			token.Wait()
+			if err := token.Error(); err != nil {
+				errs = append(errs, fmt.Errorf("subscribe %s: %w", topic, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unsubscribeWatch undoes subscribeWatch.
+func (s *Server) unsubscribeWatch(vehicleID string) error {
+	var topics []string
+	for _, t := range s.topics {
+		topics = append(topics, t.State(vehicleID), t.Alert(vehicleID))
+	}
+	token := s.client.Unsubscribe(topics...)
+	token.Wait()
+	return token.Error()
+}
@@ -0,0 +1,160 @@
+package controlcenter
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestWatchVehicleRefcountsSubscriptions(t *testing.T) {
+	srv := New(Config{ClientID: "cc", WatchOnly: true})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	if mc.handlers[protocol.WildcardStateTopic()] != nil || mc.handlers[protocol.WildcardAlertTopic()] != nil {
+		t.Fatal("WatchOnly server subscribed to the wildcard state or alert topic")
+	}
+	if mc.handlers[protocol.DefaultTopics.WildcardAck()] == nil {
+		t.Error("WatchOnly server did not subscribe to acks")
+	}
+
+	before := len(mc.subscribed)
+	for range 2 {
+		if err := srv.WatchVehicle("car-001"); err != nil {
+			t.Fatalf("WatchVehicle: %v", err)
+		}
+	}
+	want := []string{protocol.StateTopic("car-001"), protocol.AlertTopic("car-001")}
+	if got := mc.subscribed[before:]; !slices.Equal(got, want) {
+		t.Fatalf("subscribed %v, want %v once", got, want)
+	}
+
+	data, _ := protocol.Marshal(&protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli()})
+	mc.handlers[protocol.StateTopic("car-001")](mc, &mockMessage{topic: protocol.StateTopic("car-001"), payload: data})
+	if _, ok := srv.Shadows().Get("car-001"); !ok {
+		t.Error("state on the watched topic did not reach the shadow")
+	}
+
+	if err := srv.Unwatch("car-001"); err != nil {
+		t.Fatal(err)
+	}
+	if len(mc.unsubscribed) != 0 {
+		t.Fatalf("unsubscribed %v while a watcher remains", mc.unsubscribed)
+	}
+	if err := srv.Unwatch("car-001"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(mc.unsubscribed, want) {
+		t.Errorf("unsubscribed %v, want %v", mc.unsubscribed, want)
+	}
+	if w := srv.Watched(); len(w) != 0 {
+		t.Errorf("Watched() = %v after the last Unwatch", w)
+	}
+	if err := srv.Unwatch("car-001"); err != nil || len(mc.unsubscribed) != len(want) {
+		t.Errorf("extra Unwatch: err = %v, unsubscribed %v", err, mc.unsubscribed)
+	}
+}
+
+func TestWatchVehicleBeforeConnect(t *testing.T) {
+	srv := New(Config{ClientID: "cc", WatchOnly: true})
+	if err := srv.WatchVehicle("car-002"); err != nil {
+		t.Fatal(err)
+	}
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	if mc.handlers[protocol.StateTopic("car-002")] == nil || mc.handlers[protocol.AlertTopic("car-002")] == nil {
+		t.Errorf("subscribed %v, want car-002's state and alert topics", mc.subscribed)
+	}
+}
+
+func TestWatchVehicleComposesWithWildcard(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	before := len(mc.subscribed)
+	if err := srv.WatchVehicle("car-001"); err != nil {
+		t.Fatal(err)
+	}
+	if got := mc.subscribed[before:]; len(got) != 0 {
+		t.Fatalf("subscribed %v although the wildcard covers the vehicle", got)
+	}
+	if w := srv.Watched(); !slices.Equal(w, []string{"car-001"}) {
+		t.Errorf("Watched() = %v", w)
+	}
+	if err := srv.Unwatch("car-001"); err != nil || len(mc.unsubscribed) != 0 {
+		t.Errorf("Unwatch: err = %v, unsubscribed %v", err, mc.unsubscribed)
+	}
+}
+
+func TestWatchVehicleRequiresID(t *testing.T) {
+	srv := New(Config{ClientID: "cc", WatchOnly: true})
+	if err := srv.WatchVehicle(""); err == nil {
+		t.Error("WatchVehicle accepted an empty ID")
+	}
+}
+
+func TestWatchVehicleMatchesCanonicalID(t *testing.T) {
+	srv := New(Config{ClientID: "cc", WatchOnly: true})
+	mc := newMockClient()
+	srv.ConnectWithClient(mc)
+	before := len(mc.subscribed)
+	for _, id := range []string{"Car-007", " car-007 "} {
+		if err := srv.WatchVehicle(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{protocol.StateTopic("Car-007"), protocol.AlertTopic("Car-007")}
+	if got := mc.subscribed[before:]; !slices.Equal(got, want) {
+		t.Fatalf("subscribed %v, want %v once", got, want)
+	}
+	if w := srv.Watched(); !slices.Equal(w, []string{"Car-007"}) {
+		t.Errorf("Watched() = %v, want [Car-007]", w)
+	}
+	for range 2 {
+		if err := srv.Unwatch("CAR-007"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(mc.unsubscribed, want) {
+		t.Errorf("unsubscribed %v, want %v", mc.unsubscribed, want)
+	}
+}
+
+// reentrantClient calls back into the server from Subscribe, as a broker
+// round trip may while the connect callback resubscribes.
+type reentrantClient struct {
+	*mockClient
+	srv *Server
+}
+
+func (c *reentrantClient) Subscribe(topic string, qos byte, h mqtt.MessageHandler) mqtt.Token {
+	c.srv.Watched()
+	return c.mockClient.Subscribe(topic, qos, h)
+}
+
+func TestWatchVehicleSubscribesWithoutLock(t *testing.T) {
+	srv := New(Config{ClientID: "cc", WatchOnly: true})
+	if err := srv.WatchVehicle("car-001"); err != nil {
+		t.Fatal(err)
+	}
+	mc := &reentrantClient{mockClient: newMockClient(), srv: srv}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.ConnectWithClient(mc)
+		if err := srv.WatchVehicle("car-002"); err != nil {
+			t.Error(err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscribing deadlocked on the watch lock")
+	}
+	if mc.handlers[protocol.StateTopic("car-001")] == nil || mc.handlers[protocol.StateTopic("car-002")] == nil {
+		t.Errorf("subscribed %v, want both watched vehicles", mc.subscribed)
+	}
+}
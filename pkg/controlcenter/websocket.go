@@ -0,0 +1,209 @@
+package controlcenter
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+	"github.com/daohu527/vlink/pkg/teleoperation"
+)
+
+const (
+	// wsBuffer is the number of updates buffered per WebSocket client.
+	wsBuffer = 64
+	// wsWriteTimeout bounds each write to a WebSocket client.
+	wsWriteTimeout = 10 * time.Second
+)
+
+// WebSocket message types.
+const (
+	WebSocketSnapshot = "snapshot"
+	WebSocketUpdate   = "update"
+)
+
+// WebSocketMessage is a frame sent by WebSocketHandler. The first frame of
+// a connection is a snapshot listing every matching vehicle; every later one
+// is an update carrying one vehicle's new state.
+type WebSocketMessage struct {
+	Type     string                 `json:"type"`
+	Vehicles []VehicleResponse      `json:"vehicles,omitempty"` // snapshot, sorted by vehicle ID; absent when empty
+	State    *protocol.VehicleState `json:"state,omitempty"`    // update
+}
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+// webSockets tracks open WebSocket connections so that they can be closed
+// with the HTTP server, which does not close hijacked connections itself.
+type webSockets struct {
+	mu    sync.Mutex
+	conns map[*websocket.Conn]struct{}
+}
+
+func newWebSockets() *webSockets {
+	return &webSockets{conns: make(map[*websocket.Conn]struct{})}
+}
+
+func (w *webSockets) add(c *websocket.Conn) {
+	w.mu.Lock()
+	w.conns[c] = struct{}{}
+	w.mu.Unlock()
+}
+
+func (w *webSockets) remove(c *websocket.Conn) {
+	w.mu.Lock()
+	delete(w.conns, c)
+	w.mu.Unlock()
+}
+
+// closeAll closes every open connection, ending its handler.
+func (w *webSockets) closeAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for c := range w.conns {
+		_ = c.Close()
+	}
+}
+
+// streamFilter selects the vehicles a WebSocket client asked for.
+type streamFilter struct {
+	ids map[string]bool            // canonical IDs; nil matches every vehicle
+	box *teleoperation.BoundingBox // nil matches every position
+}
+
+// parseStreamFilter reads the vehicle_id and bbox query parameters.
+func parseStreamFilter(r *http.Request) (streamFilter, error) {
+	var f streamFilter
+	q := r.URL.Query()
+	for _, v := range q["vehicle_id"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				if f.ids == nil {
+					f.ids = make(map[string]bool)
+				}
+				f.ids[shadow.CanonicalID(id)] = true
+			}
+		}
+	}
+	if v := q.Get("bbox"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) != 4 {
+			return f, fmt.Errorf("bad bbox %q: want min_lat,min_lon,max_lat,max_lon", v)
+		}
+		var c [4]float64
+		for i, p := range parts {
+			x, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return f, fmt.Errorf("bad bbox %q: %v", v, err)
+			}
+			c[i] = x
+		}
+		if c[0] > c[2] {
+			return f, fmt.Errorf("bad bbox %q: min_lat above max_lat", v)
+		}
+		f.box = &teleoperation.BoundingBox{MinLat: c[0], MinLon: c[1], MaxLat: c[2], MaxLon: c[3]}
+	}
+	return f, nil
+}
+
+func (f streamFilter) match(state *protocol.VehicleState) bool {
+	if f.ids != nil && !f.ids[shadow.CanonicalID(state.VehicleID)] {
+		return false
+	}
+	return f.box == nil || f.box.Contains(state.Latitude, state.Longitude)
+}
+
+// WebSocketHandler returns an http.Handler that pushes the fleet's state to
+// dashboards over a WebSocket, intended to be mounted at /stream. A client
+// first receives a snapshot of every vehicle in the shadow and then an
+// update frame (see WebSocketMessage) whenever a vehicle's state changes.
+// The vehicle_id query parameter, repeated or comma-separated, restricts the
+// stream to those vehicles, matched after shadow.CanonicalID, and
+// bbox=min_lat,min_lon,max_lat,max_lon to vehicles inside the box (a box
+// with min_lon above max_lon spans the antimeridian).
+//
+// Updates are queued for at most 64 frames per client; a client too slow to
+// keep up misses updates rather than stalling the shadow, and catches up
+// with the vehicle's next one, since every update carries the full state.
+// The connection's goroutines end when the client goes away, a write stalls
+// for 10 seconds, or the server disconnects.
+func (s *Server) WebSocketHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseStreamFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return // Upgrade has replied with an error
+		}
+		s.sockets.add(conn)
+		defer s.sockets.remove(conn)
+		defer conn.Close()
+
+		// Subscribe before taking the snapshot so that no update falls
+		// between the two; one may be sent in both.
+		id, updates := s.hub.subscribe(wsBuffer)
+		defer s.hub.unsubscribe(id)
+
+		// The reader discards client frames, answers pings and notices the
+		// client going away.
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		snapshot := WebSocketMessage{Type: WebSocketSnapshot}
+		for _, e := range s.shadows.All() {
+			if filter.match(e.State) {
+				snapshot.Vehicles = append(snapshot.Vehicles, responseOf(e))
+			}
+		}
+		sort.Slice(snapshot.Vehicles, func(i, j int) bool {
+			return snapshot.Vehicles[i].State.VehicleID < snapshot.Vehicles[j].State.VehicleID
+		})
+		if err := writeFrame(conn, snapshot); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(s.sseHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-gone:
+				return
+			case <-heartbeat.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+					return
+				}
+			case state := <-updates:
+				if !filter.match(state) {
+					continue
+				}
+				if err := writeFrame(conn, WebSocketMessage{Type: WebSocketUpdate, State: state}); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+func writeFrame(conn *websocket.Conn, m WebSocketMessage) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	return conn.WriteJSON(m)
+}
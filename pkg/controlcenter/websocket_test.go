@@ -0,0 +1,142 @@
+package controlcenter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// dialStream connects a WebSocket client to ts with the given query.
+func dialStream(t *testing.T, ts *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/stream" + query
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) WebSocketMessage {
+	t.Helper()
+	var m WebSocketMessage
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&m); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	return m
+}
+
+func TestWebSocketSendsSnapshotThenUpdates(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	now := time.Now().UnixMilli()
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: now, Latitude: 39.9})
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now, Latitude: 39.9})
+	ts := httptest.NewServer(srv.WebSocketHandler())
+	defer ts.Close()
+
+	conn := dialStream(t, ts, "")
+	snap := readFrame(t, conn)
+	if snap.Type != WebSocketSnapshot || len(snap.Vehicles) != 2 ||
+		snap.Vehicles[0].State.VehicleID != "car-001" || snap.Vehicles[1].Version != 1 {
+		t.Fatalf("snapshot = %+v, want car-001 and car-002", snap)
+	}
+
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: now + 100, Speed: 4})
+	update := readFrame(t, conn)
+	if update.Type != WebSocketUpdate || update.State == nil || update.State.VehicleID != "car-002" || update.State.Speed != 4 {
+		t.Errorf("update = %+v", update)
+	}
+}
+
+func TestWebSocketFilters(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	now := time.Now().UnixMilli()
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now, Latitude: 39.9, Longitude: 116.4})
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: now, Latitude: 31.2, Longitude: 121.5})
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-003", Timestamp: now, Latitude: 39.8, Longitude: 116.3})
+	ts := httptest.NewServer(srv.WebSocketHandler())
+	defer ts.Close()
+
+	// IDs match after canonicalisation, like shadow lookups.
+	byID := dialStream(t, ts, "?vehicle_id=CAR-002,Car-003")
+	if snap := readFrame(t, byID); len(snap.Vehicles) != 2 || snap.Vehicles[0].State.VehicleID != "car-002" {
+		t.Errorf("vehicle_id snapshot = %+v", snap.Vehicles)
+	}
+	inBox := dialStream(t, ts, "?bbox=39,116,41,117")
+	if snap := readFrame(t, inBox); len(snap.Vehicles) != 2 || snap.Vehicles[1].State.VehicleID != "car-003" {
+		t.Errorf("bbox snapshot = %+v", snap.Vehicles)
+	}
+
+	// car-001 leaves the box, then car-003 moves within it: only the
+	// latter reaches the bbox client.
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now + 100, Latitude: 31, Longitude: 121})
+	srv.Shadows().Update(&protocol.VehicleState{VehicleID: "car-003", Timestamp: now + 100, Latitude: 39.7, Longitude: 116.3})
+	if m := readFrame(t, inBox); m.State == nil || m.State.VehicleID != "car-003" {
+		t.Errorf("bbox update = %+v, want car-003", m)
+	}
+	if m := readFrame(t, byID); m.State == nil || m.State.VehicleID != "car-003" {
+		t.Errorf("vehicle_id update = %+v, want car-003", m)
+	}
+}
+
+func TestWebSocketRejectsBadBBox(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	ts := httptest.NewServer(srv.WebSocketHandler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/stream?bbox=1,2,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestWebSocketCleansUpOnDisconnect(t *testing.T) {
+	srv := New(Config{ClientID: "cc"})
+	ts := httptest.NewServer(srv.WebSocketHandler())
+	defer ts.Close()
+
+	subscribers := func() int {
+		srv.hub.mu.Lock()
+		defer srv.hub.mu.Unlock()
+		return len(srv.hub.subs)
+	}
+	waitFor := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for subscribers() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d hub subscribers, want %d", subscribers(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	client := dialStream(t, ts, "")
+	readFrame(t, client)
+	waitFor(1)
+	client.Close()
+	waitFor(0)
+
+	// Disconnect closes connections the HTTP server no longer tracks.
+	client = dialStream(t, ts, "")
+	readFrame(t, client)
+	srv.Disconnect()
+	waitFor(0)
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := client.ReadMessage(); err == nil {
+		t.Error("connection still open after Disconnect")
+	}
+}
@@ -0,0 +1,222 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v5.29.3
+// source: fleet.proto
+
+package fleetpb
+
+import (
+	vlinkpb "github.com/daohu527/vlink/pkg/vlinkpb"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// FleetSnapshot is the control center's shadow of every tracked vehicle at
+// one instant, exported for analytics consumers.
+type FleetSnapshot struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     int64                  `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // Unix milliseconds, center clock
+	Vehicles      []*ShadowEntry         `protobuf:"bytes,2,rep,name=vehicles,proto3" json:"vehicles,omitempty"`    // sorted by state.vehicle_id
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FleetSnapshot) Reset() {
+	*x = FleetSnapshot{}
+	mi := &file_fleet_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FleetSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FleetSnapshot) ProtoMessage() {}
+
+func (x *FleetSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_fleet_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FleetSnapshot.ProtoReflect.Descriptor instead.
+func (*FleetSnapshot) Descriptor() ([]byte, []int) {
+	return file_fleet_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FleetSnapshot) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *FleetSnapshot) GetVehicles() []*ShadowEntry {
+	if x != nil {
+		return x.Vehicles
+	}
+	return nil
+}
+
+// ShadowEntry is one vehicle's shadow.
+type ShadowEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	State         *vlinkpb.VehicleState  `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	UpdatedAt     int64                  `protobuf:"varint,2,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"` // Unix milliseconds, center clock
+	Version       uint64                 `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`                      // incremented on every applied write
+	Stale         bool                   `protobuf:"varint,4,opt,name=stale,proto3" json:"stale,omitempty"`                          // known to be outdated
+	Online        bool                   `protobuf:"varint,5,opt,name=online,proto3" json:"online,omitempty"`                        // connected, per the vehicle's status topic
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShadowEntry) Reset() {
+	*x = ShadowEntry{}
+	mi := &file_fleet_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShadowEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShadowEntry) ProtoMessage() {}
+
+func (x *ShadowEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_fleet_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShadowEntry.ProtoReflect.Descriptor instead.
+func (*ShadowEntry) Descriptor() ([]byte, []int) {
+	return file_fleet_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ShadowEntry) GetState() *vlinkpb.VehicleState {
+	if x != nil {
+		return x.State
+	}
+	return nil
+}
+
+func (x *ShadowEntry) GetUpdatedAt() int64 {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return 0
+}
+
+func (x *ShadowEntry) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *ShadowEntry) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
+}
+
+func (x *ShadowEntry) GetOnline() bool {
+	if x != nil {
+		return x.Online
+	}
+	return false
+}
+
+var File_fleet_proto protoreflect.FileDescriptor
+
+const file_fleet_proto_rawDesc = "" +
+	"\n" +
+	"\vfleet.proto\x12\x05vlink\x1a\vvlink.proto\"]\n" +
+	"\rFleetSnapshot\x12\x1c\n" +
+	"\ttimestamp\x18\x01 \x01(\x03R\ttimestamp\x12.\n" +
+	"\bvehicles\x18\x02 \x03(\v2\x12.vlink.ShadowEntryR\bvehicles\"\x9f\x01\n" +
+	"\vShadowEntry\x12)\n" +
+	"\x05state\x18\x01 \x01(\v2\x13.vlink.VehicleStateR\x05state\x12\x1d\n" +
+	"\n" +
+	"updated_at\x18\x02 \x01(\x03R\tupdatedAt\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x04R\aversion\x12\x14\n" +
+	"\x05stale\x18\x04 \x01(\bR\x05stale\x12\x16\n" +
+	"\x06online\x18\x05 \x01(\bR\x06onlineB'Z%github.com/daohu527/vlink/pkg/fleetpbb\x06proto3"
+
+var (
+	file_fleet_proto_rawDescOnce sync.Once
+	file_fleet_proto_rawDescData []byte
+)
+
+func file_fleet_proto_rawDescGZIP() []byte {
+	file_fleet_proto_rawDescOnce.Do(func() {
+		file_fleet_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_fleet_proto_rawDesc), len(file_fleet_proto_rawDesc)))
+	})
+	return file_fleet_proto_rawDescData
+}
+
+var file_fleet_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_fleet_proto_goTypes = []any{
+	(*FleetSnapshot)(nil),        // 0: vlink.FleetSnapshot
+	(*ShadowEntry)(nil),          // 1: vlink.ShadowEntry
+	(*vlinkpb.VehicleState)(nil), // 2: vlink.VehicleState
+}
+var file_fleet_proto_depIdxs = []int32{
+	1, // 0: vlink.FleetSnapshot.vehicles:type_name -> vlink.ShadowEntry
+	2, // 1: vlink.ShadowEntry.state:type_name -> vlink.VehicleState
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_fleet_proto_init() }
+func file_fleet_proto_init() {
+	if File_fleet_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_fleet_proto_rawDesc), len(file_fleet_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_fleet_proto_goTypes,
+		DependencyIndexes: file_fleet_proto_depIdxs,
+		MessageInfos:      file_fleet_proto_msgTypes,
+	}.Build()
+	File_fleet_proto = out.File
+	file_fleet_proto_goTypes = nil
+	file_fleet_proto_depIdxs = nil
+}
@@ -0,0 +1,61 @@
+// Package fleetpb encodes the control center's shadow as the FleetSnapshot
+// protobuf message defined in proto/fleet.proto, for gRPC and other
+// protobuf-based consumers. It depends only on the shadow and protocol
+// packages, not on MQTT. The messages are generated by protoc-gen-go into
+// fleet.pb.go; encode and decode them with the proto package.
+package fleetpb
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/daohu527/vlink fleet.proto
+
+import (
+	"sort"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+// FromEntries builds a snapshot of entries, as returned by
+// shadow.Manager.All, taken at the given time and sorted by vehicle ID.
+func FromEntries(entries map[string]*shadow.Entry, at time.Time) *FleetSnapshot {
+	s := &FleetSnapshot{Timestamp: at.UnixMilli(), Vehicles: make([]*ShadowEntry, 0, len(entries))}
+	for _, e := range entries {
+		s.Vehicles = append(s.Vehicles, FromEntry(e))
+	}
+	sort.Slice(s.Vehicles, func(i, j int) bool {
+		return s.Vehicles[i].GetState().GetVehicleId() < s.Vehicles[j].GetState().GetVehicleId()
+	})
+	return s
+}
+
+// FromEntry converts one shadow entry.
+func FromEntry(e *shadow.Entry) *ShadowEntry {
+	pb := &ShadowEntry{
+		UpdatedAt: e.UpdatedAt.UnixMilli(),
+		Version:   e.Version,
+		Stale:     e.Stale,
+		Online:    e.Online,
+	}
+	if e.State != nil {
+		pb.State = protocol.StateToProto(e.State)
+	}
+	return pb
+}
+
+// Entries converts the snapshot back to shadow entries keyed by vehicle ID.
+func (s *FleetSnapshot) Entries() map[string]*shadow.Entry {
+	out := make(map[string]*shadow.Entry, len(s.GetVehicles()))
+	for _, v := range s.GetVehicles() {
+		e := &shadow.Entry{
+			UpdatedAt: time.UnixMilli(v.GetUpdatedAt()),
+			Version:   v.GetVersion(),
+			Stale:     v.GetStale(),
+			Online:    v.GetOnline(),
+		}
+		if v.GetState() != nil {
+			e.State = protocol.StateFromProto(v.GetState())
+		}
+		out[v.GetState().GetVehicleId()] = e
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package fleetpb
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/shadow"
+)
+
+func TestMarshalMatchesProtoFieldNumbers(t *testing.T) {
+	// The protobuf encoding of
+	//   FleetSnapshot{timestamp: 5, vehicles: [{state: {vehicle_id: "a", gear: GEAR_DRIVE}, version: 2}]}
+	want := "\x08\x05" + // timestamp = 5
+		"\x12\x09" + // vehicles, 9 bytes
+		"\x0a\x05" + // state, 5 bytes
+		"\x0a\x01a" + // vehicle_id = "a"
+		"\x40\x02" + // gear = 2
+		"\x18\x02" // version = 2
+	snap := &FleetSnapshot{Timestamp: 5, Vehicles: []*ShadowEntry{{
+		State:   protocol.StateToProto(&protocol.VehicleState{VehicleID: "a", Gear: protocol.GearDrive}),
+		Version: 2,
+	}}}
+	got, err := proto.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Marshal = %x, want %x", got, want)
+	}
+}
+
+func TestEntriesRoundTrip(t *testing.T) {
+	at := time.UnixMilli(1_700_000_000_000)
+	state := &protocol.VehicleState{VehicleID: "car-001", Speed: 3, Sensors: protocol.SensorHealth{GPS: protocol.SensorDegraded}}
+	snap := FromEntries(map[string]*shadow.Entry{
+		"car-001": {State: state, UpdatedAt: at, Version: 7, Online: true},
+	}, at)
+	data, err := proto.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got FleetSnapshot
+	if err := proto.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	e := got.Entries()["car-001"]
+	if got.Timestamp != at.UnixMilli() || e == nil || *e.State != *state || e.Version != 7 || !e.Online || !e.UpdatedAt.Equal(at) {
+		t.Errorf("decoded = %+v", e)
+	}
+}
@@ -0,0 +1,160 @@
+// Package geofence describes permitted operating areas as polygons in WGS84
+// degrees and tests positions against them.
+package geofence
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// boundaryEpsilon is how close, in degrees (about 0.1 mm), a point must be
+// to an edge to count as on the boundary.
+const boundaryEpsilon = 1e-9
+
+// minArea is the smallest area, in square degrees (a square about 10 cm
+// across), a fence may enclose; anything less is treated as degenerate,
+// e.g. collinear vertices.
+const minArea = 1e-12
+
+// Point is a WGS84 position in degrees.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Polygon is a fence given by its vertices in order, clockwise or not. The
+// ring closes implicitly; repeating the first vertex at the end is allowed.
+// Edges are straight lines in latitude/longitude, which is accurate enough
+// for fences of city scale. An edge may cross the antimeridian, taking the
+// shorter way round, but the polygon must not enclose a pole.
+type Polygon []Point
+
+// Validate reports why p cannot serve as a fence: a coordinate off the
+// globe, fewer than three distinct vertices, or no area.
+func (p Polygon) Validate() error {
+	_, err := p.Compile()
+	return err
+}
+
+// Contains reports whether (lat, lon) lies inside p, boundary included. A
+// polygon that fails Validate contains nothing. Contains validates p on
+// every call; use Compile for a fence tested repeatedly.
+func (p Polygon) Contains(lat, lon float64) bool {
+	f, err := p.Compile()
+	return err == nil && f.Contains(lat, lon)
+}
+
+// Fence is a Polygon validated and prepared once by Compile, for testing
+// many positions against it.
+type Fence struct {
+	ring []Point
+}
+
+// Compile validates p and returns it as a Fence, or the reason p cannot
+// serve as one (see Validate).
+func (p Polygon) Compile() (*Fence, error) {
+	for i, v := range p {
+		if !(v.Lat >= -90 && v.Lat <= 90) || !(v.Lon >= -180 && v.Lon <= 180) {
+			return nil, fmt.Errorf("geofence: vertex %d (%v, %v) is not on the globe", i, v.Lat, v.Lon)
+		}
+	}
+	ring := p.ring()
+	if len(ring) < 3 {
+		return nil, errors.New("geofence: polygon needs at least three distinct vertices")
+	}
+	if math.Abs(area(ring)) < minArea {
+		return nil, errors.New("geofence: polygon has no area")
+	}
+	return &Fence{ring: ring}, nil
+}
+
+// Contains reports whether (lat, lon) lies inside f, boundary included.
+func (f *Fence) Contains(lat, lon float64) bool {
+	if math.IsNaN(lat) || math.IsNaN(lon) || math.IsInf(lon, 0) {
+		return false
+	}
+	lon = normalize(lon)
+	// The ring is unwrapped around its first vertex and may extend past
+	// ±180°, so try the point in each of the copies it could fall into.
+	for _, x := range []float64{lon, lon + 360, lon - 360} {
+		if inRing(f.ring, x, lat) {
+			return true
+		}
+	}
+	return false
+}
+
+// ring returns the distinct vertices of p with longitudes unwrapped so that
+// consecutive vertices are never more than 180° apart, which turns an edge
+// across the antimeridian into an ordinary one.
+func (p Polygon) ring() []Point {
+	var ring []Point
+	for _, v := range p {
+		if len(ring) > 0 {
+			prev := ring[len(ring)-1]
+			v.Lon = prev.Lon + normalize(v.Lon-prev.Lon)
+			if nearlyEqual(v, prev) {
+				continue
+			}
+		}
+		ring = append(ring, v)
+	}
+	if n := len(ring); n > 1 && nearlyEqual(ring[0], ring[n-1]) {
+		ring = ring[:n-1]
+	}
+	return ring
+}
+
+// inRing reports whether (x, y) = (lon, lat) is on an edge of ring or, by ray
+// casting, inside it.
+func inRing(ring []Point, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[j], ring[i]
+		if onSegment(a, b, x, y) {
+			return true
+		}
+		if (a.Lat > y) != (b.Lat > y) {
+			cross := a.Lon + (y-a.Lat)*(b.Lon-a.Lon)/(b.Lat-a.Lat)
+			if x < cross {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// onSegment reports whether (x, y) lies on the edge from a to b.
+func onSegment(a, b Point, x, y float64) bool {
+	if x < math.Min(a.Lon, b.Lon)-boundaryEpsilon || x > math.Max(a.Lon, b.Lon)+boundaryEpsilon ||
+		y < math.Min(a.Lat, b.Lat)-boundaryEpsilon || y > math.Max(a.Lat, b.Lat)+boundaryEpsilon {
+		return false
+	}
+	cross := (b.Lon-a.Lon)*(y-a.Lat) - (b.Lat-a.Lat)*(x-a.Lon)
+	return math.Abs(cross) <= boundaryEpsilon*math.Hypot(b.Lon-a.Lon, b.Lat-a.Lat)
+}
+
+// area returns the signed area of ring in square degrees.
+func area(ring []Point) float64 {
+	var sum float64
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		sum += ring[j].Lon*ring[i].Lat - ring[i].Lon*ring[j].Lat
+	}
+	return sum / 2
+}
+
+// normalize maps a longitude difference or value into [-180, 180].
+func normalize(lon float64) float64 {
+	for lon > 180 {
+		lon -= 360
+	}
+	for lon < -180 {
+		lon += 360
+	}
+	return lon
+}
+
+func nearlyEqual(a, b Point) bool {
+	return math.Abs(a.Lat-b.Lat) <= boundaryEpsilon && math.Abs(a.Lon-b.Lon) <= boundaryEpsilon
+}
@@ -0,0 +1,108 @@
+package geofence
+
+import (
+	"math"
+	"testing"
+)
+
+// square is a 1°×1° fence around Beijing, given counter-clockwise.
+var square = Polygon{{39.5, 116}, {39.5, 117}, {40.5, 117}, {40.5, 116}}
+
+func TestPolygonContainsSquare(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"centre", 40, 116.5, true},
+		{"near corner", 39.51, 116.99, true},
+		{"west", 40, 115.9, false},
+		{"north", 40.6, 116.5, false},
+		{"diagonal", 41, 118, false},
+		{"on west edge", 40, 116, true},
+		{"on south edge", 39.5, 116.5, true},
+		{"on vertex", 40.5, 117, true},
+		{"just outside edge", 40, 117.000001, false},
+		{"NaN", math.NaN(), 116.5, false},
+		{"infinite", 40, math.Inf(1), false},
+	} {
+		if got := square.Contains(tc.lat, tc.lon); got != tc.want {
+			t.Errorf("%s: Contains(%v, %v) = %v, want %v", tc.name, tc.lat, tc.lon, got, tc.want)
+		}
+	}
+}
+
+func TestCompiledFenceMatchesPolygon(t *testing.T) {
+	f, err := square.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []Point{{40, 116.5}, {40, 116}, {40, 115.9}, {41, 118}} {
+		if got, want := f.Contains(p.Lat, p.Lon), square.Contains(p.Lat, p.Lon); got != want {
+			t.Errorf("Fence.Contains(%v, %v) = %v, Polygon.Contains = %v", p.Lat, p.Lon, got, want)
+		}
+	}
+	if _, err := (Polygon{{0, 0}, {0, 1}}).Compile(); err == nil {
+		t.Error("Compile accepted a two-vertex polygon")
+	}
+}
+
+func TestPolygonWindingAndClosingVertex(t *testing.T) {
+	clockwise := Polygon{square[3], square[2], square[1], square[0]}
+	closed := append(Polygon{}, square...)
+	closed = append(closed, square[0])
+	for name, p := range map[string]Polygon{"clockwise": clockwise, "closed": closed} {
+		if err := p.Validate(); err != nil {
+			t.Errorf("%s: Validate: %v", name, err)
+		}
+		if !p.Contains(40, 116.5) || p.Contains(40, 118) {
+			t.Errorf("%s: wrong containment", name)
+		}
+	}
+}
+
+func TestPolygonConcave(t *testing.T) {
+	// An L shape: the notch at the top right is outside.
+	l := Polygon{{0, 0}, {0, 2}, {1, 2}, {1, 1}, {2, 1}, {2, 0}}
+	if !l.Contains(0.5, 1.5) || !l.Contains(1.5, 0.5) {
+		t.Error("point in the L reported outside")
+	}
+	if l.Contains(1.5, 1.5) {
+		t.Error("point in the notch reported inside")
+	}
+}
+
+func TestPolygonAcrossAntimeridian(t *testing.T) {
+	pacific := Polygon{{-10, 170}, {-10, -170}, {10, -170}, {10, 170}}
+	if err := pacific.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for _, lon := range []float64{179.5, -179.5, 180, -180, 170, -170} {
+		if !pacific.Contains(0, lon) {
+			t.Errorf("Contains(0, %v) = false, want true", lon)
+		}
+	}
+	for _, lon := range []float64{0, 169, -169, 90} {
+		if pacific.Contains(0, lon) {
+			t.Errorf("Contains(0, %v) = true, want false", lon)
+		}
+	}
+}
+
+func TestDegeneratePolygons(t *testing.T) {
+	for name, p := range map[string]Polygon{
+		"empty":         nil,
+		"two vertices":  {{0, 0}, {1, 1}},
+		"repeated":      {{0, 0}, {0, 0}, {1, 1}, {1, 1}},
+		"collinear":     {{0, 0}, {1, 1}, {2, 2}},
+		"off the globe": {{0, 0}, {0, 1}, {91, 1}},
+		"NaN vertex":    {{0, 0}, {0, 1}, {math.NaN(), 1}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted a degenerate polygon", name)
+		}
+		if p.Contains(0, 0) || p.Contains(0.5, 0.5) {
+			t.Errorf("%s: degenerate polygon contains a point", name)
+		}
+	}
+}
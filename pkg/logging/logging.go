@@ -0,0 +1,164 @@
+// Package logging defines the small leveled, structured logger vlink's
+// packages write to. Messages are constant strings and the details travel as
+// alternating key-value pairs, so that a log aggregator can index them.
+//
+// *slog.Logger satisfies Logger, so JSON output or any other slog.Handler
+// needs no adapter. Without one, vlink logs through Default, which writes
+// lines such as "[WARN] connection lost vehicle_id=car-001 err=EOF" to the
+// standard log package.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Logger is a leveled, structured logger. kv holds alternating keys and
+// values; keys are strings.
+type Logger interface {
+	Debug(msg string, kv ...any)
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+}
+
+// Level is the severity of a log entry.
+type Level int
+
+// Log levels, in increasing severity. The values match slog's.
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// Std adapts a standard library *log.Logger, writing entries at or above
+// Min as "[LEVEL] msg key=value ...".
+type Std struct {
+	Log *log.Logger // nil writes to log.Default()
+	Min Level
+}
+
+// Default returns the logger vlink uses when none is configured: Info and
+// above through the standard log package, as configured by log.SetOutput
+// and log.SetFlags.
+func Default() Logger { return Std{Min: LevelInfo} }
+
+// ByName returns the logger for a -log-format flag value: "text" for
+// Default, or "json" for one JSON object per entry on standard error.
+func ByName(format string) (Logger, error) {
+	switch format {
+	case "text", "":
+		return Default(), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})), nil
+	}
+	return nil, fmt.Errorf("logging: unknown format %q (want text or json)", format)
+}
+
+// OrDefault returns l, or Default when l is nil.
+func OrDefault(l Logger) Logger {
+	if l == nil {
+		return Default()
+	}
+	return l
+}
+
+func (s Std) Debug(msg string, kv ...any) { s.write(LevelDebug, msg, kv) }
+func (s Std) Info(msg string, kv ...any)  { s.write(LevelInfo, msg, kv) }
+func (s Std) Warn(msg string, kv ...any)  { s.write(LevelWarn, msg, kv) }
+func (s Std) Error(msg string, kv ...any) { s.write(LevelError, msg, kv) }
+
+func (s Std) write(level Level, msg string, kv []any) {
+	if level < s.Min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("[")
+	b.WriteString(level.String())
+	b.WriteString("] ")
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		key, val := pair(kv, i)
+		b.WriteString(" ")
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(quote(fmt.Sprint(val)))
+	}
+	l := s.Log
+	if l == nil {
+		l = log.Default()
+	}
+	l.Output(3, b.String())
+}
+
+// pair returns the key and value starting at kv[i]. A trailing value
+// without a key, or a non-string key, is reported under "!BADKEY" as slog
+// does.
+func pair(kv []any, i int) (string, any) {
+	key, ok := kv[i].(string)
+	if !ok || i+1 == len(kv) {
+		return "!BADKEY", kv[i]
+	}
+	return key, kv[i+1]
+}
+
+// quote quotes v if it would otherwise be ambiguous in a key=value line.
+func quote(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\t\n") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// With returns a Logger that adds kv to the fields of every entry written
+// to l, e.g. the vehicle ID of an agent.
+func With(l Logger, kv ...any) Logger {
+	if len(kv) == 0 {
+		return l
+	}
+	return with{l: l, kv: kv}
+}
+
+type with struct {
+	l  Logger
+	kv []any
+}
+
+func (w with) fields(kv []any) []any {
+	return append(append(make([]any, 0, len(w.kv)+len(kv)), w.kv...), kv...)
+}
+
+func (w with) Debug(msg string, kv ...any) { w.l.Debug(msg, w.fields(kv)...) }
+func (w with) Info(msg string, kv ...any)  { w.l.Info(msg, w.fields(kv)...) }
+func (w with) Warn(msg string, kv ...any)  { w.l.Warn(msg, w.fields(kv)...) }
+func (w with) Error(msg string, kv ...any) { w.l.Error(msg, w.fields(kv)...) }
+
+// Discard drops every entry.
+var Discard Logger = discard{}
+
+type discard struct{}
+
+func (discard) Debug(string, ...any) {}
+func (discard) Info(string, ...any)  {}
+func (discard) Warn(string, ...any)  {}
+func (discard) Error(string, ...any) {}
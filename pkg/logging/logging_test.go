@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// Compile-time check: *slog.Logger can be used wherever a Logger is.
+var _ Logger = (*slog.Logger)(nil)
+
+func TestStdFormatsFieldsAndFiltersLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := Std{Log: log.New(&buf, "", 0), Min: LevelInfo}
+	l.Debug("hidden")
+	l.Warn("connection lost", "vehicle_id", "car-001", "err", "read: connection reset", "attempt", 3)
+	l.Error("odd", "dangling")
+
+	want := `[WARN] connection lost vehicle_id=car-001 err="read: connection reset" attempt=3
+[ERROR] odd !BADKEY=dangling
+`
+	if got := buf.String(); got != want {
+		t.Errorf("output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWithPrependsFields(t *testing.T) {
+	var r Recorder
+	l := With(&r, "vehicle_id", "car-001")
+	l.Info("connected", "broker", "tcp://b:1883")
+
+	e, ok := r.Find(LevelInfo, "connected")
+	if !ok {
+		t.Fatalf("entry not recorded: %+v", r.Entries())
+	}
+	if e.Fields["vehicle_id"] != "car-001" || e.Fields["broker"] != "tcp://b:1883" {
+		t.Errorf("fields = %v", e.Fields)
+	}
+}
+
+func TestOrDefault(t *testing.T) {
+	if _, ok := OrDefault(nil).(Std); !ok {
+		t.Error("OrDefault(nil) is not the stdlib adapter")
+	}
+	var r Recorder
+	if OrDefault(&r) != Logger(&r) {
+		t.Error("OrDefault replaced a configured logger")
+	}
+}
+
+func TestByName(t *testing.T) {
+	if l, err := ByName("json"); err != nil || l == nil {
+		t.Errorf("ByName(json) = %v, %v", l, err)
+	}
+	if _, err := ByName("xml"); err == nil {
+		t.Error("ByName(xml) succeeded, want an error")
+	}
+}
+
+func TestSlogLoggerReceivesEntries(t *testing.T) {
+	var buf bytes.Buffer
+	var l Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	With(l, "vehicle_id", "car-001").Error("bad control message", "err", "unexpected EOF")
+	out := buf.String()
+	for _, want := range []string{`"level":"ERROR"`, `"msg":"bad control message"`, `"vehicle_id":"car-001"`, `"err":"unexpected EOF"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("JSON output %s lacks %s", out, want)
+		}
+	}
+}
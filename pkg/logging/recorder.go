@@ -0,0 +1,54 @@
+package logging
+
+import "sync"
+
+// Entry is a log entry captured by a Recorder.
+type Entry struct {
+	Level  Level
+	Msg    string
+	Fields map[string]any
+}
+
+// Recorder is an in-memory Logger that keeps every entry, for tests that
+// assert on what was logged.
+type Recorder struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func (r *Recorder) Debug(msg string, kv ...any) { r.record(LevelDebug, msg, kv) }
+func (r *Recorder) Info(msg string, kv ...any)  { r.record(LevelInfo, msg, kv) }
+func (r *Recorder) Warn(msg string, kv ...any)  { r.record(LevelWarn, msg, kv) }
+func (r *Recorder) Error(msg string, kv ...any) { r.record(LevelError, msg, kv) }
+
+func (r *Recorder) record(level Level, msg string, kv []any) {
+	e := Entry{Level: level, Msg: msg, Fields: make(map[string]any, len(kv)/2)}
+	for i := 0; i < len(kv); i += 2 {
+		key, val := pair(kv, i)
+		e.Fields[key] = val
+	}
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+	r.mu.Unlock()
+}
+
+// Entries returns the entries logged so far, in order.
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Entry, len(r.entries))
+	copy(out, r.entries)
+	return out
+}
+
+// Find returns the first entry logged at level with message msg.
+func (r *Recorder) Find(level Level, msg string) (Entry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.Level == level && e.Msg == msg {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
@@ -0,0 +1,250 @@
+// Package membroker provides an in-process MQTT broker for tests and
+// simulations. Clients obtained from a Broker implement mqtt.Client and
+// exchange messages synchronously, so scenarios built on top of it are fully
+// deterministic and need no network.
+package membroker
+
+import (
+	"crypto/x509"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Message is a record of a single publish routed through the broker.
+type Message struct {
+	ClientID string
+	Topic    string
+	QoS      byte
+	Retained bool
+	Payload  []byte
+}
+
+// Broker routes publishes from its clients to every matching subscription.
+type Broker struct {
+	mu       sync.Mutex
+	subs     []subscription
+	messages []Message
+}
+
+type subscription struct {
+	client  *Client
+	filter  string
+	handler mqtt.MessageHandler
+}
+
+// New creates an empty Broker.
+func New() *Broker {
+	return &Broker{}
+}
+
+// Client returns a new client attached to the broker. The client reports
+// itself as connected immediately.
+func (b *Broker) Client(clientID string) *Client {
+	return &Client{broker: b, id: clientID, connected: true}
+}
+
+// Messages returns a copy of every message published so far, in order.
+func (b *Broker) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]Message, len(b.messages))
+	copy(out, b.messages)
+	return out
+}
+
+func (b *Broker) publish(from *Client, topic string, qos byte, retained bool, payload []byte) {
+	b.mu.Lock()
+	b.messages = append(b.messages, Message{
+		ClientID: from.id,
+		Topic:    topic,
+		QoS:      qos,
+		Retained: retained,
+		Payload:  payload,
+	})
+	var targets []subscription
+	for _, s := range b.subs {
+		if Match(s.filter, topic) && s.client.IsConnected() {
+			targets = append(targets, s)
+		}
+	}
+	b.mu.Unlock()
+
+	// Handlers run without the broker lock so they may publish in turn.
+	cert := from.peerCertificate()
+	for _, s := range targets {
+		s.handler(s.client, &message{topic: topic, qos: qos, retained: retained, payload: payload, cert: cert})
+	}
+}
+
+func (b *Broker) subscribe(c *Client, filter string, h mqtt.MessageHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, s := range b.subs {
+		if s.client == c && s.filter == filter {
+			b.subs[i].handler = h
+			return
+		}
+	}
+	b.subs = append(b.subs, subscription{client: c, filter: filter, handler: h})
+}
+
+func (b *Broker) unsubscribe(c *Client, filters ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept := b.subs[:0]
+	for _, s := range b.subs {
+		drop := false
+		if s.client == c {
+			for _, f := range filters {
+				if s.filter == f {
+					drop = true
+					break
+				}
+			}
+		}
+		if !drop {
+			kept = append(kept, s)
+		}
+	}
+	b.subs = kept
+}
+
+// Match reports whether topic matches the MQTT subscription filter, honouring
+// the single-level (+) and multi-level (#) wildcards.
+func Match(filter, topic string) bool {
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+// Client is an mqtt.Client connected to an in-memory Broker.
+type Client struct {
+	broker *Broker
+	id     string
+
+	mu        sync.Mutex
+	connected bool
+	cert      *x509.Certificate
+}
+
+// SetPeerCertificate makes the client behave as if it had connected with
+// the TLS client certificate cert: messages it publishes carry it to
+// subscribers through a PeerCertificate method, as a broker that forwards
+// its clients' identities would.
+func (c *Client) SetPeerCertificate(cert *x509.Certificate) {
+	c.mu.Lock()
+	c.cert = cert
+	c.mu.Unlock()
+}
+
+func (c *Client) peerCertificate() *x509.Certificate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert
+}
+
+// SetConnected toggles the client's connection state. A disconnected client
+// receives no messages and its publishes fail.
+func (c *Client) SetConnected(v bool) {
+	c.mu.Lock()
+	c.connected = v
+	c.mu.Unlock()
+}
+
+func (c *Client) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *Client) IsConnectionOpen() bool { return c.IsConnected() }
+
+func (c *Client) Connect() mqtt.Token {
+	c.SetConnected(true)
+	return &token{}
+}
+
+func (c *Client) Disconnect(uint) { c.SetConnected(false) }
+
+func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	if !c.IsConnected() {
+		return &token{err: mqtt.ErrNotConnected}
+	}
+	var p []byte
+	switch v := payload.(type) {
+	case []byte:
+		p = v
+	case string:
+		p = []byte(v)
+	}
+	c.broker.publish(c, topic, qos, retained, p)
+	return &token{}
+}
+
+func (c *Client) Subscribe(topic string, _ byte, h mqtt.MessageHandler) mqtt.Token {
+	c.broker.subscribe(c, topic, h)
+	return &token{}
+}
+
+func (c *Client) SubscribeMultiple(filters map[string]byte, h mqtt.MessageHandler) mqtt.Token {
+	for f := range filters {
+		c.broker.subscribe(c, f, h)
+	}
+	return &token{}
+}
+
+func (c *Client) Unsubscribe(topics ...string) mqtt.Token {
+	c.broker.unsubscribe(c, topics...)
+	return &token{}
+}
+
+func (c *Client) AddRoute(string, mqtt.MessageHandler) {}
+
+func (c *Client) OptionsReader() mqtt.ClientOptionsReader {
+	return mqtt.NewClient(mqtt.NewClientOptions().SetClientID(c.id)).OptionsReader()
+}
+
+// --- mqtt.Message / mqtt.Token implementations ---
+
+type message struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+	cert     *x509.Certificate
+}
+
+func (m *message) Duplicate() bool   { return false }
+func (m *message) Qos() byte         { return m.qos }
+func (m *message) Retained() bool    { return m.retained }
+func (m *message) Topic() string     { return m.topic }
+func (m *message) MessageID() uint16 { return 0 }
+func (m *message) Payload() []byte   { return m.payload }
+func (m *message) Ack()              {}
+
+// PeerCertificate returns the certificate set on the publishing client with
+// SetPeerCertificate, or nil.
+func (m *message) PeerCertificate() *x509.Certificate { return m.cert }
+
+type token struct {
+	err error
+}
+
+func (t *token) Wait() bool                     { return true }
+func (t *token) WaitTimeout(time.Duration) bool { return true }
+func (t *token) Done() <-chan struct{}          { ch := make(chan struct{}); close(ch); return ch }
+func (t *token) Error() error                   { return t.err }
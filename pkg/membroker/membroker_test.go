@@ -0,0 +1,89 @@
+package membroker
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"v1/vehicle/+/state", "v1/vehicle/car-001/state", true},
+		{"v1/vehicle/+/state", "v1/vehicle/car-001/alert", false},
+		{"v1/vehicle/#", "v1/vehicle/car-001/state", true},
+		{"v1/#", "v1", true},
+		{"v1/vehicle/car-001/state", "v1/vehicle/car-001/state", true},
+		{"v1/vehicle/+", "v1/vehicle/car-001/state", false},
+		{"v1/vehicle/+/state/x", "v1/vehicle/car-001/state", false},
+	}
+	for _, c := range cases {
+		if got := Match(c.filter, c.topic); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.filter, c.topic, got, c.want)
+		}
+	}
+}
+
+func TestPublishRoutesToMatchingSubscribers(t *testing.T) {
+	b := New()
+	pub := b.Client("pub")
+	sub := b.Client("sub")
+
+	var got []string
+	sub.Subscribe("v1/vehicle/+/state", 1, func(_ mqtt.Client, m mqtt.Message) {
+		got = append(got, m.Topic()+"="+string(m.Payload()))
+	})
+
+	pub.Publish("v1/vehicle/car-001/state", 0, false, []byte("a"))
+	pub.Publish("v1/vehicle/car-001/alert", 1, false, []byte("b"))
+
+	if len(got) != 1 || got[0] != "v1/vehicle/car-001/state=a" {
+		t.Errorf("delivered = %v, want [v1/vehicle/car-001/state=a]", got)
+	}
+	if n := len(b.Messages()); n != 2 {
+		t.Errorf("len(Messages) = %d, want 2", n)
+	}
+
+	sub.Unsubscribe("v1/vehicle/+/state")
+	pub.Publish("v1/vehicle/car-001/state", 0, false, []byte("c"))
+	if len(got) != 1 {
+		t.Errorf("message delivered after Unsubscribe: %v", got)
+	}
+}
+
+func TestDisconnectedClientCannotPublish(t *testing.T) {
+	b := New()
+	c := b.Client("car")
+	c.SetConnected(false)
+
+	tok := c.Publish("v1/vehicle/car/state", 0, false, []byte("x"))
+	if tok.Error() == nil {
+		t.Error("expected publish error while disconnected")
+	}
+	if len(b.Messages()) != 0 {
+		t.Error("disconnected publish should not reach the broker")
+	}
+}
+
+func TestMessagesCarryPublisherCertificate(t *testing.T) {
+	b := New()
+	sub := b.Client("sub")
+	var got []*x509.Certificate
+	sub.Subscribe("t", 0, func(_ mqtt.Client, m mqtt.Message) {
+		got = append(got, m.(interface{ PeerCertificate() *x509.Certificate }).PeerCertificate())
+	})
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "car-001"}}
+	pub := b.Client("car-001")
+	pub.Publish("t", 0, false, "anonymous")
+	pub.SetPeerCertificate(cert)
+	pub.Publish("t", 0, false, "authenticated")
+
+	if len(got) != 2 || got[0] != nil || got[1] != cert {
+		t.Errorf("peer certificates = %v, want [nil %p]", got, cert)
+	}
+}
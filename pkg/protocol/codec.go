@@ -0,0 +1,145 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Codec serialises wire messages. Codecs are registered by name with
+// RegisterCodec so that tooling such as BenchmarkCodecs can compare them.
+type Codec interface {
+	// Name identifies the codec, e.g. "json".
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec encodes messages as JSON using their struct tags. It is the
+// format Marshal and Unmarshal use.
+type JSONCodec struct{}
+
+// Name returns "json".
+func (JSONCodec) Name() string { return "json" }
+
+// Marshal encodes v as JSON, zeroing non-finite floats rather than failing
+// on them.
+func (JSONCodec) Marshal(v any) ([]byte, error) { return json.Marshal(sanitizeCopy(v)) }
+
+// Unmarshal decodes JSON data into v.
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	sanitizeDecoded(v)
+	return nil
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = map[string]Codec{"json": JSONCodec{}, "protobuf": ProtobufCodec{}}
+)
+
+// RegisterCodec makes c available under c.Name(), replacing any codec
+// registered under the same name.
+func RegisterCodec(c Codec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// Codecs returns the registered codecs sorted by name.
+func Codecs() []Codec {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	list := make([]Codec, 0, len(codecs))
+	for _, c := range codecs {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// codecBenchRounds is how many times BenchmarkCodecs encodes and decodes the
+// sample set per codec; timings are averaged over all rounds.
+const codecBenchRounds = 100
+
+// CodecResult reports how one codec performed on a sample set.
+type CodecResult struct {
+	Codec string
+	// Bytes is the total encoded size of one pass over the samples.
+	Bytes int
+	// Encode and Decode are the mean time per message.
+	Encode time.Duration
+	Decode time.Duration
+	// Err is set if the codec failed on any sample; the other fields are
+	// then zero.
+	Err error
+}
+
+// BenchmarkCodecs encodes and decodes samples with every registered codec
+// and reports the payload size and mean timing of each, so operators can
+// choose a wire format for their actual message mix. Samples must be
+// pointers to, or values of, struct message types such as *VehicleState.
+// Results are in Codecs order.
+func BenchmarkCodecs(samples []any) []CodecResult {
+	list := Codecs()
+	results := make([]CodecResult, 0, len(list))
+	for _, c := range list {
+		results = append(results, benchmarkCodec(c, samples))
+	}
+	return results
+}
+
+func benchmarkCodec(c Codec, samples []any) CodecResult {
+	res := CodecResult{Codec: c.Name()}
+	if len(samples) == 0 {
+		return res
+	}
+
+	encoded := make([][]byte, len(samples))
+	for i, v := range samples {
+		data, err := c.Marshal(v)
+		if err != nil {
+			return CodecResult{Codec: c.Name(), Err: fmt.Errorf("encode %T: %w", v, err)}
+		}
+		encoded[i] = data
+		res.Bytes += len(data)
+	}
+
+	start := time.Now()
+	for r := 0; r < codecBenchRounds; r++ {
+		for _, v := range samples {
+			_, _ = c.Marshal(v)
+		}
+	}
+	res.Encode = time.Since(start) / time.Duration(codecBenchRounds*len(samples))
+
+	targets := make([]any, len(samples))
+	for i, v := range samples {
+		targets[i] = newTarget(v)
+		if err := c.Unmarshal(encoded[i], targets[i]); err != nil {
+			return CodecResult{Codec: c.Name(), Err: fmt.Errorf("decode %T: %w", v, err)}
+		}
+	}
+	start = time.Now()
+	for r := 0; r < codecBenchRounds; r++ {
+		for i := range samples {
+			_ = c.Unmarshal(encoded[i], targets[i])
+		}
+	}
+	res.Decode = time.Since(start) / time.Duration(codecBenchRounds*len(samples))
+	return res
+}
+
+// newTarget returns a pointer to a new zero value of v's message type.
+func newTarget(v any) any {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return reflect.New(t).Interface()
+}
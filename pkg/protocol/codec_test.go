@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// indentCodec is a second, deliberately larger, format for comparison.
+type indentCodec struct{}
+
+func (indentCodec) Name() string                       { return "json-indent" }
+func (indentCodec) Marshal(v any) ([]byte, error)      { return json.MarshalIndent(v, "", "  ") }
+func (indentCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+func TestBenchmarkCodecsReportsEveryCodec(t *testing.T) {
+	RegisterCodec(indentCodec{})
+
+	samples := []any{
+		&VehicleState{VehicleID: "car-001", Timestamp: 1_700_000_000_000, Latitude: 39.9042, Longitude: 116.4074, Speed: 12.5, Mode: "autonomous"},
+		&ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: ActionStop},
+		TeleoperationAlert{VehicleID: "car-001", Reason: "extreme_weather", Severity: 3},
+	}
+	results := BenchmarkCodecs(samples)
+
+	byName := make(map[string]CodecResult)
+	for _, r := range results {
+		byName[r.Codec] = r
+	}
+	for _, c := range Codecs() {
+		r, ok := byName[c.Name()]
+		if !ok {
+			t.Errorf("no result for codec %q", c.Name())
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Codec, r.Err)
+		}
+		if r.Bytes <= 0 || r.Encode <= 0 || r.Decode <= 0 {
+			t.Errorf("%s: incomplete result %+v", r.Codec, r)
+		}
+	}
+
+	var want int
+	for _, v := range samples {
+		want += EstimateSize(JSONCodec{}, v)
+	}
+	if got := byName["json"].Bytes; got != want {
+		t.Errorf("json bytes = %d, want %d", got, want)
+	}
+	if byName["json-indent"].Bytes <= byName["json"].Bytes {
+		t.Errorf("indented JSON (%d bytes) not larger than compact (%d bytes)", byName["json-indent"].Bytes, byName["json"].Bytes)
+	}
+}
+
+func TestBenchmarkCodecsReportsFailures(t *testing.T) {
+	results := BenchmarkCodecs([]any{make(chan int)})
+	if len(results) == 0 {
+		t.Fatal("no results")
+	}
+	for _, r := range results {
+		if r.Err == nil {
+			t.Errorf("%s: expected an encode error for an unmarshalable sample", r.Codec)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package protocol
+
+// ConfigQuery is published by the control center to
+// v1/vehicle/{id}/config_query to ask a vehicle for its current settings,
+// e.g. for diagnostics. The vehicle answers with a ConfigReport carrying the
+// same QueryID.
+type ConfigQuery struct {
+	QueryID   string `json:"query_id"`
+	VehicleID string `json:"vehicle_id"`
+	Timestamp int64  `json:"timestamp"` // Unix milliseconds, center clock
+}
+
+// GeofenceSummary describes a vehicle's operating area as a latitude and
+// longitude box in WGS84 degrees. MinLon greater than MaxLon means the box
+// spans the antimeridian.
+type GeofenceSummary struct {
+	MinLat float64 `json:"min_lat"`
+	MinLon float64 `json:"min_lon"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLon float64 `json:"max_lon"`
+}
+
+// ConfigReport is published by the vehicle to v1/vehicle/{id}/config in
+// answer to a ConfigQuery and reports the settings in effect at that moment.
+type ConfigReport struct {
+	QueryID         string `json:"query_id"`
+	VehicleID       string `json:"vehicle_id"`
+	Timestamp       int64  `json:"timestamp"` // Unix milliseconds, vehicle clock
+	FirmwareVersion string `json:"firmware_version,omitempty"`
+	// PublishHz is the effective state publish rate, including any
+	// set_publish_hz override.
+	PublishHz          float64          `json:"publish_hz"`
+	MinPublishSeverity int32            `json:"min_publish_severity"`
+	EscalateAfterMs    int64            `json:"escalate_after_ms"`
+	LowBatteryPct      float32          `json:"low_battery_pct"`
+	Geofence           *GeofenceSummary `json:"geofence,omitempty"`
+	Mode               string           `json:"mode"`
+	Paused             bool             `json:"paused"`
+}
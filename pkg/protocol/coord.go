@@ -0,0 +1,161 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CoordinateConverter maps positions from a vehicle's local coordinate system
+// onto WGS84, the only coordinate system used on the wire. x and y are the
+// local easting and northing (or equivalent) in metres.
+type CoordinateConverter interface {
+	ToWGS84(x, y float64) (lat, lon float64, err error)
+}
+
+// ErrOutOfRange is returned for coordinates outside the valid domain of a
+// conversion.
+var ErrOutOfRange = errors.New("protocol: coordinate out of range")
+
+// WGS84 ellipsoid and UTM projection constants.
+const (
+	wgs84A     = 6378137.0
+	wgs84F     = 1 / 298.257223563
+	utmK0      = 0.9996
+	utmFalseE  = 500000.0
+	utmFalseN  = 10000000.0 // applied in the southern hemisphere
+	utmMinZone = 1
+	utmMaxZone = 60
+	utmMaxLat  = 84.0
+	utmMinLat  = -80.0
+	degPerZone = 6.0
+	zoneOrigin = -180.0
+	wgs84E2    = wgs84F * (2 - wgs84F)
+	wgs84EP2   = wgs84E2 / (1 - wgs84E2)
+	radPerDeg  = math.Pi / 180
+	degPerRad  = 180 / math.Pi
+)
+
+// EarthRadius is the mean Earth radius in metres used by DistanceMeters.
+const EarthRadius = 6371008.8
+
+// DistanceMeters returns the great-circle (haversine) distance in metres
+// between two WGS84 points given in degrees.
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	p1, p2 := lat1*radPerDeg, lat2*radPerDeg
+	dp := p2 - p1
+	dl := (lon2 - lon1) * radPerDeg
+	h := math.Sin(dp/2)*math.Sin(dp/2) + math.Cos(p1)*math.Cos(p2)*math.Sin(dl/2)*math.Sin(dl/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// HasPosition reports whether s carries a usable WGS84 fix. Out-of-range or
+// NaN coordinates and the all-zero position of a vehicle that never reported
+// one are rejected.
+func (s *VehicleState) HasPosition() bool {
+	lat, lon := s.Latitude, s.Longitude
+	switch {
+	case math.IsNaN(lat) || math.IsNaN(lon):
+		return false
+	case lat < -90 || lat > 90 || lon < -180 || lon > 180:
+		return false
+	}
+	return lat != 0 || lon != 0
+}
+
+// UTM is a CoordinateConverter for a single Universal Transverse Mercator
+// zone. x is the easting and y the northing, both in metres.
+type UTM struct {
+	Zone  int  // 1–60
+	North bool // northern hemisphere
+}
+
+// ToWGS84 implements CoordinateConverter.
+func (u UTM) ToWGS84(x, y float64) (float64, float64, error) {
+	return UTMToWGS84(x, y, u.Zone, u.North)
+}
+
+// UTMZone returns the standard UTM zone number for a longitude (ignoring
+// the Norway and Svalbard exceptions).
+func UTMZone(lon float64) int {
+	z := int(math.Floor((lon-zoneOrigin)/degPerZone)) + 1
+	if z > utmMaxZone {
+		z = utmMaxZone
+	}
+	return z
+}
+
+func centralMeridian(zone int) float64 {
+	return zoneOrigin + float64(zone-1)*degPerZone + degPerZone/2
+}
+
+// meridianArc returns the distance along the central meridian from the
+// equator to latitude phi (radians).
+func meridianArc(phi float64) float64 {
+	e2, e4, e6 := wgs84E2, wgs84E2*wgs84E2, wgs84E2*wgs84E2*wgs84E2
+	return wgs84A * ((1-e2/4-3*e4/64-5*e6/256)*phi -
+		(3*e2/8+3*e4/32+45*e6/1024)*math.Sin(2*phi) +
+		(15*e4/256+45*e6/1024)*math.Sin(4*phi) -
+		(35*e6/3072)*math.Sin(6*phi))
+}
+
+// WGS84ToUTM projects lat/lon (degrees) into its standard UTM zone.
+func WGS84ToUTM(lat, lon float64) (easting, northing float64, zone int, north bool, err error) {
+	if lat < utmMinLat || lat > utmMaxLat || lon < -180 || lon > 180 {
+		return 0, 0, 0, false, fmt.Errorf("%w: lat=%f lon=%f", ErrOutOfRange, lat, lon)
+	}
+	zone = UTMZone(lon)
+	north = lat >= 0
+
+	phi := lat * radPerDeg
+	sin, cos, tan := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+	n := wgs84A / math.Sqrt(1-wgs84E2*sin*sin)
+	t := tan * tan
+	c := wgs84EP2 * cos * cos
+	a := cos * (lon - centralMeridian(zone)) * radPerDeg
+	m := meridianArc(phi)
+
+	easting = utmFalseE + utmK0*n*(a+(1-t+c)*math.Pow(a, 3)/6+
+		(5-18*t+t*t+72*c-58*wgs84EP2)*math.Pow(a, 5)/120)
+	northing = utmK0 * (m + n*tan*(a*a/2+(5-t+9*c+4*c*c)*math.Pow(a, 4)/24+
+		(61-58*t+t*t+600*c-330*wgs84EP2)*math.Pow(a, 6)/720))
+	if !north {
+		northing += utmFalseN
+	}
+	return easting, northing, zone, north, nil
+}
+
+// UTMToWGS84 converts a UTM easting/northing (metres) in the given zone and
+// hemisphere to lat/lon in degrees.
+func UTMToWGS84(easting, northing float64, zone int, north bool) (lat, lon float64, err error) {
+	if zone < utmMinZone || zone > utmMaxZone {
+		return 0, 0, fmt.Errorf("%w: UTM zone %d", ErrOutOfRange, zone)
+	}
+	if !north {
+		northing -= utmFalseN
+	}
+
+	e2 := wgs84E2
+	m := northing / utmK0
+	mu := m / (wgs84A * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+	phi1 := mu + (3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+
+	sin, cos, tan := math.Sin(phi1), math.Cos(phi1), math.Tan(phi1)
+	n1 := wgs84A / math.Sqrt(1-e2*sin*sin)
+	t1 := tan * tan
+	c1 := wgs84EP2 * cos * cos
+	r1 := wgs84A * (1 - e2) / math.Pow(1-e2*sin*sin, 1.5)
+	d := (easting - utmFalseE) / (n1 * utmK0)
+
+	lat = phi1 - (n1*tan/r1)*(d*d/2-
+		(5+3*t1+10*c1-4*c1*c1-9*wgs84EP2)*math.Pow(d, 4)/24+
+		(61+90*t1+298*c1+45*t1*t1-252*wgs84EP2-3*c1*c1)*math.Pow(d, 6)/720)
+	lon = (d - (1+2*t1+c1)*math.Pow(d, 3)/6 +
+		(5-2*c1+28*t1-3*c1*c1+8*wgs84EP2+24*t1*t1)*math.Pow(d, 5)/120) / cos
+
+	return lat * degPerRad, centralMeridian(zone) + lon*degPerRad, nil
+}
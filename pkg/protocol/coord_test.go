@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestUTMToWGS84KnownPoint(t *testing.T) {
+	// Reference: GeographicLib GeoConvert, 33.3N 44.4E = 38n 444140.54 3684706.36.
+	lat, lon, err := UTM{Zone: 38, North: true}.ToWGS84(444140.54, 3684706.36)
+	if err != nil {
+		t.Fatalf("ToWGS84: %v", err)
+	}
+	if math.Abs(lat-33.3) > 1e-6 || math.Abs(lon-44.4) > 1e-6 {
+		t.Errorf("got (%f, %f), want (33.3, 44.4)", lat, lon)
+	}
+}
+
+func TestUTMRoundTrip(t *testing.T) {
+	for _, p := range [][2]float64{{39.9042, 116.4074}, {-33.8568, 151.2153}, {0, 3}, {64.1466, -21.9426}} {
+		e, n, zone, north, err := WGS84ToUTM(p[0], p[1])
+		if err != nil {
+			t.Fatalf("WGS84ToUTM(%v): %v", p, err)
+		}
+		lat, lon, err := UTMToWGS84(e, n, zone, north)
+		if err != nil {
+			t.Fatalf("UTMToWGS84: %v", err)
+		}
+		if math.Abs(lat-p[0]) > 1e-7 || math.Abs(lon-p[1]) > 1e-7 {
+			t.Errorf("round trip %v -> (%f, %f)", p, lat, lon)
+		}
+	}
+}
+
+func TestUTMOutOfRange(t *testing.T) {
+	if _, _, err := UTMToWGS84(500000, 0, 61, true); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("zone 61: err = %v, want ErrOutOfRange", err)
+	}
+	if _, _, _, _, err := WGS84ToUTM(89, 0); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("lat 89: err = %v, want ErrOutOfRange", err)
+	}
+}
+
+func TestDistanceMeters(t *testing.T) {
+	cases := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want, tol              float64
+	}{
+		{"same point", 39.9, 116.4, 39.9, 116.4, 0, 1e-9},
+		{"one degree of longitude on the equator", 0, 0, 0, 1, 111195, 1},
+		{"one degree of latitude", 10, 20, 11, 20, 111195, 1},
+		{"Beijing to Shanghai", 39.9042, 116.4074, 31.2304, 121.4737, 1067000, 2000},
+		{"antipodes", 0, 0, 0, 180, math.Pi * EarthRadius, 1},
+	}
+	for _, c := range cases {
+		if d := DistanceMeters(c.lat1, c.lon1, c.lat2, c.lon2); math.Abs(d-c.want) > c.tol {
+			t.Errorf("%s: distance = %.1f m, want %.1f ± %.0f m", c.name, d, c.want, c.tol)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package protocol
+
+import "math"
+
+// A buggy sensor can report NaN or ±Inf, which encoding/json refuses to
+// marshal and which poisons any arithmetic downstream. Every codec therefore
+// zeroes non-finite float fields of VehicleState, ControlCommand and
+// TeleoperationAlert, both when encoding (on a copy, leaving the caller's
+// message untouched) and when decoding. A non-finite latitude or longitude
+// zeroes both, since (0, 0) is how vlink denotes "no position fix".
+
+func isFinite(f float64) bool { return !math.IsNaN(f) && !math.IsInf(f, 0) }
+
+// zero32 zeroes *f if it is not finite and records name in fields.
+func zero32(f *float32, name string, fields []string) []string {
+	if isFinite(float64(*f)) {
+		return fields
+	}
+	*f = 0
+	return append(fields, name)
+}
+
+func zero64(f *float64, name string, fields []string) []string {
+	if isFinite(*f) {
+		return fields
+	}
+	*f = 0
+	return append(fields, name)
+}
+
+// zeroPosition zeroes lat and lon if either is not finite.
+func zeroPosition(lat, lon *float64, fields []string) []string {
+	if isFinite(*lat) && isFinite(*lon) {
+		return fields
+	}
+	*lat, *lon = 0, 0
+	return append(fields, "latitude", "longitude")
+}
+
+// Sanitize zeroes the non-finite float fields of s and returns their JSON
+// names, or nil if every field was finite.
+func (s *VehicleState) Sanitize() []string {
+	fields := zeroPosition(&s.Latitude, &s.Longitude, nil)
+	fields = zero64(&s.Altitude, "altitude", fields)
+	fields = zero32(&s.Speed, "speed", fields)
+	fields = zero32(&s.Heading, "heading", fields)
+	return zero32(&s.BatteryPct, "battery_pct", fields)
+}
+
+// Sanitize zeroes the non-finite float fields of c and returns their JSON
+// names, or nil if every field was finite.
+func (c *ControlCommand) Sanitize() []string {
+	fields := zero32(&c.TargetSpeed, "target_speed", nil)
+	return zero32(&c.TargetHeading, "target_heading", fields)
+}
+
+// Sanitize zeroes a non-finite position of a and returns the JSON names of
+// the zeroed fields, or nil if the position was finite.
+func (a *TeleoperationAlert) Sanitize() []string {
+	return zeroPosition(&a.Latitude, &a.Longitude, nil)
+}
+
+// sanitizeCopy returns v, or a sanitized copy of it if v is a message with
+// non-finite fields.
+func sanitizeCopy(v any) any {
+	switch m := v.(type) {
+	case *VehicleState:
+		if m != nil {
+			if cp := *m; cp.Sanitize() != nil {
+				return &cp
+			}
+		}
+	case VehicleState:
+		m.Sanitize()
+		return m
+	case *ControlCommand:
+		if m != nil {
+			if cp := *m; cp.Sanitize() != nil {
+				return &cp
+			}
+		}
+	case ControlCommand:
+		m.Sanitize()
+		return m
+	case *TeleoperationAlert:
+		if m != nil {
+			if cp := *m; cp.Sanitize() != nil {
+				return &cp
+			}
+		}
+	case TeleoperationAlert:
+		m.Sanitize()
+		return m
+	case *FeedAlert:
+		if m != nil {
+			if cp := *m; cp.TeleoperationAlert.Sanitize() != nil {
+				return &cp
+			}
+		}
+	}
+	return v
+}
+
+// sanitizeDecoded zeroes the non-finite fields of a freshly decoded message.
+// A state failing ValidateState is left as decoded, so that the receiver's
+// own ValidateState rejects it rather than accepting zeroes in place of a
+// NaN.
+func sanitizeDecoded(v any) {
+	if s, ok := v.(*VehicleState); ok && ValidateState(s) != nil {
+		return
+	}
+	if s, ok := v.(interface{ Sanitize() []string }); ok {
+		s.Sanitize()
+	}
+}
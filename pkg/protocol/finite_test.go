@@ -0,0 +1,81 @@
+package protocol
+
+import (
+	"math"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCodecsZeroNonFiniteFields(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, c := range []Codec{JSONCodec{}, ProtobufCodec{}, CompatCodec{}} {
+		in := &VehicleState{VehicleID: "car-001", Latitude: nan, Longitude: 116.4, Altitude: inf,
+			Speed: float32(nan), Heading: float32(math.Inf(-1)), BatteryPct: 80}
+		data, err := c.Marshal(in)
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", c.Name(), err)
+		}
+		if !math.IsNaN(in.Latitude) || !math.IsNaN(float64(in.Speed)) {
+			t.Errorf("%s: Marshal modified the caller's state: %+v", c.Name(), in)
+		}
+		var out VehicleState
+		if err := c.Unmarshal(data, &out); err != nil {
+			t.Fatalf("%s: Unmarshal: %v", c.Name(), err)
+		}
+		want := VehicleState{VehicleID: "car-001", BatteryPct: 80}
+		if out != want {
+			t.Errorf("%s: decoded %+v, want %+v", c.Name(), out, want)
+		}
+
+		cmd := ControlCommand{Action: ActionSetSpeed, TargetSpeed: float32(inf), TargetHeading: 90}
+		if data, err = c.Marshal(cmd); err != nil {
+			t.Fatalf("%s: Marshal command: %v", c.Name(), err)
+		}
+		var gotCmd ControlCommand
+		if err := c.Unmarshal(data, &gotCmd); err != nil || gotCmd.TargetSpeed != 0 || gotCmd.TargetHeading != 90 {
+			t.Errorf("%s: decoded command %+v, %v", c.Name(), gotCmd, err)
+		}
+
+		feed := &FeedAlert{TeleoperationAlert: TeleoperationAlert{VehicleID: "car-001", Latitude: 39.9, Longitude: nan}}
+		if _, err := c.Marshal(feed); err != nil {
+			t.Errorf("%s: Marshal feed alert: %v", c.Name(), err)
+		}
+	}
+}
+
+func TestProtobufDecodeZeroesNonFinite(t *testing.T) {
+	// A peer that does not sanitize can still put NaN on the wire.
+	data, _ := proto.Marshal(StateToProto(&VehicleState{VehicleID: "car-001", Latitude: 39.9, Longitude: 116.4, Altitude: math.Inf(-1)}))
+	var out VehicleState
+	if err := (ProtobufCodec{}).Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Altitude != 0 || out.Latitude != 39.9 {
+		t.Errorf("decoded %+v, want the altitude zeroed", out)
+	}
+
+	// An invalid state is left for the receiver's ValidateState to reject,
+	// not passed off as a valid one at speed 0.
+	data, _ = proto.Marshal(StateToProto(&VehicleState{VehicleID: "car-001", Speed: float32(math.NaN()), Latitude: 39.9, Longitude: 116.4}))
+	out = VehicleState{}
+	if err := (ProtobufCodec{}).Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateState(&out); err == nil {
+		t.Errorf("decoded %+v, want a state ValidateState rejects", out)
+	}
+}
+
+func TestSanitizeReportsFields(t *testing.T) {
+	s := VehicleState{Speed: 5, Heading: float32(math.NaN()), Latitude: 1, Longitude: 2}
+	if got := s.Sanitize(); len(got) != 1 || got[0] != "heading" {
+		t.Errorf("Sanitize = %v, want [heading]", got)
+	}
+	if got := s.Sanitize(); got != nil {
+		t.Errorf("second Sanitize = %v, want nil", got)
+	}
+	if s.Speed != 5 || s.Latitude != 1 || s.Longitude != 2 {
+		t.Errorf("finite fields changed: %+v", s)
+	}
+}
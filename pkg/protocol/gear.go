@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var gearNames = map[Gear]string{
+	GearUnknown: "unknown",
+	GearPark:    "park",
+	GearDrive:   "drive",
+	GearReverse: "reverse",
+	GearNeutral: "neutral",
+}
+
+// String returns the lower-case gear name, e.g. "drive", or "unknown" for a
+// value outside the defined gears.
+func (g Gear) String() string {
+	if name, ok := gearNames[g]; ok {
+		return name
+	}
+	return gearNames[GearUnknown]
+}
+
+// ParseGear parses a gear name as returned by String. It is case-insensitive
+// and also accepts the proto enum names such as "GEAR_DRIVE".
+func ParseGear(s string) (Gear, error) {
+	name := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "gear_")
+	for g, n := range gearNames {
+		if n == name {
+			return g, nil
+		}
+	}
+	return GearUnknown, fmt.Errorf("protocol: unknown gear %q", s)
+}
+
+// MarshalJSON encodes g as its name, so payloads read "gear":"drive".
+func (g Gear) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.String())
+}
+
+// UnmarshalJSON accepts a gear name or, for senders predating named gears,
+// its integer value. Unrecognised names and values decode as GearUnknown.
+func (g *Gear) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*g, _ = ParseGear(name)
+		return nil
+	}
+	var n int32
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("protocol: gear must be a name or an integer, got %s", data)
+	}
+	*g = Gear(n)
+	if _, ok := gearNames[*g]; !ok {
+		*g = GearUnknown
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGearString(t *testing.T) {
+	for g, want := range map[Gear]string{
+		GearUnknown: "unknown", GearPark: "park", GearDrive: "drive",
+		GearReverse: "reverse", GearNeutral: "neutral", Gear(42): "unknown",
+	} {
+		if got := g.String(); got != want {
+			t.Errorf("Gear(%d).String() = %q, want %q", int32(g), got, want)
+		}
+	}
+}
+
+func TestParseGear(t *testing.T) {
+	for in, want := range map[string]Gear{"drive": GearDrive, " Park ": GearPark, "GEAR_REVERSE": GearReverse, "unknown": GearUnknown} {
+		if got, err := ParseGear(in); err != nil || got != want {
+			t.Errorf("ParseGear(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseGear("overdrive"); err == nil {
+		t.Error("ParseGear accepted an unknown name")
+	}
+}
+
+func TestGearJSONWritesName(t *testing.T) {
+	data, err := Marshal(&VehicleState{VehicleID: "car-001", Gear: GearReverse})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"gear":"reverse"`) {
+		t.Errorf("payload %s does not carry the gear name", data)
+	}
+	data, _ = Marshal(&VehicleState{Gear: Gear(9)})
+	if !strings.Contains(string(data), `"gear":"unknown"`) {
+		t.Errorf("payload %s: out-of-range gear should encode as unknown", data)
+	}
+}
+
+func TestGearJSONDecode(t *testing.T) {
+	for payload, want := range map[string]Gear{
+		`{"gear":"drive"}`:   GearDrive,
+		`{"gear":"NEUTRAL"}`: GearNeutral,
+		`{"gear":"hover"}`:   GearUnknown,
+		`{"gear":2}`:         GearDrive, // integer wire format of older senders
+		`{"gear":3}`:         GearReverse,
+		`{"gear":17}`:        GearUnknown,
+		`{"vehicle_id":"x"}`: GearUnknown,
+	} {
+		var s VehicleState
+		if err := Unmarshal([]byte(payload), &s); err != nil {
+			t.Errorf("Unmarshal(%s): %v", payload, err)
+			continue
+		}
+		if s.Gear != want {
+			t.Errorf("Unmarshal(%s).Gear = %v, want %v", payload, s.Gear, want)
+		}
+	}
+	var s VehicleState
+	if err := Unmarshal([]byte(`{"gear":true}`), &s); err == nil {
+		t.Error("boolean gear accepted")
+	}
+}
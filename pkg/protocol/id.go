@@ -0,0 +1,14 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// NewID returns a random 128-bit hex identifier suitable for CommandID and
+// AlertID values.
+func NewID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
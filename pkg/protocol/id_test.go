@@ -0,0 +1,13 @@
+package protocol
+
+import "testing"
+
+func TestNewIDUnique(t *testing.T) {
+	a, b := NewID(), NewID()
+	if len(a) != 32 {
+		t.Errorf("len(NewID()) = %d, want 32", len(a))
+	}
+	if a == b {
+		t.Errorf("NewID returned %q twice", a)
+	}
+}
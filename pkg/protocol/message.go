@@ -2,11 +2,7 @@
 // across the vlink communication framework.
 package protocol
 
-import (
-	"encoding/json"
-	"fmt"
-	"time"
-)
+import "time"
 
 // Gear represents the vehicle's transmission gear.
 type Gear int32
@@ -21,17 +17,32 @@ const (
 
 // VehicleState is published by the vehicle at 10–50 Hz to v1/vehicle/{id}/state.
 type VehicleState struct {
-	VehicleID   string  `json:"vehicle_id"`
-	Timestamp   int64   `json:"timestamp"` // Unix milliseconds
-	Latitude    float64 `json:"latitude"`
-	Longitude   float64 `json:"longitude"`
-	Altitude    float64 `json:"altitude"`
-	Speed       float32 `json:"speed"`       // m/s
-	Heading     float32 `json:"heading"`     // degrees 0-360
-	Gear        Gear    `json:"gear"`
-	BatteryPct  float32 `json:"battery_pct"` // 0-100
-	Mode        string  `json:"mode"`        // autonomous / manual / teleoperation
-	Emergency   bool    `json:"emergency"`
+	VehicleID  string  `json:"vehicle_id"`
+	Timestamp  int64   `json:"timestamp"` // Unix milliseconds
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Altitude   float64 `json:"altitude"`
+	Speed      float32 `json:"speed"`   // m/s
+	Heading    float32 `json:"heading"` // degrees 0-360
+	Gear       Gear    `json:"gear"`
+	BatteryPct float32 `json:"battery_pct"` // 0-100
+	Mode       string  `json:"mode"`        // autonomous / manual / teleoperation
+	Emergency  bool    `json:"emergency"`
+	// Seq increases by one with every state the vehicle publishes, letting
+	// receivers detect lost messages. Zero means the sender does not number
+	// its states.
+	Seq uint64 `json:"seq,omitempty"`
+	// RequestID is set only on a state published in answer to an
+	// ActionRequestState command and carries that command's CommandID.
+	RequestID string `json:"request_id,omitempty"`
+	// Replayed marks a state buffered by the vehicle while it was offline
+	// and published after reconnecting, so receivers do not treat it as a
+	// live report.
+	Replayed bool `json:"replayed,omitempty"`
+	// Sensors reports the health of individual sensors, e.g.
+	// {"lidar":"ok","gps":"degraded"}. Vehicles that do not monitor their
+	// sensors leave it zero and the field is omitted.
+	Sensors SensorHealth `json:"sensors,omitzero"`
 }
 
 // ControlCommand is published by the control center to v1/vehicle/{id}/control.
@@ -39,20 +50,122 @@ type ControlCommand struct {
 	CommandID     string  `json:"command_id"`
 	VehicleID     string  `json:"vehicle_id"`
 	Timestamp     int64   `json:"timestamp"` // Unix milliseconds
-	Action        string  `json:"action"`    // stop / resume / teleoperation_start
+	Action        string  `json:"action"`    // stop / resume / teleoperation_start / follow_trajectory
 	TargetSpeed   float32 `json:"target_speed"`
 	TargetHeading float32 `json:"target_heading"`
 	Payload       string  `json:"payload"` // JSON-encoded extra parameters
+	// HasTargetSpeed distinguishes an explicit TargetSpeed (including 0)
+	// from an unset one. Use SetTargetSpeed to populate both fields.
+	HasTargetSpeed bool `json:"has_target_speed,omitempty"`
+	// TraceParent carries the W3C trace context of the control center's
+	// span for this command when tracing is enabled.
+	TraceParent string `json:"trace_parent,omitempty"`
+	// Trajectory is the path of an ActionFollowTrajectory command.
+	Trajectory *Trajectory `json:"trajectory,omitempty"`
+}
+
+// SetTargetSpeed sets an explicit target speed in m/s. On a resume command an
+// explicit 0 means "hold stop", whereas leaving the speed unset resumes the
+// vehicle's prior autonomous speed.
+func (c *ControlCommand) SetTargetSpeed(v float32) {
+	c.TargetSpeed = v
+	c.HasTargetSpeed = true
 }
 
 // TeleoperationAlert is sent by the vehicle when human intervention is needed.
 type TeleoperationAlert struct {
+	// AlertID is generated by the vehicle and stays the same across QoS 1
+	// redeliveries, allowing receivers to drop duplicates.
+	AlertID   string  `json:"alert_id,omitempty"`
 	VehicleID string  `json:"vehicle_id"`
 	Timestamp int64   `json:"timestamp"` // Unix milliseconds
 	Reason    string  `json:"reason"`    // extreme_weather / unmarked_construction
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 	Severity  int32   `json:"severity"` // 1 (low) – 3 (critical)
+	// Occurrences is set by the control center when it suppresses repeats
+	// (see teleoperation.Config.RepeatWindow): the number of alerts with
+	// this vehicle and reason that this one stands for, itself included.
+	// Zero means the alert was not subject to repeat suppression.
+	Occurrences int32 `json:"occurrences,omitempty"`
+}
+
+// FeedAlert is republished by the control center to AlertFeedTopic for every
+// alert it accepts. The alert's fields are inlined alongside the metadata.
+type FeedAlert struct {
+	TeleoperationAlert
+	ReceivedAt       int64  `json:"received_at"` // Unix milliseconds, center clock
+	AssignedOperator string `json:"assigned_operator,omitempty"`
+}
+
+// Control actions understood by the vehicle agent.
+const (
+	ActionStop               = "stop"
+	ActionResume             = "resume"
+	ActionTeleoperationStart = "teleoperation_start"
+	// ActionCancel interrupts the task running an earlier command; its
+	// Payload is a CancelPayload. The vehicle acks it completed, or
+	// rejected when no such task is running.
+	ActionCancel = "cancel"
+	// ActionRequestState asks the vehicle to publish a fresh state at once.
+	ActionRequestState = "request_state"
+	// ActionSetPublishHz temporarily overrides the vehicle's state publish
+	// rate; its Payload is a PublishHzPayload.
+	ActionSetPublishHz = "set_publish_hz"
+	// ActionResetPublishHz reverts to the vehicle's configured publish rate.
+	ActionResetPublishHz = "reset_publish_hz"
+	// ActionSetSpeed changes the target speed (TargetSpeed) without
+	// changing the driving mode.
+	ActionSetSpeed = "set_speed"
+	// ActionFollowTrajectory sends the vehicle along the path in the
+	// command's Trajectory (see ControlCommand.MarshalTrajectory).
+	ActionFollowTrajectory = "follow_trajectory"
+)
+
+// CancelPayload is the Payload of an ActionCancel command.
+type CancelPayload struct {
+	CommandID string `json:"command_id"`
+}
+
+// PublishHzPayload is the Payload of an ActionSetPublishHz command.
+type PublishHzPayload struct {
+	Hz float64 `json:"hz"`
+}
+
+// Acknowledgement statuses reported in CommandAck.Status.
+const (
+	AckAccepted  = "accepted"
+	AckRejected  = "rejected"
+	AckCompleted = "completed"
+	// AckInProgress reports the progress of a long-running command. The
+	// vehicle publishes it repeatedly until a final status follows.
+	AckInProgress = "in_progress"
+	// AckSuperseded reports a command discarded in favour of a newer one of
+	// the same kind that arrived shortly after it.
+	AckSuperseded = "superseded"
+)
+
+// CommandAck is published by the vehicle to v1/vehicle/{id}/ack after it
+// processes a ControlCommand. It is correlated with the command by CommandID.
+type CommandAck struct {
+	CommandID string `json:"command_id"`
+	VehicleID string `json:"vehicle_id"`
+	Status    string `json:"status"` // accepted / in_progress / rejected / completed / superseded
+	Reason    string `json:"reason,omitempty"`
+	Timestamp int64  `json:"timestamp"` // Unix milliseconds, vehicle clock
+	// Progress (0-100) and ETA (milliseconds remaining) are set on
+	// in_progress acks. Zero means unknown.
+	Progress float32 `json:"progress,omitempty"`
+	ETA      int64   `json:"eta_ms,omitempty"`
+	// TraceParent carries the trace context back to the control center: the
+	// vehicle's span if it traces commands, otherwise the command's own.
+	TraceParent string `json:"trace_parent,omitempty"`
+}
+
+// Final reports whether the ack ends its command, i.e. no further acks for
+// the same CommandID are expected.
+func (a *CommandAck) Final() bool {
+	return a.Status != AckAccepted && a.Status != AckInProgress
 }
 
 // NewVehicleState creates a VehicleState stamped with the current time.
@@ -60,51 +173,110 @@ func NewVehicleState(id string) *VehicleState {
 	return &VehicleState{
 		VehicleID: id,
 		Timestamp: time.Now().UnixMilli(),
-		Mode:      "autonomous",
+		Mode:      ModeAutonomous,
 	}
 }
 
 // Marshal serialises a message to JSON bytes.
 func Marshal(v any) ([]byte, error) {
-	return json.Marshal(v)
+	return JSONCodec{}.Marshal(v)
 }
 
 // Unmarshal deserialises JSON bytes into the target struct.
 func Unmarshal(data []byte, v any) error {
-	return json.Unmarshal(data, v)
+	return JSONCodec{}.Unmarshal(data, v)
 }
 
 // --- MQTT topic helpers ---
-
-const topicPrefix = "v1/vehicle"
+//
+// The package-level helpers use DefaultTopicPrefix. See Topics for other
+// prefixes, e.g. while migrating between protocol versions.
 
 // StateTopic returns the state publish topic for a vehicle.
 //
 //	v1/vehicle/{id}/state
 func StateTopic(vehicleID string) string {
-	return fmt.Sprintf("%s/%s/state", topicPrefix, vehicleID)
+	return DefaultTopics.State(vehicleID)
 }
 
 // ControlTopic returns the control subscribe topic for a vehicle.
 //
 //	v1/vehicle/{id}/control
 func ControlTopic(vehicleID string) string {
-	return fmt.Sprintf("%s/%s/control", topicPrefix, vehicleID)
+	return DefaultTopics.Control(vehicleID)
 }
 
 // AlertTopic returns the teleoperation alert topic for a vehicle.
 //
 //	v1/vehicle/{id}/alert
 func AlertTopic(vehicleID string) string {
-	return fmt.Sprintf("%s/%s/alert", topicPrefix, vehicleID)
+	return DefaultTopics.Alert(vehicleID)
+}
+
+// AckTopic returns the command acknowledgement topic for a vehicle.
+//
+//	v1/vehicle/{id}/ack
+func AckTopic(vehicleID string) string {
+	return DefaultTopics.Ack(vehicleID)
+}
+
+// StreamTopic returns the video stream signaling topic for a vehicle.
+//
+//	v1/vehicle/{id}/stream
+func StreamTopic(vehicleID string) string {
+	return DefaultTopics.Stream(vehicleID)
+}
+
+// ConfigQueryTopic returns the config query topic for a vehicle.
+//
+//	v1/vehicle/{id}/config_query
+func ConfigQueryTopic(vehicleID string) string {
+	return DefaultTopics.ConfigQuery(vehicleID)
+}
+
+// ConfigTopic returns the config report topic for a vehicle.
+//
+//	v1/vehicle/{id}/config
+func ConfigTopic(vehicleID string) string {
+	return DefaultTopics.Config(vehicleID)
+}
+
+// StatusTopic returns the connection status topic for a vehicle.
+//
+//	v1/vehicle/{id}/status
+func StatusTopic(vehicleID string) string {
+	return DefaultTopics.Status(vehicleID)
 }
 
 // WildcardStateTopic returns a broker-side wildcard for all vehicle state topics.
 func WildcardStateTopic() string {
-	return fmt.Sprintf("%s/+/state", topicPrefix)
+	return DefaultTopics.WildcardState()
 }
 
 // WildcardAlertTopic returns a broker-side wildcard for all vehicle alert topics.
 func WildcardAlertTopic() string {
-	return fmt.Sprintf("%s/+/alert", topicPrefix)
+	return DefaultTopics.WildcardAlert()
+}
+
+// WildcardAckTopic returns a broker-side wildcard for all vehicle ack topics.
+func WildcardAckTopic() string {
+	return DefaultTopics.WildcardAck()
+}
+
+// WildcardStreamTopic returns a broker-side wildcard for all vehicle stream
+// signaling topics.
+func WildcardStreamTopic() string {
+	return DefaultTopics.WildcardStream()
+}
+
+// WildcardConfigTopic returns a broker-side wildcard for all vehicle config
+// report topics.
+func WildcardConfigTopic() string {
+	return DefaultTopics.WildcardConfig()
+}
+
+// WildcardStatusTopic returns a broker-side wildcard for all vehicle status
+// topics.
+func WildcardStatusTopic() string {
+	return DefaultTopics.WildcardStatus()
 }
@@ -29,6 +29,14 @@ func TestAlertTopic(t *testing.T) {
 	}
 }
 
+func TestAckTopic(t *testing.T) {
+	got := AckTopic("car-001")
+	want := "v1/vehicle/car-001/ack"
+	if got != want {
+		t.Errorf("AckTopic = %q, want %q", got, want)
+	}
+}
+
 func TestWildcardTopics(t *testing.T) {
 	if got := WildcardStateTopic(); got != "v1/vehicle/+/state" {
 		t.Errorf("WildcardStateTopic = %q", got)
@@ -36,6 +44,18 @@ func TestWildcardTopics(t *testing.T) {
 	if got := WildcardAlertTopic(); got != "v1/vehicle/+/alert" {
 		t.Errorf("WildcardAlertTopic = %q", got)
 	}
+	if got := WildcardAckTopic(); got != "v1/vehicle/+/ack" {
+		t.Errorf("WildcardAckTopic = %q", got)
+	}
+	if got := WildcardStatusTopic(); got != "v1/vehicle/+/status" {
+		t.Errorf("WildcardStatusTopic = %q", got)
+	}
+}
+
+func TestStatusTopic(t *testing.T) {
+	if got := StatusTopic("car-001"); got != "v1/vehicle/car-001/status" {
+		t.Errorf("StatusTopic = %q", got)
+	}
 }
 
 func TestMarshalUnmarshalVehicleState(t *testing.T) {
@@ -109,3 +129,26 @@ func TestNewVehicleState(t *testing.T) {
 		t.Errorf("Mode = %q, want autonomous", s.Mode)
 	}
 }
+
+func TestTargetSpeedExplicitZeroRoundTrip(t *testing.T) {
+	unset := &ControlCommand{Action: ActionResume}
+	explicit := &ControlCommand{Action: ActionResume}
+	explicit.SetTargetSpeed(0)
+
+	for _, tc := range []struct {
+		cmd  *ControlCommand
+		want bool
+	}{{unset, false}, {explicit, true}} {
+		data, err := Marshal(tc.cmd)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		decoded := &ControlCommand{}
+		if err := Unmarshal(data, decoded); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if decoded.HasTargetSpeed != tc.want {
+			t.Errorf("HasTargetSpeed = %v, want %v (payload %s)", decoded.HasTargetSpeed, tc.want, data)
+		}
+	}
+}
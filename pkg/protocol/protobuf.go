@@ -0,0 +1,300 @@
+package protocol
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/daohu527/vlink/pkg/vlinkpb"
+)
+
+// ProtobufCodec encodes VehicleState, ControlCommand and TeleoperationAlert
+// as the messages of proto/vlink.proto (package vlinkpb), which for a typical
+// state is less than half the size of its JSON. Other message types are
+// written as JSON.
+//
+// Unmarshal also accepts JSON, recognised by its leading '{' (never a valid
+// protobuf tag for these messages), so a node switched to ProtobufCodec
+// still understands peers that have not been. See CompatCodec for migrating
+// a fleet.
+type ProtobufCodec struct{}
+
+// Name returns "protobuf".
+func (ProtobufCodec) Name() string { return "protobuf" }
+
+// Marshal encodes v, which may be a message or a pointer to one.
+func (ProtobufCodec) Marshal(v any) ([]byte, error) {
+	switch m := sanitizeCopy(v).(type) {
+	case *VehicleState:
+		return proto.Marshal(StateToProto(m))
+	case VehicleState:
+		return proto.Marshal(StateToProto(&m))
+	case *ControlCommand:
+		return proto.Marshal(CommandToProto(m))
+	case ControlCommand:
+		return proto.Marshal(CommandToProto(&m))
+	case *TeleoperationAlert:
+		return proto.Marshal(AlertToProto(m))
+	case TeleoperationAlert:
+		return proto.Marshal(AlertToProto(&m))
+	}
+	return JSONCodec{}.Marshal(v)
+}
+
+// Unmarshal decodes protobuf or JSON data into v.
+func (ProtobufCodec) Unmarshal(data []byte, v any) error {
+	if isJSON(data) {
+		return JSONCodec{}.Unmarshal(data, v)
+	}
+	var err error
+	switch m := v.(type) {
+	case *VehicleState:
+		var pb vlinkpb.VehicleState
+		if err = proto.Unmarshal(data, &pb); err == nil {
+			*m = *StateFromProto(&pb)
+		}
+	case *ControlCommand:
+		var pb vlinkpb.ControlCommand
+		if err = proto.Unmarshal(data, &pb); err == nil {
+			*m = *CommandFromProto(&pb)
+		}
+	case *TeleoperationAlert:
+		var pb vlinkpb.TeleoperationAlert
+		if err = proto.Unmarshal(data, &pb); err == nil {
+			*m = *AlertFromProto(&pb)
+		}
+	default:
+		return JSONCodec{}.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("protocol: decode %T: %w", v, err)
+	}
+	sanitizeDecoded(v)
+	return nil
+}
+
+// CompatCodec writes JSON, like JSONCodec, but reads both JSON and protobuf.
+// To migrate a fleet from JSON to protobuf without a flag day, first move
+// every node to CompatCodec, then switch nodes to ProtobufCodec one at a
+// time: each side can read whatever the other writes throughout.
+type CompatCodec struct{}
+
+// Name returns "compat".
+func (CompatCodec) Name() string { return "compat" }
+
+// Marshal encodes v as JSON.
+func (CompatCodec) Marshal(v any) ([]byte, error) { return JSONCodec{}.Marshal(v) }
+
+// Unmarshal decodes protobuf or JSON data into v.
+func (CompatCodec) Unmarshal(data []byte, v any) error { return ProtobufCodec{}.Unmarshal(data, v) }
+
+// CodecByName returns the registered codec called name, or CompatCodec for
+// "compat".
+func CodecByName(name string) (Codec, error) {
+	if name == (CompatCodec{}).Name() {
+		return CompatCodec{}, nil
+	}
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("protocol: unknown codec %q", name)
+	}
+	return c, nil
+}
+
+// isJSON reports whether data is a JSON object, i.e. its first
+// non-whitespace byte is '{'.
+func isJSON(data []byte) bool {
+	for _, c := range data {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return c == '{'
+	}
+	return false
+}
+
+// StateToProto converts s to its vlinkpb message.
+func StateToProto(s *VehicleState) *vlinkpb.VehicleState {
+	pb := &vlinkpb.VehicleState{
+		VehicleId:  s.VehicleID,
+		Timestamp:  s.Timestamp,
+		Latitude:   s.Latitude,
+		Longitude:  s.Longitude,
+		Altitude:   s.Altitude,
+		Speed:      s.Speed,
+		Heading:    s.Heading,
+		Gear:       vlinkpb.Gear(s.Gear),
+		BatteryPct: s.BatteryPct,
+		Mode:       s.Mode,
+		Emergency:  s.Emergency,
+		Seq:        s.Seq,
+		RequestId:  s.RequestID,
+		Replayed:   s.Replayed,
+	}
+	if s.Sensors != (SensorHealth{}) {
+		pb.Sensors = &vlinkpb.SensorHealth{
+			Lidar:  vlinkpb.SensorStatus(s.Sensors.Lidar),
+			Camera: vlinkpb.SensorStatus(s.Sensors.Camera),
+			Gps:    vlinkpb.SensorStatus(s.Sensors.GPS),
+			Imu:    vlinkpb.SensorStatus(s.Sensors.IMU),
+		}
+	}
+	return pb
+}
+
+// StateFromProto converts a vlinkpb message to a VehicleState. Sensor
+// statuses this version does not know decode as SensorUnknown.
+func StateFromProto(pb *vlinkpb.VehicleState) *VehicleState {
+	s := &VehicleState{
+		VehicleID:  pb.GetVehicleId(),
+		Timestamp:  pb.GetTimestamp(),
+		Latitude:   pb.GetLatitude(),
+		Longitude:  pb.GetLongitude(),
+		Altitude:   pb.GetAltitude(),
+		Speed:      pb.GetSpeed(),
+		Heading:    pb.GetHeading(),
+		Gear:       Gear(pb.GetGear()),
+		BatteryPct: pb.GetBatteryPct(),
+		Mode:       pb.GetMode(),
+		Emergency:  pb.GetEmergency(),
+		Seq:        pb.GetSeq(),
+		RequestID:  pb.GetRequestId(),
+		Replayed:   pb.GetReplayed(),
+	}
+	if h := pb.GetSensors(); h != nil {
+		s.Sensors = SensorHealth{
+			Lidar:  sensorStatus(h.GetLidar()),
+			Camera: sensorStatus(h.GetCamera()),
+			GPS:    sensorStatus(h.GetGps()),
+			IMU:    sensorStatus(h.GetImu()),
+		}
+	}
+	return s
+}
+
+// CommandToProto converts c to its vlinkpb message.
+func CommandToProto(c *ControlCommand) *vlinkpb.ControlCommand {
+	return &vlinkpb.ControlCommand{
+		CommandId:      c.CommandID,
+		VehicleId:      c.VehicleID,
+		Timestamp:      c.Timestamp,
+		Action:         c.Action,
+		TargetSpeed:    c.TargetSpeed,
+		TargetHeading:  c.TargetHeading,
+		Payload:        c.Payload,
+		HasTargetSpeed: c.HasTargetSpeed,
+		TraceParent:    c.TraceParent,
+		Trajectory:     trajectoryToProto(c.Trajectory),
+	}
+}
+
+// CommandFromProto converts a vlinkpb message to a ControlCommand.
+func CommandFromProto(pb *vlinkpb.ControlCommand) *ControlCommand {
+	return &ControlCommand{
+		CommandID:      pb.GetCommandId(),
+		VehicleID:      pb.GetVehicleId(),
+		Timestamp:      pb.GetTimestamp(),
+		Action:         pb.GetAction(),
+		TargetSpeed:    pb.GetTargetSpeed(),
+		TargetHeading:  pb.GetTargetHeading(),
+		Payload:        pb.GetPayload(),
+		HasTargetSpeed: pb.GetHasTargetSpeed(),
+		TraceParent:    pb.GetTraceParent(),
+		Trajectory:     trajectoryFromProto(pb.GetTrajectory()),
+	}
+}
+
+// trajectoryToProto converts t, which may be nil, to its vlinkpb message.
+func trajectoryToProto(t *Trajectory) *vlinkpb.Trajectory {
+	if t == nil {
+		return nil
+	}
+	pb := &vlinkpb.Trajectory{Waypoints: make([]*vlinkpb.Waypoint, len(t.Waypoints))}
+	for i, w := range t.Waypoints {
+		pb.Waypoints[i] = &vlinkpb.Waypoint{
+			Lat:         w.Latitude,
+			Lon:         w.Longitude,
+			TargetSpeed: w.TargetSpeed,
+			EtaOffsetMs: w.ETAOffset,
+		}
+	}
+	return pb
+}
+
+// trajectoryFromProto converts a vlinkpb message, which may be nil, to a
+// Trajectory.
+func trajectoryFromProto(pb *vlinkpb.Trajectory) *Trajectory {
+	if pb == nil {
+		return nil
+	}
+	t := &Trajectory{Waypoints: make([]Waypoint, len(pb.GetWaypoints()))}
+	for i, w := range pb.GetWaypoints() {
+		t.Waypoints[i] = Waypoint{
+			Latitude:    w.GetLat(),
+			Longitude:   w.GetLon(),
+			TargetSpeed: w.GetTargetSpeed(),
+			ETAOffset:   w.GetEtaOffsetMs(),
+		}
+	}
+	return t
+}
+
+// AlertToProto converts a to its vlinkpb message.
+func AlertToProto(a *TeleoperationAlert) *vlinkpb.TeleoperationAlert {
+	return &vlinkpb.TeleoperationAlert{
+		VehicleId:   a.VehicleID,
+		Timestamp:   a.Timestamp,
+		Reason:      a.Reason,
+		Latitude:    a.Latitude,
+		Longitude:   a.Longitude,
+		Severity:    a.Severity,
+		AlertId:     a.AlertID,
+		Occurrences: a.Occurrences,
+	}
+}
+
+// AlertFromProto converts a vlinkpb message to a TeleoperationAlert.
+func AlertFromProto(pb *vlinkpb.TeleoperationAlert) *TeleoperationAlert {
+	return &TeleoperationAlert{
+		VehicleID:   pb.GetVehicleId(),
+		Timestamp:   pb.GetTimestamp(),
+		Reason:      pb.GetReason(),
+		Latitude:    pb.GetLatitude(),
+		Longitude:   pb.GetLongitude(),
+		Severity:    pb.GetSeverity(),
+		AlertID:     pb.GetAlertId(),
+		Occurrences: pb.GetOccurrences(),
+	}
+}
+
+// AckToProto converts a to its vlinkpb message. ProtobufCodec leaves acks
+// as JSON on MQTT; the gRPC API returns them as protobuf.
+func AckToProto(a *CommandAck) *vlinkpb.CommandAck {
+	return &vlinkpb.CommandAck{
+		CommandId:   a.CommandID,
+		VehicleId:   a.VehicleID,
+		Status:      a.Status,
+		Reason:      a.Reason,
+		Timestamp:   a.Timestamp,
+		TraceParent: a.TraceParent,
+		Progress:    a.Progress,
+		EtaMs:       a.ETA,
+	}
+}
+
+// AckFromProto converts a vlinkpb message to a CommandAck.
+func AckFromProto(pb *vlinkpb.CommandAck) *CommandAck {
+	return &CommandAck{
+		CommandID:   pb.GetCommandId(),
+		VehicleID:   pb.GetVehicleId(),
+		Status:      pb.GetStatus(),
+		Reason:      pb.GetReason(),
+		Timestamp:   pb.GetTimestamp(),
+		TraceParent: pb.GetTraceParent(),
+		Progress:    pb.GetProgress(),
+		ETA:         pb.GetEtaMs(),
+	}
+}
@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var typicalState = &VehicleState{
+	VehicleID: "car-001", Timestamp: 1_700_000_000_000,
+	Latitude: 39.9042, Longitude: 116.4074, Altitude: 43.5,
+	Speed: 12.5, Heading: 87.25, Gear: GearDrive, BatteryPct: 76.5,
+	Mode: "autonomous", Seq: 1234,
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	c := ProtobufCodec{}
+	cmd := &ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Timestamp: 42, Action: ActionResume,
+		TargetHeading: 180, Payload: `{"x":1}`, TraceParent: "00-abc-def-01"}
+	cmd.SetTargetSpeed(0)
+	alert := &TeleoperationAlert{AlertID: "a-1", VehicleID: "car-001", Timestamp: 42, Reason: "extreme_weather",
+		Latitude: -33.8688, Longitude: 151.2093, Severity: 3, Occurrences: 4}
+
+	replayed := *typicalState
+	replayed.Replayed = true
+	monitored := *typicalState
+	monitored.Sensors = SensorHealth{Lidar: SensorOK, GPS: SensorDegraded, IMU: SensorFailed}
+
+	for _, tc := range []struct{ in, out any }{
+		{typicalState, &VehicleState{Mode: "stale"}},
+		{&replayed, &VehicleState{}},
+		{&monitored, &VehicleState{}},
+		{cmd, &ControlCommand{}},
+		{alert, &TeleoperationAlert{}},
+	} {
+		data, err := c.Marshal(tc.in)
+		if err != nil {
+			t.Fatalf("Marshal %T: %v", tc.in, err)
+		}
+		if err := c.Unmarshal(data, tc.out); err != nil {
+			t.Fatalf("Unmarshal %T: %v", tc.out, err)
+		}
+		want, _ := json.Marshal(tc.in)
+		got, _ := json.Marshal(tc.out)
+		if string(got) != string(want) {
+			t.Errorf("round trip %T:\n got %s\nwant %s", tc.in, got, want)
+		}
+	}
+}
+
+func TestProtobufSmallerThanJSON(t *testing.T) {
+	pb, _ := ProtobufCodec{}.Marshal(typicalState)
+	js, _ := JSONCodec{}.Marshal(typicalState)
+	if len(pb)*2 > len(js) {
+		t.Errorf("protobuf state is %d bytes, JSON %d; want less than half", len(pb), len(js))
+	}
+}
+
+func TestCodecsReadEachOther(t *testing.T) {
+	pb, _ := ProtobufCodec{}.Marshal(typicalState)
+	js, _ := JSONCodec{}.Marshal(typicalState)
+
+	for name, c := range map[string]Codec{"protobuf": ProtobufCodec{}, "compat": CompatCodec{}} {
+		for format, data := range map[string][]byte{"protobuf": pb, "json": js} {
+			var got VehicleState
+			if err := c.Unmarshal(data, &got); err != nil {
+				t.Errorf("%s reading %s: %v", name, format, err)
+			} else if got != *typicalState {
+				t.Errorf("%s reading %s = %+v", name, format, got)
+			}
+		}
+	}
+	if out, _ := (CompatCodec{}).Marshal(typicalState); string(out) != string(js) {
+		t.Errorf("CompatCodec wrote %q, want JSON", out)
+	}
+	if err := (JSONCodec{}).Unmarshal(pb, &VehicleState{}); err == nil {
+		t.Error("JSONCodec accepted protobuf")
+	}
+}
+
+func TestProtobufFallsBackToJSON(t *testing.T) {
+	in := &CommandAck{CommandID: "cmd-1", Status: AckCompleted}
+	data, err := ProtobufCodec{}.Marshal(in)
+	if err != nil || data[0] != '{' {
+		t.Fatalf("Marshal(CommandAck) = %q, %v; want JSON", data, err)
+	}
+	var out CommandAck
+	if err := (ProtobufCodec{}).Unmarshal(data, &out); err != nil || out != *in {
+		t.Errorf("Unmarshal = %+v, %v", out, err)
+	}
+}
+
+func TestCodecByName(t *testing.T) {
+	for _, name := range []string{"json", "protobuf", "compat"} {
+		if c, err := CodecByName(name); err != nil || c.Name() != name {
+			t.Errorf("CodecByName(%q) = %v, %v", name, c, err)
+		}
+	}
+	if _, err := CodecByName("xml"); err == nil {
+		t.Error("unknown codec accepted")
+	}
+}
+
+func BenchmarkStateJSON(b *testing.B)     { benchmarkState(b, JSONCodec{}) }
+func BenchmarkStateProtobuf(b *testing.B) { benchmarkState(b, ProtobufCodec{}) }
+
+func benchmarkState(b *testing.B, c Codec) {
+	var size int
+	var out VehicleState
+	for i := 0; i < b.N; i++ {
+		data, _ := c.Marshal(typicalState)
+		_ = c.Unmarshal(data, &out)
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes/msg")
+}
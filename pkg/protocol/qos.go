@@ -0,0 +1,30 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidQoS is returned by ValidateQoS.
+var ErrInvalidQoS = errors.New("protocol: invalid QoS")
+
+// QoS returns a pointer to level, for the optional QoS fields of the agent
+// and control-center configs, where nil keeps the default.
+func QoS(level byte) *byte { return &level }
+
+// QoSOr returns the level qos points to, or def if qos is nil.
+func QoSOr(qos *byte, def byte) byte {
+	if qos == nil {
+		return def
+	}
+	return *qos
+}
+
+// ValidateQoS checks that qos, configured as name, is unset or an MQTT QoS
+// level: 0, 1 or 2.
+func ValidateQoS(name string, qos *byte) error {
+	if qos != nil && *qos > 2 {
+		return fmt.Errorf("%w: %s %d, want 0, 1 or 2", ErrInvalidQoS, name, *qos)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateQoS(t *testing.T) {
+	for _, qos := range []*byte{nil, QoS(0), QoS(1), QoS(2)} {
+		if err := ValidateQoS("StateQoS", qos); err != nil {
+			t.Errorf("ValidateQoS(%v) = %v", qos, err)
+		}
+	}
+	if err := ValidateQoS("StateQoS", QoS(3)); !errors.Is(err, ErrInvalidQoS) {
+		t.Errorf("ValidateQoS(3) = %v, want ErrInvalidQoS", err)
+	}
+}
+
+func TestQoSOr(t *testing.T) {
+	if got := QoSOr(nil, 1); got != 1 {
+		t.Errorf("QoSOr(nil, 1) = %d, want the default", got)
+	}
+	if got := QoSOr(QoS(0), 1); got != 0 {
+		t.Errorf("QoSOr(0, 1) = %d, want an explicit 0 kept", got)
+	}
+}
@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testPayloadKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestPayloadCipherRoundTrip(t *testing.T) {
+	c, err := NewPayloadCipher(testPayloadKey)
+	if err != nil {
+		t.Fatalf("NewPayloadCipher: %v", err)
+	}
+	cmd := &ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "unlock", Payload: `{"pin":"4711"}`}
+	sealed, err := c.Seal(cmd)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !IsSealedPayload(sealed) || strings.Contains(sealed, "4711") {
+		t.Fatalf("sealed payload %q leaks the plaintext", sealed)
+	}
+	if cmd.Payload != `{"pin":"4711"}` {
+		t.Error("Seal modified the command")
+	}
+
+	cmd.Payload = sealed
+	plain, err := c.Open(cmd)
+	if err != nil || plain != `{"pin":"4711"}` {
+		t.Errorf("Open = %q, %v", plain, err)
+	}
+
+	if s, _ := c.Seal(&ControlCommand{Action: "stop"}); s != "" {
+		t.Errorf("Seal of an empty payload = %q, want empty", s)
+	}
+}
+
+func TestPayloadCipherRejectsUnauthenticated(t *testing.T) {
+	c, _ := NewPayloadCipher(testPayloadKey)
+	other, _ := NewPayloadCipher([]byte("fedcba9876543210"))
+	cmd := &ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "unlock", Payload: "secret"}
+	sealed, _ := c.Seal(cmd)
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)-2] ^= 1
+
+	for name, tc := range map[string]struct {
+		c   *PayloadCipher
+		cmd ControlCommand
+	}{
+		"tampered":      {c, ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "unlock", Payload: string(tampered)}},
+		"other vehicle": {c, ControlCommand{CommandID: "cmd-1", VehicleID: "car-002", Action: "unlock", Payload: sealed}},
+		"other action":  {c, ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "stop", Payload: sealed}},
+		"wrong key":     {other, ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "unlock", Payload: sealed}},
+		"truncated":     {c, ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: "unlock", Payload: sealedPrefix + "AAAA"}},
+	} {
+		if _, err := tc.c.Open(&tc.cmd); !errors.Is(err, ErrPayloadAuth) {
+			t.Errorf("%s: Open error = %v, want ErrPayloadAuth", name, err)
+		}
+	}
+	if _, err := c.Open(&ControlCommand{Payload: "secret"}); !errors.Is(err, ErrPlaintextPayload) {
+		t.Errorf("Open(plaintext) error = %v, want ErrPlaintextPayload", err)
+	}
+}
+
+func TestNewPayloadCipherRejectsBadKey(t *testing.T) {
+	if _, err := NewPayloadCipher([]byte("short")); err == nil {
+		t.Error("expected an error for a 5-byte key")
+	}
+}
@@ -0,0 +1,107 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/daohu527/vlink/pkg/vlinkpb"
+)
+
+// SensorStatus is the health of one sensor as reported in
+// VehicleState.Sensors.
+type SensorStatus int32
+
+const (
+	SensorUnknown  SensorStatus = 0
+	SensorOK       SensorStatus = 1
+	SensorDegraded SensorStatus = 2
+	SensorFailed   SensorStatus = 3
+)
+
+var sensorStatusNames = map[SensorStatus]string{
+	SensorUnknown:  "unknown",
+	SensorOK:       "ok",
+	SensorDegraded: "degraded",
+	SensorFailed:   "failed",
+}
+
+// String returns the lower-case status name, e.g. "degraded", or "unknown"
+// for a value outside the defined statuses.
+func (s SensorStatus) String() string {
+	if name, ok := sensorStatusNames[s]; ok {
+		return name
+	}
+	return sensorStatusNames[SensorUnknown]
+}
+
+// ParseSensorStatus parses a status name as returned by String. It is
+// case-insensitive and also accepts the proto enum names such as
+// "SENSOR_DEGRADED".
+func ParseSensorStatus(s string) (SensorStatus, error) {
+	name := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "sensor_")
+	for st, n := range sensorStatusNames {
+		if n == name {
+			return st, nil
+		}
+	}
+	return SensorUnknown, fmt.Errorf("protocol: unknown sensor status %q", s)
+}
+
+// MarshalJSON encodes s as its name, so payloads read "lidar":"ok".
+func (s SensorStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON accepts a status name. Unrecognised names, e.g. from a newer
+// sender, decode as SensorUnknown.
+func (s *SensorStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("protocol: sensor status must be a name, got %s", data)
+	}
+	*s, _ = ParseSensorStatus(name)
+	return nil
+}
+
+// SensorHealth reports the status of a vehicle's sensors. A sensor the
+// vehicle does not monitor is left SensorUnknown and omitted on the wire.
+type SensorHealth struct {
+	Lidar  SensorStatus `json:"lidar,omitzero"`
+	Camera SensorStatus `json:"camera,omitzero"`
+	GPS    SensorStatus `json:"gps,omitzero"`
+	IMU    SensorStatus `json:"imu,omitzero"`
+}
+
+// sensorField is one field of a SensorHealth and its JSON name.
+type sensorField struct {
+	name   string
+	status *SensorStatus
+}
+
+// sensors lists h's fields in declaration order.
+func (h *SensorHealth) sensors() []sensorField {
+	return []sensorField{{"lidar", &h.Lidar}, {"camera", &h.Camera}, {"gps", &h.GPS}, {"imu", &h.IMU}}
+}
+
+// Failed returns the names of the sensors reported as SensorFailed, e.g.
+// ["lidar"], in declaration order.
+func (h SensorHealth) Failed() []string {
+	var names []string
+	for _, s := range h.sensors() {
+		if *s.status == SensorFailed {
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
+
+// sensorStatus converts a wire status, mapping values this version does not
+// know to SensorUnknown.
+func sensorStatus(pb vlinkpb.SensorStatus) SensorStatus {
+	st := SensorStatus(pb)
+	if _, ok := sensorStatusNames[st]; !ok {
+		return SensorUnknown
+	}
+	return st
+}
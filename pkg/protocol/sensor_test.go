@@ -0,0 +1,98 @@
+package protocol
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSensorStatusString(t *testing.T) {
+	for st, want := range map[SensorStatus]string{
+		SensorUnknown: "unknown", SensorOK: "ok", SensorDegraded: "degraded",
+		SensorFailed: "failed", SensorStatus(9): "unknown",
+	} {
+		if got := st.String(); got != want {
+			t.Errorf("SensorStatus(%d).String() = %q, want %q", int32(st), got, want)
+		}
+	}
+}
+
+func TestParseSensorStatus(t *testing.T) {
+	for in, want := range map[string]SensorStatus{"ok": SensorOK, " Degraded ": SensorDegraded, "SENSOR_FAILED": SensorFailed} {
+		if got, err := ParseSensorStatus(in); err != nil || got != want {
+			t.Errorf("ParseSensorStatus(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseSensorStatus("smoking"); err == nil {
+		t.Error("ParseSensorStatus accepted an unknown name")
+	}
+}
+
+func TestSensorHealthJSON(t *testing.T) {
+	in := &VehicleState{VehicleID: "car-001", Sensors: SensorHealth{
+		Lidar: SensorOK, Camera: SensorDegraded, GPS: SensorFailed,
+	}}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The unreported IMU is left out.
+	if want := `"sensors":{"lidar":"ok","camera":"degraded","gps":"failed"}`; !strings.Contains(string(data), want) {
+		t.Errorf("payload %s does not contain %s", data, want)
+	}
+	var out VehicleState
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Sensors != in.Sensors {
+		t.Errorf("Sensors = %+v, want %+v", out.Sensors, in.Sensors)
+	}
+}
+
+func TestSensorHealthOmittedWhenEmpty(t *testing.T) {
+	state := &VehicleState{VehicleID: "car-001"}
+	data, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sensors") {
+		t.Errorf("payload %s carries an empty sensors field", data)
+	}
+	withSensors, _ := ProtobufCodec{}.Marshal(&VehicleState{VehicleID: "car-001", Sensors: SensorHealth{GPS: SensorOK}})
+	without, _ := ProtobufCodec{}.Marshal(state)
+	if len(without) >= len(withSensors) {
+		t.Errorf("protobuf: %d bytes without sensors, %d with", len(without), len(withSensors))
+	}
+
+	// Payloads from senders predating the field decode without it.
+	var s VehicleState
+	if err := Unmarshal([]byte(`{"vehicle_id":"car-001","battery_pct":80}`), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Sensors != (SensorHealth{}) {
+		t.Errorf("Sensors = %+v, want zero", s.Sensors)
+	}
+}
+
+func TestSensorHealthDecodesUnknownStatus(t *testing.T) {
+	var s VehicleState
+	if err := Unmarshal([]byte(`{"sensors":{"lidar":"overheating","gps":"ok","radar":"ok"}}`), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Sensors != (SensorHealth{GPS: SensorOK}) {
+		t.Errorf("Sensors = %+v, want only gps ok", s.Sensors)
+	}
+	if err := Unmarshal([]byte(`{"sensors":{"gps":2}}`), &s); err == nil {
+		t.Error("accepted a numeric sensor status")
+	}
+}
+
+func TestSensorHealthFailed(t *testing.T) {
+	h := SensorHealth{Lidar: SensorFailed, GPS: SensorDegraded, IMU: SensorFailed}
+	if got, want := h.Failed(), []string{"lidar", "imu"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Failed() = %v, want %v", got, want)
+	}
+	if got := (SensorHealth{}).Failed(); got != nil {
+		t.Errorf("Failed() on zero = %v, want nil", got)
+	}
+}
@@ -0,0 +1,24 @@
+package protocol
+
+// EstimateSize returns the number of bytes v occupies on the wire when
+// serialised with c, the codec the fleet is configured with (JSONCodec if
+// nil), or 0 if c cannot marshal v. The codecs in this package produce
+// deterministic output for its message types, so the estimate is exact for
+// a given value.
+func EstimateSize(c Codec, v any) int {
+	if c == nil {
+		c = JSONCodec{}
+	}
+	data, err := c.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// EstimateBandwidth returns the broker ingress in bytes per second produced
+// by vehicles each publishing v, serialised with c, at hz. It ignores MQTT
+// framing overhead, which is a few bytes plus the topic length per message.
+func EstimateBandwidth(c Codec, v any, hz float64, vehicles int) float64 {
+	return float64(EstimateSize(c, v)) * hz * float64(vehicles)
+}
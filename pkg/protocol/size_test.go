@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEstimateSizeMatchesCodec(t *testing.T) {
+	samples := []any{
+		&VehicleState{
+			VehicleID:  "car-001",
+			Timestamp:  time.Now().UnixMilli(),
+			Latitude:   39.9042,
+			Longitude:  116.4074,
+			Speed:      12.5,
+			Heading:    90,
+			Gear:       GearDrive,
+			BatteryPct: 78.3,
+			Mode:       "autonomous",
+			Seq:        42,
+		},
+		&ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: ActionStop},
+		&TeleoperationAlert{VehicleID: "car-001", Reason: "extreme_weather", Severity: 3},
+		&CommandAck{CommandID: "cmd-1", VehicleID: "car-001", Status: AckAccepted},
+	}
+	for _, c := range []Codec{JSONCodec{}, ProtobufCodec{}} {
+		for _, v := range samples {
+			data, err := c.Marshal(v)
+			if err != nil {
+				t.Fatalf("%s: Marshal(%T): %v", c.Name(), v, err)
+			}
+			if got := EstimateSize(c, v); got != len(data) {
+				t.Errorf("%s: EstimateSize(%T) = %d, want %d", c.Name(), v, got, len(data))
+			}
+		}
+	}
+	state := samples[0]
+	if json, pb := EstimateSize(nil, state), EstimateSize(ProtobufCodec{}, state); pb >= json {
+		t.Errorf("protobuf size %d not below the JSON default's %d", pb, json)
+	}
+}
+
+func TestEstimateSizeUnmarshalable(t *testing.T) {
+	if got := EstimateSize(nil, make(chan int)); got != 0 {
+		t.Errorf("EstimateSize(chan) = %d, want 0", got)
+	}
+}
+
+func TestEstimateBandwidth(t *testing.T) {
+	state := &VehicleState{VehicleID: "car-001", Mode: "autonomous"}
+	size := float64(EstimateSize(ProtobufCodec{}, state))
+
+	got := EstimateBandwidth(ProtobufCodec{}, state, 50, 1000)
+	if want := size * 50 * 1000; math.Abs(got-want) > 1e-9 {
+		t.Errorf("EstimateBandwidth = %v, want %v", got, want)
+	}
+}
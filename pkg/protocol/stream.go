@@ -0,0 +1,32 @@
+package protocol
+
+// Stream signal types.
+const (
+	StreamOffer  = "offer"
+	StreamAnswer = "answer"
+)
+
+// Stream transports negotiated by a StreamSignal.
+const (
+	StreamWebRTC = "webrtc"
+	StreamRTSP   = "rtsp"
+)
+
+// StreamSignal negotiates a teleoperation video stream over
+// v1/vehicle/{id}/stream. The control center publishes an offer, typically
+// after teleoperation_start; the vehicle replies with an answer carrying the
+// same SessionID. Only signaling is exchanged here, never media.
+//
+// For WebRTC, SDP holds the session description of each side. For RTSP the
+// offer only names the transport and the answer carries the stream URL.
+type StreamSignal struct {
+	SessionID string `json:"session_id"`
+	VehicleID string `json:"vehicle_id"`
+	Type      string `json:"type"`      // offer / answer
+	Transport string `json:"transport"` // webrtc / rtsp
+	SDP       string `json:"sdp,omitempty"`
+	URL       string `json:"url,omitempty"`
+	// Error, set only on an answer, rejects the offer with a reason.
+	Error     string `json:"error,omitempty"`
+	Timestamp int64  `json:"timestamp"` // Unix milliseconds, sender clock
+}
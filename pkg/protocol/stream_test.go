@@ -0,0 +1,50 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStreamSignalWireFormat(t *testing.T) {
+	offer := &StreamSignal{
+		SessionID: "s-1",
+		VehicleID: "car-001",
+		Type:      StreamOffer,
+		Transport: StreamWebRTC,
+		SDP:       "v=0\r\no=- 1 1 IN IP4 0.0.0.0\r\n",
+		Timestamp: 1700000000000,
+	}
+	data, err := Marshal(offer)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, k := range []string{"session_id", "vehicle_id", "type", "transport", "sdp", "timestamp"} {
+		if _, ok := fields[k]; !ok {
+			t.Errorf("field %q missing from %s", k, data)
+		}
+	}
+	if _, ok := fields["url"]; ok {
+		t.Errorf("empty url should be omitted: %s", data)
+	}
+
+	var got StreamSignal
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got != *offer {
+		t.Errorf("round trip = %+v, want %+v", got, *offer)
+	}
+}
+
+func TestStreamTopic(t *testing.T) {
+	if got := StreamTopic("car-001"); got != "v1/vehicle/car-001/stream" {
+		t.Errorf("StreamTopic = %q", got)
+	}
+	if got := WildcardStreamTopic(); got != "v1/vehicle/+/stream" {
+		t.Errorf("WildcardStreamTopic = %q", got)
+	}
+}
@@ -0,0 +1,166 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultTopicPrefix is the topic namespace used by the package-level helpers.
+const DefaultTopicPrefix = "v1/vehicle"
+
+// AlertFeedTopic is the aggregate topic the control center republishes
+// accepted alerts to, so downstream services need not subscribe to every
+// vehicle's alert topic.
+const AlertFeedTopic = "v1/control/alerts"
+
+// Topic kinds, i.e. the last segment of a vehicle topic.
+const (
+	KindState   = "state"
+	KindControl = "control"
+	KindAlert   = "alert"
+	KindAck     = "ack"
+	KindStream  = "stream"
+	// KindConfigQuery carries ConfigQuery messages to the vehicle and
+	// KindConfig the ConfigReport answers back.
+	KindConfigQuery = "config_query"
+	KindConfig      = "config"
+	// KindStatus carries the vehicle's connection status, StatusOnline,
+	// StatusPaused or StatusOffline (its MQTT last will), as a retained
+	// plain-text payload.
+	KindStatus = "status"
+)
+
+// Payloads of the status topic.
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+	// StatusPaused is an online vehicle that has paused its periodic state
+	// publication, e.g. for maintenance.
+	StatusPaused = "paused"
+)
+
+// Topics builds vehicle topics under a single prefix such as "v1/vehicle" or
+// "v2/vehicle". Running several Topics side by side lets a fleet migrate
+// between protocol versions without a flag-day cutover.
+type Topics struct {
+	Prefix string
+}
+
+// DefaultTopics is the Topics value for DefaultTopicPrefix.
+var DefaultTopics = Topics{Prefix: DefaultTopicPrefix}
+
+// TopicsFor returns a Topics for each prefix, or DefaultTopics alone when
+// prefixes is empty.
+func TopicsFor(prefixes []string) []Topics {
+	if len(prefixes) == 0 {
+		return []Topics{DefaultTopics}
+	}
+	ts := make([]Topics, len(prefixes))
+	for i, p := range prefixes {
+		ts[i] = Topics{Prefix: strings.TrimSuffix(p, "/")}
+	}
+	return ts
+}
+
+// ErrInvalidPrefix is returned by ValidatePrefixes.
+var ErrInvalidPrefix = errors.New("protocol: invalid topic prefix")
+
+// ValidatePrefixes checks topic prefixes before they are used to subscribe.
+// Each prefix must be non-empty and free of MQTT wildcards and empty
+// segments, and no prefix may repeat or contain another ("v1" and
+// "v1/vehicle"), since the topics of one namespace would then also be
+// topics of the other. An empty list (meaning DefaultTopicPrefix) is valid.
+func ValidatePrefixes(prefixes []string) error {
+	seen := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		p = strings.TrimSuffix(p, "/")
+		if p == "" || strings.ContainsAny(p, "+#") || strings.HasPrefix(p, "/") || strings.Contains(p, "//") {
+			return fmt.Errorf("%w: %q", ErrInvalidPrefix, p)
+		}
+		for _, q := range seen {
+			if p == q || strings.HasPrefix(p, q+"/") || strings.HasPrefix(q, p+"/") {
+				return fmt.Errorf("%w: %q overlaps %q", ErrInvalidPrefix, p, q)
+			}
+		}
+		seen = append(seen, p)
+	}
+	return nil
+}
+
+// topic builds {prefix}/{id}/{kind}, escaping vehicleID so that a
+// hierarchical ID occupies a single topic segment.
+func (t Topics) topic(vehicleID, kind string) string {
+	return fmt.Sprintf("%s/%s/%s", t.Prefix, EscapeVehicleID(vehicleID), kind)
+}
+
+func (t Topics) wildcard(kind string) string {
+	return fmt.Sprintf("%s/+/%s", t.Prefix, kind)
+}
+
+// State returns {prefix}/{id}/state.
+func (t Topics) State(vehicleID string) string { return t.topic(vehicleID, KindState) }
+
+// Control returns {prefix}/{id}/control.
+func (t Topics) Control(vehicleID string) string { return t.topic(vehicleID, KindControl) }
+
+// Alert returns {prefix}/{id}/alert.
+func (t Topics) Alert(vehicleID string) string { return t.topic(vehicleID, KindAlert) }
+
+// Ack returns {prefix}/{id}/ack.
+func (t Topics) Ack(vehicleID string) string { return t.topic(vehicleID, KindAck) }
+
+// Stream returns {prefix}/{id}/stream.
+func (t Topics) Stream(vehicleID string) string { return t.topic(vehicleID, KindStream) }
+
+// ConfigQuery returns {prefix}/{id}/config_query.
+func (t Topics) ConfigQuery(vehicleID string) string { return t.topic(vehicleID, KindConfigQuery) }
+
+// Config returns {prefix}/{id}/config.
+func (t Topics) Config(vehicleID string) string { return t.topic(vehicleID, KindConfig) }
+
+// Status returns {prefix}/{id}/status.
+func (t Topics) Status(vehicleID string) string { return t.topic(vehicleID, KindStatus) }
+
+// WildcardState returns {prefix}/+/state.
+func (t Topics) WildcardState() string { return t.wildcard(KindState) }
+
+// WildcardAlert returns {prefix}/+/alert.
+func (t Topics) WildcardAlert() string { return t.wildcard(KindAlert) }
+
+// WildcardAck returns {prefix}/+/ack.
+func (t Topics) WildcardAck() string { return t.wildcard(KindAck) }
+
+// WildcardStream returns {prefix}/+/stream.
+func (t Topics) WildcardStream() string { return t.wildcard(KindStream) }
+
+// WildcardConfig returns {prefix}/+/config.
+func (t Topics) WildcardConfig() string { return t.wildcard(KindConfig) }
+
+// WildcardStatus returns {prefix}/+/status.
+func (t Topics) WildcardStatus() string { return t.wildcard(KindStatus) }
+
+// ParseTopic splits a vehicle topic into its prefix, vehicle ID and kind,
+// unescaping the ID. An ID segment that is not validly escaped, e.g. from an
+// agent predating EscapeVehicleID whose ID contains a bare '%', is returned
+// as it is rather than rejected. It reports false when the topic has fewer
+// than three segments.
+//
+//	v2/vehicle/car-001/state -> ("v2/vehicle", "car-001", "state", true)
+//	v1/vehicle/eu%2Fcar-001/ack -> ("v1/vehicle", "eu/car-001", "ack", true)
+//	v1/vehicle/car%zz/state -> ("v1/vehicle", "car%zz", "state", true)
+func ParseTopic(topic string) (prefix, vehicleID, kind string, ok bool) {
+	k := strings.LastIndexByte(topic, '/')
+	if k <= 0 {
+		return "", "", "", false
+	}
+	i := strings.LastIndexByte(topic[:k], '/')
+	if i <= 0 || i+1 == k || k+1 == len(topic) {
+		return "", "", "", false
+	}
+	id, err := UnescapeVehicleID(topic[i+1 : k])
+	if err != nil {
+		id = topic[i+1 : k]
+	}
+	return topic[:i], id, topic[k+1:], true
+}
@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTopicsPrefix(t *testing.T) {
+	v2 := Topics{Prefix: "v2/vehicle"}
+	if got := v2.State("car-001"); got != "v2/vehicle/car-001/state" {
+		t.Errorf("State = %q", got)
+	}
+	if got := v2.WildcardAlert(); got != "v2/vehicle/+/alert" {
+		t.Errorf("WildcardAlert = %q", got)
+	}
+	if got := DefaultTopics.Control("car-001"); got != ControlTopic("car-001") {
+		t.Errorf("DefaultTopics.Control = %q, want %q", got, ControlTopic("car-001"))
+	}
+}
+
+func TestTopicsFor(t *testing.T) {
+	if ts := TopicsFor(nil); len(ts) != 1 || ts[0] != DefaultTopics {
+		t.Errorf("TopicsFor(nil) = %v, want [DefaultTopics]", ts)
+	}
+	ts := TopicsFor([]string{"v1/vehicle", "v2/vehicle/"})
+	if len(ts) != 2 || ts[1].Prefix != "v2/vehicle" {
+		t.Errorf("TopicsFor = %v", ts)
+	}
+}
+
+func TestParseTopic(t *testing.T) {
+	prefix, id, kind, ok := ParseTopic("v2/vehicle/car-001/state")
+	if !ok || prefix != "v2/vehicle" || id != "car-001" || kind != KindState {
+		t.Errorf("ParseTopic = (%q, %q, %q, %v)", prefix, id, kind, ok)
+	}
+	for _, bad := range []string{"", "state", "car/state", "v1/vehicle//state", "v1/vehicle/car/"} {
+		if _, _, _, ok := ParseTopic(bad); ok {
+			t.Errorf("ParseTopic(%q) ok, want false", bad)
+		}
+	}
+}
+
+func TestValidatePrefixes(t *testing.T) {
+	for _, ok := range [][]string{nil, {"v1/vehicle"}, {"v1/vehicle", "v2/vehicle/"}, {"fleet-a/v1", "fleet-b/v1"}} {
+		if err := ValidatePrefixes(ok); err != nil {
+			t.Errorf("ValidatePrefixes(%q) = %v", ok, err)
+		}
+	}
+	for _, bad := range [][]string{
+		{""},
+		{"v1/#"},
+		{"v1/+/vehicle"},
+		{"/v1"},
+		{"v1//vehicle"},
+		{"v1/vehicle", "v1/vehicle/"},
+		{"v1", "v1/vehicle"},
+		{"v1/vehicle/eu", "v1/vehicle"},
+	} {
+		if err := ValidatePrefixes(bad); !errors.Is(err, ErrInvalidPrefix) {
+			t.Errorf("ValidatePrefixes(%q) = %v, want ErrInvalidPrefix", bad, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTrajectory is wrapped by the errors ValidateTrajectory returns.
+var ErrInvalidTrajectory = errors.New("protocol: invalid trajectory")
+
+// Waypoint is one point of a Trajectory.
+type Waypoint struct {
+	Latitude    float64 `json:"lat"`
+	Longitude   float64 `json:"lon"`
+	TargetSpeed float32 `json:"target_speed"` // m/s on reaching the waypoint
+	// ETAOffset is when the vehicle should reach the waypoint, in
+	// milliseconds after the command's Timestamp.
+	ETAOffset int64 `json:"eta_offset_ms"`
+}
+
+// Trajectory is carried by an ActionFollowTrajectory command: a path for the
+// vehicle to follow, e.g. drawn by a remote operator, rather than a
+// single target speed and heading.
+type Trajectory struct {
+	Waypoints []Waypoint `json:"waypoints"`
+}
+
+// ValidateTrajectory checks that t has at least one waypoint, that every
+// waypoint lies on the globe with a finite non-negative target speed, and
+// that the ETA offsets are non-negative and strictly increasing. It returns
+// nil or an error wrapping ErrInvalidTrajectory that names the first
+// offending waypoint.
+func ValidateTrajectory(t *Trajectory) error {
+	if t == nil || len(t.Waypoints) == 0 {
+		return fmt.Errorf("%w: no waypoints", ErrInvalidTrajectory)
+	}
+	for i, w := range t.Waypoints {
+		switch {
+		case !isFinite(w.Latitude) || w.Latitude < -90 || w.Latitude > 90:
+			return fmt.Errorf("%w: waypoint %d: latitude %v outside [-90, 90]", ErrInvalidTrajectory, i, w.Latitude)
+		case !isFinite(w.Longitude) || w.Longitude < -180 || w.Longitude > 180:
+			return fmt.Errorf("%w: waypoint %d: longitude %v outside [-180, 180]", ErrInvalidTrajectory, i, w.Longitude)
+		case !isFinite(float64(w.TargetSpeed)) || w.TargetSpeed < 0:
+			return fmt.Errorf("%w: waypoint %d: target_speed %v is not a finite non-negative value", ErrInvalidTrajectory, i, w.TargetSpeed)
+		case w.ETAOffset < 0:
+			return fmt.Errorf("%w: waypoint %d: negative eta_offset_ms %d", ErrInvalidTrajectory, i, w.ETAOffset)
+		case i > 0 && w.ETAOffset <= t.Waypoints[i-1].ETAOffset:
+			return fmt.Errorf("%w: waypoint %d: eta_offset_ms %d not after %d", ErrInvalidTrajectory, i, w.ETAOffset, t.Waypoints[i-1].ETAOffset)
+		}
+	}
+	return nil
+}
+
+// MarshalTrajectory makes c an ActionFollowTrajectory command carrying t in
+// its Trajectory field. t must pass ValidateTrajectory.
+func (c *ControlCommand) MarshalTrajectory(t *Trajectory) error {
+	if err := ValidateTrajectory(t); err != nil {
+		return err
+	}
+	c.Action = ActionFollowTrajectory
+	c.Trajectory = t
+	return nil
+}
+
+// UnmarshalTrajectory validates and returns the Trajectory carried by an
+// ActionFollowTrajectory command. A command without one is read from a
+// JSON-encoded Payload, as sent by control centers that predate the
+// Trajectory field.
+func (c *ControlCommand) UnmarshalTrajectory() (*Trajectory, error) {
+	if c.Action != ActionFollowTrajectory {
+		return nil, fmt.Errorf("%w: action %q is not %s", ErrInvalidTrajectory, c.Action, ActionFollowTrajectory)
+	}
+	t := c.Trajectory
+	if t == nil {
+		t = new(Trajectory)
+		if err := Unmarshal([]byte(c.Payload), t); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTrajectory, err)
+		}
+	}
+	if err := ValidateTrajectory(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,121 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sampleTrajectory() *Trajectory {
+	return &Trajectory{Waypoints: []Waypoint{
+		{Latitude: 39.9042, Longitude: 116.4074, TargetSpeed: 0, ETAOffset: 0},
+		{Latitude: 39.9045, Longitude: 116.4080, TargetSpeed: 2.5, ETAOffset: 4000},
+		{Latitude: 39.9050, Longitude: 116.4091, TargetSpeed: 0, ETAOffset: 9500},
+	}}
+}
+
+func TestTrajectoryRoundTrip(t *testing.T) {
+	want := sampleTrajectory()
+	for _, codec := range []Codec{JSONCodec{}, ProtobufCodec{}} {
+		cmd := &ControlCommand{CommandID: "cmd-1", VehicleID: "car-001"}
+		if err := cmd.MarshalTrajectory(want); err != nil {
+			t.Fatalf("MarshalTrajectory: %v", err)
+		}
+		if cmd.Action != ActionFollowTrajectory {
+			t.Errorf("Action = %q, want %q", cmd.Action, ActionFollowTrajectory)
+		}
+		data, err := codec.Marshal(cmd)
+		if err != nil {
+			t.Fatalf("%T Marshal: %v", codec, err)
+		}
+		var got ControlCommand
+		if err := codec.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%T Unmarshal: %v", codec, err)
+		}
+		traj, err := got.UnmarshalTrajectory()
+		if err != nil {
+			t.Fatalf("%T UnmarshalTrajectory: %v", codec, err)
+		}
+		if !reflect.DeepEqual(traj, want) {
+			t.Errorf("%T round trip = %+v, want %+v", codec, traj, want)
+		}
+	}
+}
+
+func TestTrajectoryWireFormat(t *testing.T) {
+	cmd := &ControlCommand{}
+	traj := &Trajectory{Waypoints: []Waypoint{{Latitude: 1, Longitude: 2, TargetSpeed: 3, ETAOffset: 4}}}
+	if err := cmd.MarshalTrajectory(traj); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Payload != "" {
+		t.Errorf("Payload = %q, want the trajectory in its own field", cmd.Payload)
+	}
+	data, err := Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"trajectory":{"waypoints":[{"lat":1,"lon":2,"target_speed":3,"eta_offset_ms":4}]}`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("JSON = %s, want it to contain %s", data, want)
+	}
+}
+
+func TestUnmarshalLegacyTrajectoryPayload(t *testing.T) {
+	cmd := &ControlCommand{
+		Action:  ActionFollowTrajectory,
+		Payload: `{"waypoints":[{"lat":1,"lon":2,"target_speed":3,"eta_offset_ms":4}]}`,
+	}
+	got, err := cmd.UnmarshalTrajectory()
+	if err != nil {
+		t.Fatalf("UnmarshalTrajectory: %v", err)
+	}
+	want := &Trajectory{Waypoints: []Waypoint{{Latitude: 1, Longitude: 2, TargetSpeed: 3, ETAOffset: 4}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trajectory = %+v, want %+v", got, want)
+	}
+}
+
+func TestValidateTrajectory(t *testing.T) {
+	if err := ValidateTrajectory(sampleTrajectory()); err != nil {
+		t.Fatalf("valid trajectory rejected: %v", err)
+	}
+	for name, mutate := range map[string]func(*Trajectory){
+		"empty":          func(t *Trajectory) { t.Waypoints = nil },
+		"latitude":       func(t *Trajectory) { t.Waypoints[1].Latitude = 91 },
+		"longitude":      func(t *Trajectory) { t.Waypoints[1].Longitude = math.NaN() },
+		"negative speed": func(t *Trajectory) { t.Waypoints[1].TargetSpeed = -1 },
+		"negative eta":   func(t *Trajectory) { t.Waypoints[0].ETAOffset = -1 },
+		"repeated eta":   func(t *Trajectory) { t.Waypoints[2].ETAOffset = 4000 },
+		"decreasing eta": func(t *Trajectory) { t.Waypoints[2].ETAOffset = 3000 },
+	} {
+		traj := sampleTrajectory()
+		mutate(traj)
+		if err := ValidateTrajectory(traj); !errors.Is(err, ErrInvalidTrajectory) {
+			t.Errorf("%s: ValidateTrajectory = %v, want ErrInvalidTrajectory", name, err)
+		}
+		cmd := &ControlCommand{}
+		if err := cmd.MarshalTrajectory(traj); err == nil || cmd.Trajectory != nil {
+			t.Errorf("%s: MarshalTrajectory accepted an invalid trajectory", name)
+		}
+	}
+	if err := ValidateTrajectory(nil); !errors.Is(err, ErrInvalidTrajectory) {
+		t.Errorf("ValidateTrajectory(nil) = %v, want ErrInvalidTrajectory", err)
+	}
+}
+
+func TestUnmarshalTrajectoryErrors(t *testing.T) {
+	for name, cmd := range map[string]*ControlCommand{
+		"wrong action":       {Action: ActionStop, Payload: `{"waypoints":[{"lat":1,"lon":2}]}`},
+		"bad payload":        {Action: ActionFollowTrajectory, Payload: "not json"},
+		"no waypoints":       {Action: ActionFollowTrajectory, Payload: `{"waypoints":[]}`},
+		"non-monotonic etas": {Action: ActionFollowTrajectory, Payload: `{"waypoints":[{"eta_offset_ms":5},{"eta_offset_ms":5}]}`},
+		"typed no waypoints": {Action: ActionFollowTrajectory, Trajectory: &Trajectory{}},
+	} {
+		if _, err := cmd.UnmarshalTrajectory(); !errors.Is(err, ErrInvalidTrajectory) {
+			t.Errorf("%s: UnmarshalTrajectory = %v, want ErrInvalidTrajectory", name, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Driving modes carried in VehicleState.Mode.
+const (
+	ModeAutonomous    = "autonomous"
+	ModeManual        = "manual"
+	ModeTeleoperation = "teleoperation"
+)
+
+// ErrInvalidState is wrapped by the errors ValidateState returns.
+var ErrInvalidState = errors.New("protocol: invalid vehicle state")
+
+// ValidateState checks that s holds physically meaningful values, catching
+// sensor glitches such as a heading of 999 or a battery of -5%: heading in
+// [0, 360), a finite non-negative speed, battery in [0, 100], a latitude and
+// longitude on the globe, and a known mode (an empty mode is accepted as
+// unreported). It returns nil or an error wrapping ErrInvalidState that
+// names the first offending field.
+func ValidateState(s *VehicleState) error {
+	switch {
+	case s == nil:
+		return fmt.Errorf("%w: nil", ErrInvalidState)
+	case s.VehicleID == "":
+		return fmt.Errorf("%w: empty vehicle_id", ErrInvalidState)
+	case !isFinite(float64(s.Heading)) || s.Heading < 0 || s.Heading >= 360:
+		return fmt.Errorf("%w: heading %v outside [0, 360)", ErrInvalidState, s.Heading)
+	case !isFinite(float64(s.Speed)) || s.Speed < 0:
+		return fmt.Errorf("%w: speed %v is not a finite non-negative value", ErrInvalidState, s.Speed)
+	case math.IsNaN(float64(s.BatteryPct)) || s.BatteryPct < 0 || s.BatteryPct > 100:
+		return fmt.Errorf("%w: battery_pct %v outside [0, 100]", ErrInvalidState, s.BatteryPct)
+	case math.IsNaN(s.Latitude) || s.Latitude < -90 || s.Latitude > 90:
+		return fmt.Errorf("%w: latitude %v outside [-90, 90]", ErrInvalidState, s.Latitude)
+	case math.IsNaN(s.Longitude) || s.Longitude < -180 || s.Longitude > 180:
+		return fmt.Errorf("%w: longitude %v outside [-180, 180]", ErrInvalidState, s.Longitude)
+	}
+	switch s.Mode {
+	case "", ModeAutonomous, ModeManual, ModeTeleoperation:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown mode %q", ErrInvalidState, s.Mode)
+}
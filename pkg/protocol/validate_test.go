@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidateState(t *testing.T) {
+	valid := func() *VehicleState {
+		return &VehicleState{VehicleID: "car-001", Latitude: 39.9, Longitude: 116.4,
+			Speed: 12, Heading: 359.9, BatteryPct: 100, Mode: ModeAutonomous}
+	}
+	if err := ValidateState(valid()); err != nil {
+		t.Fatalf("valid state rejected: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		edit  func(*VehicleState)
+	}{
+		{"nan speed", "speed", func(s *VehicleState) { s.Speed = float32(math.NaN()) }},
+		{"inf speed", "speed", func(s *VehicleState) { s.Speed = float32(math.Inf(1)) }},
+		{"negative speed", "speed", func(s *VehicleState) { s.Speed = -0.1 }},
+		{"heading 360", "heading", func(s *VehicleState) { s.Heading = 360 }},
+		{"heading 999", "heading", func(s *VehicleState) { s.Heading = 999 }},
+		{"negative heading", "heading", func(s *VehicleState) { s.Heading = -1 }},
+		{"nan heading", "heading", func(s *VehicleState) { s.Heading = float32(math.NaN()) }},
+		{"negative battery", "battery_pct", func(s *VehicleState) { s.BatteryPct = -5 }},
+		{"battery over 100", "battery_pct", func(s *VehicleState) { s.BatteryPct = 100.5 }},
+		{"latitude", "latitude", func(s *VehicleState) { s.Latitude = 91 }},
+		{"nan latitude", "latitude", func(s *VehicleState) { s.Latitude = math.NaN() }},
+		{"longitude", "longitude", func(s *VehicleState) { s.Longitude = -180.5 }},
+		{"mode", "mode", func(s *VehicleState) { s.Mode = "hovering" }},
+		{"vehicle id", "vehicle_id", func(s *VehicleState) { s.VehicleID = "" }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := valid()
+			tc.edit(s)
+			err := ValidateState(s)
+			if !errors.Is(err, ErrInvalidState) {
+				t.Fatalf("ValidateState = %v, want ErrInvalidState", err)
+			}
+			if !strings.Contains(err.Error(), tc.field) {
+				t.Errorf("error %q does not name %s", err, tc.field)
+			}
+		})
+	}
+
+	s := valid()
+	s.Mode = ""
+	if err := ValidateState(s); err != nil {
+		t.Errorf("unreported mode rejected: %v", err)
+	}
+	if err := ValidateState(nil); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("ValidateState(nil) = %v", err)
+	}
+}
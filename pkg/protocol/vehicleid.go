@@ -0,0 +1,59 @@
+package protocol
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// VehicleIDSeparator separates the levels of a hierarchical vehicle ID such
+// as "region-a/fleet-3/car-001". The last level names the vehicle and the
+// levels before it form its namespace.
+const VehicleIDSeparator = "/"
+
+// vehicleIDEscaper percent-encodes the characters that would split a topic
+// segment or act as an MQTT wildcard, and '%' itself so the encoding is
+// reversible. IDs without these characters are unchanged on the wire.
+var vehicleIDEscaper = strings.NewReplacer("%", "%25", "/", "%2F", "+", "%2B", "#", "%23")
+
+// EscapeVehicleID encodes a logical vehicle ID as a single topic segment.
+//
+//	region-a/fleet-3/car-001 -> region-a%2Ffleet-3%2Fcar-001
+func EscapeVehicleID(id string) string {
+	return vehicleIDEscaper.Replace(id)
+}
+
+// UnescapeVehicleID reverses EscapeVehicleID.
+func UnescapeVehicleID(segment string) (string, error) {
+	id, err := url.PathUnescape(segment)
+	if err != nil {
+		return "", fmt.Errorf("protocol: bad vehicle ID segment %q: %w", segment, err)
+	}
+	return id, nil
+}
+
+// SplitVehicleID returns the levels of a hierarchical vehicle ID. A flat ID
+// yields a single level.
+func SplitVehicleID(id string) []string {
+	return strings.Split(id, VehicleIDSeparator)
+}
+
+// VehicleNamespace returns the namespace of id, i.e. every level but the
+// last, or "" for a flat ID.
+//
+//	region-a/fleet-3/car-001 -> region-a/fleet-3
+func VehicleNamespace(id string) string {
+	i := strings.LastIndex(id, VehicleIDSeparator)
+	if i < 0 {
+		return ""
+	}
+	return id[:i]
+}
+
+// InNamespace reports whether id lies within namespace at any depth, so
+// "region-a" contains both "region-a/car-001" and "region-a/fleet-3/car-001".
+// The empty namespace contains every ID.
+func InNamespace(id, namespace string) bool {
+	namespace = strings.TrimSuffix(namespace, VehicleIDSeparator)
+	return namespace == "" || strings.HasPrefix(id, namespace+VehicleIDSeparator)
+}
@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHierarchicalIDRoundTripsThroughTopics(t *testing.T) {
+	const id = "region-a/fleet-3/car-001"
+	topic := StateTopic(id)
+	if topic != "v1/vehicle/region-a%2Ffleet-3%2Fcar-001/state" {
+		t.Errorf("StateTopic = %q", topic)
+	}
+	prefix, got, kind, ok := ParseTopic(topic)
+	if !ok || prefix != DefaultTopicPrefix || got != id || kind != KindState {
+		t.Errorf("ParseTopic = (%q, %q, %q, %v)", prefix, got, kind, ok)
+	}
+	if levels := SplitVehicleID(got); !reflect.DeepEqual(levels, []string{"region-a", "fleet-3", "car-001"}) {
+		t.Errorf("SplitVehicleID = %q", levels)
+	}
+	if ns := VehicleNamespace(got); ns != "region-a/fleet-3" {
+		t.Errorf("VehicleNamespace = %q", ns)
+	}
+}
+
+func TestEscapeVehicleID(t *testing.T) {
+	for _, id := range []string{"car-001", "a/b", "odd%2Fname", "wild+card#", ""} {
+		seg := EscapeVehicleID(id)
+		if strings.ContainsAny(seg, "/+#") {
+			t.Errorf("EscapeVehicleID(%q) = %q contains a topic metacharacter", id, seg)
+		}
+		back, err := UnescapeVehicleID(seg)
+		if err != nil || back != id {
+			t.Errorf("UnescapeVehicleID(%q) = %q, %v, want %q", seg, back, err, id)
+		}
+	}
+	if EscapeVehicleID("car-001") != "car-001" {
+		t.Error("flat IDs must be unchanged on the wire")
+	}
+	// A legacy agent publishing a bare '%' keeps its ID.
+	if _, id, _, ok := ParseTopic("v1/vehicle/bad%zz/state"); !ok || id != "bad%zz" {
+		t.Errorf("ParseTopic of a badly escaped ID = %q, %v; want the raw segment", id, ok)
+	}
+}
+
+func TestVehicleNamespace(t *testing.T) {
+	if ns := VehicleNamespace("car-001"); ns != "" {
+		t.Errorf("VehicleNamespace(flat) = %q, want empty", ns)
+	}
+	for _, tc := range []struct {
+		id, ns string
+		want   bool
+	}{
+		{"region-a/fleet-3/car-001", "region-a", true},
+		{"region-a/fleet-3/car-001", "region-a/fleet-3/", true},
+		{"region-ab/car-001", "region-a", false},
+		{"region-a", "region-a", false},
+		{"car-001", "", true},
+	} {
+		if got := InNamespace(tc.id, tc.ns); got != tc.want {
+			t.Errorf("InNamespace(%q, %q) = %v, want %v", tc.id, tc.ns, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Package ca issues certificates for vlink's mutual TLS: a CA and leaves
+// signed by it for vehicles and control centers. It is meant for tests,
+// local demos and bootstrapping a small fleet; production fleets usually
+// have their own PKI.
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// KeyType selects the algorithm of generated keys.
+type KeyType int
+
+const (
+	// ECDSAP256 is ECDSA on the NIST P-256 curve, the default.
+	ECDSAP256 KeyType = iota
+	// ECDSAP384 is ECDSA on the NIST P-384 curve.
+	ECDSAP384
+	// RSA2048 is 2048-bit RSA, for peers without ECDSA support.
+	RSA2048
+	// Ed25519 is EdDSA on Curve25519.
+	Ed25519
+)
+
+// Default validity periods, used unless WithValidity is given.
+const (
+	DefaultCAValidity   = 10 * 365 * 24 * time.Hour
+	DefaultLeafValidity = 365 * 24 * time.Hour
+)
+
+type options struct {
+	keyType  KeyType
+	validity time.Duration
+}
+
+// Option customizes GenerateCA and SignLeaf.
+type Option func(*options)
+
+// WithKeyType generates keys of type k instead of ECDSA P-256.
+func WithKeyType(k KeyType) Option {
+	return func(o *options) { o.keyType = k }
+}
+
+// WithValidity makes the certificate valid for d from now instead of the
+// default period.
+func WithValidity(d time.Duration) Option {
+	return func(o *options) { o.validity = d }
+}
+
+func buildOptions(validity time.Duration, opts []Option) options {
+	o := options{keyType: ECDSAP256, validity: validity}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// GenerateKey returns a new private key of type k.
+func GenerateKey(k KeyType) (crypto.Signer, error) {
+	switch k {
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case RSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("ca: unknown key type %d", k)
+	}
+}
+
+// serialNumber returns a random 128-bit serial, unique in practice, so
+// revocation lists can name a single certificate.
+func serialNumber() (*big.Int, error) {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("ca: serial number: %w", err)
+	}
+	return n, nil
+}
+
+// GenerateCA creates a self-signed CA certificate with common name cn and
+// its key. The CA may sign leaves and revocation lists but not other CAs.
+func GenerateCA(cn string, opts ...Option) (*x509.Certificate, crypto.Signer, error) {
+	o := buildOptions(DefaultCAValidity, opts)
+	key, err := GenerateKey(o.keyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             now.Add(-time.Minute), // tolerate clock skew
+		NotAfter:              now.Add(o.validity),
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ca: create CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ca: create CA certificate: %w", err)
+	}
+	return cert, key, nil
+}
+
+// SignLeaf issues a certificate for cn, e.g. a vehicle ID, signed by ca,
+// together with its new key. The certificate is valid for both client and
+// server authentication and for the host names in dns.
+func SignLeaf(ca *x509.Certificate, caKey crypto.Signer, cn string, dns []string, opts ...Option) (*x509.Certificate, crypto.Signer, error) {
+	if ca == nil || caKey == nil {
+		return nil, nil, errors.New("ca: no CA to sign with")
+	}
+	o := buildOptions(DefaultLeafValidity, opts)
+	key, err := GenerateKey(o.keyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(o.validity)
+	if notAfter.After(ca.NotAfter) {
+		notAfter = ca.NotAfter // a leaf cannot outlive its CA
+	}
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, isRSA := key.(*rsa.PrivateKey); isRSA {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     keyUsage,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		DNSNames:     dns,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, key.Public(), caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ca: sign %s: %w", cn, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ca: sign %s: %w", cn, err)
+	}
+	return cert, key, nil
+}
+
+// EncodeCertPEM returns cert as a PEM "CERTIFICATE" block.
+func EncodeCertPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// EncodeKeyPEM returns key as a PKCS #8 PEM "PRIVATE KEY" block, which
+// covers every KeyType.
+func EncodeKeyPEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("ca: encode key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Files are the paths WriteFiles writes to.
+type Files struct {
+	CA    string // ca.pem: the CA certificate, for Config.CAFile
+	CAKey string // ca-key.pem: the CA key, to issue more leaves later
+	Cert  string // cert.pem: the leaf certificate, for Config.CertFile
+	Key   string // key.pem: the leaf key, for Config.KeyFile
+}
+
+// WriteFiles generates a CA and a leaf for cn and dns signed by it, and
+// writes them to dir as ca.pem, ca-key.pem, cert.pem and key.pem, ready to
+// pass to the vehicle and control-center -ca, -cert and -key flags. Keys are
+// written readable by the owner only. dir is created if missing; existing
+// files are overwritten.
+func WriteFiles(dir, cn string, dns []string, opts ...Option) (Files, error) {
+	caCert, caKey, err := GenerateCA(cn+" CA", opts...)
+	if err != nil {
+		return Files{}, err
+	}
+	leaf, leafKey, err := SignLeaf(caCert, caKey, cn, dns, opts...)
+	if err != nil {
+		return Files{}, err
+	}
+	caKeyPEM, err := EncodeKeyPEM(caKey)
+	if err != nil {
+		return Files{}, err
+	}
+	leafKeyPEM, err := EncodeKeyPEM(leafKey)
+	if err != nil {
+		return Files{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Files{}, fmt.Errorf("ca: %w", err)
+	}
+	f := Files{
+		CA:    filepath.Join(dir, "ca.pem"),
+		CAKey: filepath.Join(dir, "ca-key.pem"),
+		Cert:  filepath.Join(dir, "cert.pem"),
+		Key:   filepath.Join(dir, "key.pem"),
+	}
+	for _, w := range []struct {
+		path string
+		data []byte
+		perm os.FileMode
+	}{
+		{f.CA, EncodeCertPEM(caCert), 0o644},
+		{f.CAKey, caKeyPEM, 0o600},
+		{f.Cert, EncodeCertPEM(leaf), 0o644},
+		{f.Key, leafKeyPEM, 0o600},
+	} {
+		if err := os.WriteFile(w.path, w.data, w.perm); err != nil {
+			return Files{}, fmt.Errorf("ca: %w", err)
+		}
+		// WriteFile keeps the mode of a file it overwrites.
+		if err := os.Chmod(w.path, w.perm); err != nil {
+			return Files{}, fmt.Errorf("ca: %w", err)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,154 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/security"
+)
+
+func TestSignLeafVerifiesAgainstCA(t *testing.T) {
+	for name, k := range map[string]KeyType{
+		"ECDSA P-256": ECDSAP256,
+		"ECDSA P-384": ECDSAP384,
+		"RSA 2048":    RSA2048,
+		"Ed25519":     Ed25519,
+	} {
+		t.Run(name, func(t *testing.T) {
+			caCert, caKey, err := GenerateCA("vlink-ca", WithKeyType(k))
+			if err != nil {
+				t.Fatalf("GenerateCA: %v", err)
+			}
+			leaf, _, err := SignLeaf(caCert, caKey, "car-001", []string{"car-001.fleet.local"}, WithKeyType(k))
+			if err != nil {
+				t.Fatalf("SignLeaf: %v", err)
+			}
+
+			roots := x509.NewCertPool()
+			roots.AddCert(caCert)
+			for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth} {
+				_, err := leaf.Verify(x509.VerifyOptions{
+					Roots:     roots,
+					DNSName:   "car-001.fleet.local",
+					KeyUsages: []x509.ExtKeyUsage{usage},
+				})
+				if err != nil {
+					t.Errorf("verify for %v: %v", usage, err)
+				}
+			}
+			if leaf.Subject.CommonName != "car-001" {
+				t.Errorf("CommonName = %q, want car-001", leaf.Subject.CommonName)
+			}
+		})
+	}
+}
+
+func TestSignLeafRejectsOtherCA(t *testing.T) {
+	caCert, caKey, err := GenerateCA("vlink-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := GenerateCA("other-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := SignLeaf(caCert, caKey, "car-001", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(other)
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err == nil {
+		t.Error("leaf verified against an unrelated CA")
+	}
+	if _, _, err := SignLeaf(nil, nil, "car-001", nil); err == nil {
+		t.Error("SignLeaf succeeded without a CA")
+	}
+}
+
+func TestValidity(t *testing.T) {
+	caCert, caKey, err := GenerateCA("vlink-ca", WithValidity(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := time.Until(caCert.NotAfter); left < 47*time.Hour || left > 48*time.Hour {
+		t.Errorf("CA valid for %v, want about 48h", left)
+	}
+	short, _, err := SignLeaf(caCert, caKey, "car-001", nil, WithValidity(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := time.Until(short.NotAfter); left < 59*time.Minute || left > time.Hour {
+		t.Errorf("leaf valid for %v, want about 1h", left)
+	}
+	// The default leaf validity exceeds the CA's, so it is capped.
+	long, _, err := SignLeaf(caCert, caKey, "car-001", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !long.NotAfter.Equal(caCert.NotAfter) {
+		t.Errorf("leaf NotAfter = %v, want capped at the CA's %v", long.NotAfter, caCert.NotAfter)
+	}
+}
+
+func TestWriteFilesLoadsIntoTLSConfig(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	files, err := WriteFiles(dir, "car-001", []string{"localhost"})
+	if err != nil {
+		t.Fatalf("WriteFiles: %v", err)
+	}
+	for _, path := range []string{files.CAKey, files.Key} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Errorf("%s mode = %v, want 0600", filepath.Base(path), perm)
+		}
+	}
+
+	cfg, err := security.TLSConfig(files.Cert, files.Key, files.CA)
+	if err != nil {
+		t.Fatalf("TLSConfig: %v", err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %d, want TLS 1.3", cfg.MinVersion)
+	}
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: cfg.RootCAs, DNSName: "localhost"}); err != nil {
+		t.Errorf("written leaf does not verify against written CA: %v", err)
+	}
+
+	// The CA key issues further leaves that verify against the same CA.
+	caPEM, err := os.ReadFile(files.CA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKeyPEM, err := os.ReadFile(files.CAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := security.LoadKeyPairFromPEM(caPEM, caKeyPEM)
+	if err != nil {
+		t.Fatalf("load CA key pair: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, _, err := SignLeaf(caCert, pair.PrivateKey.(crypto.Signer), "car-002", []string{"localhost"})
+	if err != nil {
+		t.Fatalf("SignLeaf with the written CA key: %v", err)
+	}
+	if _, err := next.Verify(x509.VerifyOptions{Roots: cfg.RootCAs, DNSName: "localhost"}); err != nil {
+		t.Errorf("leaf from the written CA key does not verify: %v", err)
+	}
+}
@@ -1,11 +1,14 @@
 package security
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"fmt"
 	"math/big"
 	"time"
 )
@@ -31,7 +34,7 @@ func selfSignedCA(key *ecdsa.PrivateKey) (*x509.Certificate, error) {
 	return x509.ParseCertificate(der)
 }
 
-func signedLeaf(key *ecdsa.PrivateKey, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
+func signedLeaf(key crypto.Signer, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
 	tmpl := &x509.Certificate{
 		SerialNumber: big.NewInt(2),
 		Subject:      pkix.Name{CommonName: "vlink-test-leaf"},
@@ -41,13 +44,40 @@ func signedLeaf(key *ecdsa.PrivateKey, ca *x509.Certificate, caKey *ecdsa.Privat
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 		DNSNames:     []string{"localhost"},
 	}
-	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, key.Public(), caKey)
 	if err != nil {
 		return nil, err
 	}
 	return x509.ParseCertificate(der)
 }
 
-func marshalKey(key any) ([]byte, error) {
-	return x509.MarshalECPrivateKey(key.(*ecdsa.PrivateKey))
+// marshalKey encodes key in its type's traditional form: SEC 1 for ECDSA,
+// PKCS #1 for RSA. It returns the PEM block type to store it under.
+func marshalKey(key any) (string, []byte, error) {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		return "EC PRIVATE KEY", der, err
+	case *rsa.PrivateKey:
+		return "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(k), nil
+	default:
+		return "", nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func intermediateCA(key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "vlink-test-intermediate"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
 }
@@ -0,0 +1,61 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// IsAuthError reports whether err, returned by an MQTT connection attempt,
+// means the broker refused the client's identity or credentials, or that
+// the TLS handshake failed on a certificate. Retrying cannot fix either
+// without a configuration change, unlike a broker that is down or
+// unreachable.
+func IsAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, refused := range []error{
+		packets.ErrorRefusedBadUsernameOrPassword,
+		packets.ErrorRefusedNotAuthorised,
+		packets.ErrorRefusedIDRejected,
+		packets.ErrorRefusedBadProtocolVersion,
+		ErrRevoked,
+	} {
+		if errors.Is(err, refused) {
+			return true
+		}
+	}
+	var (
+		verify    *tls.CertificateVerificationError
+		authority x509.UnknownAuthorityError
+		invalid   x509.CertificateInvalidError
+		hostname  x509.HostnameError
+		alert     tls.AlertError
+	)
+	switch {
+	case errors.As(err, &verify), errors.As(err, &authority), errors.As(err, &invalid), errors.As(err, &hostname):
+		return true
+	case errors.As(err, &alert):
+		return certificateAlert(alert)
+	}
+	return false
+}
+
+// certificateAlert reports whether a is a TLS alert the peer sends when it
+// rejects this endpoint's certificate.
+func certificateAlert(a tls.AlertError) bool {
+	switch a {
+	case 42, // bad_certificate
+		43,  // unsupported_certificate
+		44,  // certificate_revoked
+		45,  // certificate_expired
+		46,  // certificate_unknown
+		48,  // unknown_ca
+		116: // certificate_required
+		return true
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestIsAuthError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err  error
+		want bool
+	}{
+		"bad credentials":  {fmt.Errorf("%w : %w", packets.ErrorRefusedBadUsernameOrPassword, io.EOF), true},
+		"not authorised":   {packets.ErrorRefusedNotAuthorised, true},
+		"unknown CA":       {fmt.Errorf("security: verify server certificate: %w", x509.UnknownAuthorityError{}), true},
+		"revoked":          {fmt.Errorf("%w: serial 1", ErrRevoked), true},
+		"bad certificate":  {fmt.Errorf("remote error: %w", tls.AlertError(42)), true},
+		"server down":      {packets.ErrorRefusedServerUnavailable, false},
+		"network":          {errors.New("dial tcp: connection refused"), false},
+		"internal alert":   {tls.AlertError(80), false},
+		"no error":         {nil, false},
+		"closed mid-write": {io.ErrUnexpectedEOF, false},
+	} {
+		if got := IsAuthError(tc.err); got != tc.want {
+			t.Errorf("%s: IsAuthError(%v) = %v, want %v", name, tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package security
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+)
+
+// ErrRevoked is returned, wrapped, for a peer whose certificate is revoked.
+var ErrRevoked = errors.New("security: certificate revoked")
+
+// CRL checks peer certificates against a certificate revocation list, e.g.
+// to shut out a stolen or decommissioned vehicle whose certificate has not
+// expired yet. The list file is re-read whenever it changes on disk, so
+// publishing a new CRL takes effect on the next handshake without a restart.
+//
+// A CRL only checks the peers of the endpoint it is applied to. Vehicles and
+// the control center are both MQTT clients, so on either one it checks the
+// broker's certificate alone; revoked vehicles are refused only by a CRL at
+// the broker, or at a bridge terminating vehicle connections.
+type CRL struct {
+	crlFile string
+	caFile  string // empty for LoadCRLFromPEM
+
+	mu         sync.Mutex
+	issuers    []*x509.Certificate // from the CA bundle; one must sign the list
+	modTime    time.Time
+	size       int64
+	issuer     []byte              // raw issuer name of the list
+	revoked    map[string]struct{} // serial numbers, in decimal
+	nextUpdate time.Time
+	staleDone  bool // the list was reported stale
+	log        logging.Logger
+}
+
+// LoadCRL reads the PEM or DER revocation list crlFile. Its signature must
+// verify against a certificate in the CA bundle caFile, so a forged list
+// cannot be used to reject arbitrary peers.
+func LoadCRL(crlFile, caFile string) (*CRL, error) {
+	issuers, err := loadCACerts(caFile)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newCRL(crlFile, issuers)
+	if err != nil {
+		return nil, err
+	}
+	c.caFile = caFile
+	return c, nil
+}
+
+// LoadCRLFromPEM is LoadCRL for a CA bundle held in memory, as with
+// TLSConfigFromPEM. The list itself is still a file, so that it can be
+// re-read when it changes.
+func LoadCRLFromPEM(crlFile string, caPEM []byte) (*CRL, error) {
+	issuers, err := parseCACerts(caPEM, "PEM data")
+	if err != nil {
+		return nil, err
+	}
+	return newCRL(crlFile, issuers)
+}
+
+func newCRL(crlFile string, issuers []*x509.Certificate) (*CRL, error) {
+	c := &CRL{crlFile: crlFile, issuers: issuers, log: logging.Default()}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetLogger directs the warnings about a list that failed to reload or is
+// stale to l instead of logging.Default.
+func (c *CRL) SetLogger(l logging.Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log = logging.OrDefault(l)
+}
+
+// loadLocked re-reads the list if the file changed since it was last read.
+func (c *CRL) loadLocked() error {
+	info, err := os.Stat(c.crlFile)
+	if err != nil {
+		return fmt.Errorf("security: CRL: %w", err)
+	}
+	if c.revoked != nil && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return nil
+	}
+	data, err := os.ReadFile(c.crlFile) // #nosec G304 – caller-controlled path
+	if err != nil {
+		return fmt.Errorf("security: CRL: %w", err)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return fmt.Errorf("security: CRL %s: unexpected PEM block %q", c.crlFile, block.Type)
+		}
+		data = block.Bytes
+	}
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("security: CRL %s: %w", c.crlFile, err)
+	}
+	if err := c.checkSignature(list); err != nil {
+		return err
+	}
+
+	revoked := make(map[string]struct{}, len(list.RevokedCertificateEntries))
+	for _, e := range list.RevokedCertificateEntries {
+		revoked[e.SerialNumber.String()] = struct{}{}
+	}
+	c.modTime, c.size = info.ModTime(), info.Size()
+	c.issuer = list.RawIssuer
+	c.revoked = revoked
+	c.nextUpdate, c.staleDone = list.NextUpdate, false
+	return nil
+}
+
+// ReloadIssuers re-reads the CA bundle the list was loaded with, e.g. after
+// the CA pool of a ReloadableTLSConfig was reloaded, and checks the list
+// against it again. On error the previous issuers and list stay in force. A
+// CRL from LoadCRLFromPEM has no bundle file and is left unchanged.
+func (c *CRL) ReloadIssuers() error {
+	if c.caFile == "" {
+		return nil
+	}
+	issuers, err := loadCACerts(c.caFile)
+	if err != nil {
+		return fmt.Errorf("security: CRL issuers: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prevIssuers, prevRevoked := c.issuers, c.revoked
+	c.issuers, c.revoked = issuers, nil // force the list to be re-read
+	if err := c.loadLocked(); err != nil {
+		c.issuers, c.revoked = prevIssuers, prevRevoked
+		return err
+	}
+	return nil
+}
+
+// checkStaleLocked warns once per list when the time by which its issuer
+// promised a newer one has passed at now, which suggests CRL distribution
+// has stopped and recent revocations are missing. The list stays in force:
+// refusing every peer over an old list would turn a publishing hiccup into
+// an outage. The caller must hold c.mu.
+func (c *CRL) checkStaleLocked(now time.Time) {
+	if c.staleDone || c.nextUpdate.IsZero() || !now.After(c.nextUpdate) {
+		return
+	}
+	c.staleDone = true
+	c.log.Warn("CRL is stale", "crl", c.crlFile, "next_update", c.nextUpdate.Format(time.RFC3339))
+}
+
+func (c *CRL) checkSignature(list *x509.RevocationList) error {
+	for _, ca := range c.issuers {
+		if !bytes.Equal(ca.RawSubject, list.RawIssuer) {
+			continue
+		}
+		if err := list.CheckSignatureFrom(ca); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("security: CRL %s is not signed by a trusted CA", c.crlFile)
+}
+
+// Revoked reports whether cert is on the list. Only certificates issued by
+// the list's issuer can be on it, since serial numbers are unique per
+// issuer. If the file changed but the new version fails to load, the
+// previous list stays in force and the failure is logged, so a half-written
+// CRL neither lets revoked peers in nor locks everyone out. A list past its
+// NextUpdate is likewise kept, with a warning.
+func (c *CRL) Revoked(cert *x509.Certificate) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		c.log.Warn("keeping previous CRL", "crl", c.crlFile, "err", err)
+	}
+	c.checkStaleLocked(time.Now())
+	if !bytes.Equal(cert.RawIssuer, c.issuer) {
+		return false
+	}
+	_, ok := c.revoked[cert.SerialNumber.String()]
+	return ok
+}
+
+// VerifyPeerCertificate is a tls.Config.VerifyPeerCertificate callback that
+// rejects a peer if any certificate in its chain is revoked. It checks the
+// verified chains, or the certificates as presented when verification was
+// left to a later callback.
+func (c *CRL) VerifyPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	var certs []*x509.Certificate
+	for _, chain := range verifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(verifiedChains) == 0 {
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("security: peer certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	for _, cert := range certs {
+		if c.Revoked(cert) {
+			return fmt.Errorf("%w: %q, serial %s", ErrRevoked, cert.Subject, cert.SerialNumber)
+		}
+	}
+	return nil
+}
+
+// ApplyCRL makes cfg reject peers whose certificate crl lists: the clients
+// of a server config, the server of a client config. Session
+// tickets are disabled because a resumed session skips
+// VerifyPeerCertificate, which would let a peer revoked since its first
+// handshake back in.
+func ApplyCRL(cfg *tls.Config, crl *CRL) {
+	cfg.VerifyPeerCertificate = crl.VerifyPeerCertificate
+	cfg.SessionTicketsDisabled = true
+	if cfg.GetConfigForClient != nil {
+		next := cfg.GetConfigForClient
+		cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := next(hello)
+			if err != nil || c == nil {
+				return c, err
+			}
+			c.VerifyPeerCertificate = crl.VerifyPeerCertificate
+			c.SessionTicketsDisabled = true
+			return c, nil
+		}
+	}
+}
+
+// TLSConfigWithCRL builds a config like TLSConfig that also rejects peers
+// whose certificate is listed in the revocation list crlFile (see LoadCRL).
+func TLSConfigWithCRL(certFile, keyFile, caFile, crlFile string) (*tls.Config, error) {
+	cfg, err := TLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := LoadCRL(crlFile, caFile)
+	if err != nil {
+		return nil, err
+	}
+	ApplyCRL(cfg, crl)
+	return cfg, nil
+}
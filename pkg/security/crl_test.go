@@ -0,0 +1,216 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+)
+
+// writeCRL writes a PEM CRL issued by ca that revokes the given serials.
+func writeCRL(t *testing.T, path string, ca *testCA, number int64, serials ...*big.Int) {
+	t.Helper()
+	writeCRLUntil(t, path, ca, number, time.Now().Add(time.Hour), serials...)
+}
+
+// writeCRLUntil is writeCRL for a list whose next update is due at next.
+func writeCRLUntil(t *testing.T, path string, ca *testCA, number int64, next time.Time, serials ...*big.Int) {
+	t.Helper()
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(number),
+		ThisUpdate: next.Add(-2 * time.Hour),
+		NextUpdate: next,
+	}
+	for _, s := range serials {
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   s,
+			RevocationTime: time.Now(),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	if err != nil {
+		t.Fatalf("create CRL: %v", err)
+	}
+	writePEM(t, path, "X509 CRL", der)
+}
+
+// serverHandshake runs a handshake over a pipe and returns the server's
+// error, which is where a client certificate is rejected.
+func serverHandshake(t *testing.T, client, server *tls.Config) error {
+	t.Helper()
+	cc, sc := net.Pipe()
+	defer cc.Close()
+	errc := make(chan error, 1)
+	go func() {
+		defer sc.Close()
+		errc <- tls.Server(sc, server).Handshake()
+	}()
+	cli := tls.Client(cc, client)
+	if err := cli.Handshake(); err == nil {
+		// TLS 1.3 clients finish before the server has checked their
+		// certificate; read to see the server's verdict.
+		_, _ = cli.Read(make([]byte, 1))
+	}
+	return <-errc
+}
+
+func TestCRLRejectsRevokedPeer(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca.pem")
+	leaf := ca.issue(t, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	crlFile := filepath.Join(dir, "crl.pem")
+	writeCRL(t, crlFile, ca, 1, leaf.SerialNumber)
+
+	crl, err := LoadCRL(crlFile, ca.file)
+	if err != nil {
+		t.Fatalf("LoadCRL: %v", err)
+	}
+	if !crl.Revoked(leaf) {
+		t.Error("listed leaf not revoked")
+	}
+	if crl.Revoked(ca.cert) {
+		t.Error("CA reported revoked")
+	}
+	err = crl.VerifyPeerCertificate(nil, [][]*x509.Certificate{{leaf, ca.cert}})
+	if !errors.Is(err, ErrRevoked) {
+		t.Errorf("VerifyPeerCertificate = %v, want ErrRevoked", err)
+	}
+	if err := crl.VerifyPeerCertificate([][]byte{leaf.Raw}, nil); !errors.Is(err, ErrRevoked) {
+		t.Errorf("VerifyPeerCertificate on raw certificates = %v, want ErrRevoked", err)
+	}
+}
+
+func TestTLSConfigWithCRLHandshake(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca.pem")
+	srvCert, srvKey := filepath.Join(dir, "srv.pem"), filepath.Join(dir, "srv.key")
+	cliCert, cliKey := filepath.Join(dir, "cli.pem"), filepath.Join(dir, "cli.key")
+	ca.issue(t, srvCert, srvKey)
+	cliLeaf := ca.issue(t, cliCert, cliKey)
+	crlFile := filepath.Join(dir, "crl.pem")
+	writeCRL(t, crlFile, ca, 1)
+
+	server, err := TLSConfigWithCRL(srvCert, srvKey, ca.file, crlFile)
+	if err != nil {
+		t.Fatalf("TLSConfigWithCRL: %v", err)
+	}
+	client, err := ClientTLSConfig(cliCert, cliKey, ca.file)
+	if err != nil {
+		t.Fatalf("ClientTLSConfig: %v", err)
+	}
+	client.ServerName = "localhost"
+
+	if err := serverHandshake(t, client, server); err != nil {
+		t.Fatalf("handshake before revocation: %v", err)
+	}
+
+	// Publishing a new list takes effect without rebuilding the config.
+	writeCRL(t, crlFile, ca, 2, cliLeaf.SerialNumber)
+	if err := serverHandshake(t, client, server); !errors.Is(err, ErrRevoked) {
+		t.Errorf("handshake with revoked client = %v, want ErrRevoked", err)
+	}
+}
+
+func TestReloadableTLSConfigWithCRL(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca.pem")
+	srvCert, srvKey := filepath.Join(dir, "srv.pem"), filepath.Join(dir, "srv.key")
+	cliCert, cliKey := filepath.Join(dir, "cli.pem"), filepath.Join(dir, "cli.key")
+	ca.issue(t, srvCert, srvKey)
+	cliLeaf := ca.issue(t, cliCert, cliKey)
+	crlFile := filepath.Join(dir, "crl.pem")
+	writeCRL(t, crlFile, ca, 1, cliLeaf.SerialNumber)
+
+	crl, err := LoadCRL(crlFile, ca.file)
+	if err != nil {
+		t.Fatalf("LoadCRL: %v", err)
+	}
+	server, _ := ReloadableTLSConfig(srvCert, srvKey, ca.file)
+	ApplyCRL(server, crl)
+	client, _ := ReloadableTLSConfig(cliCert, cliKey, ca.file)
+	client.ServerName = "localhost"
+
+	if err := serverHandshake(t, client, server); !errors.Is(err, ErrRevoked) {
+		t.Errorf("handshake with revoked client = %v, want ErrRevoked", err)
+	}
+}
+
+func TestLoadCRLRejectsUntrustedIssuer(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca.pem")
+	other := newTestCA(t, dir, "other.pem")
+	crlFile := filepath.Join(dir, "crl.pem")
+	writeCRL(t, crlFile, other, 1, big.NewInt(2))
+
+	if _, err := LoadCRL(crlFile, ca.file); err == nil {
+		t.Error("LoadCRL accepted a list signed by an untrusted CA")
+	}
+}
+
+func TestCRLWarnsWhenStale(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca.pem")
+	leaf := ca.issue(t, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	crlFile := filepath.Join(dir, "crl.pem")
+	writeCRLUntil(t, crlFile, ca, 1, time.Now().Add(-time.Hour), leaf.SerialNumber)
+
+	crl, err := LoadCRL(crlFile, ca.file)
+	if err != nil {
+		t.Fatalf("LoadCRL: %v", err)
+	}
+	var rec logging.Recorder
+	crl.SetLogger(&rec)
+	if !crl.Revoked(leaf) || !crl.Revoked(leaf) {
+		t.Error("stale list no longer in force")
+	}
+	n := 0
+	for _, e := range rec.Entries() {
+		if e.Msg == "CRL is stale" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("logged %+v, want one stale warning", rec.Entries())
+	}
+}
+
+func TestCRLReloadIssuers(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca.pem")
+	crlFile := filepath.Join(dir, "crl.pem")
+	writeCRL(t, crlFile, ca, 1)
+	crl, err := LoadCRL(crlFile, ca.file)
+	if err != nil {
+		t.Fatalf("LoadCRL: %v", err)
+	}
+
+	// The CA is rotated and the new one publishes the list.
+	next := newTestCA(t, dir, "ca.pem")
+	nextLeaf := next.issue(t, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	writeCRL(t, crlFile, next, 2, nextLeaf.SerialNumber)
+	if crl.Revoked(nextLeaf) {
+		t.Fatal("list signed by a CA not yet reloaded was accepted")
+	}
+	if err := crl.ReloadIssuers(); err != nil {
+		t.Fatalf("ReloadIssuers: %v", err)
+	}
+	if !crl.Revoked(nextLeaf) {
+		t.Error("list of the reloaded CA not in force")
+	}
+
+	// A bundle the list does not verify against leaves the list in force.
+	newTestCA(t, dir, "ca.pem")
+	if err := crl.ReloadIssuers(); err == nil {
+		t.Error("ReloadIssuers accepted a bundle without the list's issuer")
+	}
+	if !crl.Revoked(nextLeaf) {
+		t.Error("failed reload changed the list in force")
+	}
+}
@@ -0,0 +1,96 @@
+package security
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+)
+
+// DefaultExpiryWarning is how long before expiry CheckExpiry starts warning
+// when given no threshold.
+const DefaultExpiryWarning = 30 * 24 * time.Hour
+
+// CertExpiry returns when the PEM certificate file certFile stops being
+// usable. For a chain, i.e. a leaf followed by its intermediates, that is
+// the earliest NotAfter of any certificate in it, since the chain no longer
+// verifies once any link has expired.
+func CertExpiry(certFile string) (time.Time, error) {
+	data, err := os.ReadFile(certFile) // #nosec G304 – caller-controlled path
+	if err != nil {
+		return time.Time{}, err
+	}
+	return certExpiry(data, certFile)
+}
+
+// CertExpiryPEM is CertExpiry for a certificate chain held in memory.
+func CertExpiryPEM(certPEM []byte) (time.Time, error) {
+	return certExpiry(certPEM, "PEM data")
+}
+
+func certExpiry(data []byte, source string) (time.Time, error) {
+	var earliest time.Time
+	n := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("security: certificate %d in %s: %w", n+1, source, err)
+		}
+		if n == 0 || cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+		n++
+	}
+	if n == 0 {
+		return time.Time{}, errors.New("security: no certificate in " + source)
+	}
+	return earliest, nil
+}
+
+// CheckExpiry looks up the expiry of certFile (see CertExpiry) and logs a
+// warning to log if it is less than within away from now, or already past.
+// A non-positive within means DefaultExpiryWarning, and a nil log
+// logging.Default. It returns the expiry so callers can export the
+// remaining validity.
+func CheckExpiry(certFile string, within time.Duration, now time.Time, log logging.Logger) (time.Time, error) {
+	expiry, err := CertExpiry(certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	warnExpiry(log, certFile, expiry, within, now)
+	return expiry, nil
+}
+
+// CheckExpiryPEM is CheckExpiry for a certificate chain held in memory.
+func CheckExpiryPEM(certPEM []byte, within time.Duration, now time.Time, log logging.Logger) (time.Time, error) {
+	expiry, err := CertExpiryPEM(certPEM)
+	if err != nil {
+		return time.Time{}, err
+	}
+	warnExpiry(log, "PEM data", expiry, within, now)
+	return expiry, nil
+}
+
+func warnExpiry(log logging.Logger, source string, expiry time.Time, within time.Duration, now time.Time) {
+	if within <= 0 {
+		within = DefaultExpiryWarning
+	}
+	switch left := expiry.Sub(now); {
+	case left <= 0:
+		logging.OrDefault(log).Warn("certificate expired", "cert", source, "expiry", expiry.Format(time.RFC3339))
+	case left < within:
+		logging.OrDefault(log).Warn("certificate expires soon", "cert", source, "left", left.Round(time.Second), "expiry", expiry.Format(time.RFC3339))
+	}
+}
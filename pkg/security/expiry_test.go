@@ -0,0 +1,122 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+)
+
+// leafUntil issues a leaf from ca that expires at notAfter.
+func leafUntil(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+	key, err := newECDSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "vlink-test-leaf"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+func TestCertExpiryReportsEarliestInChain(t *testing.T) {
+	rootKey, _ := newECDSAKey()
+	root, err := selfSignedCA(rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interKey, _ := newECDSAKey()
+	inter, err := intermediateCA(interKey, root, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The leaf outlives its intermediate, which expires in an hour.
+	leaf := leafUntil(t, inter, interKey, time.Now().Add(24*time.Hour))
+
+	path := filepath.Join(t.TempDir(), "chain.pem")
+	var chain []byte
+	for _, c := range []*x509.Certificate{leaf, inter} {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	if err := os.WriteFile(path, chain, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := CertExpiry(path)
+	if err != nil {
+		t.Fatalf("CertExpiry: %v", err)
+	}
+	if !got.Equal(inter.NotAfter) {
+		t.Errorf("expiry = %v, want the intermediate's %v", got, inter.NotAfter)
+	}
+}
+
+func TestCertExpiryErrors(t *testing.T) {
+	if _, err := CertExpiry("/no/such/cert.pem"); err == nil {
+		t.Error("expected error for a missing file")
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	writePEM(t, path, "EC PRIVATE KEY", []byte("key"))
+	if _, err := CertExpiry(path); err == nil {
+		t.Error("expected error for a file without certificates")
+	}
+}
+
+func TestCheckExpiryWarnsNearExpiry(t *testing.T) {
+	caKey, _ := newECDSAKey()
+	ca, err := selfSignedCA(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	leaf := leafUntil(t, ca, caKey, now.Add(2*time.Hour))
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	writePEM(t, path, "CERTIFICATE", leaf.Raw)
+
+	var rec logging.Recorder
+	expiry, err := CheckExpiry(path, time.Hour, now, &rec)
+	if err != nil {
+		t.Fatalf("CheckExpiry: %v", err)
+	}
+	if !expiry.Equal(leaf.NotAfter) {
+		t.Errorf("expiry = %v, want %v", expiry, leaf.NotAfter)
+	}
+	if len(rec.Entries()) != 0 {
+		t.Errorf("warned outside the threshold: %+v", rec.Entries())
+	}
+
+	if _, err := CheckExpiry(path, 3*time.Hour, now, &rec); err != nil {
+		t.Fatalf("CheckExpiry: %v", err)
+	}
+	if _, ok := rec.Find(logging.LevelWarn, "certificate expires soon"); !ok {
+		t.Errorf("no warning within the threshold: %+v", rec.Entries())
+	}
+
+	if _, err := CheckExpiry(path, 0, now.Add(3*time.Hour), &rec); err != nil {
+		t.Fatalf("CheckExpiry: %v", err)
+	}
+	if _, ok := rec.Find(logging.LevelWarn, "certificate expired"); !ok {
+		t.Errorf("no warning for an expired certificate: %+v", rec.Entries())
+	}
+}
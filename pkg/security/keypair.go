@@ -0,0 +1,58 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// LoadKeyPairFromPEM builds a certificate from PEM held in memory, e.g. read
+// from a secrets manager, instead of from files. certPEM holds the
+// certificate, optionally followed by its intermediates. keyPEM holds the
+// private key as an "EC PRIVATE KEY" (SEC 1), "RSA PRIVATE KEY" (PKCS #1) or
+// "PRIVATE KEY" (PKCS #8) block; other blocks, such as the "EC PARAMETERS"
+// openssl writes ahead of an EC key, are skipped. Encrypted keys are not
+// supported. The key must match the certificate.
+func LoadKeyPairFromPEM(certPEM, keyPEM []byte) (tls.Certificate, error) {
+	block, err := findPrivateKey(keyPEM)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	// X509KeyPair checks that the key matches the certificate.
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(block))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("security: key pair: %w", err)
+	}
+	return cert, nil
+}
+
+// findPrivateKey returns the first private key block of keyPEM, having
+// checked that it parses, so a bad key is reported by its encoding.
+func findPrivateKey(keyPEM []byte) (*pem.Block, error) {
+	for {
+		var block *pem.Block
+		block, keyPEM = pem.Decode(keyPEM)
+		if block == nil {
+			return nil, errors.New("security: no private key in PEM data")
+		}
+		var err error
+		switch block.Type {
+		case "EC PRIVATE KEY":
+			_, err = x509.ParseECPrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, errors.New("security: encrypted private keys are not supported")
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("security: parse %s: %w", block.Type, err)
+		}
+		return block, nil
+	}
+}
@@ -0,0 +1,116 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKeyPairFromPEMKeyEncodings(t *testing.T) {
+	caKey, _ := newECDSAKey()
+	ca, err := selfSignedCA(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := newECDSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8 := func(key any) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	traditional := func(key any) []byte {
+		blockType, der, err := marshalKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	}
+	// openssl ecparam -genkey writes the curve ahead of the key.
+	withParams := func(key any) []byte {
+		params := pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08}})
+		return append(params, traditional(key)...)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		key    crypto.Signer
+		encode func(any) []byte
+	}{
+		{"EC PRIVATE KEY", ecKey, traditional},
+		{"EC PRIVATE KEY after EC PARAMETERS", ecKey, withParams},
+		{"RSA PRIVATE KEY", rsaKey, traditional},
+		{"PKCS8 ECDSA", ecKey, pkcs8},
+		{"PKCS8 RSA", rsaKey, pkcs8},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			leaf, err := signedLeaf(tc.key, ca, caKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+			cert, err := LoadKeyPairFromPEM(certPEM, tc.encode(tc.key))
+			if err != nil {
+				t.Fatalf("LoadKeyPairFromPEM: %v", err)
+			}
+			if !bytes.Equal(cert.Certificate[0], leaf.Raw) {
+				t.Error("loaded certificate differs from the leaf")
+			}
+
+			// The file-based helpers accept the same encodings.
+			dir := t.TempDir()
+			certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			writePEM(t, certFile, "CERTIFICATE", leaf.Raw)
+			if err := os.WriteFile(keyFile, tc.encode(tc.key), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			caFile := filepath.Join(dir, "ca.pem")
+			writePEM(t, caFile, "CERTIFICATE", ca.Raw)
+			if _, err := TLSConfig(certFile, keyFile, caFile); err != nil {
+				t.Errorf("TLSConfig: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadKeyPairFromPEMErrors(t *testing.T) {
+	caKey, _ := newECDSAKey()
+	ca, err := selfSignedCA(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := newECDSAKey()
+	leaf, err := signedLeaf(key, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	other, _ := newECDSAKey()
+	_, otherDER, _ := marshalKey(other)
+
+	for name, keyPEM := range map[string][]byte{
+		"no key":        certPEM,
+		"encrypted key": pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte("x")}),
+		"corrupt key":   pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("x")}),
+		"mismatched":    pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherDER}),
+	} {
+		if _, err := LoadKeyPairFromPEM(certPEM, keyPEM); err == nil {
+			t.Errorf("%s: LoadKeyPairFromPEM succeeded", name)
+		}
+	}
+}
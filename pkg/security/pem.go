@@ -0,0 +1,47 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// TLSConfigFromPEM builds the same TLS 1.3 mTLS config as ServerTLSConfig
+// (serverSide) or ClientTLSConfig from PEM held in memory, e.g. a mounted
+// Kubernetes secret or a secrets-manager response, rather than from files.
+// certPEM and keyPEM are as for LoadKeyPairFromPEM and caPEM as for
+// LoadCertPool.
+func TLSConfigFromPEM(certPEM, keyPEM, caPEM []byte, serverSide bool) (*tls.Config, error) {
+	cert, err := LoadKeyPairFromPEM(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	caPool, err := CertPoolFromPEM(caPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caPool,
+		ClientCAs:    caPool,
+		ClientAuth:   tls.NoClientCert,
+	}
+	if serverSide {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// CertPoolFromPEM is LoadCertPool for a CA bundle held in memory.
+func CertPoolFromPEM(caPEM []byte) (*x509.CertPool, error) {
+	certs, err := parseCACerts(caPEM, "PEM data")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
@@ -0,0 +1,71 @@
+package security
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"testing"
+)
+
+func TestTLSConfigFromPEM(t *testing.T) {
+	caKey, _ := newECDSAKey()
+	ca, err := selfSignedCA(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+	issue := func() (certPEM, keyPEM []byte) {
+		key, _ := newECDSAKey()
+		leaf, err := signedLeaf(key, ca, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockType, der, err := marshalKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}),
+			pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	}
+	srvCert, srvKey := issue()
+	cliCert, cliKey := issue()
+
+	server, err := TLSConfigFromPEM(srvCert, srvKey, caPEM, true)
+	if err != nil {
+		t.Fatalf("server TLSConfigFromPEM: %v", err)
+	}
+	client, err := TLSConfigFromPEM(cliCert, cliKey, caPEM, false)
+	if err != nil {
+		t.Fatalf("client TLSConfigFromPEM: %v", err)
+	}
+	for name, cfg := range map[string]*tls.Config{"server": server, "client": client} {
+		if cfg.MinVersion != tls.VersionTLS13 {
+			t.Errorf("%s MinVersion = %d, want TLS 1.3", name, cfg.MinVersion)
+		}
+	}
+	if server.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("server ClientAuth = %v, want RequireAndVerifyClientCert", server.ClientAuth)
+	}
+	if client.ClientAuth != tls.NoClientCert {
+		t.Errorf("client ClientAuth = %v, want NoClientCert", client.ClientAuth)
+	}
+
+	client.ServerName = "localhost"
+	if err := serverHandshake(t, client, server); err != nil {
+		t.Errorf("mTLS handshake between in-memory configs: %v", err)
+	}
+
+	// A client without a certificate is refused, as with the file-based
+	// configs.
+	anon := client.Clone()
+	anon.Certificates = nil
+	if err := serverHandshake(t, anon, server); err == nil {
+		t.Error("server accepted a client without a certificate")
+	}
+
+	if _, err := TLSConfigFromPEM(cliCert, cliKey, []byte("no CA"), false); err == nil {
+		t.Error("TLSConfigFromPEM accepted a CA bundle without certificates")
+	}
+	if _, err := TLSConfigFromPEM(cliCert, srvKey, caPEM, false); err == nil {
+		t.Error("TLSConfigFromPEM accepted a key for another certificate")
+	}
+}
@@ -0,0 +1,208 @@
+package security
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// testCA is a CA that issues leaves into files for reload tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := newECDSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := selfSignedCA(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, name)
+	writePEM(t, file, "CERTIFICATE", cert.Raw)
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue writes a fresh leaf signed by ca and its key to the given paths.
+func (ca *testCA) issue(t *testing.T, certFile, keyFile string) *x509.Certificate {
+	t.Helper()
+	key, err := newECDSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := signedLeaf(key, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", leaf.Raw)
+	writeKeyPEM(t, keyFile, key)
+	return leaf
+}
+
+func servedLeaf(t *testing.T, cfg *tls.Config) []byte {
+	t.Helper()
+	cert, err := cfg.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestReloadableTLSConfigServesNewLeafAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca.pem")
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := ca.issue(t, certFile, keyFile)
+
+	cfg, reload := ReloadableTLSConfig(certFile, keyFile, ca.file)
+	if err := reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := servedLeaf(t, cfg); !bytes.Equal(got, first.Raw) {
+		t.Fatal("initial leaf not served")
+	}
+
+	second := ca.issue(t, certFile, keyFile)
+	if got := servedLeaf(t, cfg); !bytes.Equal(got, first.Raw) {
+		t.Fatal("leaf changed before reload")
+	}
+	if err := reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := servedLeaf(t, cfg); !bytes.Equal(got, second.Raw) {
+		t.Error("new leaf not served after reload")
+	}
+	cert, err := cfg.GetClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatalf("GetClientCertificate: %v", err)
+	}
+	if !bytes.Equal(cert.Certificate[0], second.Raw) {
+		t.Error("new leaf not presented as client certificate after reload")
+	}
+}
+
+func TestReloadableTLSConfigKeepsOldMaterialOnFailedReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca.pem")
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := ca.issue(t, certFile, keyFile)
+
+	cfg, reload := ReloadableTLSConfig(certFile, keyFile, ca.file)
+	if err := reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", []byte("half written"))
+	if err := reload(); err == nil {
+		t.Fatal("reload of a corrupt certificate succeeded")
+	}
+	if got := servedLeaf(t, cfg); !bytes.Equal(got, first.Raw) {
+		t.Error("failed reload replaced the leaf in use")
+	}
+}
+
+func TestReloadableTLSConfigMissingFiles(t *testing.T) {
+	cfg, reload := ReloadableTLSConfig("/no/such/cert.pem", "/no/such/key.pem", "/no/such/ca.pem")
+	if err := reload(); err == nil {
+		t.Error("expected error for missing files")
+	}
+	if _, err := cfg.GetCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Error("GetCertificate succeeded without a keypair")
+	}
+}
+
+// handshake runs a TLS handshake between client and server over a pipe and
+// returns the leaf the client saw and the client's error.
+func handshake(t *testing.T, client, server *tls.Config) ([]byte, error) {
+	t.Helper()
+	cc, sc := net.Pipe()
+	defer cc.Close()
+	defer sc.Close()
+	srv := tls.Server(sc, server)
+	go func() {
+		_ = srv.Handshake()
+		sc.Close()
+	}()
+	cli := tls.Client(cc, client)
+	if err := cli.Handshake(); err != nil {
+		return nil, err
+	}
+	return cli.ConnectionState().PeerCertificates[0].Raw, nil
+}
+
+func TestReloadableTLSConfigHandshake(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca.pem")
+	srvCert, srvKey := filepath.Join(dir, "srv.pem"), filepath.Join(dir, "srv.key")
+	cliCert, cliKey := filepath.Join(dir, "cli.pem"), filepath.Join(dir, "cli.key")
+	ca.issue(t, srvCert, srvKey)
+	ca.issue(t, cliCert, cliKey)
+
+	server, reloadServer := ReloadableTLSConfig(srvCert, srvKey, ca.file)
+	client, _ := ReloadableTLSConfig(cliCert, cliKey, ca.file)
+	client.ServerName = "localhost"
+
+	if _, err := handshake(t, client, server); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+
+	rotated := ca.issue(t, srvCert, srvKey)
+	if err := reloadServer(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	got, err := handshake(t, client, server)
+	if err != nil {
+		t.Fatalf("handshake after reload: %v", err)
+	}
+	if !bytes.Equal(got, rotated.Raw) {
+		t.Error("client did not see the rotated server leaf")
+	}
+
+	wrong := client.Clone()
+	wrong.ServerName = "elsewhere"
+	if _, err := handshake(t, wrong, server); err == nil {
+		t.Error("handshake succeeded against the wrong server name")
+	}
+}
+
+func TestReloadableTLSConfigPicksUpNewCA(t *testing.T) {
+	dir := t.TempDir()
+	oldCA := newTestCA(t, dir, "ca.pem")
+	srvCert, srvKey := filepath.Join(dir, "srv.pem"), filepath.Join(dir, "srv.key")
+	cliCert, cliKey := filepath.Join(dir, "cli.pem"), filepath.Join(dir, "cli.key")
+	oldCA.issue(t, srvCert, srvKey)
+	oldCA.issue(t, cliCert, cliKey)
+
+	server, reloadServer := ReloadableTLSConfig(srvCert, srvKey, oldCA.file)
+	client, reloadClient := ReloadableTLSConfig(cliCert, cliKey, oldCA.file)
+	client.ServerName = "localhost"
+	if _, err := handshake(t, client, server); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+
+	// Rotate the whole PKI: both sides get leaves from a new CA, which
+	// replaces the old one in the CA file.
+	newCA := newTestCA(t, dir, "ca.pem")
+	newCA.issue(t, srvCert, srvKey)
+	if err := reloadServer(); err != nil {
+		t.Fatalf("reload server: %v", err)
+	}
+	if _, err := handshake(t, client, server); err == nil {
+		t.Fatal("client trusted a server leaf from a CA it has not loaded")
+	}
+	newCA.issue(t, cliCert, cliKey)
+	if err := reloadClient(); err != nil {
+		t.Fatalf("reload client: %v", err)
+	}
+	if _, err := handshake(t, client, server); err != nil {
+		t.Errorf("handshake after both sides reloaded: %v", err)
+	}
+}
@@ -5,7 +5,9 @@ package security
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	"os"
 )
 
@@ -13,9 +15,11 @@ import (
 // mutual authentication (mTLS).
 //
 // Parameters:
-//   - certFile: path to the PEM-encoded certificate of this endpoint.
+//   - certFile: path to the PEM-encoded certificate of this endpoint,
+//     optionally followed by its intermediate CA certificates.
 //   - keyFile:  path to the PEM-encoded private key of this endpoint.
-//   - caFile:   path to the PEM-encoded CA certificate used to verify the peer.
+//   - caFile:   path to the PEM-encoded CA bundle used to verify the peer; see
+//     LoadCertPool.
 //
 // Both the vehicle agent and the control-center gateway must call this
 // function with their respective key-pairs and the shared CA certificate.
@@ -25,16 +29,11 @@ func TLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
 		return nil, err
 	}
 
-	caPEM, err := os.ReadFile(caFile) // #nosec G304 – caller-controlled path
+	caPool, err := LoadCertPool(caFile)
 	if err != nil {
 		return nil, err
 	}
 
-	caPool := x509.NewCertPool()
-	if !caPool.AppendCertsFromPEM(caPEM) {
-		return nil, errors.New("security: failed to parse CA certificate")
-	}
-
 	return &tls.Config{
 		MinVersion:   tls.VersionTLS13,
 		Certificates: []tls.Certificate{cert},
@@ -44,6 +43,57 @@ func TLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
 	}, nil
 }
 
+// LoadCertPool reads a PEM bundle of one or more concatenated CA
+// certificates, e.g. a root followed by its intermediates, into a pool. Every
+// certificate in the bundle is trusted, so peers whose chain runs through a
+// bundled intermediate verify even when they present only their leaf.
+// Unlike x509.CertPool.AppendCertsFromPEM, a malformed certificate is an
+// error rather than silently skipped.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	certs, err := loadCACerts(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// loadCACerts parses every certificate of the CA bundle caFile.
+func loadCACerts(caFile string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(caFile) // #nosec G304 – caller-controlled path
+	if err != nil {
+		return nil, err
+	}
+	return parseCACerts(data, caFile)
+}
+
+// parseCACerts parses every certificate of a PEM CA bundle read from source.
+func parseCACerts(data []byte, source string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("security: CA certificate %d in %s: %w", len(certs)+1, source, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("security: failed to parse CA certificate")
+	}
+	return certs, nil
+}
+
 // ServerTLSConfig creates a TLS config for the server side (control center gateway).
 // It requires the connecting client to present a valid certificate signed by caFile.
 func ServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
@@ -117,12 +117,72 @@ func writePEM(t *testing.T, path, blockType string, data []byte) {
 
 func writeKeyPEM(t *testing.T, path string, key any) {
 	t.Helper()
-	der, err := marshalKey(key)
+	blockType, der, err := marshalKey(key)
 	if err != nil {
 		t.Fatalf("marshal key: %v", err)
 	}
-	writePEM(t, path, "EC PRIVATE KEY", der)
+	writePEM(t, path, blockType, der)
 }
 
 // helpers in a separate file (cert_helpers_test.go) so the test file is not too long.
 var _ = x509.NewCertPool // import used
+
+func TestTLSConfigVerifiesThroughIntermediate(t *testing.T) {
+	dir := t.TempDir()
+	rootKey, _ := newECDSAKey()
+	root, err := selfSignedCA(rootKey)
+	if err != nil {
+		t.Fatalf("root: %v", err)
+	}
+	interKey, _ := newECDSAKey()
+	inter, err := intermediateCA(interKey, root, rootKey)
+	if err != nil {
+		t.Fatalf("intermediate: %v", err)
+	}
+	leafKey, _ := newECDSAKey()
+	leaf, err := signedLeaf(leafKey, inter, interKey)
+	if err != nil {
+		t.Fatalf("leaf: %v", err)
+	}
+
+	caFile := filepath.Join(dir, "bundle.pem")
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	var bundle []byte
+	for _, c := range []*x509.Certificate{root, inter} {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	if err := os.WriteFile(caFile, bundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", leaf.Raw)
+	writeKeyPEM(t, keyFile, leafKey)
+
+	cfg, err := TLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("TLSConfig: %v", err)
+	}
+	opts := x509.VerifyOptions{KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+
+	rootOnly := x509.NewCertPool()
+	rootOnly.AddCert(root)
+	opts.Roots = rootOnly
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Fatal("leaf verified against a root-only pool; test chain is wrong")
+	}
+
+	for name, pool := range map[string]*x509.CertPool{"RootCAs": cfg.RootCAs, "ClientCAs": cfg.ClientCAs} {
+		opts.Roots = pool
+		if _, err := leaf.Verify(opts); err != nil {
+			t.Errorf("verify leaf via %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoadCertPoolRejectsMalformedCert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.pem")
+	writePEM(t, path, "CERTIFICATE", []byte("not a certificate"))
+	if _, err := LoadCertPool(path); err == nil {
+		t.Error("expected error for malformed CA certificate")
+	}
+}
@@ -0,0 +1,65 @@
+package shadow
+
+import (
+	"sort"
+	"time"
+)
+
+// Divergence is a vehicle whose latest state differs between two shadows.
+type Divergence struct {
+	VehicleID string
+	// TimestampA and TimestampB are the vehicle timestamps (Unix ms) of the
+	// latest state in each shadow.
+	TimestampA int64
+	TimestampB int64
+}
+
+// Skew returns how far apart the two latest states are.
+func (d Divergence) Skew() time.Duration {
+	skew := d.TimestampA - d.TimestampB
+	if skew < 0 {
+		skew = -skew
+	}
+	return time.Duration(skew) * time.Millisecond
+}
+
+// DiffReport lists the differences between two shadow snapshots, each
+// sorted by vehicle ID.
+type DiffReport struct {
+	OnlyInA  []string
+	OnlyInB  []string
+	Diverged []Divergence
+}
+
+// Consistent reports whether the snapshots agreed.
+func (r DiffReport) Consistent() bool {
+	return len(r.OnlyInA) == 0 && len(r.OnlyInB) == 0 && len(r.Diverged) == 0
+}
+
+// Diff compares two shadow snapshots as returned by All, e.g. of an active
+// and a standby control center. A vehicle diverges when the timestamps of
+// its latest states differ by more than tolerance, which should allow for
+// the states in flight while the snapshots were taken.
+func Diff(a, b map[string]*Entry, tolerance time.Duration) DiffReport {
+	var r DiffReport
+	for id, ea := range a {
+		eb, ok := b[id]
+		if !ok {
+			r.OnlyInA = append(r.OnlyInA, id)
+			continue
+		}
+		d := Divergence{VehicleID: id, TimestampA: ea.State.Timestamp, TimestampB: eb.State.Timestamp}
+		if d.Skew() > tolerance {
+			r.Diverged = append(r.Diverged, d)
+		}
+	}
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			r.OnlyInB = append(r.OnlyInB, id)
+		}
+	}
+	sort.Strings(r.OnlyInA)
+	sort.Strings(r.OnlyInB)
+	sort.Slice(r.Diverged, func(i, j int) bool { return r.Diverged[i].VehicleID < r.Diverged[j].VehicleID })
+	return r
+}
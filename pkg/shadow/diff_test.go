@@ -0,0 +1,40 @@
+package shadow
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestDiffReportsDivergence(t *testing.T) {
+	active, standby := NewManager(), NewManager()
+	for _, m := range []*Manager{active, standby} {
+		m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 10_000})
+		m.Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: 10_000})
+	}
+	active.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 10_400}) // within tolerance
+	active.Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: 15_000}) // standby lags
+	active.Update(&protocol.VehicleState{VehicleID: "car-003", Timestamp: 10_000})
+	standby.Update(&protocol.VehicleState{VehicleID: "car-004", Timestamp: 10_000})
+
+	r := Diff(active.All(), standby.All(), time.Second)
+	want := DiffReport{
+		OnlyInA:  []string{"car-003"},
+		OnlyInB:  []string{"car-004"},
+		Diverged: []Divergence{{VehicleID: "car-002", TimestampA: 15_000, TimestampB: 10_000}},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Diff = %+v, want %+v", r, want)
+	}
+	if r.Consistent() {
+		t.Error("Consistent() = true for diverging snapshots")
+	}
+	if skew := r.Diverged[0].Skew(); skew != 5*time.Second {
+		t.Errorf("Skew = %v, want 5s", skew)
+	}
+	if r := Diff(standby.All(), standby.All(), 0); !r.Consistent() {
+		t.Errorf("Diff of a snapshot with itself = %+v", r)
+	}
+}
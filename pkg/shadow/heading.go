@@ -0,0 +1,76 @@
+package shadow
+
+import (
+	"math"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// HeadingAnomaly describes a heading change between two consecutive states
+// of a vehicle that no real vehicle could make, which usually means a faulty
+// IMU or GNSS heading rather than an actual turn.
+type HeadingAnomaly struct {
+	VehicleID string
+	Prev      *protocol.VehicleState
+	Next      *protocol.VehicleState
+	// Delta is the signed shortest turn from Prev.Heading to Next.Heading in
+	// degrees, in (-180, 180]; positive is clockwise.
+	Delta float64
+	// Rate is |Delta| per second between the two state timestamps.
+	Rate float64
+}
+
+// HeadingAnomalyListener is called for every HeadingAnomaly.
+type HeadingAnomalyListener func(HeadingAnomaly)
+
+// SetMaxTurnRate makes Update report a HeadingAnomaly to OnHeadingAnomaly
+// listeners when the heading changed faster than degPerSec since the
+// vehicle's previous state. The change is measured the short way round, so
+// 359° to 1° is a 2° turn. The state is still applied; the check only flags
+// it. Zero, the default, disables the check.
+func (m *Manager) SetMaxTurnRate(degPerSec float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxTurnRate = degPerSec
+}
+
+// OnHeadingAnomaly registers fn to be called, after the manager's lock is
+// released, for every state applied with an implausible heading change.
+func (m *Manager) OnHeadingAnomaly(fn HeadingAnomalyListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ls := make([]HeadingAnomalyListener, len(m.turns), len(m.turns)+1)
+	copy(ls, m.turns)
+	m.turns = append(ls, fn)
+}
+
+// HeadingDelta returns the signed shortest turn from heading `from` to
+// heading `to`, both in degrees, normalised to (-180, 180].
+func HeadingDelta(from, to float64) float64 {
+	d := math.Mod(to-from, 360)
+	switch {
+	case d > 180:
+		d -= 360
+	case d <= -180:
+		d += 360
+	}
+	return d
+}
+
+// headingAnomaly reports whether turning from prev to next exceeds
+// maxRate degrees per second.
+func headingAnomaly(prev, next *protocol.VehicleState, maxRate float64) (HeadingAnomaly, bool) {
+	if maxRate <= 0 || prev == nil {
+		return HeadingAnomaly{}, false
+	}
+	delta := HeadingDelta(float64(prev.Heading), float64(next.Heading))
+	dt := float64(next.Timestamp-prev.Timestamp) / 1000
+	if dt < 0.001 {
+		dt = 0.001
+	}
+	rate := math.Abs(delta) / dt
+	if rate <= maxRate {
+		return HeadingAnomaly{}, false
+	}
+	return HeadingAnomaly{VehicleID: next.VehicleID, Prev: prev, Next: next, Delta: delta, Rate: rate}, true
+}
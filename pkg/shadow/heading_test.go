@@ -0,0 +1,56 @@
+package shadow
+
+import (
+	"math"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestHeadingDeltaWraps(t *testing.T) {
+	for _, tc := range []struct{ from, to, want float64 }{
+		{10, 30, 20},
+		{30, 10, -20},
+		{359, 1, 2},
+		{1, 359, -2},
+		{0, 180, 180},
+		{180, 0, 180},
+		{90, 450, 0},
+	} {
+		if got := HeadingDelta(tc.from, tc.to); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("HeadingDelta(%v, %v) = %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestHeadingAnomalyDetection(t *testing.T) {
+	m := NewManager()
+	m.SetMaxTurnRate(90) // degrees per second
+	var anomalies []HeadingAnomaly
+	m.OnHeadingAnomaly(func(a HeadingAnomaly) { anomalies = append(anomalies, a) })
+
+	// 100 ms ticks: a steady turn through north, then a 180° flip in one tick.
+	for i, heading := range []float32{350, 354, 358, 2, 6, 186, 190} {
+		r := m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: int64(i) * 100, Heading: heading})
+		if r != Applied {
+			t.Fatalf("state %d: %v, want applied", i, r)
+		}
+	}
+	if len(anomalies) != 1 {
+		t.Fatalf("anomalies = %+v, want exactly the 180° jump", anomalies)
+	}
+	a := anomalies[0]
+	if a.VehicleID != "car-001" || a.Prev.Heading != 6 || a.Next.Heading != 186 {
+		t.Errorf("anomaly = %+v", a)
+	}
+	if a.Delta != 180 || a.Rate != 1800 {
+		t.Errorf("delta %v rate %v, want 180° at 1800°/s", a.Delta, a.Rate)
+	}
+}
+
+func TestHeadingAnomalyDisabledByDefault(t *testing.T) {
+	m := NewManager()
+	m.OnHeadingAnomaly(func(a HeadingAnomaly) { t.Errorf("unexpected anomaly %+v", a) })
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 0, Heading: 0})
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 100, Heading: 180})
+}
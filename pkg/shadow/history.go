@@ -0,0 +1,120 @@
+package shadow
+
+import (
+	"sort"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// history is a bounded, timestamp-ordered buffer of a vehicle's states.
+type history struct {
+	states []*protocol.VehicleState
+	// odometer is the path length in metres through every sample ever
+	// recorded. Eviction leaves it unchanged, so it keeps growing after the
+	// buffer wraps.
+	odometer float64
+}
+
+// segment returns the distance between two recorded samples, or zero when
+// either lacks a position fix, so a dropout to (0,0) does not add a jump to
+// the far side of the globe.
+func segment(a, b *protocol.VehicleState) float64 {
+	if !a.HasPosition() || !b.HasPosition() {
+		return 0
+	}
+	return distanceMeters(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+}
+
+// insert places state at its timestamp position, evicting the oldest sample
+// once the buffer holds limit states. A state older than everything in a full
+// buffer is discarded.
+func (h *history) insert(state *protocol.VehicleState, limit int) {
+	n := len(h.states)
+	if n == 0 || h.states[n-1].Timestamp <= state.Timestamp {
+		if n > 0 {
+			h.odometer += segment(h.states[n-1], state)
+		}
+		h.states = append(h.states, state)
+	} else {
+		i := sort.Search(n, func(i int) bool { return h.states[i].Timestamp > state.Timestamp })
+		if i == 0 && n >= limit {
+			return
+		}
+		// A backfilled sample splits the segment it falls into.
+		h.odometer += segment(state, h.states[i])
+		if i > 0 {
+			h.odometer += segment(h.states[i-1], state) - segment(h.states[i-1], h.states[i])
+		}
+		h.states = append(h.states, nil)
+		copy(h.states[i+1:], h.states[i:])
+		h.states[i] = state
+	}
+	if len(h.states) > limit {
+		h.states[0] = nil
+		h.states = h.states[1:]
+	}
+}
+
+// SetHistoryFilter thins history so that a parked vehicle does not fill it
+// with near-identical samples: a state newer than the last one recorded is
+// only added if it moved more than minDistance metres from it, or at least
+// minInterval has passed since it (by state timestamp). A zero value
+// disables that criterion; both zero, the default, records every state.
+// Backfilled out-of-order states are always recorded, and the current state
+// returned by Get is updated regardless.
+func (m *Manager) SetHistoryFilter(minDistance float64, minInterval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.minMove = minDistance
+	m.minGap = minInterval
+}
+
+// record adds state to the history of the vehicle keyed key when history is
+// enabled and the history filter keeps it. The caller must hold m.mu for
+// writing.
+func (m *Manager) record(key string, state *protocol.VehicleState) {
+	if m.historySize <= 0 {
+		return
+	}
+	h, ok := m.histories[key]
+	if !ok {
+		h = &history{}
+		m.histories[key] = h
+	}
+	if !m.keepSample(h, state) {
+		return
+	}
+	h.insert(state, m.historySize)
+}
+
+// keepSample applies the SetHistoryFilter criteria. The caller must hold m.mu.
+func (m *Manager) keepSample(h *history, state *protocol.VehicleState) bool {
+	if m.minMove <= 0 && m.minGap <= 0 {
+		return true
+	}
+	n := len(h.states)
+	if n == 0 || state.Timestamp < h.states[n-1].Timestamp {
+		return true
+	}
+	last := h.states[n-1]
+	if m.minMove > 0 && distanceMeters(last.Latitude, last.Longitude, state.Latitude, state.Longitude) > m.minMove {
+		return true
+	}
+	return m.minGap > 0 && time.Duration(state.Timestamp-last.Timestamp)*time.Millisecond >= m.minGap
+}
+
+// History returns the retained states of vehicleID ordered oldest to newest,
+// or (nil, false) if the vehicle is unknown or history is disabled.
+func (m *Manager) History(vehicleID string) ([]*protocol.VehicleState, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	h, ok := m.histories[m.canon(vehicleID)]
+	if !ok {
+		return nil, false
+	}
+	out := make([]*protocol.VehicleState, len(h.states))
+	copy(out, h.states)
+	return out, true
+}
@@ -0,0 +1,212 @@
+package shadow
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func historyTimestamps(t *testing.T, m *Manager, id string) []int64 {
+	t.Helper()
+	states, ok := m.History(id)
+	if !ok {
+		t.Fatalf("no history for %s", id)
+	}
+	ts := make([]int64, len(states))
+	for i, s := range states {
+		ts[i] = s.Timestamp
+	}
+	return ts
+}
+
+func TestHistoryBackfillKeepsCurrentState(t *testing.T) {
+	m := NewManagerWithHistory(10)
+	now := time.Now().UnixMilli()
+
+	m.Update(makeState("car-001", now+100))
+	m.Update(makeState("car-001", now+500))
+	// Replayed offline states arrive late and out of order.
+	m.Update(makeState("car-001", now+300))
+	m.Update(makeState("car-001", now+200))
+	m.Update(makeState("car-001", now+400))
+
+	entry, _ := m.Get("car-001")
+	if entry.State.Timestamp != now+500 {
+		t.Errorf("current Timestamp = %d, want %d", entry.State.Timestamp, now+500)
+	}
+
+	got := historyTimestamps(t, m, "car-001")
+	want := []int64{now + 100, now + 200, now + 300, now + 400, now + 500}
+	if len(got) != len(want) {
+		t.Fatalf("history = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("history[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHistoryDisabledByDefault(t *testing.T) {
+	m := NewManager()
+	m.Update(makeState("car-001", time.Now().UnixMilli()))
+	if _, ok := m.History("car-001"); ok {
+		t.Error("History should be unavailable without NewManagerWithHistory")
+	}
+}
+
+func TestHistoryFilterSkipsStationarySamples(t *testing.T) {
+	m := NewManagerWithHistory(100)
+	m.SetHistoryFilter(5, time.Minute)
+	now := time.Now().UnixMilli()
+
+	at := func(ts int64, lat float64) {
+		s := makeState("car-001", ts)
+		s.Latitude, s.Longitude = lat, 116.4
+		m.Update(s)
+	}
+	// Parked: ten samples at 10 Hz within a metre of each other.
+	for i := int64(0); i < 10; i++ {
+		at(now+i*100, 39.9+float64(i%2)*0.000005)
+	}
+	if got := historyTimestamps(t, m, "car-001"); len(got) != 1 {
+		t.Fatalf("parked history = %v, want only the first sample", got)
+	}
+	if e, _ := m.Get("car-001"); e.State.Timestamp != now+900 {
+		t.Errorf("current Timestamp = %d, want %d", e.State.Timestamp, now+900)
+	}
+
+	// Moving: ~11 m between samples.
+	at(now+1000, 39.9001)
+	at(now+1100, 39.9002)
+	at(now+1200, 39.90021) // ~1 m, skipped
+	// Parked again, but long enough for the interval to record one sample.
+	at(now+61_200, 39.90021)
+
+	got := historyTimestamps(t, m, "car-001")
+	want := []int64{now, now + 1000, now + 1100, now + 61_200}
+	if len(got) != len(want) {
+		t.Fatalf("history = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("history[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHistoryEvictsOldestOnOverflow(t *testing.T) {
+	const limit = 4
+	m := NewManagerWithHistory(limit)
+	for ts := int64(1); ts <= 1000; ts++ {
+		m.Update(makeState("car-001", ts))
+	}
+
+	got := historyTimestamps(t, m, "car-001")
+	want := []int64{997, 998, 999, 1000}
+	if len(got) != len(want) {
+		t.Fatalf("history = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("history = %v, want %v newest last", got, want)
+			break
+		}
+	}
+	if c := cap(m.histories["car-001"].states); c > 4*limit {
+		t.Errorf("history capacity grew to %d for a limit of %d", c, limit)
+	}
+
+	// A replay older than everything in the full buffer is not recorded.
+	m.Update(makeState("car-001", 500))
+	if got := historyTimestamps(t, m, "car-001"); got[0] != 997 {
+		t.Errorf("history after old replay = %v, want it unchanged", got)
+	}
+	// A late state within the window is inserted in order, evicting the oldest.
+	m.Update(makeState("car-001", 998))
+	if got := historyTimestamps(t, m, "car-001"); got[0] != 998 || got[1] != 998 || got[3] != 1000 {
+		t.Errorf("history after late state = %v, want [998 998 999 1000]", got)
+	}
+
+	// Get keeps reporting the newest state, as without history.
+	if e, _ := m.Get("car-001"); e.State.Timestamp != 1000 {
+		t.Errorf("current Timestamp = %d, want 1000", e.State.Timestamp)
+	}
+}
+
+func TestHistoryReturnsCopy(t *testing.T) {
+	m := NewManagerWithHistory(3)
+	m.Update(makeState("car-001", 1))
+	m.Update(makeState("car-001", 2))
+	states, _ := m.History("car-001")
+	states[0] = nil
+	if got := historyTimestamps(t, m, "car-001"); len(got) != 2 || got[0] != 1 {
+		t.Errorf("modifying the returned slice changed the history: %v", got)
+	}
+}
+
+func TestDistanceTraveledAlongKnownPath(t *testing.T) {
+	// Four hops of 0.001° of longitude on the equator, ~111.2 m each, on a
+	// history of three samples so the ring evicts twice.
+	m := NewManagerWithHistory(3)
+	for i := range 5 {
+		m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: int64(1000 * (i + 1)), Longitude: 10 + 0.001*float64(i)})
+	}
+	e, _ := m.Get("car-001")
+	want := 4 * protocol.DistanceMeters(0, 0, 0, 0.001)
+	if got := e.DistanceTraveled(); math.Abs(got-want) > 0.01 {
+		t.Errorf("DistanceTraveled = %.2f m, want %.2f m", got, want)
+	}
+	if math.Abs(want-444.78) > 0.1 {
+		t.Errorf("four 0.001° hops = %.2f m, want ~444.78 m", want)
+	}
+}
+
+func TestDistanceTraveledWithBackfilledSample(t *testing.T) {
+	m := NewManagerWithHistory(10)
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000, Latitude: 0, Longitude: 10})
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 3000, Latitude: 0, Longitude: 10.002})
+	// A detour north, replayed late from the vehicle's offline buffer.
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 2000, Latitude: 0.001, Longitude: 10.001})
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 4000, Latitude: 0, Longitude: 10.003})
+
+	e, _ := m.Get("car-001")
+	want := protocol.DistanceMeters(0, 10, 0.001, 10.001) +
+		protocol.DistanceMeters(0.001, 10.001, 0, 10.002) +
+		protocol.DistanceMeters(0, 10.002, 0, 10.003)
+	if got := e.DistanceTraveled(); math.Abs(got-want) > 0.01 {
+		t.Errorf("DistanceTraveled = %.2f m, want %.2f m through the detour", got, want)
+	}
+}
+
+func TestDistanceTraveledSkipsSamplesWithoutFix(t *testing.T) {
+	m := NewManagerWithHistory(10)
+	for i, lon := range []float64{10, 0, 10.001} {
+		m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: int64(1000 * (i + 1)), Longitude: lon})
+	}
+	// A backfilled sample without a fix lands between two with one.
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 3500})
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 4000, Longitude: 10.002})
+
+	e, _ := m.Get("car-001")
+	if got := e.DistanceTraveled(); got != 0 {
+		t.Errorf("DistanceTraveled = %.2f m, want 0 with every segment touching a no-fix sample", got)
+	}
+}
+
+func TestDistanceTraveledZeroWithoutHistory(t *testing.T) {
+	m := NewManager()
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000})
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 2000, Latitude: 1})
+	if e, _ := m.Get("car-001"); e.DistanceTraveled() != 0 {
+		t.Errorf("DistanceTraveled without history = %v, want 0", e.DistanceTraveled())
+	}
+
+	h := NewManagerWithHistory(5)
+	h.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000, Latitude: 1})
+	if e, _ := h.Get("car-001"); e.DistanceTraveled() != 0 {
+		t.Errorf("DistanceTraveled after one sample = %v, want 0", e.DistanceTraveled())
+	}
+}
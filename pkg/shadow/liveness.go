@@ -0,0 +1,143 @@
+package shadow
+
+import (
+	"sort"
+	"time"
+)
+
+// Liveness grades how recently a vehicle reported. Entries start Online and
+// move through the later grades as time passes without a state; any state
+// brings them back to Online.
+type Liveness int
+
+const (
+	// LivenessOnline means the vehicle reported within the Degraded
+	// threshold.
+	LivenessOnline Liveness = iota
+	// LivenessDegraded means states are late, e.g. a weak link.
+	LivenessDegraded
+	// LivenessStale means the shadow can no longer be trusted for control
+	// decisions. Entries flagged by MarkStale are at least Stale.
+	LivenessStale
+	// LivenessOffline means the vehicle is presumed gone. Entries marked
+	// offline by SetOnline(false) are Offline at once.
+	LivenessOffline
+)
+
+func (l Liveness) String() string {
+	switch l {
+	case LivenessOnline:
+		return "online"
+	case LivenessDegraded:
+		return "degraded"
+	case LivenessStale:
+		return "stale"
+	case LivenessOffline:
+		return "offline"
+	}
+	return "unknown"
+}
+
+// LivenessThresholds are the times since a vehicle's last update after
+// which it becomes Degraded, Stale and Offline. A zero threshold skips that
+// grade.
+type LivenessThresholds struct {
+	Degraded time.Duration
+	Stale    time.Duration
+	Offline  time.Duration
+}
+
+// DefaultLivenessThresholds apply until SetLivenessThresholds is called.
+var DefaultLivenessThresholds = LivenessThresholds{
+	Degraded: 2 * time.Second,
+	Stale:    10 * time.Second,
+	Offline:  time.Minute,
+}
+
+// grade returns the liveness of e at now.
+func (t LivenessThresholds) grade(e *Entry, now time.Time) Liveness {
+	age := now.Sub(e.UpdatedAt)
+	switch {
+	case !e.Online, t.Offline > 0 && age >= t.Offline:
+		return LivenessOffline
+	case e.Stale, t.Stale > 0 && age >= t.Stale:
+		return LivenessStale
+	case t.Degraded > 0 && age >= t.Degraded:
+		return LivenessDegraded
+	}
+	return LivenessOnline
+}
+
+// LivenessChange is a vehicle's move from one liveness grade to another.
+type LivenessChange struct {
+	VehicleID string
+	From, To  Liveness
+}
+
+// LivenessListener observes liveness transitions.
+type LivenessListener func(LivenessChange)
+
+// SetLivenessThresholds replaces DefaultLivenessThresholds. The new
+// thresholds take effect at the next CheckLiveness.
+func (m *Manager) SetLivenessThresholds(t LivenessThresholds) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.liveness = t
+}
+
+// SetClock replaces the clock used for UpdatedAt, ActiveVehicles and
+// liveness, e.g. with a fake one in tests. A nil now restores time.Now.
+func (m *Manager) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now == nil {
+		now = time.Now
+	}
+	m.now = now
+}
+
+// OnLiveness registers fn to be called, after the manager's lock is
+// released, for every liveness transition: those found by CheckLiveness, a
+// vehicle going offline through SetOnline, and a late vehicle returning to
+// Online with its next state.
+func (m *Manager) OnLiveness(fn LivenessListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ls := make([]LivenessListener, len(m.lives), len(m.lives)+1)
+	copy(ls, m.lives)
+	m.lives = append(ls, fn)
+}
+
+// CheckLiveness regrades every entry against the current time, updates
+// Entry.Liveness and returns the transitions, sorted by vehicle ID, after
+// notifying OnLiveness listeners. Call it periodically, e.g. once a second.
+func (m *Manager) CheckLiveness() []LivenessChange {
+	m.mu.Lock()
+	now := m.now()
+	var changes []LivenessChange
+	for id, e := range m.shadows {
+		l := m.liveness.grade(e, now)
+		if l == e.Liveness {
+			continue
+		}
+		// Entries handed out by Get are never modified in place.
+		cp := *e
+		cp.Liveness = l
+		m.shadows[id] = &cp
+		changes = append(changes, LivenessChange{VehicleID: e.State.VehicleID, From: e.Liveness, To: l})
+	}
+	ls := m.lives
+	m.mu.Unlock()
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].VehicleID < changes[j].VehicleID })
+	notifyLiveness(ls, changes...)
+	return changes
+}
+
+func notifyLiveness(ls []LivenessListener, changes ...LivenessChange) {
+	for _, c := range changes {
+		for _, fn := range ls {
+			fn(c)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package shadow
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestLivenessTransitions(t *testing.T) {
+	m := NewManager()
+	now := time.Unix(1_700_000_000, 0)
+	m.SetClock(func() time.Time { return now })
+	m.SetLivenessThresholds(LivenessThresholds{Degraded: time.Second, Stale: 5 * time.Second, Offline: 30 * time.Second})
+
+	var seen []LivenessChange
+	m.OnLiveness(func(c LivenessChange) { seen = append(seen, c) })
+
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1})
+	if e, _ := m.Get("car-001"); e.Liveness != LivenessOnline {
+		t.Fatalf("new entry liveness = %v, want online", e.Liveness)
+	}
+
+	for _, step := range []struct {
+		advance time.Duration
+		want    Liveness
+	}{
+		{500 * time.Millisecond, LivenessOnline},
+		{time.Second, LivenessDegraded},
+		{4 * time.Second, LivenessStale},
+		{10 * time.Second, LivenessStale},
+		{20 * time.Second, LivenessOffline},
+	} {
+		now = now.Add(step.advance)
+		m.CheckLiveness()
+		if e, _ := m.Get("car-001"); e.Liveness != step.want {
+			t.Errorf("after %v: liveness = %v, want %v", now.Sub(time.Unix(1_700_000_000, 0)), e.Liveness, step.want)
+		}
+	}
+
+	// The next state brings the vehicle straight back.
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 2})
+	if e, _ := m.Get("car-001"); e.Liveness != LivenessOnline {
+		t.Errorf("liveness after update = %v, want online", e.Liveness)
+	}
+
+	want := []LivenessChange{
+		{"car-001", LivenessOnline, LivenessDegraded},
+		{"car-001", LivenessDegraded, LivenessStale},
+		{"car-001", LivenessStale, LivenessOffline},
+		{"car-001", LivenessOffline, LivenessOnline},
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("transitions = %v, want %v", seen, want)
+	}
+}
+
+func TestLivenessFollowsOnlineStatusAndMarkStale(t *testing.T) {
+	m := NewManager()
+	now := time.Unix(1_700_000_000, 0)
+	m.SetClock(func() time.Time { return now })
+	var seen []LivenessChange
+	m.OnLiveness(func(c LivenessChange) { seen = append(seen, c) })
+
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1})
+	m.Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: 1})
+	m.SetOnline("car-001", false)
+	m.MarkStale("car-002")
+	if changes := m.CheckLiveness(); !reflect.DeepEqual(changes, []LivenessChange{{"car-002", LivenessOnline, LivenessStale}}) {
+		t.Errorf("CheckLiveness = %v", changes)
+	}
+	want := []LivenessChange{
+		{"car-001", LivenessOnline, LivenessOffline},
+		{"car-002", LivenessOnline, LivenessStale},
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("transitions = %v, want %v", seen, want)
+	}
+	if got := LivenessDegraded.String(); got != "degraded" {
+		t.Errorf("String = %q", got)
+	}
+}
@@ -0,0 +1,81 @@
+package shadow
+
+import (
+	"math"
+	"sort"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// metresPerDegreeLat is the length of one degree of latitude, used to bound
+// the proximity sweep.
+const metresPerDegreeLat = protocol.EarthRadius * math.Pi / 180
+
+// distanceMeters is shorthand for protocol.DistanceMeters.
+var distanceMeters = protocol.DistanceMeters
+
+// Near returns the IDs, as sent by the vehicles, of vehicles whose last
+// known position is within radiusMeters of (lat, lon), sorted by ID. The
+// boundary is inclusive. Stale vehicles and vehicles without a valid
+// position are skipped.
+func (m *Manager) Near(lat, lon, radiusMeters float64) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]string, 0)
+	for _, e := range m.shadows {
+		if e.Stale || !e.State.HasPosition() {
+			continue
+		}
+		if distanceMeters(lat, lon, e.State.Latitude, e.State.Longitude) <= radiusMeters {
+			ids = append(ids, e.State.VehicleID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ProximityPairs returns every pair of vehicles whose last known positions
+// are within threshold metres of each other. Only online vehicles reporting
+// a position count: vehicles marked offline or stale, or whose Liveness has
+// decayed to Stale or worse, are ignored, as are vehicles without a fix,
+// which would otherwise all meet at (0, 0). Each pair is ordered by ID and
+// the result is sorted, so output is deterministic. Vehicles are indexed by
+// latitude and only neighbours inside the latitude band of the threshold are
+// compared, so the cost stays close to linear for a spread-out fleet.
+func (m *Manager) ProximityPairs(threshold float64) [][2]string {
+	type point struct {
+		id       string
+		lat, lon float64
+	}
+	m.mu.RLock()
+	pts := make([]point, 0, len(m.shadows))
+	for _, e := range m.shadows {
+		if e.Online && !e.Stale && e.Liveness < LivenessStale && e.State.HasPosition() {
+			pts = append(pts, point{e.State.VehicleID, e.State.Latitude, e.State.Longitude})
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(pts, func(i, j int) bool { return pts[i].lat < pts[j].lat })
+	band := threshold / metresPerDegreeLat
+	pairs := make([][2]string, 0)
+	for i := range pts {
+		for j := i + 1; j < len(pts) && pts[j].lat-pts[i].lat <= band; j++ {
+			if distanceMeters(pts[i].lat, pts[i].lon, pts[j].lat, pts[j].lon) > threshold {
+				continue
+			}
+			a, b := pts[i].id, pts[j].id
+			if b < a {
+				a, b = b, a
+			}
+			pairs = append(pairs, [2]string{a, b})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	return pairs
+}
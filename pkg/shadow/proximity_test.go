@@ -0,0 +1,103 @@
+package shadow
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestProximityPairs(t *testing.T) {
+	m := NewManager()
+	now := time.Now().UnixMilli()
+	for id, p := range map[string][2]float64{
+		"car-001": {39.90000, 116.40000},
+		"car-002": {39.90010, 116.40010}, // ~14 m from car-001
+		"car-003": {39.95000, 116.40000}, // ~5.5 km away
+		"car-004": {31.23000, 121.47000}, // another city
+	} {
+		m.Update(&protocol.VehicleState{VehicleID: id, Timestamp: now, Latitude: p[0], Longitude: p[1]})
+	}
+
+	got := m.ProximityPairs(50)
+	want := [][2]string{{"car-001", "car-002"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ProximityPairs(50) = %v, want %v", got, want)
+	}
+
+	m.MarkStale("car-002")
+	if got := m.ProximityPairs(50); len(got) != 0 {
+		t.Errorf("ProximityPairs with a stale vehicle = %v, want none", got)
+	}
+}
+
+func TestProximityPairsSkipsOfflineAndUnpositioned(t *testing.T) {
+	m := NewManager()
+	now := time.Now()
+	m.SetClock(func() time.Time { return now })
+	for id, p := range map[string][2]float64{
+		"car-001": {39.90000, 116.40000},
+		"car-002": {39.90010, 116.40010}, // ~14 m from car-001
+		"car-003": {0, 0},                // no fix
+		"car-004": {0, 0},                // no fix
+	} {
+		m.Update(&protocol.VehicleState{VehicleID: id, Timestamp: now.UnixMilli(), Latitude: p[0], Longitude: p[1]})
+	}
+	if got, want := m.ProximityPairs(50), [][2]string{{"car-001", "car-002"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ProximityPairs = %v, want %v without the vehicles lacking a fix", got, want)
+	}
+
+	m.SetOnline("car-002", false)
+	if got := m.ProximityPairs(50); len(got) != 0 {
+		t.Errorf("ProximityPairs with an offline vehicle = %v, want none", got)
+	}
+	m.SetOnline("car-002", true)
+	now = now.Add(DefaultLivenessThresholds.Stale + time.Second)
+	m.CheckLiveness()
+	if got := m.ProximityPairs(50); len(got) != 0 {
+		t.Errorf("ProximityPairs with inactive vehicles = %v, want none", got)
+	}
+}
+
+func TestNear(t *testing.T) {
+	m := NewManager()
+	now := time.Now().UnixMilli()
+	for id, p := range map[string][2]float64{
+		"car-001": {39.90000, 116.40000}, // the query point
+		"car-002": {39.90300, 116.40000}, // ~334 m north
+		"car-003": {39.90000, 116.40700}, // ~597 m east
+		"car-004": {31.23000, 121.47000}, // another city
+		"car-005": {0, 0},                // never reported a position
+	} {
+		m.Update(&protocol.VehicleState{VehicleID: id, Timestamp: now, Latitude: p[0], Longitude: p[1]})
+	}
+
+	if got, want := m.Near(39.9, 116.4, 500), []string{"car-001", "car-002"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Near(500) = %v, want %v", got, want)
+	}
+	if got, want := m.Near(39.9, 116.4, 1000), []string{"car-001", "car-002", "car-003"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Near(1000) = %v, want %v", got, want)
+	}
+	if got := m.Near(0, 0, 1000); len(got) != 0 {
+		t.Errorf("Near(0, 0) = %v, want the unpositioned vehicle skipped", got)
+	}
+
+	m.MarkStale("car-002")
+	if got, want := m.Near(39.9, 116.4, 500), []string{"car-001"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Near(500) with a stale vehicle = %v, want %v", got, want)
+	}
+}
+
+func TestNearRadiusBoundary(t *testing.T) {
+	m := NewManager()
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli(), Latitude: 39.9030, Longitude: 116.4000})
+
+	d := protocol.DistanceMeters(39.9, 116.4, 39.903, 116.4)
+	if got := m.Near(39.9, 116.4, d); len(got) != 1 {
+		t.Errorf("Near at exactly %.3f m = %v, want the vehicle included", d, got)
+	}
+	if got := m.Near(39.9, 116.4, d-0.01); len(got) != 0 {
+		t.Errorf("Near just inside %.3f m = %v, want none", d, got)
+	}
+}
@@ -0,0 +1,103 @@
+package shadow
+
+import (
+	"math"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// UpdateResult reports what Update did with a state.
+type UpdateResult int
+
+const (
+	// Applied means the state replaced the vehicle's current shadow.
+	Applied UpdateResult = iota
+	// DroppedStale means the state was older than the current shadow. It is
+	// still backfilled into the history when history is enabled.
+	DroppedStale
+	// DroppedInvalid means the state had no vehicle ID or an impossible
+	// position.
+	DroppedInvalid
+	// DroppedImplausible means reaching the new position from the current
+	// one would exceed the manager's maximum plausible speed.
+	DroppedImplausible
+)
+
+func (r UpdateResult) String() string {
+	switch r {
+	case Applied:
+		return "applied"
+	case DroppedStale:
+		return "dropped_stale"
+	case DroppedInvalid:
+		return "dropped_invalid"
+	case DroppedImplausible:
+		return "dropped_implausible"
+	}
+	return "unknown"
+}
+
+// DropListener is called for every state Update does not apply.
+type DropListener func(state *protocol.VehicleState, result UpdateResult)
+
+// OnDrop registers fn to be called, after the manager's lock is released,
+// whenever Update drops a state.
+func (m *Manager) OnDrop(fn DropListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ls := make([]DropListener, len(m.drops), len(m.drops)+1)
+	copy(ls, m.drops)
+	m.drops = append(ls, fn)
+}
+
+// SetMaxPlausibleSpeed makes Update drop a state whose position could only
+// be reached from the current shadow's at more than mps metres per second,
+// e.g. a GNSS glitch. Zero, the default, disables the check. Because the
+// speed is measured against the last applied state, a vehicle that really
+// did move (say, on a transporter) is accepted again once enough time has
+// passed.
+func (m *Manager) SetMaxPlausibleSpeed(mps float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxSpeed = mps
+}
+
+func invalid(state *protocol.VehicleState) bool {
+	if state == nil || state.VehicleID == "" {
+		return true
+	}
+	lat, lon := state.Latitude, state.Longitude
+	return math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180
+}
+
+// implausible reports whether moving from prev to next exceeds maxSpeed.
+// A prev at exactly (0, 0) is treated as having no position fix.
+func implausible(prev, next *protocol.VehicleState, maxSpeed float64) bool {
+	if maxSpeed <= 0 || (prev.Latitude == 0 && prev.Longitude == 0) {
+		return false
+	}
+	dt := float64(next.Timestamp-prev.Timestamp) / 1000
+	if dt < 0.001 {
+		dt = 0.001
+	}
+	return distanceMeters(prev.Latitude, prev.Longitude, next.Latitude, next.Longitude)/dt > maxSpeed
+}
+
+// notifyDrop logs a dropped state and reports it to ls. Stale states are
+// logged at debug level only, since QoS 1 redelivery makes them routine.
+func notifyDrop(ls []DropListener, log logging.Logger, state *protocol.VehicleState, result UpdateResult) UpdateResult {
+	id := ""
+	if state != nil {
+		id = state.VehicleID
+	}
+	if result == DroppedStale {
+		log.Debug("shadow dropped state", "vehicle_id", id, "result", result)
+	} else {
+		log.Warn("shadow dropped state", "vehicle_id", id, "result", result)
+	}
+	for _, fn := range ls {
+		fn(state, result)
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package shadow
+
+import (
+	"math"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestUpdateResults(t *testing.T) {
+	m := NewManager()
+	m.SetMaxPlausibleSpeed(100) // m/s
+	var dropped []UpdateResult
+	m.OnDrop(func(_ *protocol.VehicleState, r UpdateResult) { dropped = append(dropped, r) })
+
+	at := func(ts int64, lat, lon float64) *protocol.VehicleState {
+		return &protocol.VehicleState{VehicleID: "car-001", Timestamp: ts, Latitude: lat, Longitude: lon}
+	}
+	tests := []struct {
+		name  string
+		state *protocol.VehicleState
+		want  UpdateResult
+	}{
+		{"fresh", at(1000, 39.9000, 116.4000), Applied},
+		{"next tick", at(1100, 39.90005, 116.4000), Applied}, // ~5.6 m in 100 ms
+		{"stale", at(1050, 39.9000, 116.4000), DroppedStale},
+		{"teleport", at(1200, 31.2304, 121.4737), DroppedImplausible},
+		{"no vehicle ID", &protocol.VehicleState{Timestamp: 1300}, DroppedInvalid},
+		{"latitude out of range", at(1300, 95, 116.4), DroppedInvalid},
+		{"NaN longitude", at(1300, 39.9, math.NaN()), DroppedInvalid},
+		{"nil", nil, DroppedInvalid},
+	}
+	for _, tt := range tests {
+		if got := m.Update(tt.state); got != tt.want {
+			t.Errorf("%s: Update = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if e, _ := m.Get("car-001"); e.State.Timestamp != 1100 {
+		t.Errorf("shadow timestamp = %d, want 1100 from the last applied state", e.State.Timestamp)
+	}
+	if len(dropped) != 6 {
+		t.Errorf("drop listener called %d times, want 6", len(dropped))
+	}
+}
+
+func TestImplausibleJumpLeavesShadowUnchanged(t *testing.T) {
+	m := NewManager()
+	m.SetMaxPlausibleSpeed(70) // m/s
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000, Latitude: 39.9, Longitude: 116.4})
+	before, _ := m.Get("car-001")
+
+	// Beijing to Shanghai in a second.
+	jump := &protocol.VehicleState{VehicleID: "car-001", Timestamp: 2000, Latitude: 31.2, Longitude: 121.5}
+	if got := m.Update(jump); got != DroppedImplausible {
+		t.Fatalf("Update = %v, want %v", got, DroppedImplausible)
+	}
+	after, _ := m.Get("car-001")
+	if after.Version != before.Version || after.State.Latitude != 39.9 || after.State.Timestamp != 1000 {
+		t.Errorf("shadow = %+v (version %d), want it unchanged", after.State, after.Version)
+	}
+}
+
+func TestImplausibleCheckDisabledByDefault(t *testing.T) {
+	m := NewManager()
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000, Latitude: 39.9, Longitude: 116.4})
+	if got := m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1100, Latitude: 31.2, Longitude: 121.5}); got != Applied {
+		t.Errorf("Update = %v, want %v without a speed limit", got, Applied)
+	}
+}
+
+func TestDropsAreLogged(t *testing.T) {
+	var rec logging.Recorder
+	m := NewManager()
+	m.SetLogger(&rec)
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 2000})
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000})
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 3000, Latitude: 95})
+
+	entries := rec.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("logged %+v, want two drops", entries)
+	}
+	if entries[0].Level != logging.LevelDebug || entries[0].Fields["result"] != DroppedStale {
+		t.Errorf("stale drop logged as %+v, want debug", entries[0])
+	}
+	if entries[1].Level != logging.LevelWarn || entries[1].Fields["result"] != DroppedInvalid {
+		t.Errorf("invalid drop logged as %+v, want warn", entries[1])
+	}
+}
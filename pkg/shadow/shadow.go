@@ -5,9 +5,12 @@
 package shadow
 
 import (
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/daohu527/vlink/pkg/logging"
 	"github.com/daohu527/vlink/pkg/protocol"
 )
 
@@ -15,37 +18,356 @@ import (
 type Entry struct {
 	State     *protocol.VehicleState
 	UpdatedAt time.Time
+	// Version is incremented on every applied write, starting at 1 for the
+	// first state stored for a vehicle. It enables optimistic concurrency
+	// through CompareAndUpdate.
+	Version uint64
+	// Stale is set by MarkStale when the state is known to be outdated and
+	// cleared by the next write.
+	Stale bool
+	// Online is set by every write and by SetOnline(true), and cleared by
+	// SetOnline(false), e.g. when the vehicle's MQTT last will reports it
+	// offline.
+	Online bool
+	// Paused is set by SetPaused while the vehicle reports it has paused
+	// its periodic state publication, so that its silence is expected. It
+	// is kept across writes, e.g. a state requested from a paused vehicle.
+	Paused bool
+	// Backfill is set when the state was written by UpdateBackfill, i.e.
+	// replayed (a retained message delivered on reconnect, or a vehicle's
+	// offline buffer) rather than received live, and cleared by the next
+	// Update.
+	Backfill bool
+	// Liveness grades how recently the vehicle reported. Every write resets
+	// it to LivenessOnline; CheckLiveness advances it as the entry ages.
+	Liveness Liveness
+	// ReceivedAt is when the control center received the state: the time
+	// given to UpdateReceived, otherwise the time of the write. Skew is
+	// ReceivedAt minus the state's Timestamp, i.e. the vehicle's clock
+	// offset plus the transit delay; it is negative when the vehicle's
+	// clock runs ahead. ClockSkewed is set while the magnitude of Skew
+	// exceeds the threshold of SetMaxClockSkew. A vehicle's timestamps
+	// still decide which of its states is newest; skew is only measured.
+	// Backfilled entries keep the Skew of the entry they replace, since
+	// replayed states are old by design.
+	ReceivedAt  time.Time
+	Skew        time.Duration
+	ClockSkewed bool
+
+	distance float64 // see DistanceTraveled
+}
+
+// DistanceTraveled returns the vehicle's cumulative path length in metres
+// through every state recorded in its history up to this entry's write,
+// including samples since evicted from the history buffer. It is zero when
+// history is disabled or holds fewer than two samples. States skipped by
+// the history filter (see SetHistoryFilter) are not part of the path.
+func (e *Entry) DistanceTraveled() float64 {
+	return e.distance
 }
 
 // Manager stores and queries vehicle shadow state.
 type Manager struct {
-	mu      sync.RWMutex
-	shadows map[string]*Entry
+	mu          sync.RWMutex
+	shadows     map[string]*Entry
+	historySize int
+	histories   map[string]*history
+	canonical   func(string) string
+	listeners   []UpdateListener
+	removals    []RemoveListener
+	drops       []DropListener
+	turns       []HeadingAnomalyListener
+	lives       []LivenessListener
+	now         func() time.Time // see SetClock
+	log         logging.Logger   // see SetLogger
+	liveness    LivenessThresholds
+	maxSpeed    float64       // see SetMaxPlausibleSpeed
+	maxTurnRate float64       // see SetMaxTurnRate
+	minMove     float64       // see SetHistoryFilter
+	minGap      time.Duration // see SetHistoryFilter
+	maxSkew     time.Duration // see SetMaxClockSkew
 }
 
-// NewManager creates an empty shadow Manager.
+// NewManager creates an empty shadow Manager. Vehicle IDs are canonicalised
+// with CanonicalID; see SetCanonicalizer.
 func NewManager() *Manager {
 	return &Manager{
-		shadows: make(map[string]*Entry),
+		shadows:   make(map[string]*Entry),
+		histories: make(map[string]*history),
+		canonical: CanonicalID,
+		now:       time.Now,
+		log:       logging.Default(),
+		liveness:  DefaultLivenessThresholds,
 	}
 }
 
-// Update stores (or replaces) the shadow for the vehicle identified by state.VehicleID.
-// Out-of-order updates (older timestamp than the stored one) are silently dropped.
-func (m *Manager) Update(state *protocol.VehicleState) {
+// SetLogger replaces the logger the Manager reports dropped states to
+// (logging.Default unless set). A nil l discards them.
+func (m *Manager) SetLogger(l logging.Logger) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if l == nil {
+		l = logging.Discard
+	}
+	m.log = l
+}
 
-	existing, ok := m.shadows[state.VehicleID]
-	if ok && existing.State.Timestamp > state.Timestamp {
-		// Drop stale update.
+// CanonicalID is the default vehicle ID canonicalisation: surrounding
+// whitespace is trimmed and the ID is lower-cased, so "Car-001 " and
+// "car-001" address the same shadow. The canonical form only keys the
+// shadow; stored states keep the VehicleID the vehicle sent, which is the
+// one its topics are built from.
+func CanonicalID(id string) string {
+	return strings.ToLower(strings.TrimSpace(id))
+}
+
+// SetCanonicalizer replaces the function used to map inbound vehicle IDs onto
+// shadow keys. It applies to Update, CompareAndUpdate, Get, History and
+// Remove. A nil fn uses IDs verbatim.
+func (m *Manager) SetCanonicalizer(fn func(string) string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.canonical = fn
+}
+
+// canon maps id onto its shadow key. The caller must hold m.mu.
+func (m *Manager) canon(id string) string {
+	if m.canonical == nil {
+		return id
+	}
+	return m.canonical(id)
+}
+
+// NewManagerWithHistory creates a Manager that additionally retains the last
+// n states of every vehicle, ordered by timestamp. See History.
+func NewManagerWithHistory(n int) *Manager {
+	m := NewManager()
+	m.historySize = n
+	return m
+}
+
+// UpdateListener observes a successful shadow write. prev is the state that
+// was replaced, or nil for a vehicle's first update.
+type UpdateListener func(prev, next *protocol.VehicleState)
+
+// OnUpdate registers fn to be called after every write that changes a
+// vehicle's current state (stale and rejected updates are not reported).
+// Listeners run in registration order on the goroutine that performed the
+// write, after the manager's lock is released, so they may safely call back
+// into the Manager.
+func (m *Manager) OnUpdate(fn UpdateListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Copy on write: Update iterates the old slice without holding the lock.
+	ls := make([]UpdateListener, len(m.listeners), len(m.listeners)+1)
+	copy(ls, m.listeners)
+	m.listeners = append(ls, fn)
+}
+
+func notify(ls []UpdateListener, prev *Entry, next *protocol.VehicleState) {
+	if len(ls) == 0 {
 		return
 	}
+	var prevState *protocol.VehicleState
+	if prev != nil {
+		prevState = prev.State
+	}
+	for _, fn := range ls {
+		fn(prevState, next)
+	}
+}
+
+// Update stores (or replaces) the shadow for the vehicle identified by
+// state.VehicleID and reports the outcome; callers that do not care may
+// ignore it. Out-of-order updates (older timestamp than the stored one) never
+// replace the current state; when history is enabled they are backfilled
+// into it at their timestamp position instead, so replayed offline buffers
+// are not lost. Invalid and implausible states (see SetMaxPlausibleSpeed) are
+// dropped outright. Every drop is reported to OnDrop listeners.
+func (m *Manager) Update(state *protocol.VehicleState) UpdateResult {
+	return m.update(state, false, time.Time{})
+}
+
+// UpdateBackfill is Update for a state replayed by the broker rather than
+// received live; the resulting entry is marked Backfill.
+func (m *Manager) UpdateBackfill(state *protocol.VehicleState) UpdateResult {
+	return m.update(state, true, time.Time{})
+}
+
+// update applies state; a zero receivedAt means it was received now.
+func (m *Manager) update(state *protocol.VehicleState, backfill bool, receivedAt time.Time) UpdateResult {
+	m.mu.Lock()
+	drops, log := m.drops, m.log
+
+	if invalid(state) {
+		m.mu.Unlock()
+		return notifyDrop(drops, log, state, DroppedInvalid)
+	}
+	key := m.canon(state.VehicleID)
+	existing, ok := m.shadows[key]
+	if ok && existing.State.Timestamp <= state.Timestamp && implausible(existing.State, state, m.maxSpeed) {
+		m.mu.Unlock()
+		return notifyDrop(drops, log, state, DroppedImplausible)
+	}
+	m.record(key, state)
+
+	if ok && existing.State.Timestamp > state.Timestamp {
+		m.mu.Unlock()
+		return notifyDrop(drops, log, state, DroppedStale)
+	}
+
+	// The entry is not yet visible to readers, so it may be modified here.
+	e := m.store(key, existing, state)
+	e.Backfill = backfill
+	if receivedAt.IsZero() {
+		receivedAt = e.UpdatedAt
+	}
+	skew := m.measureSkew(e, existing, receivedAt)
+	ls, turns, lives := m.listeners, m.turns, m.lives
+	var prev *protocol.VehicleState
+	if ok {
+		prev = existing.State
+	}
+	anomaly, turned := headingAnomaly(prev, state, m.maxTurnRate)
+	m.mu.Unlock()
+
+	logSkew(log, e, skew)
+	notify(ls, existing, state)
+	notifyLiveness(lives, revived(existing)...)
+	if turned {
+		for _, fn := range turns {
+			fn(anomaly)
+		}
+	}
+	return Applied
+}
+
+// CompareAndUpdate stores state only if the vehicle's current shadow version
+// equals expectedVersion (zero meaning "no entry yet"). It reports whether the
+// write was applied together with the version now held by the shadow.
+// Because the version already guards against concurrent writers, the
+// out-of-order timestamp check performed by Update is not applied. A state
+// whose VehicleID is not vehicleID, after canonicalisation, is never
+// stored, so one vehicle's shadow cannot be overwritten with another's.
+func (m *Manager) CompareAndUpdate(vehicleID string, expectedVersion uint64, state *protocol.VehicleState) (bool, uint64) {
+	m.mu.Lock()
+
+	vehicleID = m.canon(vehicleID)
+	existing := m.shadows[vehicleID]
+	var current uint64
+	if existing != nil {
+		current = existing.Version
+	}
+	if current != expectedVersion || m.canon(state.VehicleID) != vehicleID {
+		m.mu.Unlock()
+		return false, current
+	}
+	e := m.store(vehicleID, existing, state)
+	skew := m.measureSkew(e, existing, e.UpdatedAt)
+	ls, lives, log := m.listeners, m.lives, m.log
+	m.mu.Unlock()
 
-	m.shadows[state.VehicleID] = &Entry{
+	logSkew(log, e, skew)
+	notify(ls, existing, state)
+	notifyLiveness(lives, revived(existing)...)
+	return true, e.Version
+}
+
+// revived returns the transition back to Online of a write replacing prev.
+func revived(prev *Entry) []LivenessChange {
+	if prev == nil || prev.Liveness == LivenessOnline {
+		return nil
+	}
+	return []LivenessChange{{VehicleID: prev.State.VehicleID, From: prev.Liveness, To: LivenessOnline}}
+}
+
+// store replaces the shadow for vehicleID, bumping the version of prev
+// and keeping its Paused flag.
+// The caller must hold m.mu for writing.
+func (m *Manager) store(vehicleID string, prev *Entry, state *protocol.VehicleState) *Entry {
+	e := &Entry{
 		State:     state,
-		UpdatedAt: time.Now(),
+		UpdatedAt: m.now(),
+		Version:   1,
+		Online:    true,
+	}
+	if prev != nil {
+		e.Version = prev.Version + 1
+		e.Paused = prev.Paused
+	}
+	if h, ok := m.histories[vehicleID]; ok {
+		e.distance = h.odometer
+	}
+	m.shadows[vehicleID] = e
+	return e
+}
+
+// MarkStale flags the current shadow of vehicleID as outdated until its next
+// update, e.g. when an operator knows the displayed position is wrong. Stale
+// vehicles are excluded from ActiveVehicles. It reports whether an entry
+// existed.
+func (m *Manager) MarkStale(vehicleID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	vehicleID = m.canon(vehicleID)
+	e, ok := m.shadows[vehicleID]
+	if !ok {
+		return false
+	}
+	// Entries handed out by Get are never modified in place.
+	stale := *e
+	stale.Stale = true
+	m.shadows[vehicleID] = &stale
+	return true
+}
+
+// SetPaused records whether vehicleID has paused its periodic state
+// publication. It reports whether an entry existed, like SetOnline.
+func (m *Manager) SetPaused(vehicleID string, paused bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	vehicleID = m.canon(vehicleID)
+	e, ok := m.shadows[vehicleID]
+	if !ok {
+		return false
+	}
+	if e.Paused != paused {
+		// Entries handed out by Get are never modified in place.
+		cp := *e
+		cp.Paused = paused
+		m.shadows[vehicleID] = &cp
+	}
+	return true
+}
+
+// SetOnline records whether vehicleID is connected. Offline vehicles are
+// excluded from ActiveVehicles until their next update or SetOnline(true),
+// and their liveness becomes LivenessOffline at once. It reports whether an
+// entry existed; a status for an unknown vehicle is ignored, as its first
+// state will mark it online.
+func (m *Manager) SetOnline(vehicleID string, online bool) bool {
+	m.mu.Lock()
+	vehicleID = m.canon(vehicleID)
+	e, ok := m.shadows[vehicleID]
+	if !ok {
+		m.mu.Unlock()
+		return false
+	}
+	var changes []LivenessChange
+	if e.Online != online {
+		cp := *e
+		cp.Online = online
+		if !online && e.Liveness != LivenessOffline {
+			cp.Liveness = LivenessOffline
+			changes = append(changes, LivenessChange{VehicleID: e.State.VehicleID, From: e.Liveness, To: LivenessOffline})
+		}
+		m.shadows[vehicleID] = &cp
 	}
+	ls := m.lives
+	m.mu.Unlock()
+
+	notifyLiveness(ls, changes...)
+	return true
 }
 
 // Get returns the shadow entry for vehicleID, or (nil, false) if not found.
@@ -53,11 +375,13 @@ func (m *Manager) Get(vehicleID string) (*Entry, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	e, ok := m.shadows[vehicleID]
+	e, ok := m.shadows[m.canon(vehicleID)]
 	return e, ok
 }
 
-// All returns a snapshot of all current shadow entries keyed by vehicle ID.
+// All returns a snapshot of all current shadow entries keyed by canonical
+// vehicle ID. Address a vehicle by its Entry.State.VehicleID, the ID it
+// sent, rather than by the key.
 func (m *Manager) All() map[string]*Entry {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -69,24 +393,70 @@ func (m *Manager) All() map[string]*Entry {
 	return result
 }
 
-// ActiveVehicles returns IDs of vehicles whose last update is within maxAge.
+// ActiveVehicles returns the IDs, as sent by the vehicles, of vehicles whose
+// last update is within maxAge and that are online and have not been marked
+// stale.
 func (m *Manager) ActiveVehicles(maxAge time.Duration) []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	cutoff := time.Now().Add(-maxAge)
+	cutoff := m.now().Add(-maxAge)
 	ids := make([]string, 0)
-	for id, e := range m.shadows {
-		if e.UpdatedAt.After(cutoff) {
-			ids = append(ids, id)
+	for _, e := range m.shadows {
+		if e.UpdatedAt.After(cutoff) && !e.Stale && e.Online {
+			ids = append(ids, e.State.VehicleID)
 		}
 	}
 	return ids
 }
 
+// Filter returns the entries for which pred reports true, sorted by vehicle
+// ID. pred runs under the manager's read lock, so it must not call back into
+// the Manager; the entries it sees must be treated as read-only.
+func (m *Manager) Filter(pred func(*Entry) bool) []*Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matched := make([]*Entry, 0)
+	for _, e := range m.shadows {
+		if pred(e) {
+			matched = append(matched, e)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].State.VehicleID < matched[j].State.VehicleID
+	})
+	return matched
+}
+
+// RemoveListener is called after a vehicle's shadow is removed, with the
+// canonical vehicle ID and the last state the shadow held.
+type RemoveListener func(vehicleID string, last *protocol.VehicleState)
+
+// OnRemove registers fn to be called after Remove deletes an existing entry.
+// Like OnUpdate listeners, it runs after the manager's lock is released.
+func (m *Manager) OnRemove(fn RemoveListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ls := make([]RemoveListener, len(m.removals), len(m.removals)+1)
+	copy(ls, m.removals)
+	m.removals = append(ls, fn)
+}
+
 // Remove deletes the shadow entry for vehicleID.
 func (m *Manager) Remove(vehicleID string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	vehicleID = m.canon(vehicleID)
+	e, ok := m.shadows[vehicleID]
 	delete(m.shadows, vehicleID)
+	delete(m.histories, vehicleID)
+	ls := m.removals
+	m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	for _, fn := range ls {
+		fn(vehicleID, e.State)
+	}
 }
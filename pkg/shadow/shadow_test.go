@@ -1,6 +1,7 @@
 package shadow
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
@@ -94,6 +95,35 @@ func TestActiveVehicles(t *testing.T) {
 	}
 }
 
+func TestFilterCompoundPredicate(t *testing.T) {
+	m := NewManager()
+	now := time.Now().UnixMilli()
+	for _, s := range []*protocol.VehicleState{
+		{VehicleID: "car-001", Timestamp: now, Mode: "autonomous", BatteryPct: 15, Speed: 12},
+		{VehicleID: "car-002", Timestamp: now, Mode: "autonomous", BatteryPct: 15, Speed: 5},
+		{VehicleID: "car-003", Timestamp: now, Mode: "manual", BatteryPct: 10, Speed: 14},
+		{VehicleID: "car-004", Timestamp: now, Mode: "autonomous", BatteryPct: 80, Speed: 20},
+		{VehicleID: "car-005", Timestamp: now, Mode: "autonomous", BatteryPct: 19.5, Speed: 10.5},
+	} {
+		m.Update(s)
+	}
+
+	got := m.Filter(func(e *Entry) bool {
+		return e.State.Mode == "autonomous" && e.State.BatteryPct < 20 && e.State.Speed > 10
+	})
+	var ids []string
+	for _, e := range got {
+		ids = append(ids, e.State.VehicleID)
+	}
+	if len(ids) != 2 || ids[0] != "car-001" || ids[1] != "car-005" {
+		t.Errorf("Filter = %v, want [car-001 car-005]", ids)
+	}
+
+	if none := m.Filter(func(*Entry) bool { return false }); len(none) != 0 {
+		t.Errorf("Filter with false predicate returned %d entries", len(none))
+	}
+}
+
 func TestRemove(t *testing.T) {
 	m := NewManager()
 	m.Update(makeState("car-001", time.Now().UnixMilli()))
@@ -103,3 +133,303 @@ func TestRemove(t *testing.T) {
 		t.Error("entry should have been removed")
 	}
 }
+
+func TestOnRemoveReportsLastState(t *testing.T) {
+	m := NewManager()
+	var removed []string
+	m.OnRemove(func(id string, last *protocol.VehicleState) {
+		if last == nil || last.VehicleID != id {
+			t.Errorf("last state = %+v for %s", last, id)
+		}
+		removed = append(removed, id)
+	})
+
+	m.Update(makeState("car-001", time.Now().UnixMilli()))
+	m.Remove("CAR-001")
+	m.Remove("car-404")
+
+	if len(removed) != 1 || removed[0] != "car-001" {
+		t.Errorf("removed = %v, want [car-001]", removed)
+	}
+}
+
+func TestCompareAndUpdateSucceeds(t *testing.T) {
+	m := NewManager()
+	now := time.Now().UnixMilli()
+
+	ok, ver := m.CompareAndUpdate("car-001", 0, makeState("car-001", now))
+	if !ok || ver != 1 {
+		t.Fatalf("CompareAndUpdate on empty = (%v, %d), want (true, 1)", ok, ver)
+	}
+
+	next := makeState("car-001", now+100)
+	next.Mode = "manual"
+	ok, ver = m.CompareAndUpdate("car-001", 1, next)
+	if !ok || ver != 2 {
+		t.Fatalf("CompareAndUpdate = (%v, %d), want (true, 2)", ok, ver)
+	}
+
+	entry, _ := m.Get("car-001")
+	if entry.State.Mode != "manual" || entry.Version != 2 {
+		t.Errorf("entry = {Mode:%q Version:%d}, want {manual 2}", entry.State.Mode, entry.Version)
+	}
+}
+
+func TestCompareAndUpdateFailsAfterConcurrentUpdate(t *testing.T) {
+	m := NewManager()
+	now := time.Now().UnixMilli()
+	m.Update(makeState("car-001", now))
+
+	entry, _ := m.Get("car-001")
+	seen := entry.Version
+
+	// Another writer gets in first.
+	m.Update(makeState("car-001", now+100))
+
+	flagged := makeState("car-001", now+200)
+	flagged.Emergency = true
+	ok, ver := m.CompareAndUpdate("car-001", seen, flagged)
+	if ok {
+		t.Fatal("CompareAndUpdate applied despite a version mismatch")
+	}
+	if ver != seen+1 {
+		t.Errorf("current version = %d, want %d", ver, seen+1)
+	}
+	entry, _ = m.Get("car-001")
+	if entry.State.Emergency {
+		t.Error("rejected state should not have been stored")
+	}
+}
+
+func TestCompareAndUpdateRejectsAnotherVehiclesState(t *testing.T) {
+	m := NewManager()
+	now := time.Now().UnixMilli()
+	m.Update(makeState("car-001", now))
+
+	if ok, ver := m.CompareAndUpdate("car-001", 1, makeState("car-002", now+100)); ok || ver != 1 {
+		t.Errorf("CompareAndUpdate with car-002's state = (%v, %d), want (false, 1)", ok, ver)
+	}
+	if entry, _ := m.Get("car-001"); entry.State.VehicleID != "car-001" {
+		t.Errorf("car-001 holds %q's state", entry.State.VehicleID)
+	}
+	if ok, ver := m.CompareAndUpdate("car-001", 1, makeState(" CAR-001", now+200)); !ok || ver != 2 {
+		t.Errorf("CompareAndUpdate with an aliased ID = (%v, %d), want (true, 2)", ok, ver)
+	}
+}
+
+func TestUpdateMergesAliasedIDs(t *testing.T) {
+	m := NewManager()
+	now := time.Now().UnixMilli()
+
+	m.Update(makeState("Car-001", now))
+	m.Update(makeState(" car-001 ", now+100))
+
+	all := m.All()
+	if len(all) != 1 {
+		t.Fatalf("len(All) = %d, want 1 merged entry: %v", len(all), all)
+	}
+	entry, ok := m.Get("CAR-001")
+	if !ok {
+		t.Fatal("aliased lookup failed")
+	}
+	// The state keeps the ID as sent, which its topics are built from.
+	if entry.State.VehicleID != " car-001 " || entry.State.Timestamp != now+100 {
+		t.Errorf("entry = {%q %d}, want {%q %d}", entry.State.VehicleID, entry.State.Timestamp, " car-001 ", now+100)
+	}
+	if entry.Version != 2 {
+		t.Errorf("Version = %d, want 2", entry.Version)
+	}
+}
+
+func TestSetCanonicalizerOverride(t *testing.T) {
+	m := NewManager()
+	m.SetCanonicalizer(nil)
+	now := time.Now().UnixMilli()
+
+	m.Update(makeState("Car-001", now))
+	m.Update(makeState("car-001", now))
+
+	if n := len(m.All()); n != 2 {
+		t.Errorf("len(All) = %d, want 2 with canonicalisation disabled", n)
+	}
+}
+
+func TestOnUpdatePassesPreviousState(t *testing.T) {
+	m := NewManager()
+	now := time.Now().UnixMilli()
+
+	type call struct{ prev, next int64 }
+	var calls []call
+	m.OnUpdate(func(prev, next *protocol.VehicleState) {
+		c := call{prev: -1, next: next.Timestamp}
+		if prev != nil {
+			c.prev = prev.Timestamp
+		}
+		calls = append(calls, c)
+		// Listeners run outside the lock and may query the manager.
+		if _, ok := m.Get(next.VehicleID); !ok {
+			t.Error("entry not visible from listener")
+		}
+	})
+
+	m.Update(makeState("car-001", now))
+	m.Update(makeState("car-001", now-10)) // stale, not reported
+	m.Update(makeState("car-001", now+10))
+
+	if len(calls) != 2 {
+		t.Fatalf("listener called %d times, want 2", len(calls))
+	}
+	if calls[0] != (call{-1, now}) {
+		t.Errorf("first call = %+v, want prev nil", calls[0])
+	}
+	if calls[1] != (call{now, now + 10}) {
+		t.Errorf("second call = %+v, want prev %d", calls[1], now)
+	}
+}
+
+func TestOnUpdateListenersRunInRegistrationOrder(t *testing.T) {
+	m := NewManager()
+	now := time.Now().UnixMilli()
+
+	var order []string
+	for _, name := range []string{"geofence", "dashboard", "log"} {
+		m.OnUpdate(func(prev, next *protocol.VehicleState) {
+			order = append(order, name+":"+next.VehicleID)
+		})
+	}
+	var firsts []string
+	m.OnUpdate(func(prev, next *protocol.VehicleState) {
+		if prev == nil {
+			firsts = append(firsts, next.VehicleID)
+		}
+	})
+
+	m.Update(makeState("car-001", now))
+	m.Update(makeState("car-002", now))
+	m.Update(makeState("car-001", now+10))
+
+	want := []string{
+		"geofence:car-001", "dashboard:car-001", "log:car-001",
+		"geofence:car-002", "dashboard:car-002", "log:car-002",
+		"geofence:car-001", "dashboard:car-001", "log:car-001",
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("calls = %v, want %v", order, want)
+	}
+	// prev is tracked per vehicle: each vehicle's first update reports nil.
+	if !reflect.DeepEqual(firsts, []string{"car-001", "car-002"}) {
+		t.Errorf("first updates = %v, want one per vehicle", firsts)
+	}
+}
+
+func TestSetOnline(t *testing.T) {
+	m := NewManager()
+	if m.SetOnline("car-001", false) {
+		t.Error("SetOnline returned true for an unknown vehicle")
+	}
+	m.Update(protocol.NewVehicleState("car-001"))
+	before, _ := m.Get("car-001")
+	if !before.Online {
+		t.Fatal("a fresh update should mark the vehicle online")
+	}
+
+	if !m.SetOnline("CAR-001", false) {
+		t.Fatal("SetOnline returned false for a known vehicle")
+	}
+	if e, _ := m.Get("car-001"); e.Online || e.Version != before.Version {
+		t.Errorf("entry = %+v, want offline with unchanged version", e)
+	}
+	if !before.Online {
+		t.Error("SetOnline modified a previously returned entry")
+	}
+	if ids := m.ActiveVehicles(time.Minute); len(ids) != 0 {
+		t.Errorf("ActiveVehicles = %v, want offline vehicle excluded", ids)
+	}
+
+	m.SetOnline("car-001", true)
+	if ids := m.ActiveVehicles(time.Minute); len(ids) != 1 {
+		t.Errorf("ActiveVehicles = %v, want car-001 back online", ids)
+	}
+}
+
+func TestSetPaused(t *testing.T) {
+	m := NewManager()
+	if m.SetPaused("car-001", true) {
+		t.Error("SetPaused returned true for an unknown vehicle")
+	}
+	m.Update(protocol.NewVehicleState("car-001"))
+	before, _ := m.Get("car-001")
+	if !m.SetPaused("CAR-001", true) {
+		t.Fatal("SetPaused returned false for a known vehicle")
+	}
+	if e, _ := m.Get("car-001"); !e.Paused || e.Version != before.Version {
+		t.Errorf("entry = %+v, want paused with unchanged version", e)
+	}
+	if before.Paused {
+		t.Error("SetPaused modified a previously returned entry")
+	}
+	m.SetPaused("car-001", false)
+	if e, _ := m.Get("car-001"); e.Paused {
+		t.Error("SetPaused(false) left the entry paused")
+	}
+}
+
+func TestPausedKeptAcrossWrites(t *testing.T) {
+	m := NewManager()
+	m.Update(protocol.NewVehicleState("car-001"))
+	m.SetPaused("car-001", true)
+	state := protocol.NewVehicleState("car-001")
+	state.RequestID = "req-1"
+	if r := m.Update(state); r != Applied {
+		t.Fatalf("Update = %v, want Applied", r)
+	}
+	if e, _ := m.Get("car-001"); !e.Paused || e.State.RequestID != "req-1" {
+		t.Errorf("entry = %+v, want the requested state still paused", e)
+	}
+}
+
+func TestMarkStaleUntilNextUpdate(t *testing.T) {
+	m := NewManager()
+	m.Update(protocol.NewVehicleState("car-001"))
+	before, _ := m.Get("car-001")
+
+	if !m.MarkStale("car-001") {
+		t.Fatal("MarkStale returned false for a known vehicle")
+	}
+	if m.MarkStale("car-999") {
+		t.Error("MarkStale returned true for an unknown vehicle")
+	}
+	e, _ := m.Get("car-001")
+	if !e.Stale || e.Version != before.Version {
+		t.Errorf("entry = %+v, want stale with unchanged version", e)
+	}
+	if before.Stale {
+		t.Error("MarkStale modified a previously returned entry")
+	}
+	if ids := m.ActiveVehicles(time.Minute); len(ids) != 0 {
+		t.Errorf("ActiveVehicles = %v, want stale vehicle excluded", ids)
+	}
+
+	m.Update(protocol.NewVehicleState("car-001"))
+	if e, _ := m.Get("car-001"); e.Stale {
+		t.Error("update did not clear Stale")
+	}
+}
+
+func TestUpdateBackfillMarksEntryUntilLiveUpdate(t *testing.T) {
+	m := NewManager()
+	if r := m.UpdateBackfill(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1}); r != Applied {
+		t.Fatalf("UpdateBackfill = %v, want Applied", r)
+	}
+	if e, _ := m.Get("car-001"); !e.Backfill {
+		t.Error("backfilled entry not marked")
+	}
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 2})
+	if e, _ := m.Get("car-001"); e.Backfill {
+		t.Error("live update did not clear Backfill")
+	}
+	// A replayed state older than the live one is dropped as usual.
+	if r := m.UpdateBackfill(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1}); r != DroppedStale {
+		t.Errorf("stale backfill = %v, want DroppedStale", r)
+	}
+}
@@ -0,0 +1,61 @@
+package shadow
+
+import (
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// SetMaxClockSkew flags entries ClockSkewed when the magnitude of their Skew
+// exceeds d. Zero or negative, the default, disables the flag; Skew is
+// measured regardless. The threshold applies from the next write.
+func (m *Manager) SetMaxClockSkew(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxSkew = d
+}
+
+// UpdateReceived is Update for a state the caller received at receivedAt,
+// e.g. before it waited in a queue, so that the entry's Skew does not count
+// the time spent there. A zero receivedAt is the time of the write, as with
+// Update.
+func (m *Manager) UpdateReceived(state *protocol.VehicleState, receivedAt time.Time) UpdateResult {
+	return m.update(state, false, receivedAt)
+}
+
+// measureSkew sets the clock skew fields of e, a write of a state received
+// at receivedAt replacing prev. Backfilled states are old by design, so
+// they keep the skew of prev rather than being measured. It reports whether
+// the vehicle became skewed (1), stopped being skewed (-1) or neither (0).
+// The caller must hold m.mu.
+func (m *Manager) measureSkew(e, prev *Entry, receivedAt time.Time) int {
+	e.ReceivedAt = receivedAt
+	if e.Backfill {
+		if prev != nil {
+			e.Skew, e.ClockSkewed = prev.Skew, prev.ClockSkewed
+		}
+		return 0
+	}
+	e.Skew = receivedAt.Sub(time.UnixMilli(e.State.Timestamp))
+	e.ClockSkewed = m.maxSkew > 0 && e.Skew.Abs() > m.maxSkew
+	was := prev != nil && prev.ClockSkewed
+	switch {
+	case e.ClockSkewed && !was:
+		return 1
+	case !e.ClockSkewed && was:
+		return -1
+	}
+	return 0
+}
+
+// logSkew logs a vehicle's clock going out of or back into tolerance, as
+// reported by measureSkew.
+func logSkew(log logging.Logger, e *Entry, change int) {
+	switch change {
+	case 1:
+		log.Warn("vehicle clock skewed", "vehicle_id", e.State.VehicleID, "skew", e.Skew)
+	case -1:
+		log.Info("vehicle clock back in sync", "vehicle_id", e.State.VehicleID, "skew", e.Skew)
+	}
+}
@@ -0,0 +1,73 @@
+package shadow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestFutureTimestampIsNegativeSkew(t *testing.T) {
+	var rec logging.Recorder
+	m := NewManager()
+	m.SetLogger(&rec)
+	now := time.Unix(1_700_000_000, 0)
+	m.SetClock(func() time.Time { return now })
+	m.SetMaxClockSkew(5 * time.Second)
+
+	ahead := now.Add(time.Minute)
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: ahead.UnixMilli()})
+	e, _ := m.Get("car-001")
+	if e.Skew != -time.Minute || !e.ClockSkewed {
+		t.Fatalf("skew = %v, flagged %v; want -1m0s, flagged", e.Skew, e.ClockSkewed)
+	}
+	if !e.ReceivedAt.Equal(now) {
+		t.Errorf("ReceivedAt = %v, want %v", e.ReceivedAt, now)
+	}
+	if _, ok := rec.Find(logging.LevelWarn, "vehicle clock skewed"); !ok {
+		t.Errorf("logged %+v, want a skew warning", rec.Entries())
+	}
+
+	// Skew is measured, not enforced: a later state from the corrected
+	// clock is still older than the stored one and dropped.
+	now = now.Add(time.Second)
+	if got := m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now.UnixMilli()}); got != DroppedStale {
+		t.Fatalf("corrected state = %v, want %v", got, DroppedStale)
+	}
+	now = now.Add(2 * time.Minute)
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now.Add(-100 * time.Millisecond).UnixMilli()})
+	if e, _ := m.Get("car-001"); e.Skew != 100*time.Millisecond || e.ClockSkewed {
+		t.Errorf("skew = %v, flagged %v; want 100ms, not flagged", e.Skew, e.ClockSkewed)
+	}
+	if _, ok := rec.Find(logging.LevelInfo, "vehicle clock back in sync"); !ok {
+		t.Errorf("logged %+v, want the recovery", rec.Entries())
+	}
+}
+
+func TestSkewMeasuredFromReceiveTime(t *testing.T) {
+	m := NewManager()
+	now := time.Unix(1_700_000_000, 0)
+	m.SetClock(func() time.Time { return now })
+	m.SetMaxClockSkew(time.Second)
+
+	// The state waited 3s in a queue after arriving on time.
+	received := now.Add(-3 * time.Second)
+	m.UpdateReceived(&protocol.VehicleState{VehicleID: "car-001", Timestamp: received.UnixMilli()}, received)
+	e, _ := m.Get("car-001")
+	if e.Skew != 0 || e.ClockSkewed || !e.ReceivedAt.Equal(received) || !e.UpdatedAt.Equal(now) {
+		t.Errorf("entry = %+v, want zero skew received 3s before the write", e)
+	}
+
+	// A backfilled state is old by design and keeps the measured skew.
+	m.UpdateBackfill(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now.Add(-time.Second).UnixMilli()})
+	if e, _ := m.Get("car-001"); e.Skew != 0 || e.ClockSkewed {
+		t.Errorf("backfill skew = %v, flagged %v; want carried over", e.Skew, e.ClockSkewed)
+	}
+
+	m.SetMaxClockSkew(0)
+	m.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: now.Add(time.Hour).UnixMilli()})
+	if e, _ := m.Get("car-001"); e.Skew != -time.Hour || e.ClockSkewed {
+		t.Errorf("skew = %v, flagged %v with the check disabled; want -1h0m0s, not flagged", e.Skew, e.ClockSkewed)
+	}
+}
@@ -0,0 +1,97 @@
+package shadow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// snapshotEntry is the serialized form of an Entry. Liveness, Backfill and
+// clock skew are not kept: liveness is regraded from UpdatedAt on load, a
+// restored entry is not a broker backfill, and skew is measured afresh with
+// the vehicle's next state. Histories are not kept either, only the
+// distance traveled through them.
+type snapshotEntry struct {
+	State     *protocol.VehicleState `json:"state"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	Version   uint64                 `json:"version"`
+	Stale     bool                   `json:"stale,omitempty"`
+	Online    bool                   `json:"online"`
+	Distance  float64                `json:"distance_traveled,omitempty"`
+}
+
+// Snapshot writes every shadow entry to w as a JSON object keyed by vehicle
+// ID, so the shadow survives a restart (see LoadSnapshot).
+func (m *Manager) Snapshot(w io.Writer) error {
+	m.mu.RLock()
+	entries := make(map[string]snapshotEntry, len(m.shadows))
+	for id, e := range m.shadows {
+		entries[id] = snapshotEntry{
+			State:     e.State,
+			UpdatedAt: e.UpdatedAt,
+			Version:   e.Version,
+			Stale:     e.Stale,
+			Online:    e.Online,
+			Distance:  e.distance,
+		}
+	}
+	m.mu.RUnlock()
+
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		return fmt.Errorf("shadow: write snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot restores entries written by Snapshot. Each keeps its original
+// UpdatedAt, so ActiveVehicles and liveness still judge it by when the
+// vehicle last reported rather than by when it was restored. An entry whose
+// vehicle already has a state at least as new is skipped, so a live state
+// that arrived first is never rolled back. With history enabled, a restored
+// state seeds the vehicle's history so DistanceTraveled carries on from its
+// saved total. Listeners are not notified.
+func (m *Manager) LoadSnapshot(r io.Reader) error {
+	var entries map[string]snapshotEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return fmt.Errorf("shadow: read snapshot: %w", err)
+	}
+
+	for id, s := range entries {
+		if s.State == nil {
+			return fmt.Errorf("shadow: read snapshot: vehicle %q has no state", id)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for _, s := range entries {
+		state := s.State
+		key := m.canon(state.VehicleID)
+		existing, ok := m.shadows[key]
+		if ok && existing.State.Timestamp >= state.Timestamp {
+			continue
+		}
+		e := &Entry{
+			State:     state,
+			UpdatedAt: s.UpdatedAt,
+			Version:   s.Version,
+			Stale:     s.Stale,
+			Online:    s.Online,
+			distance:  s.Distance,
+		}
+		e.ReceivedAt = s.UpdatedAt
+		if _, seeded := m.histories[key]; !seeded && m.historySize > 0 {
+			m.histories[key] = &history{states: []*protocol.VehicleState{state}, odometer: s.Distance}
+		}
+		if ok {
+			e.Version = max(e.Version, existing.Version+1)
+		}
+		e.Liveness = m.liveness.grade(e, now)
+		m.shadows[key] = e
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package shadow
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+
+	src := NewManager()
+	src.SetClock(clock)
+	src.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000, Latitude: 39.9, Longitude: 116.4, Speed: 3})
+	now = now.Add(time.Minute)
+	src.Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: 2000, BatteryPct: 80})
+	src.Update(&protocol.VehicleState{VehicleID: "car-002", Timestamp: 2100, BatteryPct: 79})
+	src.MarkStale("car-002")
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	dst := NewManager()
+	dst.SetClock(clock)
+	if err := dst.LoadSnapshot(&buf); err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	want, got := src.All(), dst.All()
+	if len(got) != len(want) {
+		t.Fatalf("restored %d entries, want %d", len(got), len(want))
+	}
+	for id, w := range want {
+		g := got[id]
+		if g == nil {
+			t.Errorf("%s missing after restore", id)
+			continue
+		}
+		if !reflect.DeepEqual(g.State, w.State) || !g.UpdatedAt.Equal(w.UpdatedAt) ||
+			g.Version != w.Version || g.Stale != w.Stale || g.Online != w.Online {
+			t.Errorf("%s restored as %+v, want %+v", id, g, w)
+		}
+	}
+
+	// car-001 last reported a minute before the restore, so it is not active
+	// even though it was restored just now.
+	if ids := dst.ActiveVehicles(10 * time.Second); len(ids) != 0 {
+		t.Errorf("ActiveVehicles = %v, want none (car-001 is old, car-002 stale)", ids)
+	}
+	if e, _ := dst.Get("car-001"); e.Liveness != LivenessOffline {
+		t.Errorf("car-001 liveness = %v, want offline", e.Liveness)
+	}
+}
+
+func TestLoadSnapshotKeepsNewerLiveState(t *testing.T) {
+	src := NewManager()
+	src.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000})
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewManager()
+	dst.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 5000})
+	if err := dst.LoadSnapshot(&buf); err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if e, _ := dst.Get("car-001"); e.State.Timestamp != 5000 {
+		t.Errorf("timestamp = %d, want the live state kept", e.State.Timestamp)
+	}
+}
+
+func TestLoadSnapshotRejectsMalformedInput(t *testing.T) {
+	m := NewManager()
+	for _, in := range []string{`not json`, `{"car-001":{"updated_at":"2024-01-01T00:00:00Z"}}`} {
+		if err := m.LoadSnapshot(strings.NewReader(in)); err == nil {
+			t.Errorf("LoadSnapshot(%q) = nil, want an error", in)
+		}
+	}
+	if n := len(m.All()); n != 0 {
+		t.Errorf("entries after failed loads = %d, want 0", n)
+	}
+}
+
+func TestSnapshotKeepsDistanceTraveled(t *testing.T) {
+	src := NewManagerWithHistory(10)
+	src.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 1000, Longitude: 10})
+	src.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 2000, Longitude: 10.001})
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewManagerWithHistory(10)
+	if err := dst.LoadSnapshot(&buf); err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	hop := protocol.DistanceMeters(0, 0, 0, 0.001)
+	if e, _ := dst.Get("car-001"); math.Abs(e.DistanceTraveled()-hop) > 0.01 {
+		t.Errorf("restored distance = %.2f m, want %.2f m", e.DistanceTraveled(), hop)
+	}
+	// The odometer carries on from the restored position.
+	dst.Update(&protocol.VehicleState{VehicleID: "car-001", Timestamp: 3000, Longitude: 10.002})
+	if e, _ := dst.Get("car-001"); math.Abs(e.DistanceTraveled()-2*hop) > 0.01 {
+		t.Errorf("distance after restart = %.2f m, want %.2f m", e.DistanceTraveled(), 2*hop)
+	}
+}
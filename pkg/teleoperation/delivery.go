@@ -0,0 +1,58 @@
+package teleoperation
+
+import (
+	"sort"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// duplicate reports whether alert's AlertID was already handled within
+// Config.DedupWindow, recording it otherwise.
+func (h *Handler) duplicate(alert *protocol.TeleoperationAlert) bool {
+	if h.cfg.DedupWindow <= 0 || alert.AlertID == "" {
+		return false
+	}
+	now := h.now()
+
+	h.deliveryMu.Lock()
+	defer h.deliveryMu.Unlock()
+	for id, at := range h.seen {
+		if now.Sub(at) > h.cfg.DedupWindow {
+			delete(h.seen, id)
+		}
+	}
+	if _, ok := h.seen[alert.AlertID]; ok {
+		return true
+	}
+	h.seen[alert.AlertID] = now
+	return false
+}
+
+// hold queues alert until the current reorder window closes.
+func (h *Handler) hold(alert *protocol.TeleoperationAlert) {
+	h.deliveryMu.Lock()
+	defer h.deliveryMu.Unlock()
+	h.pending = append(h.pending, alert)
+	if h.flushTimer == nil {
+		h.flushTimer = time.AfterFunc(h.cfg.ReorderWindow, h.Flush)
+	}
+}
+
+// Flush immediately delivers every alert held for reordering, oldest first.
+// It is a no-op when ReorderWindow is not configured.
+func (h *Handler) Flush() {
+	h.deliveryMu.Lock()
+	batch := h.pending
+	h.pending = nil
+	if h.flushTimer != nil {
+		h.flushTimer.Stop()
+		h.flushTimer = nil
+	}
+	h.deliveryMu.Unlock()
+
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].Timestamp < batch[j].Timestamp })
+	for _, a := range batch {
+		h.deliver(a)
+	}
+}
@@ -0,0 +1,78 @@
+package teleoperation
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestRedeliveredAlertFiresOnce(t *testing.T) {
+	h := NewHandlerWithConfig(Config{DedupWindow: time.Minute})
+
+	var count int
+	h.Register(func(*protocol.TeleoperationAlert) { count++ })
+
+	alert := NewAlert("car-001", "extreme_weather", 39.9, 116.4, 3)
+	alert.AlertID = "alert-1"
+	h.Handle(alert)
+	redelivered := *alert
+	h.Handle(&redelivered)
+
+	if count != 1 {
+		t.Errorf("listener called %d times, want 1", count)
+	}
+}
+
+func TestDedupWindowExpires(t *testing.T) {
+	h := NewHandlerWithConfig(Config{DedupWindow: time.Minute})
+	now := time.Now()
+	h.now = func() time.Time { return now }
+
+	var count int
+	h.Register(func(*protocol.TeleoperationAlert) { count++ })
+
+	alert := NewAlert("car-001", "extreme_weather", 0, 0, 2)
+	alert.AlertID = "alert-1"
+	h.Handle(alert)
+	now = now.Add(2 * time.Minute)
+	h.Handle(alert)
+
+	if count != 2 {
+		t.Errorf("listener called %d times, want 2 after the window expired", count)
+	}
+}
+
+func TestReorderWindowDeliversOldestFirst(t *testing.T) {
+	h := NewHandlerWithConfig(Config{ReorderWindow: 20 * time.Millisecond})
+
+	var mu sync.Mutex
+	var got []int64
+	done := make(chan struct{})
+	h.Register(func(a *protocol.TeleoperationAlert) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, a.Timestamp)
+		if len(got) == 3 {
+			close(done)
+		}
+	})
+
+	for _, ts := range []int64{300, 100, 200} {
+		a := NewAlert("car-001", "unmarked_construction", 0, 0, 1)
+		a.Timestamp = ts
+		h.Handle(a)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("held alerts were never delivered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got[0] != 100 || got[1] != 200 || got[2] != 300 {
+		t.Errorf("delivery order = %v, want [100 200 300]", got)
+	}
+}
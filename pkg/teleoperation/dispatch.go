@@ -0,0 +1,162 @@
+package teleoperation
+
+import (
+	"runtime/debug"
+	"sync"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// defaultQueueDepth is the dispatch queue capacity used when Config.Workers
+// is set without a QueueDepth.
+const defaultQueueDepth = 256
+
+// dispatcher runs listener notification on a pool of worker goroutines
+// (see Config.Workers).
+type dispatcher struct {
+	jobs         chan *protocol.TeleoperationAlert
+	dropWhenFull bool
+	log          logging.Logger
+
+	done      chan struct{}
+	closeOnce sync.Once
+	workers   sync.WaitGroup
+	senders   sync.WaitGroup // dispatch calls that passed the closed check
+
+	mu      sync.Mutex
+	closed  bool
+	dropped uint64
+}
+
+func newDispatcher(workers, depth int, dropWhenFull bool, notify func(*protocol.TeleoperationAlert), log logging.Logger) *dispatcher {
+	if depth <= 0 {
+		depth = defaultQueueDepth
+	}
+	d := &dispatcher{
+		jobs:         make(chan *protocol.TeleoperationAlert, depth),
+		dropWhenFull: dropWhenFull,
+		log:          log,
+		done:         make(chan struct{}),
+	}
+	d.workers.Add(workers)
+	for range workers {
+		go d.run(notify)
+	}
+	return d
+}
+
+// run notifies listeners of queued alerts until close, then of those still
+// queued.
+func (d *dispatcher) run(notify func(*protocol.TeleoperationAlert)) {
+	defer d.workers.Done()
+	for {
+		select {
+		case alert := <-d.jobs:
+			notify(alert)
+		case <-d.done:
+			for {
+				select {
+				case alert := <-d.jobs:
+					notify(alert)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// dispatch queues alert for the workers. When the queue is full it waits for
+// room, or drops the alert with Config.DropWhenFull. Alerts dispatched after
+// close are dropped.
+func (d *dispatcher) dispatch(alert *protocol.TeleoperationAlert) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		d.drop(alert, "handler closed")
+		return
+	}
+	d.senders.Add(1)
+	d.mu.Unlock()
+	defer d.senders.Done()
+
+	if d.dropWhenFull {
+		select {
+		case d.jobs <- alert:
+		default:
+			d.drop(alert, "dispatch queue full")
+		}
+		return
+	}
+	d.jobs <- alert
+}
+
+func (d *dispatcher) drop(alert *protocol.TeleoperationAlert, why string) {
+	d.mu.Lock()
+	d.dropped++
+	d.mu.Unlock()
+	d.log.Warn("dropping teleoperation alert", "vehicle_id", alert.VehicleID, "alert_id", alert.AlertID, "why", why)
+}
+
+// close stops accepting alerts and waits until the queued ones are
+// delivered. Dispatch calls already past the closed check finish queueing
+// first, while the workers still run, so none of their alerts is stranded
+// in the queue.
+func (d *dispatcher) close() {
+	d.closeOnce.Do(func() {
+		d.mu.Lock()
+		d.closed = true
+		d.mu.Unlock()
+		d.senders.Wait()
+		close(d.done)
+	})
+	d.workers.Wait()
+}
+
+// Dropped returns how many alerts were dropped without reaching listeners
+// because the dispatch queue was full (with Config.DropWhenFull) or the
+// Handler was closed. It is zero without Config.Workers.
+func (h *Handler) Dropped() uint64 {
+	if h.dispatch == nil {
+		return 0
+	}
+	h.dispatch.mu.Lock()
+	defer h.dispatch.mu.Unlock()
+	return h.dispatch.dropped
+}
+
+// Close stops the dispatch workers started for Config.Workers after they
+// have delivered the alerts already queued; alerts handled afterwards are
+// dropped. It is a no-op without Config.Workers.
+func (h *Handler) Close() {
+	if h.dispatch != nil {
+		h.dispatch.close()
+	}
+}
+
+// notify calls the listeners that accept alert, each guarded so a panicking
+// listener is logged and skipped rather than taking down its caller or the
+// listeners after it.
+func (h *Handler) notify(alert *protocol.TeleoperationAlert) {
+	h.mu.RLock()
+	ls := make([]registration, len(h.listeners))
+	copy(ls, h.listeners)
+	h.mu.RUnlock()
+
+	for _, r := range ls {
+		if r.filter == nil || r.filter(alert) {
+			h.call(r.listener, alert)
+		}
+	}
+}
+
+func (h *Handler) call(l AlertListener, alert *protocol.TeleoperationAlert) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.log.Error("alert listener panicked", "vehicle_id", alert.VehicleID, "alert_id", alert.AlertID,
+				"panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+	l(alert)
+}
@@ -0,0 +1,178 @@
+package teleoperation
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestPanickingListenerDoesNotStopOthers(t *testing.T) {
+	var rec logging.Recorder
+	h := NewHandlerWithConfig(Config{Logger: &rec})
+	var before, after int32
+	h.Register(func(*protocol.TeleoperationAlert) { atomic.AddInt32(&before, 1) })
+	h.Register(func(*protocol.TeleoperationAlert) { panic("listener bug") })
+	h.Register(func(*protocol.TeleoperationAlert) { atomic.AddInt32(&after, 1) })
+
+	h.Handle(NewAlert("car-001", "extreme_weather", 0, 0, 2))
+	h.Handle(NewAlert("car-001", "sensor_failure", 0, 0, 2))
+
+	if before != 2 || after != 2 {
+		t.Errorf("listeners around the panicking one called %d and %d times, want 2 each", before, after)
+	}
+	if e, ok := rec.Find(logging.LevelError, "alert listener panicked"); !ok || e.Fields["panic"] != "listener bug" {
+		t.Errorf("panic not logged at error level: %+v", rec.Entries())
+	}
+}
+
+func TestWorkersKeepSlowAndPanickingListenersOffTheCaller(t *testing.T) {
+	h := NewHandlerWithConfig(Config{Workers: 2, QueueDepth: 8})
+	defer h.Close()
+
+	release := make(chan struct{})
+	fired := make(chan string, 8)
+	h.Register(func(a *protocol.TeleoperationAlert) {
+		if a.Reason == "slow" {
+			<-release
+		}
+	})
+	h.Register(func(a *protocol.TeleoperationAlert) {
+		if a.Reason == "panic" {
+			panic("listener bug")
+		}
+	})
+	h.Register(func(a *protocol.TeleoperationAlert) { fired <- a.Reason })
+
+	start := time.Now()
+	for _, reason := range []string{"slow", "panic", "ok"} {
+		h.Handle(NewAlert("car-001", reason, 0, 0, 2))
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Handle blocked for %v behind a slow listener", elapsed)
+	}
+
+	// One worker is stuck in the slow listener; the other delivers the rest.
+	got := make(map[string]bool)
+	for range 2 {
+		select {
+		case r := <-fired:
+			got[r] = true
+		case <-time.After(time.Second):
+			t.Fatalf("only %v delivered while a listener was slow", got)
+		}
+	}
+	if !got["panic"] || !got["ok"] {
+		t.Errorf("delivered %v, want the panicking and ok alerts", got)
+	}
+
+	close(release)
+	select {
+	case r := <-fired:
+		if r != "slow" {
+			t.Errorf("last delivery = %q, want slow", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("slow alert never reached the remaining listener")
+	}
+}
+
+func TestDropWhenFull(t *testing.T) {
+	h := NewHandlerWithConfig(Config{Workers: 1, QueueDepth: 1, DropWhenFull: true})
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	var delivered int32
+	h.Register(func(*protocol.TeleoperationAlert) {
+		select {
+		case started <- struct{}{}:
+			<-release
+		default:
+		}
+		atomic.AddInt32(&delivered, 1)
+	})
+
+	h.Handle(NewAlert("car-001", "a", 0, 0, 2))
+	<-started                                   // the worker is busy
+	h.Handle(NewAlert("car-001", "b", 0, 0, 2)) // queued
+	h.Handle(NewAlert("car-001", "c", 0, 0, 2)) // dropped
+	if n := h.Dropped(); n != 1 {
+		t.Errorf("Dropped = %d, want 1", n)
+	}
+
+	close(release)
+	h.Close()
+	if n := atomic.LoadInt32(&delivered); n != 2 {
+		t.Errorf("delivered %d alerts, want the 2 that fit", n)
+	}
+	h.Handle(NewAlert("car-001", "d", 0, 0, 2))
+	if n := h.Dropped(); n != 2 {
+		t.Errorf("Dropped after Close = %d, want 2", n)
+	}
+}
+
+func TestCloseAccountsForConcurrentAlerts(t *testing.T) {
+	const senders, perSender = 8, 50
+	h := NewHandlerWithConfig(Config{Workers: 2, QueueDepth: 4, Logger: &logging.Recorder{}})
+	var delivered atomic.Uint64
+	h.Register(func(*protocol.TeleoperationAlert) { delivered.Add(1) })
+
+	var wg sync.WaitGroup
+	for i := range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range perSender {
+				h.Handle(NewAlert(fmt.Sprintf("car-%d-%d", i, j), "obstacle", 0, 0, 2))
+			}
+		}()
+	}
+	h.Close()
+	wg.Wait()
+
+	if got := delivered.Load() + h.Dropped(); got != senders*perSender {
+		t.Errorf("delivered %d + dropped %d = %d, want every one of %d alerts accounted for",
+			delivered.Load(), h.Dropped(), got, senders*perSender)
+	}
+}
+
+func TestCloseDeliversAlertsWaitingForRoom(t *testing.T) {
+	h := NewHandlerWithConfig(Config{Workers: 1, QueueDepth: 1})
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	var delivered atomic.Int32
+	h.Register(func(*protocol.TeleoperationAlert) {
+		select {
+		case started <- struct{}{}:
+			<-release
+		default:
+		}
+		delivered.Add(1)
+	})
+
+	h.Handle(NewAlert("car-001", "a", 0, 0, 2))
+	<-started                                   // the worker is busy
+	h.Handle(NewAlert("car-002", "b", 0, 0, 2)) // queued
+	waiting := make(chan struct{})
+	go func() {
+		h.Handle(NewAlert("car-003", "c", 0, 0, 2)) // waits for room
+		close(waiting)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		h.Close()
+		close(closed)
+	}()
+	time.Sleep(20 * time.Millisecond) // Close waits for the queued sender
+	close(release)
+	<-waiting
+	<-closed
+	if n, dropped := delivered.Load(), h.Dropped(); n != 3 || dropped != 0 {
+		t.Errorf("delivered %d, dropped %d; want all 3 delivered", n, dropped)
+	}
+}
@@ -0,0 +1,99 @@
+package teleoperation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// RateLimitedReason prefixes the Reason of the summary alert delivered in
+// place of alerts suppressed by Config.RateLimit.
+const RateLimitedReason = "rate-limited"
+
+// defaultRateWindow is used when Config.RateLimit is set without a window.
+const defaultRateWindow = time.Minute
+
+// bucket is the per-vehicle token bucket behind Config.RateLimit.
+type bucket struct {
+	tokens float64
+	last   time.Time
+
+	suppressed  int
+	maxSeverity int32
+	latest      *protocol.TeleoperationAlert
+	timer       *time.Timer
+}
+
+func (h *Handler) rateWindow() time.Duration {
+	if h.cfg.RateWindow > 0 {
+		return h.cfg.RateWindow
+	}
+	return defaultRateWindow
+}
+
+// limited reports whether alert exceeds its vehicle's rate and was folded
+// into the pending summary. Critical alerts are never limited.
+func (h *Handler) limited(alert *protocol.TeleoperationAlert) bool {
+	if h.cfg.RateLimit <= 0 || alert.Severity >= 3 {
+		return false
+	}
+	now := h.now()
+	window := h.rateWindow()
+	capacity := float64(h.cfg.RateLimit)
+
+	h.deliveryMu.Lock()
+	defer h.deliveryMu.Unlock()
+	b, ok := h.buckets[alert.VehicleID]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		h.buckets[alert.VehicleID] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * capacity / window.Seconds()
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return false
+	}
+
+	b.suppressed++
+	b.latest = alert
+	if alert.Severity > b.maxSeverity {
+		b.maxSeverity = alert.Severity
+	}
+	if b.timer == nil {
+		vehicleID := alert.VehicleID
+		b.timer = time.AfterFunc(window, func() { h.summarize(vehicleID) })
+	}
+	return true
+}
+
+// summarize delivers a single alert standing in for everything suppressed
+// from vehicleID during the window that just closed.
+func (h *Handler) summarize(vehicleID string) {
+	h.deliveryMu.Lock()
+	b, ok := h.buckets[vehicleID]
+	if !ok || b.suppressed == 0 {
+		h.deliveryMu.Unlock()
+		return
+	}
+	summary := &protocol.TeleoperationAlert{
+		AlertID:   protocol.NewID(),
+		VehicleID: vehicleID,
+		Reason:    fmt.Sprintf("%s: %d alert(s) suppressed, last: %s", RateLimitedReason, b.suppressed, b.latest.Reason),
+		Latitude:  b.latest.Latitude,
+		Longitude: b.latest.Longitude,
+		Severity:  b.maxSeverity,
+		Timestamp: h.now().UnixMilli(),
+	}
+	b.suppressed = 0
+	b.maxSeverity = 0
+	b.latest = nil
+	b.timer = nil
+	h.deliveryMu.Unlock()
+
+	h.deliver(summary)
+}
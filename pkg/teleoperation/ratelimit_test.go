@@ -0,0 +1,78 @@
+package teleoperation
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestRateLimitCoalescesBurst(t *testing.T) {
+	h := NewHandlerWithConfig(Config{RateLimit: 3, RateWindow: 50 * time.Millisecond})
+	now := time.Now()
+	h.now = func() time.Time { return now }
+
+	var mu sync.Mutex
+	var got []*protocol.TeleoperationAlert
+	summary := make(chan *protocol.TeleoperationAlert, 1)
+	h.Register(func(a *protocol.TeleoperationAlert) {
+		if strings.HasPrefix(a.Reason, RateLimitedReason) {
+			summary <- a
+			return
+		}
+		mu.Lock()
+		got = append(got, a)
+		mu.Unlock()
+	})
+
+	for i := 0; i < 10; i++ {
+		h.Handle(NewAlert("car-001", "sensor_glitch", 0, 0, 1))
+	}
+	h.Handle(NewAlert("car-001", "collision_risk", 0, 0, 3))
+	h.Handle(NewAlert("car-002", "sensor_glitch", 0, 0, 2))
+
+	mu.Lock()
+	if len(got) != 5 {
+		t.Errorf("delivered %d alerts, want 3 within rate + 1 critical + 1 other vehicle", len(got))
+	}
+	mu.Unlock()
+
+	select {
+	case s := <-summary:
+		if s.VehicleID != "car-001" {
+			t.Errorf("summary vehicle = %q, want car-001", s.VehicleID)
+		}
+		if !strings.Contains(s.Reason, "7 alert(s) suppressed") {
+			t.Errorf("summary reason = %q, want 7 suppressed", s.Reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no rate-limited summary delivered")
+	}
+	select {
+	case s := <-summary:
+		t.Errorf("unexpected second summary %+v", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRateLimitRefills(t *testing.T) {
+	h := NewHandlerWithConfig(Config{RateLimit: 2, RateWindow: time.Hour})
+	now := time.Now()
+	h.now = func() time.Time { return now }
+
+	var count int
+	h.Register(func(*protocol.TeleoperationAlert) { count++ })
+
+	h.Handle(NewAlert("car-001", "a", 0, 0, 1))
+	h.Handle(NewAlert("car-001", "b", 0, 0, 1))
+	h.Handle(NewAlert("car-001", "c", 0, 0, 1))
+	now = now.Add(30 * time.Minute) // one token back
+	h.Handle(NewAlert("car-001", "d", 0, 0, 1))
+	h.Handle(NewAlert("car-001", "e", 0, 0, 1))
+
+	if count != 3 {
+		t.Errorf("listener called %d times, want 3", count)
+	}
+}
@@ -0,0 +1,19 @@
+package teleoperation
+
+// BoundingBox is a latitude/longitude rectangle in WGS84 degrees. A box whose
+// MinLon is greater than MaxLon spans the antimeridian.
+type BoundingBox struct {
+	MinLat, MinLon float64
+	MaxLat, MaxLon float64
+}
+
+// Contains reports whether (lat, lon) lies inside the box, edges included.
+func (b BoundingBox) Contains(lat, lon float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return lon >= b.MinLon && lon <= b.MaxLon
+	}
+	return lon >= b.MinLon || lon <= b.MaxLon
+}
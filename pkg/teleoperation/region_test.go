@@ -0,0 +1,59 @@
+package teleoperation
+
+import (
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+var beijing = BoundingBox{MinLat: 39.7, MinLon: 116.1, MaxLat: 40.1, MaxLon: 116.7}
+
+func TestBoundingBoxContains(t *testing.T) {
+	if !beijing.Contains(39.9042, 116.4074) {
+		t.Error("expected point inside box")
+	}
+	if beijing.Contains(31.2304, 121.4737) {
+		t.Error("expected point outside box")
+	}
+
+	pacific := BoundingBox{MinLat: -10, MinLon: 170, MaxLat: 10, MaxLon: -170}
+	if !pacific.Contains(0, 179.5) || !pacific.Contains(0, -179.5) {
+		t.Error("antimeridian box should contain points on both sides of 180°")
+	}
+	if pacific.Contains(0, 0) {
+		t.Error("antimeridian box should not contain the prime meridian")
+	}
+}
+
+func TestRegisterRegionalFiltersByLocation(t *testing.T) {
+	h := NewHandler()
+
+	var got []string
+	h.RegisterRegional(beijing, func(a *protocol.TeleoperationAlert) {
+		got = append(got, a.VehicleID)
+	})
+
+	h.Handle(NewAlert("car-bj", "extreme_weather", 39.9042, 116.4074, 2))
+	h.Handle(NewAlert("car-sh", "extreme_weather", 31.2304, 121.4737, 2))
+
+	if len(got) != 1 || got[0] != "car-bj" {
+		t.Errorf("regional listener received %v, want [car-bj]", got)
+	}
+}
+
+func TestRegisterRegionalWithSeverity(t *testing.T) {
+	h := NewHandler()
+
+	var got []int32
+	h.RegisterRegional(beijing, func(a *protocol.TeleoperationAlert) {
+		got = append(got, a.Severity)
+	}, MinSeverity(3))
+
+	h.Handle(NewAlert("car-bj", "unmarked_construction", 39.9, 116.4, 1))
+	h.Handle(NewAlert("car-bj", "sensor_failure", 39.9, 116.4, 3))
+	h.Handle(NewAlert("car-sh", "sensor_failure", 31.2, 121.4, 3))
+
+	if len(got) != 1 || got[0] != 3 {
+		t.Errorf("listener received severities %v, want [3]", got)
+	}
+}
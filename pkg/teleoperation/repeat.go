@@ -0,0 +1,82 @@
+package teleoperation
+
+import (
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// repeatKey identifies alerts that count as repeats of one another.
+type repeatKey struct {
+	vehicleID string
+	reason    string
+}
+
+// repeatState tracks the last delivered alert of a repeatKey and the repeats
+// suppressed since.
+type repeatState struct {
+	deliveredAt time.Time
+	severity    int32
+	suppressed  int32
+	latest      *protocol.TeleoperationAlert // last suppressed
+	timer       *time.Timer                  // flushes the repeats at the end of the window
+}
+
+// repeated applies Config.RepeatWindow. It reports whether alert repeats one
+// delivered for the same vehicle and reason within the window and at least
+// the same severity, counting it if so. Otherwise it returns the alert to
+// deliver: a copy carrying in Occurrences the repeats it stands for.
+// Repeats still suppressed when the window closes are flushed by
+// flushRepeats.
+func (h *Handler) repeated(alert *protocol.TeleoperationAlert) (*protocol.TeleoperationAlert, bool) {
+	window := h.cfg.RepeatWindow
+	if window <= 0 {
+		return alert, false
+	}
+	now := h.now()
+	key := repeatKey{alert.VehicleID, alert.Reason}
+
+	h.deliveryMu.Lock()
+	defer h.deliveryMu.Unlock()
+	for k, r := range h.repeats {
+		if now.Sub(r.deliveredAt) >= window && r.suppressed == 0 {
+			delete(h.repeats, k)
+		}
+	}
+	r, ok := h.repeats[key]
+	if ok && now.Sub(r.deliveredAt) < window && alert.Severity <= r.severity {
+		r.suppressed++
+		r.latest = alert
+		if r.timer == nil {
+			r.timer = time.AfterFunc(window-now.Sub(r.deliveredAt), func() { h.flushRepeats(key, r) })
+		}
+		return nil, true
+	}
+	cp := *alert
+	cp.Occurrences = 1
+	if ok {
+		cp.Occurrences += r.suppressed
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+	}
+	h.repeats[key] = &repeatState{deliveredAt: now, severity: alert.Severity}
+	return &cp, false
+}
+
+// flushRepeats forwards the last alert r suppressed, carrying in Occurrences
+// the repeats it stands for, once r's window has closed without another
+// alert delivered for key, and forgets key.
+func (h *Handler) flushRepeats(key repeatKey, r *repeatState) {
+	h.deliveryMu.Lock()
+	if h.repeats[key] != r || r.suppressed == 0 {
+		h.deliveryMu.Unlock()
+		return
+	}
+	delete(h.repeats, key)
+	cp := *r.latest
+	cp.Occurrences = r.suppressed
+	h.deliveryMu.Unlock()
+
+	h.forward(&cp)
+}
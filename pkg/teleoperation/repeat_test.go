@@ -0,0 +1,128 @@
+package teleoperation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestRepeatWindowSuppressesAndCounts(t *testing.T) {
+	h := NewHandlerWithConfig(Config{RepeatWindow: 10 * time.Second})
+	now := time.Unix(1_700_000_000, 0)
+	h.now = func() time.Time { return now }
+
+	var got []*protocol.TeleoperationAlert
+	h.Register(func(a *protocol.TeleoperationAlert) { got = append(got, a) })
+
+	stuck := func() *protocol.TeleoperationAlert {
+		return NewAlert("car-001", "unmarked_construction", 39.9, 116.4, 2)
+	}
+	h.Handle(stuck())
+	for range 5 {
+		now = now.Add(time.Second)
+		h.Handle(stuck())
+	}
+	if len(got) != 1 {
+		t.Fatalf("delivered %d alerts within the window, want 1", len(got))
+	}
+	if got[0].Occurrences != 1 {
+		t.Errorf("first alert occurrences = %d, want 1", got[0].Occurrences)
+	}
+
+	// The window runs from the last delivery; once it passes, the next
+	// repeat is delivered and accounts for the five suppressed.
+	now = now.Add(5 * time.Second)
+	h.Handle(stuck())
+	if len(got) != 2 {
+		t.Fatalf("delivered %d alerts after the window, want 2", len(got))
+	}
+	if got[1].Occurrences != 6 {
+		t.Errorf("occurrences after expiry = %d, want 6", got[1].Occurrences)
+	}
+
+	// Nothing suppressed since: a later alert stands for itself alone.
+	now = now.Add(time.Minute)
+	h.Handle(stuck())
+	if len(got) != 3 || got[2].Occurrences != 1 {
+		t.Errorf("quiet repeat = %+v, want delivered with occurrences 1", got[len(got)-1])
+	}
+	if stored, _ := h.Store().Query(AlertQuery{VehicleID: "car-001"}); len(stored) != 8 {
+		t.Errorf("stored %d alerts, want all 8 kept for review", len(stored))
+	}
+}
+
+func TestRepeatWindowLetsEscalationAndNewReasonsThrough(t *testing.T) {
+	h := NewHandlerWithConfig(Config{RepeatWindow: time.Minute})
+	now := time.Unix(1_700_000_000, 0)
+	h.now = func() time.Time { return now }
+
+	var got []*protocol.TeleoperationAlert
+	h.Register(func(a *protocol.TeleoperationAlert) { got = append(got, a) })
+
+	h.Handle(NewAlert("car-001", "unmarked_construction", 0, 0, 1))
+	h.Handle(NewAlert("car-001", "unmarked_construction", 0, 0, 1))
+	h.Handle(NewAlert("car-001", "extreme_weather", 0, 0, 1))       // new reason
+	h.Handle(NewAlert("car-002", "unmarked_construction", 0, 0, 1)) // other vehicle
+	h.Handle(NewAlert("car-001", "unmarked_construction", 0, 0, 3)) // escalation
+	h.Handle(NewAlert("car-001", "unmarked_construction", 0, 0, 2)) // below the escalation
+
+	want := []struct {
+		vehicle, reason string
+		severity        int32
+		occurrences     int32
+	}{
+		{"car-001", "unmarked_construction", 1, 1},
+		{"car-001", "extreme_weather", 1, 1},
+		{"car-002", "unmarked_construction", 1, 1},
+		{"car-001", "unmarked_construction", 3, 2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("delivered %d alerts, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		a := got[i]
+		if a.VehicleID != w.vehicle || a.Reason != w.reason || a.Severity != w.severity || a.Occurrences != w.occurrences {
+			t.Errorf("alert %d = %s/%s severity %d occurrences %d, want %+v", i, a.VehicleID, a.Reason, a.Severity, a.Occurrences, w)
+		}
+	}
+}
+
+func TestRepeatWindowDisabledByDefault(t *testing.T) {
+	h := NewHandler()
+	var got []*protocol.TeleoperationAlert
+	h.Register(func(a *protocol.TeleoperationAlert) { got = append(got, a) })
+	h.Handle(NewAlert("car-001", "unmarked_construction", 0, 0, 1))
+	h.Handle(NewAlert("car-001", "unmarked_construction", 0, 0, 1))
+	if len(got) != 2 || got[0].Occurrences != 0 {
+		t.Errorf("delivered %d alerts (occurrences %d), want both untouched", len(got), got[0].Occurrences)
+	}
+}
+
+func TestRepeatWindowFlushesRepeatsWhenItCloses(t *testing.T) {
+	h := NewHandlerWithConfig(Config{RepeatWindow: 50 * time.Millisecond})
+	got := make(chan *protocol.TeleoperationAlert, 4)
+	h.Register(func(a *protocol.TeleoperationAlert) { got <- a })
+
+	for range 3 {
+		h.Handle(NewAlert("car-001", "unmarked_construction", 39.9, 116.4, 2))
+	}
+	if first := <-got; first.Occurrences != 1 {
+		t.Fatalf("first alert occurrences = %d, want 1", first.Occurrences)
+	}
+	select {
+	case a := <-got:
+		if a.Occurrences != 2 {
+			t.Errorf("flushed alert occurrences = %d, want the 2 repeats", a.Occurrences)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("suppressed repeats never reported after the window closed")
+	}
+
+	h.deliveryMu.Lock()
+	n := len(h.repeats)
+	h.deliveryMu.Unlock()
+	if n != 0 {
+		t.Errorf("%d repeat entries left after the flush, want them pruned", n)
+	}
+}
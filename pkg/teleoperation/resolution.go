@@ -0,0 +1,108 @@
+package teleoperation
+
+import (
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// defaultResolutionWindow is how long after an alert commands to its vehicle
+// are linked to it when Config.ResolutionWindow is not set.
+const defaultResolutionWindow = 10 * time.Minute
+
+// CommandRef is a command sent to a vehicle while one of its alerts was open,
+// e.g. the teleoperation_start and resume that resolved a weather alert.
+type CommandRef struct {
+	CommandID string
+	Action    string
+	SentAt    time.Time
+	// Status is the latest ack status, empty until the vehicle acks.
+	Status  string
+	AckedAt time.Time
+}
+
+// resolution links one alert to the commands that followed it.
+type resolution struct {
+	vehicleID string
+	at        time.Time // when the Handler received the alert
+	refs      []CommandRef
+}
+
+// track opens alert for linking. Alerts without an AlertID cannot be looked
+// up and are not tracked.
+func (h *Handler) track(alert *protocol.TeleoperationAlert) {
+	if alert.AlertID == "" {
+		return
+	}
+	h.resMu.Lock()
+	defer h.resMu.Unlock()
+	if _, ok := h.resolutions[alert.AlertID]; ok {
+		return
+	}
+	h.resolutions[alert.AlertID] = &resolution{vehicleID: alert.VehicleID, at: h.now()}
+	h.resOrder = append(h.resOrder, alert.AlertID)
+	if len(h.resOrder) > defaultStoreSize {
+		delete(h.resolutions, h.resOrder[0])
+		h.resOrder = h.resOrder[1:]
+	}
+}
+
+func (h *Handler) resolutionWindow() time.Duration {
+	if h.cfg.ResolutionWindow > 0 {
+		return h.cfg.ResolutionWindow
+	}
+	return defaultResolutionWindow
+}
+
+// RecordCommand links a command sent to vehicleID to every alert the vehicle
+// raised within Config.ResolutionWindow before it. The control center calls
+// it for each command it publishes.
+func (h *Handler) RecordCommand(vehicleID, commandID, action string) {
+	now := h.now()
+	since := now.Add(-h.resolutionWindow())
+	h.resMu.Lock()
+	defer h.resMu.Unlock()
+	// Newest first, stopping at the first alert outside the window.
+	for i := len(h.resOrder) - 1; i >= 0; i-- {
+		r := h.resolutions[h.resOrder[i]]
+		if r.at.Before(since) {
+			break
+		}
+		if r.vehicleID == vehicleID {
+			r.refs = append(r.refs, CommandRef{CommandID: commandID, Action: action, SentAt: now})
+		}
+	}
+}
+
+// RecordAck updates the status of commandID wherever it is linked.
+func (h *Handler) RecordAck(ack *protocol.CommandAck) {
+	now := h.now()
+	h.resMu.Lock()
+	defer h.resMu.Unlock()
+	for i := len(h.resOrder) - 1; i >= 0; i-- {
+		r := h.resolutions[h.resOrder[i]]
+		if r.vehicleID != ack.VehicleID {
+			continue
+		}
+		for j := range r.refs {
+			if r.refs[j].CommandID == ack.CommandID {
+				r.refs[j].Status = ack.Status
+				r.refs[j].AckedAt = now
+			}
+		}
+	}
+}
+
+// ResolutionOf returns the commands linked to alertID in the order they were
+// sent, or nil if none were or the alert is unknown.
+func (h *Handler) ResolutionOf(alertID string) []CommandRef {
+	h.resMu.Lock()
+	defer h.resMu.Unlock()
+	r, ok := h.resolutions[alertID]
+	if !ok || len(r.refs) == 0 {
+		return nil
+	}
+	out := make([]CommandRef, len(r.refs))
+	copy(out, r.refs)
+	return out
+}
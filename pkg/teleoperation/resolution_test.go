@@ -0,0 +1,42 @@
+package teleoperation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestResolutionLinksFollowingCommands(t *testing.T) {
+	h := NewHandlerWithConfig(Config{ResolutionWindow: time.Minute})
+	now := time.Now()
+	h.now = func() time.Time { return now }
+
+	h.Handle(&protocol.TeleoperationAlert{AlertID: "weather-1", VehicleID: "car-001", Reason: "extreme_weather", Severity: 3})
+	h.Handle(&protocol.TeleoperationAlert{AlertID: "other-1", VehicleID: "car-002", Severity: 2})
+
+	now = now.Add(10 * time.Second)
+	h.RecordCommand("car-001", "cmd-1", protocol.ActionTeleoperationStart)
+	h.RecordAck(&protocol.CommandAck{CommandID: "cmd-1", VehicleID: "car-001", Status: protocol.AckCompleted})
+	now = now.Add(20 * time.Second)
+	h.RecordCommand("car-001", "cmd-2", protocol.ActionResume)
+	now = now.Add(time.Minute) // window closed
+	h.RecordCommand("car-001", "cmd-3", protocol.ActionStop)
+
+	refs := h.ResolutionOf("weather-1")
+	if len(refs) != 2 {
+		t.Fatalf("ResolutionOf = %+v, want cmd-1 and cmd-2", refs)
+	}
+	if refs[0].CommandID != "cmd-1" || refs[0].Action != protocol.ActionTeleoperationStart || refs[0].Status != protocol.AckCompleted {
+		t.Errorf("first ref = %+v", refs[0])
+	}
+	if refs[1].CommandID != "cmd-2" || refs[1].Status != "" || !refs[1].AckedAt.IsZero() {
+		t.Errorf("second ref = %+v, want unacked resume", refs[1])
+	}
+	if refs := h.ResolutionOf("other-1"); refs != nil {
+		t.Errorf("alert of another vehicle linked to %+v", refs)
+	}
+	if refs := h.ResolutionOf("missing"); refs != nil {
+		t.Errorf("unknown alert linked to %+v", refs)
+	}
+}
@@ -0,0 +1,105 @@
+package teleoperation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// defaultStoreSize is the capacity of the MemoryStore used when
+// Config.Store is nil.
+const defaultStoreSize = 10000
+
+// AlertQuery selects stored alerts. Zero fields do not constrain the result.
+type AlertQuery struct {
+	VehicleID   string
+	From, To    time.Time // inclusive bounds on the alert Timestamp
+	MinSeverity int32
+	// Limit keeps only the newest Limit matches.
+	Limit int
+}
+
+func (q AlertQuery) matches(a *protocol.TeleoperationAlert) bool {
+	if q.VehicleID != "" && a.VehicleID != q.VehicleID {
+		return false
+	}
+	if a.Severity < q.MinSeverity {
+		return false
+	}
+	if !q.From.IsZero() && a.Timestamp < q.From.UnixMilli() {
+		return false
+	}
+	if !q.To.IsZero() && a.Timestamp > q.To.UnixMilli() {
+		return false
+	}
+	return true
+}
+
+// AlertStore persists every alert the Handler receives, e.g. for an
+// incident-review UI. Implementations must be safe for concurrent use.
+type AlertStore interface {
+	Save(alert *protocol.TeleoperationAlert) error
+	// Query returns the stored alerts matching q, oldest first.
+	Query(q AlertQuery) ([]*protocol.TeleoperationAlert, error)
+}
+
+// MemoryStore is an AlertStore keeping the most recent alerts in a ring
+// buffer. It is the Handler's default store.
+type MemoryStore struct {
+	mu     sync.Mutex
+	size   int
+	alerts []*protocol.TeleoperationAlert
+	next   int // ring write position once full
+}
+
+// NewMemoryStore returns a MemoryStore retaining up to capacity alerts
+// (default 10000 if capacity < 1).
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity < 1 {
+		capacity = defaultStoreSize
+	}
+	return &MemoryStore{size: capacity}
+}
+
+// Save stores alert, evicting the oldest alert once the store is full.
+func (m *MemoryStore) Save(alert *protocol.TeleoperationAlert) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.alerts) < m.size {
+		m.alerts = append(m.alerts, alert)
+		return nil
+	}
+	m.alerts[m.next] = alert
+	m.next = (m.next + 1) % len(m.alerts)
+	return nil
+}
+
+// Query returns the stored alerts matching q in the order they were saved.
+func (m *MemoryStore) Query(q AlertQuery) ([]*protocol.TeleoperationAlert, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []*protocol.TeleoperationAlert
+	n := len(m.alerts)
+	for i := 0; i < n; i++ {
+		a := m.alerts[(m.next+i)%n]
+		if q.matches(a) {
+			out = append(out, a)
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out, nil
+}
+
+// Store returns the store the Handler persists alerts to.
+func (h *Handler) Store() AlertStore { return h.store }
+
+// persist saves alert, logging rather than failing on a store error so
+// that delivery to operators is never held up by persistence.
+func (h *Handler) persist(alert *protocol.TeleoperationAlert) {
+	if err := h.store.Save(alert); err != nil {
+		h.log.Error("store alert", "vehicle_id", alert.VehicleID, "alert_id", alert.AlertID, "err", err)
+	}
+}
@@ -0,0 +1,81 @@
+package teleoperation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func storedReasons(t *testing.T, s AlertStore, q AlertQuery) []string {
+	t.Helper()
+	alerts, err := s.Query(q)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	reasons := make([]string, len(alerts))
+	for i, a := range alerts {
+		reasons[i] = a.Reason
+	}
+	return reasons
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHandlerPersistsAlerts(t *testing.T) {
+	h := NewHandlerWithConfig(Config{DedupWindow: time.Minute, RateLimit: 1})
+	base := time.UnixMilli(1_700_000_000_000)
+	for i, a := range []*protocol.TeleoperationAlert{
+		{AlertID: "a-1", VehicleID: "car-001", Reason: "fog", Severity: 1},
+		{AlertID: "a-1", VehicleID: "car-001", Reason: "fog", Severity: 1}, // redelivery
+		{AlertID: "a-2", VehicleID: "car-001", Reason: "construction", Severity: 2},
+		{AlertID: "a-3", VehicleID: "car-002", Reason: "collision_risk", Severity: 3},
+	} {
+		a.Timestamp = base.Add(time.Duration(i) * time.Minute).UnixMilli()
+		h.Handle(a)
+	}
+
+	// Deduplicated once, but the rate-limited alert is still stored.
+	if got := storedReasons(t, h.Store(), AlertQuery{}); !equalStrings(got, []string{"fog", "construction", "collision_risk"}) {
+		t.Errorf("stored = %v", got)
+	}
+	if got := storedReasons(t, h.Store(), AlertQuery{MinSeverity: 2}); !equalStrings(got, []string{"construction", "collision_risk"}) {
+		t.Errorf("severity >= 2 = %v", got)
+	}
+	if got := storedReasons(t, h.Store(), AlertQuery{VehicleID: "car-001"}); !equalStrings(got, []string{"fog", "construction"}) {
+		t.Errorf("car-001 = %v", got)
+	}
+	q := AlertQuery{From: base.Add(2 * time.Minute), To: base.Add(3 * time.Minute)}
+	if got := storedReasons(t, h.Store(), q); !equalStrings(got, []string{"construction", "collision_risk"}) {
+		t.Errorf("time range = %v", got)
+	}
+	q = AlertQuery{To: base.Add(time.Minute), MinSeverity: 2}
+	if got := storedReasons(t, h.Store(), q); len(got) != 0 {
+		t.Errorf("empty range = %v", got)
+	}
+}
+
+func TestMemoryStoreEvictsOldest(t *testing.T) {
+	s := NewMemoryStore(3)
+	for _, r := range []string{"a", "b", "c", "d", "e"} {
+		if err := s.Save(&protocol.TeleoperationAlert{VehicleID: "car-001", Reason: r}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	if got := storedReasons(t, s, AlertQuery{}); !equalStrings(got, []string{"c", "d", "e"}) {
+		t.Errorf("stored = %v, want [c d e]", got)
+	}
+	if got := storedReasons(t, s, AlertQuery{Limit: 2}); !equalStrings(got, []string{"d", "e"}) {
+		t.Errorf("limit 2 = %v, want [d e]", got)
+	}
+}
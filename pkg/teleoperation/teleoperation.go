@@ -7,52 +7,261 @@
 package teleoperation
 
 import (
-	"log"
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/daohu527/vlink/pkg/logging"
 	"github.com/daohu527/vlink/pkg/protocol"
 )
 
 // AlertListener is called whenever a new TeleoperationAlert is received.
 type AlertListener func(alert *protocol.TeleoperationAlert)
 
+// AlertFilter reports whether an alert should be delivered to a listener.
+type AlertFilter func(alert *protocol.TeleoperationAlert) bool
+
+// MinSeverity returns a filter accepting alerts of at least the given severity.
+func MinSeverity(severity int32) AlertFilter {
+	return func(a *protocol.TeleoperationAlert) bool { return a.Severity >= severity }
+}
+
+// InRegion returns a filter accepting alerts located inside box.
+func InRegion(box BoundingBox) AlertFilter {
+	return func(a *protocol.TeleoperationAlert) bool { return box.Contains(a.Latitude, a.Longitude) }
+}
+
+// registration is a listener together with the filter guarding it and, for
+// listeners registered on behalf of an operator, who and where they watch.
+type registration struct {
+	id       uint64
+	filter   AlertFilter
+	listener AlertListener
+	operator string
+	region   *BoundingBox // nil watches every vehicle
+}
+
+// Config tunes how a Handler delivers alerts. The zero value delivers every
+// alert immediately.
+type Config struct {
+	// DedupWindow drops an alert whose AlertID was already handled within
+	// the window, e.g. a QoS 1 redelivery. Zero disables deduplication.
+	DedupWindow time.Duration
+	// RepeatWindow suppresses repeats: once an alert is delivered, further
+	// alerts with the same VehicleID and Reason are only counted until the
+	// window has passed, e.g. while a vehicle stuck at a construction zone
+	// raises the same alert many times a second. The next one delivered
+	// after the window reports in Occurrences how many alerts it stands for;
+	// if none arrives, the last repeat is delivered when the window closes.
+	// A different Reason or a higher Severity is delivered at once. Zero
+	// disables repeat suppression.
+	RepeatWindow time.Duration
+	// ReorderWindow holds alerts for up to this long after the first one of
+	// a batch arrives and then delivers the batch oldest-first by Timestamp.
+	// Zero delivers alerts in arrival order without delay.
+	ReorderWindow time.Duration
+	// RateLimit caps how many alerts per vehicle reach listeners within
+	// RateWindow (a token bucket refilled continuously). Excess alerts are
+	// coalesced into one summary alert per window whose Reason starts with
+	// RateLimitedReason. Critical alerts (severity 3) always pass. Zero
+	// disables rate limiting.
+	RateLimit int
+	// RateWindow is the refill period of RateLimit (default 1 minute).
+	RateWindow time.Duration
+	// Store persists every alert handled, after deduplication and before
+	// rate limiting, so suppressed alerts remain reviewable. Defaults to a
+	// MemoryStore of 10000 alerts.
+	Store AlertStore
+	// Workers, when positive, makes listeners run on a pool of that many
+	// goroutines instead of the goroutine calling Handle (the MQTT callback
+	// at the control center), so a slow listener no longer stalls inbound
+	// alert processing. With more than one worker, alerts may reach
+	// listeners out of order. Call Close to stop the pool.
+	Workers int
+	// QueueDepth bounds the alerts waiting for a worker (default 256).
+	QueueDepth int
+	// DropWhenFull makes Handle drop an alert, counted by Dropped, when the
+	// queue is full; by default it waits for room.
+	DropWhenFull bool
+	// ResolutionWindow is how long after an alert the commands sent to its
+	// vehicle are linked to it (see ResolutionOf). Default 10 minutes.
+	ResolutionWindow time.Duration
+	// Logger receives the Handler's log entries. Defaults to
+	// logging.Default.
+	Logger logging.Logger
+}
+
 // Handler manages incoming teleoperation alerts.
 type Handler struct {
+	cfg      Config
+	log      logging.Logger
+	now      func() time.Time
+	store    AlertStore
+	dispatch *dispatcher // nil unless Config.Workers is set
+
 	mu        sync.RWMutex
-	listeners []AlertListener
+	listeners []registration
+	nextID    uint64 // of the next registration
+	locator   Locator
+	lastAlert map[string]*protocol.TeleoperationAlert // VehicleID -> latest delivered
+
+	deliveryMu sync.Mutex
+	seen       map[string]time.Time // AlertID -> first handled
+	buckets    map[string]*bucket   // VehicleID -> rate limit state
+	repeats    map[repeatKey]*repeatState
+	pending    []*protocol.TeleoperationAlert
+	flushTimer *time.Timer
+
+	resMu       sync.Mutex
+	resolutions map[string]*resolution // AlertID -> linked commands
+	resOrder    []string               // AlertIDs, oldest first
 }
 
 // NewHandler creates a Handler with no listeners registered.
 func NewHandler() *Handler {
-	return &Handler{}
+	return NewHandlerWithConfig(Config{})
 }
 
-// Register adds a listener that will be called for every incoming alert.
-func (h *Handler) Register(l AlertListener) {
+// NewHandlerWithConfig creates a Handler with the given delivery settings.
+func NewHandlerWithConfig(cfg Config) *Handler {
+	store := cfg.Store
+	if store == nil {
+		store = NewMemoryStore(defaultStoreSize)
+	}
+	h := &Handler{
+		store:     store,
+		cfg:       cfg,
+		log:       logging.OrDefault(cfg.Logger),
+		now:       time.Now,
+		seen:      make(map[string]time.Time),
+		buckets:   make(map[string]*bucket),
+		repeats:   make(map[repeatKey]*repeatState),
+		lastAlert: make(map[string]*protocol.TeleoperationAlert),
+
+		resolutions: make(map[string]*resolution),
+	}
+	if cfg.Workers > 0 {
+		h.dispatch = newDispatcher(cfg.Workers, cfg.QueueDepth, cfg.DropWhenFull, h.notify, h.log)
+	}
+	return h
+}
+
+// Subscription is a registered listener. Callers that never unregister may
+// ignore it.
+type Subscription struct {
+	h  *Handler
+	id uint64
+}
+
+// Remove unregisters the listener, e.g. when the dashboard it feeds
+// disconnects. Alerts already being delivered when Remove is called may
+// still reach it once; none handled afterwards do. Calling Remove again has
+// no effect.
+func (s *Subscription) Remove() {
+	h := s.h
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.listeners = append(h.listeners, l)
+	for i, r := range h.listeners {
+		if r.id != s.id {
+			continue
+		}
+		// notify iterates its own copy, so in-flight deliveries are
+		// unaffected.
+		h.listeners = slices.Delete(h.listeners, i, i+1)
+		return
+	}
+}
+
+// add registers r and returns its Subscription.
+func (h *Handler) add(r registration) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	r.id = h.nextID
+	h.listeners = append(h.listeners, r)
+	return &Subscription{h: h, id: r.id}
+}
+
+// Register adds a listener that will be called for every incoming alert.
+func (h *Handler) Register(l AlertListener) *Subscription {
+	return h.RegisterFiltered(nil, l)
+}
+
+// RegisterFiltered adds a listener that is only called for alerts accepted by
+// filter. A nil filter accepts every alert.
+func (h *Handler) RegisterFiltered(filter AlertFilter, l AlertListener) *Subscription {
+	return h.add(registration{filter: filter, listener: l})
+}
+
+// RegisterRegional adds a listener for alerts raised inside box, e.g. by a
+// regional dispatch center. Additional filters such as MinSeverity must all
+// accept the alert as well.
+func (h *Handler) RegisterRegional(box BoundingBox, l AlertListener, filters ...AlertFilter) *Subscription {
+	return h.RegisterFiltered(regional(box, filters), l)
+}
+
+// regional combines InRegion(box) with filters.
+func regional(box BoundingBox, filters []AlertFilter) AlertFilter {
+	region := InRegion(box)
+	return func(a *protocol.TeleoperationAlert) bool {
+		if !region(a) {
+			return false
+		}
+		for _, f := range filters {
+			if !f(a) {
+				return false
+			}
+		}
+		return true
+	}
 }
 
 // Handle processes an incoming alert: logs it and notifies all listeners.
-// Severity 3 (critical) is logged at a higher priority.
+// Severity 3 (critical) is logged at a higher priority. Duplicates, repeats,
+// rate limiting and reordering are handled according to the Handler's
+// Config.
 func (h *Handler) Handle(alert *protocol.TeleoperationAlert) {
+	if h.duplicate(alert) {
+		return
+	}
+	h.persist(alert)
+	h.track(alert)
+	alert, repeat := h.repeated(alert)
+	if repeat {
+		return
+	}
+	h.forward(alert)
+}
+
+// forward passes an alert that is not a repeat on to rate limiting and
+// reordering, and delivers it unless either holds it back.
+func (h *Handler) forward(alert *protocol.TeleoperationAlert) {
+	if h.limited(alert) {
+		return
+	}
+	if h.cfg.ReorderWindow > 0 {
+		h.hold(alert)
+		return
+	}
+	h.deliver(alert)
+}
+
+// deliver logs alert and notifies the listeners that accept it.
+func (h *Handler) deliver(alert *protocol.TeleoperationAlert) {
+	kv := []any{"vehicle_id", alert.VehicleID, "reason", alert.Reason, "severity", alert.Severity,
+		"lat", alert.Latitude, "lon", alert.Longitude}
 	if alert.Severity >= 3 {
-		log.Printf("[CRITICAL] teleoperation alert from vehicle %s: %s (lat=%.6f lon=%.6f)",
-			alert.VehicleID, alert.Reason, alert.Latitude, alert.Longitude)
+		h.log.Error("critical teleoperation alert", kv...)
 	} else {
-		log.Printf("[WARN] teleoperation alert from vehicle %s: %s severity=%d",
-			alert.VehicleID, alert.Reason, alert.Severity)
+		h.log.Warn("teleoperation alert", kv...)
 	}
 
-	h.mu.RLock()
-	ls := make([]AlertListener, len(h.listeners))
-	copy(ls, h.listeners)
-	h.mu.RUnlock()
-
-	for _, l := range ls {
-		l(alert)
+	h.remember(alert)
+	if h.dispatch != nil {
+		h.dispatch.dispatch(alert)
+		return
 	}
+	h.notify(alert)
 }
 
 // NewAlert is a convenience constructor for vehicle code that needs to raise
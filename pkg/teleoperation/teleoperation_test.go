@@ -1,6 +1,7 @@
 package teleoperation
 
 import (
+	"reflect"
 	"sync/atomic"
 	"testing"
 
@@ -40,6 +41,50 @@ func TestHandleMultipleListeners(t *testing.T) {
 	}
 }
 
+func TestSubscriptionRemove(t *testing.T) {
+	h := NewHandler()
+
+	var first, second int32
+	sub := h.Register(func(*protocol.TeleoperationAlert) { atomic.AddInt32(&first, 1) })
+	h.Register(func(*protocol.TeleoperationAlert) { atomic.AddInt32(&second, 1) })
+
+	sub.Remove()
+	sub.Remove() // no effect
+	h.Handle(NewAlert("car-001", "extreme_weather", 0, 0, 2))
+
+	if n := atomic.LoadInt32(&first); n != 0 {
+		t.Errorf("removed listener called %d times", n)
+	}
+	if n := atomic.LoadInt32(&second); n != 1 {
+		t.Errorf("remaining listener called %d times, want 1", n)
+	}
+}
+
+func TestSubscriptionRemoveDuringDelivery(t *testing.T) {
+	h := NewHandler()
+
+	var later *Subscription
+	var calls []string
+	h.Register(func(*protocol.TeleoperationAlert) {
+		calls = append(calls, "remover")
+		later.Remove()
+	})
+	later = h.Register(func(*protocol.TeleoperationAlert) { calls = append(calls, "removed") })
+	h.RegisterAs("alice", func(*protocol.TeleoperationAlert) { calls = append(calls, "alice") })
+
+	// The in-flight delivery still reaches the listener removed during it.
+	h.Handle(NewAlert("car-001", "extreme_weather", 0, 0, 2))
+	h.Handle(NewAlert("car-001", "sensor_failure", 0, 0, 2))
+
+	want := []string{"remover", "removed", "alice", "remover", "alice"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if w := h.WatchersOf("car-001"); !reflect.DeepEqual(w, []string{"alice"}) {
+		t.Errorf("WatchersOf = %v", w)
+	}
+}
+
 func TestHandleCriticalSeverity(t *testing.T) {
 	h := NewHandler()
 
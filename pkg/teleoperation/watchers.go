@@ -0,0 +1,81 @@
+package teleoperation
+
+import (
+	"sort"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// Locator returns the last known position of a vehicle.
+type Locator func(vehicleID string) (lat, lon float64, ok bool)
+
+// RegisterAs adds a listener for every alert on behalf of operator, who is
+// then reported by WatchersOf for every vehicle.
+func (h *Handler) RegisterAs(operator string, l AlertListener) *Subscription {
+	return h.add(registration{operator: operator, listener: l})
+}
+
+// RegisterRegionalAs is RegisterRegional on behalf of operator, who is then
+// reported by WatchersOf for vehicles located inside box.
+func (h *Handler) RegisterRegionalAs(operator string, box BoundingBox, l AlertListener, filters ...AlertFilter) *Subscription {
+	return h.add(registration{
+		filter:   regional(box, filters),
+		listener: l,
+		operator: operator,
+		region:   &box,
+	})
+}
+
+// SetLocator sets how WatchersOf finds a vehicle's position, e.g. from the
+// control center's shadow. Without a locator, or when it does not know the
+// vehicle, the position of the vehicle's most recent alert is used.
+func (h *Handler) SetLocator(fn Locator) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.locator = fn
+}
+
+// WatchersOf returns the sorted, de-duplicated operators whose listeners
+// cover vehicleID: those registered with RegisterAs, plus those registered
+// with RegisterRegionalAs whose region contains the vehicle's position.
+// Anonymous listeners are not reported.
+func (h *Handler) WatchersOf(vehicleID string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	lat, lon, located := h.locate(vehicleID)
+	seen := make(map[string]bool)
+	watchers := make([]string, 0)
+	for _, r := range h.listeners {
+		if r.operator == "" || seen[r.operator] {
+			continue
+		}
+		if r.region != nil && (!located || !r.region.Contains(lat, lon)) {
+			continue
+		}
+		seen[r.operator] = true
+		watchers = append(watchers, r.operator)
+	}
+	sort.Strings(watchers)
+	return watchers
+}
+
+// locate finds vehicleID's position. The caller must hold h.mu.
+func (h *Handler) locate(vehicleID string) (float64, float64, bool) {
+	if h.locator != nil {
+		if lat, lon, ok := h.locator(vehicleID); ok {
+			return lat, lon, true
+		}
+	}
+	if a, ok := h.lastAlert[vehicleID]; ok {
+		return a.Latitude, a.Longitude, true
+	}
+	return 0, 0, false
+}
+
+// remember records alert as the latest from its vehicle for locate.
+func (h *Handler) remember(alert *protocol.TeleoperationAlert) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastAlert[alert.VehicleID] = alert
+}
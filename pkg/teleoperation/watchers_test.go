@@ -0,0 +1,56 @@
+package teleoperation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestWatchersOfRegionalOperators(t *testing.T) {
+	h := NewHandler()
+	noop := func(*protocol.TeleoperationAlert) {}
+	beijing := BoundingBox{MinLat: 39.4, MinLon: 115.7, MaxLat: 41.1, MaxLon: 117.4}
+	shanghai := BoundingBox{MinLat: 30.7, MinLon: 120.8, MaxLat: 31.9, MaxLon: 122.0}
+
+	h.RegisterRegionalAs("bob", beijing, noop)
+	h.RegisterRegionalAs("alice", beijing, noop, MinSeverity(3))
+	h.RegisterRegionalAs("carol", shanghai, noop)
+	h.RegisterAs("supervisor", noop)
+	h.Register(noop) // anonymous: never reported
+
+	positions := map[string][2]float64{"car-001": {39.9, 116.4}, "car-002": {31.2, 121.5}}
+	h.SetLocator(func(id string) (float64, float64, bool) {
+		p, ok := positions[id]
+		return p[0], p[1], ok
+	})
+
+	if got, want := h.WatchersOf("car-001"), []string{"alice", "bob", "supervisor"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WatchersOf(car-001) = %v, want %v", got, want)
+	}
+	if got, want := h.WatchersOf("car-002"), []string{"carol", "supervisor"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WatchersOf(car-002) = %v, want %v", got, want)
+	}
+	if got, want := h.WatchersOf("car-unknown"), []string{"supervisor"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WatchersOf(car-unknown) = %v, want %v", got, want)
+	}
+}
+
+func TestWatchersOfFallsBackToLastAlert(t *testing.T) {
+	h := NewHandler()
+	var got []string
+	h.RegisterRegionalAs("bob", BoundingBox{MinLat: 39, MinLon: 116, MaxLat: 41, MaxLon: 117}, func(a *protocol.TeleoperationAlert) {
+		got = append(got, a.VehicleID)
+	})
+
+	if w := h.WatchersOf("car-001"); len(w) != 0 {
+		t.Errorf("WatchersOf before any alert = %v, want none", w)
+	}
+	h.Handle(NewAlert("car-001", "extreme_weather", 39.9, 116.4, 2))
+	if w := h.WatchersOf("car-001"); !reflect.DeepEqual(w, []string{"bob"}) {
+		t.Errorf("WatchersOf after alert = %v, want [bob]", w)
+	}
+	if len(got) != 1 {
+		t.Errorf("regional listener called %d times, want 1", len(got))
+	}
+}
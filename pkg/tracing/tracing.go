@@ -0,0 +1,42 @@
+// Package tracing follows a control command from the control center, through
+// the broker, to the vehicle and back on its acknowledgement with
+// OpenTelemetry. Span context travels in the W3C traceparent fields of
+// vlink messages, which carry no other metadata.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceParentHeader is the W3C Trace Context key of a traceparent value.
+const traceParentHeader = "traceparent"
+
+// Tracer returns the tracer called name from tp, or from the global
+// provider, a no-op until the application installs one, if tp is nil.
+func Tracer(tp trace.TracerProvider, name string) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(name)
+}
+
+// TraceParent returns the W3C traceparent of the span in ctx, or "" if ctx
+// has no valid span context.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(traceParentHeader)
+}
+
+// ContextWithTraceParent returns ctx carrying the remote span context in
+// traceParent, or ctx itself if traceParent is empty or malformed.
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{traceParentHeader: traceParent})
+}
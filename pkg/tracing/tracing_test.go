@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	v := TraceParent(trace.ContextWithSpanContext(context.Background(), sc))
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; v != want {
+		t.Fatalf("TraceParent = %q, want %q", v, want)
+	}
+	got := trace.SpanContextFromContext(ContextWithTraceParent(context.Background(), v))
+	if !got.IsRemote() || got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() {
+		t.Errorf("ContextWithTraceParent(%q) = %+v, want remote %+v", v, got, sc)
+	}
+
+	for _, bad := range []string{"", "00-abc-def-01", "00-4bf92f3577b34da6a3ce929d0e0e4736-zzzzzzzzzzzzzzzz-01"} {
+		if sc := trace.SpanContextFromContext(ContextWithTraceParent(context.Background(), bad)); sc.IsValid() {
+			t.Errorf("ContextWithTraceParent(%q) accepted a malformed value", bad)
+		}
+	}
+	if v := TraceParent(context.Background()); v != "" {
+		t.Errorf("TraceParent without a span = %q, want empty", v)
+	}
+}
+
+func TestTracerDefaultsToGlobalProvider(t *testing.T) {
+	_, span := Tracer(nil, "test").Start(context.Background(), "op")
+	defer span.End()
+	if span.IsRecording() || span.SpanContext().IsValid() {
+		t.Error("default tracer recorded a span, want the no-op global provider")
+	}
+}
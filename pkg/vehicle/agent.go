@@ -6,15 +6,25 @@ package vehicle
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/daohu527/vlink/pkg/backoff"
+	"github.com/daohu527/vlink/pkg/logging"
 	"github.com/daohu527/vlink/pkg/protocol"
 	"github.com/daohu527/vlink/pkg/security"
 	"github.com/daohu527/vlink/pkg/teleoperation"
+	"github.com/daohu527/vlink/pkg/tracing"
 )
 
 // Config holds the agent's runtime configuration.
@@ -23,66 +33,464 @@ type Config struct {
 	VehicleID string
 	// BrokerURL is the MQTT broker address (e.g. "tls://broker:8883").
 	BrokerURL string
-	// PublishHz is the state publication frequency (10–50).
+	// PublishHz is the state publication frequency (10–50, default 10). The
+	// control center may override it temporarily with set_publish_hz.
 	PublishHz float64
+	// TeleopPublishHz is the minimum state publication frequency while the
+	// vehicle is in teleoperation mode (default 50), so that a remote
+	// operator taking over after RaiseAlert sees a dense stream. The normal
+	// rate resumes when the vehicle leaves teleoperation, e.g. on a resume
+	// command. A negative value disables the boost.
+	TeleopPublishHz float64
 	// CertFile, KeyFile, CAFile are paths for mTLS authentication.
 	CertFile string
 	KeyFile  string
 	CAFile   string
+	// CertPEM, KeyPEM and CAPEM hold the same mTLS material in memory, e.g.
+	// from a mounted secret, as an alternative to the files. When all three
+	// are set they take precedence over CertFile, KeyFile and CAFile.
+	CertPEM []byte
+	KeyPEM  []byte
+	CAPEM   []byte
+	// StateQoS and AlertQoS are the MQTT QoS levels states and alerts are
+	// published at, and ControlQoS the level the agent subscribes to
+	// commands with; the broker delivers each command at the lower of that
+	// and the control center's level. Nil keeps the defaults: QoS 0 for
+	// states, which the next one supersedes within a fraction of a second,
+	// and QoS 1 for alerts and commands, which must not be lost. Set them
+	// with protocol.QoS. Connect rejects levels above 2.
+	StateQoS   *byte
+	AlertQoS   *byte
+	ControlQoS *byte
+	// CertExpiryWarning is how close to its expiry the certificate in
+	// CertFile may be before Connect and ReloadTLS log a warning. Zero means
+	// security.DefaultExpiryWarning (30 days). Metrics reports the remaining
+	// validity either way.
+	CertExpiryWarning time.Duration
+	// Username and Password authenticate with brokers that require them,
+	// alone or in addition to mTLS. The password is only sent when Username
+	// is set.
+	Username string
+	Password string
+	// InitialBackoff, MaxBackoff and JitterFraction space out attempts to
+	// reach the broker, both in Connect and after a lost connection (see
+	// backoff.Backoff). The first attempt is immediate, the second waits
+	// InitialBackoff (default 1s), and each later one twice as long, up to
+	// MaxBackoff (default 2m). JitterFraction of every wait is random
+	// (default 0.5; negative disables it) so that a fleet cut off by a
+	// broker outage does not reconnect in lockstep.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	JitterFraction float64
+	// OfflineBufferSize is the number of state snapshots retained while the
+	// broker is unreachable, from a lost connection until the next connect.
+	// They are replayed in timestamp order, marked VehicleState.Replayed,
+	// once the connection is restored. Zero disables buffering.
+	OfflineBufferSize int
+	// ManualOfflineReplay keeps buffered states across a reconnect instead
+	// of replaying them at once; call ReplayOffline to publish them, e.g.
+	// once the link has proven stable.
+	ManualOfflineReplay bool
+	// TopicPrefixes lists the topic namespaces the agent publishes under,
+	// e.g. ["v2/vehicle", "v1/vehicle"] to dual-publish during a protocol
+	// migration. Control commands are only subscribed under the first
+	// prefix. Defaults to protocol.DefaultTopicPrefix. Overlapping prefixes
+	// are rejected by Connect (see protocol.ValidatePrefixes).
+	TopicPrefixes []string
+	// TracerProvider supplies the OpenTelemetry tracer that continues the
+	// control center's trace for every command carrying a TraceParent with
+	// a span covering its handling. The ack reports that span's context
+	// back. Defaults to the global provider, a no-op until the application
+	// installs one.
+	TracerProvider trace.TracerProvider
+	// Logger receives the agent's log entries, each carrying a vehicle_id
+	// field. Defaults to logging.Default.
+	Logger logging.Logger
+	// MinPublishSeverity keeps alerts of lower severity on the vehicle: they
+	// are logged and counted in Metrics but not sent to operators. Zero
+	// publishes every alert.
+	MinPublishSeverity int32
+	// EscalateAfter publishes a below-threshold alert after its reason has
+	// been raised continuously for this long, i.e. without a gap as long
+	// or ClearAlert. Zero never escalates.
+	EscalateAfter time.Duration
+	// MonotonicTimestamps clamps every published state Timestamp to at least
+	// one millisecond after the previous one, so a backward clock step (e.g.
+	// an NTP correction) cannot make receivers drop fresh states as stale.
+	MonotonicTimestamps bool
+	// ProgressInterval is how often the latest progress of a running task
+	// (see OnTask) is republished as an in_progress ack. Default 1s.
+	ProgressInterval time.Duration
+	// LowBatteryPct raises a low_battery alert when BatteryPct drops below
+	// it. Zero disables the check.
+	LowBatteryPct float32
+	// Geofence, when set, raises a geofence_exit alert when the vehicle
+	// leaves the box.
+	Geofence *teleoperation.BoundingBox
+	// AlertPolicy, when set, is evaluated on every state the agent
+	// publishes and raises the alert it returns, switching the vehicle to
+	// teleoperation (see RaiseAlert). An alert is raised once per
+	// occurrence, not on every tick. DefaultAlertPolicy covers emergencies
+	// and failed sensors.
+	AlertPolicy AlertPolicy
+	// FirmwareVersion is reported to the control center in config reports.
+	FirmwareVersion string
+	// CoalesceWindow delays idempotent commands such as set_speed by up to
+	// this long so that a burst, e.g. from an operator dragging a slider,
+	// applies only its last command; the superseded ones are acked as such.
+	// Other actions are never delayed, and discard any command still being
+	// coalesced, so a pending set_speed cannot take effect after a stop.
+	// Zero disables coalescing.
+	CoalesceWindow time.Duration
+	// Codec encodes everything the agent publishes and decodes what it
+	// receives over MQTT. Defaults to protocol.JSONCodec; see
+	// protocol.CompatCodec for moving a fleet to protocol.ProtobufCodec.
+	Codec protocol.Codec
+	// StatePublish, AlertPublish and AckPublish choose, per message class,
+	// whether a publish waits for the broker's acknowledgement. The default,
+	// PublishSync, reports delivery errors; PublishAsync returns at once,
+	// trading them for throughput, which suits high-rate state. Acks are
+	// mostly sent from the MQTT callback delivering the command, which must
+	// not wait for the broker, so with PublishSync an ack's delivery error
+	// is logged once the broker reports it rather than waited for.
+	StatePublish PublishMode
+	AlertPublish PublishMode
+	AckPublish   PublishMode
+	// PayloadKey is the AES key shared with the control center for
+	// encrypted command payloads (see protocol.PayloadCipher). Commands
+	// whose payload fails authentication are rejected, as are unencrypted
+	// payloads unless AllowPlaintextPayloads is set while the fleet moves
+	// to encryption.
+	PayloadKey             []byte
+	AllowPlaintextPayloads bool
 }
 
+// tlsFromPEM reports whether TLS uses the in-memory PEM fields.
+func (c Config) tlsFromPEM() bool {
+	return len(c.CertPEM) > 0 && len(c.KeyPEM) > 0 && len(c.CAPEM) > 0
+}
+
+// PublishMode selects whether a publish waits for its MQTT token.
+type PublishMode int
+
+const (
+	// PublishSync waits for the token and returns its error.
+	PublishSync PublishMode = iota
+	// PublishAsync does not wait. An error is returned only if the token
+	// has already failed when Publish returns, e.g. because the client is
+	// not connected.
+	PublishAsync
+	// publishDeferred does not wait either, but logs a delivery error
+	// once the token completes.
+	publishDeferred
+)
+
 // StateProvider is a function that the agent calls each tick to obtain the
 // latest vehicle state. Implementations should return a fresh snapshot.
 type StateProvider func() *protocol.VehicleState
 
 // Agent manages the MQTT connection and state publishing loop.
 type Agent struct {
-	cfg       Config
-	client    mqtt.Client
-	alerter   *teleoperation.Handler
-	stateFn   StateProvider
+	cfg     Config
+	log     logging.Logger
+	tracer  trace.Tracer
+	client  mqtt.Client
+	alerter *teleoperation.Handler
+	stateFn StateProvider
+	topics  []protocol.Topics
+	now     func() time.Time
+	seq     atomic.Uint64
+	paused  atomic.Bool
+	lastTS  atomic.Int64 // last published state timestamp
+
+	bufMu          sync.Mutex
+	offline        []*protocol.VehicleState
+	offlineDropped uint64
+	linkLost       atomic.Bool // between onConnectionLost and onConnect
+
+	ctlMu     sync.Mutex
+	motion    motion
+	lastSpeed float32 // speed of the last published autonomous state
+
+	mode modeMachine
+
+	rateMu      sync.Mutex
+	hzOverride  float64 // set_publish_hz override; zero uses cfg.PublishHz
+	hzTeleop    float64 // floor while in teleoperation; zero when not
+	rateChanged chan struct{}
+
+	cbMu          sync.Mutex
+	providerNil   []func()
+	streamHandler StreamHandler
+	tasks         map[string]TaskHandler
+
+	taskMu  sync.Mutex
+	running map[string]context.CancelCauseFunc // command ID -> cancels its task
+
+	alertMu          sync.Mutex
+	lowAlerts        map[string]*lowSeverity
+	alertsSuppressed uint64
+	thresholds       thresholdState
+
+	coalesceMu sync.Mutex
+	coalescing map[string]*pendingCommand // action -> latest pending
+
+	dedupMu    sync.Mutex
+	recentIDs  []string                        // oldest first
+	recentAcks map[string]*protocol.CommandAck // ID -> latest ack; nil before the first
+
+	reconfMu sync.Mutex // serialises Reconfigure
+	live     atomic.Pointer[settings]
+
+	payloads *protocol.PayloadCipher // nil without Config.PayloadKey
+	keyErr   error                   // from an invalid Config.PayloadKey
+
+	tlsReload  atomic.Pointer[func() error] // set by Connect when TLS is configured
+	certExpiry atomic.Int64                 // Unix nanoseconds; zero without TLS
+
+	backoff      *backoff.Backoff
+	newClient    func(*mqtt.ClientOptions) mqtt.Client // mqtt.NewClient; replaced in tests
+	stopMu       sync.Mutex
+	stop         chan struct{} // closed by Disconnect; nil before Connect
+	reconnecting atomic.Bool
 }
 
 // New creates a new Agent. stateProvider is called each publish interval
 // to obtain the current vehicle state.
 func New(cfg Config, stateProvider StateProvider) *Agent {
-	return &Agent{
+	logger := logging.With(logging.OrDefault(cfg.Logger), "vehicle_id", cfg.VehicleID)
+	a := &Agent{
 		cfg:     cfg,
-		alerter: teleoperation.NewHandler(),
+		log:     logger,
+		tracer:  tracing.Tracer(cfg.TracerProvider, "github.com/daohu527/vlink/pkg/vehicle"),
+		alerter: teleoperation.NewHandlerWithConfig(teleoperation.Config{Logger: logger}),
 		stateFn: stateProvider,
+		topics:  protocol.TopicsFor(cfg.TopicPrefixes),
+		now:     time.Now,
+		mode:    modeMachine{current: ModeAutonomous},
+
+		rateChanged: make(chan struct{}, 1),
+		lowAlerts:   make(map[string]*lowSeverity),
+		backoff:     backoff.New(cfg.InitialBackoff, cfg.MaxBackoff, cfg.JitterFraction),
+		newClient:   mqtt.NewClient,
+	}
+	a.live.Store(settingsOf(cfg))
+	a.OnModeChange(a.teleopRate)
+	if len(cfg.PayloadKey) > 0 {
+		a.payloads, a.keyErr = protocol.NewPayloadCipher(cfg.PayloadKey)
 	}
+	return a
 }
 
-// Connect establishes the MQTT connection. When CertFile, KeyFile and CAFile
-// are set in Config, mutual TLS 1.3 authentication is used.
+// Connect is ConnectContext without a deadline: it retries until the broker
+// accepts the connection, refuses the client's credentials or certificates,
+// or Disconnect is called.
 func (a *Agent) Connect() error {
+	return a.ConnectContext(context.Background())
+}
+
+// ConnectContext establishes the MQTT connection. When CertFile, KeyFile and
+// CAFile, or CertPEM, KeyPEM and CAPEM, are set in Config, mutual TLS 1.3
+// authentication is used. Username and Password, if set, are sent as well,
+// over TLS when it is configured.
+//
+// Failed attempts are retried with backoff until one succeeds, Disconnect is
+// called, or ctx is done. The broker refusing the credentials or the client
+// certificate, or the server certificate failing verification, is not
+// retried: ConnectContext returns that error at once. When ctx is done
+// first, the attempt in flight is abandoned, the client is shut down, and
+// the returned error wraps ctx.Err(). Once connected, ctx no longer matters.
+func (a *Agent) ConnectContext(ctx context.Context) error {
+	opts, err := a.clientOptions()
+	if err != nil {
+		return err
+	}
+	a.client = a.newClient(opts)
+	stop := make(chan struct{})
+	a.stopMu.Lock()
+	a.stop = stop
+	a.stopMu.Unlock()
+
+	// abort ends the retries, and the attempt in flight, when ctx is done
+	// or Disconnect closes stop.
+	abort := make(chan struct{})
+	connected := make(chan struct{})
+	defer close(connected)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		case <-connected:
+			return
+		}
+		close(abort)
+	}()
+
+	a.backoff.Reset()
+	err = backoff.Retry(abort, a.backoff, func() error { return a.connectOnce(abort) }, a.retryFailed)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		a.abandon(stop)
+		return fmt.Errorf("vehicle agent connect: %w", ctx.Err())
+	}
+	return fmt.Errorf("vehicle agent connect: %w", err)
+}
+
+// connectOnce makes a single attempt to reach the broker, giving up with
+// backoff.ErrStopped when abort is closed first. A refusal of the client's
+// credentials or certificates is permanent: retrying cannot fix it.
+func (a *Agent) connectOnce(abort <-chan struct{}) error {
+	token := a.client.Connect()
+	select {
+	case <-token.Done():
+		err := token.Error()
+		if security.IsAuthError(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	case <-abort:
+		return backoff.ErrStopped
+	}
+}
+
+// abandon tears down the client of a ConnectContext whose context expired,
+// unless Disconnect already has.
+func (a *Agent) abandon(stop chan struct{}) {
+	a.stopMu.Lock()
+	if a.stop != stop {
+		a.stopMu.Unlock()
+		return
+	}
+	close(stop)
+	a.stop = nil
+	a.stopMu.Unlock()
+	a.client.Disconnect(0)
+}
+
+// retryFailed logs a failed attempt to reach the broker.
+func (a *Agent) retryFailed(err error, next backoff.State) {
+	a.log.Warn("connect failed", "err", err, "attempt", next.Attempt, "retry_in", next.Delay)
+}
+
+// reconnect retries the connection in the background after it was lost,
+// unless a retry is already running or the client was not created by
+// Connect.
+func (a *Agent) reconnect() {
+	a.stopMu.Lock()
+	stop := a.stop
+	a.stopMu.Unlock()
+	if stop == nil || !a.reconnecting.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer a.reconnecting.Store(false)
+		if err := backoff.Retry(stop, a.backoff, func() error { return a.connectOnce(stop) }, a.retryFailed); err != nil {
+			a.log.Error("reconnect", "err", err)
+		}
+	}()
+}
+
+// ReconnectState reports the progress of the current attempt to reach the
+// broker, e.g. for logging; it is the zero State while connected.
+func (a *Agent) ReconnectState() backoff.State {
+	return a.backoff.State()
+}
+
+// clientOptions builds the MQTT client options from Config.
+func (a *Agent) clientOptions() (*mqtt.ClientOptions, error) {
+	if err := protocol.ValidatePrefixes(a.cfg.TopicPrefixes); err != nil {
+		return nil, fmt.Errorf("vehicle agent: %w", err)
+	}
+	if a.keyErr != nil {
+		return nil, fmt.Errorf("vehicle agent: %w", a.keyErr)
+	}
+	if err := errors.Join(
+		protocol.ValidateQoS("StateQoS", a.cfg.StateQoS),
+		protocol.ValidateQoS("AlertQoS", a.cfg.AlertQoS),
+		protocol.ValidateQoS("ControlQoS", a.cfg.ControlQoS),
+	); err != nil {
+		return nil, fmt.Errorf("vehicle agent: %w", err)
+	}
 	opts := mqtt.NewClientOptions().
 		AddBroker(a.cfg.BrokerURL).
 		SetClientID(a.cfg.VehicleID).
 		SetCleanSession(false).
-		SetAutoReconnect(true).
-		SetConnectRetry(true).
-		SetConnectRetryInterval(5 * time.Second).
+		// Connect and reconnect retry with jittered backoff themselves;
+		// paho's retries are neither configurable nor jittered.
+		SetAutoReconnect(false).
+		SetConnectRetry(false).
 		SetOnConnectHandler(a.onConnect).
 		SetConnectionLostHandler(a.onConnectionLost)
+	// The broker publishes the will if the vehicle vanishes without a clean
+	// disconnect, e.g. on power or network loss.
+	opts.SetWill(a.topics[0].Status(a.cfg.VehicleID), protocol.StatusOffline, 1, true)
 
-	if a.cfg.CertFile != "" && a.cfg.KeyFile != "" && a.cfg.CAFile != "" {
-		tlsCfg, err := security.ClientTLSConfig(a.cfg.CertFile, a.cfg.KeyFile, a.cfg.CAFile)
+	switch {
+	case a.cfg.tlsFromPEM():
+		tlsCfg, err := security.TLSConfigFromPEM(a.cfg.CertPEM, a.cfg.KeyPEM, a.cfg.CAPEM, false)
 		if err != nil {
-			return fmt.Errorf("vehicle agent tls config: %w", err)
+			return nil, fmt.Errorf("vehicle agent tls config: %w", err)
+		}
+		opts.SetTLSConfig(tlsCfg)
+		a.checkCertExpiry()
+	case a.cfg.CertFile != "" && a.cfg.KeyFile != "" && a.cfg.CAFile != "":
+		tlsCfg, reload := security.ReloadableTLSConfig(a.cfg.CertFile, a.cfg.KeyFile, a.cfg.CAFile)
+		if err := reload(); err != nil {
+			return nil, fmt.Errorf("vehicle agent tls config: %w", err)
+		}
+		if u, err := url.Parse(a.cfg.BrokerURL); err == nil {
+			tlsCfg.ServerName = u.Hostname()
 		}
 		opts.SetTLSConfig(tlsCfg)
+		a.tlsReload.Store(&reload)
+		a.checkCertExpiry()
 	}
+	if a.cfg.Username != "" {
+		opts.SetUsername(a.cfg.Username)
+		opts.SetPassword(a.cfg.Password)
+	}
+	return opts, nil
+}
 
-	a.client = mqtt.NewClient(opts)
-
-	token := a.client.Connect()
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("vehicle agent connect: %w", token.Error())
+// ReloadTLS re-reads CertFile, KeyFile and CAFile, e.g. after a certificate
+// rotation, and uses them for every later TLS handshake, including automatic
+// reconnects. The current connection keeps its certificates until it is
+// re-established. If any file fails to load, the previous certificates stay
+// in use and the error is returned. ReloadTLS fails unless Connect set up TLS
+// from files; in-memory PEM cannot be re-read.
+func (a *Agent) ReloadTLS() error {
+	reload := a.tlsReload.Load()
+	if reload == nil {
+		return errors.New("vehicle agent: TLS is not loaded from files")
+	}
+	if err := (*reload)(); err != nil {
+		return fmt.Errorf("vehicle agent: %w", err)
 	}
+	a.checkCertExpiry()
+	a.log.Info("TLS certificates reloaded")
 	return nil
 }
 
+// checkCertExpiry stores the client certificate's expiry for Metrics and
+// warns within Config.CertExpiryWarning of it. A certificate whose expiry
+// cannot be read is only logged, since the keypair itself loaded.
+func (a *Agent) checkCertExpiry() {
+	var expiry time.Time
+	var err error
+	if a.cfg.tlsFromPEM() {
+		expiry, err = security.CheckExpiryPEM(a.cfg.CertPEM, a.cfg.CertExpiryWarning, a.now(), a.log)
+	} else {
+		expiry, err = security.CheckExpiry(a.cfg.CertFile, a.cfg.CertExpiryWarning, a.now(), a.log)
+	}
+	if err != nil {
+		a.log.Error("certificate expiry", "err", err)
+		return
+	}
+	a.certExpiry.Store(expiry.UnixNano())
+}
+
 // ConnectWithClient is used in tests to inject a pre-configured mqtt.Client.
 func (a *Agent) ConnectWithClient(c mqtt.Client) {
 	a.client = c
@@ -90,45 +498,64 @@ func (a *Agent) ConnectWithClient(c mqtt.Client) {
 
 // Run starts the state-publishing loop. It blocks until ctx is cancelled.
 func (a *Agent) Run(ctx context.Context) error {
-	if a.cfg.PublishHz <= 0 {
-		a.cfg.PublishHz = 10
-	}
-	interval := time.Duration(float64(time.Second) / a.cfg.PublishHz)
-	ticker := time.NewTicker(interval)
+	ticker := time.NewTicker(a.publishInterval())
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-a.rateChanged:
+			ticker.Reset(a.publishInterval())
 		case <-ticker.C:
 			if err := a.publishState(); err != nil {
-				log.Printf("vehicle %s: publish error: %v", a.cfg.VehicleID, err)
+				a.log.Error("publish state", "err", err)
 			}
 		}
 	}
 }
 
-// RaiseAlert publishes a TeleoperationAlert and switches the vehicle mode to
-// "teleoperation", increasing its heartbeat rate.
+// RaiseAlert publishes a TeleoperationAlert and switches an autonomous
+// vehicle to ModeTeleoperation, raising the publish rate to
+// Config.TeleopPublishHz until it leaves teleoperation. A manually driven
+// vehicle stays in manual.
+// Alerts below Config.MinPublishSeverity are only logged and counted unless
+// the condition persists; an escalated alert is published with severity
+// MinPublishSeverity.
 func (a *Agent) RaiseAlert(reason string, lat, lon float64, severity int32) error {
+	if a.suppressAlert(reason, severity) {
+		return nil
+	}
+	if min := a.settings().minPublishSeverity; severity < min {
+		severity = min
+	}
+	if a.Mode() == ModeAutonomous {
+		a.mode.transition(ModeTeleoperation, false)
+	}
+
 	alert := teleoperation.NewAlert(a.cfg.VehicleID, reason, lat, lon, severity)
-	alert.Timestamp = time.Now().UnixMilli()
+	alert.AlertID = protocol.NewID()
+	alert.Timestamp = a.now().UnixMilli()
 
-	data, err := protocol.Marshal(alert)
+	data, err := a.codec().Marshal(alert)
 	if err != nil {
 		return err
 	}
 
-	topic := protocol.AlertTopic(a.cfg.VehicleID)
-	token := a.client.Publish(topic, 1, false, data)
-	token.Wait()
-	return token.Error()
+	return a.publishAll(protocol.Topics.Alert, protocol.QoSOr(a.cfg.AlertQoS, 1), data, a.cfg.AlertPublish)
 }
 
 // Disconnect gracefully closes the MQTT connection.
 func (a *Agent) Disconnect() {
+	a.stopMu.Lock()
+	if a.stop != nil {
+		close(a.stop)
+		a.stop = nil
+	}
+	a.stopMu.Unlock()
 	if a.client != nil {
+		// A clean disconnect does not trigger the will, so say so ourselves.
+		a.publishStatus(a.client, protocol.StatusOffline)
 		a.client.Disconnect(250)
 	}
 }
@@ -136,44 +563,359 @@ func (a *Agent) Disconnect() {
 // --- private ---
 
 func (a *Agent) onConnect(c mqtt.Client) {
-	log.Printf("vehicle %s: connected to broker", a.cfg.VehicleID)
+	a.log.Info("connected to broker")
+	a.publishStatus(c, a.status())
 	a.subscribeControl(c)
+	a.linkLost.Store(false)
+	if !a.cfg.ManualOfflineReplay {
+		a.ReplayOffline()
+	}
+}
+
+// publishStatus publishes status, retained, to the status topic under the
+// first prefix, where the will is registered.
+func (a *Agent) publishStatus(c mqtt.Client, status string) {
+	topic := a.topics[0].Status(a.cfg.VehicleID)
+	token := c.Publish(topic, 1, true, status)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		a.log.Error("publish status", "status", status, "err", err)
+	}
 }
 
+// onConnectionLost starts buffering states and reconnecting. publish relies
+// on the linkLost flag as well as IsConnected, which clients that reconnect
+// automatically keep reporting while they do.
 func (a *Agent) onConnectionLost(_ mqtt.Client, err error) {
-	log.Printf("vehicle %s: connection lost: %v", a.cfg.VehicleID, err)
+	a.linkLost.Store(true)
+	a.log.Warn("connection lost", "err", err)
+	a.reconnect()
 }
 
+// subscribeControl subscribes to the inbound control and stream signaling
+// topics under the first prefix.
 func (a *Agent) subscribeControl(c mqtt.Client) {
-	topic := protocol.ControlTopic(a.cfg.VehicleID)
-	token := c.Subscribe(topic, 1, a.handleControl)
-	token.Wait()
-	if err := token.Error(); err != nil {
-		log.Printf("vehicle %s: subscribe %s error: %v", a.cfg.VehicleID, topic, err)
+	t := a.topics[0]
+	topics := map[string]mqtt.MessageHandler{
+		t.Control(a.cfg.VehicleID):     a.handleControl,
+		t.Stream(a.cfg.VehicleID):      a.handleStream,
+		t.ConfigQuery(a.cfg.VehicleID): a.handleConfigQuery,
+	}
+	for topic, handler := range topics {
+		qos := byte(1)
+		if topic == t.Control(a.cfg.VehicleID) {
+			qos = protocol.QoSOr(a.cfg.ControlQoS, 1)
+		}
+		token := c.Subscribe(topic, qos, handler)
+		token.Wait()
+		if err := token.Error(); err != nil {
+			a.log.Error("subscribe", "topic", topic, "err", err)
+		}
 	}
 }
 
 func (a *Agent) handleControl(_ mqtt.Client, msg mqtt.Message) {
 	cmd := &protocol.ControlCommand{}
-	if err := protocol.Unmarshal(msg.Payload(), cmd); err != nil {
-		log.Printf("vehicle %s: bad control message: %v", a.cfg.VehicleID, err)
+	if err := a.codec().Unmarshal(msg.Payload(), cmd); err != nil {
+		a.log.Error("bad control message", "topic", msg.Topic(), "err", err)
 		return
 	}
-	log.Printf("vehicle %s: received command action=%s speed=%.1f heading=%.1f",
-		a.cfg.VehicleID, cmd.Action, cmd.TargetSpeed, cmd.TargetHeading)
+	// Authenticate before deduplicating, so that a forged command cannot
+	// claim the ID of a genuine one.
+	if err := a.openPayload(cmd); err != nil {
+		a.log.Warn("rejecting command", "command_id", cmd.CommandID, "err", err)
+		if err := a.sendAck(cmd, protocol.AckRejected, err.Error()); err != nil {
+			a.log.Error("publish ack", "command_id", cmd.CommandID, "err", err)
+		}
+		return
+	}
+
+	if a.duplicate(cmd) {
+		return
+	}
+	a.log.Info("received command", "command_id", cmd.CommandID, "action", cmd.Action,
+		"speed", cmd.TargetSpeed, "heading", cmd.TargetHeading)
+
+	if cmd.TraceParent != "" {
+		ctx, span := a.tracer.Start(tracing.ContextWithTraceParent(context.Background(), cmd.TraceParent),
+			"vlink.handle_command",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("vlink.vehicle_id", a.cfg.VehicleID),
+				attribute.String("vlink.command_id", cmd.CommandID),
+				attribute.String("vlink.action", cmd.Action),
+			))
+		defer span.End()
+		// The ack continues from this span.
+		cmd.TraceParent = tracing.TraceParent(ctx)
+	}
+
+	if fn := a.taskHandler(cmd.Action); fn != nil {
+		a.dropCoalesced(cmd)
+		if err := a.sendAck(cmd, protocol.AckAccepted, ""); err != nil {
+			a.log.Error("publish ack", "command_id", cmd.CommandID, "err", err)
+		}
+		ctx, cancel := a.startTask(cmd)
+		go a.runTask(ctx, cancel, cmd, fn)
+		return
+	}
+	if a.coalesce(cmd) {
+		return
+	}
+	// Any other command overrides those still waiting to be coalesced.
+	a.dropCoalesced(cmd)
+	a.execute(cmd)
+}
+
+// execute applies cmd and acks the outcome.
+func (a *Agent) execute(cmd *protocol.ControlCommand) {
+	var status, reason string
+	if cmd.Action == protocol.ActionRequestState {
+		status, reason = a.respondState(cmd)
+	} else {
+		status, reason = a.applyCommand(cmd)
+		if status != protocol.AckRejected {
+			a.commandMode(cmd.Action)
+		}
+	}
+	if err := a.sendAck(cmd, status, reason); err != nil {
+		a.log.Error("publish ack", "command_id", cmd.CommandID, "err", err)
+	}
+}
+
+// codec returns the configured wire codec.
+func (a *Agent) codec() protocol.Codec {
+	if a.cfg.Codec == nil {
+		return protocol.JSONCodec{}
+	}
+	return a.cfg.Codec
+}
+
+// sendAck publishes a CommandAck for cmd on the vehicle's ack topic.
+func (a *Agent) sendAck(cmd *protocol.ControlCommand, status, reason string) error {
+	return a.publishAck(a.newAck(cmd, status, reason))
+}
+
+func (a *Agent) newAck(cmd *protocol.ControlCommand, status, reason string) *protocol.CommandAck {
+	return &protocol.CommandAck{
+		CommandID:   cmd.CommandID,
+		VehicleID:   a.cfg.VehicleID,
+		Status:      status,
+		Reason:      reason,
+		Timestamp:   a.now().UnixMilli(),
+		TraceParent: cmd.TraceParent,
+	}
+}
+
+func (a *Agent) publishAck(ack *protocol.CommandAck) error {
+	a.rememberAck(ack)
+	data, err := a.codec().Marshal(ack)
+	if err != nil {
+		return err
+	}
+
+	mode := a.cfg.AckPublish
+	if mode == PublishSync {
+		mode = publishDeferred
+	}
+	return a.publishAll(protocol.Topics.Ack, 1, data, mode)
 }
 
 func (a *Agent) publishState() error {
+	if a.paused.Load() {
+		return nil
+	}
+	state, err := a.provideState()
+	if errors.Is(err, errNoState) {
+		// Sensors not ready yet: skip this tick rather than publish garbage.
+		a.log.Warn("state provider returned nil, skipping tick")
+		a.cbMu.Lock()
+		ls := a.providerNil
+		a.cbMu.Unlock()
+		for _, fn := range ls {
+			fn()
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Validate before sanitizing, which would turn a NaN speed into a
+	// plausible 0.
+	if err := protocol.ValidateState(state); err != nil {
+		a.log.Error("not publishing state", "err", err)
+		return nil
+	}
+	if fields := state.Sanitize(); fields != nil {
+		a.log.Warn("state provider returned non-finite fields, sending 0", "fields", strings.Join(fields, ","))
+	}
+	a.checkThresholds(state.Latitude, state.Longitude, state.BatteryPct)
+	a.checkPolicy(state)
+	return a.publish(state)
+}
+
+// errNoState reports that the StateProvider is missing or returned nil.
+var errNoState = errors.New("state provider returned no state")
+
+// OnProviderNil registers fn to be called on every publish tick skipped
+// because the StateProvider returned nil, e.g. while sensors initialise.
+func (a *Agent) OnProviderNil(fn func()) {
+	a.cbMu.Lock()
+	defer a.cbMu.Unlock()
+	// Copy on write: publishState iterates the old slice without the lock.
+	ls := make([]func(), len(a.providerNil), len(a.providerNil)+1)
+	copy(ls, a.providerNil)
+	a.providerNil = append(ls, fn)
+}
+
+// provideState obtains a state from the StateProvider and sets its mode
+// from the agent's state machine.
+func (a *Agent) provideState() (*protocol.VehicleState, error) {
+	if a.stateFn == nil {
+		return nil, errNoState
+	}
 	state := a.stateFn()
-	state.Timestamp = time.Now().UnixMilli()
+	if state == nil {
+		return nil, errNoState
+	}
+	state.Mode = string(a.Mode())
+	return state, nil
+}
+
+// publish stamps state with the agent clock and the next sequence number and
+// sends it to the state topic.
+func (a *Agent) publish(state *protocol.VehicleState) error {
+	state.Timestamp = a.timestamp()
+	state.Seq = a.seq.Add(1)
+	if Mode(state.Mode) == ModeAutonomous {
+		a.ctlMu.Lock()
+		a.lastSpeed = state.Speed
+		a.ctlMu.Unlock()
+	}
+
+	if a.cfg.OfflineBufferSize > 0 && (a.linkLost.Load() || !a.client.IsConnected()) {
+		a.bufferOffline(state)
+		return nil
+	}
+	err := a.send(state)
+	if err != nil && a.cfg.OfflineBufferSize > 0 {
+		a.bufferOffline(state)
+	}
+	return err
+}
 
-	data, err := protocol.Marshal(state)
+// timestamp returns the agent clock in Unix milliseconds, clamped according
+// to Config.MonotonicTimestamps.
+func (a *Agent) timestamp() int64 {
+	now := a.now().UnixMilli()
+	if !a.cfg.MonotonicTimestamps {
+		return now
+	}
+	for {
+		last := a.lastTS.Load()
+		ts := now
+		if ts <= last {
+			ts = last + 1
+		}
+		if a.lastTS.CompareAndSwap(last, ts) {
+			if now < last {
+				a.log.Warn("clock went back, clamping state timestamp", "by_ms", last-now)
+			}
+			return ts
+		}
+	}
+}
+
+// send marshals state and publishes it unchanged to the state topic.
+func (a *Agent) send(state *protocol.VehicleState) error {
+	data, err := a.codec().Marshal(state)
 	if err != nil {
 		return err
 	}
 
-	topic := protocol.StateTopic(a.cfg.VehicleID)
-	token := a.client.Publish(topic, 0, false, data)
-	token.Wait()
-	return token.Error()
+	return a.publishAll(protocol.Topics.State, protocol.QoSOr(a.cfg.StateQoS, 0), data, a.cfg.StatePublish)
+}
+
+// logDelivery waits for token, a publish to topic, and logs its error.
+func (a *Agent) logDelivery(topic string, token mqtt.Token) {
+	<-token.Done()
+	if err := token.Error(); err != nil {
+		a.log.Error("publish failed", "topic", topic, "err", err)
+	}
+}
+
+// publishAll publishes data to the topic returned by topicFn under every
+// configured prefix, waiting for each token according to mode.
+func (a *Agent) publishAll(topicFn func(protocol.Topics, string) string, qos byte, data []byte, mode PublishMode) error {
+	var errs []error
+	for _, t := range a.topics {
+		topic := topicFn(t, a.cfg.VehicleID)
+		token := a.client.Publish(topic, qos, false, data)
+		switch mode {
+		case PublishAsync:
+			select {
+			case <-token.Done():
+			default:
+				continue
+			}
+		case publishDeferred:
+			select {
+			case <-token.Done():
+			default:
+				go a.logDelivery(topic, token)
+				continue
+			}
+		default:
+			token.Wait()
+		}
+		if err := token.Error(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// bufferOffline retains state for replay, evicting the oldest snapshot once
+// OfflineBufferSize is reached.
+func (a *Agent) bufferOffline(state *protocol.VehicleState) {
+	a.bufMu.Lock()
+	defer a.bufMu.Unlock()
+	if len(a.offline) >= a.cfg.OfflineBufferSize {
+		a.offline[0] = nil
+		a.offline = a.offline[1:]
+		a.offlineDropped++
+	}
+	a.offline = append(a.offline, state)
+}
+
+// ReplayOffline publishes the states buffered while offline in timestamp
+// order, marked Replayed so the control center does not mistake them for
+// live reports. States that fail to publish are kept for the next attempt.
+// It is called on reconnect unless Config.ManualOfflineReplay is set.
+func (a *Agent) ReplayOffline() {
+	a.bufMu.Lock()
+	pending := a.offline
+	a.offline = nil
+	a.bufMu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].Timestamp < pending[j].Timestamp })
+	for i, state := range pending {
+		replayed := *state
+		replayed.Replayed = true
+		if err := a.send(&replayed); err != nil {
+			a.log.Error("replay buffered state", "err", err)
+			a.bufMu.Lock()
+			a.offline = append(pending[i:], a.offline...)
+			if extra := len(a.offline) - a.cfg.OfflineBufferSize; extra > 0 {
+				a.offline = a.offline[extra:]
+				a.offlineDropped += uint64(extra)
+			}
+			a.bufMu.Unlock()
+			return
+		}
+	}
+	a.log.Info("replayed buffered states", "count", len(pending))
 }
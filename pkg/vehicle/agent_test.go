@@ -2,14 +2,28 @@ package vehicle
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/daohu527/vlink/pkg/backoff"
+	"github.com/daohu527/vlink/pkg/controlcenter"
+	"github.com/daohu527/vlink/pkg/logging"
+	"github.com/daohu527/vlink/pkg/membroker"
 	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/tracing"
 )
 
 // --- mock MQTT client ---
@@ -17,38 +31,40 @@ import (
 type mockMessage struct {
 	topic   string
 	payload []byte
+	qos     byte
 }
 
-func (m *mockMessage) Duplicate() bool       { return false }
-func (m *mockMessage) Qos() byte             { return 1 }
-func (m *mockMessage) Retained() bool        { return false }
-func (m *mockMessage) Topic() string         { return m.topic }
-func (m *mockMessage) MessageID() uint16     { return 0 }
-func (m *mockMessage) Payload() []byte       { return m.payload }
-func (m *mockMessage) Ack()                  {}
+func (m *mockMessage) Duplicate() bool   { return false }
+func (m *mockMessage) Qos() byte         { return m.qos }
+func (m *mockMessage) Retained() bool    { return false }
+func (m *mockMessage) Topic() string     { return m.topic }
+func (m *mockMessage) MessageID() uint16 { return 0 }
+func (m *mockMessage) Payload() []byte   { return m.payload }
+func (m *mockMessage) Ack()              {}
 
 type mockToken struct{}
 
-func (t *mockToken) Wait() bool                        { return true }
-func (t *mockToken) WaitTimeout(time.Duration) bool    { return true }
-func (t *mockToken) Done() <-chan struct{}              { ch := make(chan struct{}); close(ch); return ch }
-func (t *mockToken) Error() error                      { return nil }
+func (t *mockToken) Wait() bool                     { return true }
+func (t *mockToken) WaitTimeout(time.Duration) bool { return true }
+func (t *mockToken) Done() <-chan struct{}          { ch := make(chan struct{}); close(ch); return ch }
+func (t *mockToken) Error() error                   { return nil }
 
 type mockClient struct {
 	mu        sync.Mutex
 	published []mockMessage
 	handlers  map[string]mqtt.MessageHandler
+	subQoS    map[string]byte
 }
 
 func newMockClient() *mockClient {
-	return &mockClient{handlers: make(map[string]mqtt.MessageHandler)}
+	return &mockClient{handlers: make(map[string]mqtt.MessageHandler), subQoS: make(map[string]byte)}
 }
 
-func (c *mockClient) IsConnected() bool                                    { return true }
-func (c *mockClient) IsConnectionOpen() bool                               { return true }
-func (c *mockClient) Connect() mqtt.Token                                  { return &mockToken{} }
-func (c *mockClient) Disconnect(uint)                                      {}
-func (c *mockClient) Publish(topic string, _ byte, _ bool, payload interface{}) mqtt.Token {
+func (c *mockClient) IsConnected() bool      { return true }
+func (c *mockClient) IsConnectionOpen() bool { return true }
+func (c *mockClient) Connect() mqtt.Token    { return &mockToken{} }
+func (c *mockClient) Disconnect(uint)        {}
+func (c *mockClient) Publish(topic string, qos byte, _ bool, payload interface{}) mqtt.Token {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	var p []byte
@@ -58,19 +74,20 @@ func (c *mockClient) Publish(topic string, _ byte, _ bool, payload interface{})
 	case string:
 		p = []byte(v)
 	}
-	c.published = append(c.published, mockMessage{topic: topic, payload: p})
+	c.published = append(c.published, mockMessage{topic: topic, payload: p, qos: qos})
 	return &mockToken{}
 }
-func (c *mockClient) Subscribe(topic string, _ byte, h mqtt.MessageHandler) mqtt.Token {
+func (c *mockClient) Subscribe(topic string, qos byte, h mqtt.MessageHandler) mqtt.Token {
 	c.mu.Lock()
 	c.handlers[topic] = h
+	c.subQoS[topic] = qos
 	c.mu.Unlock()
 	return &mockToken{}
 }
 func (c *mockClient) SubscribeMultiple(map[string]byte, mqtt.MessageHandler) mqtt.Token {
 	return &mockToken{}
 }
-func (c *mockClient) Unsubscribe(...string) mqtt.Token  { return &mockToken{} }
+func (c *mockClient) Unsubscribe(...string) mqtt.Token     { return &mockToken{} }
 func (c *mockClient) AddRoute(string, mqtt.MessageHandler) {}
 func (c *mockClient) OptionsReader() mqtt.ClientOptionsReader {
 	return mqtt.NewClient(mqtt.NewClientOptions()).OptionsReader()
@@ -81,12 +98,12 @@ func (c *mockClient) OptionsReader() mqtt.ClientOptionsReader {
 func stateProvider(id string) StateProvider {
 	return func() *protocol.VehicleState {
 		return &protocol.VehicleState{
-			VehicleID:  id,
-			Timestamp:  time.Now().UnixMilli(),
-			Latitude:   39.9042,
-			Longitude:  116.4074,
-			Speed:      10.0,
-			Mode:       "autonomous",
+			VehicleID: id,
+			Timestamp: time.Now().UnixMilli(),
+			Latitude:  39.9042,
+			Longitude: 116.4074,
+			Speed:     10.0,
+			Mode:      "autonomous",
 		}
 	}
 }
@@ -111,6 +128,130 @@ func TestAgentPublishesState(t *testing.T) {
 	}
 }
 
+func TestAgentSkipsInvalidState(t *testing.T) {
+	heading := float32(999)
+	agent := New(Config{VehicleID: "car-001"}, func() *protocol.VehicleState {
+		s := stateProvider("car-001")()
+		s.Heading = heading
+		return s
+	})
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+	if n := len(mc.published); n != 0 {
+		t.Fatalf("published %d messages for a glitched heading, want 0", n)
+	}
+	// NaN is rejected, not sanitized to a plausible 0 first.
+	heading = float32(math.NaN())
+	if err := agent.publishState(); err != nil || len(mc.published) != 0 {
+		t.Fatalf("NaN heading: %v, published %d messages, want 0", err, len(mc.published))
+	}
+	heading = 90
+	if err := agent.publishState(); err != nil || len(mc.published) != 1 {
+		t.Errorf("valid state not published: %v, %d messages", err, len(mc.published))
+	}
+}
+
+func TestAgentLogsBadControlMessage(t *testing.T) {
+	var rec logging.Recorder
+	agent := New(Config{VehicleID: "car-001", Logger: &rec}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: []byte("{")})
+
+	e, ok := rec.Find(logging.LevelError, "bad control message")
+	if !ok {
+		t.Fatalf("no error entry for the bad control message; logged %+v", rec.Entries())
+	}
+	if e.Fields["vehicle_id"] != "car-001" {
+		t.Errorf("vehicle_id = %v, want car-001", e.Fields["vehicle_id"])
+	}
+}
+
+func TestAgentRegistersLastWill(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", BrokerURL: "tcp://localhost:1883"}, stateProvider("car-001"))
+	opts, err := agent.clientOptions()
+	if err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	if !opts.WillEnabled || opts.WillTopic != protocol.StatusTopic("car-001") ||
+		string(opts.WillPayload) != protocol.StatusOffline || opts.WillQos != 1 || !opts.WillRetained {
+		t.Errorf("will = {%v %q %q qos=%d retained=%v}, want retained offline on the status topic",
+			opts.WillEnabled, opts.WillTopic, opts.WillPayload, opts.WillQos, opts.WillRetained)
+	}
+
+	mc := newMockClient()
+	agent.onConnect(mc)
+	if len(mc.published) == 0 || mc.published[0].topic != protocol.StatusTopic("car-001") ||
+		string(mc.published[0].payload) != protocol.StatusOnline {
+		t.Errorf("first publish on connect = %+v, want online status", mc.published)
+	}
+}
+
+// pendingToken completes, with err, only when release is closed.
+type pendingToken struct {
+	release chan struct{}
+	err     error
+}
+
+func (t *pendingToken) Wait() bool { <-t.release; return true }
+func (t *pendingToken) WaitTimeout(d time.Duration) bool {
+	select {
+	case <-t.release:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+func (t *pendingToken) Done() <-chan struct{} { return t.release }
+func (t *pendingToken) Error() error          { return t.err }
+
+// stalledClient records publishes but never completes their tokens until
+// release is closed, like a broker that has stopped acknowledging.
+type stalledClient struct {
+	*mockClient
+	release chan struct{}
+}
+
+func (c *stalledClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mockClient.Publish(topic, qos, retained, payload)
+	return &pendingToken{release: c.release}
+}
+
+func TestAsyncStatePublishDoesNotWait(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", StatePublish: PublishAsync}, stateProvider("car-001"))
+	sc := &stalledClient{mockClient: newMockClient(), release: make(chan struct{})}
+	defer close(sc.release)
+	agent.ConnectWithClient(sc)
+
+	done := make(chan error, 1)
+	go func() { done <- agent.publishState() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("publishState: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("async state publish blocked on an incomplete token")
+	}
+	if n := len(sc.published); n != 1 {
+		t.Errorf("published %d messages, want 1", n)
+	}
+
+	// Alerts keep the default and still wait for the broker.
+	alertDone := make(chan error, 1)
+	go func() { alertDone <- agent.RaiseAlert("extreme_weather", 39.9, 116.4, 2) }()
+	select {
+	case <-alertDone:
+		t.Fatal("synchronous alert publish returned before its token completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
 func TestAgentStateTopicFormat(t *testing.T) {
 	cfg := Config{VehicleID: "car-001", PublishHz: 10}
 	agent := New(cfg, stateProvider("car-001"))
@@ -177,5 +318,742 @@ func TestAgentHandlesControlCommand(t *testing.T) {
 	}
 	data, _ := protocol.Marshal(cmd)
 	handler(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
-	// Verify no panic; command is logged.
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if len(mc.published) != 1 {
+		t.Fatalf("published %d messages, want 1 ack", len(mc.published))
+	}
+	if got, want := mc.published[0].topic, protocol.AckTopic("car-001"); got != want {
+		t.Errorf("topic = %q, want %q", got, want)
+	}
+	var ack protocol.CommandAck
+	if err := protocol.Unmarshal(mc.published[0].payload, &ack); err != nil {
+		t.Fatalf("decode ack: %v", err)
+	}
+	if ack.CommandID != "cmd-1" || ack.Status != protocol.AckCompleted {
+		t.Errorf("ack = %+v, want cmd-1 completed", ack)
+	}
+}
+
+func TestAgentUsesConfiguredQoS(t *testing.T) {
+	for _, tc := range []struct {
+		name                         string
+		cfg                          Config
+		state, alert, control, other byte
+	}{
+		{"defaults", Config{}, 0, 1, 1, 1},
+		{"configured", Config{StateQoS: protocol.QoS(1), AlertQoS: protocol.QoS(2), ControlQoS: protocol.QoS(2)}, 1, 2, 2, 1},
+		{"at most once", Config{AlertQoS: protocol.QoS(0), ControlQoS: protocol.QoS(0)}, 0, 0, 0, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.VehicleID = "car-001"
+			agent := New(cfg, stateProvider("car-001"))
+			mc := newMockClient()
+			agent.ConnectWithClient(mc)
+			agent.subscribeControl(mc)
+
+			if err := agent.send(stateProvider("car-001")()); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			if err := agent.RaiseAlert("obstacle", 39.9, 116.4, 2); err != nil {
+				t.Fatalf("RaiseAlert: %v", err)
+			}
+
+			mc.mu.Lock()
+			defer mc.mu.Unlock()
+			if len(mc.published) != 2 {
+				t.Fatalf("published %d messages, want 2", len(mc.published))
+			}
+			if got := mc.published[0].qos; got != tc.state {
+				t.Errorf("state QoS = %d, want %d", got, tc.state)
+			}
+			if got := mc.published[1].qos; got != tc.alert {
+				t.Errorf("alert QoS = %d, want %d", got, tc.alert)
+			}
+			for topic, qos := range mc.subQoS {
+				want := tc.other
+				if topic == protocol.ControlTopic("car-001") {
+					want = tc.control
+				}
+				if qos != want {
+					t.Errorf("subscribe %s QoS = %d, want %d", topic, qos, want)
+				}
+			}
+		})
+	}
+}
+
+func TestClientOptionsRejectsInvalidQoS(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", BrokerURL: "tcp://broker:1883", AlertQoS: protocol.QoS(3)}, stateProvider("car-001"))
+	if _, err := agent.clientOptions(); !errors.Is(err, protocol.ErrInvalidQoS) {
+		t.Errorf("clientOptions = %v, want ErrInvalidQoS", err)
+	}
+}
+
+func TestAgentNumbersPublishedStates(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	for i := 0; i < 3; i++ {
+		if err := agent.publishState(); err != nil {
+			t.Fatalf("publishState: %v", err)
+		}
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for i, m := range mc.published {
+		var s protocol.VehicleState
+		if err := json.Unmarshal(m.payload, &s); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if s.Seq != uint64(i+1) {
+			t.Errorf("message %d Seq = %d, want %d", i, s.Seq, i+1)
+		}
+	}
+}
+
+func TestOfflineBufferReplaysInTimestampOrder(t *testing.T) {
+	b := membroker.New()
+	cc := controlcenter.New(controlcenter.Config{ClientID: "cc", HistorySize: 10})
+	cc.ConnectWithClient(b.Client("cc"))
+
+	agent := New(Config{VehicleID: "car-001", OfflineBufferSize: 8}, nil)
+	car := b.Client("car-001")
+	agent.ConnectWithClient(car)
+
+	base := time.UnixMilli(1_700_000_000_000)
+	publishAt := func(offset int64) {
+		t.Helper()
+		agent.now = func() time.Time { return base.Add(time.Duration(offset) * time.Millisecond) }
+		if err := agent.publish(&protocol.VehicleState{VehicleID: "car-001", Mode: "autonomous"}); err != nil {
+			t.Fatalf("publish at +%d: %v", offset, err)
+		}
+	}
+
+	publishAt(100)
+	car.SetConnected(false)
+	publishAt(300)
+	publishAt(200) // onboard clock stepped backwards while offline
+	publishAt(400)
+	car.SetConnected(true)
+	publishAt(500) // live state reaches the center before the replay
+	agent.ReplayOffline()
+
+	ms := base.UnixMilli()
+	entry, ok := cc.Shadows().Get("car-001")
+	if !ok {
+		t.Fatal("no shadow for car-001")
+	}
+	if entry.State.Timestamp != ms+500 {
+		t.Errorf("current Timestamp = %d, want %d (replay must not regress it)", entry.State.Timestamp, ms+500)
+	}
+
+	hist, _ := cc.Shadows().History("car-001")
+	want := []int64{ms + 100, ms + 200, ms + 300, ms + 400, ms + 500}
+	if len(hist) != len(want) {
+		t.Fatalf("history has %d states, want %d", len(hist), len(want))
+	}
+	for i, s := range hist {
+		if s.Timestamp != want[i] {
+			t.Errorf("history[%d] = %d, want %d", i, s.Timestamp, want[i])
+		}
+	}
+
+	// Replayed states are published oldest first.
+	var replayed []int64
+	for _, m := range b.Messages()[2:5] {
+		var s protocol.VehicleState
+		_ = protocol.Unmarshal(m.Payload, &s)
+		replayed = append(replayed, s.Timestamp-ms)
+		if !s.Replayed {
+			t.Errorf("replayed state at +%d not marked Replayed", s.Timestamp-ms)
+		}
+	}
+	if replayed[0] != 200 || replayed[1] != 300 || replayed[2] != 400 {
+		t.Errorf("replay order = %v, want [200 300 400]", replayed)
+	}
+	// The out-of-order replay was dropped, so the live state is current.
+	if entry, _ := cc.Shadows().Get("car-001"); entry.Backfill {
+		t.Error("replayed states replaced the live shadow")
+	}
+}
+
+func TestOfflineBufferFollowsConnectionCallbacks(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", OfflineBufferSize: 4}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	states := func() []protocol.VehicleState {
+		mc.mu.Lock()
+		defer mc.mu.Unlock()
+		var out []protocol.VehicleState
+		for _, m := range mc.published {
+			if m.topic == protocol.StateTopic("car-001") {
+				var s protocol.VehicleState
+				_ = protocol.Unmarshal(m.payload, &s)
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	// The mock keeps reporting IsConnected, as paho does while reconnecting.
+	agent.onConnectionLost(mc, errors.New("network unreachable"))
+	for i := 0; i < 6; i++ {
+		if err := agent.publishState(); err != nil {
+			t.Fatalf("publishState: %v", err)
+		}
+	}
+	if n := len(states()); n != 0 {
+		t.Fatalf("%d states published while the link was down", n)
+	}
+
+	agent.onConnect(mc)
+	got := states()
+	if len(got) != 4 {
+		t.Fatalf("replayed %d states, want the last 4", len(got))
+	}
+	for i, s := range got {
+		if !s.Replayed || s.Seq != uint64(i+3) {
+			t.Errorf("replayed[%d] = seq %d replayed %v, want seq %d replayed", i, s.Seq, s.Replayed, i+3)
+		}
+	}
+
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+	if got := states(); len(got) != 5 || got[4].Replayed {
+		t.Errorf("live state after reconnect = %+v, want unmarked", got[len(got)-1])
+	}
+}
+
+func TestManualOfflineReplay(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", OfflineBufferSize: 4, ManualOfflineReplay: true}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	agent.onConnectionLost(mc, errors.New("network unreachable"))
+	_ = agent.publishState()
+	agent.onConnect(mc)
+
+	countStates := func() int {
+		mc.mu.Lock()
+		defer mc.mu.Unlock()
+		n := 0
+		for _, m := range mc.published {
+			if m.topic == protocol.StateTopic("car-001") {
+				n++
+			}
+		}
+		return n
+	}
+	if n := countStates(); n != 0 {
+		t.Fatalf("%d states replayed on reconnect, want none until ReplayOffline", n)
+	}
+	agent.ReplayOffline()
+	if n := countStates(); n != 1 {
+		t.Errorf("ReplayOffline published %d states, want 1", n)
+	}
+}
+
+func TestAgentDualPublishesDuringMigration(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", TopicPrefixes: []string{"v2/vehicle", "v1/vehicle"}}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+	agent.subscribeControl(mc)
+
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if len(mc.published) != 2 {
+		t.Fatalf("published %d messages, want 2", len(mc.published))
+	}
+	if mc.published[0].topic != "v2/vehicle/car-001/state" || mc.published[1].topic != "v1/vehicle/car-001/state" {
+		t.Errorf("topics = %q, %q", mc.published[0].topic, mc.published[1].topic)
+	}
+	if _, ok := mc.handlers["v2/vehicle/car-001/control"]; !ok {
+		t.Error("no control subscription under the primary prefix")
+	}
+	for topic := range mc.handlers {
+		if !strings.HasPrefix(topic, "v2/") {
+			t.Errorf("subscribed %s, want only the primary prefix", topic)
+		}
+	}
+}
+
+func TestCommandTraceSpansVehicleAndAck(t *testing.T) {
+	centerRec, vehicleRec := tracetest.NewSpanRecorder(), tracetest.NewSpanRecorder()
+	b := membroker.New()
+
+	srv := controlcenter.NewWithOptions(controlcenter.WithClientID("cc"),
+		controlcenter.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(centerRec))))
+	srv.ConnectWithClient(b.Client("cc"))
+	acks := make(chan *protocol.CommandAck, 1)
+	srv.OnAck(func(ack *protocol.CommandAck, _ time.Duration) { acks <- ack })
+
+	agent := NewWithOptions(stateProvider("car-001"), WithVehicleID("car-001"),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(vehicleRec))))
+	vc := b.Client("car-001")
+	agent.ConnectWithClient(vc)
+	agent.subscribeControl(vc)
+
+	// request_state completes immediately, so the ack is final.
+	if err := srv.SendControl(&protocol.ControlCommand{CommandID: "cmd-1", VehicleID: "car-001", Action: protocol.ActionRequestState}); err != nil {
+		t.Fatalf("SendControl: %v", err)
+	}
+	ack := <-acks
+
+	center, vehicle := centerRec.Ended(), vehicleRec.Ended()
+	if len(center) != 1 || len(vehicle) != 1 {
+		t.Fatalf("ended spans: center %d, vehicle %d; want 1 each", len(center), len(vehicle))
+	}
+	cs, vs := center[0].SpanContext(), vehicle[0].SpanContext()
+	if vs.TraceID() != cs.TraceID() || vehicle[0].Parent().SpanID() != cs.SpanID() {
+		t.Error("vehicle span does not continue the control-center trace")
+	}
+	if want := tracing.TraceParent(trace.ContextWithSpanContext(context.Background(), vs)); ack.TraceParent != want {
+		t.Errorf("ack TraceParent = %q, want vehicle span %q", ack.TraceParent, want)
+	}
+}
+
+func TestAgentSurvivesNilStates(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	provider := func() *protocol.VehicleState {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls <= 3 {
+			return nil // sensors not ready
+		}
+		return &protocol.VehicleState{VehicleID: "car-001"}
+	}
+	agent := New(Config{VehicleID: "car-001", PublishHz: 50}, provider)
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+	var skipped int32
+	agent.OnProviderNil(func() { atomic.AddInt32(&skipped, 1) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_ = agent.Run(ctx)
+
+	if n := atomic.LoadInt32(&skipped); n != 3 {
+		t.Errorf("OnProviderNil called %d times, want 3", n)
+	}
+	mc.mu.Lock()
+	n := len(mc.published)
+	mc.mu.Unlock()
+	if n == 0 {
+		t.Error("no state published once the provider recovered")
+	}
+}
+
+func TestStreamOfferAnswerRoundTrip(t *testing.T) {
+	b := membroker.New()
+	srv := controlcenter.New(controlcenter.Config{ClientID: "cc"})
+	srv.ConnectWithClient(b.Client("cc"))
+
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	vc := b.Client("car-001")
+	agent.ConnectWithClient(vc)
+	agent.subscribeControl(vc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Without a handler the offer is rejected.
+	if _, err := srv.OfferStream(ctx, &protocol.StreamSignal{VehicleID: "car-001", Transport: protocol.StreamRTSP}); err == nil {
+		t.Error("expected rejection without a stream handler")
+	}
+
+	agent.OnStreamOffer(func(offer *protocol.StreamSignal) (string, string, error) {
+		if offer.Transport == protocol.StreamRTSP {
+			return "", "rtsp://car-001.local:8554/front", nil
+		}
+		return "answer-sdp-for:" + offer.SDP, "", nil
+	})
+
+	answer, err := srv.OfferStream(ctx, &protocol.StreamSignal{VehicleID: "car-001", Transport: protocol.StreamWebRTC, SDP: "offer-sdp"})
+	if err != nil {
+		t.Fatalf("OfferStream: %v", err)
+	}
+	if answer.Type != protocol.StreamAnswer || answer.SDP != "answer-sdp-for:offer-sdp" || answer.VehicleID != "car-001" {
+		t.Errorf("answer = %+v", answer)
+	}
+
+	answer, err = srv.OfferStream(ctx, &protocol.StreamSignal{VehicleID: "car-001", Transport: protocol.StreamRTSP})
+	if err != nil {
+		t.Fatalf("OfferStream rtsp: %v", err)
+	}
+	if answer.URL != "rtsp://car-001.local:8554/front" {
+		t.Errorf("rtsp answer URL = %q", answer.URL)
+	}
+}
+
+func TestMonotonicTimestampsSurviveBackwardClock(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", MonotonicTimestamps: true}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	base := time.UnixMilli(1_700_000_000_000)
+	clock := []time.Duration{0, 100 * time.Millisecond, -2 * time.Second, -2 * time.Second, 200 * time.Millisecond}
+	for _, offset := range clock {
+		now := base.Add(offset)
+		agent.now = func() time.Time { return now }
+		if err := agent.publishState(); err != nil {
+			t.Fatalf("publishState: %v", err)
+		}
+	}
+
+	var prev int64
+	want := []int64{0, 100, 101, 102, 200}
+	for i, m := range mc.published {
+		var s protocol.VehicleState
+		if err := protocol.Unmarshal(m.payload, &s); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if s.Timestamp <= prev {
+			t.Errorf("state %d timestamp %d not after %d", i, s.Timestamp, prev)
+		}
+		if got := s.Timestamp - base.UnixMilli(); got != want[i] {
+			t.Errorf("state %d at +%dms, want +%dms", i, got, want[i])
+		}
+		prev = s.Timestamp
+	}
+}
+
+func TestCredentialsReachClientOptions(t *testing.T) {
+	certFile, keyFile, caFile := writeTestCerts(t)
+	agent := New(Config{
+		VehicleID: "car-001",
+		BrokerURL: "tls://broker:8883",
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		CAFile:    caFile,
+		Username:  "car-001",
+		Password:  "s3cret",
+	}, stateProvider("car-001"))
+
+	opts, err := agent.clientOptions()
+	if err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	r := mqtt.NewClient(opts).OptionsReader()
+	if r.Username() != "car-001" || r.Password() != "s3cret" {
+		t.Errorf("credentials = %q/%q, want car-001/s3cret", r.Username(), r.Password())
+	}
+	if tlsCfg := r.TLSConfig(); tlsCfg == nil || tlsCfg.GetClientCertificate == nil {
+		t.Error("TLS config lost when credentials are set")
+	}
+}
+
+func TestReloadTLS(t *testing.T) {
+	if err := New(Config{VehicleID: "car-001"}, stateProvider("car-001")).ReloadTLS(); err == nil {
+		t.Error("ReloadTLS succeeded without TLS configured")
+	}
+
+	certFile, keyFile, caFile := writeTestCerts(t)
+	agent := New(Config{
+		VehicleID: "car-001",
+		BrokerURL: "tls://broker:8883",
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		CAFile:    caFile,
+	}, stateProvider("car-001"))
+	opts, err := agent.clientOptions()
+	if err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	if got := opts.TLSConfig.ServerName; got != "broker" {
+		t.Errorf("ServerName = %q, want broker", got)
+	}
+	if err := agent.ReloadTLS(); err != nil {
+		t.Fatalf("ReloadTLS: %v", err)
+	}
+	if err := os.WriteFile(certFile, []byte("rotating"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.ReloadTLS(); err == nil {
+		t.Error("ReloadTLS accepted a corrupt certificate")
+	}
+}
+
+type errToken struct{ mockToken }
+
+func (t *errToken) Error() error { return errors.New("connection refused") }
+
+// flakyClient fails its first failures connection attempts.
+type flakyClient struct {
+	*mockClient
+	failures int
+	attempts atomic.Int32
+}
+
+func (c *flakyClient) Connect() mqtt.Token {
+	if int(c.attempts.Add(1)) <= c.failures {
+		return &errToken{}
+	}
+	return &mockToken{}
+}
+
+func TestReconnectBacksOffAfterConnectionLost(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}, stateProvider("car-001"))
+	fc := &flakyClient{mockClient: newMockClient(), failures: 3}
+	agent.ConnectWithClient(fc)
+
+	// Clients injected with ConnectWithClient reconnect on their own.
+	agent.onConnectionLost(fc, errors.New("network unreachable"))
+	time.Sleep(10 * time.Millisecond)
+	if n := fc.attempts.Load(); n != 0 {
+		t.Fatalf("reconnected an injected client %d times", n)
+	}
+
+	agent.stop = make(chan struct{})
+	defer agent.Disconnect()
+	agent.onConnectionLost(fc, errors.New("network unreachable"))
+	deadline := time.Now().Add(time.Second)
+	for fc.attempts.Load() < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := fc.attempts.Load(); n != 4 {
+		t.Fatalf("connect attempts = %d, want 4", n)
+	}
+	for agent.reconnecting.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s := agent.ReconnectState(); s.Attempt != 0 {
+		t.Errorf("ReconnectState after reconnecting = %+v, want reset", s)
+	}
+}
+
+func TestConnectRetriesUntilDisconnected(t *testing.T) {
+	agent := New(Config{
+		VehicleID:      "car-001",
+		BrokerURL:      "tcp://127.0.0.1:1",
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}, stateProvider("car-001"))
+	done := make(chan error, 1)
+	go func() { done <- agent.Connect() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for agent.ReconnectState().Attempt < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s := agent.ReconnectState(); s.Attempt < 3 || s.Delay > 5*time.Millisecond {
+		t.Errorf("ReconnectState = %+v, want attempt 3 or later within MaxBackoff", s)
+	}
+	agent.Disconnect()
+	select {
+	case err := <-done:
+		if !errors.Is(err, backoff.ErrStopped) {
+			t.Errorf("Connect = %v, want ErrStopped", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connect did not return after Disconnect")
+	}
+}
+
+// hangingToken never completes, like a connect to a broker that accepts the
+// TCP connection but never answers.
+type hangingToken struct{ mockToken }
+
+func (t *hangingToken) Wait() bool            { select {} }
+func (t *hangingToken) Done() <-chan struct{} { return nil }
+
+// hangingClient's connection attempts never complete.
+type hangingClient struct {
+	*mockClient
+	attempts     atomic.Int32
+	disconnected atomic.Bool
+}
+
+func (c *hangingClient) Connect() mqtt.Token {
+	c.attempts.Add(1)
+	return &hangingToken{}
+}
+func (c *hangingClient) Disconnect(uint) { c.disconnected.Store(true) }
+
+func TestConnectContextHonorsDeadline(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", BrokerURL: "tcp://broker:1883"}, stateProvider("car-001"))
+	hc := &hangingClient{mockClient: newMockClient()}
+	agent.newClient = func(*mqtt.ClientOptions) mqtt.Client { return hc }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := agent.ConnectContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ConnectContext = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ConnectContext returned after %v, want about 50ms", elapsed)
+	}
+	if hc.attempts.Load() != 1 || !hc.disconnected.Load() {
+		t.Errorf("attempts = %d, disconnected = %v; want the one hanging attempt torn down",
+			hc.attempts.Load(), hc.disconnected.Load())
+	}
+	if agent.stop != nil {
+		t.Error("abandoned connect left its stop channel behind")
+	}
+}
+
+func TestDisconnectAbortsHangingConnect(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", BrokerURL: "tcp://broker:1883"}, stateProvider("car-001"))
+	hc := &hangingClient{mockClient: newMockClient()}
+	agent.newClient = func(*mqtt.ClientOptions) mqtt.Client { return hc }
+
+	done := make(chan error, 1)
+	go func() { done <- agent.Connect() }()
+	deadline := time.Now().Add(time.Second)
+	for hc.attempts.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	agent.Disconnect()
+	select {
+	case err := <-done:
+		if !errors.Is(err, backoff.ErrStopped) {
+			t.Errorf("Connect = %v, want ErrStopped", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Connect did not return after Disconnect")
+	}
+}
+
+func TestClientOptionsPreferInMemoryPEM(t *testing.T) {
+	certFile, keyFile, caFile := writeTestCerts(t)
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := New(Config{
+		VehicleID: "car-001",
+		BrokerURL: "tls://broker:8883",
+		CertFile:  "/no/such/cert.pem",
+		KeyFile:   "/no/such/key.pem",
+		CAFile:    "/no/such/ca.pem",
+		CertPEM:   certPEM,
+		KeyPEM:    keyPEM,
+		CAPEM:     caPEM,
+	}, stateProvider("car-001"))
+
+	opts, err := agent.clientOptions()
+	if err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	tlsCfg := opts.TLSConfig
+	if tlsCfg == nil || len(tlsCfg.Certificates) != 1 || tlsCfg.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("TLS config not built from PEM: %+v", tlsCfg)
+	}
+	if agent.Metrics().CertValiditySeconds <= 0 {
+		t.Error("certificate validity not reported for in-memory PEM")
+	}
+	if err := agent.ReloadTLS(); err == nil {
+		t.Error("ReloadTLS succeeded for in-memory PEM")
+	}
+}
+
+func TestMixedCodecFleet(t *testing.T) {
+	b := membroker.New()
+	srv := controlcenter.New(controlcenter.Config{ClientID: "cc", Codec: protocol.CompatCodec{}})
+	srv.ConnectWithClient(b.Client("cc"))
+
+	agents := map[string]*Agent{}
+	for id, codec := range map[string]protocol.Codec{
+		"car-pb":   protocol.ProtobufCodec{},
+		"car-json": nil, // not yet migrated
+	} {
+		a := New(Config{VehicleID: id, Codec: codec}, stateProvider(id))
+		c := b.Client(id)
+		a.ConnectWithClient(c)
+		a.subscribeControl(c)
+		if err := a.publishState(); err != nil {
+			t.Fatalf("%s: publishState: %v", id, err)
+		}
+		agents[id] = a
+	}
+
+	for _, m := range b.Messages() {
+		if m.Topic == protocol.StateTopic("car-pb") && len(m.Payload) > 0 && m.Payload[0] == '{' {
+			t.Error("protobuf vehicle published JSON")
+		}
+	}
+	for id, a := range agents {
+		e, ok := srv.Shadows().Get(id)
+		if !ok || e.State.Latitude != 39.9042 || e.State.Mode != "autonomous" {
+			t.Errorf("%s shadow = %+v", id, e)
+		}
+		cmd := &protocol.ControlCommand{CommandID: "c-" + id, VehicleID: id, Action: protocol.ActionSetSpeed}
+		cmd.SetTargetSpeed(7.5)
+		if err := srv.SendControl(cmd); err != nil {
+			t.Fatalf("SendControl %s: %v", id, err)
+		}
+		if got := a.TargetSpeed(); got != 7.5 {
+			t.Errorf("%s TargetSpeed = %v, want 7.5", id, got)
+		}
+	}
+}
+
+// pendingAckClient is a mockClient whose acks stay pending on token.
+type pendingAckClient struct {
+	*mockClient
+	token *pendingToken
+}
+
+func (c *pendingAckClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	t := c.mockClient.Publish(topic, qos, retained, payload)
+	if topic == protocol.AckTopic("car-001") {
+		return c.token
+	}
+	return t
+}
+
+func TestAckDoesNotBlockTheCallback(t *testing.T) {
+	var rec logging.Recorder
+	agent := New(Config{VehicleID: "car-001", Logger: &rec}, stateProvider("car-001"))
+	token := &pendingToken{release: make(chan struct{}), err: errors.New("broker gone")}
+	mc := &pendingAckClient{mockClient: newMockClient(), token: token}
+	agent.ConnectWithClient(mc)
+
+	returned := make(chan struct{})
+	go func() {
+		sendCommand(t, agent, mc.mockClient, protocol.ActionStop)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("control callback waited for the ack publish")
+	}
+	if ack := lastAck(t, mc.mockClient); ack.Status != protocol.AckCompleted {
+		t.Errorf("ack = %+v, want completed", ack)
+	}
+
+	close(token.release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := rec.Find(logging.LevelError, "publish failed"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("logged %+v, want the failed ack publish", rec.Entries())
+		}
+		time.Sleep(time.Millisecond)
+	}
 }
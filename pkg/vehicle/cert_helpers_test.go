@@ -0,0 +1,19 @@
+package vehicle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/security/ca"
+)
+
+// writeTestCerts writes a CA and a leaf for localhost signed by it, and
+// returns the file paths.
+func writeTestCerts(t *testing.T) (certFile, keyFile, caFile string) {
+	t.Helper()
+	files, err := ca.WriteFiles(t.TempDir(), "vlink-test", []string{"localhost"}, ca.WithValidity(time.Hour))
+	if err != nil {
+		t.Fatalf("write test certs: %v", err)
+	}
+	return files.Cert, files.Key, files.CA
+}
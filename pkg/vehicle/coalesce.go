@@ -0,0 +1,88 @@
+package vehicle
+
+import (
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// coalescable lists the actions whose effect depends only on the latest
+// command, so that a newer one may replace an older one still pending.
+var coalescable = map[string]bool{
+	protocol.ActionSetSpeed:     true,
+	protocol.ActionSetPublishHz: true,
+}
+
+// pendingCommand is a coalescable command waiting for its window to close.
+type pendingCommand struct {
+	cmd   *protocol.ControlCommand
+	timer *time.Timer
+}
+
+// coalesce defers cmd for Config.CoalesceWindow if its action is
+// coalescable, superseding any command of the same action already waiting.
+// It reports whether cmd was deferred; the caller executes it otherwise.
+func (a *Agent) coalesce(cmd *protocol.ControlCommand) bool {
+	if a.cfg.CoalesceWindow <= 0 || !coalescable[cmd.Action] {
+		return false
+	}
+
+	a.coalesceMu.Lock()
+	if a.coalescing == nil {
+		a.coalescing = make(map[string]*pendingCommand)
+	}
+	var prev *protocol.ControlCommand
+	if p, waiting := a.coalescing[cmd.Action]; waiting {
+		prev, p.cmd = p.cmd, cmd
+	} else {
+		action := cmd.Action
+		a.coalescing[action] = &pendingCommand{
+			cmd:   cmd,
+			timer: time.AfterFunc(a.cfg.CoalesceWindow, func() { a.flushCoalesced(action) }),
+		}
+	}
+	a.coalesceMu.Unlock()
+
+	if prev != nil {
+		a.supersede(prev, cmd)
+	}
+	return true
+}
+
+// flushCoalesced executes the latest pending command for action. It holds
+// coalesceMu throughout so that dropCoalesced either drops the command or
+// returns only once it has been applied, never before.
+func (a *Agent) flushCoalesced(action string) {
+	a.coalesceMu.Lock()
+	defer a.coalesceMu.Unlock()
+	p := a.coalescing[action]
+	delete(a.coalescing, action)
+	if p != nil {
+		a.execute(p.cmd)
+	}
+}
+
+// dropCoalesced discards every pending coalesced command, acking each as
+// superseded by cmd. It is called before any other command runs, so that,
+// e.g., a set_speed still waiting cannot raise the target after a stop.
+func (a *Agent) dropCoalesced(cmd *protocol.ControlCommand) {
+	a.coalesceMu.Lock()
+	var dropped []*protocol.ControlCommand
+	for action, p := range a.coalescing {
+		p.timer.Stop()
+		dropped = append(dropped, p.cmd)
+		delete(a.coalescing, action)
+	}
+	a.coalesceMu.Unlock()
+
+	for _, prev := range dropped {
+		a.supersede(prev, cmd)
+	}
+}
+
+// supersede acks prev as superseded by cmd.
+func (a *Agent) supersede(prev, cmd *protocol.ControlCommand) {
+	if err := a.sendAck(prev, protocol.AckSuperseded, "superseded by "+cmd.CommandID); err != nil {
+		a.log.Error("publish ack", "command_id", prev.CommandID, "err", err)
+	}
+}
@@ -0,0 +1,89 @@
+package vehicle
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestCoalesceAppliesOnlyLatestSetSpeed(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", CoalesceWindow: 50 * time.Millisecond}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	const n = 5
+	for i := 1; i <= n; i++ {
+		data, _ := protocol.Marshal(&protocol.ControlCommand{
+			CommandID:   fmt.Sprintf("s-%d", i),
+			VehicleID:   "car-001",
+			Action:      protocol.ActionSetSpeed,
+			TargetSpeed: float32(i * 2),
+		})
+		agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+	}
+	if got := agent.TargetSpeed(); got != 0 {
+		t.Errorf("TargetSpeed = %v before the window closed, want 0", got)
+	}
+
+	acks := waitFinalAck(t, mc, fmt.Sprintf("s-%d", n))
+	if last := acks[len(acks)-1]; last.Status != protocol.AckCompleted {
+		t.Errorf("final command status = %q, want completed", last.Status)
+	}
+	if got := agent.TargetSpeed(); got != n*2 {
+		t.Errorf("TargetSpeed = %v, want %v", got, n*2)
+	}
+	for i := 1; i < n; i++ {
+		acks := acksFor(t, mc, fmt.Sprintf("s-%d", i))
+		if len(acks) != 1 || acks[0].Status != protocol.AckSuperseded {
+			t.Errorf("s-%d acks = %+v, want one superseded", i, acks)
+		}
+	}
+}
+
+func TestCoalesceBypassesNonIdempotentActions(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", CoalesceWindow: time.Hour}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	for _, id := range []string{"r-1", "r-2"} {
+		data, _ := protocol.Marshal(&protocol.ControlCommand{
+			CommandID: id, VehicleID: "car-001", Action: protocol.ActionResume,
+			TargetSpeed: 4, HasTargetSpeed: true,
+		})
+		agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+		if acks := acksFor(t, mc, id); len(acks) != 1 || acks[0].Status == protocol.AckSuperseded {
+			t.Errorf("%s acks = %+v, want one immediate ack", id, acks)
+		}
+	}
+	if got := agent.TargetSpeed(); got != 4 {
+		t.Errorf("TargetSpeed = %v, want 4", got)
+	}
+}
+
+func TestStopDropsPendingSetSpeed(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", CoalesceWindow: time.Hour}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	for _, cmd := range []*protocol.ControlCommand{
+		{CommandID: "speed", VehicleID: "car-001", Action: protocol.ActionSetSpeed, TargetSpeed: 8},
+		{CommandID: "stop", VehicleID: "car-001", Action: protocol.ActionStop},
+	} {
+		data, _ := protocol.Marshal(cmd)
+		agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+	}
+	// The window of the set_speed closes after the stop.
+	agent.flushCoalesced(protocol.ActionSetSpeed)
+
+	if got := agent.TargetSpeed(); got != 0 {
+		t.Errorf("TargetSpeed = %v after stop, want 0", got)
+	}
+	if acks := acksFor(t, mc, "speed"); len(acks) != 1 || acks[0].Status != protocol.AckSuperseded {
+		t.Errorf("set_speed acks = %+v, want one superseded", acks)
+	}
+	if acks := acksFor(t, mc, "stop"); len(acks) != 1 || acks[0].Status != protocol.AckCompleted {
+		t.Errorf("stop acks = %+v, want one completed", acks)
+	}
+}
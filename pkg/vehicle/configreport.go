@@ -0,0 +1,46 @@
+package vehicle
+
+import (
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// ConfigReport describes the settings currently in effect, as sent to the
+// control center in answer to a config query.
+func (a *Agent) ConfigReport() *protocol.ConfigReport {
+	s := a.settings()
+	r := &protocol.ConfigReport{
+		VehicleID:          a.cfg.VehicleID,
+		Timestamp:          a.now().UnixMilli(),
+		FirmwareVersion:    a.cfg.FirmwareVersion,
+		PublishHz:          a.PublishHz(),
+		MinPublishSeverity: s.minPublishSeverity,
+		EscalateAfterMs:    s.escalateAfter.Milliseconds(),
+		LowBatteryPct:      s.lowBatteryPct,
+		Mode:               string(a.Mode()),
+		Paused:             a.Paused(),
+	}
+	if g := s.geofence; g != nil {
+		r.Geofence = &protocol.GeofenceSummary{MinLat: g.MinLat, MinLon: g.MinLon, MaxLat: g.MaxLat, MaxLon: g.MaxLon}
+	}
+	return r
+}
+
+func (a *Agent) handleConfigQuery(_ mqtt.Client, msg mqtt.Message) {
+	q := &protocol.ConfigQuery{}
+	if err := a.codec().Unmarshal(msg.Payload(), q); err != nil {
+		a.log.Error("bad config query", "err", err)
+		return
+	}
+	report := a.ConfigReport()
+	report.QueryID = q.QueryID
+	data, err := a.codec().Marshal(report)
+	if err != nil {
+		a.log.Error("encode config report", "err", err)
+		return
+	}
+	if err := a.publishAll(protocol.Topics.Config, 1, data, PublishSync); err != nil {
+		a.log.Error("publish config report", "query_id", q.QueryID, "err", err)
+	}
+}
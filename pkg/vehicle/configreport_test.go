@@ -0,0 +1,51 @@
+package vehicle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/controlcenter"
+	"github.com/daohu527/vlink/pkg/membroker"
+	"github.com/daohu527/vlink/pkg/teleoperation"
+)
+
+func TestConfigQueryReturnsCurrentSettings(t *testing.T) {
+	b := membroker.New()
+	srv := controlcenter.New(controlcenter.Config{ClientID: "cc"})
+	srv.ConnectWithClient(b.Client("cc"))
+
+	fence := &teleoperation.BoundingBox{MinLat: 39, MinLon: 116, MaxLat: 41, MaxLon: 117}
+	agent := New(Config{
+		VehicleID:          "car-001",
+		PublishHz:          20,
+		MinPublishSeverity: 2,
+		LowBatteryPct:      15,
+		Geofence:           fence,
+		FirmwareVersion:    "2.4.1",
+	}, stateProvider("car-001"))
+	vc := b.Client("car-001")
+	agent.ConnectWithClient(vc)
+	agent.subscribeControl(vc)
+
+	hz := 40.0
+	if err := agent.Reconfigure(ConfigUpdate{PublishHz: &hz}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+
+	report, err := srv.QueryConfig("car-001", time.Second)
+	if err != nil {
+		t.Fatalf("QueryConfig: %v", err)
+	}
+	if report.VehicleID != "car-001" || report.FirmwareVersion != "2.4.1" {
+		t.Errorf("report = %+v", report)
+	}
+	if report.PublishHz != 40 || report.MinPublishSeverity != 2 || report.LowBatteryPct != 15 {
+		t.Errorf("report settings = %+v, want the reconfigured rate and thresholds", report)
+	}
+	if g := report.Geofence; g == nil || g.MinLat != 39 || g.MaxLon != 117 {
+		t.Errorf("geofence = %+v", g)
+	}
+	if report.Mode != string(ModeAutonomous) {
+		t.Errorf("mode = %q", report.Mode)
+	}
+}
@@ -0,0 +1,99 @@
+package vehicle
+
+import (
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// motion is the speed the control center has asked the vehicle to hold.
+type motion struct {
+	target float32 // current commanded speed, m/s
+	cruise float32 // autonomous speed to restore on an unset resume
+}
+
+// TargetSpeed returns the speed most recently commanded by the control
+// center, in m/s.
+func (a *Agent) TargetSpeed() float32 {
+	a.ctlMu.Lock()
+	defer a.ctlMu.Unlock()
+	return a.motion.target
+}
+
+// applyCommand executes cmd against the agent and returns the ack status and
+// reason to report back. A command applied here in full is completed; one
+// only accepted awaits a TaskHandler or the vehicle's own planner.
+func (a *Agent) applyCommand(cmd *protocol.ControlCommand) (string, string) {
+	a.ctlMu.Lock()
+	defer a.ctlMu.Unlock()
+
+	switch cmd.Action {
+	case protocol.ActionStop:
+		if a.lastSpeed > 0 {
+			a.motion.cruise = a.lastSpeed
+		} else if a.motion.target > 0 {
+			a.motion.cruise = a.motion.target
+		}
+		a.motion.target = 0
+	case protocol.ActionResume:
+		if !cmd.HasTargetSpeed {
+			// Unset target: resume the prior autonomous speed.
+			a.motion.target = a.motion.cruise
+			break
+		}
+		if cmd.TargetSpeed < 0 {
+			return protocol.AckRejected, "negative target speed"
+		}
+		// Explicit target; 0 means hold the stop.
+		a.motion.target = cmd.TargetSpeed
+		if cmd.TargetSpeed > 0 {
+			a.motion.cruise = cmd.TargetSpeed
+		}
+	case protocol.ActionSetSpeed:
+		if cmd.TargetSpeed < 0 {
+			return protocol.AckRejected, "negative target speed"
+		}
+		a.motion.target = cmd.TargetSpeed
+		if cmd.TargetSpeed > 0 {
+			a.motion.cruise = cmd.TargetSpeed
+		}
+		return protocol.AckCompleted, ""
+	case protocol.ActionSetPublishHz:
+		return a.setPublishHz(cmd.Payload)
+	case protocol.ActionResetPublishHz:
+		a.overridePublishHz(0)
+		return protocol.AckCompleted, ""
+	case protocol.ActionFollowTrajectory:
+		return a.followTrajectory(cmd)
+	case protocol.ActionCancel:
+		return a.cancelTask(cmd)
+	}
+	return protocol.AckCompleted, ""
+}
+
+// followTrajectory handles ActionFollowTrajectory. The agent only checks the
+// path; following it is up to the vehicle's planner, e.g. through a
+// TaskHandler registered for the action.
+func (a *Agent) followTrajectory(cmd *protocol.ControlCommand) (string, string) {
+	t, err := cmd.UnmarshalTrajectory()
+	if err != nil {
+		return protocol.AckRejected, err.Error()
+	}
+	a.log.Info("trajectory received", "command_id", cmd.CommandID, "waypoints", len(t.Waypoints))
+	return protocol.AckAccepted, ""
+}
+
+// respondState publishes a fresh state tagged with the CommandID of an
+// ActionRequestState command.
+func (a *Agent) respondState(cmd *protocol.ControlCommand) (string, string) {
+	if a.stateFn == nil {
+		return protocol.AckRejected, "no state provider"
+	}
+	state, err := a.provideState()
+	if err != nil {
+		return protocol.AckRejected, err.Error()
+	}
+	state.RequestID = cmd.CommandID
+	if err := a.publish(state); err != nil {
+		return protocol.AckRejected, err.Error()
+	}
+	return protocol.AckCompleted, ""
+}
@@ -0,0 +1,108 @@
+package vehicle
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestResumeWithUnsetSpeedRestoresPriorSpeed(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	agent.ConnectWithClient(newMockClient())
+
+	// stateProvider reports 10 m/s in autonomous mode.
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+	agent.applyCommand(&protocol.ControlCommand{Action: protocol.ActionStop})
+	if got := agent.TargetSpeed(); got != 0 {
+		t.Fatalf("TargetSpeed after stop = %v, want 0", got)
+	}
+
+	status, _ := agent.applyCommand(&protocol.ControlCommand{Action: protocol.ActionResume})
+	if status != protocol.AckCompleted {
+		t.Fatalf("status = %q, want completed", status)
+	}
+	if got := agent.TargetSpeed(); got != 10 {
+		t.Errorf("TargetSpeed after unset resume = %v, want prior speed 10", got)
+	}
+}
+
+func TestResumeWithExplicitZeroHoldsStop(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	agent.ConnectWithClient(newMockClient())
+
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+	agent.applyCommand(&protocol.ControlCommand{Action: protocol.ActionStop})
+
+	cmd := &protocol.ControlCommand{Action: protocol.ActionResume}
+	cmd.SetTargetSpeed(0)
+	agent.applyCommand(cmd)
+	if got := agent.TargetSpeed(); got != 0 {
+		t.Errorf("TargetSpeed after explicit-zero resume = %v, want 0", got)
+	}
+
+	cmd = &protocol.ControlCommand{Action: protocol.ActionResume}
+	cmd.SetTargetSpeed(6)
+	agent.applyCommand(cmd)
+	if got := agent.TargetSpeed(); got != 6 {
+		t.Errorf("TargetSpeed after explicit resume = %v, want 6", got)
+	}
+}
+
+func TestResumeRejectsNegativeSpeed(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+
+	cmd := &protocol.ControlCommand{Action: protocol.ActionResume}
+	cmd.SetTargetSpeed(-1)
+	if status, _ := agent.applyCommand(cmd); status != protocol.AckRejected {
+		t.Errorf("status = %q, want rejected", status)
+	}
+}
+
+func TestRequestStatePublishesTaggedState(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	status, _ := agent.respondState(&protocol.ControlCommand{CommandID: "req-1", Action: protocol.ActionRequestState})
+	if status != protocol.AckCompleted {
+		t.Fatalf("status = %q, want completed", status)
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if len(mc.published) != 1 || mc.published[0].topic != protocol.StateTopic("car-001") {
+		t.Fatalf("published = %v, want one state", mc.published)
+	}
+	var s protocol.VehicleState
+	if err := protocol.Unmarshal(mc.published[0].payload, &s); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if s.RequestID != "req-1" {
+		t.Errorf("RequestID = %q, want req-1", s.RequestID)
+	}
+}
+
+func TestFollowTrajectoryValidatesPath(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+
+	cmd := &protocol.ControlCommand{CommandID: "traj-1"}
+	if err := cmd.MarshalTrajectory(&protocol.Trajectory{Waypoints: []protocol.Waypoint{
+		{Latitude: 39.9042, Longitude: 116.4074, TargetSpeed: 3, ETAOffset: 0},
+		{Latitude: 39.9045, Longitude: 116.4080, TargetSpeed: 0, ETAOffset: 5000},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if status, reason := agent.applyCommand(cmd); status != protocol.AckAccepted {
+		t.Errorf("status = %q (%s), want accepted", status, reason)
+	}
+
+	slices.Reverse(cmd.Trajectory.Waypoints)
+	if status, _ := agent.applyCommand(cmd); status != protocol.AckRejected {
+		t.Errorf("status for non-monotonic ETAs = %q, want rejected", status)
+	}
+}
@@ -0,0 +1,56 @@
+package vehicle
+
+import (
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// recentCommandIDs bounds how many command IDs the agent remembers to
+// recognise a command delivered twice.
+const recentCommandIDs = 256
+
+// duplicate reports whether a command with cmd's ID was already received,
+// recording the ID otherwise. QoS 1 redelivery and the control center's
+// CommandQueue both resend commands, and a stop or a trajectory must not be
+// executed twice. A duplicate is answered with the latest ack sent for the
+// original, if any, so the sender stops retrying. Commands without an ID
+// are never duplicates.
+func (a *Agent) duplicate(cmd *protocol.ControlCommand) bool {
+	if cmd.CommandID == "" {
+		return false
+	}
+	a.dedupMu.Lock()
+	if a.recentAcks == nil {
+		a.recentAcks = make(map[string]*protocol.CommandAck)
+	}
+	ack, seen := a.recentAcks[cmd.CommandID]
+	if !seen {
+		if len(a.recentIDs) == recentCommandIDs {
+			delete(a.recentAcks, a.recentIDs[0])
+			a.recentIDs = a.recentIDs[1:]
+		}
+		a.recentIDs = append(a.recentIDs, cmd.CommandID)
+		a.recentAcks[cmd.CommandID] = nil
+	}
+	a.dedupMu.Unlock()
+	if !seen {
+		return false
+	}
+
+	a.log.Info("ignoring duplicate command", "command_id", cmd.CommandID)
+	if ack != nil {
+		if err := a.publishAck(ack); err != nil {
+			a.log.Error("publish ack", "command_id", cmd.CommandID, "err", err)
+		}
+	}
+	return true
+}
+
+// rememberAck records ack as the latest answer to a recently received
+// command.
+func (a *Agent) rememberAck(ack *protocol.CommandAck) {
+	a.dedupMu.Lock()
+	defer a.dedupMu.Unlock()
+	if _, ok := a.recentAcks[ack.CommandID]; ok {
+		a.recentAcks[ack.CommandID] = ack
+	}
+}
@@ -0,0 +1,55 @@
+package vehicle
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestDuplicateCommandIsAckedNotExecuted(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	send := func(id string, speed float32) {
+		data, _ := protocol.Marshal(&protocol.ControlCommand{
+			CommandID:   id,
+			VehicleID:   "car-001",
+			Action:      protocol.ActionSetSpeed,
+			TargetSpeed: speed,
+		})
+		agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+	}
+
+	send("d-1", 5)
+	send("d-1", 9) // a resend must not apply twice, even if altered
+	if got := agent.TargetSpeed(); got != 5 {
+		t.Errorf("TargetSpeed = %v, want 5 from the first delivery", got)
+	}
+	acks := acksFor(t, mc, "d-1")
+	if len(acks) != 2 || acks[0].Status != protocol.AckCompleted || acks[1].Status != protocol.AckCompleted {
+		t.Errorf("acks = %+v, want the completed ack repeated", acks)
+	}
+
+	send("", 7)
+	send("", 8)
+	if got := agent.TargetSpeed(); got != 8 {
+		t.Errorf("TargetSpeed = %v, want 8: commands without an ID are never duplicates", got)
+	}
+}
+
+func TestDuplicateWindowIsBounded(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	cmd := &protocol.ControlCommand{CommandID: "first"}
+	agent.duplicate(cmd)
+	for i := range recentCommandIDs {
+		agent.duplicate(&protocol.ControlCommand{CommandID: fmt.Sprintf("id-%d", i)})
+	}
+	if agent.duplicate(cmd) {
+		t.Error("the oldest ID was still remembered past recentCommandIDs")
+	}
+	if len(agent.recentIDs) != recentCommandIDs {
+		t.Errorf("remembering %d IDs, want %d", len(agent.recentIDs), recentCommandIDs)
+	}
+}
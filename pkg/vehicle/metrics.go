@@ -0,0 +1,62 @@
+package vehicle
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Metrics is a point-in-time view of the agent's internal buffers.
+type Metrics struct {
+	// OfflineBuffered is the number of states waiting for replay.
+	OfflineBuffered int `json:"offline_buffered"`
+	// OfflineDropped counts states evicted from the full offline buffer.
+	OfflineDropped uint64 `json:"offline_dropped"`
+	// Published is the number of states numbered for publication so far.
+	Published uint64 `json:"published"`
+	// AlertsSuppressed counts alerts kept local by MinPublishSeverity.
+	AlertsSuppressed uint64 `json:"alerts_suppressed"`
+	// Paused is true while periodic publishing is paused.
+	Paused bool `json:"paused"`
+	// CertValiditySeconds is how long the TLS certificate remains valid,
+	// negative once it has expired; see Config.CertExpiryWarning. It is
+	// zero without TLS.
+	CertValiditySeconds float64 `json:"cert_validity_seconds,omitempty"`
+}
+
+// Metrics returns the current buffer gauges and counters.
+func (a *Agent) Metrics() Metrics {
+	a.alertMu.Lock()
+	suppressed := a.alertsSuppressed
+	a.alertMu.Unlock()
+
+	a.bufMu.Lock()
+	defer a.bufMu.Unlock()
+	return Metrics{
+		OfflineBuffered:     len(a.offline),
+		OfflineDropped:      a.offlineDropped,
+		Published:           a.seq.Load(),
+		AlertsSuppressed:    suppressed,
+		Paused:              a.paused.Load(),
+		CertValiditySeconds: a.certValidity(),
+	}
+}
+
+// certValidity returns the seconds left before the certificate expires, or
+// zero when none was loaded.
+func (a *Agent) certValidity() float64 {
+	expiry := a.certExpiry.Load()
+	if expiry == 0 {
+		return 0
+	}
+	return time.Unix(0, expiry).Sub(a.now()).Seconds()
+}
+
+// DebugHandler returns an http.Handler that serves Metrics as JSON, suitable
+// for mounting at /debug/vlink.
+func (a *Agent) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(a.Metrics())
+	})
+}
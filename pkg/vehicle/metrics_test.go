@@ -0,0 +1,71 @@
+package vehicle
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/membroker"
+	"github.com/daohu527/vlink/pkg/security"
+)
+
+func TestMetricsReflectOfflineBuffer(t *testing.T) {
+	b := membroker.New()
+	car := b.Client("car-001")
+	agent := New(Config{VehicleID: "car-001", OfflineBufferSize: 2}, stateProvider("car-001"))
+	agent.ConnectWithClient(car)
+
+	car.SetConnected(false)
+	for i := 0; i < 3; i++ {
+		if err := agent.publishState(); err != nil {
+			t.Fatalf("publishState: %v", err)
+		}
+	}
+
+	m := agent.Metrics()
+	if m.OfflineBuffered != 2 || m.OfflineDropped != 1 || m.Published != 3 {
+		t.Errorf("Metrics = %+v, want {OfflineBuffered:2 OfflineDropped:1 Published:3}", m)
+	}
+
+	rec := httptest.NewRecorder()
+	agent.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vlink", nil))
+	var got Metrics
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode debug response: %v", err)
+	}
+	if got != m {
+		t.Errorf("debug handler = %+v, want %+v", got, m)
+	}
+}
+
+func TestMetricsReportCertValidity(t *testing.T) {
+	if got := New(Config{VehicleID: "car-001"}, stateProvider("car-001")).Metrics().CertValiditySeconds; got != 0 {
+		t.Errorf("CertValiditySeconds without TLS = %v, want 0", got)
+	}
+
+	certFile, keyFile, caFile := writeTestCerts(t)
+	expiry, err := security.CertExpiry(certFile)
+	if err != nil {
+		t.Fatalf("CertExpiry: %v", err)
+	}
+	agent := New(Config{
+		VehicleID: "car-001",
+		BrokerURL: "tls://broker:8883",
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		CAFile:    caFile,
+	}, stateProvider("car-001"))
+	now := expiry.Add(-10 * time.Minute)
+	agent.now = func() time.Time { return now }
+	if _, err := agent.clientOptions(); err != nil {
+		t.Fatalf("clientOptions: %v", err)
+	}
+	if got := agent.Metrics().CertValiditySeconds; got != 600 {
+		t.Errorf("CertValiditySeconds = %v, want 600", got)
+	}
+	now = expiry.Add(time.Minute)
+	if got := agent.Metrics().CertValiditySeconds; got != -60 {
+		t.Errorf("CertValiditySeconds after expiry = %v, want -60", got)
+	}
+}
@@ -0,0 +1,116 @@
+package vehicle
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// Mode is the vehicle's driving mode as published in VehicleState.Mode.
+type Mode string
+
+// Driving modes.
+const (
+	ModeAutonomous    Mode = protocol.ModeAutonomous
+	ModeManual        Mode = protocol.ModeManual
+	ModeTeleoperation Mode = protocol.ModeTeleoperation
+)
+
+// ErrInvalidTransition is returned by SetMode for a mode change that requires
+// an explicit command from the control center.
+var ErrInvalidTransition = errors.New("vehicle: invalid mode transition")
+
+// ModeChangeFunc observes a mode transition.
+type ModeChangeFunc func(from, to Mode)
+
+// localTransitions lists the mode changes the vehicle may make on its own
+// (SetMode, RaiseAlert). A safety driver can always take over, and the
+// vehicle can hand itself to a remote operator, but leaving manual or
+// teleoperation for autonomous driving, or handing a manually driven vehicle
+// to an operator, needs an explicit control command.
+var localTransitions = map[Mode][]Mode{
+	ModeAutonomous:    {ModeManual, ModeTeleoperation},
+	ModeTeleoperation: {ModeManual},
+	ModeManual:        {},
+}
+
+// modeMachine tracks the current mode and enforces valid transitions.
+type modeMachine struct {
+	mu        sync.Mutex
+	current   Mode
+	listeners []ModeChangeFunc
+}
+
+// transition moves the machine to `to`. Explicit transitions, requested by a
+// control command, are always allowed; local ones must be listed in
+// localTransitions. Listeners run after the lock is released.
+func (m *modeMachine) transition(to Mode, explicit bool) error {
+	m.mu.Lock()
+	from := m.current
+	if from == to {
+		m.mu.Unlock()
+		return nil
+	}
+	if !explicit && !allowed(from, to) {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	m.current = to
+	ls := m.listeners
+	m.mu.Unlock()
+
+	for _, fn := range ls {
+		fn(from, to)
+	}
+	return nil
+}
+
+func allowed(from, to Mode) bool {
+	for _, m := range localTransitions[from] {
+		if m == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Mode returns the vehicle's current driving mode. Agents start autonomous.
+func (a *Agent) Mode() Mode {
+	a.mode.mu.Lock()
+	defer a.mode.mu.Unlock()
+	return a.mode.current
+}
+
+// SetMode requests a local mode change, e.g. when the safety driver takes
+// over. It returns ErrInvalidTransition for changes that require a control
+// command (see protocol.ActionResume and protocol.ActionTeleoperationStart).
+func (a *Agent) SetMode(to Mode) error {
+	switch to {
+	case ModeAutonomous, ModeManual, ModeTeleoperation:
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidTransition, to)
+	}
+	return a.mode.transition(to, false)
+}
+
+// OnModeChange registers fn to be called after every mode transition.
+func (a *Agent) OnModeChange(fn ModeChangeFunc) {
+	a.mode.mu.Lock()
+	defer a.mode.mu.Unlock()
+	// Copy on write: transition iterates the old slice without the lock.
+	ls := make([]ModeChangeFunc, len(a.mode.listeners), len(a.mode.listeners)+1)
+	copy(ls, a.mode.listeners)
+	a.mode.listeners = append(ls, fn)
+}
+
+// commandMode applies the mode change implied by a control command action.
+func (a *Agent) commandMode(action string) {
+	switch action {
+	case protocol.ActionResume:
+		a.mode.transition(ModeAutonomous, true)
+	case protocol.ActionTeleoperationStart:
+		a.mode.transition(ModeTeleoperation, true)
+	}
+}
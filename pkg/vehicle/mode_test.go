@@ -0,0 +1,91 @@
+package vehicle
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func sendCommand(t *testing.T, agent *Agent, mc *mockClient, action string) {
+	t.Helper()
+	data, _ := protocol.Marshal(&protocol.ControlCommand{VehicleID: "car-001", Action: action})
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+}
+
+func TestModeValidTransitions(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	var changes []string
+	agent.OnModeChange(func(from, to Mode) { changes = append(changes, string(from)+"->"+string(to)) })
+
+	if got := agent.Mode(); got != ModeAutonomous {
+		t.Fatalf("initial mode = %s, want autonomous", got)
+	}
+	if err := agent.RaiseAlert("extreme_weather", 0, 0, 3); err != nil {
+		t.Fatalf("RaiseAlert: %v", err)
+	}
+	if err := agent.SetMode(ModeManual); err != nil {
+		t.Fatalf("teleoperation -> manual: %v", err)
+	}
+	sendCommand(t, agent, mc, protocol.ActionResume)
+
+	want := []string{"autonomous->teleoperation", "teleoperation->manual", "manual->autonomous"}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %s, want %s", i, changes[i], want[i])
+		}
+	}
+
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+	mc.mu.Lock()
+	last := mc.published[len(mc.published)-1]
+	mc.mu.Unlock()
+	var s protocol.VehicleState
+	if err := protocol.Unmarshal(last.payload, &s); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if s.Mode != string(ModeAutonomous) {
+		t.Errorf("published mode = %q, want autonomous", s.Mode)
+	}
+}
+
+func TestModeInvalidTransitions(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	if err := agent.SetMode(ModeManual); err != nil {
+		t.Fatalf("autonomous -> manual: %v", err)
+	}
+	for _, to := range []Mode{ModeAutonomous, ModeTeleoperation, Mode("parked")} {
+		if err := agent.SetMode(to); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("manual -> %s: err = %v, want ErrInvalidTransition", to, err)
+		}
+	}
+	if got := agent.Mode(); got != ModeManual {
+		t.Errorf("mode = %s, want manual", got)
+	}
+
+	// An alert does not take control away from the safety driver.
+	agent.RaiseAlert("sensor_fault", 0, 0, 2)
+	if got := agent.Mode(); got != ModeManual {
+		t.Errorf("mode after alert = %s, want manual", got)
+	}
+
+	// The control center can hand the vehicle to an operator explicitly.
+	sendCommand(t, agent, mc, protocol.ActionTeleoperationStart)
+	if got := agent.Mode(); got != ModeTeleoperation {
+		t.Errorf("mode after teleoperation_start = %s, want teleoperation", got)
+	}
+	if err := agent.SetMode(ModeAutonomous); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("teleoperation -> autonomous: err = %v, want ErrInvalidTransition", err)
+	}
+}
@@ -0,0 +1,81 @@
+package vehicle
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures an Agent built with NewWithOptions.
+type Option func(*Config)
+
+// NewWithOptions creates an Agent from functional options. It is equivalent
+// to calling New with a Config populated by opts.
+func NewWithOptions(stateProvider StateProvider, opts ...Option) *Agent {
+	var cfg Config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return New(cfg, stateProvider)
+}
+
+// WithVehicleID sets the unique vehicle identifier.
+func WithVehicleID(id string) Option {
+	return func(c *Config) { c.VehicleID = id }
+}
+
+// WithBroker sets the MQTT broker URL.
+func WithBroker(url string) Option {
+	return func(c *Config) { c.BrokerURL = url }
+}
+
+// WithTLS enables mutual TLS using the given certificate, key and CA files.
+func WithTLS(certFile, keyFile, caFile string) Option {
+	return func(c *Config) {
+		c.CertFile = certFile
+		c.KeyFile = keyFile
+		c.CAFile = caFile
+	}
+}
+
+// WithTLSPEM enables mutual TLS using in-memory PEM instead of files (see
+// Config.CertPEM).
+func WithTLSPEM(certPEM, keyPEM, caPEM []byte) Option {
+	return func(c *Config) {
+		c.CertPEM = certPEM
+		c.KeyPEM = keyPEM
+		c.CAPEM = caPEM
+	}
+}
+
+// WithPublishHz sets the state publication frequency.
+func WithPublishHz(hz float64) Option {
+	return func(c *Config) { c.PublishHz = hz }
+}
+
+// WithTopicPrefixes sets the topic namespaces to publish under (see
+// Config.TopicPrefixes).
+func WithTopicPrefixes(prefixes ...string) Option {
+	return func(c *Config) { c.TopicPrefixes = prefixes }
+}
+
+// WithTracerProvider continues control-center traces on the vehicle with a
+// tracer from tp (see Config.TracerProvider).
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Config) { c.TracerProvider = tp }
+}
+
+// WithMinPublishSeverity keeps alerts below severity local, escalating them
+// after they persist for escalateAfter (see Config.MinPublishSeverity).
+func WithMinPublishSeverity(severity int32, escalateAfter time.Duration) Option {
+	return func(c *Config) {
+		c.MinPublishSeverity = severity
+		c.EscalateAfter = escalateAfter
+	}
+}
+
+// WithMonotonicTimestamps clamps published timestamps so they never go
+// backwards (see Config.MonotonicTimestamps).
+func WithMonotonicTimestamps() Option {
+	return func(c *Config) { c.MonotonicTimestamps = true }
+}
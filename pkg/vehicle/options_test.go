@@ -0,0 +1,37 @@
+package vehicle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewWithOptionsBuildsConfig(t *testing.T) {
+	a := NewWithOptions(stateProvider("car-001"),
+		WithVehicleID("car-001"),
+		WithBroker("tls://broker:8883"),
+		WithTLS("cert.pem", "key.pem", "ca.pem"),
+		WithTLSPEM([]byte("cert"), []byte("key"), []byte("ca")),
+		WithPublishHz(20),
+		WithTopicPrefixes("v2/vehicle", "v1/vehicle"),
+	)
+
+	want := Config{
+		VehicleID: "car-001",
+		BrokerURL: "tls://broker:8883",
+		PublishHz: 20,
+		CertFile:  "cert.pem",
+		KeyFile:   "key.pem",
+		CAFile:    "ca.pem",
+		CertPEM:   []byte("cert"),
+		KeyPEM:    []byte("key"),
+		CAPEM:     []byte("ca"),
+
+		TopicPrefixes: []string{"v2/vehicle", "v1/vehicle"},
+	}
+	if !reflect.DeepEqual(a.cfg, want) {
+		t.Errorf("cfg = %+v, want %+v", a.cfg, want)
+	}
+	if a.stateFn == nil {
+		t.Error("state provider not set")
+	}
+}
@@ -0,0 +1,45 @@
+package vehicle
+
+import "github.com/daohu527/vlink/pkg/protocol"
+
+// PausePublishing stops periodic state publication, e.g. during maintenance,
+// while keeping the MQTT connection and control subscription active. The
+// vehicle still answers request_state commands. Metrics reports Paused, and
+// the status topic reports protocol.StatusPaused until ResumePublishing, so
+// the control center does not mistake the silence for a fault.
+func (a *Agent) PausePublishing() {
+	if !a.paused.Swap(true) {
+		a.log.Info("state publishing paused")
+		a.announceStatus()
+	}
+}
+
+// ResumePublishing restarts periodic state publication from the next tick
+// and reports the vehicle online again.
+func (a *Agent) ResumePublishing() {
+	if a.paused.Swap(false) {
+		a.log.Info("state publishing resumed")
+		a.announceStatus()
+	}
+}
+
+// status returns the status the agent reports while connected.
+func (a *Agent) status() string {
+	if a.paused.Load() {
+		return protocol.StatusPaused
+	}
+	return protocol.StatusOnline
+}
+
+// announceStatus publishes the agent's status if it has a client; onConnect
+// publishes it otherwise.
+func (a *Agent) announceStatus() {
+	if a.client != nil && a.client.IsConnected() {
+		a.publishStatus(a.client, a.status())
+	}
+}
+
+// Paused reports whether periodic state publication is paused.
+func (a *Agent) Paused() bool {
+	return a.paused.Load()
+}
@@ -0,0 +1,97 @@
+package vehicle
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/controlcenter"
+	"github.com/daohu527/vlink/pkg/membroker"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func countStates(mc *mockClient) int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	n := 0
+	for _, m := range mc.published {
+		if m.topic == protocol.StateTopic("car-001") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPausePublishingKeepsCommandsFlowing(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", PublishHz: 50}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+	agent.subscribeControl(mc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		agent.Run(ctx)
+		close(done)
+	}()
+
+	agent.PausePublishing()
+	if !agent.Metrics().Paused {
+		t.Error("Metrics.Paused = false while paused")
+	}
+	time.Sleep(30 * time.Millisecond) // let an in-flight tick finish
+	before := countStates(mc)
+	time.Sleep(100 * time.Millisecond)
+	if got := countStates(mc); got != before {
+		t.Errorf("published %d states while paused", got-before)
+	}
+
+	// The control subscription stays active.
+	sendCommand(t, agent, mc, protocol.ActionStop)
+	if ack := lastAck(t, mc); ack.Status != protocol.AckCompleted {
+		t.Errorf("ack while paused = %+v, want completed", ack)
+	}
+
+	agent.ResumePublishing()
+	time.Sleep(100 * time.Millisecond)
+	if got := countStates(mc); got == before {
+		t.Error("publishing did not resume")
+	}
+	if agent.Paused() {
+		t.Error("Paused() = true after ResumePublishing")
+	}
+	cancel()
+	<-done
+}
+
+func TestPauseIsReportedOnStatusTopic(t *testing.T) {
+	b := membroker.New()
+	srv := controlcenter.New(controlcenter.Config{ClientID: "cc"})
+	srv.ConnectWithClient(b.Client("cc"))
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	agent.ConnectWithClient(b.Client("car-001"))
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+
+	agent.PausePublishing()
+	if e, _ := srv.Shadows().Get("car-001"); !e.Paused || !e.Online {
+		t.Errorf("entry after pause = %+v, want online and paused", e)
+	}
+	agent.ResumePublishing()
+	if e, _ := srv.Shadows().Get("car-001"); e.Paused || !e.Online {
+		t.Errorf("entry after resume = %+v, want online, not paused", e)
+	}
+
+	var statuses []string
+	for _, m := range b.Messages() {
+		if m.Topic == protocol.StatusTopic("car-001") {
+			statuses = append(statuses, string(m.Payload))
+		}
+	}
+	if want := []string{protocol.StatusPaused, protocol.StatusOnline}; !slices.Equal(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+}
@@ -0,0 +1,34 @@
+package vehicle
+
+import (
+	"errors"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// errNoPayloadKey rejects an encrypted payload received without a key.
+var errNoPayloadKey = errors.New("vehicle: encrypted payload but no PayloadKey configured")
+
+// openPayload replaces an encrypted cmd.Payload with its plaintext. It
+// fails for payloads that do not authenticate, for encrypted payloads
+// without a key, and for plaintext payloads once a key is configured unless
+// Config.AllowPlaintextPayloads is set.
+func (a *Agent) openPayload(cmd *protocol.ControlCommand) error {
+	if a.keyErr != nil {
+		return a.keyErr
+	}
+	sealed := protocol.IsSealedPayload(cmd.Payload)
+	switch {
+	case sealed && a.payloads == nil:
+		return errNoPayloadKey
+	case sealed:
+		plain, err := a.payloads.Open(cmd)
+		if err != nil {
+			return err
+		}
+		cmd.Payload = plain
+	case cmd.Payload != "" && a.payloads != nil && !a.cfg.AllowPlaintextPayloads:
+		return protocol.ErrPlaintextPayload
+	}
+	return nil
+}
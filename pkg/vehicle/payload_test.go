@@ -0,0 +1,104 @@
+package vehicle
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/controlcenter"
+	"github.com/daohu527/vlink/pkg/membroker"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+var testPayloadKey = []byte("0123456789abcdef")
+
+func TestEncryptedPayloadEndToEnd(t *testing.T) {
+	b := membroker.New()
+	srv := controlcenter.New(controlcenter.Config{ClientID: "cc", PayloadKey: testPayloadKey})
+	srv.ConnectWithClient(b.Client("cc"))
+
+	agent := New(Config{VehicleID: "car-001", PayloadKey: testPayloadKey}, stateProvider("car-001"))
+	vc := b.Client("car-001")
+	agent.ConnectWithClient(vc)
+	agent.subscribeControl(vc)
+
+	payload, _ := protocol.Marshal(protocol.PublishHzPayload{Hz: 40})
+	cmd := &protocol.ControlCommand{CommandID: "c-1", VehicleID: "car-001", Action: protocol.ActionSetPublishHz, Payload: string(payload)}
+	if err := srv.SendControl(cmd); err != nil {
+		t.Fatalf("SendControl: %v", err)
+	}
+	if cmd.Payload != string(payload) {
+		t.Error("SendControl modified the caller's payload")
+	}
+	if got := agent.PublishHz(); got != 40 {
+		t.Errorf("PublishHz = %v, want 40 from the decrypted payload", got)
+	}
+	for _, m := range b.Messages() {
+		if m.Topic == protocol.ControlTopic("car-001") && strings.Contains(string(m.Payload), `"hz"`) {
+			t.Errorf("command payload visible on the broker: %s", m.Payload)
+		}
+	}
+}
+
+func TestPayloadRejectedUnlessAuthenticated(t *testing.T) {
+	c, _ := protocol.NewPayloadCipher(testPayloadKey)
+	payload, _ := protocol.Marshal(protocol.PublishHzPayload{Hz: 40})
+
+	sealedFor := func(vehicleID string) string {
+		s, _ := c.Seal(&protocol.ControlCommand{CommandID: "c-1", VehicleID: vehicleID, Action: protocol.ActionSetPublishHz, Payload: string(payload)})
+		return s
+	}
+	for _, tc := range []struct {
+		name    string
+		cfg     Config
+		payload string
+		want    string
+	}{
+		{"sealed for another vehicle", Config{PayloadKey: testPayloadKey}, sealedFor("car-002"), protocol.AckRejected},
+		{"plaintext with a key", Config{PayloadKey: testPayloadKey}, string(payload), protocol.AckRejected},
+		{"sealed without a key", Config{}, sealedFor("car-001"), protocol.AckRejected},
+		{"plaintext in transition", Config{PayloadKey: testPayloadKey, AllowPlaintextPayloads: true}, string(payload), protocol.AckCompleted},
+		{"sealed in transition", Config{PayloadKey: testPayloadKey, AllowPlaintextPayloads: true}, sealedFor("car-001"), protocol.AckCompleted},
+	} {
+		tc.cfg.VehicleID = "car-001"
+		agent := New(tc.cfg, stateProvider("car-001"))
+		mc := newMockClient()
+		agent.ConnectWithClient(mc)
+
+		data, _ := protocol.Marshal(&protocol.ControlCommand{
+			CommandID: "c-1", VehicleID: "car-001", Action: protocol.ActionSetPublishHz, Payload: tc.payload,
+		})
+		agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+		if ack := lastAck(t, mc); ack.Status != tc.want {
+			t.Errorf("%s: ack = %+v, want %s", tc.name, ack, tc.want)
+		}
+		if tc.want == protocol.AckRejected && agent.PublishHz() != defaultPublishHz {
+			t.Errorf("%s: rejected command changed the publish rate", tc.name)
+		}
+	}
+}
+
+func TestForgedCommandDoesNotClaimItsID(t *testing.T) {
+	c, _ := protocol.NewPayloadCipher(testPayloadKey)
+	payload, _ := protocol.Marshal(protocol.PublishHzPayload{Hz: 40})
+	agent := New(Config{VehicleID: "car-001", PayloadKey: testPayloadKey}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	// A forger reuses the ID of a command the control center is about to
+	// send, with a payload that fails authentication.
+	forged, _ := protocol.Marshal(&protocol.ControlCommand{
+		CommandID: "c-1", VehicleID: "car-001", Action: protocol.ActionSetPublishHz, Payload: string(payload),
+	})
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: forged})
+
+	genuine := &protocol.ControlCommand{CommandID: "c-1", VehicleID: "car-001", Action: protocol.ActionSetPublishHz, Payload: string(payload)}
+	genuine.Payload, _ = c.Seal(genuine)
+	data, _ := protocol.Marshal(genuine)
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+	if ack := lastAck(t, mc); ack.Status != protocol.AckCompleted {
+		t.Errorf("genuine command ack = %+v, want completed", ack)
+	}
+	if got := agent.PublishHz(); got != 40 {
+		t.Errorf("PublishHz = %v, want 40: the genuine command was taken for a duplicate", got)
+	}
+}
@@ -0,0 +1,81 @@
+package vehicle
+
+import (
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// Alert reasons raised by DefaultAlertPolicy.
+const (
+	ReasonEmergency     = "emergency"
+	ReasonSensorFailure = "sensor_failure"
+)
+
+// AlertPolicy decides from each state the agent publishes whether the vehicle
+// needs an operator. It returns nil when all is well, or the alert to raise:
+// the agent uses its Reason, Severity and position, taking the state's
+// position if the alert leaves both coordinates zero, and fills in the rest
+// as RaiseAlert does. It must not modify the state.
+type AlertPolicy func(*protocol.VehicleState) *protocol.TeleoperationAlert
+
+// DefaultAlertPolicy raises a critical alert when the vehicle reports an
+// emergency or a failed sensor (see protocol.SensorHealth).
+func DefaultAlertPolicy(s *protocol.VehicleState) *protocol.TeleoperationAlert {
+	alert := &protocol.TeleoperationAlert{
+		VehicleID: s.VehicleID,
+		Latitude:  s.Latitude,
+		Longitude: s.Longitude,
+		Severity:  3,
+	}
+	switch {
+	case s.Emergency:
+		alert.Reason = ReasonEmergency
+	case len(s.Sensors.Failed()) > 0:
+		alert.Reason = ReasonSensorFailure
+	default:
+		return nil
+	}
+	return alert
+}
+
+// checkPolicy evaluates Config.AlertPolicy for state and raises its alert.
+// Like the threshold checks it is edge-triggered: an alert is raised when
+// the policy starts returning a reason, not on every tick while it keeps
+// returning it. A tick without an alert, or with another reason, re-arms it.
+func (a *Agent) checkPolicy(state *protocol.VehicleState) {
+	if a.cfg.AlertPolicy == nil {
+		return
+	}
+	alert := a.evalPolicy(state)
+	reason := ""
+	if alert != nil {
+		reason = alert.Reason
+	}
+
+	a.alertMu.Lock()
+	raise := reason != "" && reason != a.thresholds.policy
+	a.thresholds.policy = reason
+	a.alertMu.Unlock()
+	if !raise {
+		return
+	}
+
+	lat, lon := alert.Latitude, alert.Longitude
+	if lat == 0 && lon == 0 {
+		lat, lon = state.Latitude, state.Longitude
+	}
+	if err := a.RaiseAlert(reason, lat, lon, alert.Severity); err != nil {
+		a.log.Error("raise alert", "reason", reason, "err", err)
+	}
+}
+
+// evalPolicy calls the policy, treating a panic as no alert so that a
+// faulty policy cannot stop state publishing.
+func (a *Agent) evalPolicy(state *protocol.VehicleState) (alert *protocol.TeleoperationAlert) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.log.Error("alert policy panicked", "panic", r)
+			alert = nil
+		}
+	}()
+	return a.cfg.AlertPolicy(state)
+}
@@ -0,0 +1,99 @@
+package vehicle
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestAlertPolicyRaisesOnceAndSwitchesMode(t *testing.T) {
+	battery := float32(50)
+	lowBattery := func(s *protocol.VehicleState) *protocol.TeleoperationAlert {
+		if s.BatteryPct >= 10 {
+			return nil
+		}
+		return &protocol.TeleoperationAlert{Reason: "battery_critical", Severity: 3}
+	}
+	agent := New(Config{VehicleID: "car-001", AlertPolicy: lowBattery}, func() *protocol.VehicleState {
+		return &protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli(),
+			Latitude: 39.9, Longitude: 116.4, BatteryPct: battery}
+	})
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	for _, pct := range []float32{50, 9, 8, 7} {
+		battery = pct
+		if err := agent.publishState(); err != nil {
+			t.Fatalf("publishState: %v", err)
+		}
+	}
+	if got := alertReasons(t, mc); !reflect.DeepEqual(got, []string{"battery_critical"}) {
+		t.Fatalf("alerts = %v, want one battery_critical", got)
+	}
+	if m := agent.Mode(); m != ModeTeleoperation {
+		t.Errorf("Mode = %s, want %s", m, ModeTeleoperation)
+	}
+
+	mc.mu.Lock()
+	var alert protocol.TeleoperationAlert
+	for _, m := range mc.published {
+		if m.topic == protocol.AlertTopic("car-001") {
+			_ = protocol.Unmarshal(m.payload, &alert)
+		}
+	}
+	mc.mu.Unlock()
+	if alert.Latitude != 39.9 || alert.Longitude != 116.4 || alert.Severity != 3 || alert.AlertID == "" {
+		t.Errorf("alert = %+v, want the state's position, severity 3 and an ID", alert)
+	}
+
+	// Recovering re-arms the policy.
+	for _, pct := range []float32{60, 5} {
+		battery = pct
+		if err := agent.publishState(); err != nil {
+			t.Fatalf("publishState: %v", err)
+		}
+	}
+	if got := alertReasons(t, mc); len(got) != 2 {
+		t.Errorf("alerts = %v, want a second one after recovery", got)
+	}
+}
+
+func TestAlertPolicyPanicDoesNotStopPublishing(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", AlertPolicy: func(*protocol.VehicleState) *protocol.TeleoperationAlert {
+		panic("bad policy")
+	}}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if len(mc.published) != 1 || mc.published[0].topic != protocol.StateTopic("car-001") {
+		t.Errorf("published = %v, want the state only", mc.published)
+	}
+}
+
+func TestDefaultAlertPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		state protocol.VehicleState
+		want  string
+	}{
+		{"healthy", protocol.VehicleState{Sensors: protocol.SensorHealth{Lidar: protocol.SensorOK}}, ""},
+		{"degraded sensor", protocol.VehicleState{Sensors: protocol.SensorHealth{GPS: protocol.SensorDegraded}}, ""},
+		{"emergency", protocol.VehicleState{Emergency: true}, ReasonEmergency},
+		{"failed sensor", protocol.VehicleState{Sensors: protocol.SensorHealth{Lidar: protocol.SensorFailed}}, ReasonSensorFailure},
+	} {
+		alert := DefaultAlertPolicy(&tc.state)
+		switch {
+		case tc.want == "" && alert != nil:
+			t.Errorf("%s: alert %+v, want none", tc.name, alert)
+		case tc.want != "" && (alert == nil || alert.Reason != tc.want || alert.Severity != 3):
+			t.Errorf("%s: alert %+v, want critical %s", tc.name, alert, tc.want)
+		}
+	}
+}
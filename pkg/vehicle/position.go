@@ -0,0 +1,35 @@
+package vehicle
+
+import "github.com/daohu527/vlink/pkg/protocol"
+
+// LocalState is a vehicle state positioned in a local coordinate system
+// rather than WGS84, e.g. by a localiser working in UTM. X and Y, such as a
+// UTM easting and northing in metres, take the place of State's Latitude
+// and Longitude, which are overwritten once converted.
+type LocalState struct {
+	State *protocol.VehicleState
+	X, Y  float64
+}
+
+// LocalStateProvider is the StateProvider of a vehicle positioned in a
+// local coordinate system; see ConvertPositions.
+type LocalStateProvider func() LocalState
+
+// ConvertPositions adapts fn into a StateProvider that publishes WGS84
+// positions, converting X and Y with conv. A nil State, or a position conv
+// rejects, yields no state, so the agent skips the tick as it does while
+// sensors initialise.
+func ConvertPositions(conv protocol.CoordinateConverter, fn LocalStateProvider) StateProvider {
+	return func() *protocol.VehicleState {
+		local := fn()
+		if local.State == nil {
+			return nil
+		}
+		lat, lon, err := conv.ToWGS84(local.X, local.Y)
+		if err != nil {
+			return nil
+		}
+		local.State.Latitude, local.State.Longitude = lat, lon
+		return local.State
+	}
+}
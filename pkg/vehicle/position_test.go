@@ -0,0 +1,37 @@
+package vehicle
+
+import (
+	"math"
+	"testing"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestConvertPositions(t *testing.T) {
+	const x, y = 444140.54, 3684706.36
+	provider := ConvertPositions(protocol.UTM{Zone: 38, North: true}, func() LocalState {
+		return LocalState{State: &protocol.VehicleState{VehicleID: "car-001"}, X: x, Y: y}
+	})
+	agent := New(Config{VehicleID: "car-001"}, provider)
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+	var s protocol.VehicleState
+	if err := protocol.Unmarshal(mc.published[0].payload, &s); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if math.Abs(s.Latitude-33.3) > 1e-6 || math.Abs(s.Longitude-44.4) > 1e-6 {
+		t.Errorf("published (%f, %f), want WGS84 (33.3, 44.4)", s.Latitude, s.Longitude)
+	}
+
+	// A position the converter rejects is not published as garbage.
+	bad := ConvertPositions(protocol.UTM{Zone: 61, North: true}, func() LocalState {
+		return LocalState{State: &protocol.VehicleState{VehicleID: "car-001"}, X: x, Y: y}
+	})
+	if got := bad(); got != nil {
+		t.Errorf("state for an unconvertible position = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,97 @@
+package vehicle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// defaultPublishHz applies when Config.PublishHz is not set.
+const defaultPublishHz = 10
+
+// Publish rates accepted from the control center, in Hz.
+const (
+	minPublishHz = 10
+	maxPublishHz = 50
+)
+
+// PublishHz returns the effective state publish rate: the control-center
+// override if one is active, otherwise Config.PublishHz as last set by
+// Reconfigure or SetPublishHz, raised to Config.TeleopPublishHz while in
+// teleoperation mode.
+func (a *Agent) PublishHz() float64 {
+	a.rateMu.Lock()
+	defer a.rateMu.Unlock()
+	hz := float64(defaultPublishHz)
+	switch {
+	case a.hzOverride > 0:
+		hz = a.hzOverride
+	case a.settings().publishHz > 0:
+		hz = a.settings().publishHz
+	}
+	return max(hz, a.hzTeleop)
+}
+
+// SetPublishHz changes the configured state publish rate, like Reconfigure
+// with only PublishHz set. It is safe to call while Run is running: Run
+// resets its ticker to the new interval on its own goroutine.
+func (a *Agent) SetPublishHz(hz float64) error {
+	return a.Reconfigure(ConfigUpdate{PublishHz: &hz})
+}
+
+// teleopRate applies Config.TeleopPublishHz on entering teleoperation mode
+// and lifts it on leaving.
+func (a *Agent) teleopRate(from, to Mode) {
+	boost := a.cfg.TeleopPublishHz
+	if boost == 0 {
+		boost = maxPublishHz
+	}
+	switch {
+	case boost < 0:
+		return
+	case to == ModeTeleoperation:
+	case from == ModeTeleoperation:
+		boost = 0
+	default:
+		return
+	}
+	a.rateMu.Lock()
+	a.hzTeleop = boost
+	a.rateMu.Unlock()
+	a.wakeRun()
+}
+
+func (a *Agent) publishInterval() time.Duration {
+	return time.Duration(float64(time.Second) / a.PublishHz())
+}
+
+// setPublishHz handles ActionSetPublishHz.
+func (a *Agent) setPublishHz(payload string) (string, string) {
+	var p protocol.PublishHzPayload
+	if err := protocol.Unmarshal([]byte(payload), &p); err != nil {
+		return protocol.AckRejected, fmt.Sprintf("bad payload: %v", err)
+	}
+	if p.Hz < minPublishHz || p.Hz > maxPublishHz {
+		return protocol.AckRejected, fmt.Sprintf("publish rate %.1f Hz outside %d–%d Hz", p.Hz, minPublishHz, maxPublishHz)
+	}
+	a.overridePublishHz(p.Hz)
+	return protocol.AckCompleted, ""
+}
+
+// overridePublishHz sets the rate override (zero clears it) and wakes Run so
+// the ticker picks up the new interval.
+func (a *Agent) overridePublishHz(hz float64) {
+	a.rateMu.Lock()
+	a.hzOverride = hz
+	a.rateMu.Unlock()
+	a.wakeRun()
+}
+
+// wakeRun makes Run re-read the publish interval.
+func (a *Agent) wakeRun() {
+	select {
+	case a.rateChanged <- struct{}{}:
+	default:
+	}
+}
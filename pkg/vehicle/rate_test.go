@@ -0,0 +1,161 @@
+package vehicle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func lastAck(t *testing.T, mc *mockClient) protocol.CommandAck {
+	t.Helper()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for i := len(mc.published) - 1; i >= 0; i-- {
+		if mc.published[i].topic == protocol.AckTopic("car-001") {
+			var ack protocol.CommandAck
+			if err := protocol.Unmarshal(mc.published[i].payload, &ack); err != nil {
+				t.Fatalf("decode ack: %v", err)
+			}
+			return ack
+		}
+	}
+	t.Fatal("no ack published")
+	return protocol.CommandAck{}
+}
+
+func TestSetPublishHzChangesInterval(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", PublishHz: 10}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	payload, _ := protocol.Marshal(protocol.PublishHzPayload{Hz: 50})
+	data, _ := protocol.Marshal(&protocol.ControlCommand{
+		CommandID: "c-1", VehicleID: "car-001", Action: protocol.ActionSetPublishHz, Payload: string(payload),
+	})
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+
+	if ack := lastAck(t, mc); ack.Status != protocol.AckCompleted {
+		t.Fatalf("ack = %+v, want completed", ack)
+	}
+	if got := agent.publishInterval(); got != 20*time.Millisecond {
+		t.Errorf("interval = %v, want 20ms", got)
+	}
+
+	sendCommand(t, agent, mc, protocol.ActionResetPublishHz)
+	if got := agent.publishInterval(); got != 100*time.Millisecond {
+		t.Errorf("interval after reset = %v, want 100ms", got)
+	}
+}
+
+func TestSetPublishHzRejectsOutOfRange(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", PublishHz: 20}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	payload, _ := protocol.Marshal(protocol.PublishHzPayload{Hz: 500})
+	data, _ := protocol.Marshal(&protocol.ControlCommand{
+		CommandID: "c-1", VehicleID: "car-001", Action: protocol.ActionSetPublishHz, Payload: string(payload),
+	})
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+
+	if ack := lastAck(t, mc); ack.Status != protocol.AckRejected {
+		t.Errorf("ack = %+v, want rejected", ack)
+	}
+	if got := agent.PublishHz(); got != 20 {
+		t.Errorf("PublishHz = %v, want configured 20", got)
+	}
+}
+
+func TestRunAppliesPublishHzOverride(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", PublishHz: 10}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+	agent.overridePublishHz(50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_ = agent.Run(ctx)
+
+	mc.mu.Lock()
+	n := len(mc.published)
+	mc.mu.Unlock()
+	// 10 Hz would yield about 3 states; 50 Hz about 15.
+	if n < 8 {
+		t.Errorf("published %d states in 300ms, want the 50 Hz override applied", n)
+	}
+}
+
+func TestRaiseAlertShortensPublishInterval(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", PublishHz: 10}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	if got := agent.publishInterval(); got != 100*time.Millisecond {
+		t.Fatalf("initial interval = %v, want 100ms", got)
+	}
+	if err := agent.RaiseAlert("sensor fault", 40, 116, 3); err != nil {
+		t.Fatalf("RaiseAlert: %v", err)
+	}
+	if agent.Mode() != ModeTeleoperation {
+		t.Fatalf("mode = %s, want teleoperation", agent.Mode())
+	}
+	if got := agent.publishInterval(); got != 20*time.Millisecond {
+		t.Errorf("interval in teleoperation = %v, want 20ms", got)
+	}
+	select {
+	case <-agent.rateChanged:
+	default:
+		t.Error("Run was not woken to reset its ticker")
+	}
+
+	sendCommand(t, agent, mc, protocol.ActionResume)
+	if got := agent.publishInterval(); got != 100*time.Millisecond {
+		t.Errorf("interval after resume = %v, want 100ms", got)
+	}
+}
+
+func TestTeleopPublishHzConfigurable(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", PublishHz: 10, TeleopPublishHz: 25}, stateProvider("car-001"))
+	agent.ConnectWithClient(newMockClient())
+	_ = agent.RaiseAlert("sensor fault", 40, 116, 3)
+	if got := agent.PublishHz(); got != 25 {
+		t.Errorf("PublishHz = %v, want 25", got)
+	}
+
+	off := New(Config{VehicleID: "car-001", PublishHz: 10, TeleopPublishHz: -1}, stateProvider("car-001"))
+	off.ConnectWithClient(newMockClient())
+	_ = off.RaiseAlert("sensor fault", 40, 116, 3)
+	if got := off.PublishHz(); got != 10 {
+		t.Errorf("PublishHz with boost disabled = %v, want 10", got)
+	}
+}
+
+func TestSetPublishHzWhileRunning(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", PublishHz: 10}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = agent.Run(ctx)
+	}()
+	if err := agent.SetPublishHz(50); err != nil {
+		t.Fatalf("SetPublishHz: %v", err)
+	}
+	if err := agent.SetPublishHz(500); err == nil {
+		t.Error("SetPublishHz accepted 500 Hz")
+	}
+	<-done
+
+	mc.mu.Lock()
+	n := len(mc.published)
+	mc.mu.Unlock()
+	if n < 8 {
+		t.Errorf("published %d states in 300ms, want the 50 Hz rate applied", n)
+	}
+}
@@ -0,0 +1,192 @@
+package vehicle
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/teleoperation"
+)
+
+// Alert reasons raised by the agent's own threshold checks.
+const (
+	ReasonLowBattery   = "low_battery"
+	ReasonGeofenceExit = "geofence_exit"
+)
+
+// ErrNotHotReloadable is returned by Reconfigure for settings that only take
+// effect on a new connection.
+var ErrNotHotReloadable = errors.New("setting requires reconnecting")
+
+// settings are the Config values that may change while the agent runs. They
+// are replaced as a whole, so readers always see a consistent set.
+type settings struct {
+	publishHz          float64
+	minPublishSeverity int32
+	escalateAfter      time.Duration
+	progressInterval   time.Duration
+	lowBatteryPct      float32
+	geofence           *teleoperation.BoundingBox
+}
+
+func settingsOf(cfg Config) *settings {
+	return &settings{
+		publishHz:          cfg.PublishHz,
+		minPublishSeverity: cfg.MinPublishSeverity,
+		escalateAfter:      cfg.EscalateAfter,
+		progressInterval:   cfg.ProgressInterval,
+		lowBatteryPct:      cfg.LowBatteryPct,
+		geofence:           cfg.Geofence,
+	}
+}
+
+func (a *Agent) settings() *settings { return a.live.Load() }
+
+// ConfigUpdate is a partial Config for Reconfigure; nil fields are left
+// unchanged. The connection fields exist only so that an attempt to change
+// them is reported instead of silently ignored.
+type ConfigUpdate struct {
+	PublishHz          *float64
+	MinPublishSeverity *int32
+	EscalateAfter      *time.Duration
+	ProgressInterval   *time.Duration
+	LowBatteryPct      *float32
+	// Geofence replaces the operating area; ClearGeofence removes it.
+	Geofence      *teleoperation.BoundingBox
+	ClearGeofence bool
+
+	// Not hot-reloadable.
+	VehicleID, BrokerURL *string
+	CertFile, KeyFile    *string
+	CAFile               *string
+	Username, Password   *string
+	TopicPrefixes        []string
+}
+
+// Reconfigure applies u to the running agent. The new values are validated
+// first and then applied all at once, or not at all if any is invalid or
+// names a connection setting. A publish rate change takes effect on the
+// next tick; a set_publish_hz override from the control center still takes
+// precedence until reset.
+func (a *Agent) Reconfigure(u ConfigUpdate) error {
+	if err := u.checkHotReloadable(); err != nil {
+		return fmt.Errorf("vehicle %s: reconfigure: %w", a.cfg.VehicleID, err)
+	}
+
+	a.reconfMu.Lock()
+	defer a.reconfMu.Unlock()
+	next := *a.settings()
+	if u.PublishHz != nil {
+		next.publishHz = *u.PublishHz
+	}
+	if u.MinPublishSeverity != nil {
+		next.minPublishSeverity = *u.MinPublishSeverity
+	}
+	if u.EscalateAfter != nil {
+		next.escalateAfter = *u.EscalateAfter
+	}
+	if u.ProgressInterval != nil {
+		next.progressInterval = *u.ProgressInterval
+	}
+	if u.LowBatteryPct != nil {
+		next.lowBatteryPct = *u.LowBatteryPct
+	}
+	if u.Geofence != nil {
+		box := *u.Geofence
+		next.geofence = &box
+	}
+	if u.ClearGeofence {
+		next.geofence = nil
+	}
+	if err := next.validate(); err != nil {
+		return fmt.Errorf("vehicle %s: reconfigure: %w", a.cfg.VehicleID, err)
+	}
+
+	prevHz := a.settings().publishHz
+	a.live.Store(&next)
+	if next.publishHz != prevHz {
+		a.wakeRun()
+	}
+	return nil
+}
+
+func (u ConfigUpdate) checkHotReloadable() error {
+	var fields []string
+	for name, set := range map[string]bool{
+		"VehicleID":     u.VehicleID != nil,
+		"BrokerURL":     u.BrokerURL != nil,
+		"CertFile":      u.CertFile != nil,
+		"KeyFile":       u.KeyFile != nil,
+		"CAFile":        u.CAFile != nil,
+		"Username":      u.Username != nil,
+		"Password":      u.Password != nil,
+		"TopicPrefixes": u.TopicPrefixes != nil,
+	} {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	sort.Strings(fields)
+	return fmt.Errorf("%w: %s", ErrNotHotReloadable, strings.Join(fields, ", "))
+}
+
+func (s *settings) validate() error {
+	if s.publishHz != 0 && (s.publishHz < minPublishHz || s.publishHz > maxPublishHz) {
+		return fmt.Errorf("publish rate %.1f Hz outside %d–%d Hz", s.publishHz, minPublishHz, maxPublishHz)
+	}
+	if s.minPublishSeverity < 0 || s.minPublishSeverity > 3 {
+		return fmt.Errorf("minimum publish severity %d outside 0–3", s.minPublishSeverity)
+	}
+	if s.escalateAfter < 0 || s.progressInterval < 0 {
+		return errors.New("negative duration")
+	}
+	if s.lowBatteryPct < 0 || s.lowBatteryPct > 100 {
+		return fmt.Errorf("low battery threshold %.1f%% outside 0–100%%", s.lowBatteryPct)
+	}
+	if g := s.geofence; g != nil {
+		if g.MinLat > g.MaxLat || g.MinLat < -90 || g.MaxLat > 90 ||
+			g.MinLon < -180 || g.MinLon > 180 || g.MaxLon < -180 || g.MaxLon > 180 {
+			return fmt.Errorf("invalid geofence %+v", *g)
+		}
+	}
+	return nil
+}
+
+// thresholdState remembers which threshold alerts are active so each
+// crossing is raised once rather than on every tick.
+type thresholdState struct {
+	lowBattery bool
+	outOfFence bool
+	policy     string // reason last returned by Config.AlertPolicy
+}
+
+// checkThresholds raises an alert when state first crosses the low battery
+// threshold or leaves the geofence. Recovering re-arms the check.
+func (a *Agent) checkThresholds(lat, lon float64, battery float32) {
+	s := a.settings()
+
+	a.alertMu.Lock()
+	low := s.lowBatteryPct > 0 && battery < s.lowBatteryPct
+	raiseLow := low && !a.thresholds.lowBattery
+	a.thresholds.lowBattery = low
+	out := s.geofence != nil && !s.geofence.Contains(lat, lon)
+	raiseFence := out && !a.thresholds.outOfFence
+	a.thresholds.outOfFence = out
+	a.alertMu.Unlock()
+
+	if raiseLow {
+		if err := a.RaiseAlert(ReasonLowBattery, lat, lon, 2); err != nil {
+			a.log.Error("raise alert", "reason", ReasonLowBattery, "err", err)
+		}
+	}
+	if raiseFence {
+		if err := a.RaiseAlert(ReasonGeofenceExit, lat, lon, 3); err != nil {
+			a.log.Error("raise alert", "reason", ReasonGeofenceExit, "err", err)
+		}
+	}
+}
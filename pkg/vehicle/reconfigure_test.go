@@ -0,0 +1,125 @@
+package vehicle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+	"github.com/daohu527/vlink/pkg/teleoperation"
+)
+
+func alertReasons(t *testing.T, mc *mockClient) []string {
+	t.Helper()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var reasons []string
+	for _, m := range mc.published {
+		if m.topic != protocol.AlertTopic("car-001") {
+			continue
+		}
+		var a protocol.TeleoperationAlert
+		if err := protocol.Unmarshal(m.payload, &a); err != nil {
+			t.Fatalf("decode alert: %v", err)
+		}
+		reasons = append(reasons, a.Reason)
+	}
+	return reasons
+}
+
+func TestReconfigureChangesPublishRate(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", PublishHz: 10}, stateProvider("car-001"))
+
+	hz := 40.0
+	if err := agent.Reconfigure(ConfigUpdate{PublishHz: &hz}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	if got := agent.publishInterval(); got != 25*time.Millisecond {
+		t.Errorf("interval = %v, want 25ms", got)
+	}
+	select {
+	case <-agent.rateChanged:
+	default:
+		t.Error("Run was not told to reset its ticker")
+	}
+}
+
+func TestReconfigureGeofenceLive(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	// The provider reports Beijing; fence the vehicle into Shanghai.
+	shanghai := teleoperation.BoundingBox{MinLat: 30.9, MinLon: 121.1, MaxLat: 31.5, MaxLon: 121.9}
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+	if got := alertReasons(t, mc); len(got) != 0 {
+		t.Fatalf("alerts without a geofence: %v", got)
+	}
+
+	if err := agent.Reconfigure(ConfigUpdate{Geofence: &shanghai}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := agent.publishState(); err != nil {
+			t.Fatalf("publishState: %v", err)
+		}
+	}
+	if got := alertReasons(t, mc); len(got) != 1 || got[0] != ReasonGeofenceExit {
+		t.Errorf("alerts = %v, want one %s", got, ReasonGeofenceExit)
+	}
+
+	// Widening the fence to include the vehicle re-arms the check quietly.
+	beijing := teleoperation.BoundingBox{MinLat: 39, MinLon: 116, MaxLat: 41, MaxLon: 117}
+	if err := agent.Reconfigure(ConfigUpdate{Geofence: &beijing}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	if err := agent.publishState(); err != nil {
+		t.Fatalf("publishState: %v", err)
+	}
+	if got := alertReasons(t, mc); len(got) != 1 {
+		t.Errorf("alerts after moving the fence = %v", got)
+	}
+}
+
+func TestReconfigureRejectsInvalidAtomically(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", PublishHz: 20}, stateProvider("car-001"))
+
+	hz, battery := 30.0, float32(120)
+	if err := agent.Reconfigure(ConfigUpdate{PublishHz: &hz, LowBatteryPct: &battery}); err == nil {
+		t.Fatal("expected an error for a battery threshold above 100%")
+	}
+	if got := agent.PublishHz(); got != 20 {
+		t.Errorf("PublishHz = %v after a rejected update, want 20", got)
+	}
+
+	broker := "tcp://other:1883"
+	err := agent.Reconfigure(ConfigUpdate{PublishHz: &hz, BrokerURL: &broker})
+	if !errors.Is(err, ErrNotHotReloadable) {
+		t.Errorf("err = %v, want ErrNotHotReloadable", err)
+	}
+	if got := agent.PublishHz(); got != 20 {
+		t.Errorf("PublishHz = %v after a rejected update, want 20", got)
+	}
+}
+
+func TestLowBatteryAlertRaisedOncePerCrossing(t *testing.T) {
+	battery := float32(50)
+	agent := New(Config{VehicleID: "car-001", LowBatteryPct: 20}, func() *protocol.VehicleState {
+		return &protocol.VehicleState{VehicleID: "car-001", Timestamp: time.Now().UnixMilli(), BatteryPct: battery}
+	})
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	for _, pct := range []float32{50, 19, 18, 25, 15} {
+		battery = pct
+		if err := agent.publishState(); err != nil {
+			t.Fatalf("publishState: %v", err)
+		}
+	}
+	got := alertReasons(t, mc)
+	if len(got) != 2 || got[0] != ReasonLowBattery || got[1] != ReasonLowBattery {
+		t.Errorf("alerts = %v, want two %s", got, ReasonLowBattery)
+	}
+}
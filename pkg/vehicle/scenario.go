@@ -0,0 +1,77 @@
+package vehicle
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// Scenario is a scripted sequence of timed steps used to drive an Agent
+// reproducibly, e.g. "drive straight, stop, raise a weather alert, resume".
+type Scenario struct {
+	Name  string
+	Steps []Step
+}
+
+// Step is a single scripted action executed At the given offset from the
+// scenario start. Within a step the mode change is applied first, then the
+// state is published, then the alert is raised.
+type Step struct {
+	At time.Duration
+	// Mode, when non-empty, becomes the mode stamped on this and every
+	// following state that does not set its own.
+	Mode Mode
+	// State is published on the vehicle's state topic when non-nil.
+	State *protocol.VehicleState
+	// Alert is raised at the last published position when non-nil.
+	Alert *ScenarioAlert
+}
+
+// ScenarioAlert describes a teleoperation alert raised by a Step.
+type ScenarioAlert struct {
+	Reason   string
+	Severity int32
+}
+
+// RunScenario drives the agent through sc. Instead of sleeping, the agent
+// clock is pinned to start+Step.At for each step, so published timestamps
+// and message ordering are identical on every run. RunScenario must not be
+// called concurrently with Run.
+func (a *Agent) RunScenario(sc Scenario, start time.Time) error {
+	steps := make([]Step, len(sc.Steps))
+	copy(steps, sc.Steps)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].At < steps[j].At })
+
+	prevNow := a.now
+	defer func() { a.now = prevNow }()
+
+	mode := ModeAutonomous
+	var lat, lon float64
+	for i, st := range steps {
+		at := start.Add(st.At)
+		a.now = func() time.Time { return at }
+
+		if st.Mode != "" {
+			mode = st.Mode
+		}
+		if st.State != nil {
+			state := *st.State
+			state.VehicleID = a.cfg.VehicleID
+			if state.Mode == "" {
+				state.Mode = string(mode)
+			}
+			if err := a.publish(&state); err != nil {
+				return fmt.Errorf("scenario %s step %d: %w", sc.Name, i, err)
+			}
+			lat, lon = state.Latitude, state.Longitude
+		}
+		if st.Alert != nil {
+			if err := a.RaiseAlert(st.Alert.Reason, lat, lon, st.Alert.Severity); err != nil {
+				return fmt.Errorf("scenario %s step %d: %w", sc.Name, i, err)
+			}
+		}
+	}
+	return nil
+}
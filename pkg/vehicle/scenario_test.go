@@ -0,0 +1,68 @@
+package vehicle
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/membroker"
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func TestRunScenarioEndToEnd(t *testing.T) {
+	b := membroker.New()
+	agent := New(Config{VehicleID: "car-001"}, nil)
+	agent.ConnectWithClient(b.Client("car-001"))
+
+	var got []string
+	observer := b.Client("observer")
+	observer.Subscribe("v1/vehicle/+/state", 0, func(_ mqtt.Client, m mqtt.Message) {
+		var s protocol.VehicleState
+		if err := protocol.Unmarshal(m.Payload(), &s); err != nil {
+			t.Fatalf("decode state: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s ts=%d mode=%s speed=%.0f", m.Topic(), s.Timestamp, s.Mode, s.Speed))
+	})
+	observer.Subscribe("v1/vehicle/+/alert", 1, func(_ mqtt.Client, m mqtt.Message) {
+		var a protocol.TeleoperationAlert
+		if err := protocol.Unmarshal(m.Payload(), &a); err != nil {
+			t.Fatalf("decode alert: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s ts=%d reason=%s lat=%.1f", m.Topic(), a.Timestamp, a.Reason, a.Latitude))
+	})
+
+	sc := Scenario{
+		Name: "weather-stop",
+		Steps: []Step{
+			{At: 0, State: &protocol.VehicleState{Latitude: 39.9, Speed: 10}},
+			{At: 100 * time.Millisecond, State: &protocol.VehicleState{Latitude: 40.0, Speed: 10}},
+			{At: 200 * time.Millisecond, State: &protocol.VehicleState{Latitude: 40.0, Speed: 0}},
+			{At: 300 * time.Millisecond, Mode: "teleoperation", State: &protocol.VehicleState{Latitude: 40.0}, Alert: &ScenarioAlert{Reason: "extreme_weather", Severity: 3}},
+			{At: 400 * time.Millisecond, Mode: "autonomous", State: &protocol.VehicleState{Latitude: 40.1, Speed: 10}},
+		},
+	}
+	start := time.UnixMilli(1_700_000_000_000)
+	if err := agent.RunScenario(sc, start); err != nil {
+		t.Fatalf("RunScenario: %v", err)
+	}
+
+	ms := start.UnixMilli()
+	want := []string{
+		fmt.Sprintf("v1/vehicle/car-001/state ts=%d mode=autonomous speed=10", ms),
+		fmt.Sprintf("v1/vehicle/car-001/state ts=%d mode=autonomous speed=10", ms+100),
+		fmt.Sprintf("v1/vehicle/car-001/state ts=%d mode=autonomous speed=0", ms+200),
+		fmt.Sprintf("v1/vehicle/car-001/state ts=%d mode=teleoperation speed=0", ms+300),
+		fmt.Sprintf("v1/vehicle/car-001/alert ts=%d reason=extreme_weather lat=40.0", ms+300),
+		fmt.Sprintf("v1/vehicle/car-001/state ts=%d mode=autonomous speed=10", ms+400),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("received %d messages, want %d:\n%v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("message %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
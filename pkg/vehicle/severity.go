@@ -0,0 +1,59 @@
+package vehicle
+
+import (
+	"time"
+)
+
+// lowSeverity tracks a below-threshold alert condition, keyed by reason.
+type lowSeverity struct {
+	first time.Time // start of the current occurrence
+	last  time.Time // most recent RaiseAlert for it
+}
+
+// suppressAlert reports whether an alert below Config.MinPublishSeverity
+// should be kept local. It returns false, and the alert is published, once
+// the same reason has been raised continuously for Config.EscalateAfter; a
+// gap longer than EscalateAfter starts a new occurrence. Conditions are
+// only tracked while they can escalate, and are forgotten once such a gap
+// has passed, so raising many distinct reasons does not grow the agent.
+func (a *Agent) suppressAlert(reason string, severity int32) bool {
+	cfg := a.settings()
+	if severity >= cfg.minPublishSeverity {
+		return false
+	}
+	now := a.now()
+
+	a.alertMu.Lock()
+	defer a.alertMu.Unlock()
+	for r, c := range a.lowAlerts {
+		if cfg.escalateAfter <= 0 || now.Sub(c.last) > cfg.escalateAfter {
+			delete(a.lowAlerts, r)
+		}
+	}
+	if cfg.escalateAfter > 0 {
+		c, ok := a.lowAlerts[reason]
+		if !ok {
+			c = &lowSeverity{first: now}
+			a.lowAlerts[reason] = c
+		}
+		c.last = now
+		if now.Sub(c.first) >= cfg.escalateAfter {
+			delete(a.lowAlerts, reason)
+			a.log.Warn("escalating persisting alert", "reason", reason, "persisting", now.Sub(c.first))
+			return false
+		}
+	}
+	a.alertsSuppressed++
+	a.log.Info("local alert below publish threshold", "reason", reason, "severity", severity,
+		"threshold", cfg.minPublishSeverity)
+	return true
+}
+
+// ClearAlert reports that the condition behind alerts with reason has gone
+// away, so that raising it again starts a new occurrence for
+// Config.EscalateAfter instead of continuing the previous one.
+func (a *Agent) ClearAlert(reason string) {
+	a.alertMu.Lock()
+	defer a.alertMu.Unlock()
+	delete(a.lowAlerts, reason)
+}
@@ -0,0 +1,121 @@
+package vehicle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+func publishedAlerts(t *testing.T, mc *mockClient) []protocol.TeleoperationAlert {
+	t.Helper()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var out []protocol.TeleoperationAlert
+	for _, m := range mc.published {
+		if m.topic != protocol.AlertTopic("car-001") {
+			continue
+		}
+		var a protocol.TeleoperationAlert
+		if err := protocol.Unmarshal(m.payload, &a); err != nil {
+			t.Fatalf("decode alert: %v", err)
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+func TestBelowThresholdAlertsStayLocal(t *testing.T) {
+	agent := NewWithOptions(stateProvider("car-001"), WithVehicleID("car-001"), WithMinPublishSeverity(2, 0))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	agent.RaiseAlert("tire_pressure_low", 0, 0, 1)
+	agent.RaiseAlert("tire_pressure_low", 0, 0, 1)
+	agent.RaiseAlert("lidar_degraded", 0, 0, 2)
+
+	alerts := publishedAlerts(t, mc)
+	if len(alerts) != 1 || alerts[0].Reason != "lidar_degraded" {
+		t.Errorf("published = %+v, want only the severity-2 alert", alerts)
+	}
+	if got := agent.Metrics().AlertsSuppressed; got != 2 {
+		t.Errorf("AlertsSuppressed = %d, want 2", got)
+	}
+	if got := agent.Mode(); got != ModeTeleoperation {
+		t.Errorf("mode = %s, want teleoperation after the published alert only", got)
+	}
+}
+
+func TestPersistentLowSeverityAlertEscalates(t *testing.T) {
+	agent := NewWithOptions(stateProvider("car-001"), WithVehicleID("car-001"), WithMinPublishSeverity(2, 10*time.Second))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+	now := time.UnixMilli(1_700_000_000_000)
+	agent.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		agent.RaiseAlert("tire_pressure_low", 0, 0, 1)
+		now = now.Add(2 * time.Second)
+	}
+	if n := len(publishedAlerts(t, mc)); n != 0 {
+		t.Fatalf("published %d alerts before the condition persisted", n)
+	}
+	agent.RaiseAlert("tire_pressure_low", 0, 0, 1) // 10s after the first
+
+	alerts := publishedAlerts(t, mc)
+	if len(alerts) != 1 {
+		t.Fatalf("published %d alerts, want 1 escalation", len(alerts))
+	}
+	if alerts[0].Severity != 2 {
+		t.Errorf("escalated severity = %d, want threshold 2", alerts[0].Severity)
+	}
+
+	// A gap longer than EscalateAfter starts a fresh occurrence.
+	now = now.Add(time.Minute)
+	agent.RaiseAlert("tire_pressure_low", 0, 0, 1)
+	if n := len(publishedAlerts(t, mc)); n != 1 {
+		t.Errorf("published %d alerts, want a new occurrence to stay local", n)
+	}
+}
+
+func TestLowSeverityConditionsArePruned(t *testing.T) {
+	agent := NewWithOptions(stateProvider("car-001"), WithVehicleID("car-001"), WithMinPublishSeverity(2, 10*time.Second))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+	now := time.UnixMilli(1_700_000_000_000)
+	agent.now = func() time.Time { return now }
+	tracked := func() int {
+		agent.alertMu.Lock()
+		defer agent.alertMu.Unlock()
+		return len(agent.lowAlerts)
+	}
+
+	for _, reason := range []string{"tire_pressure_low", "wiper_fault", "cabin_temp_high"} {
+		agent.RaiseAlert(reason, 0, 0, 1)
+	}
+	now = now.Add(11 * time.Second)
+	agent.RaiseAlert("washer_fluid_low", 0, 0, 1)
+	if n := tracked(); n != 1 {
+		t.Errorf("tracking %d conditions, want the expired ones pruned", n)
+	}
+
+	// A cleared condition starts over rather than escalating.
+	now = now.Add(6 * time.Second)
+	agent.ClearAlert("washer_fluid_low")
+	if n := tracked(); n != 0 {
+		t.Errorf("tracking %d conditions after ClearAlert, want 0", n)
+	}
+	agent.RaiseAlert("washer_fluid_low", 0, 0, 1)
+	now = now.Add(6 * time.Second)
+	agent.RaiseAlert("washer_fluid_low", 0, 0, 1)
+	if n := len(publishedAlerts(t, mc)); n != 0 {
+		t.Errorf("published %d alerts, want the cleared condition to start over", n)
+	}
+
+	never := NewWithOptions(stateProvider("car-001"), WithVehicleID("car-001"), WithMinPublishSeverity(2, 0))
+	never.ConnectWithClient(newMockClient())
+	never.RaiseAlert("tire_pressure_low", 0, 0, 1)
+	if len(never.lowAlerts) != 0 {
+		t.Errorf("tracking %d conditions that can never escalate", len(never.lowAlerts))
+	}
+}
@@ -0,0 +1,64 @@
+package vehicle
+
+import (
+	"errors"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// StreamHandler answers a video stream offer from the control center, e.g.
+// by starting a WebRTC session or an RTSP server. It returns the answer's
+// SDP (WebRTC) or URL (RTSP); an error rejects the offer.
+type StreamHandler func(offer *protocol.StreamSignal) (sdp, url string, err error)
+
+// errNoStreamHandler rejects offers when no StreamHandler is registered.
+var errNoStreamHandler = errors.New("no stream handler")
+
+// OnStreamOffer sets the handler answering stream offers. Without one,
+// offers are rejected.
+func (a *Agent) OnStreamOffer(fn StreamHandler) {
+	a.cbMu.Lock()
+	defer a.cbMu.Unlock()
+	a.streamHandler = fn
+}
+
+func (a *Agent) handleStream(_ mqtt.Client, msg mqtt.Message) {
+	offer := &protocol.StreamSignal{}
+	if err := a.codec().Unmarshal(msg.Payload(), offer); err != nil {
+		a.log.Error("bad stream message", "err", err)
+		return
+	}
+	if offer.Type != protocol.StreamOffer {
+		return // our own answers echoed back by the broker
+	}
+
+	a.cbMu.Lock()
+	fn := a.streamHandler
+	a.cbMu.Unlock()
+
+	answer := &protocol.StreamSignal{
+		SessionID: offer.SessionID,
+		VehicleID: a.cfg.VehicleID,
+		Type:      protocol.StreamAnswer,
+		Transport: offer.Transport,
+	}
+	err := errNoStreamHandler
+	if fn != nil {
+		answer.SDP, answer.URL, err = fn(offer)
+	}
+	if err != nil {
+		answer.Error = err.Error()
+	}
+	answer.Timestamp = a.now().UnixMilli()
+
+	data, err := a.codec().Marshal(answer)
+	if err != nil {
+		a.log.Error("encode stream answer", "err", err)
+		return
+	}
+	if err := a.publishAll(protocol.Topics.Stream, 1, data, PublishSync); err != nil {
+		a.log.Error("publish stream answer", "session_id", offer.SessionID, "err", err)
+	}
+}
@@ -0,0 +1,180 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// defaultProgressInterval is used when Config.ProgressInterval is zero.
+const defaultProgressInterval = time.Second
+
+// ProgressFunc reports how far a long-running command has got: percent in
+// 0-100 and the estimated time remaining, zero if unknown.
+type ProgressFunc func(percent float32, eta time.Duration)
+
+// TaskHandler executes a long-running command such as "drive to depot". It
+// runs on its own goroutine after the command has been acked as accepted, may
+// call progress any number of times, and returns the final ack status and
+// reason. An empty status reports completion. ctx is cancelled when the
+// control center cancels the command (see protocol.ActionCancel); the
+// handler should then stop the vehicle's work and return, and the command
+// is acked rejected as cancelled whatever it returns.
+type TaskHandler func(ctx context.Context, cmd *protocol.ControlCommand, progress ProgressFunc) (status, reason string)
+
+// OnTask registers fn to execute commands with the given action. Each
+// reported progress is published at once as an in_progress ack and then
+// repeated every Config.ProgressInterval until fn returns, so the control
+// center can tell a slow task from a lost one.
+func (a *Agent) OnTask(action string, fn TaskHandler) {
+	a.cbMu.Lock()
+	defer a.cbMu.Unlock()
+	if a.tasks == nil {
+		a.tasks = make(map[string]TaskHandler)
+	}
+	a.tasks[action] = fn
+}
+
+func (a *Agent) taskHandler(action string) TaskHandler {
+	a.cbMu.Lock()
+	defer a.cbMu.Unlock()
+	return a.tasks[action]
+}
+
+func (a *Agent) progressInterval() time.Duration {
+	if d := a.settings().progressInterval; d > 0 {
+		return d
+	}
+	return defaultProgressInterval
+}
+
+// startTask registers cmd as a running task that ActionCancel can reach
+// and returns its context. It is called before the task's goroutine starts,
+// so a cancel following the accepted ack always finds the task.
+func (a *Agent) startTask(cmd *protocol.ControlCommand) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	if cmd.CommandID != "" {
+		a.taskMu.Lock()
+		if a.running == nil {
+			a.running = make(map[string]context.CancelCauseFunc)
+		}
+		a.running[cmd.CommandID] = cancel
+		a.taskMu.Unlock()
+	}
+	return ctx, cancel
+}
+
+// runTask runs fn for cmd, publishing its progress, and acks the result.
+// ctx and cancel are from startTask.
+func (a *Agent) runTask(ctx context.Context, cancel context.CancelCauseFunc, cmd *protocol.ControlCommand, fn TaskHandler) {
+	defer cancel(nil)
+	var (
+		mu       sync.Mutex
+		last     *protocol.CommandAck
+		finished bool
+		wg       sync.WaitGroup
+	)
+	publish := func(ack *protocol.CommandAck) {
+		if err := a.publishAck(ack); err != nil {
+			a.log.Error("publish progress", "command_id", cmd.CommandID, "err", err)
+		}
+	}
+	progress := func(percent float32, eta time.Duration) {
+		ack := a.newAck(cmd, protocol.AckInProgress, "")
+		ack.Progress = percent
+		ack.ETA = eta.Milliseconds()
+		mu.Lock()
+		defer mu.Unlock()
+		if finished {
+			return
+		}
+		last = ack
+		publish(ack)
+	}
+
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(a.progressInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				mu.Lock()
+				if last != nil && !finished {
+					again := *last
+					again.Timestamp = a.now().UnixMilli()
+					publish(&again)
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	status, reason := a.callTask(ctx, cmd, fn, progress)
+	// Once deregistered the task can no longer be cancelled, so the cause
+	// read below is final.
+	a.taskMu.Lock()
+	delete(a.running, cmd.CommandID)
+	a.taskMu.Unlock()
+	switch {
+	case errors.Is(context.Cause(ctx), errCancelled):
+		status, reason = protocol.AckRejected, errCancelled.Error()
+	case status == "":
+		status = protocol.AckCompleted
+	}
+	mu.Lock()
+	finished = true
+	mu.Unlock()
+	close(done)
+	wg.Wait()
+
+	if err := a.sendAck(cmd, status, reason); err != nil {
+		a.log.Error("publish ack", "command_id", cmd.CommandID, "err", err)
+	}
+}
+
+// callTask runs fn, turning a panic into a rejection so the control center
+// still receives a final ack.
+func (a *Agent) callTask(ctx context.Context, cmd *protocol.ControlCommand, fn TaskHandler, progress ProgressFunc) (status, reason string) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.log.Error("task panicked", "command_id", cmd.CommandID, "panic", r)
+			status, reason = protocol.AckRejected, fmt.Sprintf("task failed: %v", r)
+		}
+	}()
+	return fn(ctx, cmd, progress)
+}
+
+// errCancelled is the cause of a task's context when an ActionCancel names
+// its command.
+var errCancelled = errors.New("cancelled")
+
+// cancelTask handles ActionCancel: it interrupts the running task of the
+// command named in the payload and reports completed, or rejected if no
+// such task is running, e.g. because the command was not a task or has
+// already finished. The cancelled task sends its own final ack.
+func (a *Agent) cancelTask(cmd *protocol.ControlCommand) (string, string) {
+	var p protocol.CancelPayload
+	if err := protocol.Unmarshal([]byte(cmd.Payload), &p); err != nil || p.CommandID == "" {
+		return protocol.AckRejected, "cancel payload must name a command_id"
+	}
+	a.taskMu.Lock()
+	cancel, ok := a.running[p.CommandID]
+	if ok {
+		cancel(errCancelled)
+	}
+	a.taskMu.Unlock()
+	if !ok {
+		return protocol.AckRejected, fmt.Sprintf("no running task for command %s", p.CommandID)
+	}
+	a.log.Info("task cancelled", "command_id", p.CommandID, "by", cmd.CommandID)
+	return protocol.AckCompleted, ""
+}
@@ -0,0 +1,156 @@
+package vehicle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daohu527/vlink/pkg/protocol"
+)
+
+// acksFor decodes every ack published for commandID, in order.
+func acksFor(t *testing.T, mc *mockClient, commandID string) []protocol.CommandAck {
+	t.Helper()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var acks []protocol.CommandAck
+	for _, m := range mc.published {
+		if m.topic != protocol.AckTopic("car-001") {
+			continue
+		}
+		var ack protocol.CommandAck
+		if err := protocol.Unmarshal(m.payload, &ack); err != nil {
+			t.Fatalf("decode ack: %v", err)
+		}
+		if ack.CommandID == commandID {
+			acks = append(acks, ack)
+		}
+	}
+	return acks
+}
+
+func waitFinalAck(t *testing.T, mc *mockClient, commandID string) []protocol.CommandAck {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		acks := acksFor(t, mc, commandID)
+		if n := len(acks); n > 0 && acks[n-1].Final() {
+			return acks
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no final ack for %s", commandID)
+	return nil
+}
+
+func TestTaskReportsProgressUntilCompletion(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", ProgressInterval: time.Hour}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	agent.OnTask("drive_to_depot", func(_ context.Context, cmd *protocol.ControlCommand, progress ProgressFunc) (string, string) {
+		progress(40, 90*time.Second)
+		progress(80, 30*time.Second)
+		return protocol.AckCompleted, ""
+	})
+	data, _ := protocol.Marshal(&protocol.ControlCommand{CommandID: "t-1", VehicleID: "car-001", Action: "drive_to_depot"})
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+
+	acks := waitFinalAck(t, mc, "t-1")
+	want := []string{protocol.AckAccepted, protocol.AckInProgress, protocol.AckInProgress, protocol.AckCompleted}
+	if len(acks) != len(want) {
+		t.Fatalf("acks = %+v, want statuses %v", acks, want)
+	}
+	for i, ack := range acks {
+		if ack.Status != want[i] {
+			t.Errorf("ack %d status = %q, want %q", i, ack.Status, want[i])
+		}
+	}
+	if acks[2].Progress != 80 || acks[2].ETA != 30_000 {
+		t.Errorf("progress = %v%% eta %dms, want 80%% eta 30000ms", acks[2].Progress, acks[2].ETA)
+	}
+}
+
+func TestTaskRepeatsLatestProgress(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", ProgressInterval: 5 * time.Millisecond}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	release := make(chan struct{})
+	agent.OnTask("drive_to_depot", func(_ context.Context, _ *protocol.ControlCommand, progress ProgressFunc) (string, string) {
+		progress(10, 0)
+		<-release
+		return "", ""
+	})
+	data, _ := protocol.Marshal(&protocol.ControlCommand{CommandID: "t-1", VehicleID: "car-001", Action: "drive_to_depot"})
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(acksFor(t, mc, "t-1")) < 4 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+
+	acks := waitFinalAck(t, mc, "t-1")
+	if n := len(acks); n < 4 {
+		t.Fatalf("got %d acks, want the progress repeated", n)
+	}
+	for _, ack := range acks[1 : len(acks)-1] {
+		if ack.Status != protocol.AckInProgress || ack.Progress != 10 {
+			t.Errorf("repeated ack = %+v, want in_progress at 10%%", ack)
+		}
+	}
+	if final := acks[len(acks)-1]; final.Status != protocol.AckCompleted {
+		t.Errorf("final status = %q, want completed", final.Status)
+	}
+}
+
+func TestTaskPanicRejects(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001"}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	agent.OnTask("drive_to_depot", func(context.Context, *protocol.ControlCommand, ProgressFunc) (string, string) {
+		panic("planner crashed")
+	})
+	data, _ := protocol.Marshal(&protocol.ControlCommand{CommandID: "t-1", VehicleID: "car-001", Action: "drive_to_depot"})
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+
+	acks := waitFinalAck(t, mc, "t-1")
+	if final := acks[len(acks)-1]; final.Status != protocol.AckRejected {
+		t.Errorf("final status = %q, want rejected", final.Status)
+	}
+}
+
+func TestCancelInterruptsTask(t *testing.T) {
+	agent := New(Config{VehicleID: "car-001", ProgressInterval: time.Hour}, stateProvider("car-001"))
+	mc := newMockClient()
+	agent.ConnectWithClient(mc)
+
+	agent.OnTask("drive_to_depot", func(ctx context.Context, _ *protocol.ControlCommand, _ ProgressFunc) (string, string) {
+		<-ctx.Done()
+		return protocol.AckCompleted, ""
+	})
+	data, _ := protocol.Marshal(&protocol.ControlCommand{CommandID: "t-1", VehicleID: "car-001", Action: "drive_to_depot"})
+	agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+
+	cancel := func(id, target string) {
+		payload, _ := protocol.Marshal(protocol.CancelPayload{CommandID: target})
+		data, _ := protocol.Marshal(&protocol.ControlCommand{CommandID: id, VehicleID: "car-001", Action: protocol.ActionCancel, Payload: string(payload)})
+		agent.handleControl(mc, &mockMessage{topic: protocol.ControlTopic("car-001"), payload: data})
+	}
+	cancel("c-1", "t-1")
+	if acks := acksFor(t, mc, "c-1"); len(acks) != 1 || acks[0].Status != protocol.AckCompleted {
+		t.Errorf("cancel acks = %+v, want completed", acks)
+	}
+	acks := waitFinalAck(t, mc, "t-1")
+	if final := acks[len(acks)-1]; final.Status != protocol.AckRejected || final.Reason != "cancelled" {
+		t.Errorf("task final ack = %+v, want rejected as cancelled", final)
+	}
+
+	// Nothing left to cancel.
+	cancel("c-2", "t-1")
+	if acks := acksFor(t, mc, "c-2"); len(acks) != 1 || acks[0].Status != protocol.AckRejected {
+		t.Errorf("cancel of a finished task acks = %+v, want rejected", acks)
+	}
+}
@@ -0,0 +1,1413 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v5.29.3
+// source: vlink.proto
+
+package vlinkpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Gear int32
+
+const (
+	Gear_GEAR_UNKNOWN Gear = 0
+	Gear_GEAR_PARK    Gear = 1
+	Gear_GEAR_DRIVE   Gear = 2
+	Gear_GEAR_REVERSE Gear = 3
+	Gear_GEAR_NEUTRAL Gear = 4
+)
+
+// Enum value maps for Gear.
+var (
+	Gear_name = map[int32]string{
+		0: "GEAR_UNKNOWN",
+		1: "GEAR_PARK",
+		2: "GEAR_DRIVE",
+		3: "GEAR_REVERSE",
+		4: "GEAR_NEUTRAL",
+	}
+	Gear_value = map[string]int32{
+		"GEAR_UNKNOWN": 0,
+		"GEAR_PARK":    1,
+		"GEAR_DRIVE":   2,
+		"GEAR_REVERSE": 3,
+		"GEAR_NEUTRAL": 4,
+	}
+)
+
+func (x Gear) Enum() *Gear {
+	p := new(Gear)
+	*p = x
+	return p
+}
+
+func (x Gear) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Gear) Descriptor() protoreflect.EnumDescriptor {
+	return file_vlink_proto_enumTypes[0].Descriptor()
+}
+
+func (Gear) Type() protoreflect.EnumType {
+	return &file_vlink_proto_enumTypes[0]
+}
+
+func (x Gear) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Gear.Descriptor instead.
+func (Gear) EnumDescriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{0}
+}
+
+type SensorStatus int32
+
+const (
+	SensorStatus_SENSOR_UNKNOWN  SensorStatus = 0
+	SensorStatus_SENSOR_OK       SensorStatus = 1
+	SensorStatus_SENSOR_DEGRADED SensorStatus = 2
+	SensorStatus_SENSOR_FAILED   SensorStatus = 3
+)
+
+// Enum value maps for SensorStatus.
+var (
+	SensorStatus_name = map[int32]string{
+		0: "SENSOR_UNKNOWN",
+		1: "SENSOR_OK",
+		2: "SENSOR_DEGRADED",
+		3: "SENSOR_FAILED",
+	}
+	SensorStatus_value = map[string]int32{
+		"SENSOR_UNKNOWN":  0,
+		"SENSOR_OK":       1,
+		"SENSOR_DEGRADED": 2,
+		"SENSOR_FAILED":   3,
+	}
+)
+
+func (x SensorStatus) Enum() *SensorStatus {
+	p := new(SensorStatus)
+	*p = x
+	return p
+}
+
+func (x SensorStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SensorStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_vlink_proto_enumTypes[1].Descriptor()
+}
+
+func (SensorStatus) Type() protoreflect.EnumType {
+	return &file_vlink_proto_enumTypes[1]
+}
+
+func (x SensorStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SensorStatus.Descriptor instead.
+func (SensorStatus) EnumDescriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{1}
+}
+
+// VehicleState is published by the vehicle to v1/vehicle/{id}/state at 10-50 Hz.
+type VehicleState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VehicleId     string                 `protobuf:"bytes,1,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // Unix milliseconds
+	Latitude      float64                `protobuf:"fixed64,3,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude     float64                `protobuf:"fixed64,4,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	Altitude      float64                `protobuf:"fixed64,5,opt,name=altitude,proto3" json:"altitude,omitempty"`
+	Speed         float32                `protobuf:"fixed32,6,opt,name=speed,proto3" json:"speed,omitempty"`     // m/s
+	Heading       float32                `protobuf:"fixed32,7,opt,name=heading,proto3" json:"heading,omitempty"` // degrees, 0-360
+	Gear          Gear                   `protobuf:"varint,8,opt,name=gear,proto3,enum=vlink.Gear" json:"gear,omitempty"`
+	BatteryPct    float32                `protobuf:"fixed32,9,opt,name=battery_pct,json=batteryPct,proto3" json:"battery_pct,omitempty"` // 0-100
+	Mode          string                 `protobuf:"bytes,10,opt,name=mode,proto3" json:"mode,omitempty"`                                // autonomous / manual / teleoperation
+	Emergency     bool                   `protobuf:"varint,11,opt,name=emergency,proto3" json:"emergency,omitempty"`
+	Seq           uint64                 `protobuf:"varint,12,opt,name=seq,proto3" json:"seq,omitempty"`                             // per-vehicle publish sequence number, 0 if unused
+	RequestId     string                 `protobuf:"bytes,13,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"` // command_id of the request_state this answers
+	Replayed      bool                   `protobuf:"varint,14,opt,name=replayed,proto3" json:"replayed,omitempty"`                   // buffered while offline, published after reconnect
+	Sensors       *SensorHealth          `protobuf:"bytes,15,opt,name=sensors,proto3" json:"sensors,omitempty"`                      // omitted when no sensor is reported
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VehicleState) Reset() {
+	*x = VehicleState{}
+	mi := &file_vlink_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VehicleState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VehicleState) ProtoMessage() {}
+
+func (x *VehicleState) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VehicleState.ProtoReflect.Descriptor instead.
+func (*VehicleState) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *VehicleState) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *VehicleState) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *VehicleState) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *VehicleState) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *VehicleState) GetAltitude() float64 {
+	if x != nil {
+		return x.Altitude
+	}
+	return 0
+}
+
+func (x *VehicleState) GetSpeed() float32 {
+	if x != nil {
+		return x.Speed
+	}
+	return 0
+}
+
+func (x *VehicleState) GetHeading() float32 {
+	if x != nil {
+		return x.Heading
+	}
+	return 0
+}
+
+func (x *VehicleState) GetGear() Gear {
+	if x != nil {
+		return x.Gear
+	}
+	return Gear_GEAR_UNKNOWN
+}
+
+func (x *VehicleState) GetBatteryPct() float32 {
+	if x != nil {
+		return x.BatteryPct
+	}
+	return 0
+}
+
+func (x *VehicleState) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *VehicleState) GetEmergency() bool {
+	if x != nil {
+		return x.Emergency
+	}
+	return false
+}
+
+func (x *VehicleState) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *VehicleState) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *VehicleState) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+func (x *VehicleState) GetSensors() *SensorHealth {
+	if x != nil {
+		return x.Sensors
+	}
+	return nil
+}
+
+// SensorHealth reports the status of a vehicle's sensors.
+type SensorHealth struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Lidar         SensorStatus           `protobuf:"varint,1,opt,name=lidar,proto3,enum=vlink.SensorStatus" json:"lidar,omitempty"`
+	Camera        SensorStatus           `protobuf:"varint,2,opt,name=camera,proto3,enum=vlink.SensorStatus" json:"camera,omitempty"`
+	Gps           SensorStatus           `protobuf:"varint,3,opt,name=gps,proto3,enum=vlink.SensorStatus" json:"gps,omitempty"`
+	Imu           SensorStatus           `protobuf:"varint,4,opt,name=imu,proto3,enum=vlink.SensorStatus" json:"imu,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SensorHealth) Reset() {
+	*x = SensorHealth{}
+	mi := &file_vlink_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SensorHealth) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SensorHealth) ProtoMessage() {}
+
+func (x *SensorHealth) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SensorHealth.ProtoReflect.Descriptor instead.
+func (*SensorHealth) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SensorHealth) GetLidar() SensorStatus {
+	if x != nil {
+		return x.Lidar
+	}
+	return SensorStatus_SENSOR_UNKNOWN
+}
+
+func (x *SensorHealth) GetCamera() SensorStatus {
+	if x != nil {
+		return x.Camera
+	}
+	return SensorStatus_SENSOR_UNKNOWN
+}
+
+func (x *SensorHealth) GetGps() SensorStatus {
+	if x != nil {
+		return x.Gps
+	}
+	return SensorStatus_SENSOR_UNKNOWN
+}
+
+func (x *SensorHealth) GetImu() SensorStatus {
+	if x != nil {
+		return x.Imu
+	}
+	return SensorStatus_SENSOR_UNKNOWN
+}
+
+// ControlCommand is published by the control center to v1/vehicle/{id}/control.
+type ControlCommand struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CommandId      string                 `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`
+	VehicleId      string                 `protobuf:"bytes,2,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	Timestamp      int64                  `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // Unix milliseconds
+	Action         string                 `protobuf:"bytes,4,opt,name=action,proto3" json:"action,omitempty"`        // e.g. "stop", "resume", "teleoperation_start"
+	TargetSpeed    float32                `protobuf:"fixed32,5,opt,name=target_speed,json=targetSpeed,proto3" json:"target_speed,omitempty"`
+	TargetHeading  float32                `protobuf:"fixed32,6,opt,name=target_heading,json=targetHeading,proto3" json:"target_heading,omitempty"`
+	Payload        string                 `protobuf:"bytes,7,opt,name=payload,proto3" json:"payload,omitempty"`                                        // JSON-encoded extra parameters
+	HasTargetSpeed bool                   `protobuf:"varint,8,opt,name=has_target_speed,json=hasTargetSpeed,proto3" json:"has_target_speed,omitempty"` // target_speed is explicit (0 = hold stop)
+	TraceParent    string                 `protobuf:"bytes,9,opt,name=trace_parent,json=traceParent,proto3" json:"trace_parent,omitempty"`             // W3C traceparent of the sending span
+	Trajectory     *Trajectory            `protobuf:"bytes,10,opt,name=trajectory,proto3" json:"trajectory,omitempty"`                                 // path of a "follow_trajectory" command
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ControlCommand) Reset() {
+	*x = ControlCommand{}
+	mi := &file_vlink_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ControlCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ControlCommand) ProtoMessage() {}
+
+func (x *ControlCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ControlCommand.ProtoReflect.Descriptor instead.
+func (*ControlCommand) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ControlCommand) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+func (x *ControlCommand) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *ControlCommand) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *ControlCommand) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *ControlCommand) GetTargetSpeed() float32 {
+	if x != nil {
+		return x.TargetSpeed
+	}
+	return 0
+}
+
+func (x *ControlCommand) GetTargetHeading() float32 {
+	if x != nil {
+		return x.TargetHeading
+	}
+	return 0
+}
+
+func (x *ControlCommand) GetPayload() string {
+	if x != nil {
+		return x.Payload
+	}
+	return ""
+}
+
+func (x *ControlCommand) GetHasTargetSpeed() bool {
+	if x != nil {
+		return x.HasTargetSpeed
+	}
+	return false
+}
+
+func (x *ControlCommand) GetTraceParent() string {
+	if x != nil {
+		return x.TraceParent
+	}
+	return ""
+}
+
+func (x *ControlCommand) GetTrajectory() *Trajectory {
+	if x != nil {
+		return x.Trajectory
+	}
+	return nil
+}
+
+// Waypoint is one point of a Trajectory.
+type Waypoint struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Lat           float64                `protobuf:"fixed64,1,opt,name=lat,proto3" json:"lat,omitempty"`
+	Lon           float64                `protobuf:"fixed64,2,opt,name=lon,proto3" json:"lon,omitempty"`
+	TargetSpeed   float32                `protobuf:"fixed32,3,opt,name=target_speed,json=targetSpeed,proto3" json:"target_speed,omitempty"`  // m/s on reaching the waypoint
+	EtaOffsetMs   int64                  `protobuf:"varint,4,opt,name=eta_offset_ms,json=etaOffsetMs,proto3" json:"eta_offset_ms,omitempty"` // after the command's timestamp
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Waypoint) Reset() {
+	*x = Waypoint{}
+	mi := &file_vlink_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Waypoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Waypoint) ProtoMessage() {}
+
+func (x *Waypoint) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Waypoint.ProtoReflect.Descriptor instead.
+func (*Waypoint) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Waypoint) GetLat() float64 {
+	if x != nil {
+		return x.Lat
+	}
+	return 0
+}
+
+func (x *Waypoint) GetLon() float64 {
+	if x != nil {
+		return x.Lon
+	}
+	return 0
+}
+
+func (x *Waypoint) GetTargetSpeed() float32 {
+	if x != nil {
+		return x.TargetSpeed
+	}
+	return 0
+}
+
+func (x *Waypoint) GetEtaOffsetMs() int64 {
+	if x != nil {
+		return x.EtaOffsetMs
+	}
+	return 0
+}
+
+// Trajectory is a path for the vehicle to follow.
+type Trajectory struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Waypoints     []*Waypoint            `protobuf:"bytes,1,rep,name=waypoints,proto3" json:"waypoints,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Trajectory) Reset() {
+	*x = Trajectory{}
+	mi := &file_vlink_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Trajectory) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Trajectory) ProtoMessage() {}
+
+func (x *Trajectory) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Trajectory.ProtoReflect.Descriptor instead.
+func (*Trajectory) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Trajectory) GetWaypoints() []*Waypoint {
+	if x != nil {
+		return x.Waypoints
+	}
+	return nil
+}
+
+// TeleoperationAlert is sent by the vehicle when it needs human intervention.
+type TeleoperationAlert struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VehicleId     string                 `protobuf:"bytes,1,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"` // e.g. "extreme_weather", "unmarked_construction"
+	Latitude      float64                `protobuf:"fixed64,4,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude     float64                `protobuf:"fixed64,5,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	Severity      int32                  `protobuf:"varint,6,opt,name=severity,proto3" json:"severity,omitempty"`             // 1 (low) – 3 (critical)
+	AlertId       string                 `protobuf:"bytes,7,opt,name=alert_id,json=alertId,proto3" json:"alert_id,omitempty"` // vehicle-generated, stable across redeliveries
+	Occurrences   int32                  `protobuf:"varint,8,opt,name=occurrences,proto3" json:"occurrences,omitempty"`       // set by the control center for repeated alerts
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TeleoperationAlert) Reset() {
+	*x = TeleoperationAlert{}
+	mi := &file_vlink_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TeleoperationAlert) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TeleoperationAlert) ProtoMessage() {}
+
+func (x *TeleoperationAlert) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TeleoperationAlert.ProtoReflect.Descriptor instead.
+func (*TeleoperationAlert) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TeleoperationAlert) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *TeleoperationAlert) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *TeleoperationAlert) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *TeleoperationAlert) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *TeleoperationAlert) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *TeleoperationAlert) GetSeverity() int32 {
+	if x != nil {
+		return x.Severity
+	}
+	return 0
+}
+
+func (x *TeleoperationAlert) GetAlertId() string {
+	if x != nil {
+		return x.AlertId
+	}
+	return ""
+}
+
+func (x *TeleoperationAlert) GetOccurrences() int32 {
+	if x != nil {
+		return x.Occurrences
+	}
+	return 0
+}
+
+// CommandAck is published by the vehicle to v1/vehicle/{id}/ack after it
+// processes a ControlCommand.
+type CommandAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CommandId     string                 `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`
+	VehicleId     string                 `protobuf:"bytes,2,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"` // "accepted", "in_progress", "rejected", "completed", "superseded"
+	Reason        string                 `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                       // Unix milliseconds, vehicle clock
+	TraceParent   string                 `protobuf:"bytes,6,opt,name=trace_parent,json=traceParent,proto3" json:"trace_parent,omitempty"` // W3C traceparent propagated back to the center
+	Progress      float32                `protobuf:"fixed32,7,opt,name=progress,proto3" json:"progress,omitempty"`                        // 0-100, in_progress acks only
+	EtaMs         int64                  `protobuf:"varint,8,opt,name=eta_ms,json=etaMs,proto3" json:"eta_ms,omitempty"`                  // milliseconds remaining, in_progress acks only
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandAck) Reset() {
+	*x = CommandAck{}
+	mi := &file_vlink_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandAck) ProtoMessage() {}
+
+func (x *CommandAck) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandAck.ProtoReflect.Descriptor instead.
+func (*CommandAck) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CommandAck) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+func (x *CommandAck) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *CommandAck) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *CommandAck) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *CommandAck) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *CommandAck) GetTraceParent() string {
+	if x != nil {
+		return x.TraceParent
+	}
+	return ""
+}
+
+func (x *CommandAck) GetProgress() float32 {
+	if x != nil {
+		return x.Progress
+	}
+	return 0
+}
+
+func (x *CommandAck) GetEtaMs() int64 {
+	if x != nil {
+		return x.EtaMs
+	}
+	return 0
+}
+
+// FeedAlert is republished by the control center to v1/control/alerts for
+// every alert it accepts, enriched with control-center metadata.
+type FeedAlert struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Alert            *TeleoperationAlert    `protobuf:"bytes,1,opt,name=alert,proto3" json:"alert,omitempty"`
+	ReceivedAt       int64                  `protobuf:"varint,2,opt,name=received_at,json=receivedAt,proto3" json:"received_at,omitempty"` // Unix milliseconds, center clock
+	AssignedOperator string                 `protobuf:"bytes,3,opt,name=assigned_operator,json=assignedOperator,proto3" json:"assigned_operator,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *FeedAlert) Reset() {
+	*x = FeedAlert{}
+	mi := &file_vlink_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FeedAlert) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FeedAlert) ProtoMessage() {}
+
+func (x *FeedAlert) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FeedAlert.ProtoReflect.Descriptor instead.
+func (*FeedAlert) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *FeedAlert) GetAlert() *TeleoperationAlert {
+	if x != nil {
+		return x.Alert
+	}
+	return nil
+}
+
+func (x *FeedAlert) GetReceivedAt() int64 {
+	if x != nil {
+		return x.ReceivedAt
+	}
+	return 0
+}
+
+func (x *FeedAlert) GetAssignedOperator() string {
+	if x != nil {
+		return x.AssignedOperator
+	}
+	return ""
+}
+
+// StreamSignal negotiates a teleoperation video stream over
+// v1/vehicle/{id}/stream (signaling only; media flows out of band).
+type StreamSignal struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	VehicleId     string                 `protobuf:"bytes,2,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	Type          string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`            // "offer" or "answer"
+	Transport     string                 `protobuf:"bytes,4,opt,name=transport,proto3" json:"transport,omitempty"`  // "webrtc" or "rtsp"
+	Sdp           string                 `protobuf:"bytes,5,opt,name=sdp,proto3" json:"sdp,omitempty"`              // WebRTC session description
+	Url           string                 `protobuf:"bytes,6,opt,name=url,proto3" json:"url,omitempty"`              // RTSP stream URL (answer)
+	Error         string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`          // set on an answer rejecting the offer
+	Timestamp     int64                  `protobuf:"varint,8,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // Unix milliseconds, sender clock
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamSignal) Reset() {
+	*x = StreamSignal{}
+	mi := &file_vlink_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamSignal) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamSignal) ProtoMessage() {}
+
+func (x *StreamSignal) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamSignal.ProtoReflect.Descriptor instead.
+func (*StreamSignal) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StreamSignal) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *StreamSignal) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *StreamSignal) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *StreamSignal) GetTransport() string {
+	if x != nil {
+		return x.Transport
+	}
+	return ""
+}
+
+func (x *StreamSignal) GetSdp() string {
+	if x != nil {
+		return x.Sdp
+	}
+	return ""
+}
+
+func (x *StreamSignal) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *StreamSignal) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *StreamSignal) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// ConfigQuery asks a vehicle for its current settings over
+// v1/vehicle/{id}/config_query.
+type ConfigQuery struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	QueryId       string                 `protobuf:"bytes,1,opt,name=query_id,json=queryId,proto3" json:"query_id,omitempty"`
+	VehicleId     string                 `protobuf:"bytes,2,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // Unix milliseconds, center clock
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigQuery) Reset() {
+	*x = ConfigQuery{}
+	mi := &file_vlink_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigQuery) ProtoMessage() {}
+
+func (x *ConfigQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigQuery.ProtoReflect.Descriptor instead.
+func (*ConfigQuery) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ConfigQuery) GetQueryId() string {
+	if x != nil {
+		return x.QueryId
+	}
+	return ""
+}
+
+func (x *ConfigQuery) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *ConfigQuery) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// GeofenceSummary is a WGS84 bounding box; min_lon > max_lon spans the
+// antimeridian.
+type GeofenceSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MinLat        float64                `protobuf:"fixed64,1,opt,name=min_lat,json=minLat,proto3" json:"min_lat,omitempty"`
+	MinLon        float64                `protobuf:"fixed64,2,opt,name=min_lon,json=minLon,proto3" json:"min_lon,omitempty"`
+	MaxLat        float64                `protobuf:"fixed64,3,opt,name=max_lat,json=maxLat,proto3" json:"max_lat,omitempty"`
+	MaxLon        float64                `protobuf:"fixed64,4,opt,name=max_lon,json=maxLon,proto3" json:"max_lon,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GeofenceSummary) Reset() {
+	*x = GeofenceSummary{}
+	mi := &file_vlink_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GeofenceSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GeofenceSummary) ProtoMessage() {}
+
+func (x *GeofenceSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GeofenceSummary.ProtoReflect.Descriptor instead.
+func (*GeofenceSummary) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GeofenceSummary) GetMinLat() float64 {
+	if x != nil {
+		return x.MinLat
+	}
+	return 0
+}
+
+func (x *GeofenceSummary) GetMinLon() float64 {
+	if x != nil {
+		return x.MinLon
+	}
+	return 0
+}
+
+func (x *GeofenceSummary) GetMaxLat() float64 {
+	if x != nil {
+		return x.MaxLat
+	}
+	return 0
+}
+
+func (x *GeofenceSummary) GetMaxLon() float64 {
+	if x != nil {
+		return x.MaxLon
+	}
+	return 0
+}
+
+// ConfigReport answers a ConfigQuery on v1/vehicle/{id}/config.
+type ConfigReport struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	QueryId            string                 `protobuf:"bytes,1,opt,name=query_id,json=queryId,proto3" json:"query_id,omitempty"`
+	VehicleId          string                 `protobuf:"bytes,2,opt,name=vehicle_id,json=vehicleId,proto3" json:"vehicle_id,omitempty"`
+	Timestamp          int64                  `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // Unix milliseconds, vehicle clock
+	FirmwareVersion    string                 `protobuf:"bytes,4,opt,name=firmware_version,json=firmwareVersion,proto3" json:"firmware_version,omitempty"`
+	PublishHz          float64                `protobuf:"fixed64,5,opt,name=publish_hz,json=publishHz,proto3" json:"publish_hz,omitempty"` // effective rate, including overrides
+	MinPublishSeverity int32                  `protobuf:"varint,6,opt,name=min_publish_severity,json=minPublishSeverity,proto3" json:"min_publish_severity,omitempty"`
+	EscalateAfterMs    int64                  `protobuf:"varint,7,opt,name=escalate_after_ms,json=escalateAfterMs,proto3" json:"escalate_after_ms,omitempty"`
+	LowBatteryPct      float32                `protobuf:"fixed32,8,opt,name=low_battery_pct,json=lowBatteryPct,proto3" json:"low_battery_pct,omitempty"`
+	Geofence           *GeofenceSummary       `protobuf:"bytes,9,opt,name=geofence,proto3" json:"geofence,omitempty"`
+	Mode               string                 `protobuf:"bytes,10,opt,name=mode,proto3" json:"mode,omitempty"`
+	Paused             bool                   `protobuf:"varint,11,opt,name=paused,proto3" json:"paused,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *ConfigReport) Reset() {
+	*x = ConfigReport{}
+	mi := &file_vlink_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigReport) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigReport) ProtoMessage() {}
+
+func (x *ConfigReport) ProtoReflect() protoreflect.Message {
+	mi := &file_vlink_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigReport.ProtoReflect.Descriptor instead.
+func (*ConfigReport) Descriptor() ([]byte, []int) {
+	return file_vlink_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ConfigReport) GetQueryId() string {
+	if x != nil {
+		return x.QueryId
+	}
+	return ""
+}
+
+func (x *ConfigReport) GetVehicleId() string {
+	if x != nil {
+		return x.VehicleId
+	}
+	return ""
+}
+
+func (x *ConfigReport) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *ConfigReport) GetFirmwareVersion() string {
+	if x != nil {
+		return x.FirmwareVersion
+	}
+	return ""
+}
+
+func (x *ConfigReport) GetPublishHz() float64 {
+	if x != nil {
+		return x.PublishHz
+	}
+	return 0
+}
+
+func (x *ConfigReport) GetMinPublishSeverity() int32 {
+	if x != nil {
+		return x.MinPublishSeverity
+	}
+	return 0
+}
+
+func (x *ConfigReport) GetEscalateAfterMs() int64 {
+	if x != nil {
+		return x.EscalateAfterMs
+	}
+	return 0
+}
+
+func (x *ConfigReport) GetLowBatteryPct() float32 {
+	if x != nil {
+		return x.LowBatteryPct
+	}
+	return 0
+}
+
+func (x *ConfigReport) GetGeofence() *GeofenceSummary {
+	if x != nil {
+		return x.Geofence
+	}
+	return nil
+}
+
+func (x *ConfigReport) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *ConfigReport) GetPaused() bool {
+	if x != nil {
+		return x.Paused
+	}
+	return false
+}
+
+var File_vlink_proto protoreflect.FileDescriptor
+
+const file_vlink_proto_rawDesc = "" +
+	"\n" +
+	"\vvlink.proto\x12\x05vlink\"\xc1\x03\n" +
+	"\fVehicleState\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x01 \x01(\tR\tvehicleId\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x1a\n" +
+	"\blatitude\x18\x03 \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\x04 \x01(\x01R\tlongitude\x12\x1a\n" +
+	"\baltitude\x18\x05 \x01(\x01R\baltitude\x12\x14\n" +
+	"\x05speed\x18\x06 \x01(\x02R\x05speed\x12\x18\n" +
+	"\aheading\x18\a \x01(\x02R\aheading\x12\x1f\n" +
+	"\x04gear\x18\b \x01(\x0e2\v.vlink.GearR\x04gear\x12\x1f\n" +
+	"\vbattery_pct\x18\t \x01(\x02R\n" +
+	"batteryPct\x12\x12\n" +
+	"\x04mode\x18\n" +
+	" \x01(\tR\x04mode\x12\x1c\n" +
+	"\temergency\x18\v \x01(\bR\temergency\x12\x10\n" +
+	"\x03seq\x18\f \x01(\x04R\x03seq\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\r \x01(\tR\trequestId\x12\x1a\n" +
+	"\breplayed\x18\x0e \x01(\bR\breplayed\x12-\n" +
+	"\asensors\x18\x0f \x01(\v2\x13.vlink.SensorHealthR\asensors\"\xb4\x01\n" +
+	"\fSensorHealth\x12)\n" +
+	"\x05lidar\x18\x01 \x01(\x0e2\x13.vlink.SensorStatusR\x05lidar\x12+\n" +
+	"\x06camera\x18\x02 \x01(\x0e2\x13.vlink.SensorStatusR\x06camera\x12%\n" +
+	"\x03gps\x18\x03 \x01(\x0e2\x13.vlink.SensorStatusR\x03gps\x12%\n" +
+	"\x03imu\x18\x04 \x01(\x0e2\x13.vlink.SensorStatusR\x03imu\"\xe8\x02\n" +
+	"\x0eControlCommand\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x01 \x01(\tR\tcommandId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x02 \x01(\tR\tvehicleId\x12\x1c\n" +
+	"\ttimestamp\x18\x03 \x01(\x03R\ttimestamp\x12\x16\n" +
+	"\x06action\x18\x04 \x01(\tR\x06action\x12!\n" +
+	"\ftarget_speed\x18\x05 \x01(\x02R\vtargetSpeed\x12%\n" +
+	"\x0etarget_heading\x18\x06 \x01(\x02R\rtargetHeading\x12\x18\n" +
+	"\apayload\x18\a \x01(\tR\apayload\x12(\n" +
+	"\x10has_target_speed\x18\b \x01(\bR\x0ehasTargetSpeed\x12!\n" +
+	"\ftrace_parent\x18\t \x01(\tR\vtraceParent\x121\n" +
+	"\n" +
+	"trajectory\x18\n" +
+	" \x01(\v2\x11.vlink.TrajectoryR\n" +
+	"trajectory\"u\n" +
+	"\bWaypoint\x12\x10\n" +
+	"\x03lat\x18\x01 \x01(\x01R\x03lat\x12\x10\n" +
+	"\x03lon\x18\x02 \x01(\x01R\x03lon\x12!\n" +
+	"\ftarget_speed\x18\x03 \x01(\x02R\vtargetSpeed\x12\"\n" +
+	"\reta_offset_ms\x18\x04 \x01(\x03R\vetaOffsetMs\";\n" +
+	"\n" +
+	"Trajectory\x12-\n" +
+	"\twaypoints\x18\x01 \x03(\v2\x0f.vlink.WaypointR\twaypoints\"\xfc\x01\n" +
+	"\x12TeleoperationAlert\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x01 \x01(\tR\tvehicleId\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12\x1a\n" +
+	"\blatitude\x18\x04 \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\x05 \x01(\x01R\tlongitude\x12\x1a\n" +
+	"\bseverity\x18\x06 \x01(\x05R\bseverity\x12\x19\n" +
+	"\balert_id\x18\a \x01(\tR\aalertId\x12 \n" +
+	"\voccurrences\x18\b \x01(\x05R\voccurrences\"\xee\x01\n" +
+	"\n" +
+	"CommandAck\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x01 \x01(\tR\tcommandId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x02 \x01(\tR\tvehicleId\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12\x1c\n" +
+	"\ttimestamp\x18\x05 \x01(\x03R\ttimestamp\x12!\n" +
+	"\ftrace_parent\x18\x06 \x01(\tR\vtraceParent\x12\x1a\n" +
+	"\bprogress\x18\a \x01(\x02R\bprogress\x12\x15\n" +
+	"\x06eta_ms\x18\b \x01(\x03R\x05etaMs\"\x8a\x01\n" +
+	"\tFeedAlert\x12/\n" +
+	"\x05alert\x18\x01 \x01(\v2\x19.vlink.TeleoperationAlertR\x05alert\x12\x1f\n" +
+	"\vreceived_at\x18\x02 \x01(\x03R\n" +
+	"receivedAt\x12+\n" +
+	"\x11assigned_operator\x18\x03 \x01(\tR\x10assignedOperator\"\xd6\x01\n" +
+	"\fStreamSignal\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x02 \x01(\tR\tvehicleId\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x1c\n" +
+	"\ttransport\x18\x04 \x01(\tR\ttransport\x12\x10\n" +
+	"\x03sdp\x18\x05 \x01(\tR\x03sdp\x12\x10\n" +
+	"\x03url\x18\x06 \x01(\tR\x03url\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\x12\x1c\n" +
+	"\ttimestamp\x18\b \x01(\x03R\ttimestamp\"e\n" +
+	"\vConfigQuery\x12\x19\n" +
+	"\bquery_id\x18\x01 \x01(\tR\aqueryId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x02 \x01(\tR\tvehicleId\x12\x1c\n" +
+	"\ttimestamp\x18\x03 \x01(\x03R\ttimestamp\"u\n" +
+	"\x0fGeofenceSummary\x12\x17\n" +
+	"\amin_lat\x18\x01 \x01(\x01R\x06minLat\x12\x17\n" +
+	"\amin_lon\x18\x02 \x01(\x01R\x06minLon\x12\x17\n" +
+	"\amax_lat\x18\x03 \x01(\x01R\x06maxLat\x12\x17\n" +
+	"\amax_lon\x18\x04 \x01(\x01R\x06maxLon\"\x96\x03\n" +
+	"\fConfigReport\x12\x19\n" +
+	"\bquery_id\x18\x01 \x01(\tR\aqueryId\x12\x1d\n" +
+	"\n" +
+	"vehicle_id\x18\x02 \x01(\tR\tvehicleId\x12\x1c\n" +
+	"\ttimestamp\x18\x03 \x01(\x03R\ttimestamp\x12)\n" +
+	"\x10firmware_version\x18\x04 \x01(\tR\x0ffirmwareVersion\x12\x1d\n" +
+	"\n" +
+	"publish_hz\x18\x05 \x01(\x01R\tpublishHz\x120\n" +
+	"\x14min_publish_severity\x18\x06 \x01(\x05R\x12minPublishSeverity\x12*\n" +
+	"\x11escalate_after_ms\x18\a \x01(\x03R\x0fescalateAfterMs\x12&\n" +
+	"\x0flow_battery_pct\x18\b \x01(\x02R\rlowBatteryPct\x122\n" +
+	"\bgeofence\x18\t \x01(\v2\x16.vlink.GeofenceSummaryR\bgeofence\x12\x12\n" +
+	"\x04mode\x18\n" +
+	" \x01(\tR\x04mode\x12\x16\n" +
+	"\x06paused\x18\v \x01(\bR\x06paused*[\n" +
+	"\x04Gear\x12\x10\n" +
+	"\fGEAR_UNKNOWN\x10\x00\x12\r\n" +
+	"\tGEAR_PARK\x10\x01\x12\x0e\n" +
+	"\n" +
+	"GEAR_DRIVE\x10\x02\x12\x10\n" +
+	"\fGEAR_REVERSE\x10\x03\x12\x10\n" +
+	"\fGEAR_NEUTRAL\x10\x04*Y\n" +
+	"\fSensorStatus\x12\x12\n" +
+	"\x0eSENSOR_UNKNOWN\x10\x00\x12\r\n" +
+	"\tSENSOR_OK\x10\x01\x12\x13\n" +
+	"\x0fSENSOR_DEGRADED\x10\x02\x12\x11\n" +
+	"\rSENSOR_FAILED\x10\x03B'Z%github.com/daohu527/vlink/pkg/vlinkpbb\x06proto3"
+
+var (
+	file_vlink_proto_rawDescOnce sync.Once
+	file_vlink_proto_rawDescData []byte
+)
+
+func file_vlink_proto_rawDescGZIP() []byte {
+	file_vlink_proto_rawDescOnce.Do(func() {
+		file_vlink_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_vlink_proto_rawDesc), len(file_vlink_proto_rawDesc)))
+	})
+	return file_vlink_proto_rawDescData
+}
+
+var file_vlink_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_vlink_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_vlink_proto_goTypes = []any{
+	(Gear)(0),                  // 0: vlink.Gear
+	(SensorStatus)(0),          // 1: vlink.SensorStatus
+	(*VehicleState)(nil),       // 2: vlink.VehicleState
+	(*SensorHealth)(nil),       // 3: vlink.SensorHealth
+	(*ControlCommand)(nil),     // 4: vlink.ControlCommand
+	(*Waypoint)(nil),           // 5: vlink.Waypoint
+	(*Trajectory)(nil),         // 6: vlink.Trajectory
+	(*TeleoperationAlert)(nil), // 7: vlink.TeleoperationAlert
+	(*CommandAck)(nil),         // 8: vlink.CommandAck
+	(*FeedAlert)(nil),          // 9: vlink.FeedAlert
+	(*StreamSignal)(nil),       // 10: vlink.StreamSignal
+	(*ConfigQuery)(nil),        // 11: vlink.ConfigQuery
+	(*GeofenceSummary)(nil),    // 12: vlink.GeofenceSummary
+	(*ConfigReport)(nil),       // 13: vlink.ConfigReport
+}
+var file_vlink_proto_depIdxs = []int32{
+	0,  // 0: vlink.VehicleState.gear:type_name -> vlink.Gear
+	3,  // 1: vlink.VehicleState.sensors:type_name -> vlink.SensorHealth
+	1,  // 2: vlink.SensorHealth.lidar:type_name -> vlink.SensorStatus
+	1,  // 3: vlink.SensorHealth.camera:type_name -> vlink.SensorStatus
+	1,  // 4: vlink.SensorHealth.gps:type_name -> vlink.SensorStatus
+	1,  // 5: vlink.SensorHealth.imu:type_name -> vlink.SensorStatus
+	6,  // 6: vlink.ControlCommand.trajectory:type_name -> vlink.Trajectory
+	5,  // 7: vlink.Trajectory.waypoints:type_name -> vlink.Waypoint
+	7,  // 8: vlink.FeedAlert.alert:type_name -> vlink.TeleoperationAlert
+	12, // 9: vlink.ConfigReport.geofence:type_name -> vlink.GeofenceSummary
+	10, // [10:10] is the sub-list for method output_type
+	10, // [10:10] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_vlink_proto_init() }
+func file_vlink_proto_init() {
+	if File_vlink_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_vlink_proto_rawDesc), len(file_vlink_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_vlink_proto_goTypes,
+		DependencyIndexes: file_vlink_proto_depIdxs,
+		EnumInfos:         file_vlink_proto_enumTypes,
+		MessageInfos:      file_vlink_proto_msgTypes,
+	}.Build()
+	File_vlink_proto = out.File
+	file_vlink_proto_goTypes = nil
+	file_vlink_proto_depIdxs = nil
+}
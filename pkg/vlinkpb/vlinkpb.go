@@ -0,0 +1,6 @@
+// Package vlinkpb holds the protobuf messages of proto/vlink.proto,
+// generated by protoc-gen-go. Package protocol converts them to and from its
+// own message types, which are what the rest of vlink works with.
+package vlinkpb
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/daohu527/vlink vlink.proto